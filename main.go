@@ -1,43 +1,1709 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"filesync"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"net"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Exit codes reported by the CLI. Invalid flags exit with 2,
+// as decided by the flag package.
+const (
+	exitOK          = 0  // everything synced cleanly
+	exitFatal       = 1  // setup failed or the sync was aborted
+	exitDiffers     = 3  // --verify, --check or --check-structure found the target not matching the source, or --diff-manifests a difference
+	exitInterrupted = 20 // stopped by SIGINT or SIGTERM (like rsync)
+	exitPartial     = 23 // the sync finished but some files failed (like rsync)
 )
 
 var (
-	deleteMissing bool
+	deleteMissing   bool
+	force           bool
+	deleteRetention time.Duration
+	retentionRuns   int
+	retentionState  string
+	deleteOlderThan time.Duration
+	dropGuard       float64
+	forceDelete     bool
+	deleteOldOnly   bool
+	deleteFirst     bool
+	deleteFirstDir  bool
+	detectRenames   bool
+	streaming       bool
+	trash           bool
+	atomicCopy      bool
+	resume          bool
+	tempDir         string
+	checksum        bool
+	contentOnly     bool
+	ignoreTimes     bool
+	ignoreSize      bool
+	contentCheck    bool
+	keepTimes       bool
+	checksumCache   string
+	mmapCompare     bool
+	quickHash       int
+	hashAlgorithm   string
+	fullCheckEvery  int
+	manifestFile    string
+	diffManifests   bool
+	diffFormat      string
+	manifestCompare bool
+	fingerprintCmd  string
+	failOnAccess    bool
+	oneFileSystem   bool
+	journal         bool
+	checkpoint      string
+	checkpointFiles int
+	checkpointEvery time.Duration
+	foldCaseOrder   bool
+	timeTolerance   time.Duration
+	clockSkew       time.Duration
+	clockCheck      time.Duration
+	clockCheckFail  bool
+	writeCheck      bool
+	modifiedSince   string
+	accessedWithin  time.Duration
+	atimeFallback   bool
+	extensions      string
+	excludes        string
+	includes        string
+	protects        string
+	alsoTo          string
+	configFile      string
+	printConfig     bool
+	contentTypes    string
+	contentMatch    string
+	shard           string
+	matchBytes      int
+	excludeOwners   string
+	excludeGroups   string
+	workers         int
+	walkWorkers     int
+	planWorkers     int
+	autoWorkers     bool
+	maxOpenFiles    int
+	maxPerDir       int
+	dryRun          bool
+	statusFormat    string
+	planOut         string
+	applyPlan       string
+	verify          bool
+	check           bool
+	checkModes      bool
+	list            bool
+	indexOut        string
+	repairMetadata  bool
+	checkStructure  bool
+	pruneOrphanDirs bool
+	format          string
+	filesFrom       string
+	gitChanges      string
+	updateOnly      bool
+	existingOnly    bool
+	noDowngrade     bool
+	firstWins       bool
+	rsyncSlashes    bool
+	nestSource      bool
+	stripPrefix     string
+	requirePrefix   bool
+	preallocate     bool
+	xattrs          bool
+	acls            bool
+	fileCaps        bool
+	altStreams      bool
+	fileFlags       bool
+	maxLoad         float64
+	birthTimes      bool
+	reflink         bool
+	watch           bool
+	watchDebounce   time.Duration
+	every           time.Duration
+	fileMode        string
+	modeRules       string
+	dirMode         string
+	progress        bool
+	statusAddr      string
+	profile         bool
+	bidirectional   bool
+	cas             bool
+	snapshot        bool
+	swap            bool
+	conflict        string
+	pruneEmpty      bool
+	noEmptyDirs     bool
+	keepEmptyDirs   bool
+	placeholders    bool
+	strictEmpty     bool
+	pruneSrcEmpty   bool
+	retryChanged    int
+	maxFiles        int
+	maxErrors       int
+	copyOrder       string
+	minFree         string
+	sizeCap         string
+	evict           bool
+	bwLimit         string
+	rateSchedule    string
+	splitSize       string
+	smallFiles      string
+	joinParts       bool
+	skipLocked      bool
+	permsFrom       string
+	treeHash        bool
+	summaryJSON     bool
+	reportFile      string
+	traceFile       string
+	replayTrace     string
+	quiet           bool
+	heartbeat       int
+	specialFiles    bool
+	preserveLinks   bool
+	followLinks     bool
+	followTgtLinks  bool
+	preservePerms   bool
+	preserveOwner   bool
+	dedup           bool
+	archive         bool
+	dirsOnly        bool
+	abortLowSpace   bool
+	lock            bool
+	lockTimeout     time.Duration
+	sshKey          string
+	sshKnownHosts   string
 )
 
 func main() {
 	// CLI flags
 	flag.BoolVar(&deleteMissing, "delete-missing", false, "Delete files from target that do not exist in source")
+	flag.BoolVar(&force, "force", false, "Make read-only target files and directories writable when they block an update or delete")
+	flag.BoolVar(&trash, "trash", false, "Move files removed by --delete-missing to the system trash (or target/.filesync-trash) instead of deleting them")
+	flag.BoolVar(&deleteOldOnly, "delete-preexisting-only", false, "With --delete-missing, only delete target files that were there, unchanged, before the sync started, sparing files other processes add meanwhile")
+	flag.BoolVar(&detectRenames, "detect-renames", false, "With --delete-missing, move orphaned target files into place of new source files with the same contents instead of copying them again")
+	flag.BoolVar(&streaming, "streaming", false, "With --delete-missing, read target directories in batches instead of whole, to keep memory flat on huge directories; entries are then handled in directory order")
+	flag.BoolVar(&deleteFirst, "delete-first", false, "With --delete-missing, delete orphans before copying, to free space on a full target; a failed copy then leaves the orphans already deleted")
+	flag.BoolVar(&deleteFirstDir, "delete-first-per-dir", false, "With --delete-missing, delete each directory's orphans, and with --atomic the files being replaced, right before copying into it, to bound the space a tight target needs")
+	flag.DurationVar(&deleteRetention, "delete-retention", 0, "Only delete orphaned target files after they have been missing this long (e.g. 72h)")
+	flag.IntVar(&retentionRuns, "delete-retention-runs", 0, "Only delete orphaned target files after they have been missing in this many runs in a row")
+	flag.StringVar(&retentionState, "retention-state", "", "Keep the --delete-retention state in this local file instead of target/.filesync-retention.json")
+	flag.Float64Var(&dropGuard, "source-drop-guard", 0, "With --delete-missing, skip the delete pass and fail when the source has fewer than this fraction of the files it had on the last run (e.g. 0.5), as when it did not mount; the count is kept in the target")
+	flag.BoolVar(&forceDelete, "force-delete", false, "Run the delete pass even though --source-drop-guard finds the source count dropped, when the drop is intended")
+	flag.DurationVar(&deleteOlderThan, "delete-older-than", 0, "Only delete orphaned target files last modified at least this long ago (e.g. 168h); newer ones are kept")
+	flag.BoolVar(&atomicCopy, "atomic", false, "Write each file to a temporary partial file and rename it into place when complete")
+	flag.BoolVar(&resume, "resume", false, "Resume interrupted copies from their partial files (implies --atomic)")
+	flag.StringVar(&tempDir, "temp-dir", "", "Write atomic copies to this local directory before moving them into the target (implies --atomic)")
+	flag.BoolVar(&checksum, "checksum", false, "Compare equal-sized files by content checksum instead of modification time")
+	flag.BoolVar(&contentOnly, "content-only", false, "Decide by size and content checksum alone, never by modification time; copies are not given the source's mod time")
+	flag.BoolVar(&ignoreTimes, "ignore-times", false, "Do not compare modification times, e.g. for stores that cannot keep them")
+	flag.BoolVar(&ignoreSize, "ignore-size", false, "Do not compare file sizes")
+	flag.BoolVar(&contentCheck, "compare-content", false, "Compare checksums of files whose metadata differs (or of all files, with --ignore-times) before copying them")
+	flag.BoolVar(&keepTimes, "keep-times", false, "With --content-only, still give copies the source's modification time")
+	flag.StringVar(&manifestFile, "manifest", "", "Keep a JSON manifest of the synced files (size, mod time and, with --checksum, digest) in this local file, updated after each run")
+	flag.BoolVar(&diffManifests, "diff-manifests", false, "Only compare the two manifest files given as arguments, from --manifest runs, and print the paths added, removed or changed between them")
+	flag.StringVar(&diffFormat, "diff-format", "text", "Output format of --diff-manifests: \"text\" or \"json\"")
+	flag.BoolVar(&manifestCompare, "manifest-compare", false, "Decide what to copy by comparing against the --manifest of earlier runs instead of statting target files, for slow or write-mostly targets")
+	flag.StringVar(&hashAlgorithm, "hash-algorithm", "sha256", "Checksum algorithm for comparisons, --verify, the checksum cache, the manifest, --dedup and --tree-hash: "+strings.Join(filesync.HashAlgorithms(), ", "))
+	flag.IntVar(&fullCheckEvery, "full-check-every", 0, "Compare file contents in full every N runs, counted in target/.filesync-runs.json, and only sizes and mod times otherwise")
+	flag.IntVar(&quickHash, "quick-hash", 0, "Compare equal-sized files by a hash of their first and last N KiB instead of modification time; cheap for large files, but misses edits to the middle (default: off)")
+	flag.BoolVar(&mmapCompare, "mmap-compare", false, "Compare file contents byte by byte, memory-mapped where possible, stopping at the first difference instead of hashing whole files")
+	flag.StringVar(&fingerprintCmd, "fingerprint-cmd", "", "Compare files by the output of this command instead, e.g. 'phash {}' where {} is the file path; equal fingerprints mean up to date even if the bytes differ")
+	flag.StringVar(&checksumCache, "checksum-cache", "", "With --checksum, reuse digests of files whose size and mod time are unchanged, cached in this file (\"target\" for target/.filesync-checksums.json)")
+	flag.BoolVar(&foldCaseOrder, "sort-ignore-case", false, "Process directory entries in case-insensitive order instead of byte order")
+	flag.StringVar(&checkpoint, "checkpoint", "", "Record finished files in this checkpoint file, flushed periodically, so a crashed migration resumes where it stopped (\"target\" for target/.filesync-journal)")
+	flag.IntVar(&checkpointFiles, "checkpoint-files", 0, "With --checkpoint, flush after this many finished files (default 1000)")
+	flag.DurationVar(&checkpointEvery, "checkpoint-interval", 0, "With --checkpoint, flush at least this often (default 30s)")
+	flag.BoolVar(&journal, "journal", false, "Journal finished files in target/.filesync-journal so an interrupted run resumes where it stopped")
+	flag.BoolVar(&oneFileSystem, "one-file-system", false, "Do not descend into directories on other filesystems than the source root (like rsync -x)")
+	flag.BoolVar(&failOnAccess, "fail-on-access-error", false, "Stop with an error when a source entry cannot be read instead of skipping it")
+	flag.DurationVar(&timeTolerance, "time-tolerance", 0, "Treat modification times within this window as equal (e.g. 2s for FAT)")
+	flag.DurationVar(&clockSkew, "clock-skew", 0, "Compare content instead of times for files whose mod times differ by at most this much")
+	flag.DurationVar(&clockCheck, "clock-check", 0, "Before syncing, measure the target host's clock skew with a probe file and warn if it exceeds this much")
+	flag.BoolVar(&clockCheckFail, "clock-check-fail", false, "With --clock-check, stop instead of warning when the skew is too large")
+	flag.BoolVar(&writeCheck, "write-check", false, "Before syncing, write and remove a probe file in the target, so a read-only target fails the run with one error")
+	flag.StringVar(&modifiedSince, "modified-since", "", "Only sync source files modified at or after this time (RFC 3339, or a date like 2024-06-01)")
+	flag.DurationVar(&accessedWithin, "accessed-within", 0, "Only sync source files accessed within this long (e.g. 720h), by access time; unreliable on noatime mounts")
+	flag.BoolVar(&atimeFallback, "atime-fallback", false, "With --accessed-within, count a file's modification time as an access too, for noatime mounts")
+	flag.StringVar(&excludes, "exclude", "", "Comma-separated .syncignore-style patterns to exclude (e.g. '*.tmp,build/'), applied before the .syncignore files")
+	flag.StringVar(&includes, "include", "", "Comma-separated patterns to sync even though --exclude matches them (e.g. 'keep.tmp')")
+	flag.StringVar(&alsoTo, "also-to", "", "Comma-separated further target directories on the same host, synced in the same run; source files are read once for all targets")
+	flag.StringVar(&protects, "protect", "", "Comma-separated .syncignore-style patterns of target entries --delete-missing never deletes (e.g. '.cache/,*.log')")
+	flag.StringVar(&extensions, "ext", "", "Comma-separated list of file extensions to sync (e.g. jpg,png,mp4); empty means all")
+	flag.StringVar(&excludeOwners, "exclude-owner", "", "Comma-separated user ids whose files are not synced (e.g. 0,999); their target copies are kept (Unix and SFTP)")
+	flag.StringVar(&excludeGroups, "exclude-group", "", "Comma-separated group ids whose files are not synced; their target copies are kept (Unix and SFTP)")
+	flag.StringVar(&shard, "shard", "", "Sync only the files whose path hashes to this shard, as index/total (e.g. 0/4), to split a huge tree across machines")
+	flag.StringVar(&contentMatch, "content-match", "", "Regular expression a file's content must match, within its first --content-match-bytes, to be synced")
+	flag.IntVar(&matchBytes, "content-match-bytes", 0, "How much of each file --content-match searches (0 means 64 KiB)")
+	flag.StringVar(&contentTypes, "content-type", "", "Comma-separated content types to sync, detected from file contents (e.g. image/*,application/pdf); empty means all")
+	flag.IntVar(&workers, "workers", 0, "Number of concurrent workers for file comparisons (default: one per CPU)")
+	flag.IntVar(&maxPerDir, "max-per-dir", 0, "Work on at most this many files within any one target directory at once, for network shares that choke on concurrent writes to a directory (default: no limit)")
+	flag.IntVar(&maxOpenFiles, "max-open-files", 0, "Keep at most this many source and target file pairs open at once, for low open-file limits (default: derived from the soft limit)")
+	flag.BoolVar(&autoWorkers, "auto-workers", false, "Tune the number of comparison workers to the best throughput while running, up to --workers")
+	flag.IntVar(&walkWorkers, "walk-workers", 0, "List directories and stat files with this many goroutines ahead of the walk, for high-latency network mounts (default: serial)")
+	flag.IntVar(&planWorkers, "plan-workers", 0, "Plan --check and --dry-run runs on this many goroutines, walking the top-level subtrees concurrently (default: serial)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Show what would change without modifying the target")
+	flag.StringVar(&planOut, "plan-out", "", "With --dry-run, save the planned changes to this JSON file for review")
+	flag.BoolVar(&verify, "verify", false, "Only audit the target: compare every file with the source by checksum and report differences, without writing anything")
+	flag.BoolVar(&check, "check", false, "Only assert that the target matches the source by presence and content, for CI: list differing paths and exit 3 if any, without writing anything")
+	flag.BoolVar(&checkModes, "check-modes", false, "With --check, also compare permission bits")
+	flag.BoolVar(&list, "list", false, "Only print the source files that would be considered for syncing (path, size, mod time), honoring filters; all arguments are sources")
+	flag.StringVar(&indexOut, "index", "", "Only write a JSON catalog of the source files (path, size, mod time, and a digest with --checksum) to this file, honoring filters; all arguments are sources")
+	flag.StringVar(&gitChanges, "git-changes", "", "Sync only the files of the source's git work tree that differ from this commit, such as HEAD~1, plus untracked ones; with --delete-missing, files git reports deleted are removed")
+	flag.StringVar(&filesFrom, "files-from", "", "Sync only the relative paths listed in this file, one per line (- for stdin); delete-missing then only works below listed directories")
+	flag.StringVar(&format, "format", "dir", "Target format: dir syncs into a directory, tar or tar.gz writes the selection to the target path as an archive instead (- for stdout)")
+	flag.BoolVar(&checkStructure, "check-structure", false, "Only report target directories that no source has, apart from empty ones the source has too, without syncing")
+	flag.BoolVar(&pruneOrphanDirs, "prune-orphan-dirs", false, "With --check-structure, remove the orphaned directories that hold no files")
+	flag.BoolVar(&repairMetadata, "repair-metadata", false, "Only fix the mode, owner and mod time of target files whose size matches the source, without copying any data")
+	flag.StringVar(&applyPlan, "apply-plan", "", "Apply the changes saved by --plan-out instead of scanning the source")
+	flag.StringVar(&statusFormat, "status-format", "log", "Output format: \"log\" for verbose log lines, \"status\" for a compact A/M/D summary")
+	flag.BoolVar(&existingOnly, "existing-only", false, "Only update files the target already has; never add new files or directories to it")
+	flag.BoolVar(&updateOnly, "update-only", false, "Only replace target files that are older than the source; never overwrite newer target files")
+	flag.BoolVar(&noDowngrade, "no-downgrade", false, "Replace an existing target file only if its size differs or the source is newer, so touched targets are not overwritten with older content")
+	flag.BoolVar(&firstWins, "first-source-wins", false, "With several sources, let the earliest source win path collisions (default: last wins)")
+	flag.BoolVar(&nestSource, "nest-source", false, "Sync the source directory itself into target/<name> instead of its contents")
+	flag.StringVar(&stripPrefix, "strip-prefix", "", "Strip these leading directories (e.g. project/dist) from the source paths, syncing only what is below them into the target root")
+	flag.BoolVar(&requirePrefix, "require-prefix", false, "Fail when a source holds entries outside --strip-prefix instead of leaving them out")
+	flag.BoolVar(&rsyncSlashes, "rsync-slashes", false, "Treat a source without a trailing slash like rsync does: sync the directory itself into target/<name>")
+	flag.BoolVar(&preallocate, "preallocate", false, "Preallocate target files to their full size before copying")
+	flag.BoolVar(&reflink, "reflink", false, "Clone files as copy-on-write reflinks where supported (Btrfs, XFS, APFS), copying otherwise")
+	flag.BoolVar(&xattrs, "xattrs", false, "Copy extended attributes of files (Linux and macOS, local paths only)")
+	flag.BoolVar(&fileCaps, "file-caps", false, "Copy Linux file capabilities of executables (needs root or CAP_SETFCAP, local paths only)")
+	flag.BoolVar(&altStreams, "alt-streams", false, "Copy and compare macOS resource forks and Windows alternate data streams (local paths only)")
+	flag.BoolVar(&fileFlags, "file-flags", false, "Copy and compare immutable and append-only file flags on Linux and the BSDs, applied last (needs root, local paths only)")
+	flag.Float64Var(&maxLoad, "max-load", 0, "Hold back new copies while the 1-minute load average is above this (Linux and macOS), e.g. the number of CPUs")
+	flag.BoolVar(&acls, "acls", false, "Copy POSIX ACLs of files and directories (Linux, local paths only)")
+	flag.BoolVar(&birthTimes, "preserve-birth-time", false, "Give copies the creation time of their source too (macOS and Windows, local paths only; skipped elsewhere)")
+	flag.BoolVar(&watch, "watch", false, "Keep running and re-sync whenever the source changes")
+	flag.DurationVar(&watchDebounce, "watch-debounce", 500*time.Millisecond, "How long to wait for a burst of changes to settle in --watch mode")
+	flag.DurationVar(&every, "every", 0, "Keep running and sync again at this interval (e.g. 5m) until interrupted; a tick is skipped while a sync is still running")
+	flag.StringVar(&fileMode, "file-mode", "", "Octal permission bits for files written to the target (e.g. 0664)")
+	flag.StringVar(&modeRules, "mode-rule", "", "Comma-separated PATTERN=MODE rules for written files, e.g. '*.sh=0755,bin/*=0750'; the last matching rule wins over --file-mode")
+	flag.StringVar(&dirMode, "dir-mode", "", "Octal permission bits for directories created in the target (e.g. 0775)")
+	flag.BoolVar(&dirsOnly, "dirs-only", false, "Only recreate the source's directory tree (with modes and mod times), copying no files")
+	flag.BoolVar(&pruneEmpty, "prune-empty-dirs", false, "Remove directories that are empty in the target after syncing (e.g. because all their files are excluded)")
+	flag.BoolVar(&noEmptyDirs, "no-empty-dirs", false, "Create target directories only once a file is written into them, so empty or filtered-to-empty source directories are left out")
+	flag.BoolVar(&placeholders, "empty-placeholders", false, "Treat empty source files as placeholders that are not ready yet: never copy one over a non-empty target file")
+	flag.BoolVar(&strictEmpty, "strict-empty", false, "Copy empty source files faithfully, over non-empty targets too (the default); overrides --empty-placeholders, e.g. from a config file")
+	flag.BoolVar(&keepEmptyDirs, "preserve-empty-dirs", false, "Mirror every source directory, even empty ones (the default); overrides --no-empty-dirs, e.g. from a config file")
+	flag.BoolVar(&pruneSrcEmpty, "prune-source-empty-dirs", false, "With --prune-empty-dirs, also prune directories that are empty in the source")
+	flag.BoolVar(&swap, "swap", false, "Build the new tree in target.new and atomically swap it in place of the target, for zero-downtime deploys")
+	flag.BoolVar(&snapshot, "snapshot", false, "Sync into a new dated snapshot directory in the target, hard-linking files unchanged since the previous snapshot")
+	flag.BoolVar(&bidirectional, "bidirectional", false, "Two-way sync: copy changes in both directions (single source only)")
+	flag.BoolVar(&cas, "cas", false, "Keep the target as a content-addressable store: file contents as target/objects/<hash>, stored once, and paths mapped to hashes in target/index.json")
+	flag.StringVar(&conflict, "conflict", "skip", "How --bidirectional settles files changed on both sides: skip, newest, source, target or both")
+	flag.BoolVar(&profile, "profile", false, "Print how long each phase took and the slowest file copies")
+	flag.StringVar(&statusAddr, "status-addr", "", "Serve the sync's progress as JSON on http://ADDR/status (and /metrics, /healthz) while it runs, e.g. localhost:8080")
+	flag.BoolVar(&progress, "progress", false, "Show a progress line with transfer rate and estimated time remaining, and hashing progress on large files")
+	flag.StringVar(&splitSize, "split-size", "", "Store target files larger than this (e.g. 4G) as name.part0001, name.part0002, ... of at most this size")
+	flag.BoolVar(&skipLocked, "skip-locked", false, "Skip source files another process holds locked or open for writing, instead of failing on them")
+	flag.BoolVar(&preserveLinks, "preserve-symlinks", false, "Recreate symlinks in the target verbatim, even dangling ones, instead of copying what they point to")
+	flag.BoolVar(&followTgtLinks, "follow-target-symlinks", false, "Write copies through symlinks in the target instead of replacing the links with files")
+	flag.BoolVar(&followLinks, "follow-symlinks", false, "Descend into symlinks to directories too, skipping links that point back to a directory they are reached from")
+	flag.BoolVar(&preservePerms, "preserve-perms", false, "Give copied files and target directories the permission bits of their source")
+	flag.BoolVar(&preserveOwner, "preserve-owner", false, "Give copied files and target directories the owner and group of their source (usually needs root)")
+	flag.BoolVar(&dedup, "dedup", false, "Store identical files once: hard-link copies whose content matches a file already copied in this run")
+	flag.BoolVar(&archive, "archive", false, "Faithful mirror, like rsync -a: shorthand for --preserve-symlinks --preserve-perms --preserve-owner --keep-times; explicit flags override its parts")
+	flag.BoolVar(&archive, "a", false, "Shorthand for --archive")
+	flag.BoolVar(&specialFiles, "special-files", false, "Recreate named pipes and device nodes in the target instead of skipping them (Unix; devices need root)")
+	flag.StringVar(&traceFile, "trace", "", "Record every decision (with the stat results it was made from), change and error of the run to this JSON Lines file, for debugging")
+	flag.StringVar(&replayTrace, "replay", "", "Repeat the changes recorded by --trace, in order and without comparing files again, instead of scanning the source")
+	flag.StringVar(&reportFile, "report-file", "", "After each run, write a Markdown audit report (changes, skipped files, errors, settings, duration) to this file")
+	flag.BoolVar(&summaryJSON, "summary-json", false, "Print the final statistics as one JSON object on stdout when the sync completes")
+	flag.BoolVar(&quiet, "quiet", false, "Suppress the per-file log lines and the closing summary message; warnings and errors are still logged to stderr")
+	flag.IntVar(&heartbeat, "heartbeat", 0, "Leave out the per-file lines for skipped files and log \"scanned N files, M changed so far\" every N files instead; changes are still logged as they happen")
+	flag.BoolVar(&treeHash, "tree-hash", false, "Log a Merkle-style hash of the whole target tree after the sync, for comparing mirrors")
+	flag.StringVar(&permsFrom, "permissions-from", "", "Give written target files and directories the mode and owner of this reference path in the target")
+	flag.BoolVar(&joinParts, "join-parts", false, "Reassemble source files split by --split-size into whole files on the target")
+	flag.StringVar(&smallFiles, "small-file-threshold", "64K", "Copy files smaller than this in one read and one write instead of streaming them (0 streams every file)")
+	flag.StringVar(&sizeCap, "size-cap", "", "Keep the target's files under this total size (e.g. 50G), skipping files that would not fit; files are then copied newest first")
+	flag.BoolVar(&evict, "evict", false, "With --size-cap, delete the least recently used target files to make room instead of skipping")
+	flag.StringVar(&minFree, "min-free", "", "Skip files that would leave less than this much free space on the target (e.g. 10G, 500M, 0)")
+	flag.StringVar(&bwLimit, "bwlimit", "", "Copy at most this many bytes per second (e.g. 1M); 0 or empty is unlimited")
+	flag.StringVar(&rateSchedule, "rate-schedule", "", "Comma-separated HH:MM-HH:MM=RATE windows varying --bwlimit by local time of day, e.g. \"09:00-17:00=1M,22:00-06:00=0\"; a window ending before it starts wraps past midnight, and 0 is unlimited")
+	flag.BoolVar(&abortLowSpace, "abort-low-space", false, "With --min-free, stop the sync at the first file that does not fit instead of skipping it")
+	flag.IntVar(&maxErrors, "max-errors", 0, "Abort the sync once this many per-file errors occurred (default: no limit)")
+	flag.StringVar(&copyOrder, "copy-order", "natural", "Order of the copy pass: natural (walk order), smallest (clear the file count quickly), largest (start the longest transfers first) or newest (most recently modified first)")
+	flag.IntVar(&maxFiles, "max-files", 0, "Copy at most this many files per run, leaving the rest for later runs (default: no limit)")
+	flag.IntVar(&retryChanged, "retry-changed", 0, "Copy a file up to this many more times if it changes while being copied (default: only warn)")
+	flag.BoolVar(&lock, "lock", false, "Hold an exclusive lock file in the target so overlapping runs cannot interfere")
+	flag.DurationVar(&lockTimeout, "lock-timeout", 0, "With --lock, wait this long for another run to finish instead of failing immediately")
+	flag.StringVar(&configFile, "config", "", "Read settings from this YAML file (default: "+filesync.ConfigFileName+" in the current directory, if present); flags override it")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the settings in effect, resolved from the flags and the config file, and exit without syncing")
+	flag.StringVar(&sshKey, "ssh-key", "", "Private key file for sftp:// locations (default: use the SSH agent)")
+	flag.StringVar(&sshKnownHosts, "ssh-known-hosts", "", "known_hosts file used to verify sftp:// servers (default: ~/.ssh/known_hosts)")
 	flag.Parse()
+	if err := applyEnv(); err != nil {
+		log.Fatalf("Invalid environment: %v", err)
+	}
+
+	// A signal stops whatever runs below at the next safe point: a sync
+	// after the current file, with a summary of the work done
+	interrupted := interruptContext()
+
+	// Offline comparison of two manifests, no locations involved
+	if diffManifests {
+		os.Exit(runDiffManifests(flag.Args()))
+	}
+
+	// Settings from a config file fill in what the flags and the
+	// environment leave unset, and give the locations when none are
+	// passed
+	args := flag.Args()
+	sourcesOnly := list || indexOut != ""
+	var envSources []string
+	var fallbackTarget string
+	if len(args) == 0 {
+		envSources, fallbackTarget = envLocations()
+	}
+	if configFile == "" {
+		if _, err := os.Stat(filesync.ConfigFileName); err == nil {
+			configFile = filesync.ConfigFileName
+		}
+	}
+	if configFile != "" {
+		cfg, err := filesync.LoadConfig(configFile)
+		if err != nil {
+			log.Fatalf("Invalid config: %v", err)
+		}
+		if err := applyConfig(cfg); err != nil {
+			log.Fatalf("Invalid config %q: %v", configFile, err)
+		}
+		if fallbackTarget == "" {
+			fallbackTarget = cfg.Target
+		}
+		if len(args) == 0 && len(envSources) == 0 && len(cfg.Sources) > 0 {
+			args = append(args, cfg.Sources...)
+			if fallbackTarget != "" && !sourcesOnly {
+				args = append(args, fallbackTarget)
+			}
+		}
+	}
+	if len(envSources) > 0 {
+		// Never take the last source for the target
+		if fallbackTarget == "" && !sourcesOnly {
+			log.Fatalf("%sSOURCES is set without a target: set %sTARGET or target in the config file", envPrefix, envPrefix)
+		}
+		args = envSources
+		if !sourcesOnly {
+			args = append(args, fallbackTarget)
+		}
+	}
+
+	if archive {
+		if err := applyArchive(); err != nil {
+			log.Fatalf("Invalid --archive: %v", err)
+		}
+	}
+
+	if len(args) < 2 && !(sourcesOnly && len(args) == 1) {
+		log.Fatalf("Usage: %s [options] <source_dir>... <target_dir>  (directories may be sftp://user@host/path)", os.Args[0])
+	}
+
+	if statusFormat != "log" && statusFormat != "status" {
+		log.Fatalf("Unknown --status-format %q (want \"log\" or \"status\")", statusFormat)
+	}
+	if planOut != "" && !dryRun {
+		log.Fatalf("--plan-out requires --dry-run")
+	}
+	if applyPlan != "" && (dryRun || watch) {
+		log.Fatalf("--apply-plan cannot be combined with --dry-run or --watch")
+	}
+	if replayTrace != "" && (dryRun || watch || applyPlan != "" || filesFrom != "") {
+		log.Fatalf("--replay cannot be combined with --dry-run, --watch, --apply-plan or --files-from")
+	}
+	if verify && (watch || applyPlan != "" || planOut != "") {
+		log.Fatalf("--verify cannot be combined with --watch, --apply-plan or --plan-out")
+	}
+	if list && (verify || watch || applyPlan != "" || planOut != "") {
+		log.Fatalf("--list cannot be combined with --verify, --watch, --apply-plan or --plan-out")
+	}
+	if repairMetadata && (list || verify || watch || applyPlan != "" || planOut != "") {
+		log.Fatalf("--repair-metadata cannot be combined with --list, --verify, --watch, --apply-plan or --plan-out")
+	}
+	if checkStructure && (list || verify || repairMetadata || watch || applyPlan != "" || planOut != "") {
+		log.Fatalf("--check-structure cannot be combined with --list, --verify, --repair-metadata, --watch, --apply-plan or --plan-out")
+	}
+	if check && (list || verify || repairMetadata || checkStructure || watch || every > 0 || applyPlan != "" || planOut != "" || filesFrom != "" || gitChanges != "" || replayTrace != "" || indexOut != "" || alsoTo != "") {
+		log.Fatalf("--check cannot be combined with --list, --verify, --repair-metadata, --check-structure, --watch, --every, --apply-plan, --plan-out, --files-from, --git-changes, --replay, --index or --also-to")
+	}
+	if checkModes && !check {
+		log.Fatalf("--check-modes requires --check")
+	}
+	if pruneOrphanDirs && !checkStructure {
+		log.Fatalf("--prune-orphan-dirs requires --check-structure")
+	}
+	if filesFrom != "" && (list || verify || repairMetadata || watch || applyPlan != "" || snapshot || swap || bidirectional) {
+		log.Fatalf("--files-from cannot be combined with --list, --verify, --repair-metadata, --watch, --apply-plan, --snapshot, --swap or --bidirectional")
+	}
+	if gitChanges != "" && (filesFrom != "" || replayTrace != "" || list || verify || repairMetadata || watch || every > 0 || applyPlan != "" || indexOut != "" || snapshot || swap || bidirectional) {
+		log.Fatalf("--git-changes cannot be combined with --files-from, --replay, --list, --verify, --repair-metadata, --watch, --every, --apply-plan, --index, --snapshot, --swap or --bidirectional")
+	}
+	archiveTarget := format == "tar" || format == "tar.gz"
+	if format != "dir" && !archiveTarget {
+		log.Fatalf("Unknown --format %q (want dir, tar or tar.gz)", format)
+	}
+	if every > 0 && (watch || list || verify || repairMetadata || applyPlan != "" || planOut != "" || filesFrom != "") {
+		log.Fatalf("--every cannot be combined with --watch, --list, --verify, --repair-metadata, --apply-plan, --plan-out or --files-from")
+	}
+	if archiveTarget && (list || verify || repairMetadata || watch || every > 0 || applyPlan != "" || planOut != "" || bidirectional || deleteMissing) {
+		log.Fatalf("--format %s cannot be combined with --list, --verify, --repair-metadata, --watch, --every, --apply-plan, --plan-out, --bidirectional or --delete-missing", format)
+	}
+	if alsoTo != "" && (sourcesOnly || verify || repairMetadata || applyPlan != "" || archiveTarget) {
+		log.Fatalf("--also-to cannot be combined with --list, --index, --verify, --repair-metadata, --apply-plan or --format")
+	}
+	if indexOut != "" && (list || verify || repairMetadata || watch || every > 0 || applyPlan != "" || planOut != "" || filesFrom != "" || archiveTarget) {
+		log.Fatalf("--index cannot be combined with --list, --verify, --repair-metadata, --watch, --every, --apply-plan, --plan-out, --files-from or --format")
+	}
+	if statusFormat == "status" || quiet {
+		// The compact view replaces the per-file log lines, but errors
+		// and warnings still reach stderr
+		log.SetOutput(alertsOnly{os.Stderr})
+	}
+
+	// All but the last argument are sources, merged in order; local
+	// ones may be glob patterns matching several of them. Listing
+	// needs no target, so every argument is a source.
+	sourceArgs := args[:len(args)-1]
+	if sourcesOnly {
+		sourceArgs = args
+	}
+	var sources []location
+	for _, arg := range sourceArgs {
+		loc, err := parseLocation(arg)
+		if err != nil {
+			log.Fatalf("Invalid source %q: %v", arg, err)
+		}
+		if len(sources) > 0 && (loc.addr != sources[0].addr || loc.user != sources[0].user) {
+			log.Fatalf("All sources must be on the same host: %q", arg)
+		}
+		paths := []string{loc.path}
+		if !loc.remote() {
+			if paths, err = filesync.GlobSources(loc.path); err != nil {
+				log.Fatalf("Invalid source: %v", err)
+			}
+		}
+		for _, path := range paths {
+			match := loc
+			match.path = path
+			sources = append(sources, match)
+		}
+	}
+	var target location
+	if archiveTarget {
+		target.path = args[len(args)-1]
+	} else if !sourcesOnly {
+		var err error
+		if target, err = parseLocation(args[len(args)-1]); err != nil {
+			log.Fatalf("Invalid target %q: %v", args[len(args)-1], err)
+		}
+	}
+
+	// Review of the resolved settings instead of a run
+	if printConfig {
+		writeEffectiveConfig(os.Stdout, sources, target, sourcesOnly)
+		return
+	}
+
+	// Check if local directories exist; remote ones are checked by the sync
+	for _, source := range sources {
+		if _, err := os.Stat(source.path); !source.remote() && os.IsNotExist(err) {
+			log.Fatalf("Source directory does not exist: %q", source.path)
+		}
+	}
+	if _, err := os.Stat(target.path); !sourcesOnly && !archiveTarget && !target.remote() && os.IsNotExist(err) {
+		log.Fatalf("Target directory does not exist: %q", target.path)
+	}
+	var extraTargets []string
+	for _, arg := range splitList(alsoTo) {
+		loc, err := parseLocation(arg)
+		if err != nil {
+			log.Fatalf("Invalid target %q: %v", arg, err)
+		}
+		if loc.addr != target.addr || loc.user != target.user {
+			log.Fatalf("All targets must be on the same host: %q", arg)
+		}
+		if _, err := os.Stat(loc.path); !loc.remote() && os.IsNotExist(err) {
+			log.Fatalf("Target directory does not exist: %q", loc.path)
+		}
+		extraTargets = append(extraTargets, loc.path)
+	}
+
+	opts, err := buildOptions()
+	if err != nil {
+		log.Fatalf("Invalid options: %v", err)
+	}
+	remoteOpts, err := remoteOptions(sources[0], target)
+	if err != nil {
+		log.Fatalf("Invalid SSH settings: %v", err)
+	}
+	opts = append(opts, remoteOpts...)
+	if archiveTarget {
+		opts = append(opts, filesync.WithExcludes(archiveExcludes(sources, target.path)...))
+	}
+
+	fs := filesync.NewFileSync(sources[0].path, target.path, deleteMissing, opts...)
+	// The SFTP connections are closed however the run ends
+	defer fs.Close()
+	exit := func(code int) {
+		fs.Close()
+		os.Exit(code)
+	}
+	for _, source := range sources[1:] {
+		fs.AddSource(source.path)
+	}
+	for _, pattern := range splitList(protects) {
+		fs.AddProtect(pattern)
+	}
+	for _, target := range extraTargets {
+		fs.AddTarget(target)
+	}
+
+	// Live mirroring until interrupted
+	if watch {
+		if err := fs.Watch(interrupted); err != nil {
+			fmt.Fprintf(os.Stderr, "Error while watching: %v\n", err)
+			exit(exitFatal)
+		}
+		return
+	}
+
+	// Periodic mirroring until interrupted; the sync in progress is
+	// finished first
+	if every > 0 {
+		if err := fs.SyncEvery(interrupted, every); err != nil {
+			fmt.Fprintf(os.Stderr, "Error during synchronization: %v\n", err)
+			exit(exitFatal)
+		}
+		return
+	}
+
+	// Inventory of the sources only
+	if list {
+		entries, err := fs.List(interrupted)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error while listing: %v\n", err)
+			exit(exitFatal)
+		}
+		for _, e := range entries {
+			fmt.Printf("%s\t%d\t%s\n", e.Path, e.Size, e.ModTime.Format(time.RFC3339))
+		}
+		return
+	}
+	if indexOut != "" {
+		if err := fs.Index(indexOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error while indexing: %v\n", err)
+			exit(exitFatal)
+		}
+		fmt.Fprintf(os.Stderr, "📇 Wrote the source catalog to %q.\n", indexOut)
+		return
+	}
+
+	// One-pass archive of the selection instead of a target directory
+	if archiveTarget {
+		if err := exportTar(interrupted, fs, target.path, format == "tar.gz"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error while archiving: %v\n", err)
+			exit(exitFatal)
+		}
+		stats := fs.Stats()
+		log.Printf("📦 Archived %d file(s), %d bytes; left out %d special file(s) and %d unreadable entr(ies)",
+			stats.FilesCopied, stats.BytesCopied, len(stats.Special), len(stats.Errors))
+		if len(stats.Errors) > 0 {
+			exit(exitPartial)
+		}
+		return
+	}
+
+	// Read-only audit of an existing copy
+	if verify {
+		report, err := fs.Verify(interrupted)
+		if progress {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error during verification: %v\n", err)
+			exit(exitFatal)
+		}
+		exit(reportVerify(report))
+	}
+
+	// Read-only equality assertion, for CI
+	if check {
+		result, err := fs.Diff(interrupted)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error during check: %v\n", err)
+			exit(exitFatal)
+		}
+		exit(reportCheck(result))
+	}
+
+	// Metadata-only reconciliation of an existing copy
+	if repairMetadata {
+		report, err := fs.RepairMetadata(interrupted)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error during repair: %v\n", err)
+			exit(exitFatal)
+		}
+		exit(reportRepair(report))
+	}
+
+	// Directory-level cleanup, without delete-missing
+	if checkStructure {
+		report, err := fs.CheckStructure(interrupted, pruneOrphanDirs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error during structure check: %v\n", err)
+			exit(exitFatal)
+		}
+		exit(reportStructure(report))
+	}
+
+	// Synchronization, or replay of a reviewed plan or a trace
+	started := time.Now()
+	if applyPlan != "" {
+		err = fs.ApplyPlan(applyPlan)
+	} else if replayTrace != "" {
+		err = fs.Replay(replayTrace)
+	} else if filesFrom != "" {
+		err = syncFilesFrom(fs, filesFrom)
+	} else if gitChanges != "" {
+		err = fs.SyncGitChanges(gitChanges)
+	} else {
+		err = fs.SyncDirsContext(interrupted)
+	}
+	if err == nil && planOut != "" {
+		err = fs.ExportPlan(planOut)
+	}
+	if progress {
+		fmt.Fprintln(os.Stderr)
+	}
+	if errors.Is(err, context.Canceled) && interrupted.Err() != nil {
+		if summaryJSON {
+			printSummary(fs.Stats(), time.Since(started))
+		}
+		exit(report(fs, true))
+	}
+	if errors.Is(err, filesync.ErrTooManyErrors) {
+		fmt.Fprintf(os.Stderr, "🛑 Aborted after %d error(s), the --max-errors threshold:\n%v\n", len(fs.Stats().Errors), fs.Stats().Err())
+		exit(exitFatal)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error during synchronization: %v\n", err)
+		exit(exitFatal)
+	}
+
+	if summaryJSON {
+		printSummary(fs.Stats(), time.Since(started))
+	}
+	exit(report(fs, false))
+}
+
+// alertsOnly passes on the log lines of errors and warnings, led by
+// ❌ and ⚠️, and the plain ones of fatal errors, dropping the other
+// emoji-led lines about files and progress, for --quiet. Lines are
+// expected in the standard "date time message" format.
+type alertsOnly struct {
+	w io.Writer
+}
+
+// Write passes p on if it is an error or warning line.
+func (a alertsOnly) Write(p []byte) (int, error) {
+	_, msg, _ := strings.Cut(string(p), " ")
+	_, msg, _ = strings.Cut(msg, " ")
+	if r, _ := utf8.DecodeRuneInString(msg); r < utf8.RuneSelf || strings.HasPrefix(msg, "❌") || strings.HasPrefix(msg, "⚠") {
+		return a.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// syncFilesFrom syncs the paths listed in the --files-from file, or
+// on stdin for "-".
+func syncFilesFrom(fs *filesync.FileSync, path string) error {
+	in := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	paths, err := filesync.ReadPathList(in)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return fs.SyncPaths(paths)
+}
+
+// exportTar writes the --format tar archive to path, or to stdout for
+// "-". A partly written archive file is removed on failure.
+func exportTar(ctx context.Context, fs *filesync.FileSync, path string, compress bool) error {
+	if path == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := fs.ExportTar(ctx, w, compress); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = fs.ExportTar(ctx, w, compress)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// archiveExcludes returns root-anchored patterns keeping an archive
+// written at path out of the local sources it lies in, so it does not
+// end up inside itself.
+func archiveExcludes(sources []location, path string) []string {
+	abs, err := filepath.Abs(path)
+	if path == "-" || err != nil {
+		return nil
+	}
+	var patterns []string
+	for _, source := range sources {
+		root, err := filepath.Abs(source.path)
+		if source.remote() || err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, abs); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			patterns = append(patterns, "/"+filepath.ToSlash(rel))
+		}
+	}
+	return patterns
+}
+
+// summary is the --summary-json output: the run's Stats, with errors
+// as their messages, plus the error count and wall-clock duration.
+type summary struct {
+	filesync.Stats
+	Errors          []string `json:"Errors"`
+	ErrorCount      int
+	DurationSeconds float64
+}
+
+// printSummary writes the --summary-json object as one line on stdout.
+func printSummary(stats filesync.Stats, elapsed time.Duration) {
+	s := summary{Stats: stats, Errors: []string{}, ErrorCount: len(stats.Errors), DurationSeconds: elapsed.Seconds()}
+	for _, err := range stats.Errors {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	line, err := json.Marshal(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding the summary: %v\n", err)
+		return
+	}
+	fmt.Println(string(line))
+}
+
+// reportVerify prints the discrepancies found by --verify and returns
+// the exit code.
+func reportVerify(report *filesync.VerifyReport) int {
+	for _, entry := range report.Mismatched {
+		fmt.Printf("M %s (%s)\n", entry.Path, entry.Reason)
+	}
+	for _, path := range report.Missing {
+		fmt.Printf("- %s\n", path)
+	}
+	for _, path := range report.Extra {
+		fmt.Printf("+ %s\n", path)
+	}
+	for _, err := range report.Errors {
+		fmt.Printf("! %v\n", err)
+	}
+	if report.OK() {
+		fmt.Printf("✅ Verified %d file(s), target matches source.\n", report.Verified)
+		return exitOK
+	}
+	fmt.Printf("⚠️ %d verified, %d mismatched, %d missing, %d extra, %d unreadable\n",
+		report.Verified, len(report.Mismatched), len(report.Missing), len(report.Extra), len(report.Errors))
+	return exitDiffers
+}
+
+// reportCheck prints the differences found by --check and returns the
+// exit code: exitDiffers unless the trees match.
+func reportCheck(result *filesync.DiffResult) int {
+	filesync.WriteDiff(os.Stdout, result)
+	if result.Empty() {
+		fmt.Println("✅ Target matches source.")
+		return exitOK
+	}
+	fmt.Printf("⚠️ Target does not match source: %d differing, %d missing, %d extra\n",
+		len(result.Differing), len(result.OnlyInSource), len(result.OnlyInTarget))
+	return exitDiffers
+}
+
+// reportRepair prints the outcome of --repair-metadata and returns the
+// exit code.
+func reportRepair(report *filesync.RepairReport) int {
+	for _, path := range report.NeedsCopy {
+		fmt.Printf("M %s\n", path)
+	}
+	for _, err := range report.Errors {
+		fmt.Printf("! %v\n", err)
+	}
+	fmt.Printf("🩹 Fixed metadata of %d entries, %d already matched, %d need a full sync\n",
+		report.Repaired, report.Unchanged, len(report.NeedsCopy))
+	if len(report.Errors) > 0 {
+		return exitPartial
+	}
+	return exitOK
+}
+
+// reportStructure prints the outcome of --check-structure and returns
+// the exit code: exitDiffers while orphaned directories remain.
+func reportStructure(report *filesync.StructureReport) int {
+	pruned := map[string]bool{}
+	for _, path := range report.Pruned {
+		pruned[path] = true
+	}
+	for _, path := range report.Orphaned {
+		if pruned[path] {
+			fmt.Printf("- %s/\n", path)
+		} else {
+			fmt.Printf("+ %s/\n", path)
+		}
+	}
+	for _, err := range report.Errors {
+		fmt.Printf("! %v\n", err)
+	}
+	left := len(report.Orphaned) - len(report.Pruned)
+	fmt.Printf("🏚️ %d orphaned director(ies), %d pruned; %d empty director(ies) the source has too\n",
+		len(report.Orphaned), len(report.Pruned), len(report.Empty))
+	switch {
+	case len(report.Errors) > 0:
+		return exitPartial
+	case left > 0:
+		return exitDiffers
+	}
+	return exitOK
+}
+
+// report prints the outcome of a finished or interrupted sync and
+// returns the exit code.
+func report(fs *filesync.FileSync, interrupted bool) int {
+	stats := fs.Stats()
+
+	if statusFormat == "status" {
+		if err := filesync.WriteStatus(os.Stdout, fs.PlannedActions()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing the status: %v\n", err)
+			return exitFatal
+		}
+	}
+	if profile {
+		fmt.Fprintf(os.Stderr, "⏱️ %s\n", stats.Timings)
+		for _, file := range stats.Timings.Slowest {
+			fmt.Fprintf(os.Stderr, "   %8v  %10s  %s\n", file.Duration.Round(time.Millisecond), formatBytes(file.Bytes), strconv.Quote(file.Path))
+		}
+	}
+	if len(stats.Conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ %d conflict(s) skipped: %s\n", len(stats.Conflicts), quoteList(stats.Conflicts))
+	}
+	if stats.Truncated {
+		fmt.Fprintf(os.Stderr, "⏸️ Stopped at --max-files, about %d file(s) left for the next run.\n", stats.FilesRemaining)
+	}
+	if len(stats.Locked) > 0 {
+		fmt.Fprintf(os.Stderr, "🔒 %d locked file(s) skipped: %s\n", len(stats.Locked), quoteList(stats.Locked))
+	}
+	if len(stats.BrokenSymlinks) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ %d broken symlink(s) skipped: %s\n", len(stats.BrokenSymlinks), quoteList(stats.BrokenSymlinks))
+	}
+	if len(stats.SymlinkCycles) > 0 {
+		fmt.Fprintf(os.Stderr, "🔁 %d symlink cycle(s) skipped: %s\n", len(stats.SymlinkCycles), quoteList(stats.SymlinkCycles))
+	}
+	if len(stats.SameFile) > 0 {
+		fmt.Fprintf(os.Stderr, "🔗 %d file(s) already the same file as their source skipped: %s\n", len(stats.SameFile), quoteList(stats.SameFile))
+	}
+	if len(stats.Placeholders) > 0 {
+		fmt.Fprintf(os.Stderr, "⏳ %d empty placeholder(s) not copied over non-empty targets: %s\n", len(stats.Placeholders), quoteList(stats.Placeholders))
+	}
+	if len(stats.OverCap) > 0 {
+		fmt.Fprintf(os.Stderr, "🧺 %d file(s) skipped to keep the target under --size-cap: %s\n", len(stats.OverCap), quoteList(stats.OverCap))
+	}
+	if len(stats.Evicted) > 0 {
+		fmt.Fprintf(os.Stderr, "♻️ %d least recently used file(s) evicted to make room: %s\n", len(stats.Evicted), quoteList(stats.Evicted))
+	}
+	if len(stats.Spared) > 0 {
+		fmt.Fprintf(os.Stderr, "🛡️ %d orphan(s) added or changed during the run were not deleted: %s\n", len(stats.Spared), quoteList(stats.Spared))
+	}
+	if len(stats.Unconfirmed) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ %d orphan(s) not confirmed gone from the source were not deleted: %s\n", len(stats.Unconfirmed), quoteList(stats.Unconfirmed))
+	}
+	if len(stats.Special) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ %d special file(s) skipped: %s\n", len(stats.Special), quoteList(stats.Special))
+	}
+	if len(stats.Drifted) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ %d planned file(s) changed since the plan was made and were not applied: %s\n", len(stats.Drifted), quoteList(stats.Drifted))
+	}
+	if interrupted {
+		fmt.Fprintf(os.Stderr, "⏹️ Synchronization interrupted after copying %d file(s) (%s) with %d error(s); run again to finish.\n",
+			stats.FilesCopied, formatBytes(stats.BytesCopied), len(stats.Errors))
+		return exitInterrupted
+	}
+	errorCount := len(stats.Errors)
+	if targets := fs.TargetStats(); len(targets) > 0 {
+		errorCount = 0
+		for _, path := range slices.Sorted(maps.Keys(targets)) {
+			t := targets[path]
+			errorCount += len(t.Errors)
+			fmt.Fprintf(os.Stderr, "🎯 %q: %d copied, %d deleted, %d error(s)\n", path, t.FilesCopied, t.FilesDeleted, len(t.Errors))
+		}
+	}
+	if errorCount > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ Synchronization finished with %d error(s).\n", errorCount)
+		return exitPartial
+	}
+	if statusFormat == "status" || quiet {
+		return exitOK
+	}
+
+	if dirsOnly {
+		fmt.Printf("📂 Created %d directories.\n", stats.DirsCreated)
+	}
+	if stats.FullCheck {
+		fmt.Println("🔍 This run compared file contents in full.")
+	}
+	if stats.FilesRenamed > 0 {
+		fmt.Printf("🚚 Renamed %d file(s) in the target instead of copying them.\n", stats.FilesRenamed)
+	}
+	if stats.FilesDeduped > 0 {
+		fmt.Printf("🔗 Hard-linked %d duplicate file(s) instead of copying them.\n", stats.FilesDeduped)
+	}
+	if dryRun {
+		added, freed := filesync.ByteImpact(fs.PlannedActions())
+		fmt.Printf("📦 Would add %s to the target and free %s on it.\n", formatBytes(added), formatBytes(freed))
+		fmt.Println("✅ Dry run completed, no changes were made.")
+	} else {
+		fmt.Println("✅ Synchronization completed successfully.")
+	}
+	return exitOK
+}
+
+// printProgress redraws the progress line on stderr.
+func printProgress(p filesync.Progress) {
+	eta := "--"
+	if p.ETA > 0 {
+		eta = p.ETA.String()
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K⏳ %d/%d files, %s/%s, %s/s, ETA %s",
+		p.FilesDone, p.FilesTotal, formatBytes(p.BytesDone), formatBytes(p.BytesTotal), formatBytes(int64(p.Rate)), eta)
+}
+
+// printHashProgress redraws the progress line on stderr while a large
+// file is hashed.
+func printHashProgress(p filesync.HashProgress) {
+	fmt.Fprintf(os.Stderr, "\r\033[K🔢 Hashing %s: %s/%s", p.Path, formatBytes(p.BytesDone), formatBytes(p.BytesTotal))
+}
+
+// formatBytes renders n with a binary unit, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// buildOptions translates the parsed CLI flags into library options.
+func buildOptions() ([]filesync.Option, error) {
+	fileModeBits, err := parseMode(fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("--file-mode: %w", err)
+	}
+	dirModeBits, err := parseMode(dirMode)
+	if err != nil {
+		return nil, fmt.Errorf("--dir-mode: %w", err)
+	}
+	rules, err := parseModeRules(modeRules)
+	if err != nil {
+		return nil, fmt.Errorf("--mode-rule: %w", err)
+	}
+	resolver, err := parseConflict(conflict)
+	if err != nil {
+		return nil, fmt.Errorf("--conflict: %w", err)
+	}
+	order, err := filesync.ParseCopyOrder(copyOrder)
+	if err != nil {
+		return nil, fmt.Errorf("--copy-order: %w", err)
+	}
+	shardIndex, shardCount, err := filesync.ParseShard(shard)
+	if err != nil {
+		return nil, fmt.Errorf("--shard: %w", err)
+	}
+	reserve, err := parseSize(minFree)
+	if err != nil {
+		return nil, fmt.Errorf("--min-free: %w", err)
+	}
+	capBytes, err := parseSize(sizeCap)
+	if err != nil {
+		return nil, fmt.Errorf("--size-cap: %w", err)
+	}
+	splitBytes, err := parseSize(splitSize)
+	if err != nil {
+		return nil, fmt.Errorf("--split-size: %w", err)
+	}
+	smallBytes, err := parseSize(smallFiles)
+	if err != nil {
+		return nil, fmt.Errorf("--small-file-threshold: %w", err)
+	}
+	rate, err := parseSize(bwLimit)
+	if err != nil {
+		return nil, fmt.Errorf("--bwlimit: %w", err)
+	}
+	windows, err := parseRateSchedule(rateSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("--rate-schedule: %w", err)
+	}
+	since, err := parseTime(modifiedSince)
+	if err != nil {
+		return nil, fmt.Errorf("--modified-since: %w", err)
+	}
+	uids, err := parseIDs(excludeOwners)
+	if err != nil {
+		return nil, fmt.Errorf("--exclude-owner: %w", err)
+	}
+	gids, err := parseIDs(excludeGroups)
+	if err != nil {
+		return nil, fmt.Errorf("--exclude-group: %w", err)
+	}
+
+	opts := []filesync.Option{
+		filesync.WithDeleteRetention(deleteRetention),
+		filesync.WithDeleteRetentionRuns(retentionRuns),
+		filesync.WithRetentionStateFile(retentionState),
+		filesync.WithDeleteOlderThan(deleteOlderThan),
+		filesync.WithAccessedSince(accessedWithin),
+		filesync.WithAccessTimeFallback(atimeFallback),
+		filesync.WithSourceDropGuard(dropGuard),
+		filesync.WithForceDelete(forceDelete),
+		filesync.WithDeletePreexistingOnly(deleteOldOnly),
+		filesync.WithDeleteFirst(deleteFirst),
+		filesync.WithDeleteFirstPerDir(deleteFirstDir),
+		filesync.WithDetectRenames(detectRenames),
+		filesync.WithStreaming(streaming),
+		filesync.WithTrash(trash),
+		filesync.WithForce(force),
+		filesync.WithAtomicCopy(atomicCopy),
+		filesync.WithChecksum(checksum || check),
+		filesync.WithDiffModes(checkModes),
+		filesync.WithContentOnly(contentOnly),
+		filesync.WithComparison(filesync.Comparison{IgnoreModTime: ignoreTimes, IgnoreSize: ignoreSize, Content: contentCheck}),
+		filesync.WithKeepModTimes(keepTimes),
+		filesync.WithMmapCompare(mmapCompare),
+		filesync.WithQuickHash(quickHash),
+		filesync.WithHashAlgorithm(hashAlgorithm),
+		filesync.WithPeriodicVerify(fullCheckEvery),
+		filesync.WithHeartbeat(heartbeat),
+		filesync.WithManifest(manifestFile),
+		filesync.WithManifestCompare(manifestCompare),
+		filesync.WithTimeTolerance(timeTolerance),
+		filesync.WithClockSkew(clockSkew),
+		filesync.WithClockCheck(clockCheck, clockCheckFail),
+		filesync.WithWriteCheck(writeCheck),
+		filesync.WithFingerprintCmd(fingerprintCmd),
+		filesync.WithModifiedSince(since),
+		filesync.WithFailOnAccessError(failOnAccess),
+		filesync.WithOneFileSystem(oneFileSystem),
+		filesync.WithJournal(journal),
+		filesync.WithCaseInsensitiveOrder(foldCaseOrder),
+		filesync.WithExcludes(splitList(excludes)...),
+		filesync.WithIncludes(splitList(includes)...),
+		filesync.WithExtensions(splitList(extensions)...),
+		filesync.WithContentTypes(splitList(contentTypes)...),
+		filesync.WithExcludeOwner(uids...),
+		filesync.WithExcludeGroup(gids...),
+		filesync.WithWorkers(workers),
+		filesync.WithParallelWalk(walkWorkers),
+		filesync.WithParallelPlan(planWorkers),
+		filesync.WithAutoWorkers(autoWorkers),
+		filesync.WithMaxOpenFiles(maxOpenFiles),
+		filesync.WithMaxPerDirectory(maxPerDir),
+		filesync.WithDryRun(dryRun),
+		filesync.WithUpdateOnly(updateOnly),
+		filesync.WithExistingOnly(existingOnly),
+		filesync.WithNoDowngrade(noDowngrade),
+		filesync.WithFirstSourceWins(firstWins),
+		filesync.WithPreallocate(preallocate),
+		filesync.WithRsyncSlashes(rsyncSlashes),
+		filesync.WithNestSourceDir(nestSource),
+		filesync.WithStripPrefix(stripPrefix),
+		filesync.WithRequirePrefix(requirePrefix),
+		filesync.WithXattrs(xattrs),
+		filesync.WithACLs(acls),
+		filesync.WithFileCaps(fileCaps),
+		filesync.WithAltStreams(altStreams),
+		filesync.WithFileFlags(fileFlags),
+		filesync.WithLoadThrottle(maxLoad),
+		filesync.WithPreserveBirthTime(birthTimes),
+		filesync.WithReflink(reflink),
+		filesync.WithWatchDebounce(watchDebounce),
+		filesync.WithFileMode(fileModeBits),
+		filesync.WithDirMode(dirModeBits),
+		filesync.WithChangedRetries(retryChanged),
+		filesync.WithMaxFilesPerRun(maxFiles),
+		filesync.WithMaxErrors(maxErrors),
+		filesync.WithCopyOrder(order),
+		filesync.WithShard(shardIndex, shardCount),
+		filesync.WithTargetSizeCap(capBytes),
+		filesync.WithEviction(evict),
+		filesync.WithPruneEmptyDirs(pruneEmpty),
+		filesync.WithNoEmptyDirs(noEmptyDirs && !keepEmptyDirs),
+		filesync.WithEmptyPlaceholders(placeholders && !strictEmpty),
+		filesync.WithPruneSourceEmptyDirs(pruneSrcEmpty),
+		filesync.WithBidirectional(bidirectional),
+		filesync.WithCAS(cas),
+		filesync.WithSnapshot(snapshot),
+		filesync.WithSwap(swap),
+		filesync.WithConflictResolver(resolver),
+		filesync.WithLock(lock),
+		filesync.WithLockTimeout(lockTimeout),
+		filesync.WithProfile(profile),
+		filesync.WithStatusServer(statusAddr),
+		filesync.WithSplitSize(splitBytes),
+		filesync.WithSmallFileThreshold(smallBytes),
+		filesync.WithRateLimit(rate),
+		filesync.WithRateSchedule(windows),
+		filesync.WithJoinParts(joinParts),
+		filesync.WithSkipLocked(skipLocked),
+		filesync.WithPermissionsFrom(permsFrom),
+		filesync.WithTreeHash(treeHash),
+		filesync.WithSpecialFiles(specialFiles),
+		filesync.WithPreserveSymlinks(preserveLinks),
+		filesync.WithFollowSymlinks(followLinks),
+		filesync.WithFollowTargetSymlinks(followTgtLinks),
+		filesync.WithPreservePerms(preservePerms),
+		filesync.WithPreserveOwner(preserveOwner),
+		filesync.WithDedup(dedup),
+		filesync.WithReportFile(reportFile),
+		filesync.WithTrace(traceFile),
+		filesync.WithDirsOnly(dirsOnly),
+	}
+	opts = append(opts, rules...)
+	if progress {
+		opts = append(opts, filesync.WithProgress(printProgress), filesync.WithHashProgress(printHashProgress))
+	}
+	// Resume and a temp dir imply atomic copies, so only apply them when requested
+	if resume {
+		opts = append(opts, filesync.WithResume(true))
+	}
+	if checksumCache != "" {
+		opts = append(opts, filesync.WithChecksumCache(true))
+		if checksumCache != "target" {
+			opts = append(opts, filesync.WithChecksumCacheFile(checksumCache))
+		}
+	}
+	if tempDir != "" {
+		opts = append(opts, filesync.WithTempDir(tempDir))
+	}
+	if contentMatch != "" {
+		re, err := regexp.Compile(contentMatch)
+		if err != nil {
+			return nil, fmt.Errorf("--content-match: %w", err)
+		}
+		opts = append(opts, filesync.WithContentMatch(re, matchBytes))
+	}
+	if checkpoint != "" {
+		path := checkpoint
+		if path == "target" {
+			path = ""
+		}
+		opts = append(opts,
+			filesync.WithCheckpoint(path),
+			filesync.WithCheckpointEvery(checkpointFiles, checkpointEvery))
+	}
+	if minFree != "" {
+		opts = append(opts,
+			filesync.WithFreeSpaceCheck(true),
+			filesync.WithFreeSpaceReserve(reserve),
+			filesync.WithAbortOnLowSpace(abortLowSpace))
+	}
+	return opts, nil
+}
+
+// writeEffectiveConfig prints the sources, the target and the value
+// of every flag after the config file was applied, one "name: value"
+// line each with flags sorted by name, so two setups can be diffed.
+// Flags set on the command line or by the config file are marked.
+func writeEffectiveConfig(w io.Writer, sources []location, target location, list bool) {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	fmt.Fprintf(w, "config: %q\n", configFile)
+	for _, source := range sources {
+		fmt.Fprintf(w, "source: %q\n", source)
+	}
+	if !list {
+		fmt.Fprintf(w, "target: %q\n", target)
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		// One-letter flags are aliases of long ones, and config and
+		// print-config were covered above
+		if len(f.Name) == 1 || f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		value := f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if s, isString := getter.Get().(string); isString {
+				value = strconv.Quote(s)
+			}
+		}
+		if given[f.Name] {
+			value += " # set"
+		}
+		fmt.Fprintf(w, "%s: %s\n", f.Name, value)
+	})
+}
+
+// location is a source or target argument: a local directory, or a
+// remote one written as sftp://user@host[:port]/path.
+type location struct {
+	path string
+	user string
+	addr string // host:port, empty for local paths
+}
+
+func (l location) remote() bool { return l.addr != "" }
+
+// String returns the location as it would be written on the command
+// line.
+func (l location) String() string {
+	if !l.remote() {
+		return l.path
+	}
+	return "sftp://" + l.user + "@" + l.addr + l.path
+}
+
+// parseLocation splits a command-line directory argument.
+func parseLocation(arg string) (location, error) {
+	if !strings.HasPrefix(arg, "sftp://") {
+		return location{path: arg}, nil
+	}
+	u, err := url.Parse(arg)
+	if err != nil {
+		return location{}, err
+	}
+	if u.Hostname() == "" {
+		return location{}, fmt.Errorf("missing host")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	path := u.Path
+	if path == "" {
+		path = "."
+	}
+	return location{path: path, user: user, addr: net.JoinHostPort(u.Hostname(), port)}, nil
+}
+
+// remoteOptions returns the options connecting to the remote source
+// and target, if any.
+func remoteOptions(source, target location) ([]filesync.Option, error) {
+	var opts []filesync.Option
+	if source.remote() {
+		config, err := sshConfig(source.user)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, filesync.WithSFTPSource(source.addr, config))
+	}
+	if target.remote() {
+		config, err := sshConfig(target.user)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, filesync.WithSFTPTarget(target.addr, config))
+	}
+	return opts, nil
+}
+
+// sshConfig authenticates as user with --ssh-key, or the SSH agent if
+// no key is given, and verifies servers against known_hosts.
+func sshConfig(user string) (*ssh.ClientConfig, error) {
+	knownHostsFile := sshKnownHosts
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth ssh.AuthMethod
+	if sshKey != "" {
+		key, err := os.ReadFile(sshKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("--ssh-key: %w", err)
+		}
+		auth = ssh.PublicKeys(signer)
+	} else {
+		sock, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return nil, fmt.Errorf("no --ssh-key given and no SSH agent available: %w", err)
+		}
+		auth = ssh.PublicKeysCallback(agent.NewClient(sock).Signers)
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// runDiffManifests prints how the second of two manifest files differs
+// from the first, for --diff-manifests, in --check's format, and
+// returns the exit code.
+func runDiffManifests(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s --diff-manifests [--diff-format text|json] <manifest_a> <manifest_b>\n", os.Args[0])
+		return exitFatal
+	}
+	if diffFormat != "text" && diffFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown --diff-format %q (want \"text\" or \"json\")\n", diffFormat)
+		return exitFatal
+	}
+	result, err := filesync.DiffManifests(args[0], args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error comparing manifests: %v\n", err)
+		return exitFatal
+	}
+	if diffFormat == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error comparing manifests: %v\n", err)
+			return exitFatal
+		}
+		fmt.Println(string(data))
+	} else {
+		filesync.WriteDiff(os.Stdout, result)
+		if result.Empty() {
+			fmt.Println("✅ The manifests match.")
+		} else {
+			fmt.Printf("⚠️ The manifests differ: %d differing, %d only in the first, %d only in the second\n",
+				len(result.Differing), len(result.OnlyInSource), len(result.OnlyInTarget))
+		}
+	}
+	// Like --check, a difference is exit code 3
+	if !result.Empty() {
+		return exitDiffers
+	}
+	return exitOK
+}
+
+// parseConflict maps a --conflict value to a resolver; "skip" yields
+// none, so conflicts are reported and left alone.
+func parseConflict(value string) (filesync.ConflictResolver, error) {
+	fixed := func(r filesync.Resolution) filesync.ConflictResolver {
+		return func(filesync.Conflict) filesync.Resolution { return r }
+	}
+	switch value {
+	case "skip":
+		return nil, nil
+	case "newest":
+		return filesync.NewestWins, nil
+	case "source":
+		return fixed(filesync.KeepSource), nil
+	case "target":
+		return fixed(filesync.KeepTarget), nil
+	case "both":
+		return fixed(filesync.KeepBoth), nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q", value)
+}
+
+// parseModeRules parses --mode-rule, a comma-separated list of
+// PATTERN=MODE pairs, into WithModeRule options in order.
+func parseModeRules(value string) ([]filesync.Option, error) {
+	var opts []filesync.Option
+	for _, item := range splitList(value) {
+		pattern, mode, ok := strings.Cut(item, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid rule %q (want PATTERN=MODE)", item)
+		}
+		bits, err := parseMode(mode)
+		if err != nil || mode == "" {
+			return nil, fmt.Errorf("invalid rule %q: want an octal mode", item)
+		}
+		opts = append(opts, filesync.WithModeRule(pattern, bits))
+	}
+	return opts, nil
+}
+
+// parseMode parses an octal permission string such as "0664".
+// An empty string yields zero, meaning "keep the default".
+func parseMode(value string) (os.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+	bits, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || bits > 0777 {
+		return 0, fmt.Errorf("invalid octal mode %q", value)
+	}
+	return os.FileMode(bits), nil
+}
+
+// parseSize parses a byte count with an optional binary unit suffix
+// (K, M, G or T), such as "500M". An empty string yields zero.
+func parseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	number, shift := strings.ToUpper(value), 0
+	if i := strings.IndexByte("KMGT", number[len(number)-1]); i >= 0 {
+		number, shift = number[:len(number)-1], 10*(i+1)
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)>>shift {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n << shift, nil
+}
+
+// parseRateSchedule parses --rate-schedule, a comma-separated list of
+// HH:MM-HH:MM=RATE windows such as "09:00-17:00=1M", with the rate in
+// bytes per second as parseSize reads it and 0 for unlimited.
+func parseRateSchedule(value string) ([]filesync.RateWindow, error) {
+	var windows []filesync.RateWindow
+	for _, item := range splitList(value) {
+		span, rate, ok := strings.Cut(item, "=")
+		from, to, hasRange := strings.Cut(span, "-")
+		if !ok || !hasRange || rate == "" {
+			return nil, fmt.Errorf("invalid window %q (want HH:MM-HH:MM=RATE)", item)
+		}
+		start, err := parseTimeOfDay(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeOfDay(to)
+		if err != nil {
+			return nil, err
+		}
+		limit, err := parseSize(rate)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, filesync.RateWindow{Start: start, End: end, BytesPerSecond: limit})
+	}
+	return windows, nil
+}
+
+// parseTimeOfDay parses a HH:MM time of day into its offset from
+// midnight.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseTime parses an RFC 3339 timestamp or a plain date, which is
+// taken as local midnight. An empty string yields the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return t, nil
+}
 
-	if flag.NArg() < 2 {
-		log.Fatalf("Usage: %s [--delete-missing] <source_dir> <target_dir>", os.Args[0])
+// parseIDs parses a comma-separated list of user or group ids.
+func parseIDs(value string) ([]int, error) {
+	var ids []int
+	for _, item := range splitList(value) {
+		id, err := strconv.Atoi(item)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid id %q", item)
+		}
+		ids = append(ids, id)
 	}
+	return ids, nil
+}
 
-	sourceDir := flag.Arg(0)
-	targetDir := flag.Arg(1)
+// applyConfig sets the flags not given on the command line from cfg,
+// whose keys are named like the flags, so that flags override the
+// config file. Keys without a flag, like sources, are left to the
+// caller.
+func applyConfig(cfg *filesync.Config) error {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
 
-	// Check if directories exist
-	if _, err := os.Stat(sourceDir); os.IsNotExist(err) {
-		log.Fatalf("Source directory does not exist: %s", sourceDir)
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, field := v.Type().Field(i).Tag.Get("yaml"), v.Field(i)
+		if given[name] || flag.Lookup(name) == nil || field.IsZero() {
+			continue
+		}
+		value := fmt.Sprint(field.Interface())
+		switch list := field.Interface().(type) {
+		case []string:
+			value = strings.Join(list, ",")
+		case []int:
+			value = strings.Trim(strings.Join(strings.Fields(fmt.Sprint(list)), ","), "[]")
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
 	}
-	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
-		log.Fatalf("Target directory does not exist: %s", targetDir)
+	return nil
+}
+
+// envPrefix starts the environment variables that set flags.
+const envPrefix = "FILESYNC_"
+
+// envName returns the environment variable for the flag name, such as
+// FILESYNC_DELETE_MISSING for --delete-missing.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets the flags not given on the command line from their
+// environment variables (see envName), for containers and CI. It runs
+// before applyConfig, so the environment overrides the config file and
+// the flags override both. FILESYNC_EXCLUDE and FILESYNC_INCLUDE may
+// separate patterns with colons or newlines as well as commas.
+func applyEnv() error {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if f.Name == "exclude" || f.Name == "include" {
+			value = strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+				return r == ':' || r == '\n' || r == ','
+			}), ",")
+		}
+		if setErr := flag.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// envLocations returns the sources from FILESYNC_SOURCES, one per
+// line since paths and sftp:// locations may hold colons, and the
+// target from FILESYNC_TARGET, for runs given no locations on the
+// command line. Either may be empty, leaving it to the config file.
+func envLocations() (sources []string, target string) {
+	for _, source := range strings.Split(os.Getenv(envPrefix+"SOURCES"), "\n") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources, strings.TrimSpace(os.Getenv(envPrefix + "TARGET"))
+}
+
+// applyArchive switches on the flags --archive stands for, leaving
+// those given on the command line (e.g. --preserve-owner=false) or in
+// the config file as they are.
+func applyArchive() error {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, name := range []string{"preserve-symlinks", "preserve-perms", "preserve-owner", "keep-times"} {
+		if given[name] {
+			continue
+		}
+		if err := flag.Set(name, "true"); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
 	}
+	return nil
+}
 
-	fs := filesync.NewFileSync(sourceDir, targetDir, deleteMissing)
+// interruptContext returns a context cancelled by the first SIGINT or
+// SIGTERM. Signals are no longer caught after that, so a second one
+// ends the process at once.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Fprintln(os.Stderr, "\n⏳ Interrupted, stopping after the current file (interrupt again to abort)")
+		cancel()
+	}()
+	return ctx
+}
 
-	// Synchronization
-	if err := fs.SyncDirs(); err != nil {
-		log.Fatalf("Error during synchronization: %v", err)
+// quoteList joins paths for the summary, quoted so unusual names
+// cannot garble the terminal.
+func quoteList(paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = strconv.Quote(p)
 	}
+	return strings.Join(quoted, ", ")
+}
 
-	fmt.Println("✅ Synchronization completed successfully.")
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
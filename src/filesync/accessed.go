@@ -0,0 +1,21 @@
+package filesync
+
+import (
+	"os"
+	"time"
+)
+
+// notAccessed reports whether the source file info describes falls
+// outside the WithAccessedSince window, its access time, or with
+// WithAccessTimeFallback the later of that and its mod time, being
+// longer ago.
+func (fs *FileSync) notAccessed(info os.FileInfo) bool {
+	if fs.accessedSince <= 0 {
+		return false
+	}
+	used := accessTime(info)
+	if fs.accessFallback && info.ModTime().After(used) {
+		used = info.ModTime()
+	}
+	return time.Since(used) > fs.accessedSince
+}
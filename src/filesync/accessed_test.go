@@ -0,0 +1,65 @@
+//go:build linux || darwin || windows
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_AccessedSince(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	old := now.Add(-90 * 24 * time.Hour)
+	// Read yesterday, read long ago, and written yesterday but with an
+	// access time left behind as on a noatime mount
+	files := map[string][2]time.Time{
+		"hot.txt":     {now.Add(-24 * time.Hour), old},
+		"cold.txt":    {old, old},
+		"written.txt": {old, now.Add(-24 * time.Hour)},
+	}
+	for name, times := range files {
+		writeTestFile(t, filepath.Join(src, name), name, times[1])
+		if err := os.Chtimes(filepath.Join(src, name), times[0], times[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A stale copy of the cold file is kept by the delete pass
+	writeTestFile(t, filepath.Join(dst, "cold.txt"), "stale", old)
+
+	for _, tc := range []struct {
+		fallback bool
+		copied   []string
+	}{
+		{false, []string{"hot.txt"}},
+		{true, []string{"hot.txt", "written.txt"}},
+	} {
+		os.Remove(filepath.Join(dst, "hot.txt"))
+		os.Remove(filepath.Join(dst, "written.txt"))
+		fs := NewFileSync(src, dst, true, WithAccessedSince(30*24*time.Hour), WithAccessTimeFallback(tc.fallback))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		for name := range files {
+			_, err := os.Stat(filepath.Join(dst, name))
+			want := name == "cold.txt"
+			for _, c := range tc.copied {
+				want = want || c == name
+			}
+			if got := err == nil; got != want {
+				t.Errorf("fallback %v: %s in target = %v, want %v", tc.fallback, name, got, want)
+			}
+		}
+		stats := fs.Stats()
+		if stats.FilesCopied != len(tc.copied) || stats.FilesNotAccessed != len(files)-len(tc.copied) {
+			t.Errorf("fallback %v: copied %d, not accessed %d", tc.fallback, stats.FilesCopied, stats.FilesNotAccessed)
+		}
+		if got, _ := os.ReadFile(filepath.Join(dst, "cold.txt")); string(got) != "stale" {
+			t.Errorf("fallback %v: cold.txt = %q, want the stale copy kept", tc.fallback, got)
+		}
+	}
+}
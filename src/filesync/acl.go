@@ -0,0 +1,10 @@
+package filesync
+
+// copyACL gives the local target path the POSIX ACLs of the source
+// path with WithACLs, handling unsupported ACLs with metaUnsupported.
+func (fs *FileSync) copyACL(src, dst string, isDir bool) error {
+	if !fs.acls || fs.metaDenied(metaACLs) {
+		return nil
+	}
+	return fs.metaUnsupported(metaACLs, copyPosixACL(src, dst, isDir))
+}
@@ -0,0 +1,66 @@
+package filesync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// POSIX ACLs live in these extended attributes on Linux: the access
+// ACL of any file, and the default ACL new entries of a directory
+// inherit.
+const (
+	aclAccessXattr  = "system.posix_acl_access"
+	aclDefaultXattr = "system.posix_acl_default"
+)
+
+// copyPosixACL gives dst the access ACL of src and, for directories,
+// its default ACL. An ACL the source does not have is removed from
+// dst, so a file that lost its ACL loses it in the target too. Errors
+// for filesystems without ACLs or a lack of permission wrap
+// errors.ErrUnsupported.
+func copyPosixACL(src, dst string, isDir bool) error {
+	names := []string{aclAccessXattr}
+	if isDir {
+		names = append(names, aclDefaultXattr)
+	}
+	for _, name := range names {
+		value, err := getXattr(src, name)
+		switch {
+		case errors.Is(err, unix.ENODATA):
+			err = unix.Removexattr(dst, name)
+			if errors.Is(err, unix.ENODATA) {
+				err = nil
+			}
+		case err == nil:
+			err = unix.Setxattr(dst, name, value, 0)
+		}
+		if err != nil {
+			if xattrUnsupported(err) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) {
+				return fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// samePosixACL reports whether the files srcPath and tgtPath carry the
+// same access ACL. A side whose filesystem has no ACLs counts as
+// matching.
+func samePosixACL(srcPath, tgtPath string) (bool, error) {
+	var acls [2][]byte
+	for i, path := range []string{srcPath, tgtPath} {
+		value, err := getXattr(path, aclAccessXattr)
+		switch {
+		case xattrUnsupported(err):
+			return true, nil
+		case err != nil && !errors.Is(err, unix.ENODATA):
+			return false, err
+		}
+		acls[i] = value
+	}
+	return bytes.Equal(acls[0], acls[1]), nil
+}
@@ -0,0 +1,96 @@
+package filesync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// testACL encodes a POSIX ACL in the kernel's xattr format, granting
+// the extra user uid read access.
+func testACL(uid uint32) []byte {
+	const undefinedID = 0xffffffff
+	type entry struct {
+		tag, perm uint16
+		id        uint32
+	}
+	entries := []entry{
+		{0x01, 6, undefinedID}, // user::rw-
+		{0x02, 4, uid},         // user:uid:r--
+		{0x04, 4, undefinedID}, // group::r--
+		{0x10, 4, undefinedID}, // mask::r--
+		{0x20, 0, undefinedID}, // other::---
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(2))
+	for _, e := range entries {
+		binary.Write(&b, binary.LittleEndian, e)
+	}
+	return b.Bytes()
+}
+
+func TestFileSync_ACLs(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "shared", "a.txt"), "hello", time.Now())
+	acl := testACL(uint32(os.Getuid()) + 1)
+	if err := unix.Setxattr(filepath.Join(src, "shared", "a.txt"), aclAccessXattr, acl, 0); err != nil {
+		t.Skipf("ACLs not supported here: %v", err)
+	}
+	if err := unix.Setxattr(filepath.Join(src, "shared"), aclDefaultXattr, acl, 0); err != nil {
+		t.Skipf("default ACLs not supported here: %v", err)
+	}
+
+	fs := NewFileSync(src, dst, false, WithACLs(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Stats().Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ path, name string }{
+		{filepath.Join(dst, "shared", "a.txt"), aclAccessXattr},
+		{filepath.Join(dst, "shared"), aclDefaultXattr},
+	} {
+		got, err := getXattr(c.path, c.name)
+		if err != nil {
+			t.Fatalf("%s of %s: %v", c.name, c.path, err)
+		}
+		if !bytes.Equal(got, acl) {
+			t.Errorf("%s of %s = %x, want %x", c.name, c.path, got, acl)
+		}
+	}
+
+	// An ACL removed from the source goes away in the target too
+	if err := unix.Removexattr(filepath.Join(src, "shared", "a.txt"), aclAccessXattr); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src, "shared", "a.txt"), "changed", time.Now().Add(time.Minute))
+	if err := NewFileSync(src, dst, false, WithACLs(true)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getXattr(filepath.Join(dst, "shared", "a.txt"), aclAccessXattr); err == nil {
+		t.Error("expected the access ACL to be removed from the target")
+	}
+
+	// An ACL that differs alone brings a recopy
+	if err := unix.Setxattr(filepath.Join(src, "shared", "a.txt"), aclAccessXattr, acl, 0); err != nil {
+		t.Fatal(err)
+	}
+	fs = NewFileSync(src, dst, false, WithACLs(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Stats().FilesCopied != 1 {
+		t.Errorf("FilesCopied = %d, want 1 for the new ACL", fs.Stats().FilesCopied)
+	}
+	if got, err := getXattr(filepath.Join(dst, "shared", "a.txt"), aclAccessXattr); err != nil || !bytes.Equal(got, acl) {
+		t.Errorf("access ACL of a.txt = %x, %v; want %x", got, err, acl)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package filesync
+
+import (
+	"errors"
+	"fmt"
+)
+
+// copyPosixACL is not available on this platform; only Linux ACLs are
+// copied.
+func copyPosixACL(src, dst string, isDir bool) error {
+	return fmt.Errorf("%w: POSIX ACLs are only copied on Linux", errors.ErrUnsupported)
+}
+
+// samePosixACL reports a match, as ACLs are not compared here.
+func samePosixACL(srcPath, tgtPath string) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,48 @@
+package filesync
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+)
+
+// copyAltStreams gives the local target file dst the alternate data
+// streams or resource fork of src with WithAltStreams, removing the
+// ones src does not have, handling targets that cannot hold them with
+// metaUnsupported.
+func (fs *FileSync) copyAltStreams(src, dst string) error {
+	if !fs.altStreams || fs.metaDenied(metaStreams) {
+		return nil
+	}
+	streams, err := readAltStreams(src)
+	if errors.Is(err, errors.ErrUnsupported) {
+		// The source's filesystem has none to copy
+		return nil
+	}
+	if err == nil {
+		err = writeAltStreams(dst, streams)
+	}
+	return fs.metaUnsupported(metaStreams, err)
+}
+
+// sameAltStreams reports whether the local files srcPath and tgtPath
+// carry the same alternate data streams. A side whose filesystem
+// cannot hold any counts as matching, so targets without support are
+// not recopied on every run.
+func (fs *FileSync) sameAltStreams(srcPath, tgtPath string) (bool, error) {
+	src, err := readAltStreams(srcPath)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	tgt, err := readAltStreams(tgtPath)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return maps.EqualFunc(src, tgt, bytes.Equal), nil
+}
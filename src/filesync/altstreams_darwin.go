@@ -0,0 +1,45 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// resourceForkXattr is how macOS exposes a file's resource fork.
+const resourceForkXattr = "com.apple.ResourceFork"
+
+// readAltStreams returns the resource fork of path, keyed by its name,
+// or none. Errors for filesystems without resource forks wrap
+// errors.ErrUnsupported.
+func readAltStreams(path string) (map[string][]byte, error) {
+	fork, err := getXattr(path, resourceForkXattr)
+	if errors.Is(err, unix.ENOATTR) || err == nil && len(fork) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		if xattrUnsupported(err) {
+			return nil, fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+		}
+		return nil, err
+	}
+	return map[string][]byte{resourceForkXattr: fork}, nil
+}
+
+// writeAltStreams gives dst the resource fork in streams, or removes
+// its own if there is none. Errors for filesystems that cannot hold
+// one wrap errors.ErrUnsupported.
+func writeAltStreams(dst string, streams map[string][]byte) error {
+	var err error
+	if fork, ok := streams[resourceForkXattr]; ok {
+		err = unix.Setxattr(dst, resourceForkXattr, fork, 0)
+	} else if err = unix.Removexattr(dst, resourceForkXattr); errors.Is(err, unix.ENOATTR) || xattrUnsupported(err) {
+		// Nothing to remove
+		err = nil
+	}
+	if err != nil && (xattrUnsupported(err) || errors.Is(err, unix.EPERM)) {
+		return fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+	}
+	return err
+}
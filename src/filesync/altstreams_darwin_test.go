@@ -0,0 +1,48 @@
+package filesync
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFileSync_AltStreams(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "Icon"), "icon", time.Now())
+	fork := bytes.Repeat([]byte("rsrc"), 1024)
+	if err := unix.Setxattr(filepath.Join(src, "Icon"), resourceForkXattr, fork, 0); err != nil {
+		t.Skipf("cannot write resource forks here: %v", err)
+	}
+
+	fs := NewFileSync(src, dst, false, WithAltStreams(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := getXattr(filepath.Join(dst, "Icon"), resourceForkXattr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fork) {
+		t.Errorf("resource fork = %d bytes, want %d", len(got), len(fork))
+	}
+
+	// A fork dropped from the source is dropped from the copy
+	if err := unix.Removexattr(filepath.Join(src, "Icon"), resourceForkXattr); err != nil {
+		t.Fatal(err)
+	}
+	fs = NewFileSync(src, dst, false, WithAltStreams(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 1 {
+		t.Errorf("copied %d files, want 1", got)
+	}
+	if streams, err := readAltStreams(filepath.Join(dst, "Icon")); err != nil || len(streams) != 0 {
+		t.Errorf("target streams = %v, %v; want none", streams, err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !windows
+
+package filesync
+
+// readAltStreams reports that files carry no alternate data streams on
+// this platform.
+func readAltStreams(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// writeAltStreams is a no-op where files carry no alternate data
+// streams.
+func writeAltStreams(dst string, streams map[string][]byte) error {
+	return nil
+}
@@ -0,0 +1,114 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procFindFirstStreamW = windows.NewLazySystemDLL("kernel32.dll").NewProc("FindFirstStreamW")
+	procFindNextStreamW  = windows.NewLazySystemDLL("kernel32.dll").NewProc("FindNextStreamW")
+)
+
+// findStreamData is WIN32_FIND_STREAM_DATA from fileapi.h.
+type findStreamData struct {
+	size int64
+	name [windows.MAX_PATH + 36]uint16
+}
+
+// mainStream is the name FindFirstStreamW gives a file's own data.
+const mainStream = "::$DATA"
+
+// readAltStreams returns the NTFS alternate data streams of path, such
+// as Zone.Identifier, keyed by their ":name:$DATA" names. Errors for
+// filesystems without streams, such as FAT, wrap
+// errors.ErrUnsupported.
+func readAltStreams(path string) (map[string][]byte, error) {
+	names, err := listAltStreams(path)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	streams := make(map[string][]byte, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(longPath(path) + name)
+		if err != nil {
+			return nil, err
+		}
+		streams[name] = data
+	}
+	return streams, nil
+}
+
+// listAltStreams returns the names of the streams of path other than
+// its main data.
+func listAltStreams(path string) ([]string, error) {
+	if procFindFirstStreamW.Find() != nil {
+		return nil, fmt.Errorf("%w: FindFirstStreamW is not available", errors.ErrUnsupported)
+	}
+	name, err := windows.UTF16PtrFromString(longPath(path))
+	if err != nil {
+		return nil, err
+	}
+	var data findStreamData
+	h, _, err := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(name)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if windows.Handle(h) == windows.InvalidHandle {
+		switch {
+		case errors.Is(err, windows.ERROR_HANDLE_EOF):
+			// No streams at all, as for an empty file on some systems
+			return nil, nil
+		case errors.Is(err, windows.ERROR_INVALID_PARAMETER), errors.Is(err, windows.ERROR_NOT_SUPPORTED):
+			return nil, fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+		}
+		return nil, err
+	}
+	defer windows.FindClose(windows.Handle(h))
+
+	var names []string
+	for {
+		if stream := windows.UTF16ToString(data.name[:]); stream != mainStream {
+			names = append(names, stream)
+		}
+		ok, _, err := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data)))
+		if ok == 0 {
+			if errors.Is(err, windows.ERROR_HANDLE_EOF) {
+				return names, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// writeAltStreams makes the alternate data streams of dst those in
+// streams, removing the others. Errors for filesystems that cannot
+// hold them wrap errors.ErrUnsupported.
+func writeAltStreams(dst string, streams map[string][]byte) error {
+	names, err := listAltStreams(dst)
+	if errors.Is(err, errors.ErrUnsupported) && len(streams) == 0 {
+		// Nothing to remove
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, ok := streams[name]; !ok {
+			if err := os.Remove(longPath(dst) + name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	for name, data := range streams {
+		if err := os.WriteFile(longPath(dst)+name, data, 0666); err != nil {
+			if errors.Is(err, windows.ERROR_INVALID_NAME) || errors.Is(err, windows.ERROR_NOT_SUPPORTED) {
+				return fmt.Errorf("%w: stream %s: %v", errors.ErrUnsupported, strings.TrimSuffix(name, ":$DATA"), err)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_AltStreams(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", modified)
+
+	// Writing a stream touches the file, so the mod time is put back
+	// for only the streams to tell the runs apart
+	for i, zone := range []string{"[ZoneTransfer]\r\nZoneId=3\r\n", "[ZoneTransfer]\r\nZoneId=2\r\n"} {
+		path := filepath.Join(src, "a.txt")
+		if err := os.WriteFile(path+":Zone.Identifier", []byte(zone), 0666); err != nil {
+			t.Skipf("cannot write alternate data streams here: %v", err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		fs := NewFileSync(src, dst, false, WithAltStreams(true))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fs.Stats().FilesCopied; got != 1 {
+			t.Errorf("run %d: copied %d files, want 1", i, got)
+		}
+		got, err := os.ReadFile(filepath.Join(dst, "a.txt") + ":Zone.Identifier")
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		if string(got) != zone {
+			t.Errorf("run %d: stream = %q, want %q", i, got, zone)
+		}
+	}
+
+	// Unchanged streams are not recopied
+	fs := NewFileSync(src, dst, false, WithAltStreams(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 0 {
+		t.Errorf("copied %d files again, want 0", got)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build darwin
+
+package filesync
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns when the file info describes was last read, or
+// its mod time where that is not known.
+func accessTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atimespec.Unix())
+	}
+	return info.ModTime()
+}
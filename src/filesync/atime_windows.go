@@ -0,0 +1,18 @@
+//go:build windows
+
+package filesync
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns when the file info describes was last read, or
+// its mod time where that is not known.
+func accessTime(info os.FileInfo) time.Time {
+	if attrs, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, attrs.LastAccessTime.Nanoseconds())
+	}
+	return info.ModTime()
+}
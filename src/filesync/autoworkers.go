@@ -0,0 +1,112 @@
+package filesync
+
+import (
+	"sync"
+	"time"
+)
+
+// Tuning of WithAutoWorkers: the pool starts small and is adjusted
+// once per window, by one worker at a time.
+const (
+	autoWorkersStart  = 2
+	autoWorkersWindow = 250 * time.Millisecond
+)
+
+// workerTuner limits how many workers of a pool run at once and climbs
+// towards the limit with the best throughput: while a step raises the
+// bytes read per window it keeps going that way, otherwise it turns
+// around. A nil tuner places no limit.
+type workerTuner struct {
+	max  int
+	read func() int64 // bytes read so far by the pool's jobs
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	active   int
+	lastRead int64 // read at the last adjustment
+
+	step     int // +1 or -1
+	lastRate float64
+	best     int
+	bestRate float64
+}
+
+// newWorkerTuner returns a tuner for a pool of up to max workers whose
+// throughput is the growth of read.
+func newWorkerTuner(max int, read func() int64) *workerTuner {
+	t := &workerTuner{max: max, read: read, limit: min(autoWorkersStart, max), step: 1}
+	t.best = t.limit
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire waits until the worker may take a job.
+func (t *workerTuner) acquire() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	for t.active >= t.limit {
+		t.cond.Wait()
+	}
+	t.active++
+	t.mu.Unlock()
+}
+
+// release hands back a worker's turn after a job.
+func (t *workerTuner) release() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.active--
+	t.mu.Unlock()
+	t.cond.Signal()
+}
+
+// adjust ends a window of d, moving the limit one step.
+func (t *workerTuner) adjust(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	read := t.read()
+	rate := float64(read-t.lastRead) / d.Seconds()
+	t.lastRead = read
+	if rate > t.bestRate {
+		t.best, t.bestRate = t.limit, rate
+	}
+	if rate < t.lastRate {
+		t.step = -t.step
+	}
+	t.lastRate = rate
+	if next := t.limit + t.step; next >= 1 && next <= t.max {
+		t.limit = next
+	} else {
+		// At either end, head back the other way
+		t.step = -t.step
+	}
+	t.cond.Broadcast()
+}
+
+// run adjusts the limit every window until stop is closed.
+func (t *workerTuner) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(autoWorkersWindow)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			t.adjust(now.Sub(last))
+			last = now
+		}
+	}
+}
+
+// chosen returns the worker count that gave the best throughput.
+func (t *workerTuner) chosen() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.best
+}
@@ -0,0 +1,75 @@
+package filesync
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerTuner_ClimbsToBestThroughput(t *testing.T) {
+	// Throughput rises up to four workers and falls beyond
+	rate := map[int]int64{1: 10, 2: 20, 3: 30, 4: 40, 5: 35, 6: 30, 7: 25, 8: 20}
+	var read int64
+	tuner := newWorkerTuner(8, func() int64 { return read })
+	var limits []int
+	for range 8 {
+		read += rate[tuner.limit]
+		tuner.adjust(time.Second)
+		limits = append(limits, tuner.limit)
+	}
+	if got := tuner.chosen(); got != 4 {
+		t.Errorf("chosen() = %d, want 4 (limits %v)", got, limits)
+	}
+	for _, limit := range limits {
+		if limit < 3 || limit > 5 {
+			t.Errorf("limits = %v, want them to stay around 4", limits)
+			break
+		}
+	}
+
+	// Never beyond the bounds
+	tuner = newWorkerTuner(1, func() int64 { return read })
+	for range 3 {
+		read += 100
+		tuner.adjust(time.Second)
+		if tuner.limit != 1 {
+			t.Fatalf("limit = %d with a maximum of 1", tuner.limit)
+		}
+	}
+}
+
+func TestFileSync_AutoWorkers(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for i := range 50 {
+		p := fmt.Sprintf("f%02d.txt", i)
+		mem.WriteFile("/src/"+p, []byte(strings.Repeat("x", i)), now)
+		mem.WriteFile("/dst/"+p, []byte(strings.Repeat("y", i)), now)
+	}
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem),
+		WithChecksum(true), WithWorkers(6), WithAutoWorkers(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if w := fs.Stats().Workers; w < 1 || w > 6 {
+		t.Errorf("Workers = %d, want 1 to 6", w)
+	}
+	if fs.Stats().FilesCopied != 49 {
+		t.Errorf("FilesCopied = %d, want 49", fs.Stats().FilesCopied)
+	}
+	// The throughput is what the comparisons read: every file, on
+	// both sides
+	if got, want := fs.contentRead.Load(), int64(2*49*50/2); got != want {
+		t.Errorf("content read = %d bytes, want %d", got, want)
+	}
+
+	// Nothing is read by comparing sizes and mod times
+	fs = NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithWorkers(6), WithAutoWorkers(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.contentRead.Load(); got != 0 {
+		t.Errorf("content read = %d bytes without checksums, want 0", got)
+	}
+}
@@ -0,0 +1,338 @@
+package filesync
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bidirStateName is the file in the target recording the state of
+// every file after the last two-way sync.
+const bidirStateName = ".filesync-bidir.json"
+
+// Conflict is a file that changed on both sides since the last
+// two-way sync (or that differs and has no recorded history).
+type Conflict struct {
+	Path string // relative to both roots
+
+	SourcePath    string
+	SourceSize    int64
+	SourceModTime time.Time
+
+	TargetPath    string
+	TargetSize    int64
+	TargetModTime time.Time
+}
+
+// Resolution says how a Conflict is settled.
+type Resolution int
+
+const (
+	// Skip leaves both versions as they are; the conflict is reported
+	// again on the next run.
+	Skip Resolution = iota
+	// KeepSource copies the source version over the target.
+	KeepSource
+	// KeepTarget copies the target version over the source.
+	KeepTarget
+	// KeepBoth keeps the source version at the path and saves the
+	// target version next to it on both sides (see conflictName).
+	KeepBoth
+)
+
+// ConflictResolver decides how a conflict in two-way mode is settled.
+type ConflictResolver func(c Conflict) Resolution
+
+// NewestWins is a ConflictResolver that keeps whichever version was
+// modified last, preferring the source on a tie.
+func NewestWins(c Conflict) Resolution {
+	if c.TargetModTime.After(c.SourceModTime) {
+		return KeepTarget
+	}
+	return KeepSource
+}
+
+// bidirRecord is the state of one file right after it was synced.
+type bidirRecord struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// matches reports whether info still describes the recorded file.
+func (r bidirRecord) matches(info os.FileInfo, tolerance time.Duration) bool {
+	return r.Size == info.Size() && sameModTime(r.ModTime, info.ModTime(), tolerance)
+}
+
+// bidirFile returns the path of the two-way state file.
+func (fs *FileSync) bidirFile() string {
+	return filepath.Join(fs.target, bidirStateName)
+}
+
+// conflictName is where KeepBoth saves the target version of path:
+// "report.txt" becomes "report.conflict.txt".
+func conflictName(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".conflict" + ext
+}
+
+// syncBidirectional reconciles the source tree with the target in
+// both directions (see WithBidirectional).
+func (fs *FileSync) syncBidirectional(tree sourceTree) error {
+	state := map[string]bidirRecord{}
+	data, err := readFile(fs.tgtFS, fs.bidirFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+	}
+
+	srcFiles, err := fs.listFiles(tree.fsys, tree.root, tree)
+	if err != nil {
+		return err
+	}
+	tgtFiles, err := fs.listFiles(fs.tgtFS, fs.target, tree)
+	if err != nil {
+		return err
+	}
+	// A vanished source would look like everything was deleted there
+	if err := checkSourcesPresent(tree); err != nil {
+		return err
+	}
+
+	var paths []string
+	for relPath := range srcFiles {
+		paths = append(paths, relPath)
+	}
+	for relPath := range tgtFiles {
+		if _, ok := srcFiles[relPath]; !ok {
+			paths = append(paths, relPath)
+		}
+	}
+	if fs.foldCaseOrder {
+		sort.Slice(paths, func(i, j int) bool { return foldedLess(paths[i], paths[j]) })
+	} else {
+		sort.Strings(paths)
+	}
+
+	reverse := fs.reversed(tree.root)
+	next := map[string]bidirRecord{}
+	for _, relPath := range paths {
+		srcPath := filepath.Join(tree.root, relPath)
+		tgtPath := filepath.Join(fs.target, relPath)
+		src, inSource := srcFiles[relPath]
+		tgt, inTarget := tgtFiles[relPath]
+		rec, known := state[relPath]
+
+		switch {
+		// A file deleted on one side is only deleted on the other if it
+		// was left unchanged there; otherwise the change wins
+		case inSource && !inTarget:
+			if known && fs.deleteMissing && rec.matches(src, fs.timeTolerance) {
+				fs.removeFile(fs.srcFS, srcPath, "source")
+				continue
+			}
+			if fs.copyOneWay(fs, srcPath, tgtPath, relPath, ActionAdd, "") {
+				next[relPath] = bidirRecord{Size: src.Size(), ModTime: src.ModTime()}
+			}
+
+		case inTarget && !inSource:
+			if known && fs.deleteMissing && rec.matches(tgt, fs.timeTolerance) {
+				if fs.removeFile(fs.tgtFS, tgtPath, "target") {
+					fs.recordAction(ActionDelete, relPath, false, "")
+				}
+				continue
+			}
+			if fs.copyOneWay(reverse, tgtPath, srcPath, relPath, "", "") {
+				next[relPath] = bidirRecord{Size: tgt.Size(), ModTime: tgt.ModTime()}
+			}
+
+		default:
+			reason, err := fs.compareFiles(srcPath, tgtPath, src, tgt)
+			if err != nil {
+				log.Printf("❌ Could not compare %q with %q: %v", srcPath, tgtPath, err)
+				fs.recordError(&CompareError{Src: srcPath, Dst: tgtPath, Err: err})
+				continue
+			}
+			if reason == "" {
+				fs.stats.FilesSkipped++
+				next[relPath] = bidirRecord{Size: src.Size(), ModTime: src.ModTime()}
+				continue
+			}
+
+			srcChanged := !known || !rec.matches(src, fs.timeTolerance)
+			tgtChanged := !known || !rec.matches(tgt, fs.timeTolerance)
+			resolution := KeepSource
+			switch {
+			case srcChanged && tgtChanged:
+				resolution = fs.resolveConflict(Conflict{
+					Path:       relPath,
+					SourcePath: srcPath, SourceSize: src.Size(), SourceModTime: src.ModTime(),
+					TargetPath: tgtPath, TargetSize: tgt.Size(), TargetModTime: tgt.ModTime(),
+				})
+			case tgtChanged:
+				resolution = KeepTarget
+			}
+
+			switch resolution {
+			case KeepSource:
+				if fs.copyOneWay(fs, srcPath, tgtPath, relPath, ActionModify, reason) {
+					next[relPath] = bidirRecord{Size: src.Size(), ModTime: src.ModTime()}
+				}
+			case KeepTarget:
+				if fs.copyOneWay(reverse, tgtPath, srcPath, relPath, "", "") {
+					next[relPath] = bidirRecord{Size: tgt.Size(), ModTime: tgt.ModTime()}
+				}
+			case KeepBoth:
+				if fs.keepBoth(reverse, srcPath, tgtPath, relPath, reason) {
+					next[relPath] = bidirRecord{Size: src.Size(), ModTime: src.ModTime()}
+					next[conflictName(relPath)] = bidirRecord{Size: tgt.Size(), ModTime: tgt.ModTime()}
+				}
+			default:
+				log.Printf("⚠️ Conflict skipped: %q", relPath)
+				fs.stats.Conflicts = append(fs.stats.Conflicts, relPath)
+				if known {
+					next[relPath] = rec
+				}
+			}
+		}
+	}
+
+	if fs.dryRun {
+		return nil
+	}
+	data, err = json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fs.bidirFile() + ".tmp"
+	if err := writeFile(fs.tgtFS, tmp, data); err != nil {
+		return err
+	}
+	return fs.tgtFS.Rename(tmp, fs.bidirFile())
+}
+
+// resolveConflict asks the configured resolver, or reports the
+// conflict as skipped if there is none.
+func (fs *FileSync) resolveConflict(c Conflict) Resolution {
+	if fs.conflictResolver == nil {
+		return Skip
+	}
+	return fs.conflictResolver(c)
+}
+
+// listFiles returns the regular files below root on fsys by relative
+// path, applying the source tree's exclusions to either side. Special
+// files are skipped and listed in Stats().Special.
+func (fs *FileSync) listFiles(fsys FS, root string, tree sourceTree) (map[string]os.FileInfo, error) {
+	files := map[string]os.FileInfo{}
+	if _, err := fsys.Lstat(root); os.IsNotExist(err) {
+		return files, nil
+	}
+	err := fs.walk(fsys, root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error accessing %q: %v", path, err)
+			fs.recordError(&WalkError{Path: path, Err: err})
+			return fs.accessError(path, err)
+		}
+		relPath, _ := filepath.Rel(root, path)
+		if fs.isInternal(path) {
+			return nil
+		}
+		if fs.excluded(tree.ignores, relPath, d.IsDir()) || fs.contentExcluded(fsys, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := fsys.Stat(path)
+		if err != nil {
+			log.Printf("❌ Could not read file info for %q: %v", path, err)
+			fs.recordError(&StatError{Path: path, Err: err})
+			return fs.accessError(path, err)
+		}
+		// Opening a named pipe blocks, so special files stay out of
+		// two-way syncs on either side
+		if isSpecial(info.Mode()) {
+			log.Printf("⚠️ Skipping %s: %q", specialKind(info.Mode()), path)
+			fs.stats.Special = append(fs.stats.Special, relPath)
+			return nil
+		}
+		files[relPath] = info
+		return nil
+	})
+	return files, err
+}
+
+// reversed returns a copy of fs that copies from the target into the
+// source tree rooted at sourceRoot, for the target-to-source half.
+func (fs *FileSync) reversed(sourceRoot string) *FileSync {
+	rev := *fs
+	rev.srcFS, rev.tgtFS = fs.tgtFS, fs.srcFS
+	rev.source, rev.target = fs.target, sourceRoot
+	rev.transforms = nil
+	rev.progress = nil
+	return &rev
+}
+
+// copyOneWay copies src to dst using copier's filesystems and reports
+// whether it succeeded. Copies into the target are recorded as kind;
+// an empty kind marks a copy into the source.
+func (fs *FileSync) copyOneWay(copier *FileSync, src, dst, relPath string, kind ActionKind, reason DiffReason) bool {
+	if fs.dryRun {
+		log.Printf("🔎 Would copy: %q → %q", src, dst)
+	} else if err := copier.copyFile(src, dst); err != nil {
+		log.Printf("❌ Error copying %q → %q: %v", src, dst, err)
+		fs.recordError(&CopyError{Src: src, Dst: dst, Err: err})
+		return false
+	} else {
+		log.Printf("📄 Copied/Updated: %q → %q", src, dst)
+	}
+	if kind != "" {
+		fs.recordAction(kind, relPath, false, reason)
+	}
+	fs.stats.FilesCopied++
+	return true
+}
+
+// keepBoth settles a conflict by saving the target version as its
+// conflict copy on both sides and then copying the source version
+// over the target.
+func (fs *FileSync) keepBoth(reverse *FileSync, srcPath, tgtPath, relPath string, reason DiffReason) bool {
+	conflictRel := conflictName(relPath)
+	tgtConflict := filepath.Join(fs.target, conflictRel)
+	if !fs.dryRun {
+		if err := fs.tgtFS.Rename(tgtPath, tgtConflict); err != nil {
+			log.Printf("❌ Failed to keep conflicting %q: %v", tgtPath, err)
+			fs.recordError(&CopyError{Src: tgtPath, Dst: tgtConflict, Err: err})
+			return false
+		}
+	}
+	srcConflict := filepath.Join(reverse.target, conflictRel)
+	return fs.copyOneWay(reverse, tgtConflict, srcConflict, conflictRel, "", "") &&
+		fs.copyOneWay(fs, srcPath, tgtPath, relPath, ActionModify, reason)
+}
+
+// removeFile deletes a file that was deleted on the other side.
+func (fs *FileSync) removeFile(fsys FS, path, side string) bool {
+	if fs.dryRun {
+		log.Printf("🔎 Would remove %s file: %q", side, path)
+	} else if err := fs.removeEntry(fsys, path); err != nil {
+		log.Printf("❌ Failed to remove %q: %v", path, err)
+		fs.recordError(&DeleteError{Path: path, Err: err})
+		return false
+	} else {
+		log.Printf("🗑️ Removed %s file: %q", side, path)
+	}
+	fs.stats.FilesDeleted++
+	return true
+}
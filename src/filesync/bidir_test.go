@@ -0,0 +1,142 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileSync_BidirectionalPropagatesBothWays(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "from-src.txt"), "s", old)
+	writeTestFile(t, filepath.Join(dst, "sub", "from-dst.txt"), "d", old)
+	writeTestFile(t, filepath.Join(src, "shared.txt"), "v1", old)
+	writeTestFile(t, filepath.Join(src, "doomed.txt"), "x", old)
+
+	fs := NewFileSync(src, dst, true, WithBidirectional(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "from-src.txt")); got != "s" {
+		t.Errorf("target from-src.txt = %q", got)
+	}
+	if got := readTestFile(t, filepath.Join(src, "sub", "from-dst.txt")); got != "d" {
+		t.Errorf("source sub/from-dst.txt = %q", got)
+	}
+
+	// Edit on the target side only, delete on the target side only
+	writeTestFile(t, filepath.Join(dst, "shared.txt"), "v2 from target", time.Now())
+	os.Remove(filepath.Join(dst, "doomed.txt"))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(src, "shared.txt")); got != "v2 from target" {
+		t.Errorf("source shared.txt = %q, want the target edit", got)
+	}
+	if _, err := os.Stat(filepath.Join(src, "doomed.txt")); !os.IsNotExist(err) {
+		t.Errorf("doomed.txt should have been deleted from source")
+	}
+
+	// Nothing left to do
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 0 || stats.FilesDeleted != 0 {
+		t.Errorf("third run copied %d and deleted %d, want 0/0", stats.FilesCopied, stats.FilesDeleted)
+	}
+}
+
+func TestFileSync_BidirectionalConflicts(t *testing.T) {
+	newerTarget := func(t *testing.T) (src, dst string) {
+		tmp := t.TempDir()
+		src = filepath.Join(tmp, "src")
+		dst = filepath.Join(tmp, "dst")
+		base := time.Now().Add(-time.Hour)
+		writeTestFile(t, filepath.Join(src, "doc.txt"), "base", base)
+
+		// Establish the baseline, then change both sides
+		if err := NewFileSync(src, dst, false, WithBidirectional(true)).SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, filepath.Join(src, "doc.txt"), "source edit", base.Add(time.Minute))
+		writeTestFile(t, filepath.Join(dst, "doc.txt"), "target edit", base.Add(2*time.Minute))
+		return src, dst
+	}
+
+	t.Run("no resolver skips", func(t *testing.T) {
+		src, dst := newerTarget(t)
+		fs := NewFileSync(src, dst, false, WithBidirectional(true))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fs.Stats().Conflicts; len(got) != 1 || got[0] != "doc.txt" {
+			t.Errorf("Conflicts = %v, want [doc.txt]", got)
+		}
+		if readTestFile(t, filepath.Join(src, "doc.txt")) != "source edit" || readTestFile(t, filepath.Join(dst, "doc.txt")) != "target edit" {
+			t.Error("skipped conflict must leave both sides untouched")
+		}
+	})
+
+	t.Run("newest wins", func(t *testing.T) {
+		src, dst := newerTarget(t)
+		var seen Conflict
+		fs := NewFileSync(src, dst, false, WithBidirectional(true), WithConflictResolver(func(c Conflict) Resolution {
+			seen = c
+			return NewestWins(c)
+		}))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if seen.Path != "doc.txt" || seen.SourceSize != int64(len("source edit")) || seen.TargetSize != int64(len("target edit")) {
+			t.Errorf("resolver got %+v", seen)
+		}
+		if got := readTestFile(t, filepath.Join(src, "doc.txt")); got != "target edit" {
+			t.Errorf("source doc.txt = %q, want the newer target edit", got)
+		}
+	})
+
+	t.Run("keep both", func(t *testing.T) {
+		src, dst := newerTarget(t)
+		fs := NewFileSync(src, dst, false, WithBidirectional(true), WithConflictResolver(func(Conflict) Resolution {
+			return KeepBoth
+		}))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		for _, root := range []string{src, dst} {
+			if got := readTestFile(t, filepath.Join(root, "doc.txt")); got != "source edit" {
+				t.Errorf("%s doc.txt = %q, want source edit", root, got)
+			}
+			if got := readTestFile(t, filepath.Join(root, "doc.conflict.txt")); got != "target edit" {
+				t.Errorf("%s doc.conflict.txt = %q, want target edit", root, got)
+			}
+		}
+	})
+
+	t.Run("identical edits within clock skew", func(t *testing.T) {
+		src, dst := newerTarget(t)
+		base := time.Now().Add(-time.Hour)
+		writeTestFile(t, filepath.Join(src, "doc.txt"), "same edit", base.Add(time.Minute))
+		writeTestFile(t, filepath.Join(dst, "doc.txt"), "same edit", base.Add(2*time.Minute))
+		fs := NewFileSync(src, dst, false, WithBidirectional(true), WithClockSkew(5*time.Minute))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if stats := fs.Stats(); len(stats.Conflicts) != 0 || stats.FilesCopied != 0 {
+			t.Errorf("Conflicts = %v, copied %d; want none", stats.Conflicts, stats.FilesCopied)
+		}
+	})
+}
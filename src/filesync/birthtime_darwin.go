@@ -0,0 +1,30 @@
+//go:build darwin
+
+package filesync
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyBirthTime gives dst the creation time of the source file info
+// describes, with setattrlist. Filesystems that keep no creation time
+// are skipped silently.
+func copyBirthTime(info os.FileInfo, dst string) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	ts := unix.Timespec{Sec: st.Birthtimespec.Sec, Nsec: st.Birthtimespec.Nsec}
+	attrs := unix.Attrlist{Bitmapcount: unix.ATTR_BIT_MAP_COUNT, Commonattr: unix.ATTR_CMN_CRTIME}
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts))
+	err := unix.Setattrlist(dst, &attrs, buf, unix.FSOPT_NOFOLLOW)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EINVAL) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileSync_PreserveBirthTime(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", modified)
+
+	// Backdate the source's creation time, then sync it
+	info, err := os.Stat(filepath.Join(src, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	st := *info.Sys().(*syscall.Stat_t)
+	st.Birthtimespec = syscall.NsecToTimespec(created.UnixNano())
+	if err := copyBirthTime(statInfo{info, &st}, filepath.Join(src, "a.txt")); err != nil {
+		t.Skipf("cannot set creation times: %v", err)
+	}
+
+	fs := NewFileSync(src, dst, false, WithPreserveBirthTime(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(filepath.Join(dst, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	birth := info.Sys().(*syscall.Stat_t).Birthtimespec
+	if got := time.Unix(birth.Unix()); !got.Equal(created) {
+		t.Errorf("target created %v, want %v", got, created)
+	}
+	if !info.ModTime().Equal(modified) {
+		t.Errorf("target modified %v, want %v", info.ModTime(), modified)
+	}
+}
+
+// statInfo is a FileInfo with other system data.
+type statInfo struct {
+	os.FileInfo
+	sys *syscall.Stat_t
+}
+
+func (i statInfo) Sys() any { return i.sys }
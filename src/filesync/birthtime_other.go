@@ -0,0 +1,11 @@
+//go:build !darwin && !windows
+
+package filesync
+
+import "os"
+
+// copyBirthTime is a no-op where creation times cannot be set; Linux
+// reports them through statx but offers no way to change them.
+func copyBirthTime(info os.FileInfo, dst string) error {
+	return nil
+}
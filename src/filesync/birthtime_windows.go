@@ -0,0 +1,31 @@
+//go:build windows
+
+package filesync
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// copyBirthTime gives dst the creation time of the source file info
+// describes, with SetFileTime.
+func copyBirthTime(info os.FileInfo, dst string) error {
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return nil
+	}
+	name, err := windows.UTF16PtrFromString(longPath(dst))
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateFile(name, windows.FILE_WRITE_ATTRIBUTES, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	created := windows.Filetime{LowDateTime: attrs.CreationTime.LowDateTime, HighDateTime: attrs.CreationTime.HighDateTime}
+	return windows.SetFileTime(h, &created, nil, nil)
+}
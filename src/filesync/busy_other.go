@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package filesync
+
+// fileLocked cannot tell without a locking API, so files are always
+// copied and a lock shows up as a copy error.
+func fileLocked(path string) bool {
+	return false
+}
+
+// isLockError never recognizes lock failures without a locking API.
+func isLockError(err error) bool {
+	return false
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package filesync
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileLocked reports whether another process holds a lock on the
+// local file at path that keeps it from being read consistently: a
+// POSIX write lock (as SQLite takes) or an exclusive flock.
+func fileLocked(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	lk := unix.Flock_t{Type: unix.F_RDLCK, Whence: io.SeekStart}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_GETLK, &lk); err == nil && lk.Type != unix.F_UNLCK {
+		return true
+	}
+	fd := int(f.Fd())
+	if err := unix.Flock(fd, unix.LOCK_SH|unix.LOCK_NB); err != nil {
+		return errors.Is(err, unix.EWOULDBLOCK)
+	}
+	_ = unix.Flock(fd, unix.LOCK_UN)
+	return false
+}
+
+// isLockError reports whether err is a failure caused by another
+// process's lock. Unix locks are advisory and never fail a read.
+func isLockError(err error) bool {
+	return false
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileSync_SkipLocked(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "db.sqlite"), "busy", time.Now())
+	writeTestFile(t, filepath.Join(src, "notes.txt"), "free", time.Now())
+
+	// Another open file description holds an exclusive flock
+	held, err := os.Open(filepath.Join(src, "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+	if err := syscall.Flock(int(held.Fd()), syscall.LOCK_EX); err != nil {
+		t.Skipf("flock unavailable: %v", err)
+	}
+
+	// A dry run plans without the locked file, as the real run skips it
+	dry := NewFileSync(src, dst, false, WithSkipLocked(true), WithDryRun(true))
+	if err := dry.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if added, _ := ByteImpact(dry.PlannedActions()); added != int64(len("free")) || len(dry.Stats().Locked) != 1 {
+		t.Errorf("dry run: ByteImpact added %d bytes, Locked = %v; want %d and the locked file", added, dry.Stats().Locked, len("free"))
+	}
+
+	fs := NewFileSync(src, dst, false, WithSkipLocked(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if want := []string{"db.sqlite"}; !reflect.DeepEqual(stats.Locked, want) {
+		t.Errorf("Locked = %v, want %v", stats.Locked, want)
+	}
+	if len(stats.Errors) > 0 {
+		t.Errorf("locked files must not be errors: %v", stats.Errors)
+	}
+	if stats.FilesCopied != 1 {
+		t.Errorf("FilesCopied = %d, want 1", stats.FilesCopied)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "db.sqlite")); !os.IsNotExist(err) {
+		t.Errorf("locked file was copied, stat err = %v", err)
+	}
+
+	// Once released, the next run picks it up
+	if err := syscall.Flock(int(held.Fd()), syscall.LOCK_UN); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats(); got.FilesCopied != 1 || len(got.Locked) != 0 {
+		t.Errorf("after unlocking: copied %d, locked %v; want 1 copied and none locked", got.FilesCopied, got.Locked)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package filesync
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileLocked reports whether another process has the local file at
+// path open for writing, or not shared at all: a trial open that
+// denies other writers then fails with a sharing violation.
+func fileLocked(path string) bool {
+	name, err := windows.UTF16PtrFromString(longPath(path))
+	if err != nil {
+		return false
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ, windows.FILE_SHARE_READ, nil,
+		windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return isLockError(err)
+	}
+	windows.CloseHandle(h)
+	return false
+}
+
+// isLockError reports whether err is a failure caused by another
+// process's lock: a sharing violation when opening the file, or a
+// locked byte range when reading it.
+func isLockError(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
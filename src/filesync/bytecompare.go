@@ -0,0 +1,69 @@
+package filesync
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// mmapMaxSize is the largest file WithMmapCompare maps into memory;
+// bigger ones are read in chunks so the address space is not strained.
+const mmapMaxSize = 1 << 30
+
+// compareChunk is the buffer size of the streaming comparison.
+const compareChunk = 256 << 10
+
+// sameBytes reports whether a source file and its target copy hold
+// the same bytes, stopping at the first difference. Local files up to
+// mmapMaxSize are compared memory-mapped where the platform allows,
+// anything else is streamed from the two filesystems.
+func (fs *FileSync) sameBytes(srcPath string, src os.FileInfo, tgtPath string, tgt os.FileInfo) (bool, error) {
+	if src.Size() != tgt.Size() {
+		return false, nil
+	}
+	_, localSrc := fs.srcFS.(osFS)
+	_, localTgt := fs.tgtFS.(osFS)
+	if localSrc && localTgt && src.Size() > 0 && src.Size() <= mmapMaxSize {
+		if equal, ok, err := mmapEqual(longPath(srcPath), longPath(tgtPath), src.Size()); ok {
+			fs.contentRead.Add(2 * src.Size())
+			return equal, err
+		}
+	}
+	return streamEqual(fs.srcFS, srcPath, fs.tgtFS, tgtPath, fs.contentRead)
+}
+
+// streamEqual compares two files chunk by chunk, adding the bytes it
+// reads to read.
+func streamEqual(fsysA FS, pathA string, fsysB FS, pathB string, read *atomic.Int64) (bool, error) {
+	a, err := fsysA.Open(pathA)
+	if err != nil {
+		return false, err
+	}
+	defer a.Close()
+	b, err := fsysB.Open(pathB)
+	if err != nil {
+		return false, err
+	}
+	defer b.Close()
+
+	bufA, bufB := make([]byte, compareChunk), make([]byte, compareChunk)
+	for {
+		n, errA := io.ReadFull(a, bufA)
+		m, errB := io.ReadFull(b, bufB)
+		read.Add(int64(n + m))
+		if !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		switch {
+		case errA != nil && !endA:
+			return false, errA
+		case errB != nil && !endB:
+			return false, errB
+		case endA || endB:
+			return endA == endB, nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package filesync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_MmapCompare(t *testing.T) {
+	big := bytes.Repeat([]byte("x"), 3*compareChunk+17)
+	lateEdit := bytes.Clone(big)
+	lateEdit[len(lateEdit)-1] = 'y'
+	earlyEdit := bytes.Clone(big)
+	earlyEdit[0] = 'y'
+	files := map[string][2][]byte{
+		"same.bin":  {big, big},
+		"late.bin":  {big, lateEdit},
+		"early.bin": {big, earlyEdit},
+		"empty.bin": {nil, nil},
+		"short.txt": {[]byte("new!"), []byte("old!")},
+	}
+	changed := map[string]bool{"late.bin": true, "early.bin": true, "short.txt": true}
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	check := func(t *testing.T, fs *FileSync, read func(name string) []byte) {
+		t.Helper()
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fs.Stats().FilesCopied; got != len(changed) {
+			t.Errorf("FilesCopied = %d, want %d", got, len(changed))
+		}
+		for name, data := range files {
+			if got := read(name); !bytes.Equal(got, data[0]) {
+				t.Errorf("%s was not synced", name)
+			}
+		}
+	}
+
+	t.Run("local", func(t *testing.T) {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		for name, data := range files {
+			writeTestFile(t, filepath.Join(src, name), string(data[0]), mtime)
+			writeTestFile(t, filepath.Join(dst, name), string(data[1]), mtime)
+		}
+		fs := NewFileSync(src, dst, false, WithChecksum(true), WithMmapCompare(true))
+		check(t, fs, func(name string) []byte {
+			data, err := os.ReadFile(filepath.Join(dst, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		})
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		mem := NewMemFS()
+		for name, data := range files {
+			if err := mem.WriteFile("/src/"+name, data[0], mtime); err != nil {
+				t.Fatal(err)
+			}
+			if err := mem.WriteFile("/dst/"+name, data[1], mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem),
+			WithChecksum(true), WithMmapCompare(true))
+		check(t, fs, func(name string) []byte {
+			data, err := mem.ReadFile("/dst/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		})
+	})
+}
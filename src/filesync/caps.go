@@ -0,0 +1,11 @@
+package filesync
+
+// copyCaps gives the local target file dst the Linux file capabilities
+// of src with WithFileCaps. Setting them needs CAP_SETFCAP; without it,
+// they are handled as unsupported by metaUnsupported.
+func (fs *FileSync) copyCaps(src, dst string) error {
+	if !fs.fileCaps || fs.metaDenied(metaCaps) {
+		return nil
+	}
+	return fs.metaUnsupported(metaCaps, copyFileCaps(src, dst))
+}
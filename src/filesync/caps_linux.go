@@ -0,0 +1,29 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// capsXattr holds the file capabilities of an executable on Linux.
+const capsXattr = "security.capability"
+
+// copyFileCaps gives dst the file capabilities of src, if it has any.
+// The kernel drops them whenever a file is written to or changes
+// owner, so this must come after both. Errors for filesystems without
+// capabilities or a lack of CAP_SETFCAP wrap errors.ErrUnsupported.
+func copyFileCaps(src, dst string) error {
+	value, err := getXattr(src, capsXattr)
+	if errors.Is(err, unix.ENODATA) || err == nil && len(value) == 0 {
+		return nil
+	}
+	if err == nil {
+		err = unix.Setxattr(dst, capsXattr, value, 0)
+	}
+	if err != nil && (xattrUnsupported(err) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES)) {
+		return fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package filesync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFileSync_FileCaps(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "server"), "binary", time.Now())
+
+	// Revision 2, effective, permitting cap_net_bind_service (bit 10)
+	var caps bytes.Buffer
+	binary.Write(&caps, binary.LittleEndian, []uint32{0x02000001, 1 << 10, 0, 0, 0})
+	if err := unix.Setxattr(filepath.Join(src, "server"), capsXattr, caps.Bytes(), 0); err != nil {
+		t.Skipf("cannot set file capabilities here: %v", err)
+	}
+
+	for _, content := range []string{"binary", "binary v2"} {
+		writeTestFile(t, filepath.Join(src, "server"), content, time.Now().Add(time.Duration(len(content))*time.Second))
+		if err := unix.Setxattr(filepath.Join(src, "server"), capsXattr, caps.Bytes(), 0); err != nil {
+			t.Fatal(err)
+		}
+		fs := NewFileSync(src, dst, false, WithFileCaps(true))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Stats().Err(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := getXattr(filepath.Join(dst, "server"), capsXattr)
+		if err != nil {
+			t.Fatalf("%q: %v", content, err)
+		}
+		if !bytes.Equal(got, caps.Bytes()) {
+			t.Errorf("%q: capabilities = %x, want %x", content, got, caps.Bytes())
+		}
+	}
+}
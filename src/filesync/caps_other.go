@@ -0,0 +1,8 @@
+//go:build !linux
+
+package filesync
+
+// copyFileCaps is a no-op where files carry no capabilities.
+func copyFileCaps(src, dst string) error {
+	return nil
+}
@@ -0,0 +1,281 @@
+package filesync
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// casObjectsDir and casIndexName are where WithCAS keeps the objects
+// and the index, relative to the target root.
+const (
+	casObjectsDir = "objects"
+	casIndexName  = "index.json"
+)
+
+// casIndexVersion is the format version written to indexes.
+const casIndexVersion = 1
+
+// casIndex is the name to hash index written by WithCAS, keyed by
+// slash-separated paths relative to the source root.
+type casIndex struct {
+	Version   int                 `json:"version"`
+	Algorithm string              `json:"algorithm"`
+	Files     map[string]casEntry `json:"files"`
+}
+
+// casEntry is a source file as the index records it. The size and mod
+// time let a later run reuse the digest of a file that has not changed.
+type casEntry struct {
+	Digest  string    `json:"digest"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// loadCASIndex reads the index at path on fsys. A missing index is
+// empty.
+func loadCASIndex(fsys FS, path string) (*casIndex, error) {
+	index := &casIndex{}
+	data, err := readFile(fsys, path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, index); err != nil {
+			return nil, err
+		}
+	}
+	if index.Files == nil {
+		index.Files = map[string]casEntry{}
+	}
+	return index, nil
+}
+
+// save atomically replaces the index at path on fsys.
+func (index *casIndex) save(fsys FS, path string) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := writeFile(fsys, tmp, append(data, '\n')); err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, path)
+}
+
+// objectPath returns where the object with the given hex digest is
+// stored.
+func (fs *FileSync) objectPath(digest string) string {
+	return filepath.Join(fs.target, casObjectsDir, digest)
+}
+
+// syncCAS syncs tree into the content-addressable store of WithCAS:
+// each file's contents are stored once, as an object named by its
+// digest, and the index maps every path to its digest. A file that
+// cannot be read keeps its previous index entry, and unreferenced
+// objects are only pruned by a run without errors.
+func (fs *FileSync) syncCAS(tree sourceTree) error {
+	errorsBefore := len(fs.stats.Errors)
+	files, err := fs.listFiles(fs.srcFS, tree.root, tree)
+	if err != nil {
+		return err
+	}
+	indexPath := filepath.Join(fs.target, casIndexName)
+	prev, err := loadCASIndex(fs.tgtFS, indexPath)
+	if err != nil {
+		return fmt.Errorf("content store index: %w", err)
+	}
+	// Digests by another algorithm cannot be reused
+	if prev.Algorithm != fs.hashAlgorithm() {
+		prev.Files = map[string]casEntry{}
+	}
+
+	index := &casIndex{Version: casIndexVersion, Algorithm: fs.hashAlgorithm(), Files: map[string]casEntry{}}
+	stored := map[string]bool{}
+	paths := make([]string, 0, len(files))
+	for relPath := range files {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+	for _, relPath := range paths {
+		if err := fs.interrupted(); err != nil {
+			return err
+		}
+		info, key := files[relPath], filepath.ToSlash(relPath)
+		srcPath := filepath.Join(tree.root, relPath)
+		old, known := prev.Files[key]
+		digest, err := fs.storeObject(srcPath, info, old, stored)
+		if err != nil {
+			log.Printf("❌ Error storing %q: %v", srcPath, err)
+			fs.recordError(&CopyError{Src: srcPath, Dst: filepath.Join(fs.target, casObjectsDir), Err: err})
+			// Keep the previous version, so its object is not pruned
+			if known {
+				index.Files[key] = old
+			}
+			if isSourceError(err, srcPath) {
+				if err := fs.accessError(srcPath, err); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		index.Files[key] = casEntry{Digest: digest, Size: info.Size(), ModTime: info.ModTime()}
+		switch {
+		case !known:
+			fs.recordAction(ActionAdd, relPath, false, "")
+		case old.Digest != digest:
+			fs.recordAction(ActionModify, relPath, false, ReasonContent)
+		}
+	}
+	failed := len(fs.stats.Errors) > errorsBefore
+	for key, old := range prev.Files {
+		if _, ok := index.Files[key]; ok {
+			continue
+		}
+		if _, listed := files[filepath.FromSlash(key)]; failed && !listed {
+			// Not listed, but only gone if the source says so
+			if _, err := fs.srcFS.Lstat(filepath.Join(tree.root, filepath.FromSlash(key))); !os.IsNotExist(err) {
+				index.Files[key] = old
+				continue
+			}
+		}
+		fs.recordAction(ActionDelete, filepath.FromSlash(key), false, "")
+	}
+
+	if !fs.dryRun {
+		if err := index.save(fs.tgtFS, indexPath); err != nil {
+			return fmt.Errorf("content store index: %w", err)
+		}
+	}
+	if fs.deleteMissing {
+		if failed {
+			log.Printf("⚠️ Errors during the run, unreferenced objects not pruned from %q", filepath.Join(fs.target, casObjectsDir))
+			return nil
+		}
+		return fs.pruneObjects(index)
+	}
+	return nil
+}
+
+// storeObject makes sure the object holding the contents of the source
+// file at srcPath exists, and returns its digest. The digest recorded
+// in old is reused while the file's size and mod time are unchanged,
+// unless WithChecksum asks for every file to be hashed. Digests in
+// stored are objects already dealt with during this run.
+func (fs *FileSync) storeObject(srcPath string, info os.FileInfo, old casEntry, stored map[string]bool) (string, error) {
+	digest := old.Digest
+	if fs.checksum || digest == "" || old.Size != info.Size() || !old.ModTime.Equal(info.ModTime()) {
+		sum, err := fs.fileChecksum(fs.srcFS, srcPath)
+		if err != nil {
+			return "", err
+		}
+		digest = hex.EncodeToString(sum)
+	}
+	objPath := fs.objectPath(digest)
+	if !stored[digest] {
+		if _, err := fs.tgtFS.Lstat(objPath); err == nil {
+			stored[digest] = true
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	if stored[digest] {
+		fs.stats.FilesSkipped++
+		return digest, nil
+	}
+
+	if fs.dryRun {
+		log.Printf("🔎 Would store object %s: %q", digest, srcPath)
+	} else {
+		if err := fs.writeObject(srcPath, objPath, digest); err != nil {
+			return "", err
+		}
+		log.Printf("📦 Stored object %s: %q", digest, srcPath)
+	}
+	stored[digest] = true
+	fs.stats.FilesCopied++
+	fs.stats.BytesCopied += info.Size()
+	return digest, nil
+}
+
+// writeObject copies the source file at srcPath to objPath through a
+// temporary file, hashing it on the way: if the contents no longer
+// match digest, the source changed since it was hashed and
+// ErrChangedDuringCopy is returned rather than storing an object under
+// the wrong name.
+func (fs *FileSync) writeObject(srcPath, objPath, digest string) error {
+	in, err := fs.srcFS.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := fs.tgtFS.MkdirAll(filepath.Dir(objPath), 0755); err != nil {
+		return err
+	}
+	tmp := objPath + ".tmp"
+	out, err := fs.tgtFS.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	h := fs.newHash()
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != digest {
+		err = ErrChangedDuringCopy
+	}
+	if err != nil {
+		fs.tgtFS.Remove(tmp)
+		return err
+	}
+	return fs.tgtFS.Rename(tmp, objPath)
+}
+
+// pruneObjects removes the objects, and leftover temporary files, that
+// no path in index refers to any more.
+func (fs *FileSync) pruneObjects(index *casIndex) error {
+	dir := filepath.Join(fs.target, casObjectsDir)
+	entries, err := fs.tgtFS.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	referenced := map[string]bool{}
+	for _, entry := range index.Files {
+		referenced[entry.Digest] = true
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || referenced[name] {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if fs.dryRun {
+			log.Printf("🔎 Would remove unreferenced object: %q", path)
+			fs.stats.FilesDeleted++
+			continue
+		}
+		if err := fs.tgtFS.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("❌ Failed to remove %q: %v", path, err)
+			fs.recordError(&DeleteError{Path: path, Err: err})
+			continue
+		}
+		log.Printf("🗑️ Removed unreferenced object: %q", path)
+		fs.stats.FilesDeleted++
+	}
+	return nil
+}
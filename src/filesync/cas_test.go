@@ -0,0 +1,113 @@
+package filesync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileSync_CAS(t *testing.T) {
+	now := time.Now()
+	mem := NewMemFS()
+	mem.WriteFile("/src/a.txt", []byte("shared"), now)
+	mem.WriteFile("/src/sub/b.txt", []byte("shared"), now)
+	mem.WriteFile("/src/c.txt", []byte("own"), now)
+	digest := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithCAS(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs() = %v", err)
+	}
+	if got := fs.Stats().FilesCopied; got != 2 {
+		t.Errorf("FilesCopied = %d, want 2 objects for 3 files", got)
+	}
+	for _, content := range []string{"shared", "own"} {
+		data, err := mem.ReadFile("/dst/objects/" + digest(content))
+		if err != nil || string(data) != content {
+			t.Errorf("object for %q = %q, %v", content, data, err)
+		}
+	}
+	if _, err := mem.Stat("/dst/a.txt"); err == nil {
+		t.Error("file mirrored as a tree in CAS mode")
+	}
+	index, err := loadCASIndex(mem, "/dst/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Files) != 3 || index.Files["sub/b.txt"].Digest != digest("shared") {
+		t.Errorf("index = %+v", index.Files)
+	}
+
+	// A rerun stores nothing; a removed file's object is pruned
+	mem.Remove("/src/c.txt")
+	fs = NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithCAS(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("second SyncDirs() = %v", err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 0 || stats.FilesDeleted != 1 {
+		t.Errorf("second run copied %d, deleted %d; want 0 and 1", stats.FilesCopied, stats.FilesDeleted)
+	}
+	if _, err := mem.Stat("/dst/objects/" + digest("own")); err == nil {
+		t.Error("unreferenced object not pruned")
+	}
+	if index, _ := loadCASIndex(mem, "/dst/index.json"); len(index.Files) != 2 {
+		t.Errorf("index after removal = %+v", index.Files)
+	}
+}
+
+// unreadableFS fails to stat the files with the base name of
+// flakyStatFS, with either Stat or Lstat.
+type unreadableFS struct{ flakyStatFS }
+
+func (u *unreadableFS) Stat(name string) (os.FileInfo, error) {
+	if filepath.Base(name) == u.name {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: syscall.EIO}
+	}
+	return u.FS.Stat(name)
+}
+
+func TestFileSync_CASKeepsUnreadable(t *testing.T) {
+	now := time.Now()
+	mem := NewMemFS()
+	mem.WriteFile("/src/a.txt", []byte("shared"), now)
+	mem.WriteFile("/src/c.txt", []byte("own"), now)
+	if err := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithCAS(true)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := loadCASIndex(mem, "/dst/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	own := index.Files["c.txt"]
+
+	// A file that cannot be stat'ed keeps its entry and its object
+	mem.WriteFile("/src/extra.txt", []byte("extra"), now)
+	mem.WriteFile("/dst/objects/stale", []byte("stale"), now)
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(&unreadableFS{flakyStatFS{FS: mem, name: "c.txt"}}), WithTargetFS(mem), WithCAS(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if errs := fs.Stats().Errors; len(errs) != 1 || !errors.Is(errs[0], syscall.EIO) {
+		t.Errorf("Errors = %v, want one EIO", errs)
+	}
+	index, err = loadCASIndex(mem, "/dst/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Files) != 3 || index.Files["c.txt"] != own {
+		t.Errorf("index = %+v, want c.txt kept as %+v", index.Files, own)
+	}
+	for _, name := range []string{own.Digest, "stale"} {
+		if _, err := mem.Stat("/dst/objects/" + name); err != nil {
+			t.Errorf("object %s pruned by a run with errors: %v", name, err)
+		}
+	}
+}
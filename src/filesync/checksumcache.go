@@ -0,0 +1,136 @@
+package filesync
+
+import (
+	"cmp"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// checksumCacheName is the default checksum cache file, in the target.
+const checksumCacheName = ".filesync-checksums.json"
+
+// checksumEntry is a cached digest, valid while the file keeps the
+// size and mod time it had when it was hashed.
+type checksumEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Sum     []byte    `json:"sum"`
+}
+
+// checksumCache maps file paths, as FileSync passes them to its
+// filesystems, to their last known digest. Comparisons run on several
+// workers at once, so access is guarded by mu.
+type checksumCache struct {
+	mu        sync.Mutex
+	Algorithm string                   `json:"algorithm,omitempty"` // sha256 when empty
+	Entries   map[string]checksumEntry `json:"entries"`
+
+	used  map[string]bool // entries looked up or added during this run
+	dirty bool
+}
+
+// checksumCacheFile returns the path of the checksum cache.
+func (fs *FileSync) checksumCacheFile() string {
+	if fs.checksumCachePath != "" {
+		return fs.checksumCachePath
+	}
+	return filepath.Join(fs.target, checksumCacheName)
+}
+
+// loadChecksumCache reads the checksum cache when it is enabled in
+// checksum mode, except for the full checks of WithPeriodicVerify. A
+// missing file yields an empty cache.
+func (fs *FileSync) loadChecksumCache() error {
+	if !fs.checksumCache || !fs.byContent() || fs.fullCheck {
+		return nil
+	}
+	cache := &checksumCache{}
+	data, err := readFile(fs.stateFS(fs.checksumCachePath), fs.checksumCacheFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, cache); err != nil {
+			return err
+		}
+	}
+	// Digests by another algorithm are of no use
+	if algo := cmp.Or(cache.Algorithm, defaultHashAlgorithm); algo != fs.hashAlgorithm() && len(cache.Entries) > 0 {
+		cache.Entries = nil
+		cache.dirty = true
+	}
+	if cache.Entries == nil {
+		cache.Entries = map[string]checksumEntry{}
+	}
+	cache.Algorithm = fs.hashAlgorithm()
+	cache.used = map[string]bool{}
+	fs.checksums = cache
+	return nil
+}
+
+// saveChecksumCache atomically writes the cache back if it changed.
+// After a run over the whole tree, entries that were not needed are
+// dropped, so deleted files do not accumulate.
+func (fs *FileSync) saveChecksumCache(wholeTree bool) error {
+	cache := fs.checksums
+	if cache == nil || fs.dryRun {
+		return nil
+	}
+	if wholeTree {
+		for path := range cache.Entries {
+			if !cache.used[path] {
+				delete(cache.Entries, path)
+				cache.dirty = true
+			}
+		}
+	}
+	if !cache.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	path, fsys := fs.checksumCacheFile(), fs.stateFS(fs.checksumCachePath)
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := writeFile(fsys, tmp, data); err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, path)
+}
+
+// checksumOf returns the digest of path on fsys, whose current state
+// is info. With the cache enabled an entry whose size and mod time
+// still match is reused instead of reading the file; stale entries
+// are replaced.
+func (fs *FileSync) checksumOf(fsys FS, path string, info os.FileInfo) ([]byte, error) {
+	cache := fs.checksums
+	if cache == nil {
+		return fs.fileChecksum(fsys, path)
+	}
+
+	cache.mu.Lock()
+	entry, ok := cache.Entries[path]
+	cache.used[path] = true
+	cache.mu.Unlock()
+	if ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		return entry.Sum, nil
+	}
+
+	sum, err := fs.fileChecksum(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	cache.mu.Lock()
+	cache.Entries[path] = checksumEntry{Size: info.Size(), ModTime: info.ModTime(), Sum: sum}
+	cache.dirty = true
+	cache.mu.Unlock()
+	return sum, nil
+}
@@ -0,0 +1,69 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// remoteFS stands in for a remote target: it records every file opened
+// through it.
+type remoteFS struct {
+	FS
+	mu     sync.Mutex
+	opened []string
+}
+
+func (f *remoteFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f.mu.Lock()
+	f.opened = append(f.opened, name)
+	f.mu.Unlock()
+	return f.FS.OpenFile(name, flag, perm)
+}
+
+func (f *remoteFS) Open(name string) (File, error) {
+	f.mu.Lock()
+	f.opened = append(f.opened, name)
+	f.mu.Unlock()
+	return f.FS.Open(name)
+}
+
+// openedIn returns the files opened through f in dir.
+func (f *remoteFS) openedIn(dir string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, name := range f.opened {
+		if filepath.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestFileSync_ChecksumCacheFileStaysLocal(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	state := filepath.Join(tmp, "state")
+	cache := filepath.Join(state, "checksums.json")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", time.Now())
+
+	// The second run hashes both sides and saves the cache
+	target := &remoteFS{FS: LocalFS()}
+	fs := NewFileSync(src, dst, false, WithTargetFS(target),
+		WithChecksum(true), WithChecksumCache(true), WithChecksumCacheFile(cache))
+	for range 2 {
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(cache); err != nil {
+		t.Errorf("checksum cache not written locally: %v", err)
+	}
+	if opened := target.openedIn(state); len(opened) > 0 {
+		t.Errorf("opened through the target's filesystem: %v", opened)
+	}
+}
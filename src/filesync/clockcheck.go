@@ -0,0 +1,38 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrClockSkew reports a target whose clock is further off this
+// host's than WithClockCheck allows, with failing enabled.
+var ErrClockSkew = errors.New("clock skew between this host and the target exceeds the threshold")
+
+// checkClock reports skew, how far the mod time the target's host gave
+// the probe (see probeTarget) is off this host's clock, or err if it
+// could not be measured, for WithClockCheck. The skew is logged and
+// kept in Stats.ClockSkew; past the threshold it is a warning, or
+// ErrClockSkew when failing.
+func (fs *FileSync) checkClock(skew time.Duration, err error) error {
+	if err != nil {
+		log.Printf("⚠️ Could not measure the target's clock: %v", err)
+		return nil
+	}
+	fs.stats.ClockSkew = skew
+	if skew.Abs() <= fs.clockCheck {
+		log.Printf("🕰️ Target clock skew: %s", skew)
+		return nil
+	}
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	if fs.clockCheckFail {
+		return fmt.Errorf("target clock is %s %s this host's: %w", skew.Abs(), direction, ErrClockSkew)
+	}
+	log.Printf("⚠️ Target clock is %s %s this host's, more than %s: mod-time comparisons may recopy files or miss updates (see WithClockSkew)", skew.Abs(), direction, fs.clockCheck)
+	return nil
+}
@@ -0,0 +1,62 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// skewedFS is a target whose host clock runs skew ahead of ours.
+type skewedFS struct {
+	FS
+	skew time.Duration
+}
+
+func (s skewedFS) Stat(name string) (os.FileInfo, error) {
+	info, err := s.FS.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return skewedInfo{info, s.skew}, nil
+}
+
+// skewedInfo is a file info whose mod time is skew ahead.
+type skewedInfo struct {
+	os.FileInfo
+	skew time.Duration
+}
+
+func (i skewedInfo) ModTime() time.Time {
+	return i.FileInfo.ModTime().Add(i.skew)
+}
+
+func TestFileSync_ClockCheck(t *testing.T) {
+	mem := NewMemFS()
+	mem.WriteFile("/src/a.txt", []byte("a"), time.Now())
+
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithClockCheck(time.Minute, true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if skew := fs.Stats().ClockSkew; skew != 0 {
+		t.Errorf("ClockSkew = %s for the same clock, want 0", skew)
+	}
+	if _, err := mem.Stat("/dst/" + probeName); err == nil {
+		t.Error("expected the probe file to be removed")
+	}
+
+	target := skewedFS{FS: mem, skew: 10 * time.Minute}
+	fs = NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(target), WithClockCheck(time.Minute, false))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("warning only: %v", err)
+	}
+	if skew := fs.Stats().ClockSkew; skew < 9*time.Minute || skew > 10*time.Minute {
+		t.Errorf("ClockSkew = %s, want about 10m", skew)
+	}
+
+	fs = NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(target), WithClockCheck(time.Minute, true))
+	if err := fs.SyncDirs(); !errors.Is(err, ErrClockSkew) {
+		t.Errorf("SyncDirs() = %v, want ErrClockSkew", err)
+	}
+}
@@ -0,0 +1,220 @@
+package filesync
+
+import (
+	"bytes"
+	"os"
+	"time"
+)
+
+// DiffReason explains why a file is considered different
+// between source and target.
+type DiffReason string
+
+const (
+	// ReasonSize means the file sizes differ.
+	ReasonSize DiffReason = "size"
+	// ReasonTime means the modification times differ.
+	ReasonTime DiffReason = "time"
+	// ReasonContent means the checksums differ (checksum mode only).
+	ReasonContent DiffReason = "content"
+	// ReasonType means one side is a file and the other a directory.
+	ReasonType DiffReason = "type"
+	// ReasonStreams means the alternate data streams or resource forks
+	// differ (WithAltStreams only).
+	ReasonStreams DiffReason = "streams"
+	// ReasonMode means the permission bits differ (Diff with
+	// WithDiffModes only).
+	ReasonMode DiffReason = "mode"
+	// ReasonFlags means the immutable or append-only flags differ
+	// (WithFileFlags only).
+	ReasonFlags DiffReason = "flags"
+	// ReasonACL means the POSIX access ACLs differ (WithACLs only).
+	ReasonACL DiffReason = "acl"
+)
+
+// Comparison selects what the comparator looks at to decide whether a
+// target file is up to date; see WithComparison. The zero value is the
+// default of comparing size and mod time. The fields compose:
+//
+//   - IgnoreModTime alone compares sizes only. It is the cheapest
+//     choice, but misses edits that keep the size.
+//   - Content with IgnoreModTime compares equal-sized files by checksum
+//     and never looks at mod times, like WithChecksum: every file on
+//     both sides is read unless the checksum cache vouches for it.
+//   - Content alone is a fallback: files whose size and mod time match
+//     are up to date without being read, and only those whose mod
+//     time differs are hashed, so a touched but unchanged file is not
+//     copied. Only the differing files are read, but they are read on
+//     every run while their times stay apart.
+//   - IgnoreSize also skips the size check, for stores that report
+//     sizes unreliably. With Content the checksums still catch a
+//     difference; without it, and with IgnoreModTime, only missing
+//     files are copied.
+type Comparison struct {
+	IgnoreSize    bool
+	IgnoreModTime bool
+	Content       bool
+}
+
+// comparison returns the comparison in effect, with checksum and
+// content-only mode meaning content with mod times ignored.
+func (fs *FileSync) comparison() Comparison {
+	c := fs.compare
+	if fs.checksum || fs.contentOnly {
+		c.Content, c.IgnoreModTime = true, true
+	}
+	return c
+}
+
+// compareFiles applies the configured comparator to a source file and
+// its target counterpart. It returns an empty reason when they are
+// considered identical.
+//
+// Sizes are compared first since that is free, then mod times, and
+// then, when the comparison asks for content, the checksums (see
+// Comparison for how the checks combine). Mod times that differ by no
+// more than the WithClockSkew allowance are not trusted either way,
+// and the checksums decide. With WithQuickHash, quick hashes decide
+// instead of mod times, unless full checksums are compared anyway.
+// Files with a registered transform are compared against their
+// transform record instead, and with WithFingerprintCmd, files are
+// compared by fingerprint first. With WithAltStreams, local files
+// whose data matches are compared by their streams last, with
+// WithFileFlags by their flags, and with WithACLs by their ACLs.
+func (fs *FileSync) compareFiles(srcPath, tgtPath string, src, tgt os.FileInfo) (DiffReason, error) {
+	reason, err := fs.compareData(srcPath, tgtPath, src, tgt)
+	if reason != "" || err != nil || !fs.localCopy(fs.tgtFS) {
+		return reason, err
+	}
+	if fs.altStreams {
+		same, err := fs.sameAltStreams(srcPath, tgtPath)
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			return ReasonStreams, nil
+		}
+	}
+	if fs.fileFlags && !fs.metaDenied(metaFlags) {
+		same, err := sameFileFlags(srcPath, tgtPath)
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			return ReasonFlags, nil
+		}
+	}
+	if fs.acls && !fs.metaDenied(metaACLs) {
+		same, err := samePosixACL(srcPath, tgtPath)
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			return ReasonACL, nil
+		}
+	}
+	return "", nil
+}
+
+// compareData compares the main data of a source file and its target
+// counterpart for compareFiles.
+func (fs *FileSync) compareData(srcPath, tgtPath string, src, tgt os.FileInfo) (DiffReason, error) {
+	if fs.transformFor(srcPath) != nil {
+		return fs.compareTransformed(srcPath, tgtPath, src, tgt)
+	}
+	if fs.fingerprintCmd != "" {
+		if reason, ok := fs.compareFingerprints(srcPath, tgtPath, src, tgt); ok {
+			return reason, nil
+		}
+	}
+	c := fs.comparison()
+	if !c.IgnoreSize && src.Size() != tgt.Size() {
+		return ReasonSize, nil
+	}
+	if _, ok := tgt.(manifestInfo); fs.quickHash > 0 && !c.Content && !ok {
+		return fs.compareQuickHash(srcPath, tgtPath, src, tgt)
+	}
+	timeDiffers := !c.IgnoreModTime && !sameModTime(src.ModTime(), tgt.ModTime(), fs.timeTolerance)
+	switch {
+	case !c.Content && timeDiffers && !fs.withinClockSkew(src.ModTime(), tgt.ModTime()):
+		return ReasonTime, nil
+	case !c.Content && !timeDiffers:
+		return "", nil
+	case !c.IgnoreModTime && !timeDiffers:
+		// Matching metadata needs no content fallback
+		return "", nil
+	}
+	same, err := fs.sameContent(srcPath, src, tgtPath, tgt)
+	if err != nil {
+		return "", err
+	}
+	if !same {
+		return ReasonContent, nil
+	}
+	return "", nil
+}
+
+// byContent reports whether files are compared by their checksums, in
+// checksum or content-only mode or with Comparison.Content.
+func (fs *FileSync) byContent() bool {
+	return fs.comparison().Content
+}
+
+// timestampUnits are the granularities target filesystems commonly
+// store mod times at, finest first.
+var timestampUnits = []time.Duration{time.Microsecond, time.Millisecond, time.Second}
+
+// withinClockSkew reports whether two mod times are close enough
+// that clock skew between hosts may explain the difference.
+func (fs *FileSync) withinClockSkew(a, b time.Time) bool {
+	delta := a.Sub(b)
+	if delta < 0 {
+		delta = -delta
+	}
+	return fs.clockSkew > 0 && delta <= fs.clockSkew
+}
+
+// sameModTime reports whether a source and target mod time match.
+//
+// Besides the explicit tolerance, a target time that is exactly the
+// source time truncated to a coarser unit (µs, ms or s) also counts as
+// equal: that is what Chtimes leaves behind on filesystems with lower
+// timestamp precision than the source, and treating it as a change
+// would recopy the file on every run.
+func sameModTime(src, tgt time.Time, tolerance time.Duration) bool {
+	delta := src.Sub(tgt)
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta <= tolerance {
+		return true
+	}
+	for _, unit := range timestampUnits {
+		if tgt.Equal(tgt.Truncate(unit)) && tgt.Equal(src.Truncate(unit)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameContent reports whether a source file and its target
+// counterpart have identical digests, or with WithMmapCompare
+// identical bytes. A target described by the manifest (see
+// WithManifestCompare) is compared by its recorded digest.
+func (fs *FileSync) sameContent(srcPath string, src os.FileInfo, tgtPath string, tgt os.FileInfo) (bool, error) {
+	if m, ok := tgt.(manifestInfo); ok {
+		return fs.sameAsManifest(srcPath, src, m)
+	}
+	if fs.mmapCompare {
+		return fs.sameBytes(srcPath, src, tgtPath, tgt)
+	}
+	sumA, err := fs.checksumOf(fs.srcFS, srcPath, src)
+	if err != nil {
+		return false, err
+	}
+	sumB, err := fs.checksumOf(fs.tgtFS, tgtPath, tgt)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(sumA, sumB), nil
+}
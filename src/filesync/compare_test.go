@@ -0,0 +1,451 @@
+package filesync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFileSync_TimeTolerance(t *testing.T) {
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		offset    time.Duration
+		tolerance time.Duration
+		wantCopy  bool
+	}{
+		{"exact match by default", 0, 0, false},
+		{"offset without tolerance", time.Second, 0, true},
+		{"offset within tolerance", time.Second, 2 * time.Second, false},
+		{"negative offset within tolerance", -2 * time.Second, 2 * time.Second, false},
+		{"offset beyond tolerance", 3 * time.Second, 2 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+
+			// same size, different content: only copied if times differ
+			writeTestFile(t, filepath.Join(src, "a.txt"), "new", base)
+			writeTestFile(t, filepath.Join(dst, "a.txt"), "old", base.Add(tt.offset))
+
+			fs := NewFileSync(src, dst, false, WithTimeTolerance(tt.tolerance))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ := os.ReadFile(filepath.Join(dst, "a.txt"))
+			if copied := string(data) == "new"; copied != tt.wantCopy {
+				t.Errorf("copied = %v, want %v", copied, tt.wantCopy)
+			}
+		})
+	}
+}
+
+func TestFileSync_ClockSkew(t *testing.T) {
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		srcContent string
+		offset     time.Duration
+		updateOnly bool
+		wantCopy   bool
+	}{
+		{"identical content within skew", "same", time.Minute, false, false},
+		{"identical content, target newer", "same", -time.Minute, true, false},
+		{"changed content within skew", "diff", time.Minute, false, true},
+		{"changed content, target newer within skew", "diff", -time.Minute, false, true},
+		{"identical content beyond skew", "same", time.Hour, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			writeTestFile(t, filepath.Join(src, "a.txt"), tt.srcContent, base.Add(tt.offset))
+			writeTestFile(t, filepath.Join(dst, "a.txt"), "same", base)
+
+			fs := NewFileSync(src, dst, false, WithClockSkew(5*time.Minute), WithUpdateOnly(tt.updateOnly))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if copied := fs.Stats().FilesCopied == 1; copied != tt.wantCopy {
+				t.Errorf("copied = %v, want %v", copied, tt.wantCopy)
+			}
+		})
+	}
+}
+
+func TestFileSync_ParallelChecksum(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	// every third file differs in content only
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("f%02d.txt", i)
+		writeTestFile(t, filepath.Join(src, name), "aaaa", now)
+		content := "aaaa"
+		if i%3 == 0 {
+			content = "bbbb"
+		}
+		writeTestFile(t, filepath.Join(dst, name), content, now)
+	}
+
+	fs := NewFileSync(src, dst, false, WithChecksum(true), WithWorkers(4))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := fs.Stats()
+	if stats.FilesCopied != 10 || stats.FilesSkipped != 20 {
+		t.Errorf("expected 10 copied / 20 skipped, got %d / %d", stats.FilesCopied, stats.FilesSkipped)
+	}
+	for i := 0; i < 30; i += 3 {
+		data, _ := os.ReadFile(filepath.Join(dst, fmt.Sprintf("f%02d.txt", i)))
+		if string(data) != "aaaa" {
+			t.Errorf("expected f%02d.txt to be updated, got %s", i, data)
+		}
+	}
+}
+
+func TestFileSync_ChecksumErrorsAggregated(t *testing.T) {
+	tmp := t.TempDir()
+	tgt := filepath.Join(tmp, "tgt.txt")
+	writeTestFile(t, tgt, "data", time.Now())
+	info, err := os.Stat(tgt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the source vanished after scanning, so hashing it fails
+	jobs := []*fileJob{{
+		srcPath:    filepath.Join(tmp, "gone.txt"),
+		targetPath: tgt,
+		srcInfo:    info,
+		tgtInfo:    info,
+	}}
+
+	fs := NewFileSync(tmp, tmp, false, WithChecksum(true), WithWorkers(2))
+	fs.compareJobs(jobs)
+	if err := fs.copyJobs(jobs); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Stats().Err() == nil {
+		t.Error("expected hash error in aggregate error")
+	}
+}
+
+func TestFileSync_UpdateOnly(t *testing.T) {
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		srcTime  time.Time
+		tgtTime  time.Time
+		wantCopy bool
+	}{
+		{"source newer", base.Add(time.Hour), base, true},
+		{"target newer", base, base.Add(time.Hour), false},
+		{"same time, different size", base, base, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+
+			writeTestFile(t, filepath.Join(src, "a.txt"), "source", tt.srcTime)
+			writeTestFile(t, filepath.Join(dst, "a.txt"), "target!", tt.tgtTime)
+			writeTestFile(t, filepath.Join(src, "new.txt"), "new", base)
+
+			fs := NewFileSync(src, dst, false, WithUpdateOnly(true))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ := os.ReadFile(filepath.Join(dst, "a.txt"))
+			if copied := string(data) == "source"; copied != tt.wantCopy {
+				t.Errorf("copied = %v, want %v", copied, tt.wantCopy)
+			}
+			if _, err := os.Stat(filepath.Join(dst, "new.txt")); err != nil {
+				t.Error("expected missing file to be copied in update-only mode")
+			}
+		})
+	}
+}
+
+func TestFileSync_ExistingOnly(t *testing.T) {
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeTestFile(t, filepath.Join(src, "a.txt"), "updated", base.Add(time.Hour))
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "old", base)
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "updated", base.Add(time.Hour))
+	writeTestFile(t, filepath.Join(dst, "sub", "b.txt"), "old", base)
+	writeTestFile(t, filepath.Join(src, "sub", "new.txt"), "new", base)
+	writeTestFile(t, filepath.Join(src, "newdir", "c.txt"), "new", base)
+	// Delete-missing has no effect in this mode
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", base)
+
+	fs := NewFileSync(src, dst, true, WithExistingOnly(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"a.txt", "sub/b.txt"} {
+		if got := readTestFile(t, filepath.Join(dst, p)); got != "updated" {
+			t.Errorf("%s = %q, want it updated", p, got)
+		}
+	}
+	for _, p := range []string{"sub/new.txt", "newdir"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be created", p)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "orphan.txt")); err != nil {
+		t.Error("expected the orphan to be kept")
+	}
+	if stats := fs.Stats(); stats.FilesNotInTarget != 1 || stats.FilesCopied != 2 {
+		t.Errorf("FilesNotInTarget = %d, FilesCopied = %d; want 1, 2", stats.FilesNotInTarget, stats.FilesCopied)
+	}
+}
+
+func TestFileSync_ExistingOnlyRejectsTwoWay(t *testing.T) {
+	for name, opt := range map[string]Option{"two-way sync": WithBidirectional(true), "snapshots": WithSnapshot(true), "swaps": WithSwap(true)} {
+		src, dst := t.TempDir(), t.TempDir()
+		writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+		writeTestFile(t, filepath.Join(dst, "a.txt"), "old", time.Now())
+		fs := NewFileSync(src, dst, false, WithExistingOnly(true), opt)
+		if err := fs.SyncDirs(); err == nil {
+			t.Errorf("expected an error combining existing-only mode with %s", name)
+		}
+		// Nothing was built to replace the target with
+		if _, err := os.Stat(filepath.Join(dst, "a.txt")); err != nil {
+			t.Errorf("%s: target emptied: %v", name, err)
+		}
+	}
+}
+
+func TestFileSync_NoDowngrade(t *testing.T) {
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		srcData  string
+		srcTime  time.Time
+		tgtTime  time.Time
+		checksum bool
+		wantCopy bool
+	}{
+		{"source newer", "source", base.Add(time.Hour), base, false, true},
+		{"target newer", "source", base, base.Add(time.Hour), false, false},
+		{"target newer, different size", "longer source", base, base.Add(time.Hour), false, true},
+		{"target newer, different content", "source", base, base.Add(time.Hour), true, false},
+		{"same time, different content", "source", base, base, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+
+			writeTestFile(t, filepath.Join(src, "a.txt"), tt.srcData, tt.srcTime)
+			writeTestFile(t, filepath.Join(dst, "a.txt"), "target", tt.tgtTime)
+			writeTestFile(t, filepath.Join(src, "new.txt"), "new", base)
+
+			fs := NewFileSync(src, dst, false, WithNoDowngrade(true), WithChecksum(tt.checksum))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ := os.ReadFile(filepath.Join(dst, "a.txt"))
+			if copied := string(data) == tt.srcData; copied != tt.wantCopy {
+				t.Errorf("copied = %v, want %v", copied, tt.wantCopy)
+			}
+			if _, err := os.Stat(filepath.Join(dst, "new.txt")); err != nil {
+				t.Error("expected missing file to be copied in no-downgrade mode")
+			}
+		})
+	}
+}
+
+func TestSameModTime(t *testing.T) {
+	src := time.Date(2024, 6, 1, 12, 0, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		name string
+		tgt  time.Time
+		want bool
+	}{
+		{"exact", src, true},
+		{"truncated to microseconds", src.Truncate(time.Microsecond), true},
+		{"truncated to milliseconds", src.Truncate(time.Millisecond), true},
+		{"truncated to seconds", src.Truncate(time.Second), true},
+		{"a second earlier", src.Truncate(time.Second).Add(-time.Second), false},
+		{"slightly later", src.Add(time.Nanosecond), false},
+	}
+
+	for _, tt := range tests {
+		if got := sameModTime(src, tt.tgt, 0); got != tt.want {
+			t.Errorf("%s: sameModTime = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileSync_ChecksumCache(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modtime := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", modtime)
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "hello", modtime)
+
+	newSync := func() *FileSync {
+		return NewFileSync(src, dst, true, WithChecksum(true), WithChecksumCache(true))
+	}
+	if err := newSync().SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, checksumCacheName)); err != nil {
+		t.Fatalf("cache file not written: %v", err)
+	}
+
+	// Same size and mod time: the cached digest is trusted, so this
+	// (deliberately sneaky) edit goes unnoticed and nothing is deleted
+	writeTestFile(t, filepath.Join(src, "a.txt"), "HELLO", modtime)
+	fs := newSync()
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 0 || stats.FilesDeleted != 0 {
+		t.Fatalf("copied %d and deleted %d files, want 0/0 with a valid cache", stats.FilesCopied, stats.FilesDeleted)
+	}
+
+	// A new mod time invalidates the entry and the file is hashed again
+	writeTestFile(t, filepath.Join(src, "a.txt"), "HELLO", modtime.Add(time.Minute))
+	fs = newSync()
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 1 {
+		t.Fatalf("copied %d files, want 1 after invalidation", got)
+	}
+	data, _ := os.ReadFile(filepath.Join(dst, "a.txt"))
+	if string(data) != "HELLO" {
+		t.Errorf("target = %q, want HELLO", data)
+	}
+}
+
+func TestFileSync_ContentOnly(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep mod times %v", keep), func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			srcTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			// Same content, different times: a checkout, not a change
+			writeTestFile(t, filepath.Join(src, "same.txt"), "same", srcTime)
+			writeTestFile(t, filepath.Join(dst, "same.txt"), "same", srcTime.Add(time.Hour))
+			// Same size and time, different content: a change
+			writeTestFile(t, filepath.Join(src, "edited.txt"), "new!", srcTime)
+			writeTestFile(t, filepath.Join(dst, "edited.txt"), "old!", srcTime)
+
+			fs := NewFileSync(src, dst, false, WithContentOnly(true), WithKeepModTimes(keep))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if got := fs.Stats().FilesCopied; got != 1 {
+				t.Errorf("FilesCopied = %d, want 1", got)
+			}
+			data, err := os.ReadFile(filepath.Join(dst, "edited.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "new!" {
+				t.Errorf("edited.txt = %q, want %q", data, "new!")
+			}
+			info, err := os.Stat(filepath.Join(dst, "edited.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.ModTime().Equal(srcTime); got != keep {
+				t.Errorf("copy has the source mod time: %v, want %v", got, keep)
+			}
+
+			// The written copy's own mod time does not trigger a recopy
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if got := fs.Stats().FilesCopied; got != 0 {
+				t.Errorf("second run FilesCopied = %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestFileSync_ContentOnlyRejectsUpdateOnly(t *testing.T) {
+	fs := NewFileSync(t.TempDir(), t.TempDir(), false, WithContentOnly(true), WithUpdateOnly(true))
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("expected an error combining content-only and update-only mode")
+	}
+}
+
+func TestFileSync_Comparison(t *testing.T) {
+	srcTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	type pair struct{ src, dst string }
+	files := map[string]pair{
+		"touched.txt": {"same", "same"}, // newer target time, same content
+		"edited.txt":  {"new!", "old!"}, // newer target time, same size
+		"grown.txt":   {"longer", "short"},
+	}
+	for _, tc := range []struct {
+		name   string
+		cmp    Comparison
+		copied []string
+	}{
+		{"default", Comparison{}, []string{"edited.txt", "grown.txt", "touched.txt"}},
+		{"ignore mod time", Comparison{IgnoreModTime: true}, []string{"grown.txt"}},
+		{"content fallback", Comparison{Content: true}, []string{"edited.txt", "grown.txt"}},
+		{"content ignoring time", Comparison{Content: true, IgnoreModTime: true}, []string{"edited.txt", "grown.txt"}},
+		{"ignore size and time", Comparison{IgnoreSize: true, IgnoreModTime: true}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			for name, p := range files {
+				writeTestFile(t, filepath.Join(src, name), p.src, srcTime)
+				writeTestFile(t, filepath.Join(dst, name), p.dst, srcTime.Add(time.Hour))
+			}
+
+			fs := NewFileSync(src, dst, false, WithComparison(tc.cmp))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			var copied []string
+			for _, a := range fs.PlannedActions() {
+				copied = append(copied, a.Path)
+			}
+			sort.Strings(copied)
+			if !reflect.DeepEqual(copied, tc.copied) {
+				t.Errorf("copied %v, want %v", copied, tc.copied)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package filesync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the config file the command line tool reads from
+// the current directory when no --config is given.
+const ConfigFileName = ".filesync.yaml"
+
+// Config describes a sync job, usually loaded from a YAML file with
+// LoadConfig so repeatable jobs can be kept under version control.
+// Keys are named like the command line flags; zero values keep the
+// defaults. Paths are used as written, so relative ones are relative
+// to the working directory.
+type Config struct {
+	Sources       []string `yaml:"sources"`
+	Target        string   `yaml:"target"`
+	AlsoTo        []string `yaml:"also-to"` // further targets, see AddTarget
+	DeleteMissing bool     `yaml:"delete-missing"`
+	Protect       []string `yaml:"protect"` // target-side patterns kept by delete-missing
+
+	Exclude       []string `yaml:"exclude"` // .syncignore-style patterns
+	Include       []string `yaml:"include"` // patterns re-included after exclude
+	Extensions    []string `yaml:"ext"`
+	ContentTypes  []string `yaml:"content-type"`
+	ContentMatch  string   `yaml:"content-match"` // regular expression
+	MatchBytes    int      `yaml:"content-match-bytes"`
+	Shard         string   `yaml:"shard"`         // index/total, e.g. "0/4"
+	ExcludeOwner  []int    `yaml:"exclude-owner"` // uids
+	ExcludeGroup  []int    `yaml:"exclude-group"` // gids
+	StripPrefix   string   `yaml:"strip-prefix"`
+	RequirePrefix bool     `yaml:"require-prefix"`
+
+	Checksum       bool          `yaml:"checksum"`
+	ContentOnly    bool          `yaml:"content-only"`
+	IgnoreTimes    bool          `yaml:"ignore-times"`
+	IgnoreSize     bool          `yaml:"ignore-size"`
+	CompareContent bool          `yaml:"compare-content"`
+	MmapCompare    bool          `yaml:"mmap-compare"`
+	QuickHash      int           `yaml:"quick-hash"` // KiB
+	HashAlgorithm  string        `yaml:"hash-algorithm"`
+	FullCheckEvery int           `yaml:"full-check-every"`
+	Heartbeat      int           `yaml:"heartbeat"`
+	TimeTolerance  time.Duration `yaml:"time-tolerance"`
+	ClockSkew      time.Duration `yaml:"clock-skew"`
+	ClockCheck     time.Duration `yaml:"clock-check"`
+	ClockCheckFail bool          `yaml:"clock-check-fail"`
+	WriteCheck     bool          `yaml:"write-check"`
+	FingerprintCmd string        `yaml:"fingerprint-cmd"`
+	UpdateOnly     bool          `yaml:"update-only"`
+	ExistingOnly   bool          `yaml:"existing-only"`
+	NoDowngrade    bool          `yaml:"no-downgrade"`
+
+	Manifest        string `yaml:"manifest"`
+	ManifestCompare bool   `yaml:"manifest-compare"`
+
+	Workers           int           `yaml:"workers"`
+	WalkWorkers       int           `yaml:"walk-workers"`
+	PlanWorkers       int           `yaml:"plan-workers"`
+	AutoWorkers       bool          `yaml:"auto-workers"`
+	MaxOpenFiles      int           `yaml:"max-open-files"`
+	MaxPerDir         int           `yaml:"max-per-dir"`
+	DryRun            bool          `yaml:"dry-run"`
+	Atomic            bool          `yaml:"atomic"`
+	Resume            bool          `yaml:"resume"`
+	Journal           bool          `yaml:"journal"`
+	Lock              bool          `yaml:"lock"`
+	Trash             bool          `yaml:"trash"`
+	DeleteRetention   time.Duration `yaml:"delete-retention"`
+	RetentionRuns     int           `yaml:"delete-retention-runs"`
+	RetentionState    string        `yaml:"retention-state"`
+	DeleteOlderThan   time.Duration `yaml:"delete-older-than"`
+	AccessedWithin    time.Duration `yaml:"accessed-within"`
+	AtimeFallback     bool          `yaml:"atime-fallback"`
+	SourceDropGuard   float64       `yaml:"source-drop-guard"`
+	SizeCap           int64         `yaml:"size-cap"` // bytes
+	Evict             bool          `yaml:"evict"`
+	DeletePreexisting bool          `yaml:"delete-preexisting-only"`
+	DeleteFirst       bool          `yaml:"delete-first"`
+	DeleteFirstPerDir bool          `yaml:"delete-first-per-dir"`
+	DetectRenames     bool          `yaml:"detect-renames"`
+	Streaming         bool          `yaml:"streaming"`
+	FirstSourceWins   bool          `yaml:"first-source-wins"`
+	PreserveSymlinks  bool          `yaml:"preserve-symlinks"`
+	FollowSymlinks    bool          `yaml:"follow-symlinks"`
+	FollowTargetLinks bool          `yaml:"follow-target-symlinks"`
+	PreservePerms     bool          `yaml:"preserve-perms"`
+	PreserveOwner     bool          `yaml:"preserve-owner"`
+	ACLs              bool          `yaml:"acls"`
+	FileCaps          bool          `yaml:"file-caps"`
+	AltStreams        bool          `yaml:"alt-streams"`
+	FileFlags         bool          `yaml:"file-flags"`
+	MaxLoad           float64       `yaml:"max-load"`
+	PreserveBirthTime bool          `yaml:"preserve-birth-time"`
+	Dedup             bool          `yaml:"dedup"`
+	ReportFile        string        `yaml:"report-file"`
+	Trace             string        `yaml:"trace"`
+	PruneEmptyDirs    bool          `yaml:"prune-empty-dirs"`
+	NoEmptyDirs       bool          `yaml:"no-empty-dirs"`
+	EmptyPlaceholders bool          `yaml:"empty-placeholders"`
+	OneFileSystem     bool          `yaml:"one-file-system"`
+	FailOnAccessError bool          `yaml:"fail-on-access-error"`
+	MaxFiles          int           `yaml:"max-files"`
+	MaxErrors         int           `yaml:"max-errors"`
+	CopyOrder         string        `yaml:"copy-order"` // natural, smallest, largest or newest
+	Bidirectional     bool          `yaml:"bidirectional"`
+	CAS               bool          `yaml:"cas"`
+
+	FileMode string `yaml:"file-mode"` // octal, e.g. "0664"
+	DirMode  string `yaml:"dir-mode"`
+}
+
+// LoadConfig reads a YAML config file. Unknown keys, values of the
+// wrong type and invalid modes are reported with the file name (and
+// line, where the YAML decoder knows it). An empty file is an empty
+// config.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the values that YAML decoding cannot.
+func (c *Config) Validate() error {
+	if _, err := parseConfigMode("file-mode", c.FileMode); err != nil {
+		return err
+	}
+	if _, err := parseConfigMode("dir-mode", c.DirMode); err != nil {
+		return err
+	}
+	if c.Workers < 0 || c.MaxFiles < 0 {
+		return errors.New("workers and max-files cannot be negative")
+	}
+	if _, err := ParseCopyOrder(c.CopyOrder); err != nil {
+		return fmt.Errorf("copy-order: %w", err)
+	}
+	if _, err := regexp.Compile(c.ContentMatch); err != nil {
+		return fmt.Errorf("content-match: %w", err)
+	}
+	if _, _, err := ParseShard(c.Shard); err != nil {
+		return fmt.Errorf("shard: %w", err)
+	}
+	return nil
+}
+
+// Options returns the options the config sets, for NewFileSync.
+func (c *Config) Options() ([]Option, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	fileMode, _ := parseConfigMode("file-mode", c.FileMode)
+	dirMode, _ := parseConfigMode("dir-mode", c.DirMode)
+	copyOrder, _ := ParseCopyOrder(c.CopyOrder)
+	shardIndex, shardCount, _ := ParseShard(c.Shard)
+	opts := []Option{
+		WithExcludes(c.Exclude...),
+		WithIncludes(c.Include...),
+		WithExtensions(c.Extensions...),
+		WithShard(shardIndex, shardCount),
+		WithContentTypes(c.ContentTypes...),
+		WithExcludeOwner(c.ExcludeOwner...),
+		WithExcludeGroup(c.ExcludeGroup...),
+		WithStripPrefix(c.StripPrefix),
+		WithRequirePrefix(c.RequirePrefix),
+		WithChecksum(c.Checksum),
+		WithContentOnly(c.ContentOnly),
+		WithMmapCompare(c.MmapCompare),
+		WithQuickHash(c.QuickHash),
+		WithHashAlgorithm(c.HashAlgorithm),
+		WithPeriodicVerify(c.FullCheckEvery),
+		WithHeartbeat(c.Heartbeat),
+		WithManifest(c.Manifest),
+		WithManifestCompare(c.ManifestCompare),
+		WithTimeTolerance(c.TimeTolerance),
+		WithClockSkew(c.ClockSkew),
+		WithClockCheck(c.ClockCheck, c.ClockCheckFail),
+		WithWriteCheck(c.WriteCheck),
+		WithFingerprintCmd(c.FingerprintCmd),
+		WithUpdateOnly(c.UpdateOnly),
+		WithExistingOnly(c.ExistingOnly),
+		WithNoDowngrade(c.NoDowngrade),
+		WithWorkers(c.Workers),
+		WithParallelWalk(c.WalkWorkers),
+		WithParallelPlan(c.PlanWorkers),
+		WithAutoWorkers(c.AutoWorkers),
+		WithMaxOpenFiles(c.MaxOpenFiles),
+		WithMaxPerDirectory(c.MaxPerDir),
+		WithDryRun(c.DryRun),
+		WithAtomicCopy(c.Atomic),
+		WithJournal(c.Journal),
+		WithLock(c.Lock),
+		WithTrash(c.Trash),
+		WithDeleteRetention(c.DeleteRetention),
+		WithDeleteRetentionRuns(c.RetentionRuns),
+		WithRetentionStateFile(c.RetentionState),
+		WithDeleteOlderThan(c.DeleteOlderThan),
+		WithAccessedSince(c.AccessedWithin),
+		WithAccessTimeFallback(c.AtimeFallback),
+		WithSourceDropGuard(c.SourceDropGuard),
+		WithTargetSizeCap(c.SizeCap),
+		WithEviction(c.Evict),
+		WithDeletePreexistingOnly(c.DeletePreexisting),
+		WithDeleteFirst(c.DeleteFirst),
+		WithDeleteFirstPerDir(c.DeleteFirstPerDir),
+		WithDetectRenames(c.DetectRenames),
+		WithStreaming(c.Streaming),
+		WithFirstSourceWins(c.FirstSourceWins),
+		WithPreserveSymlinks(c.PreserveSymlinks),
+		WithPreserveBirthTime(c.PreserveBirthTime),
+		WithFollowSymlinks(c.FollowSymlinks),
+		WithFollowTargetSymlinks(c.FollowTargetLinks),
+		WithPreservePerms(c.PreservePerms),
+		WithPreserveOwner(c.PreserveOwner),
+		WithACLs(c.ACLs),
+		WithFileCaps(c.FileCaps),
+		WithAltStreams(c.AltStreams),
+		WithFileFlags(c.FileFlags),
+		WithLoadThrottle(c.MaxLoad),
+		WithDedup(c.Dedup),
+		WithReportFile(c.ReportFile),
+		WithTrace(c.Trace),
+		WithPruneEmptyDirs(c.PruneEmptyDirs),
+		WithNoEmptyDirs(c.NoEmptyDirs),
+		WithEmptyPlaceholders(c.EmptyPlaceholders),
+		WithOneFileSystem(c.OneFileSystem),
+		WithFailOnAccessError(c.FailOnAccessError),
+		WithMaxFilesPerRun(c.MaxFiles),
+		WithMaxErrors(c.MaxErrors),
+		WithCopyOrder(copyOrder),
+		WithBidirectional(c.Bidirectional),
+		WithCAS(c.CAS),
+		WithFileMode(fileMode),
+		WithDirMode(dirMode),
+	}
+	if c.ContentMatch != "" {
+		re, err := regexp.Compile(c.ContentMatch)
+		if err != nil {
+			return nil, fmt.Errorf("content-match: %w", err)
+		}
+		opts = append(opts, WithContentMatch(re, c.MatchBytes))
+	}
+	if c.IgnoreTimes || c.IgnoreSize || c.CompareContent {
+		opts = append(opts, WithComparison(Comparison{IgnoreModTime: c.IgnoreTimes, IgnoreSize: c.IgnoreSize, Content: c.CompareContent}))
+	}
+	// Resume implies atomic copies, so only apply it when requested
+	if c.Resume {
+		opts = append(opts, WithResume(true))
+	}
+	return opts, nil
+}
+
+// NewFileSyncFromConfig creates a FileSync for the job c describes.
+// The opts are applied after the config's own, so they override it.
+func NewFileSyncFromConfig(c *Config, opts ...Option) (*FileSync, error) {
+	if len(c.Sources) == 0 || c.Target == "" {
+		return nil, errors.New("config needs at least one source and a target")
+	}
+	cfgOpts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	fs := NewFileSync(c.Sources[0], c.Target, c.DeleteMissing, append(cfgOpts, opts...)...)
+	for _, source := range c.Sources[1:] {
+		fs.AddSource(source)
+	}
+	for _, pattern := range c.Protect {
+		fs.AddProtect(pattern)
+	}
+	for _, target := range c.AlsoTo {
+		fs.AddTarget(target)
+	}
+	return fs, nil
+}
+
+// parseConfigMode parses an octal permission string; empty is zero.
+func parseConfigMode(key, value string) (os.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+	bits, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || bits > 0o7777 {
+		return 0, fmt.Errorf("%s: invalid octal mode %q", key, value)
+	}
+	return os.FileMode(bits), nil
+}
@@ -0,0 +1,79 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep", now)
+	writeTestFile(t, filepath.Join(src, "scratch.tmp"), "tmp", now)
+	writeTestFile(t, filepath.Join(src, "build", "out.bin"), "bin", now)
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", now)
+
+	path := filepath.Join(tmp, ConfigFileName)
+	writeTestFile(t, path, `sources: [`+src+`]
+target: `+dst+`
+delete-missing: true
+exclude:
+  - "*.tmp"
+  - build/
+workers: 2
+time-tolerance: 2s
+file-mode: 0640
+`, now)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workers != 2 || cfg.TimeTolerance != 2*time.Second || cfg.FileMode != "0640" {
+		t.Errorf("decoded %+v", cfg)
+	}
+	fs, err := NewFileSyncFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dst, "keep.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("keep.txt mode %o, want 0640", info.Mode().Perm())
+	}
+	for _, p := range []string{"scratch.tmp", "build", "orphan.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be absent from target", p)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{"unknown key", "target: /tmp\nworkerz: 4\n", "workerz"},
+		{"wrong type", "workers: many\n", "line 1"},
+		{"bad mode", "file-mode: 0999\n", "file-mode"},
+		{"bad duration", "clock-skew: soon\n", "line 1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ConfigFileName)
+			writeTestFile(t, path, tc.content, time.Now())
+			_, err := LoadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), path) {
+				t.Errorf("LoadConfig() error = %v, want one naming %q and the file", err, tc.want)
+			}
+		})
+	}
+}
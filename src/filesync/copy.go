@@ -0,0 +1,515 @@
+package filesync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// partialSuffix marks in-progress atomic copies in the target.
+const partialSuffix = ".filesync-partial"
+
+// defaultSmallFileSize is the size below which files are copied whole
+// rather than streamed, unless WithSmallFileThreshold says otherwise.
+const defaultSmallFileSize = 64 << 10
+
+// ErrChangedDuringCopy reports a source file that was modified while
+// it was being copied, so the copy may mix old and new contents.
+var ErrChangedDuringCopy = errors.New("source changed during copy")
+
+// partialPath returns the temporary path used while copying into dst.
+// It lives in the same directory so the final rename stays atomic.
+func partialPath(dst string) string {
+	return filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+partialSuffix)
+}
+
+// isPartialName reports whether name is an in-progress copy.
+func isPartialName(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, partialSuffix)
+}
+
+// copyFile copies src → dst, creating parent directories if needed.
+// The modification time of the source file is preserved on the target.
+// With atomic copies enabled the data is written to a partial file
+// that is renamed over dst only after the copy succeeded (see
+// stagingFile and publish).
+func (fs *FileSync) copyFile(src, dst string) (err error) {
+	fs.forgetFingerprint(dst)
+
+	// Ensure parent directory exists
+	if err := fs.makeDir(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	// An immutable or append-only dst can be neither written over nor
+	// renamed over until its flags are lifted, and gets them back if
+	// the copy fails
+	restoreFlags, err := fs.clearFileFlags(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			restoreFlags()
+		}
+	}()
+
+	// Open source file
+	in, err := fs.openSource(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Stat before copying: the target is stamped with the mod time the
+	// data was read at, so a source modified mid-copy differs next run
+	srcInfo, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	transform := fs.transformFor(src)
+
+	writeFS, writePath := fs.tgtFS, dst
+	if fs.atomicCopy {
+		writeFS, writePath = fs.stagingFile(dst)
+	} else if err := fs.unlinkTargetSymlink(dst); err != nil {
+		return err
+	} else if err := fs.breakHardLink(dst); err != nil {
+		return err
+	}
+	if fs.tempDir != "" {
+		if err := os.MkdirAll(longPath(fs.tempDir), 0755); err != nil {
+			return err
+		}
+	}
+
+	// Share the source's blocks if the filesystem can, else copy the data
+	var offset, read int64
+	var record transformRecord
+	if fs.reflink && transform == nil && fs.tryReflink(in, writeFS, writePath) {
+		read = srcInfo.Size()
+		if fs.progress != nil {
+			fs.progress.add(read)
+		}
+	} else if offset, read, record, err = fs.streamCopy(in, srcInfo, writeFS, writePath, transform); err != nil {
+		return err
+	}
+
+	// A source written to while it was read yields a torn copy.
+	// Leave it unstamped so the next run sees a difference, and
+	// never move a torn partial file into place.
+	if err := fs.checkUnchanged(src, srcInfo, offset+read); err != nil {
+		if fs.atomicCopy {
+			_ = writeFS.Remove(writePath)
+		}
+		return err
+	}
+
+	// Apply an explicit or preserved file mode, bypassing the umask,
+	// and owner
+	if mode := fs.copyMode(dst, srcInfo); mode != 0 {
+		if err := writeFS.Chmod(writePath, mode); err != nil {
+			return err
+		}
+	}
+	fs.applyOwner(writeFS, writePath)
+	fs.copyOwner(writeFS, writePath, srcInfo)
+
+	// Carry over extended attributes (SELinux labels, Finder tags)
+	// for local copies; they survive the final rename
+	if fs.xattrs && fs.localCopy(writeFS) {
+		if err := copyXattrs(src, writePath); err != nil {
+			return err
+		}
+	}
+	// ACLs after the mode, which would otherwise reset their mask
+	if fs.localCopy(writeFS) {
+		if err := fs.copyACL(src, writePath, false); err != nil {
+			return err
+		}
+		if err := fs.copyAltStreams(src, writePath); err != nil {
+			return err
+		}
+		// Capabilities last, as writing or chowning the file drops them
+		if err := fs.copyCaps(src, writePath); err != nil {
+			return err
+		}
+	}
+
+	// Preserve modification time from source. A failure here would
+	// make the next run see a different mod time and recopy forever,
+	// so it is reported rather than ignored.
+	if fs.preserveModTime() {
+		if err := fs.stampModTime(writeFS, writePath, srcInfo); err != nil {
+			return err
+		}
+	}
+	// Creation time last: on macOS, setting a mod time older than the
+	// creation time moves the creation time back with it
+	if fs.preserveBirthTime && fs.localCopy(writeFS) {
+		if err := copyBirthTime(srcInfo, writePath); err != nil {
+			return err
+		}
+	}
+
+	if fs.atomicCopy {
+		if err := fs.publish(writePath, dst, srcInfo); err != nil {
+			return err
+		}
+	}
+	// File flags after everything else, as immutable blocks all of it
+	if fs.localCopy(fs.tgtFS) {
+		if err := fs.copyFileFlags(src, dst); err != nil {
+			return err
+		}
+	}
+	if transform != nil {
+		fs.recordTransform(dst, record)
+	}
+	return nil
+}
+
+// streamCopy writes the contents of in to writePath on writeFS,
+// resuming or preallocating it as configured, and returns the offset
+// it resumed at, the number of source bytes read after that and, for
+// transformed files, the transform record.
+func (fs *FileSync) streamCopy(in File, srcInfo os.FileInfo, writeFS FS, writePath string, transform TransformFunc) (offset, read int64, record transformRecord, err error) {
+	// Create or truncate target file, or pick up a previous partial copy
+	var out File
+	if fs.resume && transform == nil {
+		out, offset, err = openResumable(writeFS, in, writePath)
+		if err == nil && offset > 0 {
+			log.Printf("⏩ Resuming %q at byte %d", writePath, offset)
+			if fs.progress != nil {
+				fs.progress.add(offset)
+			}
+		}
+	} else {
+		out, err = fs.createTarget(writeFS, writePath)
+	}
+	if err != nil {
+		return 0, 0, record, err
+	}
+	defer out.Close()
+
+	// Reserve the full extent up front to reduce fragmentation;
+	// unsupported filesystems simply skip this
+	if fs.preallocate && transform == nil && srcInfo.Size() > offset {
+		_ = preallocate(out, srcInfo.Size())
+	}
+
+	// Copy contents, counting bytes for the progress callback if set
+	var r io.Reader = in
+	if fs.limiter != nil {
+		r = &limitedReader{r: r, l: fs.limiter}
+	}
+	if fs.progress != nil {
+		r = &progressReader{r: r, t: fs.progress}
+	}
+	var written int64
+	switch {
+	case transform != nil:
+		record, read, err = fs.transformCopy(transform, r, out)
+	case offset == 0 && srcInfo.Size() < fs.smallFileSize:
+		written, err = copyWhole(out, r, srcInfo.Size())
+		read = written
+	default:
+		written, err = io.Copy(out, r)
+		read = written
+	}
+	if err != nil {
+		return 0, 0, record, err
+	}
+	if fs.preallocate && transform == nil {
+		// The source may have shrunk since it was stat'ed; cut off
+		// any preallocated space that was never written
+		if err := out.Truncate(offset + written); err != nil {
+			return 0, 0, record, err
+		}
+	}
+	if fs.atomicCopy {
+		if err := out.Sync(); err != nil {
+			return 0, 0, record, err
+		}
+	}
+	return offset, read, record, out.Close()
+}
+
+// copyWhole copies a small file of the given size from r to w through
+// one buffer holding all of it, like os.ReadFile and os.WriteFile, which
+// saves the calls io.Copy spends per file setting up a stream. The
+// read asks for a byte more than the size, to see the end of the file;
+// one that grew since it was stat'ed is finished with io.Copy, and
+// checkUnchanged then reports it.
+func copyWhole(w io.Writer, r io.Reader, size int64) (int64, error) {
+	buf := make([]byte, size+1)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	if n > 0 {
+		if _, err := w.Write(buf[:n]); err != nil {
+			return 0, err
+		}
+	}
+	if n < len(buf) {
+		return int64(n), nil
+	}
+	rest, err := io.Copy(w, r)
+	return int64(n) + rest, err
+}
+
+// tryReflink attempts to clone in into writePath as a copy-on-write
+// reflink and reports whether it worked. Only local copies within one
+// filesystem are attempted; anything else is left to streamCopy.
+func (fs *FileSync) tryReflink(in File, writeFS FS, writePath string) bool {
+	f, ok := in.(*os.File)
+	if !ok || !fs.localCopy(writeFS) {
+		return false
+	}
+	srcDev, ok := deviceID(f.Name())
+	if !ok {
+		return false
+	}
+	dstDev, ok := deviceID(filepath.Dir(writePath))
+	if !ok || srcDev != dstDev {
+		return false
+	}
+	return reflink(f, writePath) == nil
+}
+
+// localCopy reports whether both the source and writeFS are the local
+// filesystem, so OS-level metadata can be copied between them.
+func (fs *FileSync) localCopy(writeFS FS) bool {
+	_, localSrc := fs.srcFS.(osFS)
+	_, localDst := writeFS.(osFS)
+	return localSrc && localDst
+}
+
+// stagingFile returns where an atomic copy into dst is written before
+// it is moved into place: a partial file next to dst, or one in the
+// temp dir (see WithTempDir) on the local filesystem. The name is
+// stable per dst so interrupted copies can be resumed.
+func (fs *FileSync) stagingFile(dst string) (FS, string) {
+	if fs.tempDir == "" {
+		return fs.tgtFS, partialPath(dst)
+	}
+	sum := sha256.Sum256([]byte(dst))
+	name := fmt.Sprintf(".%x-%s%s", sum[:8], filepath.Base(dst), partialSuffix)
+	return osFS{}, filepath.Join(fs.tempDir, name)
+}
+
+// stampModTime gives path on fsys the mod time of the source srcInfo
+// describes. An empty file is checked afterwards and stamped again if
+// the time did not stick: with no data written, some filesystems,
+// network ones in particular, settle the creation's timestamp only
+// after the close, overriding ours, and the file would be copied again
+// on every run. Renaming a staged copy into place keeps the time.
+func (fs *FileSync) stampModTime(fsys FS, path string, srcInfo os.FileInfo) error {
+	modTime := srcInfo.ModTime()
+	if err := fsys.Chtimes(path, modTime, modTime); err != nil {
+		return err
+	}
+	if srcInfo.Size() != 0 {
+		return nil
+	}
+	for attempt := 1; ; attempt++ {
+		info, err := fsys.Stat(path)
+		if err != nil {
+			return err
+		}
+		if sameModTime(modTime, info.ModTime(), fs.timeTolerance) {
+			return nil
+		}
+		if attempt == 2 {
+			log.Printf("⚠️ Mod time of empty file did not stick, it may be copied again: %q", path)
+			return nil
+		}
+		if err := fsys.Chtimes(path, modTime, modTime); err != nil {
+			return err
+		}
+	}
+}
+
+// preserveModTime reports whether copies get the source's mod time,
+// which content-only mode skips unless WithKeepModTimes asks for it.
+func (fs *FileSync) preserveModTime() bool {
+	return !fs.contentOnly || fs.keepModTimes
+}
+
+// renameStaged moves a staged copy into place. It is a variable so
+// tests can make it fail like a rename across filesystems.
+var renameStaged = func(fsys FS, stage, dst string) error {
+	return fsys.Rename(stage, dst)
+}
+
+// publish moves the finished staging file at stage, a copy of the
+// source file srcInfo describes, over dst. A rename
+// is used when both are on the same device. Otherwise, or when the
+// rename fails because they are on different filesystems after all,
+// the staged data is first copied into a partial file next to dst,
+// with the staged mode, owner, extended attributes and mod time, which
+// can then be renamed atomically, and the staging file is removed.
+func (fs *FileSync) publish(stage, dst string, srcInfo os.FileInfo) error {
+	if fs.tempDir == "" || fs.sameDevice(stage, dst) {
+		err := renameStaged(fs.tgtFS, stage, dst)
+		if fs.tempDir == "" || !crossDevice(err) {
+			return err
+		}
+		log.Printf("↪️ The temp dir is on another filesystem than the target, copying instead of renaming: %q", dst)
+	}
+
+	part := partialPath(dst)
+	if err := copyBetween(osFS{}, stage, fs.tgtFS, part); err != nil {
+		return err
+	}
+	if mode := fs.copyMode(dst, srcInfo); mode != 0 {
+		if err := fs.tgtFS.Chmod(part, mode); err != nil {
+			return err
+		}
+	}
+	fs.applyOwner(fs.tgtFS, part)
+	fs.copyOwner(fs.tgtFS, part, srcInfo)
+	if fs.xattrs && fs.localCopy(fs.tgtFS) {
+		if err := copyXattrs(stage, part); err != nil {
+			return err
+		}
+	}
+	if fs.preserveModTime() {
+		if err := fs.stampModTime(fs.tgtFS, part, srcInfo); err != nil {
+			return err
+		}
+	}
+	if err := fs.tgtFS.Rename(part, dst); err != nil {
+		return err
+	}
+	return os.Remove(stage)
+}
+
+// sameDevice reports whether the local staging file stage and the
+// target path dst are on the same device, so a rename between them
+// works. Remote targets never are.
+func (fs *FileSync) sameDevice(stage, dst string) bool {
+	if _, local := fs.tgtFS.(osFS); !local {
+		return false
+	}
+	stageDev, ok := deviceID(filepath.Dir(stage))
+	if !ok {
+		return false
+	}
+	dstDev, ok := deviceID(filepath.Dir(dst))
+	return ok && stageDev == dstDev
+}
+
+// copyBetween copies the file src on srcFS to dst on dstFS and
+// flushes it to stable storage.
+func copyBetween(srcFS FS, src string, dstFS FS, dst string) error {
+	in, err := srcFS.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := createFile(dstFS, dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// checkUnchanged re-stats src after copying and reports
+// ErrChangedDuringCopy if its size or mod time no longer match before,
+// or if the number of bytes copied differs from the size it had.
+func (fs *FileSync) checkUnchanged(src string, before os.FileInfo, copied int64) error {
+	after, err := fs.srcFS.Stat(src)
+	if err != nil {
+		return err
+	}
+	if copied != before.Size() || after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		return fmt.Errorf("%s: %w", src, ErrChangedDuringCopy)
+	}
+	return nil
+}
+
+// openResumable opens the partial file at path on fsys for writing and
+// positions both it and in at the offset where copying should
+// continue. A partial copy is only trusted if its bytes match the
+// source prefix; otherwise it is truncated and the offset is zero.
+func openResumable(fsys FS, in File, path string) (File, int64, error) {
+	out, err := fsys.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	srcInfo, err := in.Stat()
+	if err != nil {
+		out.Close()
+		return nil, 0, err
+	}
+	partInfo, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return nil, 0, err
+	}
+
+	offset := partInfo.Size()
+	if offset > 0 && offset <= srcInfo.Size() {
+		// Reading the prefix leaves both files positioned at offset
+		if ok, err := samePrefix(in, out, offset); err == nil && ok {
+			return out, offset, nil
+		}
+	}
+
+	// Start over: rewind the source and truncate the partial file
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		out.Close()
+		return nil, 0, err
+	}
+	if err := out.Truncate(0); err != nil {
+		out.Close()
+		return nil, 0, err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		out.Close()
+		return nil, 0, err
+	}
+	return out, 0, nil
+}
+
+// samePrefix compares the first n bytes of a and b chunk by chunk.
+func samePrefix(a, b io.Reader, n int64) (bool, error) {
+	const chunk = 64 * 1024
+	bufA := make([]byte, chunk)
+	bufB := make([]byte, chunk)
+	for n > 0 {
+		size := int64(chunk)
+		if n < size {
+			size = n
+		}
+		if _, err := io.ReadFull(a, bufA[:size]); err != nil {
+			return false, err
+		}
+		if _, err := io.ReadFull(b, bufB[:size]); err != nil {
+			return false, err
+		}
+		if !bytes.Equal(bufA[:size], bufB[:size]) {
+			return false, nil
+		}
+		n -= size
+	}
+	return true, nil
+}
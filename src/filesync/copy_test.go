@@ -0,0 +1,618 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_AtomicCopyLeavesNoPartial(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", time.Now())
+
+	fs := NewFileSync(src, dst, false, WithAtomicCopy(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("expected hello, got %s", data)
+	}
+	if _, err := os.Stat(partialPath(filepath.Join(dst, "a.txt"))); !os.IsNotExist(err) {
+		t.Error("expected partial file to be renamed away")
+	}
+}
+
+func TestOpenResumable(t *testing.T) {
+	tmp := t.TempDir()
+	content := "0123456789abcdef"
+	srcPath := filepath.Join(tmp, "src.bin")
+	writeTestFile(t, srcPath, content, time.Time{})
+
+	tests := []struct {
+		name       string
+		partial    string
+		wantOffset int64
+	}{
+		{"matching prefix resumes", "0123456", 7},
+		{"corrupt prefix restarts", "01X3456", 0},
+		{"oversized partial restarts", content + "extra", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partPath := filepath.Join(tmp, "part")
+			writeTestFile(t, partPath, tt.partial, time.Time{})
+
+			in, err := os.Open(srcPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+
+			out, offset, err := openResumable(LocalFS(), in, partPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offset != tt.wantOffset {
+				t.Errorf("expected offset %d, got %d", tt.wantOffset, offset)
+			}
+			rest := make([]byte, len(content))
+			n, _ := in.Read(rest)
+			if _, err := out.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			out.Close()
+
+			data, _ := os.ReadFile(partPath)
+			if string(data) != content {
+				t.Errorf("expected %q, got %q", content, data)
+			}
+		})
+	}
+}
+
+func TestFileSync_ResumePartialCopy(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeTestFile(t, filepath.Join(src, "big.bin"), "complete contents", time.Now())
+	// simulate an interrupted run that wrote part of the file
+	writeTestFile(t, partialPath(filepath.Join(dst, "big.bin")), "complete", time.Time{})
+
+	fs := NewFileSync(src, dst, true, WithResume(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "complete contents" {
+		t.Errorf("expected resumed file, got %q", data)
+	}
+	if _, err := os.Stat(partialPath(filepath.Join(dst, "big.bin"))); !os.IsNotExist(err) {
+		t.Error("expected partial file to be gone after resume")
+	}
+}
+
+func TestFileSync_Preallocate(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	content := strings.Repeat("x", 128*1024)
+	writeTestFile(t, filepath.Join(src, "big.bin"), content, time.Now())
+	writeTestFile(t, filepath.Join(src, "empty.bin"), "", time.Now())
+
+	fs := NewFileSync(src, dst, false, WithPreallocate(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("expected %d bytes, got %d", len(content), len(data))
+	}
+	info, err := os.Stat(filepath.Join(dst, "empty.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("expected empty file, got %d bytes", info.Size())
+	}
+}
+
+func TestFileSync_FileAndDirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeTestFile(t, filepath.Join(src, "shared", "deep", "a.txt"), "a", time.Now())
+	if err := os.Chmod(filepath.Join(src, "shared", "deep", "a.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileSync(src, dst, false, WithFileMode(0664), WithDirMode(0775))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"shared", filepath.Join("shared", "deep")} {
+		info, err := os.Stat(filepath.Join(dst, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0775 {
+			t.Errorf("expected %s mode 0775, got %o", dir, info.Mode().Perm())
+		}
+	}
+	info, err := os.Stat(filepath.Join(dst, "shared", "deep", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0664 {
+		t.Errorf("expected file mode 0664, got %o", info.Mode().Perm())
+	}
+}
+
+func TestFileSync_ModeRules(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	for _, name := range []string{"deploy.sh", "app.conf", "bin/run", "bin/tool.sh", "lib/util.sh"} {
+		writeTestFile(t, filepath.Join(src, name), name, time.Now())
+	}
+
+	fs := NewFileSync(src, dst, false,
+		WithFileMode(0644),
+		WithModeRule("*.sh", 0755),
+		WithModeRule("bin/*", 0750),
+		// Later rules win over earlier matches
+		WithModeRule("lib/*.sh", 0700),
+	)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{
+		"deploy.sh":   0755,
+		"app.conf":    0644,
+		"bin/run":     0750,
+		"bin/tool.sh": 0750,
+		"lib/util.sh": 0700,
+	} {
+		info, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %o, want %o", name, got, want)
+		}
+	}
+}
+
+// changingFS is a local FS whose files grow by one line the first
+// few times they are read to the end, like a log being written to.
+type changingFS struct {
+	FS
+	changes int
+}
+
+func (c *changingFS) Open(name string) (File, error) {
+	f, err := c.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &changingFile{File: f, fsys: c, name: name}, nil
+}
+
+type changingFile struct {
+	File
+	fsys *changingFS
+	name string
+}
+
+func (f *changingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if err == io.EOF && f.fsys.changes > 0 {
+		f.fsys.changes--
+		appendTo, openErr := os.OpenFile(f.name, os.O_APPEND|os.O_WRONLY, 0)
+		if openErr == nil {
+			appendTo.WriteString("more\n")
+			appendTo.Close()
+		}
+	}
+	return n, err
+}
+
+func TestFileSync_ChangedDuringCopy(t *testing.T) {
+	cases := []struct {
+		name        string
+		changes     int
+		opts        []Option
+		wantChanged bool
+	}{
+		{"warn", 1, nil, true},
+		{"warn atomic", 1, []Option{WithAtomicCopy(true)}, true},
+		{"retry succeeds", 2, []Option{WithChangedRetries(2)}, false},
+		{"retries exhausted", 3, []Option{WithChangedRetries(2)}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			writeTestFile(t, filepath.Join(src, "app.log"), "start\n", time.Now().Add(-time.Hour))
+
+			opts := append([]Option{WithSourceFS(&changingFS{FS: LocalFS(), changes: tc.changes})}, tc.opts...)
+			fs := NewFileSync(src, dst, false, opts...)
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+
+			stats := fs.Stats()
+			if got := len(stats.ChangedDuringCopy) > 0; got != tc.wantChanged {
+				t.Fatalf("ChangedDuringCopy = %v, want changed=%v", stats.ChangedDuringCopy, tc.wantChanged)
+			}
+			if got := errors.Is(stats.Err(), ErrChangedDuringCopy); got != tc.wantChanged {
+				t.Errorf("Err() = %v, want ErrChangedDuringCopy=%v", stats.Err(), tc.wantChanged)
+			}
+			if tc.wantChanged {
+				return
+			}
+
+			// After a successful retry the target matches the final source
+			want, _ := os.ReadFile(filepath.Join(src, "app.log"))
+			got, err := os.ReadFile(filepath.Join(dst, "app.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("target = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFileSync_TempDir(t *testing.T) {
+	cases := []struct {
+		name   string
+		remote bool // remote targets are never on the temp dir's device
+	}{
+		{"same device", false},
+		{"other device", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			tempDir := filepath.Join(tmp, "staging")
+			modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+			writeTestFile(t, filepath.Join(src, "sub", "a.txt"), "hello", modtime)
+
+			opts := []Option{WithTempDir(tempDir)}
+			if tc.remote {
+				opts = append(opts, WithTargetFS(newTestSFTPFS(t)))
+			}
+			fs := NewFileSync(src, dst, false, opts...)
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if err := fs.Stats().Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			target := filepath.Join(dst, "sub", "a.txt")
+			data, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "hello" {
+				t.Errorf("expected hello, got %q", data)
+			}
+			info, err := os.Stat(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(modtime) {
+				t.Errorf("mod time = %v, want %v", info.ModTime(), modtime)
+			}
+
+			// Neither the staging file nor a partial file is left behind
+			staged, _ := os.ReadDir(tempDir)
+			if len(staged) != 0 {
+				t.Errorf("staging dir not empty: %v", staged)
+			}
+			if _, err := os.Stat(partialPath(target)); !os.IsNotExist(err) {
+				t.Errorf("partial file left next to target")
+			}
+		})
+	}
+}
+
+func TestFileSync_ReflinkFallback(t *testing.T) {
+	// The temp dir is usually not on a copy-on-write filesystem, so
+	// this exercises the fallback; on Btrfs or APFS it is a real clone
+	for _, atomic := range []bool{false, true} {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		content := strings.Repeat("reflink ", 4096)
+		writeTestFile(t, filepath.Join(src, "big.bin"), content, modtime)
+		// A longer stale target must not leave trailing bytes behind
+		writeTestFile(t, filepath.Join(dst, "big.bin"), content+"stale tail", time.Time{})
+
+		fs := NewFileSync(src, dst, false, WithReflink(true), WithAtomicCopy(atomic))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Stats().Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dst, "big.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("atomic=%v: target has %d bytes, want %d", atomic, len(data), len(content))
+		}
+		info, err := os.Stat(filepath.Join(dst, "big.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(modtime) {
+			t.Errorf("atomic=%v: mod time = %v, want %v", atomic, info.ModTime(), modtime)
+		}
+	}
+}
+
+func TestFileSync_BeforeCopy(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, "small.txt"), "ok", now)
+	writeTestFile(t, filepath.Join(src, "big.txt"), "too large", now)
+	writeTestFile(t, filepath.Join(src, "denied.txt"), "no", now)
+
+	errDenied := errors.New("policy service said no")
+	hook := func(src, dst string, info os.FileInfo) (bool, error) {
+		switch filepath.Base(src) {
+		case "denied.txt":
+			return false, errDenied
+		case "big.txt":
+			return info.Size() < 5, nil
+		}
+		if filepath.Base(dst) != filepath.Base(src) {
+			t.Errorf("hook got dst %s for src %s", dst, src)
+		}
+		return true, nil
+	}
+
+	fs := NewFileSync(src, dst, false, WithBeforeCopy(hook))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if stats.FilesCopied != 1 || len(stats.Vetoed) != 1 || stats.Vetoed[0] != "big.txt" {
+		t.Errorf("copied %d, vetoed %v; want 1 and [big.txt]", stats.FilesCopied, stats.Vetoed)
+	}
+	if len(stats.Errors) != 1 || !errors.Is(stats.Errors[0], errDenied) {
+		t.Errorf("Errors = %v, want the hook's error", stats.Errors)
+	}
+	for _, name := range []string{"big.txt", "denied.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should not have been copied", name)
+		}
+	}
+
+	err := NewFileSync(src, dst, false, WithBeforeCopy(hook), WithFailOnAccessError(true)).SyncDirs()
+	if !errors.Is(err, errDenied) {
+		t.Errorf("with fail-on-access-error, SyncDirs() = %v, want the hook's error", err)
+	}
+}
+
+func TestFileSync_SameFileSkipped(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "notes.txt"), "a\r\nb\r\n", time.Now().Add(-time.Hour))
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(src, "notes.txt"), filepath.Join(dst, "notes.txt")); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	// Without a transform record the file would be recopied, which
+	// onto itself truncates it
+	fs := NewFileSync(src, dst, true)
+	fs.RegisterTransform(".txt", crlfToLF)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if !reflect.DeepEqual(stats.SameFile, []string{"notes.txt"}) {
+		t.Errorf("SameFile = %v, want [notes.txt]", stats.SameFile)
+	}
+	if stats.FilesCopied != 0 || stats.FilesDeleted != 0 {
+		t.Errorf("copied %d, deleted %d files, want none", stats.FilesCopied, stats.FilesDeleted)
+	}
+	if got := readTestFile(t, filepath.Join(src, "notes.txt")); got != "a\r\nb\r\n" {
+		t.Errorf("source = %q, want it untouched", got)
+	}
+}
+
+func TestFileSync_EmptyFileIdempotent(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts func(tmp string) []Option
+	}{
+		{"direct", func(string) []Option { return nil }},
+		{"atomic", func(string) []Option { return []Option{WithAtomicCopy(true)} }},
+		{"temp dir", func(tmp string) []Option {
+			return []Option{WithAtomicCopy(true), WithTempDir(filepath.Join(tmp, "stage"))}
+		}},
+		{"preallocate", func(string) []Option { return []Option{WithPreallocate(true)} }},
+		{"resume", func(string) []Option { return []Option{WithAtomicCopy(true), WithResume(true)} }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			modTime := time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC)
+			writeTestFile(t, filepath.Join(src, "empty"), "", modTime)
+
+			for run := 1; run <= 2; run++ {
+				fs := NewFileSync(src, dst, false, tc.opts(tmp)...)
+				if err := fs.SyncDirs(); err != nil {
+					t.Fatalf("run %d: %v", run, err)
+				}
+				want := 1
+				if run == 2 {
+					want = 0
+				}
+				if got := fs.Stats().FilesCopied; got != want {
+					t.Errorf("run %d copied %d file(s), want %d", run, got, want)
+				}
+			}
+			info, err := os.Stat(filepath.Join(dst, "empty"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != 0 || !sameModTime(modTime, info.ModTime(), 0) {
+				t.Errorf("target is %d bytes modified %v, want empty at %v", info.Size(), info.ModTime(), modTime)
+			}
+		})
+	}
+}
+
+// lazyTimesFS is a MemFS that drops the first Chtimes of each path,
+// like filesystems that settle a new file's timestamp after the close.
+type lazyTimesFS struct {
+	*MemFS
+	dropped map[string]bool
+}
+
+func (l *lazyTimesFS) Chtimes(name string, atime, mtime time.Time) error {
+	if !l.dropped[name] {
+		l.dropped[name] = true
+		return nil
+	}
+	return l.MemFS.Chtimes(name, atime, mtime)
+}
+
+func TestFileSync_EmptyFileModTimeRetried(t *testing.T) {
+	mem := NewMemFS()
+	mem.WriteFile("/src/empty", nil, time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+	lazy := &lazyTimesFS{MemFS: mem, dropped: map[string]bool{}}
+
+	for run := 1; run <= 2; run++ {
+		fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(lazy), WithAtomicCopy(true))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if run == 2 && fs.Stats().FilesCopied != 0 {
+			t.Errorf("second run copied %d file(s), want a no-op", fs.Stats().FilesCopied)
+		}
+	}
+}
+
+func TestFileSync_SmallFileThreshold(t *testing.T) {
+	const threshold = 1024
+	sizes := map[string]int{"empty": 0, "tiny": 10, "below": threshold - 1, "at": threshold, "large": 3 * threshold}
+	for _, limit := range []int64{threshold, 0} {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		for name, size := range sizes {
+			writeTestFile(t, filepath.Join(src, name), strings.Repeat("x", size), mtime)
+		}
+
+		fs := NewFileSync(src, dst, false, WithSmallFileThreshold(limit))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		for name, size := range sizes {
+			path := filepath.Join(dst, name)
+			if got := readTestFile(t, path); got != strings.Repeat("x", size) {
+				t.Errorf("threshold %d: %s has %d bytes, want %d", limit, name, len(got), size)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(mtime) {
+				t.Errorf("threshold %d: %s mod time = %v, want %v", limit, name, info.ModTime(), mtime)
+			}
+		}
+	}
+}
+
+func TestCopyWholeGrownFile(t *testing.T) {
+	// The source grew past the size it was stat'ed at
+	var out strings.Builder
+	n, err := copyWhole(&out, strings.NewReader("0123456789"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || out.String() != "0123456789" {
+		t.Errorf("copyWhole = %d, %q; want 10, %q", n, out.String(), "0123456789")
+	}
+}
+
+func BenchmarkFileSync_SmallFileCopy(b *testing.B) {
+	tmp := b.TempDir()
+	src := filepath.Join(tmp, "src")
+	for i := range 1000 {
+		writeTestFile(b, filepath.Join(src, "f", fmt.Sprintf("file%d.txt", i)), "content", time.Now())
+	}
+	for _, bc := range []struct {
+		name  string
+		limit int64
+	}{
+		{"streamed", 0},
+		{"whole", defaultSmallFileSize},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			dst := filepath.Join(tmp, "dst-"+bc.name)
+			fs := NewFileSync(src, dst, false, WithSmallFileThreshold(bc.limit))
+			for b.Loop() {
+				b.StopTimer()
+				if err := os.RemoveAll(dst); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if err := fs.SyncDirs(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
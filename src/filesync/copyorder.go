@@ -0,0 +1,78 @@
+package filesync
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CopyOrder is the order in which the copy pass copies files, see
+// WithCopyOrder.
+type CopyOrder int
+
+const (
+	// Natural copies files in walk order.
+	Natural CopyOrder = iota
+	// SmallestFirst copies the smallest files first, so the bulk of
+	// the file count is done early.
+	SmallestFirst
+	// LargestFirst copies the largest files first, so the longest
+	// transfers are not left for the end.
+	LargestFirst
+	// NewestFirst copies the most recently modified files first, so
+	// they get the room under WithTargetSizeCap.
+	NewestFirst
+)
+
+// String returns the name ParseCopyOrder accepts for o.
+func (o CopyOrder) String() string {
+	switch o {
+	case SmallestFirst:
+		return "smallest"
+	case LargestFirst:
+		return "largest"
+	case NewestFirst:
+		return "newest"
+	}
+	return "natural"
+}
+
+// ParseCopyOrder parses a copy order by name: "natural", "smallest",
+// "largest" or "newest", matched case-insensitively. Empty is Natural.
+func ParseCopyOrder(name string) (CopyOrder, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "natural":
+		return Natural, nil
+	case "smallest":
+		return SmallestFirst, nil
+	case "largest":
+		return LargestFirst, nil
+	case "newest":
+		return NewestFirst, nil
+	}
+	return Natural, fmt.Errorf("unknown copy order %q", name)
+}
+
+// orderCopies sorts jobs by source size or mod time for WithCopyOrder,
+// keeping the walk order among ties. A size cap copies the newest
+// files first unless told otherwise.
+func (fs *FileSync) orderCopies(jobs []*fileJob) {
+	order := fs.copyOrder
+	if order == Natural && fs.sizeCap > 0 {
+		order = NewestFirst
+	}
+	switch order {
+	case SmallestFirst, LargestFirst:
+		slices.SortStableFunc(jobs, func(a, b *fileJob) int {
+			if order == LargestFirst {
+				a, b = b, a
+			}
+			return cmp.Compare(a.srcInfo.Size(), b.srcInfo.Size())
+		})
+	case NewestFirst:
+		slices.SortStableFunc(jobs, func(a, b *fileJob) int {
+			return b.srcInfo.ModTime().Compare(a.srcInfo.ModTime())
+		})
+	}
+}
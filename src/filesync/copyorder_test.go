@@ -0,0 +1,84 @@
+package filesync
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_CopyOrder(t *testing.T) {
+	now := time.Now()
+	mem := NewMemFS()
+	for name, f := range map[string]struct{ size, age int }{"a.txt": {30, 0}, "b.txt": {10, 3}, "c.txt": {20, 1}, "d.txt": {10, 2}} {
+		mem.WriteFile("/src/"+name, []byte(strings.Repeat("x", f.size)), now.Add(-time.Duration(f.age)*time.Hour))
+	}
+	mem.MkdirAll("/dst", 0755)
+
+	tests := []struct {
+		order CopyOrder
+		want  []string
+	}{
+		{Natural, addActions("a.txt", "b.txt", "c.txt", "d.txt")},
+		// Files of the same size keep their walk order
+		{SmallestFirst, addActions("b.txt", "d.txt", "c.txt", "a.txt")},
+		{LargestFirst, addActions("a.txt", "c.txt", "b.txt", "d.txt")},
+		{NewestFirst, addActions("a.txt", "c.txt", "d.txt", "b.txt")},
+	}
+	for _, tc := range tests {
+		fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithDryRun(true), WithCopyOrder(tc.order))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if got := actionPaths(fs.PlannedActions()); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\n got %v\nwant %v", tc.order, got, tc.want)
+		}
+	}
+}
+
+// addActions returns the add actions of paths, as actionPaths does.
+func addActions(paths ...string) []string {
+	var out []string
+	for _, p := range paths {
+		out = append(out, fmt.Sprintf("%s %s", ActionAdd, p))
+	}
+	return out
+}
+
+func TestParseCopyOrder(t *testing.T) {
+	for _, order := range []CopyOrder{Natural, SmallestFirst, LargestFirst, NewestFirst} {
+		if got, err := ParseCopyOrder(strings.ToUpper(order.String())); err != nil || got != order {
+			t.Errorf("ParseCopyOrder(%q) = %v, %v", order, got, err)
+		}
+	}
+	if _, err := ParseCopyOrder("random"); err == nil {
+		t.Error("ParseCopyOrder accepted an unknown order")
+	}
+}
+
+// BenchmarkFileSync_CopyOrder copies a tree of many small files and a
+// few large ones in each order.
+func BenchmarkFileSync_CopyOrder(b *testing.B) {
+	tmp := b.TempDir()
+	src := filepath.Join(tmp, "src")
+	now := time.Now()
+	for i := range 200 {
+		size := 1 << 10
+		if i%50 == 0 {
+			size = 4 << 20
+		}
+		writeTestFile(b, filepath.Join(src, fmt.Sprintf("d%d", i%8), fmt.Sprintf("file%03d", i)), strings.Repeat("x", size), now)
+	}
+	for _, order := range []CopyOrder{Natural, SmallestFirst, LargestFirst} {
+		b.Run(order.String(), func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				fs := NewFileSync(src, filepath.Join(tmp, fmt.Sprintf("%s-%d", order, i)), false, WithCopyOrder(order))
+				if err := fs.SyncDirs(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
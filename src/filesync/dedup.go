@@ -0,0 +1,99 @@
+package filesync
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// dedupEntry is a file this run wrote to the target, kept as a
+// candidate for WithDedup to link later copies with the same content
+// to. The source checksum is computed lazily, once a second file of
+// the same size turns up.
+type dedupEntry struct {
+	srcPath    string
+	srcInfo    os.FileInfo
+	targetPath string
+	sum        []byte
+}
+
+// noteDeduped remembers the finished copy of job for linkDuplicate.
+func (fs *FileSync) noteDeduped(job *fileJob) {
+	if !fs.dedup {
+		return
+	}
+	if fs.dedupIndex == nil {
+		fs.dedupIndex = map[int64][]*dedupEntry{}
+	}
+	size := job.srcInfo.Size()
+	fs.dedupIndex[size] = append(fs.dedupIndex[size], &dedupEntry{srcPath: job.srcPath, srcInfo: job.srcInfo, targetPath: job.targetPath})
+}
+
+// breakHardLink removes the target file dst before a copy is written
+// over it in place when other names share its data, such as the links
+// of WithDedup, so the update does not rewrite them too. Only the name
+// dst goes; the others keep the old contents.
+func (fs *FileSync) breakHardLink(dst string) error {
+	info, err := fs.tgtFS.Lstat(dst)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	if n, ok := hardLinks(info); ok && n > 1 {
+		return fs.tgtFS.Remove(dst)
+	}
+	return nil
+}
+
+// linkDuplicate hard-links the target of job to an earlier copy of
+// this run whose source has the same content, and reports whether it
+// did. When hashing or linking fails, the file is copied as usual.
+func (fs *FileSync) linkDuplicate(job *fileJob) bool {
+	candidates := fs.dedupIndex[job.srcInfo.Size()]
+	if !fs.dedup || len(candidates) == 0 || job.srcInfo.Size() == 0 {
+		return false
+	}
+	sum, err := fs.checksumOf(fs.srcFS, job.srcPath, job.srcInfo)
+	if err != nil {
+		return false
+	}
+	var first *dedupEntry
+	for _, c := range candidates {
+		if c.sum == nil {
+			if c.sum, err = fs.checksumOf(fs.srcFS, c.srcPath, c.srcInfo); err != nil {
+				continue
+			}
+		}
+		if bytes.Equal(c.sum, sum) {
+			first = c
+			break
+		}
+	}
+	if first == nil {
+		return false
+	}
+
+	if fs.dryRun {
+		log.Printf("🔎 Would link duplicate: %q → %q", first.targetPath, job.targetPath)
+		return true
+	}
+	// Link next to the target and rename, so an outdated copy is
+	// replaced in one step
+	tmp := partialPath(job.targetPath)
+	_ = fs.tgtFS.Remove(tmp)
+	err = fs.makeDir(filepath.Dir(job.targetPath))
+	if err == nil {
+		err = fs.tgtFS.Link(first.targetPath, tmp)
+	}
+	if err == nil {
+		if err = fs.tgtFS.Rename(tmp, job.targetPath); err != nil {
+			_ = fs.tgtFS.Remove(tmp)
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️ Could not link duplicate %q, copying instead: %v", job.targetPath, err)
+		return false
+	}
+	log.Printf("🔗 Linked duplicate: %q → %q", first.targetPath, job.targetPath)
+	return true
+}
@@ -0,0 +1,83 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Dedup(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modtime := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "a.jpg"), "picture", modtime)
+	writeTestFile(t, filepath.Join(src, "backup", "a-copy.jpg"), "picture", modtime)
+	writeTestFile(t, filepath.Join(src, "b.jpg"), "PICTURE", modtime) // same size, other content
+
+	dry := NewFileSync(src, dst, false, WithDedup(true), WithDryRun(true))
+	if err := dry.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dry.Stats().FilesDeduped; got != 1 {
+		t.Errorf("dry run FilesDeduped = %d, want 1", got)
+	}
+	if added, _ := ByteImpact(dry.PlannedActions()); added != 2*int64(len("picture")) {
+		t.Errorf("dry run ByteImpact added %d bytes, want %d for the two copies only", added, 2*len("picture"))
+	}
+
+	fs := NewFileSync(src, dst, false, WithDedup(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if stats.FilesCopied != 2 || stats.FilesDeduped != 1 {
+		t.Errorf("copied %d, deduped %d files, want 2 and 1", stats.FilesCopied, stats.FilesDeduped)
+	}
+	first, err := os.Stat(filepath.Join(dst, "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup, err := os.Stat(filepath.Join(dst, "backup", "a-copy.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(first, dup) {
+		t.Error("duplicate was copied instead of hard-linked")
+	}
+	other, err := os.Stat(filepath.Join(dst, "b.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(first, other) {
+		t.Error("file with different content was linked")
+	}
+	if got := readTestFile(t, filepath.Join(dst, "backup", "a-copy.jpg")); got != "picture" {
+		t.Errorf("a-copy.jpg = %q, want %q", got, "picture")
+	}
+}
+
+// noLinkFS is a target filesystem without hard links.
+type noLinkFS struct{ FS }
+
+func (noLinkFS) Link(oldname, newname string) error { return os.ErrInvalid }
+
+func TestFileSync_DedupFallsBackToCopy(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "same", time.Now())
+	writeTestFile(t, filepath.Join(src, "b.txt"), "same", time.Now())
+
+	fs := NewFileSync(src, dst, false, WithDedup(true), WithTargetFS(noLinkFS{LocalFS()}))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 2 || stats.FilesDeduped != 0 || len(stats.Errors) != 0 {
+		t.Errorf("copied %d, deduped %d, errors %v; want 2 copies", stats.FilesCopied, stats.FilesDeduped, stats.Errors)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "b.txt")); got != "same" {
+		t.Errorf("b.txt = %q, want %q", got, "same")
+	}
+}
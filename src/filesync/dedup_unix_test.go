@@ -0,0 +1,40 @@
+//go:build unix
+
+package filesync
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_DedupUpdateKeepsLinks(t *testing.T) {
+	for _, dedup := range []bool{true, false} {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		modtime := time.Now().Add(-time.Hour)
+		writeTestFile(t, filepath.Join(src, "a.jpg"), "picture", modtime)
+		writeTestFile(t, filepath.Join(src, "a-copy.jpg"), "picture", modtime)
+		if err := NewFileSync(src, dst, false, WithDedup(true)).SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Updating one of the linked files, whether by an atomic copy or
+		// in place, leaves its sibling alone
+		writeTestFile(t, filepath.Join(src, "a.jpg"), "edited picture", time.Now())
+		fs := NewFileSync(src, dst, false, WithDedup(dedup))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Stats().Err(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readTestFile(t, filepath.Join(dst, "a.jpg")); got != "edited picture" {
+			t.Errorf("dedup %v: a.jpg = %q", dedup, got)
+		}
+		if got := readTestFile(t, filepath.Join(dst, "a-copy.jpg")); got != "picture" {
+			t.Errorf("dedup %v: the update rewrote the linked a-copy.jpg to %q", dedup, got)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package filesync
+
+import (
+	"log"
+	"path/filepath"
+)
+
+// dirCleanup is the state of WithDeleteFirstPerDir during a copy
+// pass: the sources orphans are checked against, and the target
+// directories whose orphans are already gone.
+type dirCleanup struct {
+	trees   []sourceTree
+	cleaned map[string]bool
+}
+
+// newDirCleanup returns the per-directory delete state for a copy
+// pass over trees, nil when WithDeleteFirstPerDir has nothing to do:
+// without delete-missing, when the source looks emptied out (see
+// WithDropGuard), in dry runs, whose deletions the delete pass reports,
+// and with WithDeleteFirst, whose delete pass has run already.
+func (fs *FileSync) newDirCleanup(trees []sourceTree, dropErr error) *dirCleanup {
+	if !fs.deleteFirstPerDir || !fs.deleteMissing || fs.existingOnly || fs.deleteFirst || fs.dryRun || dropErr != nil {
+		return nil
+	}
+	return &dirCleanup{trees: trees, cleaned: map[string]bool{}}
+}
+
+// cleanDirFirst clears the orphans out of the target directory of job
+// before the first copy into it, with WithDeleteFirstPerDir. Orphans
+// get the checks of the delete pass; subdirectories are left to theirs
+// or to the delete pass after the copies.
+func (fs *FileSync) cleanDirFirst(job *fileJob) error {
+	c := fs.dirCleanup
+	if c == nil {
+		return nil
+	}
+	dir, _ := filepath.Rel(fs.target, filepath.Dir(job.targetPath))
+	if !c.cleaned[dir] {
+		c.cleaned[dir] = true
+		if err := checkSourceRoots(c.trees...); err != nil {
+			return err
+		}
+		if err := fs.deleteMissingFiles(c.trees, dir, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeReplaced removes the old version of the file job replaces with
+// WithDeleteFirstPerDir and atomic copies, which would otherwise sit
+// beside the new one until the rename. It is called once nothing is
+// left that could skip the copy, such as the free space check.
+func (fs *FileSync) removeReplaced(job *fileJob) {
+	if fs.replacesFirst(job) {
+		if err := fs.removeEntry(fs.tgtFS, job.targetPath); err != nil {
+			log.Printf("⚠️ Could not remove the old version before copying: %q: %v", job.targetPath, err)
+			return
+		}
+		log.Printf("🗑️ Removed the old version before copying: %q", job.targetPath)
+	}
+}
+
+// replacesFirst reports whether removeReplaced removes the old version
+// of the file job replaces, whose space the free space check may then
+// count as free.
+func (fs *FileSync) replacesFirst(job *fileJob) bool {
+	return fs.dirCleanup != nil && fs.atomicCopy && job.tgtInfo != nil && job.tgtInfo.Mode().IsRegular()
+}
@@ -0,0 +1,173 @@
+package filesync
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_DeleteOrder(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	for _, deleteFirst := range []bool{false, true} {
+		mem := NewMemFS()
+		mem.WriteFile("/src/new.txt", []byte("new"), time.Now())
+		mem.WriteFile("/dst/old.txt", []byte("old"), time.Now())
+
+		var logs bytes.Buffer
+		log.SetOutput(&logs)
+		fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem),
+			WithDeleteFirst(deleteFirst))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatalf("SyncDirs() with delete first %v = %v", deleteFirst, err)
+		}
+
+		out := logs.String()
+		copied, removed := strings.Index(out, "Copied/Updated"), strings.Index(out, "Removed file")
+		if copied < 0 || removed < 0 {
+			t.Fatalf("missing copy or delete with delete first %v:\n%s", deleteFirst, out)
+		}
+		if (removed < copied) != deleteFirst {
+			t.Errorf("delete first %v, but the log is:\n%s", deleteFirst, out)
+		}
+	}
+}
+
+func TestFileSync_DeleteOrderFailedCopy(t *testing.T) {
+	failing := WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+		return false, errors.New("refused")
+	})
+	for _, deleteFirst := range []bool{false, true} {
+		mem := NewMemFS()
+		mem.WriteFile("/src/new.txt", []byte("new"), time.Now())
+		mem.WriteFile("/dst/old.txt", []byte("old"), time.Now())
+
+		fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem),
+			failing, WithFailOnAccessError(true), WithDeleteFirst(deleteFirst))
+		if err := fs.SyncDirs(); err == nil {
+			t.Fatalf("SyncDirs() with delete first %v succeeded despite the failed copy", deleteFirst)
+		}
+
+		// Only deleting first gets to the orphan before the copy fails
+		_, err := mem.Stat("/dst/old.txt")
+		if kept := err == nil; kept == deleteFirst {
+			t.Errorf("delete first %v: orphan kept = %v", deleteFirst, kept)
+		}
+	}
+}
+
+func TestFileSync_DeleteFirstPerDir(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	mem := NewMemFS()
+	old, now := time.Now().Add(-time.Hour), time.Now()
+	mem.WriteFile("/src/a/grown.bin", []byte("a larger version"), now)
+	mem.WriteFile("/src/a/same.txt", []byte("same"), old)
+	mem.WriteFile("/src/b/new.txt", []byte("new"), now)
+	mem.WriteFile("/src/c/same.txt", []byte("same"), old)
+	mem.WriteFile("/dst/a/grown.bin", []byte("small"), old)
+	mem.WriteFile("/dst/a/same.txt", []byte("same"), old)
+	mem.WriteFile("/dst/a/orphan.txt", []byte("orphan"), old)
+	mem.WriteFile("/dst/a/keep.log", []byte("protected"), old)
+	mem.WriteFile("/dst/a/sub/orphan.txt", []byte("orphan"), old)
+	mem.WriteFile("/dst/b/orphan.txt", []byte("orphan"), old)
+	mem.WriteFile("/dst/c/same.txt", []byte("same"), old)
+	mem.WriteFile("/dst/c/orphan.txt", []byte("orphan"), old)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem),
+		WithDeleteFirstPerDir(true), WithAtomicCopy(true))
+	fs.AddProtect("*.log")
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	out := logs.String()
+	at := func(s string) int {
+		t.Helper()
+		i := strings.Index(out, s)
+		if i < 0 {
+			t.Fatalf("no %q in the log:\n%s", s, out)
+		}
+		return i
+	}
+
+	// Each directory's orphans go right before its first copy, and the
+	// replaced file right before its own
+	aOrphan, aOld, aCopy := at(`Removed file: "/dst/a/orphan.txt"`), at(`old version before copying: "/dst/a/grown.bin"`), at(`Copied/Updated: "/src/a/grown.bin"`)
+	bOrphan, bCopy := at(`Removed file: "/dst/b/orphan.txt"`), at(`Copied/Updated: "/src/b/new.txt"`)
+	if !(aOrphan < aOld && aOld < aCopy && aCopy < bOrphan && bOrphan < bCopy) {
+		t.Errorf("deletions out of order:\n%s", out)
+	}
+	// Subdirectories and directories without copies are left to the
+	// delete pass after the copies
+	if at(`Removed file: "/dst/a/sub/orphan.txt"`) < bCopy || at(`Removed file: "/dst/c/orphan.txt"`) < bCopy {
+		t.Errorf("expected the delete pass to come last:\n%s", out)
+	}
+
+	for _, p := range []string{"/dst/a/same.txt", "/dst/a/keep.log", "/dst/c/same.txt"} {
+		if _, err := mem.Stat(p); err != nil {
+			t.Errorf("expected %s to be kept: %v", p, err)
+		}
+	}
+	for _, p := range []string{"/dst/a/orphan.txt", "/dst/a/sub/orphan.txt", "/dst/b/orphan.txt", "/dst/c/orphan.txt"} {
+		if _, err := mem.Stat(p); err == nil {
+			t.Errorf("expected %s to be gone", p)
+		}
+	}
+	if data, err := mem.ReadFile("/dst/a/grown.bin"); err != nil || string(data) != "a larger version" {
+		t.Errorf("grown.bin = %q, %v", data, err)
+	}
+	if stats := fs.Stats(); stats.FilesDeleted != 4 || stats.FilesCopied != 2 {
+		t.Errorf("deleted %d and copied %d files, want 4 and 2", stats.FilesDeleted, stats.FilesCopied)
+	}
+}
+
+func TestFileSync_DeleteFirstPerDirVetoed(t *testing.T) {
+	mem := NewMemFS()
+	mem.WriteFile("/src/a/new.txt", []byte("new"), time.Now())
+	mem.WriteFile("/src/a/changed.txt", []byte("changed"), time.Now())
+	mem.WriteFile("/dst/a/changed.txt", []byte("old"), time.Now().Add(-time.Hour))
+	mem.WriteFile("/dst/a/orphan.txt", []byte("orphan"), time.Now())
+
+	// A copy that does not happen deletes neither the file it would
+	// replace nor, before the run stops, the directory's orphans
+	refuse := WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+		return false, errors.New("refused")
+	})
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem),
+		WithDeleteFirstPerDir(true), WithAtomicCopy(true), refuse, WithFailOnAccessError(true))
+	if err := fs.SyncDirs(); err == nil {
+		t.Fatal("SyncDirs() succeeded despite the refused copy")
+	}
+	for _, p := range []string{"/dst/a/changed.txt", "/dst/a/orphan.txt"} {
+		if _, err := mem.Stat(p); err != nil {
+			t.Errorf("expected %s to be kept: %v", p, err)
+		}
+	}
+}
+
+func TestFileSync_DeleteFirstPerDirNoSpace(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a", "changed.txt"), "new version", time.Now())
+	writeTestFile(t, filepath.Join(dst, "a", "changed.txt"), "old", time.Now().Add(-time.Hour))
+
+	// A copy skipped for lack of space keeps the version it would have
+	// replaced
+	fs := NewFileSync(src, dst, true, WithDeleteFirstPerDir(true), WithAtomicCopy(true),
+		WithFreeSpaceCheck(true), WithFreeSpaceReserve(1<<62))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().NoSpace; len(got) != 1 {
+		t.Fatalf("NoSpace = %v, want the changed file skipped", got)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "a", "changed.txt")); got != "old" {
+		t.Errorf("changed.txt = %q, want the old version kept", got)
+	}
+}
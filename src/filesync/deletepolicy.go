@@ -0,0 +1,72 @@
+package filesync
+
+import (
+	"log"
+	"os"
+)
+
+// DeleteAction is what the delete pass does with an orphaned file, as
+// decided by a WithDeletePolicy callback.
+type DeleteAction int
+
+const (
+	// DeleteOrphan removes the file, or moves it to the trash with
+	// WithTrash, as without a policy.
+	DeleteOrphan DeleteAction = iota
+	// KeepOrphan leaves the file in place.
+	KeepOrphan
+	// BackupOrphan moves the file aside to the trash, as WithTrash
+	// does, even when WithTrash is not set.
+	BackupOrphan
+	// ReviewOrphan leaves the file in place and lists it in
+	// Stats.ForReview for someone to decide on.
+	ReviewOrphan
+)
+
+// String returns the name of a.
+func (a DeleteAction) String() string {
+	switch a {
+	case DeleteOrphan:
+		return "delete"
+	case KeepOrphan:
+		return "keep"
+	case BackupOrphan:
+		return "backup"
+	case ReviewOrphan:
+		return "review"
+	}
+	return "unknown"
+}
+
+// orphanAction asks the WithDeletePolicy callback what to do with the
+// orphaned file at path, relPath below the target root, and handles
+// the actions that leave it in place. A file that cannot be stat'ed,
+// or gets an action the pass does not know, is kept.
+func (fs *FileSync) orphanAction(relPath, path string, d os.DirEntry) DeleteAction {
+	if fs.deletePolicy == nil {
+		return DeleteOrphan
+	}
+	info, err := d.Info()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("❌ Could not read file info for %q: %v", path, err)
+			fs.recordError(&StatError{Path: path, Err: err})
+		}
+		return KeepOrphan
+	}
+	action := fs.deletePolicy(relPath, info)
+	switch action {
+	case DeleteOrphan, BackupOrphan:
+	case KeepOrphan:
+		log.Printf("📌 Kept by the delete policy: %q", path)
+		fs.stats.KeptByPolicy = append(fs.stats.KeptByPolicy, relPath)
+	case ReviewOrphan:
+		log.Printf("👀 Orphan left for review: %q", path)
+		fs.stats.ForReview = append(fs.stats.ForReview, relPath)
+	default:
+		log.Printf("⚠️ Unknown delete action %d, keeping: %q", action, path)
+		fs.stats.KeptByPolicy = append(fs.stats.KeptByPolicy, relPath)
+		action = KeepOrphan
+	}
+	return action
+}
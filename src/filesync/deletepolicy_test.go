@@ -0,0 +1,81 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_DeletePolicy(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	mem.WriteFile("/src/kept.txt", []byte("kept"), now)
+	for _, name := range []string{"old.txt", "keep.cfg", "photo.jpg", "notes.md", "odd.bin"} {
+		mem.WriteFile("/dst/"+name, []byte(name), now)
+	}
+
+	var seen []string
+	policy := func(relPath string, info os.FileInfo) DeleteAction {
+		seen = append(seen, relPath)
+		if info.Name() != filepath.Base(relPath) {
+			t.Errorf("info for %s is for %s", relPath, info.Name())
+		}
+		switch filepath.Ext(relPath) {
+		case ".cfg":
+			return KeepOrphan
+		case ".jpg":
+			return BackupOrphan
+		case ".md":
+			return ReviewOrphan
+		case ".bin":
+			return DeleteAction(42)
+		}
+		return DeleteOrphan
+	}
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithDeletePolicy(policy))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The policy is only asked about orphans
+	if want := []string{"keep.cfg", "notes.md", "odd.bin", "old.txt", "photo.jpg"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("policy saw %v, want %v", seen, want)
+	}
+	for _, p := range []string{"/dst/keep.cfg", "/dst/notes.md", "/dst/odd.bin"} {
+		if _, err := mem.Stat(p); err != nil {
+			t.Errorf("expected %s to be left in place: %v", p, err)
+		}
+	}
+	for _, p := range []string{"/dst/old.txt", "/dst/photo.jpg"} {
+		if _, err := mem.Stat(p); err == nil {
+			t.Errorf("expected %s to be gone", p)
+		}
+	}
+	entries, err := mem.ReadDir(filepath.Join("/dst", trashDirName))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("trash = %v, %v; want one run directory", entries, err)
+	}
+	if _, err := mem.Stat(filepath.Join("/dst", trashDirName, entries[0].Name(), "photo.jpg")); err != nil {
+		t.Errorf("expected photo.jpg in the trash: %v", err)
+	}
+
+	stats := fs.Stats()
+	if !reflect.DeepEqual(stats.KeptByPolicy, []string{"keep.cfg", "odd.bin"}) {
+		t.Errorf("KeptByPolicy = %v", stats.KeptByPolicy)
+	}
+	if !reflect.DeepEqual(stats.BackedUp, []string{"photo.jpg"}) {
+		t.Errorf("BackedUp = %v", stats.BackedUp)
+	}
+	if !reflect.DeepEqual(stats.ForReview, []string{"notes.md"}) {
+		t.Errorf("ForReview = %v", stats.ForReview)
+	}
+	if stats.FilesDeleted != 2 {
+		t.Errorf("FilesDeleted = %d, want 2", stats.FilesDeleted)
+	}
+	if !strings.Contains(strings.Join(fs.reportOptions(), ","), "delete policy") {
+		t.Errorf("report options = %v, want the delete policy listed", fs.reportOptions())
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !unix
+
+package filesync
+
+import "os"
+
+// deviceID is unknown without Unix stat data; callers then fall back
+// to copying, which works across devices.
+func deviceID(path string) (uint64, bool) {
+	return 0, false
+}
+
+// crossDevice never holds: without device IDs, publish copies staged
+// files instead of renaming them.
+func crossDevice(err error) bool {
+	return false
+}
+
+// fileDevice is unknown without Unix stat data, so no directory is
+// ever treated as a mount point.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// hardLinks is unknown without Unix stat data; only links made by
+// WithDedup are then kept apart, by its atomic copies.
+func hardLinks(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// specialDevice is unknown without Unix stat data.
+func specialDevice(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
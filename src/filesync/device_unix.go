@@ -0,0 +1,54 @@
+//go:build unix
+
+package filesync
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// deviceID returns the ID of the device holding path.
+func deviceID(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	return fileDevice(info)
+}
+
+// crossDevice reports whether err is a rename refused because source
+// and destination are on different filesystems, as happens across bind
+// mounts even when both report the same device.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// fileDevice returns the ID of the device holding the file info
+// describes, if it carries Unix stat data.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// hardLinks returns how many names the file info describes has, if it
+// carries Unix stat data.
+func hardLinks(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Nlink), true
+}
+
+// specialDevice returns the device number a device node stands for.
+func specialDevice(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Rdev), true
+}
@@ -0,0 +1,124 @@
+//go:build unix
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// mountFS is a local FS on which the directory mount reports another
+// device ID, as if a filesystem were mounted there.
+type mountFS struct {
+	FS
+	mount string
+}
+
+func (m mountFS) ReadDir(name string) ([]os.DirEntry, error) {
+	entries, err := m.FS.ReadDir(name)
+	for i, entry := range entries {
+		if filepath.Join(name, entry.Name()) == m.mount {
+			entries[i] = mountedEntry{entry}
+		}
+	}
+	return entries, err
+}
+
+type mountedEntry struct{ os.DirEntry }
+
+func (e mountedEntry) Info() (os.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return mountedInfo{info}, nil
+}
+
+type mountedInfo struct{ os.FileInfo }
+
+func (i mountedInfo) Sys() any {
+	st := *i.FileInfo.Sys().(*syscall.Stat_t)
+	st.Dev++
+	return &st
+}
+
+func TestFileSync_OneFileSystem(t *testing.T) {
+	for _, oneFS := range []bool{false, true} {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+		writeTestFile(t, filepath.Join(src, "mnt", "b.txt"), "b", time.Now())
+		writeTestFile(t, filepath.Join(src, "sub", "c.txt"), "c", time.Now())
+
+		source := mountFS{FS: LocalFS(), mount: filepath.Join(src, "mnt")}
+		fs := NewFileSync(src, dst, false, WithSourceFS(source), WithOneFileSystem(oneFS))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, rel := range []string{"a.txt", filepath.Join("sub", "c.txt")} {
+			if _, err := os.Stat(filepath.Join(dst, rel)); err != nil {
+				t.Errorf("oneFS=%v: %s missing: %v", oneFS, rel, err)
+			}
+		}
+		_, err := os.Stat(filepath.Join(dst, "mnt"))
+		if crossed := err == nil; crossed == oneFS {
+			t.Errorf("oneFS=%v: mount point synced = %v", oneFS, crossed)
+		}
+	}
+}
+
+func TestFileSync_TempDirCrossDeviceRename(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	tempDir := filepath.Join(tmp, "staging")
+	modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", modtime)
+
+	// The devices match, but the rename is refused as across a bind mount
+	rename := renameStaged
+	defer func() { renameStaged = rename }()
+	var refused int
+	renameStaged = func(fsys FS, stage, dst string) error {
+		if filepath.Dir(stage) == tempDir {
+			refused++
+			return &os.LinkError{Op: "rename", Old: stage, New: dst, Err: syscall.EXDEV}
+		}
+		return rename(fsys, stage, dst)
+	}
+
+	fs := NewFileSync(src, dst, false, WithTempDir(tempDir))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Stats().Err(); err != nil {
+		t.Fatal(err)
+	}
+	if refused != 1 {
+		t.Fatalf("%d renames out of the temp dir, want 1", refused)
+	}
+	target := filepath.Join(dst, "a.txt")
+	if data := readTestFile(t, target); data != "hello" {
+		t.Errorf("target = %q, want hello", data)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(modtime) {
+		t.Errorf("target mod time = %v, want %v", info.ModTime(), modtime)
+	}
+	for _, dir := range []string{tempDir, dst} {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if isPartialName(e.Name()) {
+				t.Errorf("staging file %s left in %s", e.Name(), dir)
+			}
+		}
+	}
+}
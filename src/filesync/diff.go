@@ -0,0 +1,254 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DiffEntry is a path present on both sides that differs.
+type DiffEntry struct {
+	Path   string     `json:"path"`   // relative to the source/target roots
+	Reason DiffReason `json:"reason"` // why the comparator considers them different
+}
+
+// DiffResult describes how the target differs from the source.
+// All paths are relative to the respective roots, in walk order.
+type DiffResult struct {
+	OnlyInSource []string    `json:"only_in_source"`
+	OnlyInTarget []string    `json:"only_in_target"`
+	Differing    []DiffEntry `json:"differing"`
+}
+
+// Empty reports whether source and target are in sync.
+func (r *DiffResult) Empty() bool {
+	return len(r.OnlyInSource) == 0 && len(r.OnlyInTarget) == 0 && len(r.Differing) == 0
+}
+
+// Diff compares source and target without modifying either.
+//
+// Unlike a dry run it does not simulate the actions a sync would
+// take; it only reports state. Both trees are walked in full
+// regardless of deleteMissing, .syncignore rules are honored, and
+// files present on both sides are compared with the configured
+// comparator (see WithChecksum). With several sources, each path is
+// judged by the source that would win it during a sync. The walk
+// stops early with ctx's error if ctx is cancelled. WithParallelPlan
+// speeds up the source side on large trees, and with WithDiffModes,
+// files that only differ in their permission bits are reported too.
+func (fs *FileSync) Diff(ctx context.Context) (*DiffResult, error) {
+	if fs.pathMapper != nil {
+		return nil, errors.New("Diff compares paths as they are and does not support a path mapper")
+	}
+	if fs.cas {
+		return nil, errors.New("Diff compares trees and does not support a content-addressable store")
+	}
+	if err := fs.connect(); err != nil {
+		return nil, err
+	}
+	if err := fs.checkHashAlgorithm(); err != nil {
+		return nil, err
+	}
+	if err := fs.loadTransforms(); err != nil {
+		return nil, err
+	}
+	if err := fs.loadChecksumCache(); err != nil {
+		return nil, err
+	}
+	result := &DiffResult{}
+	trees := fs.sourceTrees()
+
+	// Source side: compare every source, then keep the winning
+	// source's view of each path (see AddSource)
+	perSource := make([][]diffItem, len(trees))
+	for i, tree := range trees {
+		items, err := fs.diffTree(ctx, tree)
+		if err != nil {
+			return nil, err
+		}
+		perSource[i] = items
+	}
+	for _, item := range mergeByPath(perSource, func(it diffItem) string { return it.relPath }, fs.firstSourceWins) {
+		switch {
+		case item.missing:
+			result.OnlyInSource = append(result.OnlyInSource, item.relPath)
+		case item.reason != "":
+			result.Differing = append(result.Differing, DiffEntry{Path: item.relPath, Reason: item.reason})
+		}
+	}
+
+	// Target side: entries the source does not have
+	extra, err := fs.onlyInTarget(ctx, trees, nil)
+	if err != nil {
+		return nil, err
+	}
+	result.OnlyInTarget = extra
+
+	return result, nil
+}
+
+// diffItem is the state of one source path relative to the target.
+type diffItem struct {
+	relPath string
+	missing bool       // not present in target
+	reason  DiffReason // why it differs; empty if identical
+}
+
+// diffTree classifies the entries of one source tree against the
+// target, in walk order. With WithParallelPlan, the top-level entries
+// are classified concurrently and their results put back together in
+// the order a serial walk visits them, so the outcome is the same.
+func (fs *FileSync) diffTree(ctx context.Context, tree sourceTree) ([]diffItem, error) {
+	if fs.planWorkers <= 1 || tree.file != "" {
+		return fs.diffSource(ctx, tree, ".")
+	}
+	entries, err := tree.fsys.ReadDir(tree.root)
+	if err != nil {
+		// Let the serial walk report it
+		return fs.diffSource(ctx, tree, ".")
+	}
+	less := func(a, b string) bool { return a < b }
+	if fs.foldCaseOrder {
+		less = foldedLess
+	}
+	sort.Slice(entries, func(i, j int) bool { return less(entries[i].Name(), entries[j].Name()) })
+
+	parts := make([][]diffItem, len(entries))
+	errs := make([]error, len(entries))
+	slots := make(chan struct{}, fs.planWorkers)
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			parts[i], errs[i] = fs.diffSource(ctx, tree, entry.Name())
+		}()
+	}
+	wg.Wait()
+
+	var items []diffItem
+	for i := range parts {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		items = append(items, parts[i]...)
+	}
+	return items, nil
+}
+
+// diffSource walks the scope of one source tree and classifies each
+// entry against the target, in walk order, following directory links
+// as the sync does.
+func (fs *FileSync) diffSource(ctx context.Context, tree sourceTree, scope string) ([]diffItem, error) {
+	var items []diffItem
+
+	err := fs.walk(tree.fsys, tree.walkRoot(scope), fs.followDirLinks(tree.fsys, tree.root, func(path string, d os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			log.Printf("Error accessing %q: %v", path, err)
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(tree.root, path)
+		if relPath == "." {
+			return nil
+		}
+		if fs.excluded(tree.ignores, relPath, d.IsDir()) || fs.contentExcluded(tree.fsys, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Special files have no content to compare, see syncSpecial
+		if isSpecial(d.Type()) {
+			return nil
+		}
+		targetPath := filepath.Join(fs.target, relPath)
+
+		tgtInfo, err := fs.tgtFS.Stat(targetPath)
+		if os.IsNotExist(err) {
+			items = append(items, diffItem{relPath: relPath, missing: true})
+			return nil
+		}
+		if err != nil {
+			log.Printf("❌ Problem reading %q: %v", targetPath, err)
+			return nil
+		}
+
+		if d.IsDir() != tgtInfo.IsDir() {
+			items = append(items, diffItem{relPath: relPath, reason: ReasonType})
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			items = append(items, diffItem{relPath: relPath})
+			return nil
+		}
+
+		srcInfo, err := d.Info()
+		if err != nil {
+			log.Printf("❌ Could not read file info for %q: %v", path, err)
+			return nil
+		}
+		reason, err := fs.compareFiles(path, targetPath, srcInfo, tgtInfo)
+		if err != nil {
+			log.Printf("❌ Could not compare %q with %q: %v", path, targetPath, err)
+			return nil
+		}
+		if reason == "" && fs.diffModes && srcInfo.Mode().Perm() != tgtInfo.Mode().Perm() {
+			reason = ReasonMode
+		}
+		items = append(items, diffItem{relPath: relPath, reason: reason})
+		return nil
+	}))
+	return items, err
+}
+
+// onlyInTarget walks the target and returns the entries that no source
+// has, skipping internal files and excluded paths. Walk errors are
+// logged, and also passed to onError when it is not nil.
+func (fs *FileSync) onlyInTarget(ctx context.Context, trees []sourceTree, onError func(error)) ([]string, error) {
+	var extra []string
+	err := fs.walk(fs.tgtFS, fs.target, func(path string, d os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			log.Printf("Error accessing %q: %v", path, err)
+			if onError != nil {
+				onError(&WalkError{Path: path, Err: err})
+			}
+			return nil
+		}
+		if fs.isInternal(path) {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(fs.target, path)
+		if relPath == "." {
+			return nil
+		}
+		if fs.excludedEverywhere(trees, relPath, d.IsDir()) || fs.contentExcluded(fs.tgtFS, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if missingEverywhere(trees, relPath) {
+			extra = append(extra, relPath)
+		}
+		return nil
+	})
+	return extra, err
+}
@@ -0,0 +1,260 @@
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Diff(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	old := now.Add(-time.Hour)
+
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dst, "same.txt"), "same", now)
+	writeTestFile(t, filepath.Join(src, "size.txt"), "longer", now)
+	writeTestFile(t, filepath.Join(dst, "size.txt"), "short", now)
+	writeTestFile(t, filepath.Join(src, "time.txt"), "abc", now)
+	writeTestFile(t, filepath.Join(dst, "time.txt"), "abc", old)
+	writeTestFile(t, filepath.Join(src, "new.txt"), "new", now)
+	writeTestFile(t, filepath.Join(dst, "extra.txt"), "extra", now)
+
+	fs := NewFileSync(src, dst, false)
+	result, err := fs.Diff(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"new.txt"}; !reflect.DeepEqual(result.OnlyInSource, want) {
+		t.Errorf("OnlyInSource = %v, want %v", result.OnlyInSource, want)
+	}
+	if want := []string{"extra.txt"}; !reflect.DeepEqual(result.OnlyInTarget, want) {
+		t.Errorf("OnlyInTarget = %v, want %v", result.OnlyInTarget, want)
+	}
+	wantDiff := []DiffEntry{
+		{Path: "size.txt", Reason: ReasonSize},
+		{Path: "time.txt", Reason: ReasonTime},
+	}
+	if !reflect.DeepEqual(result.Differing, wantDiff) {
+		t.Errorf("Differing = %v, want %v", result.Differing, wantDiff)
+	}
+
+	// Diff must not have touched the target
+	again, err := fs.Diff(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, result) {
+		t.Error("expected Diff to be side-effect free")
+	}
+}
+
+func TestFileSync_DiffChecksum(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	// same size and mod time, different bytes
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa", now)
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "bbbb", now)
+	// different mod time, same bytes
+	writeTestFile(t, filepath.Join(src, "b.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dst, "b.txt"), "same", now.Add(-time.Hour))
+
+	fs := NewFileSync(src, dst, false, WithChecksum(true))
+	result, err := fs.Diff(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []DiffEntry{{Path: "a.txt", Reason: ReasonContent}}
+	if !reflect.DeepEqual(result.Differing, want) {
+		t.Errorf("Differing = %v, want %v", result.Differing, want)
+	}
+}
+
+func TestFileSync_DiffModes(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	mem.WriteFile("/src/run.sh", []byte("#!/bin/sh"), now)
+	mem.WriteFile("/dst/run.sh", []byte("#!/bin/sh"), now)
+	mem.Chmod("/src/run.sh", 0755)
+	mem.Chmod("/dst/run.sh", 0644)
+
+	for _, modes := range []bool{false, true} {
+		fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithDiffModes(modes))
+		result, err := fs.Diff(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []DiffEntry
+		if modes {
+			want = []DiffEntry{{Path: "run.sh", Reason: ReasonMode}}
+		}
+		if !reflect.DeepEqual(result.Differing, want) {
+			t.Errorf("modes %v: Differing = %v, want %v", modes, result.Differing, want)
+		}
+	}
+}
+
+func TestFileSync_DiffCancelled(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fs := NewFileSync(src, filepath.Join(tmp, "dst"), false)
+	if _, err := fs.Diff(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestFileSync_DiffParallelPlan(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for _, dir := range []string{"b", "a", "c/d", "e"} {
+		for _, name := range []string{"new.txt", "same.txt", "changed.txt"} {
+			p := dir + "/" + name
+			mem.WriteFile("/src/"+p, []byte(p), now)
+			switch name {
+			case "same.txt":
+				mem.WriteFile("/dst/"+p, []byte(p), now)
+			case "changed.txt":
+				mem.WriteFile("/dst/"+p, []byte("old"), now)
+			}
+		}
+	}
+	mem.WriteFile("/src/root.txt", []byte("root"), now)
+	mem.WriteFile("/src/Z.txt", []byte("z"), now)
+	mem.WriteFile("/dst/orphan.txt", []byte("gone"), now)
+
+	diff := func(opts ...Option) *DiffResult {
+		t.Helper()
+		fs := NewFileSync("/src", "/dst", false, append([]Option{WithSourceFS(mem), WithTargetFS(mem)}, opts...)...)
+		result, err := fs.Diff(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	serial := diff()
+	if len(serial.OnlyInSource) == 0 || len(serial.Differing) == 0 {
+		t.Fatalf("serial diff = %+v, want missing and differing files", serial)
+	}
+	for range 5 {
+		if got := diff(WithParallelPlan(3)); !reflect.DeepEqual(got, serial) {
+			t.Fatalf("parallel diff = %+v, want %+v", got, serial)
+		}
+	}
+	if got, want := diff(WithParallelPlan(3), WithCaseInsensitiveOrder(true)), diff(WithCaseInsensitiveOrder(true)); !reflect.DeepEqual(got, want) {
+		t.Errorf("case-folded parallel diff = %+v, want %+v", got, want)
+	}
+}
+
+func TestFileSync_DiffParallelPlanIgnores(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, syncIgnoreName), "*.tmp\n", now)
+	for _, dir := range []string{"a", "b", "c", "d", "e", "f"} {
+		writeTestFile(t, filepath.Join(src, dir, syncIgnoreName), "*.log\n", now)
+		writeTestFile(t, filepath.Join(src, dir, "sub", syncIgnoreName), "!keep.log\n", now)
+		for _, name := range []string{"new.txt", "skip.tmp", "skip.log", "sub/new.txt", "sub/keep.log", "sub/deep/skip.log"} {
+			writeTestFile(t, filepath.Join(src, dir, name), name, now)
+		}
+	}
+
+	diff := func(opts ...Option) *DiffResult {
+		t.Helper()
+		result, err := NewFileSync(src, dst, false, opts...).Diff(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	serial := diff()
+	// Per directory: itself, sub and sub/deep, new.txt and sub/new.txt,
+	// and sub/keep.log, which the nested file re-includes
+	if want := 6 * 6; len(serial.OnlyInSource) != want {
+		t.Fatalf("serial diff has %d entries only in the source, want %d: %v", len(serial.OnlyInSource), want, serial.OnlyInSource)
+	}
+	for range 5 {
+		if got := diff(WithParallelPlan(4)); !reflect.DeepEqual(got, serial) {
+			t.Fatalf("parallel diff = %+v, want %+v", got, serial)
+		}
+	}
+}
+
+// busyStatFS is a target whose lookups take a while, recording how
+// many ran at once.
+type busyStatFS struct {
+	FS
+	running, most atomic.Int32
+}
+
+func (b *busyStatFS) Lstat(name string) (os.FileInfo, error) {
+	n := b.running.Add(1)
+	defer b.running.Add(-1)
+	for m := b.most.Load(); n > m && !b.most.CompareAndSwap(m, n); m = b.most.Load() {
+	}
+	time.Sleep(2 * time.Millisecond)
+	return b.FS.Lstat(name)
+}
+
+func TestFileSync_DryRunParallelPlan(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for _, dir := range []string{"b", "a", "c/d", "e"} {
+		for _, name := range []string{"new.txt", "same.txt", "changed.txt"} {
+			p := dir + "/" + name
+			mem.WriteFile("/src/"+p, []byte(p), now)
+			switch name {
+			case "same.txt":
+				mem.WriteFile("/dst/"+p, []byte(p), now)
+			case "changed.txt":
+				mem.WriteFile("/dst/"+p, []byte("old"), now)
+			}
+		}
+	}
+	// A file where the source has a directory, and the reverse
+	mem.WriteFile("/src/f/inside.txt", []byte("f"), now)
+	mem.WriteFile("/dst/f", []byte("file"), now)
+	mem.WriteFile("/src/g", []byte("g"), now)
+	mem.WriteFile("/dst/g/inside.txt", []byte("dir"), now)
+	mem.WriteFile("/dst/orphan.txt", []byte("gone"), now)
+
+	plan := func(opts ...Option) ([]Action, int32) {
+		t.Helper()
+		tgt := &busyStatFS{FS: mem}
+		fs := NewFileSync("/src", "/dst", true, append([]Option{WithSourceFS(mem), WithTargetFS(tgt), WithDryRun(true)}, opts...)...)
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if errs := fs.Stats().Errors; len(errs) > 0 {
+			t.Fatalf("dry run errors: %v", errs)
+		}
+		return fs.PlannedActions(), tgt.most.Load()
+	}
+	serial, _ := plan()
+	if len(serial) == 0 {
+		t.Fatal("serial dry run planned nothing")
+	}
+	got, most := plan(WithParallelPlan(4))
+	if !reflect.DeepEqual(got, serial) {
+		t.Errorf("parallel plan = %+v, want %+v", got, serial)
+	}
+	if most < 2 {
+		t.Errorf("at most %d target lookup(s) ran at once, want them in parallel", most)
+	}
+}
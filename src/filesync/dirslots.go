@@ -0,0 +1,44 @@
+package filesync
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// dirSlots bounds how many files are worked on at once within any one
+// target directory, see WithMaxPerDirectory. Each directory gets its
+// own semaphore on first use.
+type dirSlots struct {
+	mu    sync.Mutex
+	limit int
+	slots map[string]chan struct{}
+}
+
+// newDirSlots returns the per-directory semaphores for a limit of n,
+// nil when there is no limit.
+func newDirSlots(n int) *dirSlots {
+	if n < 1 {
+		return nil
+	}
+	return &dirSlots{limit: n, slots: map[string]chan struct{}{}}
+}
+
+// acquireDir blocks until another file in the directory of the target
+// path may be worked on and returns the function that gives the slot
+// back.
+func (fs *FileSync) acquireDir(targetPath string) func() {
+	d := fs.dirSlots
+	if d == nil {
+		return func() {}
+	}
+	dir := filepath.Dir(targetPath)
+	d.mu.Lock()
+	slots, ok := d.slots[dir]
+	if !ok {
+		slots = make(chan struct{}, d.limit)
+		d.slots[dir] = slots
+	}
+	d.mu.Unlock()
+	slots <- struct{}{}
+	return func() { <-slots }
+}
@@ -0,0 +1,58 @@
+package filesync
+
+import (
+	"log"
+	"os"
+)
+
+// dirStamp is a source directory whose metadata its target copy gets:
+// mode and mod time in a directories-only sync, mode, owner and ACLs when
+// they are preserved.
+type dirStamp struct {
+	sourcePath string
+	targetPath string
+	info       os.FileInfo
+}
+
+// noteDirStamp remembers the source directory d at path for
+// applyDirStamps.
+func (fs *FileSync) noteDirStamp(path, targetPath string, d os.DirEntry) {
+	if info, err := d.Info(); err == nil {
+		fs.dirStamps = append(fs.dirStamps, dirStamp{sourcePath: path, targetPath: targetPath, info: info})
+	}
+}
+
+// applyDirStamps gives the target directories noted during the walk
+// the mode (unless one is configured), owner, ACLs and, for a
+// directories-only sync, mod time of their source. It runs once the
+// walk is over, since creating a subdirectory would otherwise bump its
+// parent's mod time again.
+func (fs *FileSync) applyDirStamps() {
+	stamps := fs.dirStamps
+	fs.dirStamps = nil
+	if fs.dryRun {
+		return
+	}
+	for _, s := range stamps {
+		if fs.targetDirMode() == 0 && (fs.dirsOnly || fs.preservePerms) {
+			if err := fs.tgtFS.Chmod(s.targetPath, s.info.Mode().Perm()); err != nil {
+				if !os.IsNotExist(err) {
+					log.Printf("⚠️ Could not set the mode of %q: %v", s.targetPath, err)
+				}
+				continue
+			}
+		}
+		fs.copyOwner(fs.tgtFS, s.targetPath, s.info)
+		if fs.localCopy(fs.tgtFS) {
+			if err := fs.copyACL(s.sourcePath, s.targetPath, true); err != nil && !os.IsNotExist(err) {
+				log.Printf("⚠️ Could not copy the ACLs of %q: %v", s.targetPath, err)
+			}
+		}
+		if !fs.dirsOnly {
+			continue
+		}
+		if err := fs.tgtFS.Chtimes(s.targetPath, s.info.ModTime(), s.info.ModTime()); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ Could not set the mod time of %q: %v", s.targetPath, err)
+		}
+	}
+}
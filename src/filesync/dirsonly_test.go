@@ -0,0 +1,60 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFileSync_DirsOnly(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	writeTestFile(t, filepath.Join(src, "a", "b", "file.txt"), "data", old)
+	writeTestFile(t, filepath.Join(src, "c", "other.txt"), "data", old)
+	if err := os.Chmod(filepath.Join(src, "c"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"a/b", "a", "c"} {
+		if err := os.Chtimes(filepath.Join(src, dir), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An empty orphaned directory goes; target files stay
+	writeTestFile(t, filepath.Join(dst, "stray.txt"), "stray", old)
+	if err := os.MkdirAll(filepath.Join(dst, "gone"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileSync(src, dst, true, WithDirsOnly(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if stats.DirsCreated != 3 || stats.FilesCopied != 0 || stats.DirsDeleted != 1 || stats.FilesDeleted != 0 {
+		t.Errorf("stats = %+v, want 3 dirs created, 1 deleted and no files", stats)
+	}
+	for _, dir := range []string{"a/b", "a", "c"} {
+		info, err := os.Stat(filepath.Join(dst, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("%s mod time %v, want %v", dir, info.ModTime(), old)
+		}
+	}
+	if info, _ := os.Stat(filepath.Join(dst, "c")); runtime.GOOS != "windows" && info.Mode().Perm() != 0750 {
+		t.Errorf("c mode %o, want 0750", info.Mode().Perm())
+	}
+	for _, p := range []string{"a/b/file.txt", "c/other.txt", "gone"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be absent from target", p)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "stray.txt")); err != nil {
+		t.Errorf("stray.txt should be kept: %v", err)
+	}
+}
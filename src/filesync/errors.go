@@ -0,0 +1,95 @@
+package filesync
+
+import "fmt"
+
+// The per-file errors collected in Stats().Errors, and for
+// RepairMetadata in RepairReport.Errors, are of the types below, each
+// wrapping the underlying cause, so callers can tell them apart with
+// errors.As and still match the cause with errors.Is.
+
+// CopyError is a file that could not be copied from Src to Dst.
+type CopyError struct {
+	Src, Dst string
+	Err      error
+}
+
+func (e *CopyError) Error() string { return fmt.Sprintf("copy %s → %s: %v", e.Src, e.Dst, e.Err) }
+func (e *CopyError) Unwrap() error { return e.Err }
+
+// CompareError is a source file that could not be compared with its
+// target copy at Dst.
+type CompareError struct {
+	Src, Dst string
+	Err      error
+}
+
+func (e *CompareError) Error() string {
+	return fmt.Sprintf("compare %s with %s: %v", e.Src, e.Dst, e.Err)
+}
+func (e *CompareError) Unwrap() error { return e.Err }
+
+// DeleteError is an entry that could not be removed.
+type DeleteError struct {
+	Path string
+	Err  error
+}
+
+func (e *DeleteError) Error() string { return fmt.Sprintf("delete %s: %v", e.Path, e.Err) }
+func (e *DeleteError) Unwrap() error { return e.Err }
+
+// MkdirError is a target directory that could not be created.
+type MkdirError struct {
+	Path string
+	Err  error
+}
+
+func (e *MkdirError) Error() string { return fmt.Sprintf("mkdir %s: %v", e.Path, e.Err) }
+func (e *MkdirError) Unwrap() error { return e.Err }
+
+// MetadataError is a target entry whose mode, owner or mod time could
+// not be set by RepairMetadata.
+type MetadataError struct {
+	Path string
+	Err  error
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("repair metadata of %s: %v", e.Path, e.Err)
+}
+func (e *MetadataError) Unwrap() error { return e.Err }
+
+// ValidationError is a copied file at Path that the WithValidate hook
+// rejected. Removed reports whether the target copy was deleted again,
+// rather than kept as WithKeepInvalid asks.
+type ValidationError struct {
+	Path    string
+	Removed bool
+	Err     error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Removed {
+		return fmt.Sprintf("validate %s (removed): %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("validate %s (kept): %v", e.Path, e.Err)
+}
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// StatError is an entry whose file info could not be read.
+type StatError struct {
+	Path string
+	Err  error
+}
+
+func (e *StatError) Error() string { return fmt.Sprintf("stat %s: %v", e.Path, e.Err) }
+func (e *StatError) Unwrap() error { return e.Err }
+
+// WalkError is an entry a directory walk could not access; anything
+// below it was skipped.
+type WalkError struct {
+	Path string
+	Err  error
+}
+
+func (e *WalkError) Error() string { return fmt.Sprintf("walk %s: %v", e.Path, e.Err) }
+func (e *WalkError) Unwrap() error { return e.Err }
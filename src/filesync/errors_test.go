@@ -0,0 +1,88 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_TypedErrors(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "update.txt"), "new", time.Now())
+	writeTestFile(t, filepath.Join(dst, "update.txt"), "old", time.Now().Add(-time.Hour))
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", time.Now())
+	for _, name := range []string{"update.txt", "orphan.txt"} {
+		if err := os.Chmod(filepath.Join(dst, name), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := NewFileSync(src, dst, true, WithTargetFS(strictFS{LocalFS()}))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	err := fs.Stats().Err()
+
+	var copyErr *CopyError
+	if !errors.As(err, &copyErr) {
+		t.Fatalf("expected a CopyError in %v", err)
+	}
+	if copyErr.Src != filepath.Join(src, "update.txt") || copyErr.Dst != filepath.Join(dst, "update.txt") {
+		t.Errorf("CopyError = %+v", copyErr)
+	}
+	var deleteErr *DeleteError
+	if !errors.As(err, &deleteErr) || deleteErr.Path != filepath.Join(dst, "orphan.txt") {
+		t.Errorf("expected a DeleteError for orphan.txt in %v", err)
+	}
+	// The cause is still reachable
+	if !errors.Is(copyErr, os.ErrPermission) {
+		t.Errorf("CopyError does not wrap the permission error: %v", copyErr)
+	}
+	var walkErr *WalkError
+	if errors.As(err, &walkErr) {
+		t.Errorf("unexpected WalkError %v", walkErr)
+	}
+}
+
+func TestFileSync_MaxErrors(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+		writeTestFile(t, filepath.Join(src, name), name, time.Now())
+	}
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", time.Now())
+	failing := errors.New("disk on fire")
+	var calls int
+	hook := func(src, dst string, info os.FileInfo) (bool, error) {
+		calls++
+		return false, failing
+	}
+
+	fs := NewFileSync(src, dst, true, WithBeforeCopy(hook), WithMaxErrors(2))
+	err := fs.SyncDirs()
+	if !errors.Is(err, ErrTooManyErrors) || !errors.Is(err, failing) {
+		t.Fatalf("SyncDirs() = %v, want ErrTooManyErrors with the aggregate", err)
+	}
+	if calls != 2 || len(fs.Stats().Errors) != 2 {
+		t.Errorf("%d hook calls and %d errors, want 2 each", calls, len(fs.Stats().Errors))
+	}
+	// Nothing is deleted after the abort
+	if got := readTestFile(t, filepath.Join(dst, "orphan.txt")); got != "orphan" {
+		t.Errorf("orphan.txt = %q after the abort", got)
+	}
+
+	// Without a limit, every file is tried
+	calls = 0
+	fs = NewFileSync(src, dst, false, WithBeforeCopy(hook), WithMaxErrors(0))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 5 {
+		t.Errorf("%d hook calls without a limit, want 5", calls)
+	}
+}
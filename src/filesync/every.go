@@ -0,0 +1,75 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// SyncEvery runs SyncDirs, then again every interval, until ctx is
+// done, as a lighter alternative to Watch for periodic mirroring. A
+// tick that comes while the previous run is still going is skipped
+// rather than queued, so runs never overlap or pile up. Each run is
+// logged with a separator and its own summary; a failed run is logged
+// too and the next tick tries again. When ctx is done, a run in
+// progress is allowed to finish, unless it is paused (see Pause), and
+// SyncEvery returns nil.
+func (fs *FileSync) SyncEvery(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("the sync interval must be positive")
+	}
+	stop, err := fs.serveStatus()
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	fs.runCtx = ctx
+	defer func() { fs.runCtx = nil }()
+	done := make(chan error, 1)
+	run := 0
+	var started time.Time
+	start := func() {
+		run++
+		started = time.Now()
+		log.Printf("──────── Run %d at %s ────────", run, started.Format(time.RFC3339))
+		go func() { done <- fs.SyncDirs() }()
+	}
+	finish := func(err error) {
+		stats := fs.Stats()
+		if err != nil {
+			log.Printf("❌ Run %d failed after %s: %v", run, time.Since(started).Round(time.Millisecond), err)
+			return
+		}
+		log.Printf("🔁 Run %d finished in %s: %d copied, %d deleted, %d skipped, %d error(s)",
+			run, time.Since(started).Round(time.Millisecond), stats.FilesCopied, stats.FilesDeleted, stats.FilesSkipped, len(stats.Errors))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	start()
+	running := true
+	for {
+		select {
+		case <-ctx.Done():
+			if running {
+				log.Printf("⏳ Stopping after run %d finishes", run)
+				finish(<-done)
+			}
+			return nil
+
+		case err := <-done:
+			running = false
+			finish(err)
+
+		case <-ticker.C:
+			if running {
+				log.Printf("⏭️ Run %d is still in progress, skipping this tick", run)
+				continue
+			}
+			start()
+			running = true
+		}
+	}
+}
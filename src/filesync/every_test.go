@@ -0,0 +1,83 @@
+package filesync
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_SyncEvery(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", old)
+
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	fs := NewFileSync(src, dst, false)
+	go func() { done <- fs.SyncEvery(ctx, 20*time.Millisecond) }()
+
+	// A file added between runs is picked up by a later one
+	time.Sleep(30 * time.Millisecond)
+	writeTestFile(t, filepath.Join(src, "b.txt"), "b", old)
+	time.Sleep(80 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("SyncEvery() = %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if got := readTestFile(t, filepath.Join(dst, name)); got != strings.TrimSuffix(name, ".txt") {
+			t.Errorf("%s = %q", name, got)
+		}
+	}
+	if n := strings.Count(logs.String(), "🔁 Run "); n < 2 {
+		t.Errorf("%d run(s) logged a summary, want at least 2:\n%s", n, logs.String())
+	}
+}
+
+func TestFileSync_SyncEverySkipsBusyTicks(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for _, name := range []string{"/src/a.txt", "/src/b.txt", "/src/c.txt"} {
+		if err := mem.WriteFile(name, []byte(name), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slow := &slowFS{MemFS: mem, latency: 20 * time.Millisecond}
+
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(slow), WithTargetFS(mem))
+	if err := fs.SyncEvery(ctx, 5*time.Millisecond); err != nil {
+		t.Fatalf("SyncEvery() = %v", err)
+	}
+	if !strings.Contains(logs.String(), "skipping this tick") {
+		t.Errorf("no tick was skipped while a run was going:\n%s", logs.String())
+	}
+	// The run in progress when ctx ended was allowed to finish
+	if slow.inFlight.Load() != 0 {
+		t.Error("SyncEvery returned with a run still in progress")
+	}
+	if n := strings.Count(logs.String(), "──────── Run "); n != strings.Count(logs.String(), "🔁 Run ") {
+		t.Errorf("%d run(s) started but not all finished:\n%s", n, logs.String())
+	}
+	if _, err := mem.ReadFile("/dst/c.txt"); err != nil {
+		t.Errorf("the last run did not finish: %v", err)
+	}
+	if err := fs.SyncEvery(ctx, 0); err == nil {
+		t.Error("SyncEvery with a zero interval should fail")
+	}
+}
@@ -0,0 +1,38 @@
+package filesync_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"filesync"
+)
+
+// A FileSync can run entirely in memory, which keeps tests of code
+// built on it fast and free of temporary directories.
+func ExampleMemFS() {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	mem := filesync.NewMemFS()
+	mem.WriteFile("/src/docs/readme.txt", []byte("hello"), time.Now())
+	mem.WriteFile("/dst/obsolete.txt", []byte("bye"), time.Now())
+
+	fs := filesync.NewFileSync("/src", "/dst", true,
+		filesync.WithSourceFS(mem), filesync.WithTargetFS(mem))
+	if err := fs.SyncDirs(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	data, _ := mem.ReadFile("/dst/docs/readme.txt")
+	fmt.Printf("readme: %s\n", data)
+	_, err := mem.Stat("/dst/obsolete.txt")
+	fmt.Println("obsolete removed:", err != nil)
+	fmt.Println("copied:", fs.Stats().FilesCopied, "deleted:", fs.Stats().FilesDeleted)
+	// Output:
+	// readme: hello
+	// obsolete removed: true
+	// copied: 1 deleted: 1
+}
@@ -0,0 +1,78 @@
+package filesync
+
+import (
+	"errors"
+	"log"
+)
+
+// copyFileFlags gives the local target file dst the immutable and
+// append-only flags of src with WithFileFlags. It must be the last
+// change to dst, after the final rename of an atomic copy too, since
+// either flag makes the file refuse writes, new times and renames.
+// Setting the flags needs privileges; without them, they are handled
+// as unsupported by metaUnsupported.
+func (fs *FileSync) copyFileFlags(src, dst string) error {
+	if !fs.fileFlags || fs.metaDenied(metaFlags) {
+		return nil
+	}
+	want, err := fileFlags(src)
+	if errors.Is(err, errors.ErrUnsupported) {
+		// The source's filesystem has none to copy
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	have, err := fileFlags(dst)
+	if err == nil && have&preservedFlags != want&preservedFlags {
+		err = setFileFlags(dst, have&^preservedFlags|want&preservedFlags)
+	}
+	return fs.metaUnsupported(metaFlags, err)
+}
+
+// clearFileFlags lifts the immutable and append-only flags from the
+// local target file dst before a copy is written over it with
+// WithFileFlags; copyFileFlags puts them back once the copy is done,
+// and the returned restore puts the old ones back if the copy fails
+// instead. A missing dst, or one without the flags, is left alone, and
+// flags that cannot be lifted are handled like copyFileFlags handles
+// flags it cannot set.
+func (fs *FileSync) clearFileFlags(dst string) (restore func(), err error) {
+	restore = func() {}
+	if !fs.fileFlags || fs.metaDenied(metaFlags) || !fs.localCopy(fs.tgtFS) {
+		return restore, nil
+	}
+	have, err := fileFlags(dst)
+	if err != nil || have&preservedFlags == 0 {
+		return restore, nil
+	}
+	if err := fs.metaUnsupported(metaFlags, setFileFlags(dst, have&^preservedFlags)); err != nil || fs.metaDenied(metaFlags) {
+		return restore, err
+	}
+	return func() {
+		if err := setFileFlags(dst, have); err != nil {
+			log.Printf("❌ Failed to restore the file flags of %q: %v", dst, err)
+		}
+	}, nil
+}
+
+// sameFileFlags reports whether the local files srcPath and tgtPath
+// carry the same immutable and append-only flags. A side whose
+// filesystem cannot hold them counts as matching.
+func sameFileFlags(srcPath, tgtPath string) (bool, error) {
+	src, err := fileFlags(srcPath)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	tgt, err := fileFlags(tgtPath)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return src&preservedFlags == tgt&preservedFlags, nil
+}
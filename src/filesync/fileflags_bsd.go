@@ -0,0 +1,47 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// The file flags chflags sets as uchg, uappnd, schg and sappnd, from
+// sys/stat.h, which agree across the BSDs.
+const (
+	ufImmutable = 0x2
+	ufAppend    = 0x4
+	sfImmutable = 0x20000
+	sfAppend    = 0x40000
+)
+
+// preservedFlags are the flags WithFileFlags copies: the user flags,
+// which the owner may set, and the system ones, which need root.
+const preservedFlags = ufImmutable | ufAppend | sfImmutable | sfAppend
+
+// fileFlags returns the file flags of path, as ls -lO shows them.
+func fileFlags(path string) (uint32, error) {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return 0, &os.PathError{Op: "lstat", Path: path, Err: err}
+	}
+	return st.Flags, nil
+}
+
+// setFileFlags replaces the file flags of path. Errors for a lack of
+// privilege and for filesystems without flags wrap
+// errors.ErrUnsupported.
+func setFileFlags(path string, flags uint32) error {
+	err := unix.Chflags(path, int(flags))
+	if errors.Is(err, unix.EPERM) || errors.Is(err, unix.EOPNOTSUPP) {
+		return fmt.Errorf("%w: %s: %v", errors.ErrUnsupported, path, err)
+	}
+	if err != nil {
+		return &os.PathError{Op: "chflags", Path: path, Err: err}
+	}
+	return nil
+}
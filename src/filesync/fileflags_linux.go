@@ -0,0 +1,54 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// The inode flags chattr sets with +i and +a, from linux/fs.h.
+const (
+	fsImmutableFlag = 0x10
+	fsAppendFlag    = 0x20
+)
+
+// preservedFlags are the flags WithFileFlags copies.
+const preservedFlags = fsImmutableFlag | fsAppendFlag
+
+// fileFlags returns the inode flags of path, as lsattr shows them.
+// Errors for filesystems without flags wrap errors.ErrUnsupported.
+func fileFlags(path string) (uint32, error) {
+	var flags uint32
+	err := withFlagsFd(path, func(fd int) (err error) {
+		flags, err = unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+		return err
+	})
+	return flags, err
+}
+
+// setFileFlags replaces the inode flags of path. Changing the
+// immutable or append-only flag needs CAP_LINUX_IMMUTABLE; errors for
+// its lack and for filesystems without flags wrap
+// errors.ErrUnsupported.
+func setFileFlags(path string, flags uint32) error {
+	return withFlagsFd(path, func(fd int) error {
+		return unix.IoctlSetPointerInt(fd, unix.FS_IOC_SETFLAGS, int(flags))
+	})
+}
+
+// withFlagsFd opens path for the flags ioctls, which work on a
+// read-only descriptor even for an immutable file.
+func withFlagsFd(path string, f func(fd int) error) error {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer unix.Close(fd)
+	err = f(fd)
+	if errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EPERM) {
+		return fmt.Errorf("%w: %s: %v", errors.ErrUnsupported, path, err)
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_FileFlags(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "locked.conf"), "v1", time.Now())
+	writeTestFile(t, filepath.Join(src, "audit.log"), "entries", time.Now())
+
+	// Immutable and append-only files cannot be removed, so lift the
+	// flags before the temporary directory is cleaned up
+	t.Cleanup(func() {
+		filepath.Walk(tmp, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				setPreservedFlags(path, 0)
+			}
+			return nil
+		})
+	})
+	if err := setPreservedFlags(filepath.Join(src, "locked.conf"), fsImmutableFlag); err != nil {
+		t.Skipf("cannot set file flags here: %v", err)
+	}
+	if err := setPreservedFlags(filepath.Join(src, "audit.log"), fsAppendFlag); err != nil {
+		t.Fatal(err)
+	}
+
+	sync := func(opts ...Option) *FileSync {
+		t.Helper()
+		fs := NewFileSync(src, dst, false, append([]Option{WithFileFlags(true)}, opts...)...)
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Stats().Err(); err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+	wantFlags := func(name string, want uint32) {
+		t.Helper()
+		if got, err := fileFlags(filepath.Join(dst, name)); err != nil || got&preservedFlags != want {
+			t.Errorf("%s flags = %#x, %v; want %#x", name, got&preservedFlags, err, want)
+		}
+	}
+
+	sync()
+	wantFlags("locked.conf", fsImmutableFlag)
+	wantFlags("audit.log", fsAppendFlag)
+
+	// Flags that differ alone bring a recopy
+	if err := setPreservedFlags(filepath.Join(dst, "audit.log"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if fs := sync(); fs.Stats().FilesCopied != 1 {
+		t.Errorf("FilesCopied = %d, want 1 for the lost flag", fs.Stats().FilesCopied)
+	}
+	wantFlags("audit.log", fsAppendFlag)
+
+	// A new version replaces the immutable copy, in place and renamed
+	// over it, and is immutable again afterwards
+	for i, atomic := range []bool{false, true} {
+		path := filepath.Join(src, "locked.conf")
+		setPreservedFlags(path, 0)
+		writeTestFile(t, path, "version "+string(rune('2'+i)), time.Now().Add(time.Duration(i+1)*time.Hour))
+		if err := setPreservedFlags(path, fsImmutableFlag); err != nil {
+			t.Fatal(err)
+		}
+		sync(WithAtomicCopy(atomic))
+		if data, err := os.ReadFile(filepath.Join(dst, "locked.conf")); err != nil || string(data) != "version "+string(rune('2'+i)) {
+			t.Errorf("atomic %v: locked.conf = %q, %v", atomic, data, err)
+		}
+		wantFlags("locked.conf", fsImmutableFlag)
+	}
+}
+
+// setPreservedFlags sets the preserved flags of path to flags, keeping
+// the others, such as ext4's extents flag, which cannot be cleared.
+func setPreservedFlags(path string, flags uint32) error {
+	have, err := fileFlags(path)
+	if err != nil {
+		return err
+	}
+	return setFileFlags(path, have&^preservedFlags|flags)
+}
+
+func TestFileSync_FileFlagsFailedCopy(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "locked.conf"), "v2", time.Now())
+	writeTestFile(t, filepath.Join(dst, "locked.conf"), "v1", time.Now().Add(-time.Hour))
+	t.Cleanup(func() { setPreservedFlags(filepath.Join(dst, "locked.conf"), 0) })
+	if err := setPreservedFlags(filepath.Join(dst, "locked.conf"), fsImmutableFlag); err != nil {
+		t.Skipf("cannot set file flags here: %v", err)
+	}
+
+	// The source is gone by the time it is copied, so the copy fails
+	// after the target's flags were lifted
+	vanish := WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+		return true, os.Remove(src)
+	})
+	fs := NewFileSync(src, dst, false, WithFileFlags(true), vanish)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.Stats().Errors) != 1 {
+		t.Errorf("Errors = %v, want the failed copy", fs.Stats().Errors)
+	}
+	if got, err := fileFlags(filepath.Join(dst, "locked.conf")); err != nil || got&preservedFlags != fsImmutableFlag {
+		t.Errorf("locked.conf flags = %#x, %v; want immutable again", got&preservedFlags, err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package filesync
+
+import "errors"
+
+// preservedFlags is empty where files carry no such flags.
+const preservedFlags = 0
+
+// fileFlags reports that files carry no flags here.
+func fileFlags(path string) (uint32, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// setFileFlags reports that files carry no flags here.
+func setFileFlags(path string, flags uint32) error {
+	return errors.ErrUnsupported
+}
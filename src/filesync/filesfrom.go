@@ -0,0 +1,142 @@
+package filesync
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SyncPaths runs one sync limited to the given paths, relative to the
+// source roots, like rsync's --files-from: a listed file is synced on
+// its own, a listed directory with everything below it, and the
+// parent directories are created as needed. The rest of the source
+// tree is not looked at, and delete-missing only removes orphans
+// below the listed directories. A listed path that exists in no
+// source is logged and recorded in Stats().Errors as a *StatError
+// wrapping os.ErrNotExist; the others are still synced. Absolute
+// paths and paths leaving the root are rejected before anything is
+// done. Snapshots, directory swaps and two-way sync need the whole
+// tree and cannot be combined with it.
+func (fs *FileSync) SyncPaths(paths []string) error {
+	return fs.syncPaths(paths, nil)
+}
+
+// SyncSubtree runs one sync of the source directory relPath, relative
+// to the source roots, into the same place below the target, when only
+// that area is known to have changed: nothing outside it is walked or
+// compared, and delete-missing only removes orphans inside it. A
+// subtree that no source has any more is removed from the target with
+// delete-missing, and is an error without it. A source root that is
+// itself missing, such as an unmounted volume, fails the sync with a
+// *StatError before anything is removed. It is SyncPaths with a single
+// directory, with the same restrictions.
+func (fs *FileSync) SyncSubtree(relPath string) error {
+	rel, err := listedPath(relPath)
+	if err != nil {
+		return err
+	}
+	if err := fs.connect(); err != nil {
+		return err
+	}
+	trees := fs.sourceTrees()
+	for _, tree := range trees {
+		if tree.present {
+			continue
+		}
+		if _, err := tree.fsys.Stat(tree.root); err != nil {
+			return &StatError{Path: tree.root, Err: err}
+		}
+	}
+	for _, tree := range trees {
+		if !tree.holds(rel) {
+			continue
+		}
+		info, err := tree.fsys.Stat(filepath.Join(tree.root, rel))
+		switch {
+		case err == nil && !info.IsDir():
+			return fmt.Errorf("subtree %q is not a directory", relPath)
+		case err == nil:
+			return fs.syncPaths([]string{relPath}, nil)
+		case !os.IsNotExist(err):
+			return &StatError{Path: filepath.Join(tree.root, rel), Err: err}
+		}
+	}
+	if !fs.deleteMissing {
+		return fmt.Errorf("subtree %q: %w", relPath, os.ErrNotExist)
+	}
+	return fs.syncPaths([]string{relPath}, map[string]bool{rel: true})
+}
+
+// syncPaths is SyncPaths, where the paths in gone are expected to be
+// missing from the sources: they are only there for delete-missing to
+// remove their target counterparts, and not reported.
+func (fs *FileSync) syncPaths(paths []string, gone map[string]bool) error {
+	if fs.snapshot || fs.swap || fs.bidirectional {
+		return errors.New("a path list cannot be synced with snapshots, directory swaps or two-way sync")
+	}
+	pending := map[string]bool{}
+	for _, p := range paths {
+		rel, err := listedPath(p)
+		if err != nil {
+			return err
+		}
+		pending[rel] = true
+	}
+	if err := fs.connect(); err != nil {
+		return err
+	}
+
+	trees := fs.sourceTrees()
+	var scopes, missing []string
+	for _, scope := range collapseScopes(pending) {
+		if scope != "." && !gone[scope] && missingEverywhere(trees, scope) {
+			missing = append(missing, scope)
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+
+	stop, err := fs.serveStatus()
+	if err != nil {
+		return err
+	}
+	defer stop()
+	err = fs.syncScopes(scopes)
+	for _, rel := range missing {
+		path := filepath.Join(fs.strippedRoot(fs.source), rel)
+		log.Printf("❌ Listed path not found in any source: %q", path)
+		fs.recordError(&StatError{Path: path, Err: os.ErrNotExist})
+	}
+	return err
+}
+
+// listedPath cleans the path p listed for SyncPaths, relative to the
+// source roots, and rejects absolute paths and ones leaving the root.
+func listedPath(p string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(p))
+	if filepath.IsAbs(rel) || strings.HasPrefix(filepath.ToSlash(p), "/") || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("listed path %q is not inside the source", p)
+	}
+	return rel, nil
+}
+
+// ReadPathList reads a list of relative paths for SyncPaths from r,
+// one per line. Blank lines and lines starting with # are skipped, and
+// surrounding whitespace is trimmed.
+func ReadPathList(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	return paths, scanner.Err()
+}
@@ -0,0 +1,137 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_SyncPaths(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modtime := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "docs", "deep", "a.txt"), "a", modtime)
+	writeTestFile(t, filepath.Join(src, "docs", "other.txt"), "other", modtime)
+	writeTestFile(t, filepath.Join(src, "photos", "p.jpg"), "p", modtime)
+	writeTestFile(t, filepath.Join(src, "photos", "q.jpg"), "q", modtime)
+	writeTestFile(t, filepath.Join(dst, "photos", "orphan.jpg"), "orphan", modtime)
+	writeTestFile(t, filepath.Join(dst, "unlisted.txt"), "keep", modtime)
+
+	fs := NewFileSync(src, dst, true)
+	err := fs.SyncPaths([]string{"docs/deep/a.txt", "photos/", "missing.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"docs/deep/a.txt", "photos/p.jpg", "photos/q.jpg", "unlisted.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"docs/other.txt", "photos/orphan.jpg"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("%s exists, want it not synced or deleted", name)
+		}
+	}
+
+	stats := fs.Stats()
+	if stats.FilesCopied != 3 || stats.FilesDeleted != 1 {
+		t.Errorf("copied %d, deleted %d files, want 3 and 1", stats.FilesCopied, stats.FilesDeleted)
+	}
+	var statErr *StatError
+	if len(stats.Errors) != 1 || !errors.As(stats.Errors[0], &statErr) || !errors.Is(statErr, os.ErrNotExist) {
+		t.Fatalf("Errors = %v, want one not-exist error for missing.txt", stats.Errors)
+	}
+	if !strings.HasSuffix(statErr.Path, "missing.txt") {
+		t.Errorf("error for %s, want missing.txt", statErr.Path)
+	}
+}
+
+func TestFileSync_SyncPathsRejectsOutside(t *testing.T) {
+	tmp := t.TempDir()
+	fs := NewFileSync(filepath.Join(tmp, "src"), filepath.Join(tmp, "dst"), false)
+	for _, p := range []string{"../etc/passwd", "/etc/passwd"} {
+		if err := fs.SyncPaths([]string{p}); err == nil {
+			t.Errorf("SyncPaths(%q) succeeded, want an error", p)
+		}
+	}
+}
+
+func TestFileSync_SyncSubtree(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modtime := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "site", "blog", "post.html"), "post", modtime)
+	writeTestFile(t, filepath.Join(src, "site", "blog", "drafts", "d.html"), "draft", modtime)
+	writeTestFile(t, filepath.Join(src, "site", "index.html"), "index", modtime)
+	writeTestFile(t, filepath.Join(src, "gone", "old.html"), "old", modtime)
+	// Orphans inside and outside the subtree, including in a sibling
+	// sharing its name as a prefix
+	writeTestFile(t, filepath.Join(dst, "site", "blog", "orphan.html"), "orphan", modtime)
+	writeTestFile(t, filepath.Join(dst, "site", "blog", "drafts", "orphan.html"), "orphan", modtime)
+	writeTestFile(t, filepath.Join(dst, "site", "blog-old", "keep.html"), "keep", modtime)
+	writeTestFile(t, filepath.Join(dst, "site", "keep.html"), "keep", modtime)
+	writeTestFile(t, filepath.Join(dst, "keep.txt"), "keep", modtime)
+
+	fs := NewFileSync(src, dst, true)
+	if err := fs.SyncSubtree("site/blog"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"site/blog/post.html", "site/blog/drafts/d.html", "site/blog-old/keep.html", "site/keep.html", "keep.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"site/blog/orphan.html", "site/blog/drafts/orphan.html", "site/index.html", "gone/old.html"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("%s exists, want it not synced or deleted", name)
+		}
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 2 || stats.FilesDeleted != 2 || len(stats.Errors) != 0 {
+		t.Errorf("copied %d, deleted %d files with %v, want 2 and 2", stats.FilesCopied, stats.FilesDeleted, stats.Errors)
+	}
+
+	// A subtree gone from the source is removed with delete-missing only
+	writeTestFile(t, filepath.Join(dst, "archive", "a.html"), "a", modtime)
+	if err := NewFileSync(src, dst, false).SyncSubtree("archive"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("SyncSubtree of a missing subtree = %v, want os.ErrNotExist", err)
+	}
+	if err := NewFileSync(src, dst, true).SyncSubtree("archive"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "archive", "a.html")); !os.IsNotExist(err) {
+		t.Error("expected the vanished subtree's files to be deleted")
+	}
+
+	// A missing source root is not taken for a vanished subtree
+	var statErr *StatError
+	if err := NewFileSync(filepath.Join(tmp, "unmounted"), dst, true).SyncSubtree("site/blog"); !errors.As(err, &statErr) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("SyncSubtree from a missing source = %v, want a *StatError wrapping os.ErrNotExist", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "site", "blog", "post.html")); err != nil {
+		t.Errorf("expected the target subtree to be left alone: %v", err)
+	}
+
+	for _, p := range []string{"site/index.html", "../elsewhere"} {
+		if err := fs.SyncSubtree(p); err == nil {
+			t.Errorf("SyncSubtree(%q) succeeded, want an error", p)
+		}
+	}
+}
+
+func TestReadPathList(t *testing.T) {
+	got, err := ReadPathList(strings.NewReader("a.txt\n\n# comment\n  dir/b.txt  \r\nphotos/\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt", "dir/b.txt", "photos/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadPathList = %v, want %v", got, want)
+	}
+}
@@ -1,10 +1,18 @@
 package filesync
 
 import (
-	"io"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // FileSync represents a one-way synchronization job
@@ -15,6 +23,239 @@ type FileSync struct {
 	source        string
 	target        string
 	deleteMissing bool
+
+	bidirectional    bool
+	conflictResolver ConflictResolver
+
+	snapshot     bool
+	prevSnapshot string // snapshot unchanged files are linked from
+
+	extraSources    []string
+	firstSourceWins bool
+
+	extraTargets []string
+	targetStats  map[string]Stats // of the last run, see AddTarget
+	tee          *teeHub          // shared source reads during a multi-target run
+	teeID        int              // this target's member of tee
+
+	// The arguments NewFileSync was called with, to set up the other
+	// targets alike
+	sourceArg string
+	opts      []Option
+
+	rsyncSlashes bool
+	nestSource   bool
+	namedSources []string // sources given without a trailing slash
+
+	deleteRetention    time.Duration
+	retentionRuns      int
+	retentionStatePath string
+	deleteOlderThan    time.Duration
+	dropGuard          float64 // see WithSourceDropGuard
+	forceDelete        bool
+
+	atomicCopy  bool
+	tempDir     string
+	resume      bool
+	preallocate bool
+	// smallFileSize is the size below which files are copied in one
+	// read and one write (see WithSmallFileThreshold)
+	smallFileSize int64
+
+	copyIgnoreFiles bool
+	checksum        bool
+
+	contentOnly       bool
+	compare           Comparison
+	keepModTimes      bool
+	checksumCache     bool
+	checksumCachePath string
+	mmapCompare       bool
+	hashAlgo          string // lowercased, see WithHashAlgorithm
+	verifyEvery       int
+	fullCheck         bool // this run compares contents, see WithPeriodicVerify
+	emptyPlaceholders bool
+	heartbeatEvery    int
+	deleteFirst       bool
+	deleteFirstPerDir bool
+	dirCleanup        *dirCleanup // of the copy pass, see WithDeleteFirstPerDir
+	streaming         bool
+	maxErrors         int
+	quickHash         int            // KiB hashed at each end, see WithQuickHash
+	checksums         *checksumCache // loaded while the cache is enabled
+	timeTolerance     time.Duration
+	clockSkew         time.Duration
+	clockCheck        time.Duration
+	clockCheckFail    bool
+	writeCheck        bool
+	modifiedSince     time.Time
+	accessedSince     time.Duration
+	accessFallback    bool         // count mod times as accesses, see WithAccessTimeFallback
+	excludeOwners     map[int]bool // uids skipped, see WithExcludeOwner
+	excludeGroups     map[int]bool // gids skipped, see WithExcludeGroup
+	trash             bool
+	deletePolicy      func(relPath string, info os.FileInfo) DeleteAction
+	preserveSymlinks  bool
+	followSymlinks    bool
+	followTargetLinks bool
+	excludes          []ignoreRule
+	includes          []ignoreRule // negated, applied after excludes
+	protects          []ignoreRule // target entries delete-missing keeps, see AddProtect
+	dirsOnly          bool
+	dirStamps         []dirStamp // see stampsDirs, applied after the walk
+	beforeCopy        func(src, dst string, info os.FileInfo) (bool, error)
+	validate          func(dst string) error
+	keepInvalid       bool
+	stripPrefix       string // synced from source/stripPrefix, see WithStripPrefix
+	requirePrefix     bool
+	pause             *pauseGate      // shared with reversed copies
+	runCtx            context.Context // of Watch, SyncEvery or SyncDirsContext, ends a paused run
+	syncCtx           context.Context // of SyncDirsContext, stops the run between files
+	fingerprintCmd    string
+	fingerprints      *fingerprintCache
+	preservePerms     bool
+	preserveOwner     bool
+	ownerDenied       bool // a chown failed this run, see copyOwner
+	acls              bool
+	fileCaps          bool
+	altStreams        bool
+	loadThrottle      *loadThrottle
+	fileFlags         bool
+	deniedMeta        metaFeature // copied metadata found unsupported this run, see metaUnsupported
+	dedup             bool
+	dedupIndex        map[int64][]*dedupEntry // this run's copies, by size
+	reportFile        string                  // written after each run when set
+
+	failOnAccessError bool
+	changedRetries    int
+	maxFiles          int // zero means no limit
+
+	spaceCheck   bool
+	spaceReserve int64
+	abortOnSpace bool
+
+	sizeCap int64 // zero means no cap, see WithTargetSizeCap
+	evict   bool
+
+	lock        bool
+	lockTimeout time.Duration
+
+	extensions   map[string]bool
+	shardIndex   int
+	shardCount   int
+	contentTypes []string // lowercased patterns, see WithContentTypes
+
+	contentMatch      *regexp.Regexp // see WithContentMatch
+	contentMatchBytes int
+
+	maxOpenFiles int
+	openSlots    chan struct{} // one per open source and target file pair, see WithMaxOpenFiles
+	maxPerDir    int
+	dirSlots     *dirSlots // nil without WithMaxPerDirectory
+
+	workers      int
+	autoWorkers  bool
+	contentRead  *atomic.Int64 // bytes read to hash or compare file contents
+	walkWorkers  int           // directories listed concurrently; one or less walks serially
+	planWorkers  int           // top-level entries Diff plans concurrently, and dry-run target lookups
+	planStats    *targetStats  // target lookups of a dry-run scan fetched ahead
+	diffModes    bool
+	dryRun       bool
+	updateOnly   bool
+	noDowngrade  bool
+	existingOnly bool
+
+	watchDebounce time.Duration
+	onWatchCycle  func(WatchCycle)
+
+	pruneEmptyDirs       bool
+	noEmptyDirs          bool
+	pruneSourceEmptyDirs bool
+	pendingDirs          map[string]bool // directories created with their first file
+
+	deletePreexistingOnly bool
+	preexisting           map[string]targetEntry // target before the run, see WithDeletePreexistingOnly
+
+	detectRenames bool
+	renamedFrom   map[string]bool // orphans moved this run, see WithDetectRenames
+
+	pathMapper func(relPath string, info os.FileInfo) string
+	mapped     map[string]bool // target paths mapped to in this run, see WithPathMapper
+	unmapped   bool            // a source file could not be mapped in this run
+
+	manifestPath    string
+	manifestCompare bool
+	manifest        *manifest // loaded while a manifest is configured
+
+	cas bool
+
+	xattrs  bool
+	reflink bool
+	force   bool
+
+	preserveBirthTime bool
+
+	rateLimit    int64 // bytes per second, see WithRateLimit
+	rateSchedule []RateWindow
+	limiter      *rateLimiter // nil without a limit
+
+	oneFileSystem bool
+	foldCaseOrder bool
+	copyOrder     CopyOrder
+
+	splitSize int64 // split target files larger than this; zero never
+	joinParts bool
+
+	skipLocked bool
+
+	permissionsFrom string
+	refPerms        *refPerms // loaded per run from permissionsFrom
+	modeRules       []modeRule
+
+	treeHash bool
+
+	specialFiles bool
+
+	swap bool
+
+	metrics   *metricsBoard // shared with reversed copies
+	onMetrics func(Metrics)
+
+	journal   bool
+	journaled *journal // open while a journaled sync runs
+
+	checkpoint      bool
+	checkpointPath  string // empty for target/.filesync-journal
+	checkpointFiles int    // entries buffered before a flush
+	checkpointEvery time.Duration
+
+	fileMode os.FileMode // zero keeps the default mode
+	dirMode  os.FileMode // zero keeps the default mode
+
+	srcFS       FS            // filesystem holding the sources
+	tgtFS       FS            // filesystem holding the target
+	sftpSource  *sftpEndpoint // dialed into srcFS on first use
+	sftpTarget  *sftpEndpoint // dialed into tgtFS on first use
+	connections []*SFTPFS     // sessions opened by FileSync itself
+
+	transforms  map[string]TransformFunc // by normalized extension
+	transformed *transformState          // loaded while transforms are registered
+
+	onProgress  func(Progress)
+	progress    *progressTracker // set while copyJobs runs
+	onHash      func(HashProgress)
+	hashCtx     context.Context // of Verify, stops hashing between chunks
+	statusAddr  string
+	statusBoard *statusBoard // set while the status server runs
+	profile     bool
+
+	stats       Stats
+	actions     []Action
+	planSources map[string]planSource // by relative path, in dry-run mode
+
+	tracePath string       // see WithTrace
+	trace     *tracer      // the trace of the current run, nil without WithTrace
+	spans     *spanTracing // see WithSpanTracer
 }
 
 // NewFileSync constructs a FileSync instance.
@@ -24,12 +265,48 @@ type FileSync struct {
 //   - target: directory path to copy files into
 //   - deleteMissing: whether to remove files from target
 //     if they don’t exist in source
-func NewFileSync(source, target string, deleteMissing bool) *FileSync {
-	return &FileSync{
-		source:        source,
-		target:        target,
+//   - opts: optional settings such as WithDeleteRetention
+//
+// By default the contents of source are synced into target. With
+// WithNestSourceDir the source directory itself is, into
+// target/<base name of source>. Both paths are cleaned, so trailing
+// slashes, repeated separators and "." or ".." elements make no
+// difference, unless WithRsyncSlashes decides between the two by a
+// trailing slash on the source, as rsync does.
+func NewFileSync(source, target string, deleteMissing bool, opts ...Option) *FileSync {
+	fs := &FileSync{
+		source:        filepath.Clean(source),
+		target:        filepath.Clean(target),
 		deleteMissing: deleteMissing,
+		watchDebounce: defaultWatchDebounce,
+		smallFileSize: defaultSmallFileSize,
+		srcFS:         osFS{},
+		tgtFS:         osFS{},
+		metrics:       &metricsBoard{},
+		pause:         &pauseGate{},
+		contentRead:   &atomic.Int64{},
+		sourceArg:     source,
+		opts:          opts,
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	fs.openSlots = newOpenSlots(fs.maxOpenFiles)
+	fs.dirSlots = newDirSlots(fs.maxPerDir)
+	fs.limiter = newRateLimiter(fs.rateLimit, fs.rateSchedule)
+	if !hasTrailingSlash(source) {
+		fs.namedSources = append(fs.namedSources, fs.source)
+	}
+	if fs.nestSource || fs.rsyncSlashes && !hasTrailingSlash(source) {
+		fs.target = filepath.Join(fs.target, filepath.Base(fs.source))
 	}
+	return fs
+}
+
+// hasTrailingSlash reports whether path ends in a separator (or in
+// "/."), which rsync reads as "the contents of" the directory.
+func hasTrailingSlash(path string) bool {
+	return len(path) > 1 && os.IsPathSeparator(path[len(path)-1]) || filepath.Base(path) == "."
 }
 
 // SyncDirs synchronizes the contents of source → target.
@@ -37,144 +314,1306 @@ func NewFileSync(source, target string, deleteMissing bool) *FileSync {
 // Behavior:
 //  1. Walks the source directory.
 //  2. Creates missing directories in target.
-//  3. Copies new or updated files into target.
-//  4. Optionally deletes files/dirs in target
+//  3. Compares files with their target counterparts,
+//     using a bounded pool of workers (see WithWorkers).
+//  4. Copies new or updated files into target, in walk order.
+//     Entries whose type changed (file ↔ directory) are removed
+//     from target first and recreated with the source's type.
+//  5. Optionally deletes files/dirs in target
 //     that do not exist in source (if deleteMissing is set).
+//  6. Optionally removes directories left empty in target
+//     (see WithPruneEmptyDirs).
+//
+// In dry-run mode (see WithDryRun) the same decisions are made
+// but nothing is written; PlannedActions lists what would change
+// and Stats counts it as if it had happened.
 //
 // Returns an error only if the initial directory walk fails
 // or if target cleanup encounters issues; per-file errors
-// are logged but do not stop the process.
+// are logged but do not stop the process. They are collected
+// in Stats().Errors, so Stats().Err() gives the aggregate. With
+// WithFailOnAccessError, a source entry that cannot be
+// read stops the sync and its error is returned instead. With
+// WithMaxErrors, the sync stops once that many per-file errors were
+// collected, and ErrTooManyErrors is returned with them.
+// With WithLock, ErrLocked is returned if another sync holds the
+// target for longer than the lock timeout. With WithSwap, an error
+// is also returned when per-file errors kept the new tree from being
+// swapped in.
 func (fs *FileSync) SyncDirs() error {
+	stop, err := fs.serveStatus()
+	if err != nil {
+		return err
+	}
+	defer stop()
+	if fs.swap {
+		return fs.syncSwapped()
+	}
+	return fs.syncScopes([]string{"."})
+}
+
+// SyncDirsContext is SyncDirs, stopped early when ctx is done, e.g. on
+// a signal. The file being copied is finished first, so with
+// WithAtomicCopy no torn copy is left in the target, and the run then
+// ends with ctx's error, before deleting anything. Stats covers the
+// work done until then, and with WithJournal the next run resumes
+// where this one stopped.
+func (fs *FileSync) SyncDirsContext(ctx context.Context) error {
+	fs.syncCtx = ctx
+	defer func() { fs.syncCtx = nil }()
+	if fs.runCtx == nil {
+		// A paused run is abandoned too
+		fs.runCtx = ctx
+		defer func() { fs.runCtx = nil }()
+	}
+	return fs.SyncDirs()
+}
+
+// interrupted returns the error of the SyncDirsContext context once it
+// is done, or ErrTooManyErrors once WithMaxErrors is reached, and nil
+// otherwise.
+func (fs *FileSync) interrupted() error {
+	if err := fs.errorLimit(); err != nil {
+		return err
+	}
+	if fs.syncCtx == nil {
+		return nil
+	}
+	return fs.syncCtx.Err()
+}
+
+// syncScopes runs one sync limited to the given relative paths, with
+// "." meaning the whole tree. Scopes that exist in no source are only
+// handled by the delete pass.
+func (fs *FileSync) syncScopes(scopes []string) (err error) {
+	if len(fs.extraTargets) > 0 && fs.tee == nil {
+		return fs.syncTargets(scopes)
+	}
+	endSpan := fs.startRunSpan()
+	defer func() { endSpan(err) }()
+	if err := fs.connect(); err != nil {
+		return err
+	}
+	release, err := fs.acquireLock()
+	if err != nil {
+		return err
+	}
+	defer release()
+	if fs.journal && (fs.snapshot || fs.bidirectional) {
+		return errors.New("the resume journal cannot be combined with snapshots or two-way sync")
+	}
+	if fs.snapshot {
+		if fs.bidirectional {
+			return errors.New("snapshots cannot be combined with two-way sync")
+		}
+		finish, snapErr := fs.beginSnapshot()
+		if snapErr != nil {
+			return snapErr
+		}
+		defer func() {
+			if markErr := finish(err == nil && len(fs.stats.Errors) == 0); err == nil {
+				err = markErr
+			}
+		}()
+		// Every snapshot holds the whole tree
+		scopes = []string{"."}
+	}
+	if err := fs.checkHashAlgorithm(); err != nil {
+		return err
+	}
+	if err := fs.loadTransforms(); err != nil {
+		return err
+	}
+	if fs.verifyEvery > 0 && (fs.snapshot || fs.swap) {
+		return errors.New("periodic full checks cannot be combined with snapshots or directory swaps")
+	}
+	endPeriodic, err := fs.beginPeriodicVerify()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if countErr := endPeriodic(err); err == nil {
+			err = countErr
+		}
+	}()
+	if err := fs.loadChecksumCache(); err != nil {
+		return err
+	}
+	if fs.manifestCompare && (fs.manifestPath == "" || fs.fingerprintCmd != "") {
+		return errors.New("comparing against a manifest needs WithManifest, and cannot be combined with fingerprints")
+	}
+	if fs.manifestPath != "" && (fs.snapshot || fs.swap || fs.bidirectional) {
+		return errors.New("a manifest cannot be combined with snapshots, directory swaps or two-way sync")
+	}
+	if err := fs.loadManifest(); err != nil {
+		return err
+	}
+	if err := fs.loadPermissionsRef(); err != nil {
+		return err
+	}
+	fs.deniedMeta = 0
+	if err := fs.checkStripPrefix(); err != nil {
+		return err
+	}
+	if err := fs.checkShard(); err != nil {
+		return err
+	}
+
+	if fs.rsyncSlashes && len(fs.extraSources) > 0 && len(fs.namedSources) > 0 {
+		return fmt.Errorf("with rsync-style slashes, merged sources need a trailing slash: %s", fs.namedSources[0])
+	}
+	if fs.splitSize > 0 && (fs.resume || fs.preallocate) {
+		return errors.New("split files cannot be resumed or preallocated")
+	}
+	if fs.contentOnly && (fs.updateOnly || fs.noDowngrade || fs.bidirectional) {
+		return errors.New("update-only, no-downgrade and two-way sync need mod times, which content-only mode ignores")
+	}
+	if fs.nestSource && len(fs.extraSources) > 0 {
+		return errors.New("nesting the source directory supports a single source")
+	}
+	if fs.dirsOnly && (fs.pruneEmptyDirs || fs.noEmptyDirs || fs.bidirectional) {
+		return errors.New("a directories-only sync cannot prune or leave out empty directories, or run two-way")
+	}
+	if fs.sizeCap > 0 && (fs.snapshot || fs.swap || fs.bidirectional || fs.cas) {
+		return errors.New("a target size cap cannot be combined with snapshots, directory swaps, two-way sync or a content-addressable store")
+	}
+	if fs.shardCount > 1 && (fs.snapshot || fs.swap || fs.bidirectional || fs.cas) {
+		return errors.New("a shard of the tree cannot be synced with snapshots, directory swaps, two-way sync or a content-addressable store, which need the whole tree")
+	}
+	if fs.existingOnly && (fs.bidirectional || fs.snapshot || fs.swap) {
+		return errors.New("existing-only mode cannot be combined with two-way sync, snapshots or directory swaps, which build a new tree")
+	}
+	if fs.noEmptyDirs && fs.bidirectional {
+		return errors.New("leaving out empty directories cannot be combined with two-way sync")
+	}
+	if fs.emptyPlaceholders && fs.bidirectional {
+		return errors.New("empty placeholders cannot be combined with two-way sync")
+	}
+	if !fs.modifiedSince.IsZero() && (fs.snapshot || fs.swap || fs.bidirectional) {
+		return errors.New("a modified-since cutoff cannot be combined with snapshots, directory swaps or two-way sync")
+	}
+	if fs.accessedSince > 0 && (fs.snapshot || fs.swap || fs.bidirectional) {
+		return errors.New("an accessed-since cutoff cannot be combined with snapshots, directory swaps or two-way sync")
+	}
+	if (len(fs.excludeOwners) > 0 || len(fs.excludeGroups) > 0) && (fs.snapshot || fs.swap || fs.bidirectional) {
+		return errors.New("excluding owners or groups cannot be combined with snapshots, directory swaps or two-way sync")
+	}
+	if fs.pathMapper != nil && (fs.bidirectional || fs.deleteMissing && (len(scopes) != 1 || scopes[0] != ".")) {
+		return errors.New("a path mapper cannot be combined with two-way sync, or with delete-missing on part of the tree")
+	}
+	if fs.cas && (fs.snapshot || fs.swap || fs.bidirectional || fs.pathMapper != nil || fs.manifestPath != "" || len(fs.transforms) > 0 || fs.dirsOnly) {
+		return errors.New("a content-addressable store cannot be combined with snapshots, directory swaps, two-way sync, a path mapper, a manifest, transforms or directories only")
+	}
+	if err := checkRateSchedule(fs.rateSchedule); err != nil {
+		return err
+	}
+	if fs.cas && (len(scopes) != 1 || scopes[0] != ".") {
+		return errors.New("a content-addressable store is synced from the whole source tree")
+	}
+
+	fs.stats = Stats{FullCheck: fs.fullCheck}
+	if fs.snapshot {
+		fs.stats.Snapshot = fs.target
+	}
+	defer fs.beginStatus()()
+	defer func(start time.Time) { fs.recordRun(start, err) }(time.Now())
+	defer func(start time.Time) {
+		if reportErr := fs.writeReport(start, err); err == nil {
+			err = reportErr
+		}
+	}(time.Now())
+	if fs.treeHash {
+		defer func() {
+			if err == nil {
+				err = fs.hashTarget()
+			}
+		}()
+	}
+	defer func() {
+		// Progress is kept even when the run stopped early
+		wholeTree := len(scopes) == 1 && scopes[0] == "."
+		if saveErr := fs.saveManifest(err == nil && wholeTree); err == nil {
+			err = saveErr
+		}
+	}()
+	fs.actions = nil
+	fs.planSources = map[string]planSource{}
+	if err := fs.openTrace(); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := fs.closeTrace(); err == nil {
+			err = closeErr
+		}
+	}()
+	if err := fs.probeTarget(); err != nil {
+		return err
+	}
+	fs.pendingDirs = map[string]bool{}
+	fs.mapped = map[string]bool{}
+	fs.unmapped = false
+	fs.dedupIndex = nil
+	trees := fs.sourceTrees()
+
+	// Two-way mode reconciles the whole tree in both directions
+	if fs.bidirectional {
+		if len(trees) > 1 || trees[0].file != "" {
+			return errors.New("two-way sync supports a single source directory")
+		}
+		return fs.syncBidirectional(trees[0])
+	}
+
+	// A content store keeps objects by digest instead of a tree
+	if fs.cas {
+		if len(trees) > 1 || trees[0].file != "" {
+			return errors.New("a content-addressable store supports a single source directory")
+		}
+		return fs.syncCAS(trees[0])
+	}
+
+	// Note what the target holds before anything is written to it
+	fs.preexisting = nil
+	if fs.deleteMissing && fs.deletePreexistingOnly {
+		if fs.preexisting, err = fs.listTarget(scopes); err != nil {
+			return err
+		}
+	}
+
+	// Pick up where an interrupted run stopped
+	if err := fs.openJournal(); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := fs.closeJournal(err == nil); err == nil {
+			err = closeErr
+		}
+	}()
+
+	// Scan every source, then keep one job per target path
+	walked := fs.timePhase("walk", &fs.stats.Timings.Walk)
+	if fs.dryRun && fs.planWorkers > 1 && fs.pathMapper == nil {
+		// Nothing is written, so target lookups can run ahead
+		fs.planStats = &targetStats{stats: map[string]prefetchedStat{}}
+		defer func() { fs.planStats = nil }()
+	}
+	var perSource [][]*fileJob
+	for _, scope := range scopes {
+		for _, tree := range trees {
+			if scope != "." {
+				if !tree.holds(scope) {
+					continue
+				}
+				if _, err := tree.fsys.Lstat(filepath.Join(tree.root, scope)); os.IsNotExist(err) {
+					continue
+				}
+			}
+			jobs, err := fs.scanSource(tree, scope)
+			if err != nil {
+				return err
+			}
+			perSource = append(perSource, jobs)
+		}
+	}
+	jobs := mergeByPath(perSource, func(j *fileJob) string { return j.relPath }, fs.firstSourceWins)
+	fs.planStats = nil
+	walked()
+	if fs.stats.FilesTooOld > 0 {
+		log.Printf("🕰️ Skipped %d file(s) modified before %s", fs.stats.FilesTooOld, fs.modifiedSince.Format(time.RFC3339))
+	}
+	if fs.stats.FilesNotAccessed > 0 {
+		log.Printf("💤 Skipped %d file(s) not accessed in the last %s", fs.stats.FilesNotAccessed, fs.accessedSince)
+	}
+	if fs.stats.FilesByOwner > 0 {
+		log.Printf("👤 Skipped %d file(s) of excluded owners or groups", fs.stats.FilesByOwner)
+	}
+	if fs.stats.FilesNotInTarget > 0 {
+		log.Printf("🆕 Skipped %d file(s) the target does not have yet", fs.stats.FilesNotInTarget)
+	}
+
+	compared := fs.timePhase("compare", &fs.stats.Timings.Compare)
+	fs.skipJournaled(jobs)
+	fs.compareJobs(jobs)
+	if err := fs.saveChecksumCache(len(scopes) == 1 && scopes[0] == "."); err != nil {
+		return err
+	}
+	compared()
+
+	// Move renamed files rather than copying them again
+	if err := fs.renameOrphans(trees, scopes, jobs); err != nil {
+		return err
+	}
+
+	// A source that looks emptied out gets no delete pass
+	wholeTree := len(scopes) == 1 && scopes[0] == "."
+	dropErr := fs.checkSourceDrop(len(jobs), wholeTree)
+	if dropErr != nil && !errors.Is(dropErr, ErrSourceDropped) {
+		return dropErr
+	}
+
+	// Reclaim space before copying, see WithDeleteFirst
+	if fs.deleteFirst && dropErr == nil {
+		cleaned := fs.timePhase("delete", &fs.stats.Timings.Cleanup)
+		err := fs.deleteOrphans(trees, scopes)
+		cleaned()
+		if err != nil {
+			return err
+		}
+	}
+
+	copied := fs.timePhase("copy", &fs.stats.Timings.Copy)
+	fs.orderCopies(jobs)
+	fs.dirCleanup = fs.newDirCleanup(trees, dropErr)
+	err = fs.copyJobs(jobs)
+	fs.dirCleanup = nil
+	fs.applyDirStamps()
+	if saveErr := fs.saveTransforms(); err == nil {
+		err = saveErr
+	}
+	copied()
+	if err != nil {
+		return err
+	}
+	defer fs.timePhase("delete", &fs.stats.Timings.Cleanup)()
+
+	// Optionally clean up extra files in target
+	if !fs.deleteFirst && dropErr == nil {
+		if err := fs.deleteOrphans(trees, scopes); err != nil {
+			return err
+		}
+	}
+
+	// Optionally remove directories that ended up empty
+	if fs.pruneEmptyDirs && dropErr == nil {
+		for _, scope := range scopes {
+			if err := fs.pruneEmpty(trees, scope); err != nil {
+				return err
+			}
+		}
+	}
+	if dropErr != nil {
+		return dropErr
+	}
+	if fs.dropGuard > 0 && wholeTree && !fs.dryRun {
+		return fs.saveSourceCount(len(jobs))
+	}
+	return nil
+}
+
+// fileJob is a source file considered for copying during a sync.
+type fileJob struct {
+	relPath    string
+	srcPath    string
+	targetPath string
+	srcInfo    os.FileInfo
+	tgtInfo    os.FileInfo // nil when the file must be copied regardless
+
+	copy   bool       // set once the file is known to need copying
+	reason DiffReason // why an existing target file is replaced
+	err    error      // comparison failure, if any
+
+	linkFrom  string // previous snapshot's copy, compared instead of the target
+	journaled bool   // synced by an interrupted earlier run, see WithJournal
+
+	targetNewer bool // differs, but skipped because the target is not older
+	renamed     bool // an orphan was moved into place, see WithDetectRenames
+	placeholder bool // empty source skipped over a non-empty target, see WithEmptyPlaceholders
+}
+
+// scanSource walks the scope (a path relative to the root, "." for
+// all of it) of one source tree, creating directories in target as it
+// goes, and returns the files to consider in walk order.
+func (fs *FileSync) scanSource(tree sourceTree, scope string) ([]*fileJob, error) {
+	var jobs []*fileJob
+
+	// Note the root's device if the walk must stay on it
+	var rootDev uint64
+	var rootDevOK bool
+	if fs.oneFileSystem {
+		if info, err := tree.fsys.Stat(tree.root); err == nil {
+			rootDev, rootDevOK = fileDevice(info)
+		}
+	}
+
+	// A dry run leaves a file where a directory goes, so the target
+	// has nothing below it yet: the subtree is planned as new
+	var dryRunReplaced string
+	inReplaced := func(relPath string) bool {
+		return dryRunReplaced != "" && relPath != dryRunReplaced && withinScope(relPath, dryRunReplaced)
+	}
+
 	// Walk through all entries in source
-	err := filepath.WalkDir(fs.source, func(path string, d os.DirEntry, err error) error {
+	err := fs.walkTree(tree.fsys, tree.walkRoot(scope), true, fs.prefetchTarget(tree), fs.followDirLinks(tree.fsys, tree.root, func(path string, d os.DirEntry, err error) error {
+		if stopErr := fs.interrupted(); stopErr != nil {
+			return stopErr
+		}
 		if err != nil {
-			// Skip problem entries but continue walking
-			log.Printf("Error accessing %s: %v", path, err)
-			return nil
+			// A source that is gone altogether aborts the sync;
+			// other problem entries are skipped, unless access
+			// errors must abort it too
+			if vanished := checkSourcesPresent(tree); vanished != nil {
+				return vanished
+			}
+			log.Printf("Error accessing %q: %v", path, err)
+			fs.recordError(&WalkError{Path: path, Err: err})
+			fs.unmapped = true
+			return fs.accessError(path, err)
 		}
 
 		// Build target path relative to source root
-		relPath, _ := filepath.Rel(fs.source, path)
+		relPath, _ := filepath.Rel(tree.root, path)
 		targetPath := filepath.Join(fs.target, relPath)
 
+		// Skip entries excluded by .syncignore files or filters
+		if fs.excluded(tree.ignores, relPath, d.IsDir()) || fs.contentExcluded(tree.fsys, path, d) {
+			fs.keepSkipped(tree, path)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		// Handle directories: ensure existence in target
 		if d.IsDir() {
-			if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-				if mkErr := os.MkdirAll(targetPath, 0755); mkErr != nil {
-					log.Printf("❌ Failed to create directory %s: %v", targetPath, mkErr)
+			if rootDevOK && fs.onOtherDevice(d, rootDev) {
+				log.Printf("⏭️ Skipping mount point: %q", path)
+				fs.keepSkipped(tree, path)
+				return filepath.SkipDir
+			}
+			if fs.pathMapper != nil {
+				// Mapped files bring their own directories
+				return nil
+			}
+			if fs.stampsDirs() {
+				fs.noteDirStamp(path, targetPath, d)
+			}
+			if inReplaced(relPath) {
+				if fs.existingOnly {
+					return filepath.SkipDir
+				}
+				fs.createDir(relPath)
+				return nil
+			}
+			// A file sitting where the directory should be must go first,
+			// otherwise MkdirAll fails and the subtree is never synced.
+			if tgtInfo, err := fs.targetLstat(targetPath); err == nil && !tgtInfo.IsDir() {
+				if fs.dryRun {
+					log.Printf("🔎 Would replace file with directory: %q", targetPath)
+					fs.recordAction(ActionModify, relPath, true, ReasonType)
+					dryRunReplaced = relPath
+					return nil
+				}
+				if rmErr := fs.removeEntry(fs.tgtFS, targetPath); rmErr != nil {
+					log.Printf("❌ Failed to remove file blocking directory %q: %v", targetPath, rmErr)
+					fs.recordError(&DeleteError{Path: targetPath, Err: rmErr})
+					return nil
+				}
+				log.Printf("🔁 Replaced file with directory: %q", targetPath)
+				fs.recordAction(ActionModify, relPath, true, ReasonType)
+				if mkErr := fs.makeDir(targetPath); mkErr != nil {
+					log.Printf("❌ Failed to create directory %q: %v", targetPath, mkErr)
+					fs.recordError(&MkdirError{Path: targetPath, Err: mkErr})
+				}
+				return nil
+			}
+			if _, err := fs.targetStat(targetPath); os.IsNotExist(err) {
+				if fs.existingOnly {
+					// Nothing below it is in the target either
+					return filepath.SkipDir
+				}
+				if fs.noEmptyDirs || fs.pruneEmptyDirs && !fs.keepEmptyDir(tree, relPath) {
+					// Only created once a file lands in it, so
+					// directories that would end up empty never appear
+					fs.pendingDirs[relPath] = true
 				} else {
-					log.Printf("📂 Created directory: %s", targetPath)
+					fs.createDir(relPath)
 				}
 			}
 			return nil
 		}
 
-		// Handle files
-		copy := false
-		srcInfo, err := os.Stat(path)
+		// Handle files, and symlinks to them
+		if fs.dirsOnly {
+			return nil
+		}
+		if fs.preserveSymlinks && isSymlink(d) {
+			if fs.skipNew(targetPath) {
+				return nil
+			}
+			fs.claimPath(relPath)
+			fs.syncSymlink(tree.fsys, relPath, path, targetPath)
+			return nil
+		}
+		srcInfo, err := statOf(tree.fsys, path, d)
+		if err != nil && os.IsNotExist(err) && isSymlink(d) {
+			fs.skipBrokenSymlink(tree.fsys, relPath, path)
+			fs.unmapped = true
+			return fs.accessError(path, err)
+		}
 		if err != nil {
-			log.Printf("❌ Could not read file info for %s: %v", path, err)
+			if vanished := checkSourcesPresent(tree); vanished != nil {
+				return vanished
+			}
+			log.Printf("❌ Could not read file info for %q: %v", path, err)
+			fs.recordError(&StatError{Path: path, Err: err})
+			fs.unmapped = true
+			return fs.accessError(path, err)
+		}
+		if isSpecial(srcInfo.Mode()) {
+			if fs.skipNew(targetPath) {
+				return nil
+			}
+			fs.claimPath(relPath)
+			fs.syncSpecial(relPath, path, targetPath, srcInfo)
 			return nil
 		}
+		if srcInfo.ModTime().Before(fs.modifiedSince) {
+			fs.stats.FilesTooOld++
+			fs.keepMapped(relPath, srcInfo)
+			return nil
+		}
+		if fs.notAccessed(srcInfo) {
+			fs.stats.FilesNotAccessed++
+			fs.keepMapped(relPath, srcInfo)
+			return nil
+		}
+		if fs.ownerExcluded(srcInfo) {
+			fs.stats.FilesByOwner++
+			fs.keepMapped(relPath, srcInfo)
+			return nil
+		}
+		if fs.pathMapper != nil {
+			var ok bool
+			if relPath, targetPath, ok = fs.mapTarget(relPath, path, srcInfo); !ok {
+				return nil
+			}
+		}
+		job := &fileJob{relPath: relPath, srcPath: path, targetPath: targetPath, srcInfo: srcInfo}
 
 		// Determine whether to copy:
 		// - Missing in target
-		// - Different size or modification time
-		if tgtInfo, err := os.Stat(targetPath); os.IsNotExist(err) {
-			copy = true
-		} else if err == nil {
-			if !fs.sameFile(srcInfo, tgtInfo) {
-				copy = true
-			}
+		// - Different according to the comparator (size and
+		//   modification time, or content in checksum mode),
+		//   which is decided later by compareJobs
+		var tgtInfo os.FileInfo
+		if inReplaced(relPath) {
+			err = &os.PathError{Op: "lstat", Path: targetPath, Err: os.ErrNotExist}
 		} else {
-			log.Printf("❌ Problem reading %s: %v", targetPath, err)
+			tgtInfo, err = fs.statTarget(relPath, targetPath)
 		}
-
-		// Perform copy if flagged
-		if copy {
-			if err := fs.copyFile(path, targetPath); err != nil {
-				log.Printf("❌ Error copying %s → %s: %v", path, targetPath, err)
+		if os.IsNotExist(err) && fs.existingOnly {
+			fs.stats.FilesNotInTarget++
+			return nil
+		} else if os.IsNotExist(err) {
+			job.copy = true
+			fs.snapshotBase(job)
+		} else if err == nil && tgtInfo.IsDir() {
+			// A directory sitting where the file should be is removed
+			// together with its contents before the file is copied.
+			if fs.dryRun {
+				log.Printf("🔎 Would replace directory with file: %q", targetPath)
+			} else if rmErr := fs.removeTree(fs.tgtFS, targetPath); rmErr != nil {
+				log.Printf("❌ Failed to remove directory blocking file %q: %v", targetPath, rmErr)
+				fs.recordError(&DeleteError{Path: targetPath, Err: rmErr})
+				return nil
 			} else {
-				log.Printf("📄 Copied/Updated: %s → %s", path, targetPath)
+				log.Printf("🔁 Replaced directory with file: %q", targetPath)
 			}
+			job.copy = true
+			job.reason = ReasonType
+		} else if err == nil && tgtInfo.Mode()&os.ModeSymlink != 0 {
+			// Only there without WithFollowTargetSymlinks, and replaced
+			// by copyFile
+			log.Printf("🔗 Target is a symlink, replacing it with a file: %q", targetPath)
+			job.copy = true
+			job.reason = ReasonType
+		} else if err == nil && os.SameFile(srcInfo, tgtInfo) {
+			// A hard link or bind mount makes the target the source
+			// itself; copying it onto itself would truncate it
+			fs.logSkip("🔗 Same file as the source, skipping: %q", targetPath)
+			fs.stats.SameFile = append(fs.stats.SameFile, relPath)
+			return nil
+		} else if err == nil {
+			job.tgtInfo = tgtInfo
+		} else {
+			log.Printf("❌ Problem reading %q: %v", targetPath, err)
+			fs.recordError(&StatError{Path: targetPath, Err: err})
+			return nil
 		}
 
+		jobs = append(jobs, job)
 		return nil
-	})
+	}))
+
+	return jobs, err
+}
 
+// skipNew reports whether existing-only mode skips the entry for
+// targetPath because nothing is there yet (see WithExistingOnly), and
+// counts it if so.
+func (fs *FileSync) skipNew(targetPath string) bool {
+	if !fs.existingOnly {
+		return false
+	}
+	if _, err := fs.targetLstat(targetPath); !os.IsNotExist(err) {
+		return false
+	}
+	fs.stats.FilesNotInTarget++
+	return true
+}
+
+// onOtherDevice reports whether the directory entry d lives on
+// another device than rootDev, i.e. is a mount point the walk must not
+// cross (see WithOneFileSystem).
+func (fs *FileSync) onOtherDevice(d os.DirEntry, rootDev uint64) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	dev, ok := fileDevice(info)
+	return ok && dev != rootDev
+}
+
+// comparePath is the file the job's source is compared with.
+func (j *fileJob) comparePath() string {
+	if j.linkFrom != "" {
+		return j.linkFrom
+	}
+	return j.targetPath
+}
+
+// createDir creates the target directory for relPath, logging and
+// recording it (or only pretending to, in dry-run mode).
+func (fs *FileSync) createDir(relPath string) {
+	targetPath := filepath.Join(fs.target, relPath)
+	if fs.dryRun {
+		log.Printf("🔎 Would create directory: %q", targetPath)
+		fs.recordAction(ActionAdd, relPath, true, "")
+		fs.stats.DirsCreated++
+	} else if mkErr := fs.makeDir(targetPath); mkErr != nil {
+		log.Printf("❌ Failed to create directory %q: %v", targetPath, mkErr)
+		fs.recordError(&MkdirError{Path: targetPath, Err: mkErr})
+	} else {
+		log.Printf("📂 Created directory: %q", targetPath)
+		fs.recordAction(ActionAdd, relPath, true, "")
+		fs.stats.DirsCreated++
+	}
+}
+
+// compareJobs runs the comparator for every job whose target exists,
+// spreading the work over a bounded pool of workers. This matters in
+// checksum mode, where each comparison hashes both files. Results are
+// stored on the jobs themselves, so the copy decisions that follow
+// stay in deterministic walk order.
+func (fs *FileSync) compareJobs(jobs []*fileJob) {
+	pending := make(chan *fileJob)
+	var wg sync.WaitGroup
+	workers := fs.workerCount()
+	var tuner *workerTuner
+	if fs.autoWorkers {
+		tuner = newWorkerTuner(workers, fs.contentRead.Load)
+		stop := make(chan struct{})
+		go tuner.run(stop)
+		defer func() {
+			close(stop)
+			fs.stats.Workers = tuner.chosen()
+			log.Printf("⚙️ Auto-tuned comparisons to %d of up to %d worker(s)", fs.stats.Workers, workers)
+		}()
+	}
+	fs.stats.Workers = workers
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range pending {
+				tuner.acquire()
+				releaseDir := fs.acquireDir(job.targetPath)
+				release := fs.acquireFiles()
+				reason, err := fs.compareFiles(job.srcPath, job.comparePath(), job.srcInfo, job.tgtInfo)
+				release()
+				releaseDir()
+				tuner.release()
+				job.copy = reason != ""
+				job.reason = reason
+				job.err = err
+
+				// In update-only mode a differing file is only replaced
+				// when the source is strictly newer than the target.
+				if job.copy && fs.updateOnly && !job.srcInfo.ModTime().After(job.tgtInfo.ModTime()) {
+					job.copy = false
+					job.targetNewer = true
+				}
+				// Without a size change, only a newer source may
+				// replace the target (see WithNoDowngrade)
+				if job.copy && fs.noDowngrade && job.reason != ReasonSize && !job.srcInfo.ModTime().After(job.tgtInfo.ModTime()) {
+					job.copy = false
+					job.targetNewer = true
+				}
+				// An empty source is not ready yet and must not
+				// clobber data (see WithEmptyPlaceholders)
+				if job.copy && fs.emptyPlaceholders && job.srcInfo.Size() == 0 && job.tgtInfo.Size() > 0 {
+					job.copy = false
+					job.placeholder = true
+				}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		if job.tgtInfo != nil && !job.journaled {
+			pending <- job
+		}
+	}
+	close(pending)
+	wg.Wait()
+}
+
+// copyJobs copies every job flagged for copying, in walk order.
+func (fs *FileSync) copyJobs(jobs []*fileJob) error {
+	if (fs.onProgress != nil || fs.statusBoard != nil) && !fs.dryRun {
+		fs.progress = newProgressTracker(fs.reportProgress, jobs)
+		defer func() { fs.progress = nil }()
+	}
+	budget, err := fs.newSizeBudget(jobs)
 	if err != nil {
 		return err
 	}
+	beats := fs.newHeartbeat()
+	defer beats.finish(fs)
+	if fs.tee != nil {
+		fs.tee.begin(fs.teeID, jobs)
+		defer fs.tee.end(fs.teeID)
+	}
 
-	// Optionally clean up extra files in target
-	if fs.deleteMissing {
-		err = filepath.WalkDir(fs.target, func(path string, d os.DirEntry, err error) error {
+	for _, job := range jobs {
+		beats.beat(fs)
+		fs.traceJob(job)
+		if job.renamed {
+			continue
+		}
+		if job.err != nil {
+			// A hash cut short by the run being stopped is no failure
+			if err := fs.interrupted(); err != nil && errors.Is(job.err, err) {
+				return err
+			}
+			log.Printf("❌ Could not compare %q with %q: %v", job.srcPath, job.targetPath, job.err)
+			fs.recordError(&CompareError{Src: job.srcPath, Dst: job.targetPath, Err: job.err})
+			if isSourceError(job.err, job.srcPath) {
+				if err := fs.accessError(job.srcPath, job.err); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// Unchanged since the previous snapshot: a hard link will do,
+		// unless the filesystem has none and it must be copied after all
+		if !job.copy && job.linkFrom != "" {
+			if fs.linkUnchanged(job) {
+				continue
+			}
+			job.copy = true
+		}
+
+		// Perform copy if flagged
+		if !job.copy {
+			if job.targetNewer {
+				fs.logSkip("⏭️ Skipped, target is newer: %q", job.targetPath)
+			}
+			if job.placeholder {
+				fs.logSkip("⏳ Skipped empty placeholder over non-empty target: %q", job.targetPath)
+				fs.stats.Placeholders = append(fs.stats.Placeholders, job.relPath)
+			}
+			fs.journalDone(job)
+			fs.noteManifest(job, false)
+			fs.stats.FilesSkipped++
+			continue
+		}
+		if fs.maxFiles > 0 && fs.stats.FilesCopied >= fs.maxFiles {
+			fs.stats.Truncated = true
+			fs.stats.FilesRemaining++
+			continue
+		}
+		if err := fs.interrupted(); err != nil {
+			return err
+		}
+		if err := fs.waitIfPaused(); err != nil {
+			return err
+		}
+		if err := fs.waitForLoad(); err != nil {
+			return err
+		}
+		if fs.beforeCopy != nil {
+			proceed, err := fs.beforeCopy(job.srcPath, job.targetPath, job.srcInfo)
 			if err != nil {
-				log.Printf("Error accessing %s: %v", path, err)
-				return nil
+				log.Printf("❌ Before-copy hook failed for %q: %v", job.srcPath, err)
+				fs.recordError(&CopyError{Src: job.srcPath, Dst: job.targetPath, Err: err})
+				if fs.failOnAccessError {
+					return fmt.Errorf("before-copy hook for %s: %w", job.srcPath, err)
+				}
+				continue
+			}
+			if !proceed {
+				log.Printf("🚫 Skipped by the before-copy hook: %q", job.srcPath)
+				fs.stats.Vetoed = append(fs.stats.Vetoed, job.relPath)
+				continue
+			}
+		}
+		if budget != nil && !fs.fitsCap(budget, job) {
+			continue
+		}
+		kind := ActionAdd
+		if job.reason != "" {
+			kind = ActionModify
+		}
+		oldSize, newSize := copySizes(kind, job)
+		if fs.skipLocked && fs.sourceLocked(job.srcPath) {
+			fs.skipLockedFile(job)
+			continue
+		}
+		fs.createPendingDirs(job.relPath)
+		if fs.linkDuplicate(job) {
+			// A link copies nothing, it only frees the file it replaces
+			fs.recordFileAction(kind, job.relPath, job.reason, oldSize, 0)
+			if fs.dryRun {
+				fs.planSources[job.relPath] = planSource{path: job.srcPath, info: job.srcInfo}
+			}
+			fs.journalDone(job)
+			fs.noteManifest(job, true)
+			fs.stats.FilesDeduped++
+			continue
+		}
+		if fs.dryRun {
+			log.Printf("🔎 Would copy: %q → %q (%d → %d bytes, %+d)", job.srcPath, job.targetPath, oldSize, newSize, newSize-oldSize)
+			fs.recordFileAction(kind, job.relPath, job.reason, oldSize, newSize)
+			fs.planSources[job.relPath] = planSource{path: job.srcPath, info: job.srcInfo}
+			fs.noteDeduped(job)
+			fs.stats.FilesCopied++
+			fs.stats.BytesCopied += job.srcInfo.Size()
+			continue
+		}
+		if err := fs.cleanDirFirst(job); err != nil {
+			return err
+		}
+		if fs.spaceCheck {
+			need := job.srcInfo.Size()
+			if fs.replacesFirst(job) {
+				need = max(need-job.tgtInfo.Size(), 0)
 			}
+			if err := fs.checkFreeSpace(job.targetPath, need); err != nil {
+				if fs.abortOnSpace {
+					return err
+				}
+				log.Printf("💾 Skipped, not enough free space: %q", job.targetPath)
+				fs.stats.NoSpace = append(fs.stats.NoSpace, job.relPath)
+				fs.recordError(&CopyError{Src: job.srcPath, Dst: job.targetPath, Err: err})
+				continue
+			}
+		}
+		if fs.progress != nil {
+			fs.progress.begin(job.relPath)
+		}
+		var started time.Time
+		if fs.profile {
+			started = time.Now()
+		}
+		fs.removeReplaced(job)
+		releaseDir := fs.acquireDir(job.targetPath)
+		release := fs.acquireFiles()
+		err := fs.copyFile(job.srcPath, job.targetPath)
+		for attempt := 1; errors.Is(err, ErrChangedDuringCopy) && attempt <= fs.changedRetries; attempt++ {
+			log.Printf("🔄 Source changed during copy, retrying (%d/%d): %q", attempt, fs.changedRetries, job.srcPath)
+			err = fs.copyFile(job.srcPath, job.targetPath)
+		}
+		release()
+		releaseDir()
+		if fs.progress != nil {
+			fs.progress.finish(job.srcInfo.Size())
+		}
+		if fs.profile {
+			fs.stats.Timings.recordFileTiming(job.relPath, job.srcInfo.Size(), time.Since(started))
+		}
+		if errors.Is(err, ErrChangedDuringCopy) {
+			log.Printf("⚠️ Source changed during copy: %q", job.srcPath)
+			fs.stats.ChangedDuringCopy = append(fs.stats.ChangedDuringCopy, job.relPath)
+			fs.recordError(&CopyError{Src: job.srcPath, Dst: job.targetPath, Err: err})
+		} else if err != nil && fs.skipLocked && isLockError(err) {
+			fs.skipLockedFile(job)
+		} else if err != nil {
+			log.Printf("❌ Error copying %q → %q: %v", job.srcPath, job.targetPath, err)
+			fs.recordError(&CopyError{Src: job.srcPath, Dst: job.targetPath, Err: err})
+			if isSourceError(err, job.srcPath) {
+				if err := fs.accessError(job.srcPath, err); err != nil {
+					return err
+				}
+			}
+		} else if err := fs.validateCopy(job); err != nil {
+			if fs.failOnAccessError {
+				return err
+			}
+		} else {
+			log.Printf("📄 Copied/Updated: %q → %q", job.srcPath, job.targetPath)
+			fs.recordFileAction(kind, job.relPath, job.reason, oldSize, newSize)
+			fs.journalDone(job)
+			fs.noteDeduped(job)
+			fs.noteManifest(job, true)
+			fs.stats.FilesCopied++
+			fs.stats.BytesCopied += job.srcInfo.Size()
+		}
+	}
+	if fs.stats.Truncated {
+		log.Printf("⏸️ Stopped after %d files, %d left for the next run", fs.stats.FilesCopied, fs.stats.FilesRemaining)
+	}
+	return nil
+}
+
+// sourceLocked reports whether another process holds a local source
+// file locked (see WithSkipLocked).
+func (fs *FileSync) sourceLocked(path string) bool {
+	_, local := baseFS(fs.srcFS).(osFS)
+	return local && fileLocked(path)
+}
+
+// skipLockedFile records a job skipped because its source is locked.
+func (fs *FileSync) skipLockedFile(job *fileJob) {
+	log.Printf("🔒 Locked, skipped: %q", job.srcPath)
+	fs.stats.Locked = append(fs.stats.Locked, job.relPath)
+}
 
-			// Find matching path in source
-			relPath, _ := filepath.Rel(fs.target, path)
-			srcPath := filepath.Join(fs.source, relPath)
+// deleteOrphans runs the delete pass over every scope when
+// deleteMissing is set, unless a source is missing or vanished since
+// the walk and everything would look orphaned. Existing-only mode never
+// deletes.
+func (fs *FileSync) deleteOrphans(trees []sourceTree, scopes []string) error {
+	if !fs.deleteMissing || fs.existingOnly {
+		return nil
+	}
+	if err := checkSourceRoots(trees...); err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		if err := fs.deleteMissingFiles(trees, scope, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMissingFiles removes target entries within scope (relative
+// to the target root, "." for all of it) that no longer exist in any
+// of the source trees. A shallow pass only looks at the entries
+// directly in scope, not in its subdirectories.
+func (fs *FileSync) deleteMissingFiles(trees []sourceTree, scope string, shallow bool) error {
+	if fs.pathMapper != nil && fs.unmapped {
+		log.Printf("⚠️ Some source files could not be mapped, no orphans deleted from %q", fs.target)
+		return nil
+	}
+	scopeRoot := filepath.Join(fs.target, scope)
+	if scope != "." {
+		if _, err := fs.tgtFS.Lstat(scopeRoot); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	// With a retention period, orphans are only deleted once they
+	// have been missing for long enough across runs.
+	var retention *retentionState
+	if fs.retainsOrphans() {
+		var err error
+		if retention, err = loadRetentionState(fs.stateFS(fs.retentionStatePath), fs.retentionFile()); err != nil {
+			return err
+		}
+		retention.keepOutside(scope)
+		if shallow {
+			retention.keepBelow(scope)
+		}
+	}
+	now := time.Now()
+	var trash *trashCan
+	if fs.trash {
+		trash = fs.newTrashCan(now)
+	}
+	// Moves to the trash the delete policy asks for, without WithTrash
+	var backup *trashCan
 
-			// Remove target entry if it doesn’t exist in source
-			if _, err := os.Stat(srcPath); os.IsNotExist(err) {
+	err := fs.walkTarget(scopeRoot, func(path string, d os.DirEntry, err error) error {
+		if limitErr := fs.errorLimit(); limitErr != nil {
+			return limitErr
+		}
+		if err != nil {
+			log.Printf("Error accessing %q: %v", path, err)
+			fs.recordError(&WalkError{Path: path, Err: err})
+			return nil
+		}
+
+		// Never treat our own bookkeeping files as orphans
+		if fs.isInternal(path) {
+			return nil
+		}
+		if shallow && d.IsDir() && path != scopeRoot {
+			return filepath.SkipDir
+		}
+
+		// Find matching path in source
+		relPath, _ := filepath.Rel(fs.target, path)
+
+		// Excluded entries are left alone, like excludes in rsync
+		if fs.excludedEverywhere(trees, relPath, d.IsDir()) || fs.contentExcluded(fs.tgtFS, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Remove target entry if it doesn’t exist in any source, and
+		// was not renamed in a dry run. An entry that only may be gone
+		// from the source is kept, and so is one that is back when the
+		// sources are stat'ed again right before deleting it.
+		orphan, statErr := fs.orphaned(trees, relPath)
+		if statErr != nil {
+			fs.keepUnconfirmed(relPath, path, statErr)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if orphan && !fs.renamedFrom[relPath] {
+			if fs.spareProtected(relPath, path, d) || fs.spareOrphan(relPath, path, d) || !fs.dryRun && !fs.confirmOrphan(trees, relPath, path) {
 				if d.IsDir() {
-					// Attempt to remove empty directory
-					if rmErr := os.Remove(path); rmErr == nil {
-						log.Printf("🗑️ Removed empty directory: %s", path)
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				// Attempt to remove empty directory
+				if fs.dryRun {
+					log.Printf("🔎 Would remove directory: %q", path)
+					fs.recordAction(ActionDelete, relPath, true, "")
+					fs.stats.DirsDeleted++
+				} else if rmErr := fs.removeEntry(fs.tgtFS, path); rmErr == nil {
+					log.Printf("🗑️ Removed empty directory: %q", path)
+					fs.recordAction(ActionDelete, relPath, true, "")
+					fs.stats.DirsDeleted++
+				}
+			} else if !fs.dirsOnly {
+				if retention != nil && !retention.due(relPath, now, fs.deleteRetention, fs.retentionRuns) {
+					log.Printf("⏳ Keeping orphan until retention expires: %q", path)
+					return nil
+				}
+				if fs.deleteOlderThan > 0 {
+					if info, err := d.Info(); err == nil && now.Sub(info.ModTime()) < fs.deleteOlderThan {
+						log.Printf("🌱 Keeping recent orphan, modified %s ago: %q", now.Sub(info.ModTime()).Round(time.Second), path)
+						return nil
+					}
+				}
+				action := fs.orphanAction(relPath, path, d)
+				if action != DeleteOrphan && action != BackupOrphan {
+					return nil
+				}
+				discard := trash
+				if action == BackupOrphan && discard == nil {
+					if backup == nil {
+						backup = fs.newTrashCan(now)
+					}
+					discard = backup
+				}
+				size := entrySize(d)
+				if fs.dryRun && discard != nil {
+					log.Printf("🔎 Would move to trash: %q (frees %d bytes)", path, size)
+					fs.recordFileAction(ActionDelete, relPath, "", size, 0)
+					fs.stats.FilesDeleted++
+					if action == BackupOrphan {
+						fs.stats.BackedUp = append(fs.stats.BackedUp, relPath)
 					}
+					return nil
+				}
+				if fs.dryRun {
+					log.Printf("🔎 Would remove file: %q (frees %d bytes)", path, size)
+					fs.recordFileAction(ActionDelete, relPath, "", size, 0)
+					fs.stats.FilesDeleted++
+					return nil
+				}
+				var rmErr error
+				if discard != nil {
+					rmErr = discard.discard(path, relPath)
 				} else {
-					if rmErr := os.Remove(path); rmErr == nil {
-						log.Printf("🗑️ Removed file: %s", path)
+					rmErr = fs.removeEntry(fs.tgtFS, path)
+				}
+				if rmErr == nil {
+					if discard != nil {
+						log.Printf("♻️ Moved to trash: %q", path)
+					} else {
+						log.Printf("🗑️ Removed file: %q", path)
 					}
+					fs.recordFileAction(ActionDelete, relPath, "", size, 0)
+					fs.stats.FilesDeleted++
+					if action == BackupOrphan {
+						fs.stats.BackedUp = append(fs.stats.BackedUp, relPath)
+					}
+					fs.forgetManifest(relPath)
+					if retention != nil {
+						retention.forget(relPath)
+					}
+				} else if !os.IsNotExist(rmErr) {
+					log.Printf("❌ Failed to remove %q: %v", path, rmErr)
+					fs.recordError(&DeleteError{Path: path, Err: rmErr})
 				}
 			}
-			return nil
-		})
-	}
+		}
+		return nil
+	})
 
+	if err == nil && retention != nil && !fs.dryRun {
+		err = retention.save(fs.stateFS(fs.retentionStatePath), fs.retentionFile())
+	}
 	return err
 }
 
-// sameFile compares two files by size and modification time.
-// Returns true if they appear identical.
-func (fs *FileSync) sameFile(src, tgt os.FileInfo) bool {
-	return src.Size() == tgt.Size() && src.ModTime().Equal(tgt.ModTime())
+// accessError decides what happens when a source entry cannot be read.
+// By default the entry is skipped (nil); with failOnAccessError the
+// walk is aborted with a descriptive error.
+func (fs *FileSync) accessError(path string, err error) error {
+	if !fs.failOnAccessError {
+		return nil
+	}
+	return fmt.Errorf("cannot access source %s: %w", path, err)
 }
 
-// copyFile copies src → dst, creating parent directories if needed.
-// The modification time of the source file is preserved on the target.
-func (fs *FileSync) copyFile(src, dst string) error {
-	// Ensure parent directory exists
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-		return err
+// isSourceError reports whether err was caused by reading src,
+// as opposed to writing the target.
+func isSourceError(err error, src string) bool {
+	var pathErr *os.PathError
+	return errors.As(err, &pathErr) && pathErr.Path == src
+}
+
+// walk walks root on fsys like walkDir, in the configured order (see
+// WithCaseInsensitiveOrder), listing directories ahead of the walk
+// with WithParallelWalk.
+func (fs *FileSync) walk(fsys FS, root string, fn func(path string, d os.DirEntry, err error) error) error {
+	return fs.walkTree(fsys, root, false, nil, fn)
+}
+
+// walkTree is walk, also stat'ing files ahead of the walk with
+// statFiles and WithParallelWalk (see statOf). A non-nil prefetch runs
+// ahead of the walk for every entry too, on at least the
+// WithParallelPlan number of goroutines.
+func (fs *FileSync) walkTree(fsys FS, root string, statFiles bool, prefetch func(path string), fn func(path string, d os.DirEntry, err error) error) error {
+	workers := fs.walkWorkers
+	if prefetch != nil {
+		workers = max(workers, fs.planWorkers)
+	}
+	if workers > 1 {
+		var less func(a, b string) bool
+		if fs.foldCaseOrder {
+			less = foldedLess
+		}
+		return walkDirParallel(fsys, root, less, workers, statFiles, prefetch, fn)
 	}
+	if fs.foldCaseOrder {
+		return walkDirOrdered(fsys, root, foldedLess, fn)
+	}
+	return walkDir(fsys, root, fn)
+}
 
-	// Open source file
-	in, err := os.Open(src)
-	if err != nil {
-		return err
+// isInternal reports whether path is one of the files FileSync
+// itself maintains, which must never be synced or deleted.
+func (fs *FileSync) isInternal(path string) bool {
+	if fs.retainsOrphans() && samePath(path, fs.retentionFile()) {
+		return true
+	}
+	if len(fs.transforms) > 0 && samePath(path, fs.transformFile()) {
+		return true
+	}
+	if fs.checksums != nil && samePath(path, fs.checksumCacheFile()) {
+		return true
 	}
-	defer in.Close()
+	if fs.verifyEvery > 0 && samePath(path, fs.runCountFile()) {
+		return true
+	}
+	if fs.dropGuard > 0 && anyShardFile(path, filepath.Join(fs.target, sourceCountName)) {
+		return true
+	}
+	if fs.manifest != nil && samePath(path, fs.manifestFile()) {
+		return true
+	}
+	if fs.bidirectional && samePath(path, fs.bidirFile()) {
+		return true
+	}
+	if fs.journal && samePath(path, fs.journalFile()) {
+		return true
+	}
+	if fs.lock && samePath(path, fs.lockFile()) {
+		return true
+	}
+	if samePath(path, fs.probeFile()) {
+		return true
+	}
+	if fs.atomicCopy && isPartialName(filepath.Base(path)) {
+		return true
+	}
+	if fs.trash && fs.inTrashDir(path) {
+		return true
+	}
+	return false
+}
 
-	// Create or truncate target file
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
+// makeDir creates dir (and any missing parents) in the target.
+// With a configured directory mode the new directories get exactly
+// that mode, regardless of the process umask, and with
+// WithPermissionsFrom the reference owner.
+func (fs *FileSync) makeDir(dir string) error {
+	mode := fs.targetDirMode()
+	if mode == 0 && !fs.chownTargets() {
+		return fs.tgtFS.MkdirAll(dir, 0755)
+	}
+	if _, err := fs.tgtFS.Stat(dir); err == nil {
+		return nil
 	}
-	defer out.Close()
 
-	// Copy contents
-	if _, err = io.Copy(out, in); err != nil {
+	// Find the topmost missing ancestor so all new dirs get the mode
+	top := dir
+	for {
+		parent := filepath.Dir(top)
+		if parent == top {
+			break
+		}
+		if _, err := fs.tgtFS.Stat(parent); err == nil {
+			break
+		}
+		top = parent
+	}
+	if err := fs.tgtFS.MkdirAll(dir, cmp.Or(mode, 0755)); err != nil {
 		return err
 	}
+	for p := dir; ; p = filepath.Dir(p) {
+		if mode != 0 {
+			if err := fs.tgtFS.Chmod(p, mode); err != nil {
+				return err
+			}
+		}
+		fs.applyOwner(fs.tgtFS, p)
+		if p == top {
+			break
+		}
+	}
+	return nil
+}
 
-	// Preserve modification time from source
-	if srcInfo, err := os.Stat(src); err == nil {
-		os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+// workerCount returns the configured number of workers,
+// defaulting to one per CPU.
+func (fs *FileSync) workerCount() int {
+	if fs.workers > 0 {
+		return fs.workers
 	}
+	return runtime.NumCPU()
+}
 
-	return nil
+// samePath compares two paths after cleaning and making them absolute.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
 }
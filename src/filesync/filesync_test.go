@@ -1,6 +1,8 @@
 package filesync
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -129,3 +131,297 @@ func benchmarkFileSync(b *testing.B, n int) {
 		}
 	}
 }
+
+func TestFileSync_FileReplacedByDir(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	// target has a plain file where source now has a directory
+	writeTestFile(t, filepath.Join(src, "entry", "inner.txt"), "inner", time.Now())
+	writeTestFile(t, filepath.Join(dst, "entry"), "stale file", time.Now())
+
+	fs := NewFileSync(src, dst, false)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "entry"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Fatal("expected entry to be a directory")
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "entry", "inner.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "inner" {
+		t.Errorf("expected inner, got %s", data)
+	}
+}
+
+func TestFileSync_DirReplacedByFile(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	// target has a populated directory where source now has a file
+	writeTestFile(t, filepath.Join(src, "entry"), "now a file", time.Now())
+	writeTestFile(t, filepath.Join(dst, "entry", "old", "deep.txt"), "old", time.Now())
+
+	fs := NewFileSync(src, dst, false)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "entry"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDir() {
+		t.Fatal("expected entry to be a regular file")
+	}
+	data, _ := os.ReadFile(filepath.Join(dst, "entry"))
+	if string(data) != "now a file" {
+		t.Errorf("expected file content, got %s", data)
+	}
+}
+
+func TestFileSync_FailOnAccessError(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeTestFile(t, filepath.Join(src, "ok.txt"), "ok", time.Now())
+	// a dangling symlink cannot be stat'ed
+	if err := os.Symlink(filepath.Join(tmp, "missing"), filepath.Join(src, "broken")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	lenient := NewFileSync(src, dst, false)
+	if err := lenient.SyncDirs(); err != nil {
+		t.Errorf("expected lenient sync to succeed, got %v", err)
+	}
+
+	strict := NewFileSync(src, dst, false, WithFailOnAccessError(true))
+	if err := strict.SyncDirs(); err == nil {
+		t.Error("expected strict sync to fail on unreadable source entry")
+	}
+}
+
+func TestFileSync_FailOnAccessErrorMissingSource(t *testing.T) {
+	fs := NewFileSync("nonexistent", t.TempDir(), false, WithFailOnAccessError(true))
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("expected error for missing source")
+	}
+}
+
+func TestFileSync_Idempotent(t *testing.T) {
+	modes := map[string][]Option{
+		"default":  nil,
+		"atomic":   {WithAtomicCopy(true)},
+		"checksum": {WithChecksum(true)},
+		"modes":    {WithFileMode(0664), WithDirMode(0775), WithPreallocate(true)},
+	}
+
+	for name, opts := range modes {
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+
+			// sub-second mod times are the usual source of spurious recopies
+			now := time.Now()
+			writeTestFile(t, filepath.Join(src, "a.txt"), "a", now)
+			writeTestFile(t, filepath.Join(src, "empty.txt"), "", now.Add(-time.Minute))
+			writeTestFile(t, filepath.Join(src, "dir", "b.txt"), "bb", now.Add(-1500*time.Millisecond))
+
+			fs := NewFileSync(src, dst, true, opts...)
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if n := fs.Stats().FilesCopied; n != 3 {
+				t.Fatalf("expected 3 files copied on first run, got %d", n)
+			}
+
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			stats := fs.Stats()
+			if stats.FilesCopied != 0 || stats.FilesDeleted != 0 || stats.DirsCreated != 0 {
+				t.Errorf("expected second run to be a no-op, got %+v", stats)
+			}
+			if stats.FilesSkipped != 3 {
+				t.Errorf("expected 3 files skipped, got %d", stats.FilesSkipped)
+			}
+		})
+	}
+}
+
+func TestFileSync_SourcePathForms(t *testing.T) {
+	sep := string(filepath.Separator)
+	cases := []struct {
+		name   string
+		source func(src string) string
+		rsync  bool
+		want   string // where a.txt ends up, relative to the target
+	}{
+		{"plain", func(src string) string { return src }, false, "a.txt"},
+		{"trailing slash", func(src string) string { return src + sep }, false, "a.txt"},
+		{"unclean", func(src string) string { return src + sep + sep + "sub" + sep + ".." + sep }, false, "a.txt"},
+		{"rsync contents", func(src string) string { return src + sep }, true, "a.txt"},
+		{"rsync directory", func(src string) string { return src }, true, filepath.Join("src", "a.txt")},
+		{"rsync dot contents", func(src string) string { return src + sep + "." }, true, "a.txt"},
+		{"rsync unclean directory", func(src string) string { return src + sep + "sub" + sep + ".." }, true, filepath.Join("src", "a.txt")},
+	}
+	nestCases := []struct {
+		name   string
+		source func(src string) string
+		want   string
+	}{
+		{"nest", func(src string) string { return src }, filepath.Join("src", "a.txt")},
+		{"nest trailing slash", func(src string) string { return src + sep }, filepath.Join("src", "a.txt")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+			if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			fs := NewFileSync(tc.source(src), dst+sep, false, WithRsyncSlashes(tc.rsync))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(dst, tc.want)); err != nil {
+				t.Errorf("expected %s in target: %v", tc.want, err)
+			}
+		})
+	}
+	for _, tc := range nestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+
+			fs := NewFileSync(tc.source(src), dst, false, WithNestSourceDir(true))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(dst, tc.want)); err != nil {
+				t.Errorf("expected %s in target: %v", tc.want, err)
+			}
+			if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+				t.Errorf("contents should not land in the target root, stat err = %v", err)
+			}
+		})
+	}
+}
+
+func TestFileSync_RsyncSlashesMergedSources(t *testing.T) {
+	tmp := t.TempDir()
+	sep := string(filepath.Separator)
+	writeTestFile(t, filepath.Join(tmp, "a", "x.txt"), "x", time.Now())
+	writeTestFile(t, filepath.Join(tmp, "b", "y.txt"), "y", time.Now())
+
+	fs := NewFileSync(filepath.Join(tmp, "a"), filepath.Join(tmp, "dst"), false, WithRsyncSlashes(true))
+	fs.AddSource(filepath.Join(tmp, "b") + sep)
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("expected an error for a merged source without a trailing slash")
+	}
+
+	fs = NewFileSync(filepath.Join(tmp, "a")+sep, filepath.Join(tmp, "dst"), false, WithRsyncSlashes(true))
+	fs.AddSource(filepath.Join(tmp, "b") + sep)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"x.txt", "y.txt"} {
+		if _, err := os.Stat(filepath.Join(tmp, "dst", name)); err != nil {
+			t.Errorf("expected %s in target: %v", name, err)
+		}
+	}
+}
+
+func TestFileSync_MaxFilesPerRun(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	for i := 0; i < 5; i++ {
+		writeTestFile(t, filepath.Join(src, fmt.Sprintf("f%d.txt", i)), "x", time.Now())
+	}
+	writeTestFile(t, filepath.Join(dst, "orphan1.txt"), "x", time.Now())
+	writeTestFile(t, filepath.Join(dst, "orphan2.txt"), "x", time.Now())
+	writeTestFile(t, filepath.Join(dst, "orphan3.txt"), "x", time.Now())
+
+	fs := NewFileSync(src, dst, true, WithMaxFilesPerRun(2))
+	for run, want := range []Stats{
+		{FilesCopied: 2, FilesDeleted: 3, Truncated: true, FilesRemaining: 3},
+		{FilesCopied: 2, FilesSkipped: 2, Truncated: true, FilesRemaining: 1},
+		{FilesCopied: 1, FilesSkipped: 4},
+	} {
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		got := fs.Stats()
+		if got.FilesCopied != want.FilesCopied || got.FilesSkipped != want.FilesSkipped ||
+			got.FilesDeleted != want.FilesDeleted || got.Truncated != want.Truncated ||
+			got.FilesRemaining != want.FilesRemaining {
+			t.Errorf("run %d: stats = %+v, want %+v", run+1, got, want)
+		}
+	}
+
+	entries, _ := os.ReadDir(dst)
+	if len(entries) != 5 {
+		t.Errorf("expected 5 files in target after three runs, got %d", len(entries))
+	}
+}
+
+func TestFileSync_SyncDirsContext(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeTestFile(t, filepath.Join(src, name), name, old)
+	}
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", old)
+
+	// Interrupted while the first file is being copied
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs := NewFileSync(src, dst, true, WithAtomicCopy(true), WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+		cancel()
+		return true, nil
+	}))
+	if err := fs.SyncDirsContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SyncDirsContext() = %v, want context.Canceled", err)
+	}
+	if got := fs.Stats().FilesCopied; got != 1 {
+		t.Errorf("FilesCopied = %d, want the file in progress only", got)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "a.txt")); got != "a.txt" {
+		t.Errorf("a.txt = %q", got)
+	}
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("target holds %d entries, want a.txt and the orphan, which is not deleted", len(entries))
+	}
+
+	// Without the interruption the next run completes the sync
+	fs = NewFileSync(src, dst, true)
+	if err := fs.SyncDirsContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 2 || stats.FilesDeleted != 1 {
+		t.Errorf("copied %d and deleted %d file(s), want 2 and 1", stats.FilesCopied, stats.FilesDeleted)
+	}
+}
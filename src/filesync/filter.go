@@ -0,0 +1,102 @@
+package filesync
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how much of a file content type detection reads.
+const sniffLen = 512
+
+// defaultContentMatchBytes is how much of a file WithContentMatch
+// searches when no limit is given.
+const defaultContentMatchBytes = 64 << 10
+
+// excluded reports whether relPath should be left out of the sync,
+// either because .syncignore rules exclude it or because it does not
+// pass the configured filters. Excluded entries are neither copied
+// nor deleted from the target, which also keeps the files of other
+// WithShard nodes apart from delete-missing. The ignore files themselves are
+// excluded unless copyIgnoreFiles is set.
+func (fs *FileSync) excluded(ignores *ignoreSet, relPath string, isDir bool) bool {
+	if relPath == "." {
+		return false
+	}
+	if !isDir && !fs.copyIgnoreFiles && filepath.Base(relPath) == syncIgnoreName {
+		return true
+	}
+	if !isDir && (!fs.extensionAllowed(relPath) || !fs.inShard(relPath)) {
+		return true
+	}
+	return ignores.ignored(relPath, isDir)
+}
+
+// extensionAllowed reports whether the file's extension is in the
+// allowlist. An empty allowlist allows every extension.
+func (fs *FileSync) extensionAllowed(relPath string) bool {
+	if len(fs.extensions) == 0 {
+		return true
+	}
+	return fs.extensions[strings.ToLower(filepath.Ext(relPath))]
+}
+
+// normalizeExtension lowercases ext and ensures a leading dot,
+// so "JPG", ".jpg" and "jpg" are equivalent.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// contentExcluded reports whether the regular file at path on fsys is
+// left out because its detected content type matches none of
+// WithContentTypes, or the start of its content does not match
+// WithContentMatch. Both are checked from one read of the file's
+// first bytes. Files that cannot be read are not excluded, so the
+// error surfaces when they are copied.
+func (fs *FileSync) contentExcluded(fsys FS, path string, d os.DirEntry) bool {
+	if len(fs.contentTypes) == 0 && fs.contentMatch == nil || !d.Type().IsRegular() {
+		return false
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	size := sniffLen
+	if fs.contentMatch != nil {
+		size = max(size, fs.contentMatchBytes)
+	}
+	buf := make([]byte, size)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	if len(fs.contentTypes) > 0 && !contentTypeMatches(fs.contentTypes, http.DetectContentType(buf[:min(n, sniffLen)])) {
+		return true
+	}
+	return fs.contentMatch != nil && !fs.contentMatch.Match(buf[:min(n, fs.contentMatchBytes)])
+}
+
+// contentTypeMatches reports whether the detected type, without its
+// parameters, matches one of the patterns: a full type such as
+// "application/pdf" or a whole family such as "image/*".
+func contentTypeMatches(patterns []string, detected string) bool {
+	detected, _, _ = strings.Cut(detected, ";")
+	detected = strings.ToLower(strings.TrimSpace(detected))
+	for _, pattern := range patterns {
+		if family, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(detected, family+"/") {
+				return true
+			}
+		} else if detected == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Extensions(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(src, "photo.JPG"), "jpg", now)
+	writeTestFile(t, filepath.Join(src, "album", "shot.png"), "png", now)
+	writeTestFile(t, filepath.Join(src, "notes.txt"), "txt", now)
+	// non-matching orphan in target must survive delete-missing
+	writeTestFile(t, filepath.Join(dst, "readme.md"), "md", now)
+	// matching orphan is still removed
+	writeTestFile(t, filepath.Join(dst, "old.mp4"), "mp4", now)
+
+	fs := NewFileSync(src, dst, true, WithExtensions("jpg", ".PNG", "mp4"))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"photo.JPG", "album/shot.png", "readme.md"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Errorf("expected %s in target", p)
+		}
+	}
+	for _, p := range []string{"notes.txt", "old.mp4"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be absent from target", p)
+		}
+	}
+}
+
+func TestNormalizeExtension(t *testing.T) {
+	for in, want := range map[string]string{
+		"jpg":   ".jpg",
+		".JPG":  ".jpg",
+		" png ": ".png",
+		"":      "",
+	} {
+		if got := normalizeExtension(in); got != want {
+			t.Errorf("normalizeExtension(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFileSync_ContentTypes(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	gif := "GIF89a\x01\x00\x01\x00"
+
+	// Misnamed files are judged by their content
+	writeTestFile(t, filepath.Join(src, "photo.dat"), png, now)
+	writeTestFile(t, filepath.Join(src, "album", "anim.txt"), gif, now)
+	writeTestFile(t, filepath.Join(src, "fake.png"), "just text", now)
+	// non-matching orphan in target must survive delete-missing
+	writeTestFile(t, filepath.Join(dst, "readme.md"), "# readme", now)
+	// matching orphan is still removed
+	writeTestFile(t, filepath.Join(dst, "old.png"), png, now)
+
+	fs := NewFileSync(src, dst, true, WithContentTypes("image/*"))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"photo.dat", "album/anim.txt", "readme.md"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Errorf("expected %s in target", p)
+		}
+	}
+	for _, p := range []string{"fake.png", "old.png"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be absent from target", p)
+		}
+	}
+}
+
+func TestContentTypeMatches(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		detected string
+		want     bool
+	}{
+		{[]string{"image/*"}, "image/png", true},
+		{[]string{"image/*"}, "text/plain; charset=utf-8", false},
+		{[]string{"text/plain"}, "text/plain; charset=utf-8", true},
+		{[]string{"application/pdf", "image/*"}, "application/pdf", true},
+		{[]string{"image/*"}, "imagex/png", false},
+	} {
+		if got := contentTypeMatches(tc.patterns, tc.detected); got != tc.want {
+			t.Errorf("contentTypeMatches(%v, %q) = %v, want %v", tc.patterns, tc.detected, got, tc.want)
+		}
+	}
+}
+
+func TestFileSync_ModifiedSince(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	cutoff := time.Now().Add(-time.Hour)
+
+	writeTestFile(t, filepath.Join(src, "fresh.txt"), "fresh", cutoff.Add(time.Minute))
+	writeTestFile(t, filepath.Join(src, "stale.txt"), "stale", cutoff.Add(-time.Minute))
+	// an old file that differs from its target copy is left alone too
+	writeTestFile(t, filepath.Join(src, "kept.txt"), "new", cutoff.Add(-time.Minute))
+	writeTestFile(t, filepath.Join(dst, "kept.txt"), "old", cutoff.Add(-time.Hour))
+	// deletions do not depend on the cutoff
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", cutoff.Add(time.Minute))
+
+	fs := NewFileSync(src, dst, true, WithModifiedSince(cutoff))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := fs.Stats(); stats.FilesCopied != 1 || stats.FilesTooOld != 2 {
+		t.Errorf("copied %d, too old %d; want 1 and 2", stats.FilesCopied, stats.FilesTooOld)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "kept.txt")); got != "old" {
+		t.Errorf("kept.txt = %q, want the untouched target copy", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "stale.txt")); !os.IsNotExist(err) {
+		t.Error("stale.txt should not have been copied")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "orphan.txt")); !os.IsNotExist(err) {
+		t.Error("orphan.txt should have been deleted")
+	}
+}
+
+func TestFileSync_ContentMatch(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(src, "app.log"), "started\nERROR disk full\n", now)
+	writeTestFile(t, filepath.Join(src, "quiet.log"), "started\nstopped\n", now)
+	// The marker lies past the searched prefix
+	writeTestFile(t, filepath.Join(src, "late.log"), strings.Repeat("x", 64)+"ERROR", now)
+	// non-matching orphan in target must survive delete-missing
+	writeTestFile(t, filepath.Join(dst, "notes.txt"), "nothing here", now)
+	// matching orphan is still removed
+	writeTestFile(t, filepath.Join(dst, "old.log"), "ERROR gone", now)
+
+	fs := NewFileSync(src, dst, true, WithContentMatch(regexp.MustCompile(`ERROR`), 32))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"app.log", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Errorf("expected %s in target", p)
+		}
+	}
+	for _, p := range []string{"quiet.log", "late.log", "old.log"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be absent from target", p)
+		}
+	}
+}
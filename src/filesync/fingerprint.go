@@ -0,0 +1,129 @@
+package filesync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fingerprintTimeout is how long the WithFingerprintCmd command may run
+// for one file before it is killed.
+const fingerprintTimeout = time.Minute
+
+// fingerprintEntry is the fingerprint of a file as it was at the
+// given size and mod time.
+type fingerprintEntry struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// fingerprintCache remembers the output of the WithFingerprintCmd
+// command by path, for as long as the FileSync lives (across Watch
+// runs, say).
+type fingerprintCache struct {
+	mu     sync.Mutex
+	prints map[string]fingerprintEntry
+}
+
+// fingerprintArgs expands the WithFingerprintCmd template for path:
+// the template is split into words like a shell would without quotes,
+// and every {} word becomes the path, or the path is appended when
+// there is none. No shell is involved, so names need no escaping.
+func fingerprintArgs(template, path string) []string {
+	words := strings.Fields(template)
+	placed := false
+	for i, word := range words {
+		if word == "{}" {
+			words[i] = path
+			placed = true
+		}
+	}
+	if !placed {
+		words = append(words, path)
+	}
+	return words
+}
+
+// fingerprint returns the fingerprint of a local file, running the
+// command unless the cache has one for this size and mod time.
+func (fs *FileSync) fingerprint(path string, info os.FileInfo) (string, error) {
+	c := fs.fingerprints
+	c.mu.Lock()
+	entry, ok := c.prints[path]
+	c.mu.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.sum, nil
+	}
+
+	// A hanging command must not hang the run, which may also be
+	// cancelled meanwhile
+	ctx, cancel := context.WithTimeout(fs.hashContext(), fingerprintTimeout)
+	defer cancel()
+	args := fingerprintArgs(fs.fingerprintCmd, path)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	// Children left holding the output open are not waited for long
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("no fingerprint after %v", fingerprintTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	sum := strings.TrimSpace(string(out))
+	if sum == "" {
+		return "", errors.New("empty fingerprint")
+	}
+	c.mu.Lock()
+	c.prints[path] = fingerprintEntry{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	c.mu.Unlock()
+	return sum, nil
+}
+
+// forgetFingerprint drops the cached fingerprint of a file about to be
+// overwritten, since the copy may keep its size and get the mod time
+// the old content had.
+func (fs *FileSync) forgetFingerprint(path string) {
+	if c := fs.fingerprints; c != nil {
+		c.mu.Lock()
+		delete(c.prints, path)
+		c.mu.Unlock()
+	}
+}
+
+// compareFingerprints compares a source file with its target copy by
+// their WithFingerprintCmd fingerprints. ok is false when that is not
+// possible, because a side is not local or the command failed, and
+// the default comparator should decide instead.
+func (fs *FileSync) compareFingerprints(srcPath, tgtPath string, src, tgt os.FileInfo) (reason DiffReason, ok bool) {
+	_, localSrc := fs.srcFS.(osFS)
+	_, localTgt := fs.tgtFS.(osFS)
+	if !localSrc || !localTgt {
+		return "", false
+	}
+	a, err := fs.fingerprint(srcPath, src)
+	if err == nil {
+		var b string
+		if b, err = fs.fingerprint(tgtPath, tgt); err == nil {
+			if a != b {
+				return ReasonContent, true
+			}
+			return "", true
+		}
+	}
+	log.Printf("⚠️ Fingerprint command failed for %q, comparing as usual: %v", srcPath, err)
+	return "", false
+}
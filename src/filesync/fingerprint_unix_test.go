@@ -0,0 +1,101 @@
+//go:build unix
+
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFingerprintArgs(t *testing.T) {
+	for _, tc := range []struct {
+		template string
+		want     []string
+	}{
+		{"phash {}", []string{"phash", "/a b.jpg"}},
+		{"phash --quiet", []string{"phash", "--quiet", "/a b.jpg"}},
+		{"cmp {} {}", []string{"cmp", "/a b.jpg", "/a b.jpg"}},
+	} {
+		if got := fingerprintArgs(tc.template, "/a b.jpg"); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("fingerprintArgs(%q) = %q, want %q", tc.template, got, tc.want)
+		}
+	}
+}
+
+func TestFileSync_FingerprintCmd(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	// The fingerprint is the first three bytes, and each run of the
+	// command is counted
+	script := filepath.Join(tmp, "print.sh")
+	counter := filepath.Join(tmp, "runs")
+	writeTestFile(t, script, "#!/bin/sh\necho run >> "+counter+"\nhead -c 3 \"$1\"\n", old)
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src, "same.jpg"), "abc re-encoded", old.Add(time.Minute))
+	writeTestFile(t, filepath.Join(dst, "same.jpg"), "abc original", old)
+	writeTestFile(t, filepath.Join(src, "changed.jpg"), "xyz", old)
+	writeTestFile(t, filepath.Join(dst, "changed.jpg"), "abc", old)
+
+	fs := NewFileSync(src, dst, false, WithFingerprintCmd(script+" {}"))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs() = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "same.jpg")); got != "abc original" {
+		t.Errorf("same.jpg = %q, a file with an equal fingerprint was copied", got)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "changed.jpg")); got != "xyz" {
+		t.Errorf("changed.jpg = %q, want the source copy", got)
+	}
+	runs := strings.Count(readTestFile(t, counter), "run")
+
+	// Unchanged files are not fingerprinted twice
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("second SyncDirs() = %v", err)
+	}
+	// changed.jpg has a new target copy, hence one more run
+	if n := strings.Count(readTestFile(t, counter), "run"); n != runs+1 {
+		t.Errorf("command ran %d more time(s) on the second run, want 1", n-runs)
+	}
+
+	// A failing command falls back to size and mod time
+	fs = NewFileSync(src, dst, false, WithFingerprintCmd("false"))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs() with a failing command = %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "same.jpg")); got != "abc re-encoded" {
+		t.Errorf("same.jpg = %q, want it copied by the default comparator", got)
+	}
+}
+
+func TestFileSync_FingerprintCmdCancelled(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	script := filepath.Join(tmp, "hang.sh")
+	writeTestFile(t, script, "#!/bin/sh\nsleep 60\n", old)
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src, "a.jpg"), "abc", old)
+	writeTestFile(t, filepath.Join(dst, "a.jpg"), "abc", old)
+
+	// The hanging command is killed with the run
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	fs := NewFileSync(src, dst, false, WithFingerprintCmd(script+" {}"))
+	start := time.Now()
+	fs.SyncDirsContext(ctx)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("cancelled run took %v, the fingerprint command was not stopped", elapsed)
+	}
+}
@@ -0,0 +1,73 @@
+package filesync
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// removeEntry removes the file or empty directory path from fsys.
+// With WithForce, a permission error is retried once after making the
+// entry and its parent directory writable.
+func (fs *FileSync) removeEntry(fsys FS, path string) error {
+	err := fsys.Remove(path)
+	if err != nil && fs.makeWritable(fsys, err, path, filepath.Dir(path)) {
+		err = fsys.Remove(path)
+	}
+	return err
+}
+
+// removeTree removes path and everything below it from fsys, making
+// the whole subtree writable first on a permission error with
+// WithForce.
+func (fs *FileSync) removeTree(fsys FS, path string) error {
+	err := fsys.RemoveAll(path)
+	if err == nil || !fs.force || !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	paths := []string{filepath.Dir(path)}
+	_ = walkDir(fsys, path, func(p string, d os.DirEntry, err error) error {
+		if err == nil {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if fs.makeWritable(fsys, err, paths...) {
+		err = fsys.RemoveAll(path)
+	}
+	return err
+}
+
+// createTarget creates or truncates path on fsys for writing, making
+// a read-only file (or its directory) writable first with WithForce.
+func (fs *FileSync) createTarget(fsys FS, path string) (File, error) {
+	f, err := createFile(fsys, path)
+	if err != nil && fs.makeWritable(fsys, err, path, filepath.Dir(path)) {
+		f, err = createFile(fsys, path)
+	}
+	return f, err
+}
+
+// makeWritable handles a permission error err under WithForce by
+// adding the owner write bit to those of paths that lack it. It
+// reports whether anything changed, and so whether a retry may work.
+func (fs *FileSync) makeWritable(fsys FS, err error, paths ...string) bool {
+	if !fs.force || !errors.Is(err, os.ErrPermission) {
+		return false
+	}
+	changed := false
+	for _, path := range paths {
+		info, statErr := fsys.Lstat(path)
+		if statErr != nil || info.Mode()&os.ModeSymlink != 0 || info.Mode().Perm()&0200 != 0 {
+			continue
+		}
+		if chErr := fsys.Chmod(path, info.Mode().Perm()|0200); chErr != nil {
+			log.Printf("❌ Could not make %q writable: %v", path, chErr)
+			continue
+		}
+		log.Printf("🔓 Made writable: %q", path)
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,82 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// strictFS is a local FS that enforces write permission bits even
+// when the tests run as root: read-only files cannot be opened for
+// writing or removed, and read-only directories cannot be changed.
+type strictFS struct{ FS }
+
+func (s strictFS) writable(path string) bool {
+	info, err := s.FS.Lstat(path)
+	return err != nil || info.Mode().Perm()&0200 != 0
+}
+
+func (s strictFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 && (!s.writable(name) || !s.writable(filepath.Dir(name))) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return s.FS.OpenFile(name, flag, perm)
+}
+
+func (s strictFS) Remove(name string) error {
+	if !s.writable(name) || !s.writable(filepath.Dir(name)) {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+	}
+	return s.FS.Remove(name)
+}
+
+func TestFileSync_ForceReadOnlyTargets(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		writeTestFile(t, filepath.Join(src, "update.txt"), "new", time.Now())
+		writeTestFile(t, filepath.Join(dst, "update.txt"), "old", time.Now().Add(-time.Hour))
+		writeTestFile(t, filepath.Join(dst, "archive", "orphan.txt"), "orphan", time.Now())
+		for _, path := range []string{"update.txt", filepath.Join("archive", "orphan.txt"), "archive"} {
+			mode := os.FileMode(0444)
+			if path == "archive" {
+				mode = 0555
+			}
+			if err := os.Chmod(filepath.Join(dst, path), mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+		t.Cleanup(func() { os.Chmod(filepath.Join(dst, "archive"), 0755) })
+
+		fs := NewFileSync(src, dst, true, WithTargetFS(strictFS{LocalFS()}), WithForce(force))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := os.ReadFile(filepath.Join(dst, "update.txt"))
+		_, statErr := os.Stat(filepath.Join(dst, "archive", "orphan.txt"))
+		if force {
+			if err := fs.Stats().Err(); err != nil {
+				t.Errorf("force: unexpected errors: %v", err)
+			}
+			if string(data) != "new" {
+				t.Errorf("force: update.txt = %q, want new", data)
+			}
+			if !os.IsNotExist(statErr) {
+				t.Errorf("force: read-only orphan should be gone, stat err = %v", statErr)
+			}
+		} else {
+			if len(fs.Stats().Errors) == 0 {
+				t.Error("expected the read-only update to be reported")
+			}
+			if string(data) != "old" {
+				t.Errorf("update.txt = %q, want the old contents kept", data)
+			}
+			if statErr != nil {
+				t.Errorf("read-only orphan should be kept: %v", statErr)
+			}
+		}
+	}
+}
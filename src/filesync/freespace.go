@@ -0,0 +1,37 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrInsufficientSpace reports a file that was not copied because the
+// target filesystem lacks the space for it (see WithFreeSpaceCheck).
+var ErrInsufficientSpace = errors.New("not enough free space on target")
+
+// checkFreeSpace reports ErrInsufficientSpace if copying size bytes to
+// dst would leave less than the configured reserve free. Targets whose
+// free space cannot be determined, such as remote ones, always pass.
+func (fs *FileSync) checkFreeSpace(dst string, size int64) error {
+	if _, local := baseFS(fs.tgtFS).(osFS); !local {
+		return nil
+	}
+	// The file's directory may not exist yet; ask the nearest ancestor
+	dir := filepath.Dir(dst)
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	free, ok := freeSpace(dir)
+	if !ok {
+		return nil
+	}
+	if need := uint64(size) + uint64(fs.spaceReserve); free < need {
+		return fmt.Errorf("%s: %w (%d bytes free, %d needed)", dst, ErrInsufficientSpace, free, need)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_FreeSpaceCheck(t *testing.T) {
+	if _, ok := freeSpace(t.TempDir()); !ok {
+		t.Skip("free space cannot be queried on this platform")
+	}
+	const huge = 1 << 60
+
+	cases := []struct {
+		name      string
+		opts      []Option
+		wantErr   bool
+		wantFiles int
+		wantSkip  bool // listed in NoSpace
+	}{
+		{"enough space", []Option{WithFreeSpaceCheck(true)}, false, 1, false},
+		{"reserve too large", []Option{WithFreeSpaceCheck(true), WithFreeSpaceReserve(huge)}, false, 0, true},
+		{"abort", []Option{WithFreeSpaceCheck(true), WithFreeSpaceReserve(huge), WithAbortOnLowSpace(true)}, true, 0, false},
+		{"disabled", []Option{WithFreeSpaceReserve(huge)}, false, 1, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			writeTestFile(t, filepath.Join(src, "sub", "a.txt"), "hello", time.Now())
+
+			fs := NewFileSync(src, dst, false, tc.opts...)
+			err := fs.SyncDirs()
+			if got := errors.Is(err, ErrInsufficientSpace); got != tc.wantErr {
+				t.Fatalf("SyncDirs() = %v, want ErrInsufficientSpace=%v", err, tc.wantErr)
+			}
+			if got := fs.Stats().FilesCopied; got != tc.wantFiles {
+				t.Errorf("FilesCopied = %d, want %d", got, tc.wantFiles)
+			}
+
+			_, statErr := os.Stat(filepath.Join(dst, "sub", "a.txt"))
+			if copied := statErr == nil; copied != (tc.wantFiles == 1) {
+				t.Errorf("target file exists = %v, want %v", copied, tc.wantFiles == 1)
+			}
+			if tc.wantSkip {
+				stats := fs.Stats()
+				if want := []string{filepath.Join("sub", "a.txt")}; !reflect.DeepEqual(stats.NoSpace, want) {
+					t.Errorf("NoSpace = %v, want %v", stats.NoSpace, want)
+				}
+				if !errors.Is(stats.Err(), ErrInsufficientSpace) {
+					t.Errorf("Err() = %v, want ErrInsufficientSpace", stats.Err())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package filesync
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is the set of filesystem operations FileSync performs on the
+// source and target trees. The default implementation uses the local
+// operating system; see NewSFTPFS for a remote one.
+//
+// Paths are passed exactly as FileSync builds them with filepath,
+// so remote implementations must accept the local path syntax.
+type FS interface {
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	MkdirAll(name string, perm os.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldname, newname string) error
+	Link(oldname, newname string) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// File is an open file on an FS.
+type File interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Seek(offset int64, whence int) (int64, error)
+	Close() error
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Sync() error
+}
+
+// osFS implements FS with the local operating system. Long paths are
+// passed in extended-length form on Windows, so deep trees do not hit
+// the MAX_PATH limit.
+type osFS struct{}
+
+// LocalFS returns the FS backed by the local operating system,
+// which FileSync uses unless told otherwise.
+func LocalFS() FS { return osFS{} }
+
+func (osFS) Open(name string) (File, error) {
+	f, err := os.Open(longPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(longPath(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error)      { return os.Stat(longPath(name)) }
+func (osFS) Lstat(name string) (os.FileInfo, error)     { return os.Lstat(longPath(name)) }
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(longPath(name)) }
+func (osFS) Remove(name string) error                   { return os.Remove(longPath(name)) }
+func (osFS) RemoveAll(name string) error                { return os.RemoveAll(longPath(name)) }
+
+func (osFS) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(longPath(name), perm)
+}
+
+func (osFS) Rename(oldname, newname string) error {
+	return os.Rename(longPath(oldname), longPath(newname))
+}
+
+func (osFS) Link(oldname, newname string) error {
+	return os.Link(longPath(oldname), longPath(newname))
+}
+
+func (osFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(longPath(name), mode)
+}
+
+func (osFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(longPath(name), atime, mtime)
+}
+
+func (osFS) Chown(name string, uid, gid int) error {
+	return os.Chown(longPath(name), uid, gid)
+}
+
+func (osFS) Readlink(name string) (string, error) {
+	return os.Readlink(longPath(name))
+}
+
+func (osFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, longPath(newname))
+}
+
+// createFile creates or truncates name on fsys, like os.Create.
+func createFile(fsys FS, name string) (File, error) {
+	return fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// readFile reads the whole file name from fsys, like os.ReadFile.
+func readFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// writeFile writes data to name on fsys, like os.WriteFile.
+func writeFile(fsys FS, name string, data []byte) error {
+	f, err := createFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// stateFS returns the filesystem of a state file kept for the next
+// run: one at a path named by an option is a local file, even when
+// the target is remote, while the default (an empty path) lives in
+// the target's root.
+func (fs *FileSync) stateFS(path string) FS {
+	if path != "" {
+		return LocalFS()
+	}
+	return fs.tgtFS
+}
+
+// walkDir walks the tree rooted at root on fsys with the semantics of
+// filepath.WalkDir: entries are visited in lexical order, and fn may
+// return filepath.SkipDir or filepath.SkipAll.
+func walkDir(fsys FS, root string, fn func(path string, d os.DirEntry, err error) error) error {
+	return walkDirOrdered(fsys, root, nil, fn)
+}
+
+// walkDirOrdered is walkDir visiting the entries of each directory in
+// the order of less, or lexical order if less is nil.
+func walkDirOrdered(fsys FS, root string, less func(a, b string) bool, fn func(path string, d os.DirEntry, err error) error) error {
+	if _, ok := fsys.(osFS); ok && less == nil {
+		return filepath.WalkDir(root, fn)
+	}
+	if less == nil {
+		less = func(a, b string) bool { return a < b }
+	}
+
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDirEntry(fsys, root, dirEntry{info}, less, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDirEntry visits path and, for directories, everything below it.
+func walkDirEntry(fsys FS, path string, d os.DirEntry, less func(a, b string) bool, fn func(string, os.DirEntry, error) error) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := fsys.ReadDir(path)
+	if err != nil {
+		// Second call, to report the ReadDir error
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return less(entries[i].Name(), entries[j].Name()) })
+
+	for _, entry := range entries {
+		if err := walkDirEntry(fsys, filepath.Join(path, entry.Name()), entry, less, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// foldedLess orders names case-insensitively, falling back to
+// lexical order for names that differ only in case, so the order
+// stays total and deterministic.
+func foldedLess(a, b string) bool {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	if la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+// dirEntry adapts an os.FileInfo to an os.DirEntry.
+type dirEntry struct {
+	info os.FileInfo
+}
+
+func (d dirEntry) Name() string               { return d.info.Name() }
+func (d dirEntry) IsDir() bool                { return d.info.IsDir() }
+func (d dirEntry) Type() os.FileMode          { return d.info.Mode().Type() }
+func (d dirEntry) Info() (os.FileInfo, error) { return d.info, nil }
@@ -0,0 +1,102 @@
+package filesync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SyncGitChanges runs one sync limited to the files of the source that
+// differ from the git commit ref, such as a branch, tag or "HEAD~3",
+// for fast incremental deploys from a work tree: instead of comparing
+// the whole tree, it asks git diff for the files changed since ref,
+// committed or not, adds the untracked files git does not ignore, and
+// syncs them as SyncPaths does. Files git reports deleted are removed
+// from the target with WithDeleteMissing, through the usual delete
+// pass; without it they are left alone. Paths are relative to the
+// source, which may be a subdirectory of the work tree.
+//
+// It needs git on the PATH and a single local source inside a git work
+// tree, and fails otherwise; like SyncPaths, it cannot be combined with
+// snapshots, directory swaps or two-way sync.
+func (fs *FileSync) SyncGitChanges(ref string) error {
+	if len(fs.extraSources) > 0 {
+		return errors.New("git changes can only be synced from a single source")
+	}
+	if _, local := fs.srcFS.(osFS); !local {
+		return errors.New("git changes can only be synced from a local source")
+	}
+	changed, deleted, err := gitChanges(fs.strippedRoot(fs.source), ref)
+	if err != nil {
+		return err
+	}
+	gone := make(map[string]bool, len(deleted))
+	for _, p := range deleted {
+		gone[filepath.Clean(filepath.FromSlash(p))] = true
+	}
+	if len(changed)+len(deleted) == 0 {
+		// An empty path list would sync the whole tree
+		log.Printf("✅ Nothing changed since %s", ref)
+		return nil
+	}
+	return fs.syncPaths(append(changed, deleted...), gone)
+}
+
+// gitChanges returns the paths below dir, relative to it, that differ
+// in dir's work tree from ref or are untracked, and those deleted
+// since ref. Renames count as a deletion and an addition.
+func gitChanges(dir, ref string) (changed, deleted []string, err error) {
+	if strings.HasPrefix(ref, "-") {
+		return nil, nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+	if _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil, nil, fmt.Errorf("source %s is not a git work tree: %w", dir, err)
+	}
+	if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return nil, nil, fmt.Errorf("git ref %q is not a commit in %s", ref, dir)
+	}
+
+	// Records of a status letter and a path, each NUL-terminated
+	out, err := runGit(dir, "diff", "--name-status", "--no-renames", "--relative", "-z", ref, "--")
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "D" {
+			deleted = append(deleted, fields[i+1])
+		} else {
+			changed = append(changed, fields[i+1])
+		}
+	}
+	out, err = runGit(dir, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range strings.Split(out, "\x00") {
+		if p != "" {
+			changed = append(changed, p)
+		}
+	}
+	return changed, deleted, nil
+}
+
+// runGit runs git with args in dir and returns its output, with git's
+// own message in the error on failure.
+func runGit(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,78 @@
+package filesync
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_SyncGitChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	past := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, ".gitignore"), "*.log\n", past)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", past)
+	writeTestFile(t, filepath.Join(src, "b.txt"), "b", past)
+	writeTestFile(t, filepath.Join(src, "sub", "c.txt"), "c", past)
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", src, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	if err := NewFileSync(src, dst, true).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Change, delete and add files, and tamper with an unchanged one
+	// in the target, which a full sync would put back
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a v2", time.Now())
+	if err := os.Remove(filepath.Join(src, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src, "sub", "d.txt"), "d", time.Now())
+	writeTestFile(t, filepath.Join(src, "debug.log"), "ignored", time.Now())
+	writeTestFile(t, filepath.Join(dst, "sub", "c.txt"), "tampered", time.Now())
+
+	fs := NewFileSync(src, dst, true)
+	if err := fs.SyncGitChanges("HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Stats().Err(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"a.txt": "a v2", "sub/d.txt": "d", "sub/c.txt": "tampered"} {
+		got, err := os.ReadFile(filepath.Join(dst, path))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	for _, path := range []string{"b.txt", "debug.log"} {
+		if _, err := os.Stat(filepath.Join(dst, path)); err == nil {
+			t.Errorf("expected %s not to be in the target", path)
+		}
+	}
+	if got := fs.Stats().FilesCopied; got != 2 {
+		t.Errorf("FilesCopied = %d, want 2", got)
+	}
+
+	if err := fs.SyncGitChanges("no-such-ref"); err == nil || !strings.Contains(err.Error(), "not a commit") {
+		t.Errorf("unknown ref: %v", err)
+	}
+	plain := t.TempDir()
+	err := NewFileSync(plain, dst, false).SyncGitChanges("HEAD")
+	if err == nil || !strings.Contains(err.Error(), "not a git work tree") {
+		t.Errorf("plain directory: %v", err)
+	}
+}
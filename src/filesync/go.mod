@@ -1,3 +1,13 @@
 module filesync
 
 go 1.25.0
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/pkg/sftp v1.13.10
+	golang.org/x/crypto v0.46.0
+	golang.org/x/sys v0.47.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/kr/fs v0.1.0 // indirect
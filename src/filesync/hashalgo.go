@@ -0,0 +1,99 @@
+package filesync
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// defaultHashAlgorithm is the checksum algorithm unless
+// WithHashAlgorithm picks another.
+const defaultHashAlgorithm = "sha256"
+
+// minDedupDigest is the digest size, in bytes, below which WithDedup
+// does not trust an algorithm to tell files apart.
+const minDedupDigest = 16
+
+// hashRegistry maps algorithm names, lowercased, to their
+// constructors; see RegisterHash.
+var hashRegistry = struct {
+	mu    sync.RWMutex
+	algos map[string]func() hash.Hash
+}{algos: map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"blake2b": func() hash.Hash {
+		h, _ := blake2b.New256(nil) // only fails for a key that is too long
+		return h
+	},
+}}
+
+// RegisterHash makes a checksum algorithm available to
+// WithHashAlgorithm under name, which is matched case-insensitively,
+// e.g. a BLAKE3 implementation as "blake3". Registering a name again
+// replaces the algorithm. It is safe to call from several goroutines,
+// but algorithms should be registered before syncs using them start.
+// The built-in algorithms are sha256, sha512, sha1, md5, crc32 and
+// blake2b (BLAKE2b-256).
+func RegisterHash(name string, fn func() hash.Hash) {
+	hashRegistry.mu.Lock()
+	defer hashRegistry.mu.Unlock()
+	hashRegistry.algos[strings.ToLower(name)] = fn
+}
+
+// HashAlgorithms returns the names of the registered checksum
+// algorithms, sorted.
+func HashAlgorithms() []string {
+	hashRegistry.mu.RLock()
+	defer hashRegistry.mu.RUnlock()
+	names := make([]string, 0, len(hashRegistry.algos))
+	for name := range hashRegistry.algos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hashAlgorithm returns the name of the configured checksum algorithm.
+func (fs *FileSync) hashAlgorithm() string {
+	if fs.hashAlgo == "" {
+		return defaultHashAlgorithm
+	}
+	return fs.hashAlgo
+}
+
+// checkHashAlgorithm reports a configured algorithm that is not
+// registered, or that is too weak for dedup, before any file is
+// hashed.
+func (fs *FileSync) checkHashAlgorithm() error {
+	hashRegistry.mu.RLock()
+	newHash, ok := hashRegistry.algos[fs.hashAlgorithm()]
+	hashRegistry.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown hash algorithm %q, want one of %s", fs.hashAlgorithm(), strings.Join(HashAlgorithms(), ", "))
+	}
+	if fs.dedup && newHash().Size() < minDedupDigest {
+		return fmt.Errorf("hash algorithm %q is too weak for dedup, which links files by digest alone", fs.hashAlgorithm())
+	}
+	return nil
+}
+
+// newHash returns a hash of the configured algorithm, which
+// checkHashAlgorithm has accepted.
+func (fs *FileSync) newHash() hash.Hash {
+	hashRegistry.mu.RLock()
+	defer hashRegistry.mu.RUnlock()
+	return hashRegistry.algos[fs.hashAlgorithm()]()
+}
@@ -0,0 +1,101 @@
+package filesync
+
+import (
+	"encoding/json"
+	"hash"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHashes counts the hashes of the "counting" algorithm, which
+// is CRC-32 underneath.
+var countingHashes atomic.Int32
+
+func init() {
+	RegisterHash("Counting", func() hash.Hash {
+		countingHashes.Add(1)
+		return crc32.NewIEEE()
+	})
+}
+
+func TestFileSync_HashAlgorithm(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	manifestPath := filepath.Join(tmp, "manifest.json")
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same", mtime)
+	writeTestFile(t, filepath.Join(dst, "same.txt"), "same", mtime)
+	writeTestFile(t, filepath.Join(src, "edited.txt"), "new!", mtime)
+	writeTestFile(t, filepath.Join(dst, "edited.txt"), "old!", mtime)
+
+	countingHashes.Store(0)
+	fs := NewFileSync(src, dst, false, WithChecksum(true), WithHashAlgorithm("COUNTING"),
+		WithChecksumCache(true), WithManifest(manifestPath))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 1 {
+		t.Errorf("FilesCopied = %d, want 1", got)
+	}
+	if countingHashes.Load() == 0 {
+		t.Error("the registered algorithm was not used")
+	}
+
+	// The cache and the manifest name the algorithm of their digests
+	var cache checksumCache
+	data, err := os.ReadFile(filepath.Join(dst, checksumCacheName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Algorithm != "counting" {
+		t.Errorf("checksum cache algorithm = %q, %v", cache.Algorithm, err)
+	}
+	var m manifest
+	if data, err = os.ReadFile(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if entry := m.Files["edited.txt"]; entry.Algorithm != "counting" || entry.Digest == "" {
+		t.Errorf("manifest entry = %+v", entry)
+	}
+
+	// Switching algorithms drops the cached digests
+	fs = NewFileSync(src, dst, false, WithChecksum(true), WithChecksumCache(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = os.ReadFile(filepath.Join(dst, checksumCacheName)); err != nil {
+		t.Fatal(err)
+	}
+	cache = checksumCache{}
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Algorithm != defaultHashAlgorithm {
+		t.Errorf("checksum cache algorithm after switching = %q, %v", cache.Algorithm, err)
+	}
+}
+
+func TestFileSync_UnknownHashAlgorithm(t *testing.T) {
+	tmp := t.TempDir()
+	fs := NewFileSync(filepath.Join(tmp, "src"), filepath.Join(tmp, "dst"), false, WithHashAlgorithm("nope"))
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("SyncDirs with an unknown hash algorithm should fail")
+	}
+	for _, name := range []string{"sha256", "crc32", "blake2b", "counting"} {
+		if err := NewFileSync(".", ".", false, WithHashAlgorithm(name)).checkHashAlgorithm(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Dedup links files by digest, so it refuses short ones
+	for name, ok := range map[string]bool{"sha256": true, "md5": true, "crc32": false, "counting": false} {
+		if err := NewFileSync(".", ".", false, WithHashAlgorithm(name), WithDedup(true)).checkHashAlgorithm(); (err == nil) != ok {
+			t.Errorf("%s with dedup: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package filesync
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// hashChunk is how much of a file is hashed at a time; cancellation is
+// checked and progress reported between chunks.
+const hashChunk = 1 << 20
+
+// HashProgress is how far the hashing of one file has got, reported to
+// the callback set with WithHashProgress.
+type HashProgress struct {
+	Path       string // file being hashed, on the source or the target
+	BytesDone  int64
+	BytesTotal int64
+}
+
+// hashContext returns the context that stops hashing: Verify's, or
+// else SyncDirsContext's.
+func (fs *FileSync) hashContext() context.Context {
+	switch {
+	case fs.hashCtx != nil:
+		return fs.hashCtx
+	case fs.syncCtx != nil:
+		return fs.syncCtx
+	}
+	return context.Background()
+}
+
+// fileChecksum returns the digest of the file at path on fsys by the
+// configured algorithm. The file is read hashChunk bytes at a time, so
+// a cancelled run stops hashing a huge file within a chunk, returning
+// the context's error, and a file taking longer than progressInterval
+// is reported to the WithHashProgress callback as it goes, and once
+// more when done.
+func (fs *FileSync) fileChecksum(fsys FS, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var total int64
+	if fs.onHash != nil {
+		if info, err := f.Stat(); err == nil {
+			total = info.Size()
+		}
+	}
+	ctx := fs.hashContext()
+	h := fs.newHash()
+	var done int64
+	var reported bool
+	last := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := io.CopyN(h, f, hashChunk)
+		done += n
+		fs.contentRead.Add(n)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if fs.onHash != nil && (err == io.EOF && reported || err == nil && time.Since(last) >= progressInterval) {
+			fs.onHash(HashProgress{Path: path, BytesDone: done, BytesTotal: total})
+			last, reported = time.Now(), true
+		}
+		if err == io.EOF {
+			return h.Sum(nil), nil
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package filesync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readHookFS is an FS that calls onRead before every read of a file.
+type readHookFS struct {
+	FS
+	onRead func()
+}
+
+// hookedFile is a file of readHookFS.
+type hookedFile struct {
+	File
+	onRead func()
+}
+
+func (f *hookedFile) Read(p []byte) (int, error) {
+	f.onRead()
+	return f.File.Read(p)
+}
+
+func (r *readHookFS) Open(name string) (File, error) {
+	f, err := r.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedFile{File: f, onRead: r.onRead}, nil
+}
+
+// writeLargeFile writes size bytes to path on the local disk.
+func writeLargeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSync_VerifyCancelStopsHashing(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	size := 64 * hashChunk
+	writeLargeFile(t, filepath.Join(src, "big.bin"), size)
+	writeLargeFile(t, filepath.Join(dst, "big.bin"), size)
+
+	// Cancel once the hashing has started
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reads atomic.Int64
+	hook := &readHookFS{FS: LocalFS(), onRead: func() {
+		if reads.Add(1) == 1 {
+			cancel()
+		}
+	}}
+	fs := NewFileSync(src, dst, false, WithSourceFS(hook), WithTargetFS(hook))
+	if _, err := fs.Verify(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Verify() = %v, want context.Canceled", err)
+	}
+	// Each file stops within a chunk, read in 32 KiB pieces
+	if limit := int64(2 * hashChunk / (32 << 10)); reads.Load() > limit {
+		t.Errorf("%d reads after cancelling, want at most %d", reads.Load(), limit)
+	}
+}
+
+func TestFileSync_HashProgress(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	size := 4 * hashChunk
+	writeLargeFile(t, filepath.Join(src, "big.bin"), size)
+	writeLargeFile(t, filepath.Join(dst, "big.bin"), size)
+
+	// Slow reads, so hashing takes longer than progressInterval
+	slow := &readHookFS{FS: LocalFS(), onRead: func() { time.Sleep(5 * time.Millisecond) }}
+	var mu sync.Mutex
+	var updates []HashProgress
+	fs := NewFileSync(src, dst, false, WithSourceFS(slow), WithTargetFS(LocalFS()), WithHashProgress(func(p HashProgress) {
+		mu.Lock()
+		updates = append(updates, p)
+		mu.Unlock()
+	}))
+	report, err := fs.Verify(context.Background())
+	if err != nil || report.Verified != 1 {
+		t.Fatalf("Verify() = %+v, %v", report, err)
+	}
+
+	var mid, final bool
+	for _, p := range updates {
+		if p.Path != filepath.Join(src, "big.bin") || p.BytesTotal != int64(size) {
+			t.Errorf("unexpected update %+v", p)
+		}
+		mid = mid || p.BytesDone < p.BytesTotal
+		final = final || p.BytesDone == p.BytesTotal
+	}
+	if !mid || !final {
+		t.Errorf("updates = %+v, want some mid-file and a final one", updates)
+	}
+}
@@ -0,0 +1,56 @@
+package filesync
+
+import "log"
+
+// heartbeat tracks the copy pass for WithHeartbeat, logging a summary
+// line every fs.heartbeatEvery files in place of the per-file skip
+// lines.
+type heartbeat struct {
+	every   int
+	scanned int
+	base    int // changed files before the pass
+}
+
+// newHeartbeat starts a heartbeat for a copy pass, or returns nil when
+// WithHeartbeat is off.
+func (fs *FileSync) newHeartbeat() *heartbeat {
+	if fs.heartbeatEvery <= 0 {
+		return nil
+	}
+	return &heartbeat{every: fs.heartbeatEvery, base: fs.changedFiles()}
+}
+
+// changedFiles counts the files copied, linked as duplicates or
+// renamed so far.
+func (fs *FileSync) changedFiles() int {
+	return fs.stats.FilesCopied + fs.stats.FilesDeduped + fs.stats.FilesRenamed
+}
+
+// beat is called before each file of the pass, logging the heartbeat
+// once another interval's worth of files has been dealt with.
+func (h *heartbeat) beat(fs *FileSync) {
+	if h == nil {
+		return
+	}
+	if h.scanned > 0 && h.scanned%h.every == 0 {
+		log.Printf("💓 Scanned %d files, %d changed so far", h.scanned, fs.changedFiles()-h.base)
+	}
+	h.scanned++
+}
+
+// finish logs the closing heartbeat with the totals of the pass.
+func (h *heartbeat) finish(fs *FileSync) {
+	if h == nil || h.scanned == 0 {
+		return
+	}
+	log.Printf("💓 Scanned %d files, %d changed", h.scanned, fs.changedFiles()-h.base)
+}
+
+// logSkip logs a per-file skip line, unless WithHeartbeat collapses
+// them.
+func (fs *FileSync) logSkip(format string, args ...any) {
+	if fs.heartbeatEvery > 0 {
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,49 @@
+package filesync
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Heartbeat(t *testing.T) {
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	mem := NewMemFS()
+	for i := range 5 {
+		name := fmt.Sprintf("f%d.txt", i)
+		mem.WriteFile("/src/"+name, []byte("same"), old)
+		mem.WriteFile("/dst/"+name, []byte("same"), old)
+	}
+	// One new file, and one the target has a newer edit of
+	mem.WriteFile("/src/new.txt", []byte("new"), old)
+	mem.WriteFile("/dst/f0.txt", []byte("newer"), old.Add(time.Minute))
+
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem),
+		WithUpdateOnly(true), WithHeartbeat(2))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs() = %v", err)
+	}
+	out := logs.String()
+	if strings.Contains(out, "target is newer") {
+		t.Errorf("skip line not collapsed:\n%s", out)
+	}
+	if !strings.Contains(out, "new.txt") {
+		t.Errorf("copy not logged:\n%s", out)
+	}
+	for _, want := range []string{
+		"Scanned 2 files, 0 changed so far",
+		"Scanned 4 files, 0 changed so far",
+		"Scanned 6 files, 1 changed\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %q:\n%s", want, out)
+		}
+	}
+}
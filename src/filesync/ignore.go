@@ -0,0 +1,154 @@
+package filesync
+
+import (
+	"bufio"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// syncIgnoreName is the per-directory ignore file, similar to .gitignore.
+const syncIgnoreName = ".syncignore"
+
+// ignoreRule is a single pattern line from a .syncignore file.
+type ignoreRule struct {
+	base     string // slash-separated dir holding the ignore file ("" for root)
+	pattern  string // glob, slash-separated
+	negate   bool   // "!pattern" re-includes a previously ignored entry
+	dirOnly  bool   // "pattern/" only matches directories
+	anchored bool   // pattern contains a slash: match relative to base
+}
+
+// ignoreSet lazily loads and stacks .syncignore files from the source
+// tree. Rules of a directory apply to its whole subtree, with rules
+// from deeper directories evaluated after (and overriding) parents.
+// It is safe for concurrent use, as by the walks of WithParallelPlan.
+type ignoreSet struct {
+	root  string
+	fsys  FS
+	extra []ignoreRule // from WithExcludes, before the root's file
+
+	mu    sync.Mutex // guards cache
+	cache map[string][]ignoreRule
+}
+
+func newIgnoreSet(fsys FS, root string, extra []ignoreRule) *ignoreSet {
+	return &ignoreSet{root: root, fsys: fsys, extra: extra, cache: map[string][]ignoreRule{}}
+}
+
+// rulesFor returns the cumulative rules in effect inside relDir
+// (slash-separated, "" for the source root).
+func (s *ignoreSet) rulesFor(relDir string) []ignoreRule {
+	s.mu.Lock()
+	rules, ok := s.cache[relDir]
+	s.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	// Loaded without the lock, which the parents' lookups take; walks
+	// racing for the same directory parse its file alike
+	if relDir != "" {
+		parent := path.Dir(relDir)
+		if parent == "." {
+			parent = ""
+		}
+		rules = append(rules, s.rulesFor(parent)...)
+	} else {
+		rules = append(rules, s.extra...)
+	}
+	rules = append(rules, parseIgnoreFile(s.fsys, filepath.Join(s.root, filepath.FromSlash(relDir), syncIgnoreName), relDir)...)
+
+	s.mu.Lock()
+	s.cache[relDir] = rules
+	s.mu.Unlock()
+	return rules
+}
+
+// ignored reports whether relPath (relative to the source root) is
+// excluded by the .syncignore files above it. The last matching rule
+// wins, so negations can re-include entries.
+func (s *ignoreSet) ignored(relPath string, isDir bool) bool {
+	rel := filepath.ToSlash(relPath)
+	dir := path.Dir(rel)
+	if dir == "." {
+		dir = ""
+	}
+
+	ignored := false
+	for _, r := range s.rulesFor(dir) {
+		if r.matches(rel, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// matches reports whether the rule applies to rel (slash-separated,
+// relative to the source root).
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	sub := rel
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		sub = strings.TrimPrefix(rel, r.base+"/")
+	}
+	if r.anchored {
+		ok, _ := path.Match(r.pattern, sub)
+		return ok
+	}
+	ok, _ := path.Match(r.pattern, path.Base(sub))
+	return ok
+}
+
+// parseIgnoreFile reads the rules from file, which lives in relDir.
+// A missing or unreadable file yields no rules.
+func parseIgnoreFile(fsys FS, file, relDir string) []ignoreRule {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if r, ok := parseIgnoreRule(scanner.Text(), relDir); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreRule parses one .syncignore line for a file in relDir. It
+// reports false for blank lines and comments.
+func parseIgnoreRule(line, relDir string) (ignoreRule, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	r := ignoreRule{base: relDir}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	r.pattern = line
+	return r, true
+}
@@ -0,0 +1,128 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_SyncIgnoreNested(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(src, syncIgnoreName), "*.log\nbuild/\n", now)
+	writeTestFile(t, filepath.Join(src, "app.log"), "log", now)
+	writeTestFile(t, filepath.Join(src, "main.go"), "code", now)
+	writeTestFile(t, filepath.Join(src, "build", "out.bin"), "bin", now)
+	// nested ignore file stacks on top of the root one
+	writeTestFile(t, filepath.Join(src, "sub", syncIgnoreName), "!keep.log\n*.tmp\n", now)
+	writeTestFile(t, filepath.Join(src, "sub", "keep.log"), "keep", now)
+	writeTestFile(t, filepath.Join(src, "sub", "drop.log"), "drop", now)
+	writeTestFile(t, filepath.Join(src, "sub", "scratch.tmp"), "tmp", now)
+	// sibling directories are not affected by sub/.syncignore
+	writeTestFile(t, filepath.Join(src, "other", "scratch.tmp"), "tmp", now)
+
+	fs := NewFileSync(src, dst, false)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	present := []string{"main.go", "sub/keep.log", "other/scratch.tmp"}
+	absent := []string{
+		syncIgnoreName, "app.log", "build", "sub/drop.log",
+		"sub/scratch.tmp", "sub/" + syncIgnoreName,
+	}
+	for _, p := range present {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Errorf("expected %s to be copied", p)
+		}
+	}
+	for _, p := range absent {
+		if _, err := os.Stat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be ignored", p)
+		}
+	}
+}
+
+func TestFileSync_SyncIgnoreProtectsFromDelete(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeTestFile(t, filepath.Join(src, syncIgnoreName), "*.cache\n", time.Now())
+	writeTestFile(t, filepath.Join(dst, "local.cache"), "cache", time.Now())
+
+	fs := NewFileSync(src, dst, true)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "local.cache")); err != nil {
+		t.Error("expected ignored target file to survive delete-missing")
+	}
+}
+
+func TestFileSync_CopyIgnoreFiles(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeTestFile(t, filepath.Join(src, syncIgnoreName), "*.log\n", time.Now())
+
+	fs := NewFileSync(src, dst, false, WithCopyIgnoreFiles(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, syncIgnoreName)); err != nil {
+		t.Error("expected .syncignore to be copied")
+	}
+}
+
+func TestFileSync_Excludes(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, "a.log"), "log", now)
+	writeTestFile(t, filepath.Join(src, "keep.log"), "keep", now)
+	writeTestFile(t, filepath.Join(src, "main.go"), "code", now)
+	// the .syncignore files are applied after, and can re-include
+	writeTestFile(t, filepath.Join(src, syncIgnoreName), "!keep.log\n", now)
+
+	fs := NewFileSync(src, dst, false, WithExcludes("*.log", "", "# comment"))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{"a.log": false, "keep.log": true, "main.go": true} {
+		_, err := os.Stat(filepath.Join(dst, p))
+		if got := err == nil; got != want {
+			t.Errorf("%s in target = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestFileSync_Includes(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, "a.log"), "log", now)
+	writeTestFile(t, filepath.Join(src, "audit.log"), "audit", now)
+	writeTestFile(t, filepath.Join(src, "main.go"), "code", now)
+
+	// The includes win whatever order the options come in
+	fs := NewFileSync(src, dst, false, WithIncludes("audit.log"), WithExcludes("*.log"))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{"a.log": false, "audit.log": true, "main.go": true} {
+		_, err := os.Stat(filepath.Join(dst, p))
+		if got := err == nil; got != want {
+			t.Errorf("%s in target = %v, want %v", p, got, want)
+		}
+	}
+}
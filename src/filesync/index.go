@@ -0,0 +1,86 @@
+package filesync
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// indexVersion is the format version written to catalogs by Index.
+const indexVersion = 1
+
+// catalog is the JSON document Index writes.
+type catalog struct {
+	Version   int            `json:"version"`
+	Created   time.Time      `json:"created"`
+	Sources   []string       `json:"sources"`
+	Algorithm string         `json:"algorithm,omitempty"`
+	Files     []catalogEntry `json:"files"`
+}
+
+// catalogEntry is a source file in a catalog, with its slash-separated
+// path relative to the source root.
+type catalogEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Digest  string    `json:"digest,omitempty"`
+}
+
+// Index writes a JSON catalog of the files the sources offer, as List
+// reports them, to the local file out, without copying anything: for
+// each its path, size and mod time, plus a digest in checksum mode
+// (see WithChecksum and WithHashAlgorithm), since hashing reads every
+// file in full. The target is never touched. Files that cannot be read
+// or hashed are logged, and left out or listed without a digest. The
+// file is replaced atomically.
+func (fs *FileSync) Index(out string) error {
+	if err := fs.connect(); err != nil {
+		return err
+	}
+	items, err := fs.listSources(context.Background(), false)
+	if err != nil {
+		return err
+	}
+
+	c := catalog{
+		Version: indexVersion,
+		Created: time.Now().UTC(),
+		Sources: append([]string{fs.source}, fs.extraSources...),
+		Files:   make([]catalogEntry, 0, len(items)),
+	}
+	if fs.checksum {
+		c.Algorithm = fs.hashAlgorithm()
+	}
+	for _, item := range items {
+		entry := catalogEntry{Path: filepath.ToSlash(item.relPath), Size: item.info.Size(), ModTime: item.info.ModTime()}
+		if fs.checksum && item.info.Mode().IsRegular() {
+			sum, err := fs.checksumOf(fs.srcFS, item.path, item.info)
+			if err != nil {
+				log.Printf("❌ Could not hash %q: %v", item.path, err)
+			} else {
+				entry.Digest = hex.EncodeToString(sum)
+			}
+		}
+		c.Files = append(c.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := out + ".tmp"
+	if err := os.WriteFile(longPath(tmp), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	if err := os.Rename(longPath(tmp), longPath(out)); err != nil {
+		os.Remove(longPath(tmp))
+		return fmt.Errorf("index: %w", err)
+	}
+	return nil
+}
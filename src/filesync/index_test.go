@@ -0,0 +1,51 @@
+package filesync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Index(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", mtime)
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "world!", mtime)
+	writeTestFile(t, filepath.Join(src, "skip.log"), "x", mtime)
+	out := filepath.Join(tmp, "index.json")
+
+	for _, checksum := range []bool{false, true} {
+		fs := NewFileSync(src, filepath.Join(tmp, "no-target"), false, WithExcludes("*.log"), WithChecksum(checksum))
+		if err := fs.Index(out); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Files) != 2 || c.Files[0].Path != "a.txt" || c.Files[1].Path != "sub/b.txt" {
+			t.Fatalf("checksum %v: files = %+v", checksum, c.Files)
+		}
+		if c.Files[1].Size != 6 || !c.Files[1].ModTime.Equal(mtime) {
+			t.Errorf("sub/b.txt = %+v", c.Files[1])
+		}
+		// sha256 of "hello"
+		wantDigest, wantAlgo := "", ""
+		if checksum {
+			wantDigest, wantAlgo = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", "sha256"
+		}
+		if c.Files[0].Digest != wantDigest || c.Algorithm != wantAlgo {
+			t.Errorf("checksum %v: digest %q (%s), want %q (%s)", checksum, c.Files[0].Digest, c.Algorithm, wantDigest, wantAlgo)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "no-target")); !os.IsNotExist(err) {
+		t.Errorf("Index touched the target: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package filesync
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// journalName is the resume journal file, in the target.
+const journalName = ".filesync-journal"
+
+// Default flush cadence of a checkpoint, see WithCheckpointEvery.
+const (
+	defaultCheckpointFiles = 1000
+	defaultCheckpointEvery = 30 * time.Second
+)
+
+// journalEntry records one file the current run has synced, with the
+// source size and mod time it was synced at. The journal holds one
+// entry per line as JSON.
+type journalEntry struct {
+	Path    string    `json:"path"` // relative, slash-separated
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// journal is the resume state of a run: what an interrupted earlier
+// run finished, and the file new entries are appended to.
+type journal struct {
+	done map[string]journalEntry // by relative path
+	file File
+
+	// With WithCheckpoint, entries are buffered until the next flush
+	pending []byte
+	unsaved int
+	saved   time.Time
+}
+
+// journalFile returns the path of the resume journal.
+func (fs *FileSync) journalFile() string {
+	if fs.checkpointPath != "" {
+		return fs.checkpointPath
+	}
+	return filepath.Join(fs.target, journalName)
+}
+
+// openJournal reads the journal left behind by an interrupted run, if
+// any, and opens it for appending (see WithJournal). A line cut short
+// by the interruption is ignored.
+func (fs *FileSync) openJournal() error {
+	if !fs.journal || fs.dryRun {
+		return nil
+	}
+	j := &journal{done: map[string]journalEntry{}, saved: time.Now()}
+	data, err := readFile(fs.stateFS(fs.checkpointPath), fs.journalFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry journalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			j.done[entry.Path] = entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := fs.stateFS(fs.checkpointPath).MkdirAll(filepath.Dir(fs.journalFile()), 0755); err != nil {
+		return err
+	}
+	if j.file, err = fs.stateFS(fs.checkpointPath).OpenFile(fs.journalFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	fs.journaled = j
+	return nil
+}
+
+// closeJournal closes the journal, removing it once the run completed:
+// the next run then starts from scratch.
+func (fs *FileSync) closeJournal(completed bool) error {
+	j := fs.journaled
+	if j == nil {
+		return nil
+	}
+	fs.journaled = nil
+	fs.flushJournal(j)
+	err := j.file.Close()
+	if completed {
+		if rmErr := fs.stateFS(fs.checkpointPath).Remove(fs.journalFile()); rmErr != nil && !os.IsNotExist(rmErr) {
+			err = errors.Join(err, rmErr)
+		}
+	}
+	return err
+}
+
+// skipJournaled marks the jobs an interrupted run already synced, as
+// long as their source is unchanged and the target still has them, so
+// they are neither compared nor copied again.
+func (fs *FileSync) skipJournaled(jobs []*fileJob) {
+	j := fs.journaled
+	if j == nil || len(j.done) == 0 {
+		return
+	}
+	for _, job := range jobs {
+		entry, ok := j.done[filepath.ToSlash(job.relPath)]
+		if ok && job.tgtInfo != nil && entry.Size == job.srcInfo.Size() && entry.ModTime.Equal(job.srcInfo.ModTime()) {
+			job.journaled = true
+		}
+	}
+}
+
+// journalDone appends a synced file to the journal. Failing to do so
+// only makes a resumed run redo that file, so it is not an error.
+func (fs *FileSync) journalDone(job *fileJob) {
+	j := fs.journaled
+	if j == nil || job.journaled {
+		return
+	}
+	line, err := json.Marshal(journalEntry{Path: filepath.ToSlash(job.relPath), Size: job.srcInfo.Size(), ModTime: job.srcInfo.ModTime()})
+	if err != nil {
+		return
+	}
+	j.pending = append(append(j.pending, line...), '\n')
+	j.unsaved++
+	files := cmp.Or(fs.checkpointFiles, defaultCheckpointFiles)
+	every := cmp.Or(fs.checkpointEvery, defaultCheckpointEvery)
+	if !fs.checkpoint || j.unsaved >= files || time.Since(j.saved) >= every {
+		fs.flushJournal(j)
+	}
+}
+
+// flushJournal writes the buffered entries of j, syncing them to disk
+// for a checkpoint. Like journalDone, it does not fail.
+func (fs *FileSync) flushJournal(j *journal) {
+	if len(j.pending) == 0 {
+		return
+	}
+	if _, err := j.file.Write(j.pending); err == nil && fs.checkpoint {
+		j.file.Sync()
+	}
+	j.pending, j.unsaved, j.saved = j.pending[:0], 0, time.Now()
+}
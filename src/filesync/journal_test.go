@@ -0,0 +1,179 @@
+package filesync
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// interruptFS is a local FS that counts how often each file is opened
+// and refuses to open the file named fail, which aborts a sync run
+// with WithFailOnAccessError as an interruption would.
+type interruptFS struct {
+	FS
+	mu     sync.Mutex
+	opened map[string]int
+	fail   string
+}
+
+func (f *interruptFS) Open(name string) (File, error) {
+	f.mu.Lock()
+	f.opened[filepath.Base(name)]++
+	f.mu.Unlock()
+	if filepath.Base(name) == f.fail {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return f.FS.Open(name)
+}
+
+func TestFileSync_JournalResume(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		writeTestFile(t, filepath.Join(src, name), "old "+name, now.Add(-time.Hour))
+		writeTestFile(t, filepath.Join(dst, name), "old "+name, now.Add(-time.Hour))
+	}
+	writeTestFile(t, filepath.Join(src, "c.txt"), "new c.txt", now)
+	journalPath := filepath.Join(dst, journalName)
+
+	// The first run verifies a and b, then dies on c
+	srcFS := &interruptFS{FS: LocalFS(), opened: map[string]int{}, fail: "c.txt"}
+	fs := NewFileSync(src, dst, false, WithChecksum(true), WithWorkers(1), WithFailOnAccessError(true),
+		WithSourceFS(srcFS), WithJournal(true))
+	if err := fs.SyncDirs(); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("interrupted run: err = %v, want permission error", err)
+	}
+	if _, err := os.Stat(journalPath); err != nil {
+		t.Fatalf("journal missing after interrupted run: %v", err)
+	}
+
+	// b changed since; a did not and is taken from the journal
+	writeTestFile(t, filepath.Join(src, "b.txt"), "new b.txt", now)
+	srcFS = &interruptFS{FS: LocalFS(), opened: map[string]int{}}
+	fs = NewFileSync(src, dst, false, WithChecksum(true), WithSourceFS(srcFS), WithJournal(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if n := srcFS.opened["a.txt"]; n != 0 {
+		t.Errorf("journaled a.txt was opened %d time(s) on resume", n)
+	}
+	if n := srcFS.opened["d.txt"]; n == 0 {
+		t.Error("d.txt was never checked")
+	}
+	for _, name := range []string{"b.txt", "c.txt"} {
+		data, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "new "+name {
+			t.Errorf("%s = %q after resume, want %q", name, data, "new "+name)
+		}
+	}
+	if _, err := os.Stat(journalPath); !os.IsNotExist(err) {
+		t.Errorf("journal not removed after a completed run, stat err = %v", err)
+	}
+}
+
+func TestFileSync_JournalRejectsSnapshots(t *testing.T) {
+	tmp := t.TempDir()
+	fs := NewFileSync(t.TempDir(), tmp, false, WithJournal(true), WithSnapshot(true))
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("expected an error combining the journal with snapshots")
+	}
+}
+
+func TestFileSync_CheckpointFlushesPeriodically(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	checkpoint := filepath.Join(tmp, "state", "migration.checkpoint")
+	names := []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"}
+	for _, name := range names {
+		writeTestFile(t, filepath.Join(src, name), name, time.Now())
+	}
+
+	// Before each copy, count the entries that have reached the file
+	flushed := map[string]int{}
+	hook := func(src, dst string, info os.FileInfo) (bool, error) {
+		data, _ := os.ReadFile(checkpoint)
+		flushed[filepath.Base(src)] = bytes.Count(data, []byte("\n"))
+		if filepath.Base(src) == "e.txt" {
+			return false, os.ErrPermission
+		}
+		return true, nil
+	}
+	fs := NewFileSync(src, dst, false, WithCheckpoint(checkpoint), WithCheckpointEvery(2, time.Hour),
+		WithBeforeCopy(hook), WithFailOnAccessError(true))
+	if err := fs.SyncDirs(); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("interrupted run: err = %v, want permission error", err)
+	}
+	want := map[string]int{"a.txt": 0, "b.txt": 0, "c.txt": 2, "d.txt": 2, "e.txt": 4}
+	for name, n := range want {
+		if flushed[name] != n {
+			t.Errorf("before %s: %d entries flushed, want %d", name, flushed[name], n)
+		}
+	}
+
+	// Stopping early still saves what was buffered
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 4 {
+		t.Errorf("checkpoint holds %d entries after the interruption, want 4", n)
+	}
+
+	fs = NewFileSync(src, dst, false, WithCheckpoint(checkpoint))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 1 {
+		t.Errorf("resumed run copied %d files, want 1", got)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint not removed after a completed run, stat err = %v", err)
+	}
+}
+
+func TestFileSync_CheckpointStaysLocal(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	state := filepath.Join(tmp, "state")
+	checkpoint := filepath.Join(state, "migration.checkpoint")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", time.Now())
+	writeTestFile(t, filepath.Join(src, "b.txt"), "beta", time.Now())
+
+	// The run is interrupted, so the checkpoint stays behind
+	target := &remoteFS{FS: LocalFS()}
+	fail := WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+		if filepath.Base(src) == "b.txt" {
+			return false, os.ErrPermission
+		}
+		return true, nil
+	})
+	fs := NewFileSync(src, dst, false, WithTargetFS(target), WithCheckpoint(checkpoint), fail, WithFailOnAccessError(true))
+	if err := fs.SyncDirs(); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("interrupted run: err = %v, want permission error", err)
+	}
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Errorf("checkpoint not written locally: %v", err)
+	}
+
+	fs = NewFileSync(src, dst, false, WithTargetFS(target), WithCheckpoint(checkpoint))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 1 {
+		t.Errorf("resumed run copied %d files, want 1", got)
+	}
+	if opened := target.openedIn(state); len(opened) > 0 {
+		t.Errorf("opened through the target's filesystem: %v", opened)
+	}
+}
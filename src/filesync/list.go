@@ -0,0 +1,118 @@
+package filesync
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ListEntry is a source file as reported by List.
+type ListEntry struct {
+	Path    string // relative to the source root
+	Size    int64
+	ModTime time.Time
+}
+
+// List returns the files the sources offer for syncing, in the order a
+// sync would visit them, honoring .syncignore rules and the configured
+// filters. With several sources each path is listed once, from the
+// source that would win it. The target is never touched, so it need
+// not exist. Entries that cannot be read are logged and left out.
+func (fs *FileSync) List(ctx context.Context) ([]ListEntry, error) {
+	if err := fs.connect(); err != nil {
+		return nil, err
+	}
+	items, err := fs.listSources(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ListEntry, len(items))
+	for i, item := range items {
+		entries[i] = ListEntry{Path: item.relPath, Size: item.info.Size(), ModTime: item.info.ModTime()}
+	}
+	return entries, nil
+}
+
+// sourceItem is an entry offered by the sources, with the source path
+// it is read from.
+type sourceItem struct {
+	relPath string
+	path    string
+	info    os.FileInfo // Lstat'ed for a preserved symlink, else Stat'ed
+}
+
+// listSources walks all source trees and returns their entries merged
+// like List does, including directories (other than the roots) with
+// withDirs.
+func (fs *FileSync) listSources(ctx context.Context, withDirs bool) ([]sourceItem, error) {
+	trees := fs.sourceTrees()
+	perSource := make([][]sourceItem, len(trees))
+	for i, tree := range trees {
+		items, err := fs.listSource(ctx, tree, withDirs)
+		if err != nil {
+			return nil, err
+		}
+		perSource[i] = items
+	}
+	return mergeByPath(perSource, func(item sourceItem) string { return item.relPath }, fs.firstSourceWins), nil
+}
+
+// listSource walks one source tree for listSources.
+func (fs *FileSync) listSource(ctx context.Context, tree sourceTree, withDirs bool) ([]sourceItem, error) {
+	var items []sourceItem
+
+	var rootDev uint64
+	var rootDevOK bool
+	if fs.oneFileSystem {
+		if info, err := tree.fsys.Stat(tree.root); err == nil {
+			rootDev, rootDevOK = fileDevice(info)
+		}
+	}
+
+	err := fs.walk(tree.fsys, tree.walkRoot("."), func(path string, d os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			log.Printf("Error accessing %q: %v", path, err)
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(tree.root, path)
+		if relPath == "." {
+			return nil
+		}
+		if fs.excluded(tree.ignores, relPath, d.IsDir()) || fs.contentExcluded(tree.fsys, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if rootDevOK && fs.onOtherDevice(d, rootDev) {
+				return filepath.SkipDir
+			}
+			if withDirs {
+				if info, err := d.Info(); err == nil {
+					items = append(items, sourceItem{relPath: relPath, path: path, info: info})
+				}
+			}
+			return nil
+		}
+
+		stat := tree.fsys.Stat
+		if fs.preserveSymlinks && isSymlink(d) {
+			stat = tree.fsys.Lstat
+		}
+		info, err := stat(path)
+		if err != nil {
+			log.Printf("❌ Could not read file info for %q: %v", path, err)
+			return nil
+		}
+		items = append(items, sourceItem{relPath: relPath, path: path, info: info})
+		return nil
+	})
+	return items, err
+}
@@ -0,0 +1,43 @@
+package filesync
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_List(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	extra := filepath.Join(tmp, "extra")
+	mod := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(src, "b.txt"), "bee", mod)
+	writeTestFile(t, filepath.Join(src, "a", "c.txt"), "sea", mod)
+	writeTestFile(t, filepath.Join(src, "skip.log"), "log", mod)
+	writeTestFile(t, filepath.Join(extra, "b.txt"), "override", mod)
+	writeTestFile(t, filepath.Join(extra, "d.txt"), "dee", mod)
+
+	// The target does not exist and is not created
+	fs := NewFileSync(src, filepath.Join(tmp, "missing"), false, WithExtensions("txt"))
+	fs.AddSource(extra)
+	entries, err := fs.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ListEntry{
+		{Path: filepath.Join("a", "c.txt"), Size: 3, ModTime: mod},
+		{Path: "b.txt", Size: 8, ModTime: mod},
+		{Path: "d.txt", Size: 3, ModTime: mod},
+	}
+	for i := range entries {
+		entries[i].ModTime = entries[i].ModTime.UTC()
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("List() = %v, want %v", entries, want)
+	}
+	if _, err := LocalFS().Stat(filepath.Join(tmp, "missing")); err == nil {
+		t.Error("List created the target")
+	}
+}
@@ -0,0 +1,23 @@
+package filesync
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/sys/unix"
+)
+
+// loadAverage returns the 1-minute load average from the vm.loadavg
+// sysctl, a struct loadavg of three fixed-point values and their scale.
+func loadAverage() (float64, bool) {
+	raw, err := unix.SysctlRaw("vm.loadavg")
+	if err != nil || len(raw) < 24 {
+		return 0, false
+	}
+	load := binary.NativeEndian.Uint32(raw[0:4])
+	// fscale is a long, after the three uint32 averages and padding
+	scale := binary.NativeEndian.Uint64(raw[16:24])
+	if scale == 0 {
+		return 0, false
+	}
+	return float64(load) / float64(scale), true
+}
@@ -0,0 +1,14 @@
+package filesync
+
+import "golang.org/x/sys/unix"
+
+// loadAverage returns the 1-minute load average. On Linux it counts
+// the tasks waiting on I/O as well as the runnable ones.
+func loadAverage() (float64, bool) {
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0, false
+	}
+	// The loads are fixed-point with SI_LOAD_SHIFT, 16, fraction bits
+	return float64(info.Loads[0]) / (1 << 16), true
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package filesync
+
+// loadAverage reports that the load average is unknown here, so
+// WithLoadThrottle does nothing.
+func loadAverage() (float64, bool) {
+	return 0, false
+}
@@ -0,0 +1,58 @@
+package filesync
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// loadCheckInterval is how often WithLoadThrottle samples the load
+// average, both between copies and while holding them back.
+const loadCheckInterval = 5 * time.Second
+
+// loadThrottle holds back new copies while the system load is high,
+// for WithLoadThrottle.
+type loadThrottle struct {
+	max      float64
+	load     func() (float64, bool) // the 1-minute load average, if known
+	interval time.Duration
+	checked  time.Time // when the load was last found below max
+}
+
+// waitForLoad blocks before a copy while the 1-minute load average is
+// above the WithLoadThrottle threshold, sampling it at most once per
+// interval. The time spent waiting adds up in Stats.LoadThrottled.
+// When the run's context ends first, its error is returned.
+func (fs *FileSync) waitForLoad() error {
+	t := fs.loadThrottle
+	if t == nil || time.Since(t.checked) < t.interval {
+		return nil
+	}
+	load, ok := t.load()
+	if !ok || load <= t.max {
+		t.checked = time.Now()
+		return nil
+	}
+	ctx := fs.runCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	log.Printf("🐢 Load average %.2f is above %.2f, holding back copies", load, t.max)
+	start := time.Now()
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for ok && load > t.max {
+		select {
+		case <-ticker.C:
+			load, ok = t.load()
+		case <-ctx.Done():
+			fs.stats.LoadThrottled += time.Since(start)
+			return ctx.Err()
+		}
+	}
+	waited := time.Since(start)
+	fs.stats.LoadThrottled += waited
+	t.checked = time.Now()
+	log.Printf("▶️ Load average %.2f, resuming copies after %s", load, waited.Round(time.Second))
+	return nil
+}
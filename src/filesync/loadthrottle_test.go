@@ -0,0 +1,55 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFileSync_LoadThrottle(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	mem.WriteFile("/src/a.txt", []byte("a"), now)
+	mem.WriteFile("/src/b.txt", []byte("b"), now)
+
+	// The load is high for the first three samples
+	samples := 0
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithLoadThrottle(2))
+	fs.loadThrottle.interval = time.Millisecond
+	fs.loadThrottle.load = func() (float64, bool) {
+		samples++
+		if samples <= 3 {
+			return 8, true
+		}
+		return 0.5, true
+	}
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if stats.FilesCopied != 2 {
+		t.Errorf("FilesCopied = %d, want 2", stats.FilesCopied)
+	}
+	if samples < 4 || stats.LoadThrottled <= 0 {
+		t.Errorf("sampled %d times and held back for %s, want a wait", samples, stats.LoadThrottled)
+	}
+
+	// A load that stays high gives way to the run being cancelled
+	mem.WriteFile("/src/c.txt", []byte("c"), now)
+	fs.loadThrottle.load = func() (float64, bool) { return 8, true }
+	fs.loadThrottle.checked = time.Time{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := fs.SyncDirsContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SyncDirsContext = %v, want the deadline", err)
+	}
+	if _, err := mem.Stat("/dst/c.txt"); err == nil {
+		t.Error("expected c.txt to be held back")
+	}
+
+	// A threshold of zero turns the throttle off
+	if WithLoadThrottle(0)(fs); fs.loadThrottle != nil {
+		t.Error("expected a zero threshold to turn the throttle off")
+	}
+}
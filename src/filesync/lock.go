@@ -0,0 +1,76 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockFileName is the lock file placed in the target while a sync runs.
+const lockFileName = ".filesync.lock"
+
+// lockPollInterval is how often a waiting sync retries the lock.
+const lockPollInterval = 50 * time.Millisecond
+
+// ErrLocked is returned when another sync holds the target's lock
+// and it did not become free within the lock timeout.
+var ErrLocked = errors.New("target is locked by another sync")
+
+// errLockHeld is what tryLock reports for a lock held elsewhere.
+var errLockHeld = errors.New("lock held")
+
+// lockFile returns the path of the target's lock file.
+func (fs *FileSync) lockFile() string {
+	return filepath.Join(fs.target, lockFileName)
+}
+
+// acquireLock takes the exclusive lock on the target (see WithLock),
+// waiting up to the lock timeout for another sync to release it. The
+// returned function releases the lock. Without locking, or in dry-run
+// mode where nothing is written, it does nothing.
+func (fs *FileSync) acquireLock() (func(), error) {
+	return fs.acquireLockAt(fs.lockFile())
+}
+
+// acquireLockAt is acquireLock with the lock file at path.
+func (fs *FileSync) acquireLockAt(path string) (func(), error) {
+	if !fs.lock || fs.dryRun {
+		return func() {}, nil
+	}
+	// Advisory locks are a local kernel facility
+	if _, local := baseFS(fs.tgtFS).(osFS); !local {
+		return nil, errors.New("locking requires a local target")
+	}
+
+	if err := fs.makeDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(fs.lockTimeout)
+	for {
+		err := tryLock(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLockHeld) {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	return func() {
+		unlock(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package filesync
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock reports that locking is unavailable: flock only exists on Unix.
+func tryLock(f *os.File) error {
+	return errors.New("target locking is not supported on this platform")
+}
+
+// unlock is a no-op where tryLock never succeeds.
+func unlock(f *os.File) {}
@@ -0,0 +1,73 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_LockHeldFailsImmediately(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", time.Now())
+
+	holder := NewFileSync(src, dst, false, WithLock(true))
+	release, err := holder.acquireLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	fs := NewFileSync(src, dst, false, WithLock(true))
+	if err := fs.SyncDirs(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("SyncDirs error = %v, want ErrLocked", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("a.txt should not have been copied while locked")
+	}
+}
+
+func TestFileSync_LockTimeoutWaits(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", time.Now())
+
+	holder := NewFileSync(src, dst, false, WithLock(true))
+	release, err := holder.acquireLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(200*time.Millisecond, release)
+
+	fs := NewFileSync(src, dst, false, WithLock(true), WithLockTimeout(5*time.Second))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs should have waited for the lock: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); err != nil {
+		t.Errorf("a.txt was not copied: %v", err)
+	}
+}
+
+func TestFileSync_LockFileIsNotDeleted(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", time.Now())
+
+	fs := NewFileSync(src, dst, true, WithLock(true))
+	for i := 0; i < 2; i++ {
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fs.Stats().FilesDeleted; got != 0 {
+		t.Errorf("FilesDeleted = %d, want 0", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, lockFileName)); err != nil {
+		t.Errorf("lock file missing after sync: %v", err)
+	}
+}
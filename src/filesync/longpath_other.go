@@ -0,0 +1,9 @@
+//go:build !windows
+
+package filesync
+
+// longPath returns name unchanged: only Windows limits path lengths
+// that way.
+func longPath(name string) string {
+	return name
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package filesync
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the length from which a path may not fit the Windows
+// MAX_PATH limit of 260: directories must leave room for an 8.3 name.
+const maxPath = 248
+
+// longPath turns a long path into an extended-length one ("\\?\C:\..."
+// or "\\?\UNC\server\share\..."), which Windows accepts up to about
+// 32767 characters. Short paths and device paths are returned as is.
+func longPath(name string) string {
+	if len(name) < maxPath || strings.HasPrefix(name, `\\?\`) || strings.HasPrefix(name, `\\.\`) {
+		return name
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return name
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,64 @@
+//go:build windows
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	long := strings.Repeat("d", maxPath)
+	cases := []struct {
+		name, in, want string
+	}{
+		{"short", `C:\data\file.txt`, `C:\data\file.txt`},
+		{"long drive", `C:\` + long, `\\?\C:\` + long},
+		{"long unix separators", `C:/` + long, `\\?\C:\` + long},
+		{"long UNC", `\\server\share\` + long, `\\?\UNC\server\share\` + long},
+		{"already extended", `\\?\C:\` + long, `\\?\C:\` + long},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := longPath(tc.in); got != tc.want {
+				t.Errorf("longPath(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFileSync_LongPaths(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	// Nest directories until the file path is well past MAX_PATH
+	rel := ""
+	for len(filepath.Join(dst, rel)) < 300 {
+		rel = filepath.Join(rel, strings.Repeat("n", 40))
+	}
+	rel = filepath.Join(rel, "deep.txt")
+	srcFile := filepath.Join(src, rel)
+	if err := os.MkdirAll(longPath(filepath.Dir(srcFile)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(longPath(srcFile), []byte("deep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileSync(src, dst, false)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if errs := fs.Stats().Errors; len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	data, err := os.ReadFile(longPath(filepath.Join(dst, rel)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "deep" {
+		t.Errorf("copied content = %q, want %q", data, "deep")
+	}
+}
@@ -0,0 +1,213 @@
+package filesync
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// manifestVersion is the format version written to manifests.
+const manifestVersion = 1
+
+// manifestEntry is a file as the target held it after the run that
+// wrote the manifest. The digest, along with the algorithm that
+// produced it, is only known for files copied, or found up to date, in
+// checksum mode.
+type manifestEntry struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	Digest    string    `json:"digest,omitempty"`
+	Algorithm string    `json:"algorithm,omitempty"`
+
+	// SHA256 is the digest of manifests written before the algorithm
+	// was recorded, only read; see readManifest.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// manifest is the file list written by WithManifest, keyed by
+// slash-separated paths relative to the target root. Comparisons run
+// on several workers at once, so access is guarded by mu.
+type manifest struct {
+	mu      sync.Mutex
+	Version int                      `json:"version"`
+	Files   map[string]manifestEntry `json:"files"`
+
+	seen map[string]bool // entries confirmed or written during this run
+}
+
+// manifestInfo is a target file as the manifest describes it, compared
+// instead of the target itself with WithManifestCompare.
+type manifestInfo struct {
+	name  string
+	entry manifestEntry
+}
+
+func (i manifestInfo) Name() string       { return i.name }
+func (i manifestInfo) Size() int64        { return i.entry.Size }
+func (i manifestInfo) Mode() os.FileMode  { return 0644 }
+func (i manifestInfo) ModTime() time.Time { return i.entry.ModTime }
+func (i manifestInfo) IsDir() bool        { return false }
+func (i manifestInfo) Sys() any           { return nil }
+
+// manifestFile returns the path of the manifest, one per shard (see
+// shardFile).
+func (fs *FileSync) manifestFile() string {
+	return fs.shardFile(fs.manifestPath)
+}
+
+// loadManifest reads the manifest when one is configured. A missing
+// file yields an empty manifest, so comparing against it copies
+// everything.
+func (fs *FileSync) loadManifest() error {
+	fs.manifest = nil
+	if fs.manifestPath == "" {
+		return nil
+	}
+	m, err := readManifest(fs.manifestFile())
+	if os.IsNotExist(err) {
+		m, err = &manifest{Files: map[string]manifestEntry{}}, nil
+	}
+	if err != nil {
+		return err
+	}
+	m.seen = map[string]bool{}
+	fs.manifest = m
+	return nil
+}
+
+// readManifest reads the manifest file at path.
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(longPath(path))
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Files == nil {
+		m.Files = map[string]manifestEntry{}
+	}
+	for key, entry := range m.Files {
+		if entry.SHA256 != "" {
+			if entry.Digest == "" {
+				entry.Digest, entry.Algorithm = entry.SHA256, defaultHashAlgorithm
+			}
+			entry.SHA256 = ""
+			m.Files[key] = entry
+		}
+	}
+	return m, nil
+}
+
+// saveManifest atomically writes the manifest back. After a run over
+// the whole tree, entries of files that are no longer synced are
+// dropped.
+func (fs *FileSync) saveManifest(wholeTree bool) error {
+	m := fs.manifest
+	if m == nil || fs.dryRun {
+		return nil
+	}
+	if wholeTree {
+		for path := range m.Files {
+			if !m.seen[path] {
+				delete(m.Files, path)
+			}
+		}
+	}
+	m.Version = manifestVersion
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := longPath(fs.manifestFile())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// statTarget returns the info of the target file at targetPath, or
+// with WithManifestCompare, the manifest's entry for relPath, with an
+// os.ErrNotExist error when it has none. Symlinks are only followed
+// with WithFollowTargetSymlinks.
+func (fs *FileSync) statTarget(relPath, targetPath string) (os.FileInfo, error) {
+	if !fs.manifestCompare {
+		if fs.followTargetLinks {
+			return fs.targetStat(targetPath)
+		}
+		return fs.targetLstat(targetPath)
+	}
+	m := fs.manifest
+	m.mu.Lock()
+	entry, ok := m.Files[filepath.ToSlash(relPath)]
+	m.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: targetPath, Err: os.ErrNotExist}
+	}
+	return manifestInfo{name: filepath.Base(relPath), entry: entry}, nil
+}
+
+// sameAsManifest reports whether a source file has the digest its
+// manifest entry records. Entries without one, or with one by another
+// algorithm, are taken as differing.
+func (fs *FileSync) sameAsManifest(srcPath string, src os.FileInfo, tgt manifestInfo) (bool, error) {
+	if tgt.entry.Digest == "" || tgt.entry.Algorithm != fs.hashAlgorithm() || src.Size() != tgt.entry.Size {
+		return false, nil
+	}
+	sum, err := fs.checksumOf(fs.srcFS, srcPath, src)
+	if err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(sum) == tgt.entry.Digest, nil
+}
+
+// noteManifest records the job's file in the manifest once it is in
+// the target: as the source is when it was just copied, otherwise as
+// already recorded, or as the target was found.
+func (fs *FileSync) noteManifest(job *fileJob, copied bool) {
+	m := fs.manifest
+	if m == nil || fs.dryRun {
+		return
+	}
+	key := filepath.ToSlash(job.relPath)
+	m.mu.Lock()
+	prev, known := m.Files[key]
+	m.mu.Unlock()
+
+	info := job.srcInfo
+	if !copied && job.tgtInfo != nil {
+		info = job.tgtInfo
+	}
+	entry := manifestEntry{Size: info.Size(), ModTime: info.ModTime()}
+	switch {
+	case !copied && known && prev.Size == entry.Size && prev.ModTime.Equal(entry.ModTime):
+		entry = prev
+	case fs.byContent() && !job.targetNewer && !job.placeholder && (copied || job.tgtInfo != nil):
+		// Up to date or just copied, the target holds the source's bytes
+		if sum, err := fs.checksumOf(fs.srcFS, job.srcPath, job.srcInfo); err == nil {
+			entry.Digest, entry.Algorithm = hex.EncodeToString(sum), fs.hashAlgorithm()
+		}
+	}
+	m.mu.Lock()
+	m.Files[key] = entry
+	m.seen[key] = true
+	m.mu.Unlock()
+}
+
+// forgetManifest drops the entry of a file removed from the target.
+func (fs *FileSync) forgetManifest(relPath string) {
+	if m := fs.manifest; m != nil {
+		m.mu.Lock()
+		delete(m.Files, filepath.ToSlash(relPath))
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,136 @@
+package filesync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_ManifestCompare(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	manifestPath := filepath.Join(tmp, "state", "manifest.json")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", old)
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b", old)
+
+	// No manifest yet: everything is copied and recorded
+	fs := NewFileSync(src, dst, false, WithManifest(manifestPath), WithManifestCompare(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 2 {
+		t.Errorf("FilesCopied = %d, want 2", got)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := m.Files["sub/b.txt"]; !ok || entry.Size != 1 || !entry.ModTime.Equal(old) {
+		t.Errorf("manifest entry for sub/b.txt = %+v, %v", entry, ok)
+	}
+
+	// The target is not consulted: a file removed from it behind the
+	// manifest's back is not recopied, a change in the source is
+	if err := os.Remove(filepath.Join(dst, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b2", old)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 1 {
+		t.Errorf("second run FilesCopied = %d, want 1", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("a.txt was recopied: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "sub", "b.txt")); got != "b2" {
+		t.Errorf("sub/b.txt = %q", got)
+	}
+
+	// Without a manifest path there is nothing to compare against
+	fs = NewFileSync(src, dst, false, WithManifestCompare(true))
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("comparing against a manifest without WithManifest should fail")
+	}
+}
+
+func TestFileSync_ManifestChecksums(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	manifestPath := filepath.Join(tmp, "manifest.json")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same", old)
+	writeTestFile(t, filepath.Join(src, "edited.txt"), "old!", old)
+
+	// A first run against the live target builds the manifest
+	fs := NewFileSync(src, dst, false, WithChecksum(true), WithManifest(manifestPath))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Later runs trust its digests: same size and mod time, new bytes
+	writeTestFile(t, filepath.Join(src, "edited.txt"), "new!", old)
+	fs = NewFileSync(src, dst, false, WithChecksum(true), WithManifest(manifestPath), WithManifestCompare(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 1 || stats.FilesSkipped != 1 {
+		t.Errorf("copied %d and skipped %d file(s), want 1 and 1", stats.FilesCopied, stats.FilesSkipped)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "edited.txt")); got != "new!" {
+		t.Errorf("edited.txt = %q", got)
+	}
+}
+
+func TestFileSync_ManifestLegacyDigests(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	manifestPath := filepath.Join(tmp, "manifest.json")
+	old := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same", old)
+	writeTestFile(t, filepath.Join(src, "edited.txt"), "new!", old)
+
+	// A manifest from before the algorithm was recorded, with the old
+	// key, and the digest of what edited.txt held before
+	sum := func(data string) string {
+		s := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(s[:])
+	}
+	legacy := fmt.Sprintf(`{"version":1,"files":{
+		"same.txt":{"size":4,"mod_time":%q,"sha256":%q},
+		"edited.txt":{"size":4,"mod_time":%q,"sha256":%q}}}`,
+		old.Format(time.RFC3339), sum("same"), old.Format(time.RFC3339), sum("old!"))
+	if err := os.WriteFile(manifestPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileSync(src, dst, false, WithChecksum(true), WithManifest(manifestPath), WithManifestCompare(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 1 || stats.FilesSkipped != 1 {
+		t.Errorf("copied %d and skipped %d file(s), want 1 and 1", stats.FilesCopied, stats.FilesSkipped)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"sha256":`) {
+		t.Errorf("rewritten manifest still uses the old key: %s", data)
+	}
+}
@@ -0,0 +1,85 @@
+package filesync
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+)
+
+// DiffManifests compares two manifests written by WithManifest, from
+// different runs or machines, without touching any filesystem: a takes
+// the place of the source and b of the target, so OnlyInSource lists
+// the paths b lacks, OnlyInTarget the paths b added, and Differing the
+// paths whose files changed. Files are told apart by digest when both
+// manifests hold one by the same algorithm, and by size and mod time
+// otherwise. Paths are sorted.
+func DiffManifests(a, b string) (*DiffResult, error) {
+	ma, err := readManifest(a)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", a, err)
+	}
+	mb, err := readManifest(b)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", b, err)
+	}
+
+	// Empty lists rather than nil ones, for the JSON form
+	result := &DiffResult{OnlyInSource: []string{}, OnlyInTarget: []string{}, Differing: []DiffEntry{}}
+	for _, path := range slices.Sorted(maps.Keys(ma.Files)) {
+		ea := ma.Files[path]
+		eb, ok := mb.Files[path]
+		switch {
+		case !ok:
+			result.OnlyInSource = append(result.OnlyInSource, filepath.FromSlash(path))
+		case manifestReason(ea, eb) != "":
+			result.Differing = append(result.Differing, DiffEntry{Path: filepath.FromSlash(path), Reason: manifestReason(ea, eb)})
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(mb.Files)) {
+		if _, ok := ma.Files[path]; !ok {
+			result.OnlyInTarget = append(result.OnlyInTarget, filepath.FromSlash(path))
+		}
+	}
+	return result, nil
+}
+
+// manifestReason returns why two manifest entries of a path differ, or
+// "" if they describe the same file.
+func manifestReason(a, b manifestEntry) DiffReason {
+	switch {
+	case a.Digest != "" && b.Digest != "" && a.Algorithm == b.Algorithm:
+		if a.Digest != b.Digest {
+			return ReasonContent
+		}
+	case a.Size != b.Size:
+		return ReasonSize
+	case !a.ModTime.Equal(b.ModTime):
+		return ReasonTime
+	}
+	return ""
+}
+
+// WriteDiff renders r as text, one line per path: "M path (reason)"
+// for paths that differ, "- path" for paths only in the source (or
+// first manifest), and "+ path" for paths only in the target (or
+// second), in that order.
+func WriteDiff(w io.Writer, r *DiffResult) error {
+	for _, e := range r.Differing {
+		if _, err := fmt.Fprintf(w, "M %s (%s)\n", filepath.ToSlash(e.Path), e.Reason); err != nil {
+			return err
+		}
+	}
+	for _, path := range r.OnlyInSource {
+		if _, err := fmt.Fprintf(w, "- %s\n", filepath.ToSlash(path)); err != nil {
+			return err
+		}
+	}
+	for _, path := range r.OnlyInTarget {
+		if _, err := fmt.Fprintf(w, "+ %s\n", filepath.ToSlash(path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
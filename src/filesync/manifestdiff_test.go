@@ -0,0 +1,61 @@
+package filesync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffManifests(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same", old)
+	writeTestFile(t, filepath.Join(src, "edited.txt"), "aaaa", old)
+	writeTestFile(t, filepath.Join(src, "gone.txt"), "gone", old)
+
+	first := filepath.Join(tmp, "first.json")
+	if err := NewFileSync(src, filepath.Join(tmp, "dst1"), false, WithChecksum(true), WithManifest(first)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	// Same size and mod time: only the digests tell the edit apart
+	writeTestFile(t, filepath.Join(src, "edited.txt"), "bbbb", old)
+	os.Remove(filepath.Join(src, "gone.txt"))
+	writeTestFile(t, filepath.Join(src, "sub", "new.txt"), "new", old)
+	second := filepath.Join(tmp, "second.json")
+	if err := NewFileSync(src, filepath.Join(tmp, "dst2"), false, WithChecksum(true), WithManifest(second)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := DiffManifests(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DiffResult{
+		OnlyInSource: []string{"gone.txt"},
+		OnlyInTarget: []string{filepath.Join("sub", "new.txt")},
+		Differing:    []DiffEntry{{Path: "edited.txt", Reason: ReasonContent}},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("DiffManifests = %+v, want %+v", r, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	wantText := "M edited.txt (content)\n- gone.txt\n+ sub/new.txt\n"
+	if buf.String() != wantText {
+		t.Errorf("WriteDiff =\n%s\nwant\n%s", buf.String(), wantText)
+	}
+
+	if r, err := DiffManifests(second, second); err != nil || !r.Empty() {
+		t.Errorf("DiffManifests of a manifest with itself = %+v, %v", r, err)
+	}
+	if _, err := DiffManifests(first, filepath.Join(tmp, "missing.json")); err == nil {
+		t.Error("DiffManifests accepted a missing manifest")
+	}
+}
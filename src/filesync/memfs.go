@@ -0,0 +1,438 @@
+package filesync
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNotEmpty is returned when removing a directory that still has
+// entries.
+var errNotEmpty = errors.New("directory not empty")
+
+// MemFS is an FS held entirely in memory, so code built on FileSync
+// can be tested without touching disk: pass it to WithSourceFS and
+// WithTargetFS, run the sync, and inspect the result with ReadFile,
+// Stat and ReadDir. One MemFS can serve as both source and target.
+//
+// Paths are cleaned with filepath.Clean; the roots "." and "/" always
+// exist. Hard links share their content, as on disk, and there are no
+// symlinks. A MemFS is safe for concurrent use.
+type MemFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+}
+
+// memNode is a file or directory of a MemFS. Hard links are several
+// paths pointing to the same node.
+type memNode struct {
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+// NewMemFS returns an empty in-memory filesystem.
+func NewMemFS() *MemFS {
+	return &MemFS{nodes: map[string]*memNode{}}
+}
+
+// WriteFile creates or replaces the file name with data and the given
+// mod time, creating missing parent directories, to set up a tree.
+func (m *MemFS) WriteFile(name string, data []byte, modTime time.Time) error {
+	if err := m.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err := writeFile(m, name, data); err != nil {
+		return err
+	}
+	return m.Chtimes(name, modTime, modTime)
+}
+
+// ReadFile returns the contents of the file name.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	return readFile(m, name)
+}
+
+// isRoot reports whether the clean path p is a root, which always
+// exists as a directory.
+func isRoot(p string) bool {
+	return p == "." || filepath.Dir(p) == p
+}
+
+// lookup returns the node at the clean path p. The caller holds m.mu.
+func (m *MemFS) lookup(p string) (*memNode, bool) {
+	if isRoot(p) {
+		return &memNode{mode: os.ModeDir | 0755}, true
+	}
+	n, ok := m.nodes[p]
+	return n, ok
+}
+
+// children returns the clean paths directly below dir, sorted. The
+// caller holds m.mu.
+func (m *MemFS) children(dir string) []string {
+	var paths []string
+	for p := range m.nodes {
+		if filepath.Dir(p) == dir && p != dir {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// below reports whether p is inside the directory dir.
+func below(p, dir string) bool {
+	if dir == "." {
+		return !filepath.IsAbs(p) && p != "."
+	}
+	return strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	p := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.lookup(p)
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case ok && n.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		parent, ok := m.lookup(filepath.Dir(p))
+		if !ok || !parent.mode.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		n = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[p] = n
+	}
+	if flag&os.O_TRUNC != 0 {
+		n.data = nil
+		n.modTime = time.Now()
+	}
+	return &memFile{fs: m, node: n, name: name, flag: flag}, nil
+}
+
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	p := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.lookup(p)
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return n.info(filepath.Base(p)), nil
+}
+
+// Lstat is Stat, since a MemFS has no symlinks.
+func (m *MemFS) Lstat(name string) (os.FileInfo, error) {
+	return m.Stat(name)
+}
+
+func (m *MemFS) ReadDir(name string) ([]os.DirEntry, error) {
+	p := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.lookup(p)
+	if !ok {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: os.ErrNotExist}
+	}
+	if !n.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: errors.New("not a directory")}
+	}
+	var entries []os.DirEntry
+	for _, child := range m.children(p) {
+		entries = append(entries, iofs.FileInfoToDirEntry(m.nodes[child].info(filepath.Base(child))))
+	}
+	return entries, nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	p := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var missing []string
+	for ; ; p = filepath.Dir(p) {
+		n, ok := m.lookup(p)
+		if ok {
+			if !n.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: p, Err: errors.New("not a directory")}
+			}
+			break
+		}
+		missing = append(missing, p)
+	}
+	for _, dir := range missing {
+		m.nodes[dir] = &memNode{mode: os.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	p := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.nodes[p]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if n.mode.IsDir() && len(m.children(p)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(m.nodes, p)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	p := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.nodes, p)
+	for other := range m.nodes {
+		if below(other, p) {
+			delete(m.nodes, other)
+		}
+	}
+	return nil
+}
+
+// Rename moves oldname, with everything below it for a directory, to
+// newname, replacing a file or empty directory there.
+func (m *MemFS) Rename(oldname, newname string) error {
+	from, to := filepath.Clean(oldname), filepath.Clean(newname)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.nodes[from]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if from == to {
+		return nil
+	}
+	if parent, ok := m.lookup(filepath.Dir(to)); !ok || !parent.mode.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if old, ok := m.nodes[to]; ok && old.mode.IsDir() && len(m.children(to)) > 0 {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errNotEmpty}
+	}
+	moved := map[string]*memNode{to: n}
+	delete(m.nodes, from)
+	for p, child := range m.nodes {
+		if below(p, from) {
+			moved[to+p[len(from):]] = child
+			delete(m.nodes, p)
+		}
+	}
+	for p, child := range moved {
+		m.nodes[p] = child
+	}
+	return nil
+}
+
+func (m *MemFS) Link(oldname, newname string) error {
+	from, to := filepath.Clean(oldname), filepath.Clean(newname)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.nodes[from]
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if n.mode.IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrPermission}
+	}
+	if _, exists := m.lookup(to); exists {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	m.nodes[to] = n
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode os.FileMode) error {
+	p := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.nodes[p]
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+	}
+	n.mode = n.mode.Type() | mode.Perm()
+	return nil
+}
+
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	p := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.nodes[p]
+	if !ok {
+		return &os.PathError{Op: "chtimes", Path: name, Err: os.ErrNotExist}
+	}
+	n.modTime = mtime
+	return nil
+}
+
+// info describes the node under the given base name.
+func (n *memNode) info(name string) os.FileInfo {
+	return memInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// memInfo is the os.FileInfo of a MemFS entry.
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() os.FileMode  { return i.mode }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
+
+// memFile is an open MemFS file.
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	name   string
+	flag   int
+	offset int64
+	closed bool
+}
+
+// check returns the error for using the file after Close, or for an
+// operation the open mode does not allow.
+func (f *memFile) check(op string, write bool) error {
+	switch {
+	case f.closed:
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	case write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrPermission}
+	case !write && f.flag&os.O_WRONLY != 0:
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrPermission}
+	}
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.node.mode.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	if end := f.offset + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	n := copy(f.node.data[f.offset:], p)
+	f.offset += int64(n)
+	f.node.modTime = time.Now()
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: errors.New("negative offset")}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size]
+	} else {
+		f.node.data = append(f.node.data, make([]byte, size-int64(len(f.node.data)))...)
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: os.ErrClosed}
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+// Sync is a no-op, since the data never leaves memory.
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,104 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemFS_Sync(t *testing.T) {
+	mem := NewMemFS()
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, data := range map[string]string{
+		"/src/a.txt":        "alpha",
+		"/src/sub/b.txt":    "beta",
+		"/dst/a.txt":        "old",
+		"/dst/gone/old.txt": "orphan",
+	} {
+		if err := mem.WriteFile(name, []byte(data), old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One MemFS serves as both sides, with atomic copies staged in it
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithAtomicCopy(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"/dst/a.txt": "alpha", "/dst/sub/b.txt": "beta"} {
+		data, err := mem.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+		info, err := mem.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("%s mod time = %v, want %v", name, info.ModTime(), old)
+		}
+	}
+	if _, err := mem.Stat("/dst/gone/old.txt"); !os.IsNotExist(err) {
+		t.Errorf("orphaned file survived: %v", err)
+	}
+	if got := fs.Stats().FilesCopied; got != 2 {
+		t.Errorf("FilesCopied = %d, want 2", got)
+	}
+
+	// Nothing changes on a second run
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 0 {
+		t.Errorf("second run FilesCopied = %d, want 0", got)
+	}
+}
+
+func TestMemFS_Operations(t *testing.T) {
+	mem := NewMemFS()
+	if err := mem.WriteFile(filepath.Join("d", "f"), []byte("data"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Remove("d"); err == nil {
+		t.Error("removing a non-empty directory succeeded")
+	}
+	if err := mem.Link(filepath.Join("d", "f"), "hard"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mem.OpenFile("hard", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("+more"))
+	f.Close()
+	if data, _ := mem.ReadFile(filepath.Join("d", "f")); string(data) != "data+more" {
+		t.Errorf("hard link does not share content: %q", data)
+	}
+	if err := mem.Rename("d", "e"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := mem.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 2 || names[0] != "e" || names[1] != "hard" {
+		t.Errorf("ReadDir(.) = %v, want [e hard]", names)
+	}
+	if _, err := mem.Stat(filepath.Join("e", "f")); err != nil {
+		t.Errorf("renamed directory lost its contents: %v", err)
+	}
+	if err := mem.RemoveAll("e"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.Stat(filepath.Join("e", "f")); !os.IsNotExist(err) {
+		t.Errorf("RemoveAll left %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package filesync
+
+import (
+	"errors"
+	"log"
+)
+
+// metaFeature is a kind of metadata copied along with files on
+// request: ACLs, file capabilities, alternate streams or file flags.
+type metaFeature uint8
+
+const (
+	metaACLs metaFeature = 1 << iota
+	metaCaps
+	metaStreams
+	metaFlags
+)
+
+func (f metaFeature) String() string {
+	switch f {
+	case metaACLs:
+		return "ACLs"
+	case metaCaps:
+		return "file capabilities"
+	case metaStreams:
+		return "alternate data streams"
+	case metaFlags:
+		return "file flags"
+	}
+	return "metadata"
+}
+
+// metaUnsupported handles err, the result of copying the metadata f.
+// An error wrapping errors.ErrUnsupported means the target cannot hold
+// f or the run may not set it: the first one is logged as a warning,
+// f is left out for the rest of the run (see deniedMeta) and nil is
+// returned. Other errors are returned as they are.
+func (fs *FileSync) metaUnsupported(f metaFeature, err error) error {
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	log.Printf("⚠️ Cannot copy %s, copying without them: %v", f, err)
+	fs.deniedMeta |= f
+	return nil
+}
+
+// metaDenied reports whether the metadata f was found unsupported
+// earlier in the run, so it is no longer copied or compared.
+func (fs *FileSync) metaDenied(f metaFeature) bool {
+	return fs.deniedMeta&f != 0
+}
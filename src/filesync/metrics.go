@@ -0,0 +1,66 @@
+package filesync
+
+import (
+	"sync"
+	"time"
+)
+
+// Metrics are counters accumulated over all runs of a FileSync and
+// gauges describing the latest run, as plain numbers so they can be
+// exported to a monitoring system such as Prometheus without this
+// package depending on a metrics library. A Watch or a service calling
+// SyncDirs periodically counts every pass as a run.
+type Metrics struct {
+	Runs         int64 // runs finished, successful or not
+	FailedRuns   int64 // runs that returned an error
+	FilesCopied  int64
+	FilesDeleted int64
+	BytesCopied  int64
+	Errors       int64 // per-file errors, see Stats.Errors
+
+	LastRunDuration time.Duration
+	LastRunEnd      time.Time
+	LastSuccess     time.Time // end of the latest run without an error; zero if none
+}
+
+// metricsBoard holds the Metrics, which a collector may read while a
+// sync is running.
+type metricsBoard struct {
+	mu      sync.Mutex
+	metrics Metrics
+}
+
+// Metrics returns the counters and gauges of all runs so far. It is
+// safe to call from another goroutine while a sync runs, for example
+// from a Prometheus collector's Collect method.
+func (fs *FileSync) Metrics() Metrics {
+	fs.metrics.mu.Lock()
+	defer fs.metrics.mu.Unlock()
+	return fs.metrics.metrics
+}
+
+// recordRun adds the run that started at start and ended with err to
+// the metrics, and passes them to the WithMetricsHook callback.
+func (fs *FileSync) recordRun(start time.Time, err error) {
+	end := time.Now()
+	fs.metrics.mu.Lock()
+	m := &fs.metrics.metrics
+	m.Runs++
+	m.FilesCopied += int64(fs.stats.FilesCopied)
+	m.FilesDeleted += int64(fs.stats.FilesDeleted)
+	m.BytesCopied += fs.stats.BytesCopied
+	m.Errors += int64(len(fs.stats.Errors))
+	m.LastRunDuration = end.Sub(start)
+	m.LastRunEnd = end
+	if err != nil {
+		m.FailedRuns++
+	} else if len(fs.stats.Errors) == 0 {
+		m.LastSuccess = end
+	}
+	snapshot := *m
+	fs.metrics.mu.Unlock()
+
+	if fs.onMetrics != nil {
+		fs.onMetrics(snapshot)
+	}
+}
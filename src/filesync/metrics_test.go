@@ -0,0 +1,80 @@
+package filesync
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Metrics(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", time.Now())
+	writeTestFile(t, filepath.Join(dst, "old.txt"), "old", time.Now())
+
+	var hooked []Metrics
+	fs := NewFileSync(src, dst, true, WithMetricsHook(func(m Metrics) { hooked = append(hooked, m) }))
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(src, "b.txt"), "beta!", time.Now())
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := fs.Metrics()
+	if m.Runs != 3 || m.FailedRuns != 0 {
+		t.Errorf("Runs = %d, FailedRuns = %d, want 3 and 0", m.Runs, m.FailedRuns)
+	}
+	if m.FilesCopied != 2 || m.FilesDeleted != 1 || m.BytesCopied != 10 {
+		t.Errorf("FilesCopied = %d, FilesDeleted = %d, BytesCopied = %d, want 2, 1 and 10", m.FilesCopied, m.FilesDeleted, m.BytesCopied)
+	}
+	if m.LastSuccess.Before(start) || !m.LastSuccess.Equal(m.LastRunEnd) {
+		t.Errorf("LastSuccess = %v, LastRunEnd = %v", m.LastSuccess, m.LastRunEnd)
+	}
+	if len(hooked) != 3 || hooked[2] != m {
+		t.Errorf("hook saw %d runs, last %+v, want 3 ending with %+v", len(hooked), hooked, m)
+	}
+}
+
+func TestFileSync_MetricsFailedRun(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", time.Now())
+
+	// Two-way sync with several sources fails after the stats reset
+	fs := NewFileSync(src, filepath.Join(tmp, "dst"), false, WithBidirectional(true))
+	fs.AddSource(src)
+	if err := fs.SyncDirs(); err == nil {
+		t.Fatal("expected an error")
+	}
+	m := fs.Metrics()
+	if m.Runs != 1 || m.FailedRuns != 1 || !m.LastSuccess.IsZero() {
+		t.Errorf("Runs = %d, FailedRuns = %d, LastSuccess = %v", m.Runs, m.FailedRuns, m.LastSuccess)
+	}
+}
+
+func TestStatusHandler_Metrics(t *testing.T) {
+	fs := NewFileSync(t.TempDir(), t.TempDir(), false)
+	fs.metrics.metrics = Metrics{Runs: 4, BytesCopied: 2048, LastRunDuration: 1500 * time.Millisecond}
+
+	rec := httptest.NewRecorder()
+	fs.statusHandler(&statusBoard{}).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE filesync_runs_total counter\nfilesync_runs_total 4\n",
+		"filesync_bytes_copied_total 2048\n",
+		"# TYPE filesync_last_run_duration_seconds gauge\nfilesync_last_run_duration_seconds 1.5\n",
+		"filesync_last_success_timestamp_seconds 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics lacks %q:\n%s", want, body)
+		}
+	}
+}
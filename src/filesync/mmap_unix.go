@@ -0,0 +1,62 @@
+//go:build linux || darwin
+
+package filesync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapEqual compares two files of the given size through read-only
+// memory maps. ok is false when a file cannot be mapped, or shrinks
+// while it is compared, which faults on the pages past its new end,
+// and the caller should compare some other way.
+func mmapEqual(pathA, pathB string, size int64) (equal, ok bool, err error) {
+	a, err := mapFile(pathA, size)
+	if err != nil {
+		return false, false, nil
+	}
+	defer unix.Munmap(a)
+	b, err := mapFile(pathB, size)
+	if err != nil {
+		return false, false, nil
+	}
+	defer unix.Munmap(b)
+	equal, ok = mappedEqual(a, b)
+	return equal, ok, nil
+}
+
+// mappedEqual compares two mapped files. ok is false when reading
+// them faulted, as it does on the pages of a file truncated after it
+// was mapped, instead of the fault crashing the process.
+func mappedEqual(a, b []byte) (equal, ok bool) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, fault := r.(runtime.Error); !fault {
+				panic(r)
+			}
+			equal, ok = false, false
+		}
+	}()
+	return bytes.Equal(a, b), true
+}
+
+// mapFile maps the first size bytes of path read-only.
+func mapFile(path string, size int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// The mapping stays valid after the file is closed
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.Size() != size {
+		return nil, fmt.Errorf("%s changed size before it was mapped", path)
+	}
+	return unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+}
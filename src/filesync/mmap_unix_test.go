@@ -0,0 +1,36 @@
+//go:build linux || darwin
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMappedEqualTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shrinking.bin")
+	content := strings.Repeat("x", 1<<16)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := mapFile(path, int64(len(content)))
+	if err != nil {
+		t.Skipf("cannot map files here: %v", err)
+	}
+	defer unix.Munmap(mapped)
+
+	// Truncated behind the mapping, as by another process
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mappedEqual(mapped, []byte(content)); ok {
+		t.Error("mappedEqual() of a truncated file = ok, want the fault reported")
+	}
+	if _, err := mapFile(path, int64(len(content))); err == nil {
+		t.Error("mapFile() of a file smaller than expected succeeded")
+	}
+}
@@ -0,0 +1,102 @@
+package filesync
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// oddNames are file names a messy real-world tree can hold: spaces,
+// control characters and bytes that are not valid UTF-8.
+var oddNames = []string{
+	"with space.txt",
+	"new\nline.txt",
+	"tab\there.txt",
+	"bad\xff\xfeutf8.txt",
+	"\x1b[31mred.txt",
+}
+
+func TestFileSync_OddFileNames(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, name := range oddNames {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Logf("skipping %q, the filesystem does not allow it: %v", name, err)
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		t.Skip("the filesystem allows none of the odd names")
+	}
+	oddDir := filepath.Join("odd dir\n", "inner.txt")
+	haveDir := os.Mkdir(filepath.Join(src, "odd dir\n"), 0755) == nil
+	if haveDir {
+		writeTestFile(t, filepath.Join(src, oddDir), "inner", old)
+	}
+	orphan := "gone\xff.txt"
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	haveOrphan := os.WriteFile(filepath.Join(dst, orphan), []byte("x"), 0644) == nil
+
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	fs := NewFileSync(src, dst, true)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs() = %v", err)
+	}
+	if errs := fs.Stats().Errors; len(errs) > 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	for _, name := range names {
+		if got := readTestFile(t, filepath.Join(dst, name)); got != name {
+			t.Errorf("%q = %q, want its own name", name, got)
+		}
+		if !strings.Contains(logs.String(), strconv.Quote(filepath.Join(dst, name))) {
+			t.Errorf("log does not quote %q", name)
+		}
+	}
+	if haveDir {
+		if got := readTestFile(t, filepath.Join(dst, oddDir)); got != "inner" {
+			t.Errorf("file in an odd directory = %q, want %q", got, "inner")
+		}
+	}
+	if haveOrphan {
+		if _, err := os.Stat(filepath.Join(dst, orphan)); !os.IsNotExist(err) {
+			t.Errorf("orphan %q was not deleted: %v", orphan, err)
+		}
+	}
+
+	// No name splits a log line or sends raw bytes to the terminal
+	for _, line := range strings.Split(strings.TrimSuffix(logs.String(), "\n"), "\n") {
+		if !strings.HasPrefix(line, time.Now().Format("2006/")) {
+			t.Errorf("log line does not start with a timestamp: %q", line)
+		}
+		if strings.ContainsRune(line, '\x1b') || strings.Contains(line, "\xff") {
+			t.Errorf("log line carries a raw name: %q", line)
+		}
+	}
+
+	// A second run finds everything up to date
+	fs = NewFileSync(src, dst, true)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("second SyncDirs() = %v", err)
+	}
+	if n := fs.Stats().FilesCopied; n != 0 {
+		t.Errorf("second run copied %d file(s), want 0", n)
+	}
+}
@@ -0,0 +1,43 @@
+package filesync
+
+import "math"
+
+// reservedFiles are the descriptors of the soft limit left to
+// everything but the files being compared or copied: standard streams,
+// logs, directory listings, and status server or SFTP connections.
+const reservedFiles = 64
+
+// defaultMaxOpenFiles derives how many source and target file pairs
+// may be open at once from the soft limit on open files, leaving
+// reservedFiles spare, or returns 0, no bound, if the limit is unknown
+// or unlimited.
+func defaultMaxOpenFiles() int {
+	limit, ok := openFileLimit()
+	if !ok || limit > math.MaxInt32 {
+		return 0
+	}
+	return max(int(limit)-reservedFiles, 2) / 2
+}
+
+// newOpenSlots returns the semaphore bounding open file pairs to n (or
+// the default for n < 1), nil when there is no bound.
+func newOpenSlots(n int) chan struct{} {
+	if n < 1 {
+		n = defaultMaxOpenFiles()
+	}
+	if n < 1 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// acquireFiles blocks until a source file and its target counterpart
+// may be opened (see WithMaxOpenFiles) and returns the function that
+// gives the slot back.
+func (fs *FileSync) acquireFiles() func() {
+	if fs.openSlots == nil {
+		return func() {}
+	}
+	fs.openSlots <- struct{}{}
+	return func() { <-fs.openSlots }
+}
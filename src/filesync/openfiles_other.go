@@ -0,0 +1,9 @@
+//go:build !unix
+
+package filesync
+
+// openFileLimit is unknown here, so open files are not bounded by
+// default.
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,168 @@
+package filesync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openCountFS is a MemFS that counts the files open at once.
+type openCountFS struct {
+	*MemFS
+	open atomic.Int32
+	peak atomic.Int32
+}
+
+// countedFile is a file of openCountFS, uncounted when closed.
+type countedFile struct {
+	File
+	fsys   *openCountFS
+	closed bool
+}
+
+func (f *countedFile) Close() error {
+	if !f.closed {
+		f.closed = true
+		f.fsys.open.Add(-1)
+	}
+	return f.File.Close()
+}
+
+func (c *openCountFS) count(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	n := c.open.Add(1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	// Stay open for a while, like a slow disk
+	time.Sleep(2 * time.Millisecond)
+	return &countedFile{File: f, fsys: c}, nil
+}
+
+func (c *openCountFS) Open(name string) (File, error) {
+	return c.count(c.MemFS.Open(name))
+}
+
+func (c *openCountFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return c.count(c.MemFS.OpenFile(name, flag, perm))
+}
+
+func TestFileSync_MaxOpenFiles(t *testing.T) {
+	for _, limit := range []int{1, 3} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			mem := NewMemFS()
+			mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			for i := 0; i < 24; i++ {
+				name := fmt.Sprintf("f%02d.txt", i)
+				if err := mem.WriteFile("/src/"+name, []byte("new"), mtime); err != nil {
+					t.Fatal(err)
+				}
+				if err := mem.WriteFile("/dst/"+name, []byte("old"), mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			counted := &openCountFS{MemFS: mem}
+
+			fs := NewFileSync("/src", "/dst", false, WithSourceFS(counted), WithTargetFS(counted),
+				WithChecksum(true), WithWorkers(8), WithMaxOpenFiles(limit))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if got := fs.Stats().FilesCopied; got != 24 {
+				t.Errorf("FilesCopied = %d, want 24", got)
+			}
+			// Each slot is one source file and its target counterpart
+			if peak := counted.peak.Load(); peak > int32(2*limit) {
+				t.Errorf("%d files were open at once, want at most %d", peak, 2*limit)
+			}
+			if open := counted.open.Load(); open != 0 {
+				t.Errorf("%d file(s) left open", open)
+			}
+		})
+	}
+	if n := defaultMaxOpenFiles(); n < 0 {
+		t.Errorf("defaultMaxOpenFiles() = %d", n)
+	}
+}
+
+// dirCountFS is a MemFS that records the most files open at once
+// within each directory.
+type dirCountFS struct {
+	*MemFS
+	mu   sync.Mutex
+	open map[string]int
+	peak map[string]int
+}
+
+// dirCountedFile is a file of dirCountFS, uncounted when closed.
+type dirCountedFile struct {
+	File
+	fsys   *dirCountFS
+	dir    string
+	closed bool
+}
+
+func (f *dirCountedFile) Close() error {
+	if !f.closed {
+		f.closed = true
+		f.fsys.mu.Lock()
+		f.fsys.open[f.dir]--
+		f.fsys.mu.Unlock()
+	}
+	return f.File.Close()
+}
+
+func (c *dirCountFS) Open(name string) (File, error) {
+	f, err := c.MemFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(name)
+	c.mu.Lock()
+	c.open[dir]++
+	c.peak[dir] = max(c.peak[dir], c.open[dir])
+	c.mu.Unlock()
+	// Stay open for a while, like a slow share
+	time.Sleep(2 * time.Millisecond)
+	return &dirCountedFile{File: f, fsys: c, dir: dir}, nil
+}
+
+func TestFileSync_MaxPerDirectory(t *testing.T) {
+	mem := NewMemFS()
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, dir := range []string{"a", "b", "c"} {
+		for i := 0; i < 12; i++ {
+			name := fmt.Sprintf("%s/f%02d.txt", dir, i)
+			if err := mem.WriteFile("/src/"+name, []byte("same"), mtime); err != nil {
+				t.Fatal(err)
+			}
+			if err := mem.WriteFile("/dst/"+name, []byte("same"), mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tgt := &dirCountFS{MemFS: mem, open: map[string]int{}, peak: map[string]int{}}
+
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(tgt),
+		WithChecksum(true), WithWorkers(12), WithMaxPerDirectory(2))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesSkipped; got != 36 {
+		t.Errorf("FilesSkipped = %d, want 36", got)
+	}
+	for _, dir := range []string{"a", "b", "c"} {
+		if peak := tgt.peak[filepath.Join("/dst", dir)]; peak > 2 {
+			t.Errorf("%d files open at once in %s, want at most 2", peak, dir)
+		}
+	}
+}
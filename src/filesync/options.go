@@ -0,0 +1,1753 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Option configures optional FileSync behavior.
+// Options are applied in order by NewFileSync, so a later
+// option overrides an earlier one touching the same setting.
+type Option func(*FileSync)
+
+// WithDeleteRetention delays deletion of target files that are
+// missing from source until they have been missing for at least d.
+// The first time an orphan is seen is persisted in a small state
+// file (see WithRetentionStateFile). A zero duration deletes
+// orphans immediately, which is the default.
+func WithDeleteRetention(d time.Duration) Option {
+	return func(fs *FileSync) {
+		fs.deleteRetention = d
+	}
+}
+
+// WithDeleteRetentionRuns delays deletion of target files that are
+// missing from source until they have been missing in n runs in a
+// row, counted in the same state file as WithDeleteRetention; a file
+// back in the source starts over. With both, an orphan must have
+// waited out both. Dry runs do not count. Zero, the default, does not
+// count runs.
+func WithDeleteRetentionRuns(n int) Option {
+	return func(fs *FileSync) {
+		fs.retentionRuns = n
+	}
+}
+
+// WithDeleteOlderThan only deletes orphaned target files last modified
+// at least d ago; more recent ones are logged and kept, a grace period
+// for files that may still matter. Unlike WithDeleteRetention it needs
+// no state file, as it goes by the target file's own mod time. A zero
+// duration deletes orphans of any age, which is the default.
+func WithDeleteOlderThan(d time.Duration) Option {
+	return func(fs *FileSync) {
+		fs.deleteOlderThan = d
+	}
+}
+
+// WithRetentionStateFile sets where the delete-retention state is
+// stored, a path on the local filesystem even when the target is
+// remote. By default it lives in the target directory as
+// ".filesync-retention.json".
+func WithRetentionStateFile(path string) Option {
+	return func(fs *FileSync) {
+		fs.retentionStatePath = path
+	}
+}
+
+// WithAtomicCopy makes each copy write into a temporary partial file
+// next to the destination and rename it into place once complete,
+// so a target file never appears half-written.
+func WithAtomicCopy(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.atomicCopy = enabled
+	}
+}
+
+// WithResume lets an interrupted copy continue from the partial file
+// left behind by a previous run instead of starting over. The already
+// copied prefix is compared against the source before appending, and
+// a mismatch restarts the copy from scratch. Resume implies atomic
+// copies, since the partial file is what gets resumed.
+func WithResume(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.resume = enabled
+		if enabled {
+			fs.atomicCopy = true
+		}
+	}
+}
+
+// WithTempDir writes atomic copies to dir, which must be on the local
+// filesystem, instead of next to each target file, and implies atomic
+// copies. When dir is on the same device as the target the finished
+// file is renamed into place; otherwise it is copied into a partial
+// file beside the target and renamed from there, keeping the final
+// replacement atomic. The same happens, with a log line, when a rename
+// expected to work fails because the two are different filesystems
+// after all, as across bind mounts.
+func WithTempDir(dir string) Option {
+	return func(fs *FileSync) {
+		fs.tempDir = dir
+		if dir != "" {
+			fs.atomicCopy = true
+		}
+	}
+}
+
+// WithCopyIgnoreFiles controls whether .syncignore files are copied
+// to the target. They are still honored either way; by default they
+// stay in the source only.
+func WithCopyIgnoreFiles(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.copyIgnoreFiles = enabled
+	}
+}
+
+// WithChecksum compares equal-sized files by content digest (SHA-256
+// unless WithHashAlgorithm picks another) instead of modification
+// time. This is slower, since both files must be read, but catches
+// edits that preserved size and mod time.
+func WithChecksum(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.checksum = enabled
+	}
+}
+
+// WithContentOnly decides purely by content, for trees whose mod times
+// mean nothing, such as fresh VCS checkouts: files of different size
+// differ, equal-sized ones are compared by checksum as with
+// WithChecksum, and mod times are never looked at. Copies keep the
+// time they were written at unless WithKeepModTimes is also given.
+// Update-only mode and two-way sync cannot be used with it.
+func WithContentOnly(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.contentOnly = enabled
+	}
+}
+
+// WithComparison sets what the comparator checks to decide whether a
+// target file is up to date, for backing stores with quirky metadata
+// such as object stores that cannot keep mod times. See Comparison for
+// the combinations and their cost. WithChecksum and WithContentOnly
+// take precedence and compare by content with mod times ignored.
+func WithComparison(c Comparison) Option {
+	return func(fs *FileSync) {
+		fs.compare = c
+	}
+}
+
+// WithKeepModTimes still sets the source's mod time on copied files in
+// content-only mode (see WithContentOnly).
+func WithKeepModTimes(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.keepModTimes = enabled
+	}
+}
+
+// WithChecksumCache keeps the digests computed in checksum mode in a
+// cache file (see WithChecksumCacheFile), keyed by path together with
+// the file's size and mod time. A file whose size and mod time are
+// unchanged since it was hashed is not read again, which makes nightly
+// checksum runs over a stable tree cheap. Note that this trusts size
+// and mod time for unchanged files, just like the default comparator.
+func WithChecksumCache(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.checksumCache = enabled
+	}
+}
+
+// WithChecksumCacheFile sets where the checksum cache is stored, as a
+// local file even when the target is remote. By default it lives in
+// the target directory as ".filesync-checksums.json".
+func WithChecksumCacheFile(path string) Option {
+	return func(fs *FileSync) {
+		fs.checksumCachePath = path
+	}
+}
+
+// WithFailOnAccessError makes the sync stop with an error when a
+// source entry cannot be walked, stat'ed, or read, instead of logging
+// it and continuing. Use it for backups where a silently skipped
+// file is worse than a failed run.
+func WithFailOnAccessError(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.failOnAccessError = enabled
+	}
+}
+
+// WithTimeTolerance treats modification times that differ by at most
+// d as equal. Filesystems like FAT store times at 2-second granularity,
+// so a tolerance of 2s stops identical files from being recopied on
+// every run. The default of zero requires an exact match.
+func WithTimeTolerance(d time.Duration) Option {
+	return func(fs *FileSync) {
+		fs.timeTolerance = d
+	}
+}
+
+// WithClockSkew sets how far apart the clocks of the hosts writing the
+// source and target may be. Files of equal size whose mod times differ
+// by no more than d are compared by checksum instead of by time: if the
+// content is identical nothing is copied, whichever side looks newer,
+// which keeps two-way syncs and update-only runs between machines with
+// skewed clocks from copying the same file back and forth. Unlike
+// WithTimeTolerance, a real edit within the window is still found;
+// the cost is hashing those files on both sides.
+func WithClockSkew(d time.Duration) Option {
+	return func(fs *FileSync) {
+		fs.clockSkew = d
+	}
+}
+
+// WithWriteCheck makes each run write a probe file to the target and
+// remove it again before walking anything, so that a target on a
+// read-only filesystem, such as one mounted read-only, fails the run
+// with ErrReadOnlyTarget instead of an error for every file. It is off
+// by default, since the probe bumps the target root's mod time and
+// costs round trips on remote targets; WithClockCheck writes the same
+// probe and catches a read-only target too. Dry runs skip the probe.
+func WithWriteCheck(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.writeCheck = enabled
+	}
+}
+
+// WithClockCheck measures, before each run, how far the clock of the
+// target's host is off this one's, by writing a probe file to the
+// target (the one of WithWriteCheck) and comparing the mod time it
+// gets with the local time. The skew is logged and kept in
+// Stats.ClockSkew. Beyond threshold, which is the usual cause of files
+// that recopy on every run or never update, a warning is logged, or
+// with fail the run stops with ErrClockSkew before touching anything.
+// Only targets on another host, such as network mounts and SFTP, can
+// show a skew; dry runs skip the check. Zero, the default, disables
+// it.
+func WithClockCheck(threshold time.Duration, fail bool) Option {
+	return func(fs *FileSync) {
+		fs.clockCheck = threshold
+		fs.clockCheckFail = fail
+	}
+}
+
+// WithModifiedSince skips source files last modified before t, whether
+// or not they exist in the target, so an incremental export only has
+// to pass the start time of the previous run instead of comparing the
+// whole tree. Skipped files are counted in Stats.FilesTooOld. The
+// delete pass is not affected: an old file still exists in the source,
+// so its target copy is kept. The zero time disables the cutoff.
+func WithModifiedSince(t time.Time) Option {
+	return func(fs *FileSync) {
+		fs.modifiedSince = t
+	}
+}
+
+// WithAccessedSince skips source files that were last accessed longer
+// than d ago, for backing up a tier of hot data, as told by their
+// access time (atime) on Linux, macOS and Windows, and by their mod
+// time elsewhere. Skipped files are counted in Stats.FilesNotAccessed,
+// and as with WithModifiedSince, their target copies are kept by the
+// delete pass. Access times are often unreliable: filesystems mounted
+// noatime never update them, relatime only about once a day, and
+// copying a file reads it and so may refresh its access time; see
+// WithAccessTimeFallback. Zero disables the cutoff.
+func WithAccessedSince(d time.Duration) Option {
+	return func(fs *FileSync) {
+		fs.accessedSince = d
+	}
+}
+
+// WithAccessTimeFallback makes WithAccessedSince also count a file's
+// mod time as an access, for filesystems mounted noatime, where the
+// access times stay at when files were created, so recently written
+// files still count as hot.
+func WithAccessTimeFallback(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.accessFallback = enabled
+	}
+}
+
+// WithExcludes excludes the entries matching patterns, written like
+// the lines of a .syncignore file ("*.tmp", "build/", "/cache",
+// "!keep.tmp"), as if they came first in a .syncignore file at the
+// source root; rules in the .syncignore files still apply after them
+// and can override them.
+func WithExcludes(patterns ...string) Option {
+	return func(fs *FileSync) {
+		for _, p := range patterns {
+			if r, ok := parseIgnoreRule(p, ""); ok {
+				fs.excludes = append(fs.excludes, r)
+			}
+		}
+	}
+}
+
+// WithIncludes keeps the entries matching patterns in the sync even
+// though WithExcludes excludes them, like "!pattern" rules after all
+// of the excludes, such as WithExcludes("*.log") with
+// WithIncludes("audit.log"). Rules in the .syncignore files still
+// apply after them.
+func WithIncludes(patterns ...string) Option {
+	return func(fs *FileSync) {
+		for _, p := range patterns {
+			if r, ok := parseIgnoreRule("!"+strings.TrimPrefix(p, "!"), ""); ok {
+				fs.includes = append(fs.includes, r)
+			}
+		}
+	}
+}
+
+// WithExtensions restricts the sync to files with one of the given
+// extensions. Matching is case-insensitive and the leading dot is
+// optional. Files with other extensions are neither copied nor
+// deleted from the target. Calling it with no extensions allows all.
+func WithExtensions(exts ...string) Option {
+	return func(fs *FileSync) {
+		fs.extensions = nil
+		for _, ext := range exts {
+			if ext = normalizeExtension(ext); ext != "" {
+				if fs.extensions == nil {
+					fs.extensions = map[string]bool{}
+				}
+				fs.extensions[ext] = true
+			}
+		}
+	}
+}
+
+// WithShard restricts the sync to the files whose path hashes to
+// index of total shards, so several machines running the same sync
+// each handle their own part of a huge tree without coordinating. The
+// hash is of the path relative to the source root, so every node
+// splits the tree the same way. Like WithExtensions, the files of
+// other shards are neither copied nor deleted from the target, so
+// nodes writing to one shared target leave each other's files alone,
+// while directories are mirrored by every node. Each shard keeps its
+// own source count (see WithSourceDropGuard) and manifest (see
+// WithManifest), with the shard in the file name, such as
+// manifest.2-of-4.json for index 1 of 4. Snapshots, directory swaps,
+// two-way sync and a content-addressable store need the whole tree and
+// cannot be sharded. An index outside 0 to total-1 makes the sync
+// fail; total 1 is the whole tree.
+func WithShard(index, total int) Option {
+	return func(fs *FileSync) {
+		fs.shardIndex = index
+		fs.shardCount = total
+	}
+}
+
+// WithContentMatch restricts the sync to files whose first maxBytes of
+// content match re, such as log files carrying a marker; zero or less
+// searches the first 64 KiB. Like WithContentTypes, other files are
+// neither copied nor deleted from the target, and every file is opened
+// and its start read during the walk, so this is slower than filtering
+// by name. A nil re allows all.
+func WithContentMatch(re *regexp.Regexp, maxBytes int) Option {
+	return func(fs *FileSync) {
+		fs.contentMatch, fs.contentMatchBytes = re, maxBytes
+		if maxBytes <= 0 {
+			fs.contentMatchBytes = defaultContentMatchBytes
+		}
+	}
+}
+
+// WithContentTypes restricts the sync to files whose content, sniffed
+// from the first 512 bytes with http.DetectContentType, has one of the
+// given types, whatever their extension. A type is either exact, such
+// as "application/pdf", or a family such as "image/*". Like
+// WithExtensions, files of other types are neither copied nor deleted
+// from the target. Every file is opened during the walk to sniff it,
+// so this is slower than filtering by name. Calling it with no types
+// allows all.
+func WithContentTypes(types ...string) Option {
+	return func(fs *FileSync) {
+		fs.contentTypes = nil
+		for _, t := range types {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				fs.contentTypes = append(fs.contentTypes, t)
+			}
+		}
+	}
+}
+
+// WithWorkers sets how many files are compared concurrently, which
+// speeds up checksum mode on multi-core machines with fast storage.
+// Values below one fall back to the default of one worker per CPU.
+func WithWorkers(n int) Option {
+	return func(fs *FileSync) {
+		fs.workers = n
+	}
+}
+
+// WithAutoWorkers tunes the number of comparison workers while they
+// run instead of using WithWorkers as is: the pool starts with two,
+// the bytes the comparisons read to hash or compare contents are
+// measured every quarter second, and workers are added one at a time
+// while that raises the throughput and taken away again once it drops,
+// so fast local disks get many and a saturated network mount few.
+// Comparisons by size and mod time, or by a cached checksum, read
+// nothing and leave the pool as it started. WithWorkers, or one per
+// CPU, is the most it goes up to. The count that did best is in
+// Stats.Workers. Copies run one at a time after the comparisons, in
+// walk order, so only the comparison pool is tuned.
+func WithAutoWorkers(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.autoWorkers = enabled
+	}
+}
+
+// WithDryRun makes SyncDirs decide what it would do without writing
+// anything to the target. The decisions are available afterwards via
+// PlannedActions.
+func WithDryRun(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.dryRun = enabled
+	}
+}
+
+// WithUpdateOnly only replaces a differing target file when the
+// source's modification time is strictly newer, so intentionally
+// newer edits in the target are never overwritten by older sources.
+// Files missing from the target are copied as usual.
+func WithUpdateOnly(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.updateOnly = enabled
+	}
+}
+
+// WithExistingOnly only updates files the target already has, like
+// rsync's --existing: source files without a counterpart in the target
+// are skipped and counted in Stats.FilesNotInTarget, and directories
+// missing from it are skipped whole, so nothing new is created. Files
+// that do exist are compared and replaced as usual. Nothing is deleted
+// in this mode, whatever deleteMissing says. It cannot be combined with
+// two-way sync, or with snapshots and directory swaps, whose new tree
+// would hold nothing.
+func WithExistingOnly(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.existingOnly = enabled
+	}
+}
+
+// WithNoDowngrade keeps target files whose mod time is not older than
+// their source's from being overwritten with older content, unless the
+// sizes differ. An existing target file is replaced exactly when the
+// comparator finds a difference and either its size differs from the
+// source's or the source's mod time is strictly later; files missing
+// from the target are always copied. Unlike WithUpdateOnly, which also
+// keeps newer targets of a different size, a size change always
+// wins. Skipped files are logged as having a newer target.
+func WithNoDowngrade(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.noDowngrade = enabled
+	}
+}
+
+// WithFirstSourceWins resolves path collisions between multiple
+// sources (see AddSource) in favor of the earliest source instead
+// of the latest.
+func WithFirstSourceWins(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.firstSourceWins = enabled
+	}
+}
+
+// WithPreallocate reserves each target file's full size before
+// copying (fallocate on Linux, truncate elsewhere), which reduces
+// fragmentation for large files on some filesystems. Failures to
+// preallocate are ignored and the copy proceeds normally.
+func WithPreallocate(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.preallocate = enabled
+	}
+}
+
+// WithSpanTracer emits distributed tracing spans for every run through
+// tracer, such as an adapter around an OpenTelemetry tracer: a
+// filesync.sync span with the source, target and totals, a child span
+// for each phase (filesync.walk, filesync.compare, filesync.copy and
+// filesync.delete), an event for each change made to the target and
+// the per-file errors. The run's span is a child of the span in the
+// context given to SyncDirsContext or Watch, if any. With several
+// targets, each target's run gets its own span. Without a tracer
+// nothing is done.
+func WithSpanTracer(tracer SpanTracer) Option {
+	return func(fs *FileSync) {
+		fs.spans = nil
+		if tracer != nil {
+			fs.spans = &spanTracing{tracer: tracer}
+		}
+	}
+}
+
+// WithTrace records every run to a trace file at path on the local
+// filesystem, for debugging a surprising outcome: after a versioned
+// header, one JSON line per event, in order, for the comparator's
+// decision on each source file with the stat results it was made from,
+// for each change made to the target and for each per-file error.
+// Replay repeats a trace's changes. Each run replaces the previous
+// trace; with several targets, only the first one's run is traced.
+func WithTrace(path string) Option {
+	return func(fs *FileSync) {
+		fs.tracePath = path
+	}
+}
+
+// WithSmallFileThreshold sets the size below which a file is copied by
+// reading all of it into memory at once and writing it in one call,
+// instead of streaming it: for trees of tiny files the per-file cost of
+// the streaming loop adds up. Larger files, resumed copies and
+// transformed files are always streamed. It defaults to 64 KiB; zero
+// streams every file.
+func WithSmallFileThreshold(size int64) Option {
+	return func(fs *FileSync) {
+		fs.smallFileSize = size
+	}
+}
+
+// WithWatchDebounce sets how long Watch waits after the last event
+// before syncing the changed paths. The default is 500ms.
+func WithWatchDebounce(d time.Duration) Option {
+	return func(fs *FileSync) {
+		if d > 0 {
+			fs.watchDebounce = d
+		}
+	}
+}
+
+// WithFileMode sets the permission bits of every file written to the
+// target, e.g. 0664 for group-writable shared directories. The mode is
+// applied with chmod, so it is not reduced by the umask. Zero keeps
+// the default behavior.
+func WithFileMode(mode os.FileMode) Option {
+	return func(fs *FileSync) {
+		fs.fileMode = mode.Perm()
+	}
+}
+
+// WithModeRule gives files written to the target whose relative path
+// matches pattern the permission bits mode, whatever the source's mode
+// or WithFileMode says. Patterns use path.Match syntax; without a
+// slash they match the base name (for example "*.sh"), with one the
+// whole slash-separated path (for example "bin/*"). It may be given
+// several times, and the last matching rule wins.
+func WithModeRule(pattern string, mode os.FileMode) Option {
+	return func(fs *FileSync) {
+		fs.modeRules = append(fs.modeRules, modeRule{pattern: pattern, mode: mode.Perm()})
+	}
+}
+
+// WithDirMode sets the permission bits of directories the sync creates
+// in the target, e.g. 0775. Like WithFileMode it bypasses the umask,
+// and zero keeps the default of 0755.
+func WithDirMode(mode os.FileMode) Option {
+	return func(fs *FileSync) {
+		fs.dirMode = mode.Perm()
+	}
+}
+
+// WithSourceFS reads the sources from fsys instead of the local
+// filesystem. Every source added with AddSource lives on it too.
+func WithSourceFS(fsys FS) Option {
+	return func(fs *FileSync) {
+		fs.srcFS = fsys
+	}
+}
+
+// WithTargetFS writes the target to fsys instead of the local
+// filesystem.
+func WithTargetFS(fsys FS) Option {
+	return func(fs *FileSync) {
+		fs.tgtFS = fsys
+	}
+}
+
+// WithSFTPSource reads the sources from the SSH server at addr
+// ("host:port") over SFTP, with source paths taken as remote paths.
+// The connection is made when the first sync starts; a failure to
+// connect is returned from that sync. Call Close when done.
+func WithSFTPSource(addr string, config *ssh.ClientConfig) Option {
+	return func(fs *FileSync) {
+		fs.sftpSource = &sftpEndpoint{addr: addr, config: config}
+	}
+}
+
+// WithSFTPTarget writes the target to the SSH server at addr over
+// SFTP, like WithSFTPSource does for the sources.
+func WithSFTPTarget(addr string, config *ssh.ClientConfig) Option {
+	return func(fs *FileSync) {
+		fs.sftpTarget = &sftpEndpoint{addr: addr, config: config}
+	}
+}
+
+// WithLock makes each sync hold an exclusive advisory lock (flock) on
+// a ".filesync.lock" file in the target while it runs, so overlapping
+// runs, e.g. from cron, cannot interleave their writes. The lock file
+// itself is never synced or deleted. See WithLockTimeout for what
+// happens when the lock is taken.
+func WithLock(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.lock = enabled
+	}
+}
+
+// WithLockTimeout sets how long a sync waits for another sync to
+// release the target's lock before failing with ErrLocked. The
+// default of zero fails immediately. It only matters with WithLock.
+func WithLockTimeout(d time.Duration) Option {
+	return func(fs *FileSync) {
+		fs.lockTimeout = d
+	}
+}
+
+// WithProgress registers a callback that receives progress updates
+// while files are copied: when each file starts and finishes, and
+// periodically during large files. It runs on the syncing goroutine,
+// so it should return quickly. Dry runs report no progress.
+func WithProgress(fn func(Progress)) Option {
+	return func(fs *FileSync) {
+		fs.onProgress = fn
+	}
+}
+
+// WithChangedRetries sets how many times a file is copied again when
+// the source changed while it was being copied (see
+// ErrChangedDuringCopy). The default of zero only warns: the file is
+// listed in Stats().ChangedDuringCopy and left for the next run.
+func WithChangedRetries(n int) Option {
+	return func(fs *FileSync) {
+		fs.changedRetries = n
+	}
+}
+
+// WithPruneEmptyDirs removes directories that are empty in the target
+// after syncing, deepest first, independently of deleteMissing. This
+// covers directories whose contents are all excluded, which are then
+// not created in the first place. Directories that are empty in the
+// source as well are kept, unless WithPruneSourceEmptyDirs is set.
+func WithPruneEmptyDirs(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.pruneEmptyDirs = enabled
+	}
+}
+
+// WithNoEmptyDirs creates a target directory only once something is
+// about to be written into it, so source directories that are empty,
+// or end up empty because every file in them is filtered out, never
+// appear in the target. Unlike WithPruneEmptyDirs it removes nothing:
+// empty directories already in the target are left alone. The default
+// mirrors every source directory.
+func WithNoEmptyDirs(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.noEmptyDirs = enabled
+	}
+}
+
+// WithPruneSourceEmptyDirs makes WithPruneEmptyDirs also prune (and
+// not create) directories that are empty in the source.
+func WithPruneSourceEmptyDirs(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.pruneSourceEmptyDirs = enabled
+	}
+}
+
+// WithBidirectional turns the sync into a two-way one between the
+// source and the target. A state file (".filesync-bidir.json" in the
+// target) records every file after each run, so the next run can tell
+// which side changed: changes on one side are copied to the other, and
+// with deleteMissing a file deleted on one side is deleted on the
+// other. Files changed on both sides are conflicts, settled by the
+// resolver set with WithConflictResolver or otherwise reported in
+// Stats().Conflicts and skipped. Only files are reconciled, and only
+// a single source is supported.
+func WithBidirectional(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.bidirectional = enabled
+	}
+}
+
+// WithConflictResolver sets the callback deciding conflicts in
+// two-way mode, e.g. NewestWins.
+func WithConflictResolver(resolve ConflictResolver) Option {
+	return func(fs *FileSync) {
+		fs.conflictResolver = resolve
+	}
+}
+
+// WithXattrs copies the extended attributes of each file (such as
+// SELinux contexts or macOS Finder tags) onto its copy, on Linux and
+// macOS with local source and target. It costs a few syscalls per
+// file, so it is off by default. Targets on filesystems without xattr
+// support are skipped silently.
+func WithXattrs(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.xattrs = enabled
+	}
+}
+
+// WithACLs copies the POSIX access control lists of files and
+// directories onto their copies, including the default ACLs that
+// directories pass on to new entries, for migrations of shared trees
+// whose permissions go beyond the mode bits. It works on Linux with
+// local source and target, and is applied after the mode, so it wins
+// over WithPreservePerms or WithFileMode for the group bits the ACL
+// mask covers. Files whose access ACLs differ are recopied, and the
+// ACLs of directories are set again on every run. Where the target
+// filesystem has no ACLs or setting them is not permitted, a warning
+// is logged and the rest of the run leaves them out; on other
+// platforms the warning comes with the first copy.
+func WithACLs(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.acls = enabled
+	}
+}
+
+// WithFileCaps copies the Linux file capabilities of executables, such
+// as cap_net_bind_service, onto their copies, so mirrored system
+// binaries keep working. It needs local source and target, and setting
+// capabilities needs root or CAP_SETFCAP: without the privilege, or on
+// filesystems that cannot hold them, a warning is logged and the rest
+// of the run copies files without them. It has no effect on other
+// platforms.
+func WithFileCaps(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.fileCaps = enabled
+	}
+}
+
+// WithAltStreams copies the extra named streams files can carry beside
+// their data onto their copies, and recopies files whose streams
+// differ: resource forks on macOS (APFS and HFS+), and alternate data
+// streams such as Zone.Identifier on Windows (NTFS and ReFS). It needs
+// local source and target and covers files, not directories. Where the
+// target filesystem cannot hold streams, such as FAT, a warning is
+// logged and the rest of the run copies files without them. It has no
+// effect on other platforms. Streams are read into memory whole.
+func WithAltStreams(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.altStreams = enabled
+	}
+}
+
+// WithFileFlags copies the immutable and append-only flags of files
+// onto their copies, and recopies files whose flags differ, for
+// faithful system backups: the chattr +i and +a inode flags on Linux,
+// and the uchg, uappnd, schg and sappnd flags of chflags on macOS and
+// the BSDs. The flags are applied as the last step of each copy, after
+// the data, times and final rename, since an immutable file refuses
+// all of them, and are lifted from a target file before a new version
+// is written over it. It needs local source and target and covers
+// files, not directories; deleting an orphan that carries the flags
+// fails and is reported. Setting the flags needs root, or
+// CAP_LINUX_IMMUTABLE on Linux, except for the user flags on the BSDs:
+// without the privilege, or on filesystems that cannot hold them, a
+// warning is logged and the rest of the run copies files without
+// them. It has no effect on other platforms.
+func WithFileFlags(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.fileFlags = enabled
+	}
+}
+
+// WithLoadThrottle holds back new copies while the 1-minute system
+// load average is above maxLoad, such as the number of CPUs, so a sync
+// in the background makes way for interactive use; on Linux the load
+// includes tasks waiting on I/O. The load is sampled every few
+// seconds, and copies resume once it drops to maxLoad or below; copies
+// in progress and comparisons carry on. Both are logged. It works on
+// Linux and macOS and does nothing where the load cannot be read, or
+// with a maxLoad of zero or less.
+func WithLoadThrottle(maxLoad float64) Option {
+	return func(fs *FileSync) {
+		fs.loadThrottle = nil
+		if maxLoad > 0 {
+			fs.loadThrottle = &loadThrottle{max: maxLoad, load: loadAverage, interval: loadCheckInterval}
+		}
+	}
+}
+
+// WithNestSourceDir syncs the source directory itself rather than its
+// contents: source "photos" lands in target/photos instead of
+// directly in target. It cannot be combined with merged sources.
+func WithNestSourceDir(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.nestSource = enabled
+	}
+}
+
+// WithRsyncSlashes gives a trailing slash on the source the meaning
+// it has for rsync: "src/" syncs the contents of src into the target,
+// while "src" syncs the directory itself, into target/src. Without
+// this option both forms sync the contents. Merged sources (see
+// AddSource) must all be given with a trailing slash.
+func WithRsyncSlashes(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.rsyncSlashes = enabled
+	}
+}
+
+// WithMaxFilesPerRun stops copying once n files have been copied in a
+// run, so a huge tree can be migrated in chunks: files already copied
+// are skipped next time, so each run continues where the last one
+// stopped. Stats reports the cut-off in Truncated and FilesRemaining.
+// Deletions do not count against the limit. Zero (the default) means
+// no limit.
+func WithMaxFilesPerRun(n int) Option {
+	return func(fs *FileSync) {
+		fs.maxFiles = n
+	}
+}
+
+// WithFreeSpaceCheck checks, before each file is copied, that the
+// local target filesystem has room for it plus the reserve set with
+// WithFreeSpaceReserve. Files that do not fit are skipped with an
+// ErrInsufficientSpace error and listed in Stats().NoSpace, unless
+// WithAbortOnLowSpace stops the sync instead.
+func WithFreeSpaceCheck(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.spaceCheck = enabled
+	}
+}
+
+// WithFreeSpaceReserve sets how many bytes the free-space check keeps
+// free on the target (see WithFreeSpaceCheck).
+func WithFreeSpaceReserve(bytes int64) Option {
+	return func(fs *FileSync) {
+		fs.spaceReserve = bytes
+	}
+}
+
+// WithAbortOnLowSpace makes SyncDirs return ErrInsufficientSpace at
+// the first file that does not fit, instead of skipping it and moving
+// on to files that may be smaller.
+func WithAbortOnLowSpace(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.abortOnSpace = enabled
+	}
+}
+
+// WithReflink makes local copies within one filesystem try a
+// copy-on-write reflink first (FICLONE on Linux Btrfs/XFS, clonefile
+// on macOS APFS), which is nearly instant and shares the data blocks
+// until either file is modified. Where reflinks are unsupported, and
+// for transformed files, the data is copied as usual.
+func WithReflink(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.reflink = enabled
+	}
+}
+
+// WithSnapshot turns the target into a set of dated snapshots: each
+// run syncs the full tree into a new directory such as
+// target/2024-06-01T12-00-00, hard-linking files that are unchanged
+// since the most recent earlier snapshot and copying only new or
+// changed ones, like Time Machine. Each snapshot is a complete tree,
+// so delete-missing has nothing to remove. Stats().Snapshot names the
+// new directory. A run that ends without errors marks its snapshot
+// complete with an empty file beside it, such as
+// target/2024-06-01T12-00-00.complete, and only complete snapshots are
+// linked from, so a failed or interrupted one never becomes the base
+// of the next.
+func WithSnapshot(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.snapshot = enabled
+	}
+}
+
+// WithProfile records how long each phase of a sync takes (walk,
+// compare, copy, cleanup) and which file copies were slowest, in
+// Stats().Timings. Without it no clocks are read.
+func WithProfile(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.profile = enabled
+	}
+}
+
+// WithForce retries updates and deletions that fail with a permission
+// error after adding the owner write bit to the read-only target file
+// or directory in the way, like rsync's --force. Without it such
+// entries are logged and skipped.
+func WithForce(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.force = enabled
+	}
+}
+
+// WithOneFileSystem keeps the source walk on the filesystem holding
+// each source root, like rsync -x: directories on another device,
+// such as /proc or network mounts below a backed-up root, are skipped
+// and not synced at all. It relies on Unix device IDs and has no
+// effect elsewhere or for sources whose FS does not report them.
+func WithOneFileSystem(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.oneFileSystem = enabled
+	}
+}
+
+// WithJournal keeps an append-only journal of the files a sync has
+// finished in target/.filesync-journal. If the run is interrupted, the
+// next one skips the journaled files whose source is unchanged instead
+// of comparing (or hashing) them again; the journal is removed once a
+// run completes. It cannot be combined with snapshots or two-way sync.
+func WithJournal(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.journal = enabled
+	}
+}
+
+// WithCheckpoint is WithJournal for very large one-time migrations: the
+// finished files are recorded in the checkpoint file at path (a local
+// file, even when the target is remote; empty for
+// target/.filesync-journal), but buffered and only written and synced
+// to disk periodically, see WithCheckpointEvery, which keeps the
+// overhead of millions of entries low. After a crash, the next run loads the checkpoint and
+// skips the files recorded there whose source is unchanged, redoing
+// at most the files finished since the last flush. The checkpoint is
+// deleted once a run completes.
+func WithCheckpoint(path string) Option {
+	return func(fs *FileSync) {
+		fs.journal, fs.checkpoint, fs.checkpointPath = true, true, path
+	}
+}
+
+// WithCheckpointEvery sets how often WithCheckpoint flushes: after
+// files finished files or once interval has passed since the last
+// flush, whichever comes first, checked as each file finishes. Zero
+// keeps the defaults of 1000 files and 30 seconds.
+func WithCheckpointEvery(files int, interval time.Duration) Option {
+	return func(fs *FileSync) {
+		fs.checkpointFiles, fs.checkpointEvery = files, interval
+	}
+}
+
+// WithStatusServer serves the state of the running sync over HTTP at
+// addr (such as "localhost:8080"): /status returns a Status as JSON,
+// /metrics the Metrics in the Prometheus text format, and /healthz
+// answers "ok". The server runs for the duration of
+// SyncDirs, ApplyPlan or Watch and is shut down when they return.
+func WithStatusServer(addr string) Option {
+	return func(fs *FileSync) {
+		fs.statusAddr = addr
+	}
+}
+
+// WithCaseInsensitiveOrder processes the entries of each directory in
+// case-insensitive order, rather than the default byte order in which
+// "Zebra" sorts before "apple". Either order is deterministic, so logs
+// and planned actions of two runs can be diffed; this one matches
+// what file managers show and is the same on every platform.
+func WithCaseInsensitiveOrder(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.foldCaseOrder = enabled
+	}
+}
+
+// WithSplitSize stores target files larger than size bytes as numbered
+// parts of at most size bytes each, for destinations with a per-file
+// size cap: "video.mkv" becomes "video.mkv.part0001",
+// "video.mkv.part0002" and so on. The parts are compared, replaced and
+// deleted as the one file they make up, so unchanged files are not
+// copied again. When a file shrinks below size it is stored whole
+// again. Split files cannot be resumed or preallocated. WithJoinParts
+// reassembles them.
+func WithSplitSize(size int64) Option {
+	return func(fs *FileSync) {
+		fs.splitSize = size
+	}
+}
+
+// WithJoinParts reads source files stored as parts by WithSplitSize as
+// the whole files they make up, so that they are synced to the target
+// reassembled. Any source files named like "name.part0001" are taken
+// to be such parts.
+func WithJoinParts(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.joinParts = enabled
+	}
+}
+
+// WithSkipLocked skips source files that another process holds locked,
+// such as open databases or logs being written, listing them in
+// Stats().Locked instead of failing to copy them. On Unix a file counts
+// as locked while someone holds a POSIX write lock or an exclusive
+// flock on it; on Windows while it is open for writing or not shared.
+// Watch retries them after 30 seconds. Only local sources are checked;
+// dry runs check them too and leave them out of the plan.
+func WithSkipLocked(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.skipLocked = enabled
+	}
+}
+
+// WithPermissionsFrom gives every file written and directory created
+// in the target the mode and owner of the reference at refPath, a path
+// on the target's filesystem such as the target directory itself. A
+// directory reference gives files its mode without the execute bits
+// (0755 becomes 0644); a file reference gives directories its mode
+// with execute bits wherever it is readable. WithFileMode and
+// WithDirMode take precedence over the reference's modes. Changing the
+// owner usually needs root; if it is not permitted, the default owner
+// is kept and the failure is logged once.
+func WithPermissionsFrom(refPath string) Option {
+	return func(fs *FileSync) {
+		fs.permissionsFrom = refPath
+	}
+}
+
+// WithTreeHash computes, after each successful run, a Merkle-style
+// root over the content and relative path of every file in the target
+// and reports it as Stats.TreeHash. Comparing it with SourceTreeHash,
+// or with the root of another mirror, confirms a complete match in a
+// single value. Every file is hashed, so this costs a full read of the
+// target unless WithChecksumCache can vouch for unchanged files.
+func WithTreeHash(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.treeHash = enabled
+	}
+}
+
+// WithSpecialFiles recreates named pipes and device nodes found in the
+// source (with mkfifo and mknod) instead of skipping them with a
+// warning, which is the default. It needs a local target on Unix, and
+// device nodes usually need root. Sockets are always skipped, and so
+// are all special files in two-way syncs.
+func WithSpecialFiles(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.specialFiles = enabled
+	}
+}
+
+// WithSwap deploys the target atomically, for trees such as a web
+// root that must never be seen half-updated. SyncDirs builds the
+// complete tree in a sibling directory, target.new, hard-linking the
+// files that are unchanged from the current target, and then renames
+// target to target.old and target.new to target and removes
+// target.old. Both renames need target.new and target on the same
+// filesystem. If the staged sync has any error, the current target is
+// left untouched. Files only present in the target do not survive the
+// swap, whatever the delete-missing setting. With WithLock, the lock
+// file is target.lock, next to the target, taken before target.new or
+// target.old is touched. Two-way sync, snapshots, the journal, Watch
+// and ApplyPlan cannot be used with it.
+func WithSwap(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.swap = enabled
+	}
+}
+
+// WithMetricsHook calls fn with the updated Metrics after every run,
+// for pushing them to a metrics library instead of reading them with
+// FileSync.Metrics. It runs on the syncing goroutine.
+func WithMetricsHook(fn func(Metrics)) Option {
+	return func(fs *FileSync) {
+		fs.onMetrics = fn
+	}
+}
+
+// WithBeforeCopy calls fn before each file a one-way sync is about to
+// copy, with the source and target paths and the source's file info,
+// for checks no static filter can express, such as an external policy
+// or a quota. Returning false skips the file, which is listed in
+// Stats.Vetoed. Returning an error records it as a *CopyError and
+// skips the file, or aborts the sync with WithFailOnAccessError. The
+// hook also runs in dry-run mode, so the plan shows what a real run
+// would do. A nil fn, the default, copies everything.
+func WithBeforeCopy(fn func(src, dst string, info os.FileInfo) (proceed bool, err error)) Option {
+	return func(fs *FileSync) {
+		fs.beforeCopy = fn
+	}
+}
+
+// WithTrash moves files removed by delete-missing to the trash instead
+// of deleting them, so they can be restored the usual way: the
+// Freedesktop.org trash on Linux and other Unix desktops, ~/.Trash on
+// macOS and the Recycle Bin on Windows. For remote targets, or when
+// the platform trash cannot take a file (e.g. it lives on another
+// volume), files are moved to a directory per run under
+// target/.filesync-trash instead, keeping their relative paths; the
+// sync leaves that directory alone and clearing it is up to the user.
+func WithTrash(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.trash = enabled
+	}
+}
+
+// WithDeletePolicy lets policy decide the fate of each orphaned file
+// that delete-missing would remove, after the protect list, retention
+// and WithDeleteOlderThan have had their say. It gets the path
+// relative to the target root and the file's info, and returns
+// DeleteOrphan to go ahead, KeepOrphan or ReviewOrphan to leave the
+// file in place, or BackupOrphan to move it to the trash. Kept files
+// are listed in Stats.KeptByPolicy, backed up ones in Stats.BackedUp
+// and ones left for review in Stats.ForReview. Directories are still
+// only removed once empty.
+func WithDeletePolicy(policy func(relPath string, info os.FileInfo) DeleteAction) Option {
+	return func(fs *FileSync) {
+		fs.deletePolicy = policy
+	}
+}
+
+// WithPreserveSymlinks recreates source symlinks in the target as
+// symlinks with the same destination, verbatim, instead of copying the
+// files they point to; a link is recreated whether or not its
+// destination exists. It needs source and target filesystems that
+// support symlinks (local or SFTP); elsewhere links are skipped. By
+// default links are dereferenced, and a broken one is skipped with a
+// warning and listed in Stats.BrokenSymlinks, unless
+// WithFailOnAccessError makes it stop the sync.
+func WithPreserveSymlinks(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.preserveSymlinks = enabled
+	}
+}
+
+// WithDirsOnly recreates the source's directory tree in the target
+// without copying any files, e.g. to scaffold a mirror before filling
+// it some other way. Directories get the mode (unless WithDirMode or
+// WithPermissionsFrom sets one) and mod time of their source, and
+// Stats.DirsCreated counts the new ones. Delete-missing then only
+// removes empty orphaned directories; target files are left alone.
+// It cannot be combined with pruning empty directories or two-way sync.
+func WithDirsOnly(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.dirsOnly = enabled
+	}
+}
+
+// WithParallelWalk lists source and target directories, and stats
+// source files, with up to n goroutines running ahead of the walk.
+// Entries are still handled one by one in the usual order, so results
+// and errors are the same as with a serial walk; only the round trips
+// overlap. The work queued ahead is capped at 256 tasks per goroutine,
+// so a huge tree is not listed into memory at once. This pays off on
+// network filesystems where every stat is slow, not on local disks.
+// Values of one or less walk serially.
+func WithParallelWalk(n int) Option {
+	return func(fs *FileSync) {
+		fs.walkWorkers = n
+	}
+}
+
+// WithParallelPlan makes Diff classify each source's top-level entries
+// on up to n goroutines at once, walking and comparing their subtrees
+// concurrently, so the full scope of a sync on a huge tree is known
+// sooner. The partial results are merged in the order a serial walk
+// visits the entries, so the result is identical and reproducible.
+// A dry run plans in parallel too: the source is listed and the target
+// looked up on at least n goroutines ahead of the scan, which still
+// decides in walk order, so PlannedActions are those of a serial run.
+// It combines with WithParallelWalk, which overlaps the listings
+// within each subtree. Values of one or less plan serially.
+func WithParallelPlan(n int) Option {
+	return func(fs *FileSync) {
+		fs.planWorkers = n
+	}
+}
+
+// WithDiffModes makes Diff report files whose contents match but whose
+// permission bits differ, with ReasonMode, for checks that the
+// target matches the source exactly. Syncs are not affected.
+func WithDiffModes(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.diffModes = enabled
+	}
+}
+
+// WithPreservePerms gives copied files and the target's directories
+// the permission bits of their source, instead of the defaults left
+// by the umask. A mode set with WithFileMode, WithDirMode,
+// WithModeRule or WithPermissionsFrom still wins.
+func WithPreservePerms(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.preservePerms = enabled
+	}
+}
+
+// WithPreserveOwner gives copied files and the target's directories
+// the user and group owning their source, on targets that support it
+// (local or SFTP). Changing ownership usually needs root; if it is not
+// permitted, a warning is logged and the rest of the run keeps the
+// default owner. WithPermissionsFrom takes precedence.
+func WithPreserveOwner(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.preserveOwner = enabled
+	}
+}
+
+// WithArchive turns on everything a faithful mirror needs, like rsync's
+// -a: WithPreserveSymlinks, WithPreservePerms, WithPreserveOwner and
+// WithKeepModTimes (mod times are kept by default; this keeps them in
+// content-only mode too). Directories are always synced recursively.
+// Options given after it override its parts, e.g.
+// WithPreserveOwner(false) for a mirror made without root.
+func WithArchive() Option {
+	return func(fs *FileSync) {
+		fs.preserveSymlinks = true
+		fs.preservePerms = true
+		fs.preserveOwner = true
+		fs.keepModTimes = true
+	}
+}
+
+// WithDedup stores identical files only once in the target: a file
+// whose source content (by checksum, hashed only when another copy of
+// the same size was written) matches a file already copied in this
+// run is hard-linked to that copy instead, counted in
+// Stats.FilesDeduped. Where the target cannot link, the file is copied
+// as usual. Linked files share one mode and mod time, so duplicates
+// whose source mod times differ look changed on later runs unless
+// content is compared (see WithChecksum); they are then linked again
+// rather than copied. Dedup implies atomic copies, so updating one of
+// the linked files replaces it rather than rewriting the others; on
+// Unix, even in-place copies unlink a target file with several names
+// before writing it.
+func WithDedup(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.dedup = enabled
+		if enabled {
+			fs.atomicCopy = true
+		}
+	}
+}
+
+// WithReportFile writes a Markdown report to path after every run, as
+// a self-contained audit record separate from the logs: start and end
+// time, duration, sources and target, the settings that differ from
+// the defaults, the counts of Stats, every file copied, updated and
+// deleted, the files skipped for a reason, the full error list and,
+// with WithTreeHash, the tree hash. The file is written even when the
+// run fails, and replaced atomically. A report that cannot be written
+// makes an otherwise successful run return its error.
+func WithReportFile(path string) Option {
+	return func(fs *FileSync) {
+		fs.reportFile = path
+	}
+}
+
+// WithExcludeOwner skips source files owned by any of the given user
+// ids, such as system accounts in a backup of user data. Like
+// WithModifiedSince, it only narrows what is copied: a skipped file
+// still exists in the source, so delete-missing keeps its target copy.
+// Skipped files are counted in Stats.FilesByOwner. Ownership is read
+// from the Unix stat data, or from SFTP; on other platforms the
+// owner is unknown and nothing is skipped. May be given several times.
+func WithExcludeOwner(uids ...int) Option {
+	return func(fs *FileSync) {
+		for _, uid := range uids {
+			if fs.excludeOwners == nil {
+				fs.excludeOwners = map[int]bool{}
+			}
+			fs.excludeOwners[uid] = true
+		}
+	}
+}
+
+// WithExcludeGroup is WithExcludeOwner for group ids.
+func WithExcludeGroup(gids ...int) Option {
+	return func(fs *FileSync) {
+		for _, gid := range gids {
+			if fs.excludeGroups == nil {
+				fs.excludeGroups = map[int]bool{}
+			}
+			fs.excludeGroups[gid] = true
+		}
+	}
+}
+
+// WithValidate calls fn with the target path of each file a one-way
+// sync has just copied, before the copy counts as done, for checks
+// such as verifying a signature or a malware scan. A returned error
+// fails the file: it is listed in Stats.Invalid and recorded as a
+// *ValidationError, and the target copy is removed again unless
+// WithKeepInvalid is set. The sync goes on with the next file, or
+// stops with WithFailOnAccessError. fn runs in the copy loop, one file
+// at a time, so it needs no locking of its own; it is not called in
+// dry-run mode or for WithDedup links to a file already validated.
+func WithValidate(fn func(dst string) error) Option {
+	return func(fs *FileSync) {
+		fs.validate = fn
+	}
+}
+
+// WithKeepInvalid keeps target copies the WithValidate hook rejects,
+// instead of removing them. They are still reported as failed, and
+// their mod time is set to the Unix epoch to flag them, so the next
+// run copies and validates them again, unless the comparison ignores
+// mod times or finds the content unchanged.
+func WithKeepInvalid(keep bool) Option {
+	return func(fs *FileSync) {
+		fs.keepInvalid = keep
+	}
+}
+
+// WithStripPrefix strips the leading directories prefix (e.g.
+// "project/dist") from the relative paths of every source before they
+// are joined with the target, so the target holds the contents of
+// source/project/dist as if that directory had been synced. Entries
+// outside the prefix are left alone, and the delete pass only sees the
+// stripped tree; with WithRequirePrefix they fail the sync instead.
+// The prefix must be a relative path inside the source; .syncignore
+// files are read from the prefix directory down. An empty prefix, the
+// default, syncs the whole source.
+func WithStripPrefix(prefix string) Option {
+	return func(fs *FileSync) {
+		if prefix != "" {
+			prefix = filepath.Clean(filepath.FromSlash(prefix))
+		}
+		fs.stripPrefix = prefix
+	}
+}
+
+// WithRequirePrefix makes a sync with WithStripPrefix fail with
+// ErrOutsidePrefix, before anything is copied, when a source holds
+// entries other than the prefix (and .syncignore files) on the way
+// down to it, rather than silently leaving them out.
+func WithRequirePrefix(require bool) Option {
+	return func(fs *FileSync) {
+		fs.requirePrefix = require
+	}
+}
+
+// WithFingerprintCmd compares files by a fingerprint an external
+// command prints, such as a perceptual hash of a photo, instead of by
+// size and mod time: a target file whose fingerprint equals its
+// source's is up to date even if the bytes differ, and one whose
+// fingerprint differs is copied. The template is the command line,
+// split on spaces without shell quoting, where {} stands for the file
+// path (appended at the end when missing), e.g. "phash --quiet {}";
+// its trimmed standard output is the fingerprint. Fingerprints are
+// cached by path, size and mod time for the life of the FileSync.
+// When the command fails, prints nothing, runs longer than a minute,
+// or a side is not local, the file is compared as usual. An empty template, the default, disables
+// fingerprints.
+func WithFingerprintCmd(template string) Option {
+	return func(fs *FileSync) {
+		fs.fingerprintCmd = strings.TrimSpace(template)
+		fs.fingerprints = &fingerprintCache{prints: map[string]fingerprintEntry{}}
+	}
+}
+
+// WithDeletePreexistingOnly lets delete-missing remove only target
+// entries that were already there, unchanged, when the run started,
+// for targets other processes write into too. The target is listed up
+// front, at the cost of one extra walk, and an orphan that was not in
+// the listing, or whose size or mod time has changed since, is left
+// alone and listed in Stats.Spared. A race window remains: a file
+// another process rewrites between the moment the delete pass checks
+// it and its removal, or rewrites keeping its size and mod time, is
+// still deleted.
+func WithDeletePreexistingOnly(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.deletePreexistingOnly = enabled
+	}
+}
+
+// WithMmapCompare makes content comparisons check the bytes of both
+// files directly, stopping at the first difference, rather than hash
+// each file in full. That is faster in checksum mode when files differ
+// early or the checksum cache is cold. Local files up to 1 GiB are
+// memory-mapped on Linux and macOS; larger files, remote or in-memory
+// filesystems and other platforms are streamed in chunks instead.
+// Checksums are then neither computed nor cached.
+func WithMmapCompare(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.mmapCompare = enabled
+	}
+}
+
+// WithPathMapper decides where each source file lands in the target,
+// e.g. to shard images into subdirectories by hash prefix or to file
+// photos by date. The mapper gets the file's slash-separated path
+// relative to the source root and its info, and returns the path
+// relative to the target root to copy it to; nil, the default, keeps
+// every file at its own path. Source directories are not mirrored
+// then: a target directory is only created for the files mapped into
+// it. Delete-missing removes whatever no file of the run was mapped
+// to, so the mapping must be deterministic, giving the same result
+// for a file on every run, or files are recopied and their earlier
+// copies deleted. Files skipped by filters keep their mapped copies,
+// and when a source file cannot be read or mapped, no orphan is
+// deleted in that run, as its copy could be anywhere. Two files mapped
+// to one path overwrite each other, and preserved symlinks and special
+// files keep their own paths. A mapper returning a path outside the
+// target is recorded as an error for that file. Diff, two-way sync and
+// delete-missing limited to part of the tree reject a mapper.
+func WithPathMapper(mapper func(relPath string, info os.FileInfo) string) Option {
+	return func(fs *FileSync) {
+		fs.pathMapper = mapper
+	}
+}
+
+// WithManifest keeps a manifest at path, a local JSON file listing
+// every file synced to the target with its size, mod time and, in
+// checksum mode, digest and the algorithm that produced it, updated
+// after each run (dry runs excepted). Entries of files no longer
+// synced are dropped after a run over the whole tree. The manifest is
+// what WithManifestCompare compares against, so runs chain together.
+// Manifests written before the algorithm was recorded still hold
+// SHA-256 digests and are read as such. An empty path, the default,
+// keeps no manifest.
+func WithManifest(path string) Option {
+	return func(fs *FileSync) {
+		fs.manifestPath = path
+	}
+}
+
+// WithManifestCompare decides what to copy by comparing the source
+// against the manifest of WithManifest rather than the target's own
+// file stats, for slow or write-mostly targets such as tape or object
+// archives. A file the manifest lacks, or all of them when there is no
+// manifest yet, is copied; in checksum mode, a file whose entry has no
+// digest is copied too. Target directories, symlinks and special files
+// are still looked at, and delete-missing still walks the target.
+func WithManifestCompare(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.manifestCompare = enabled
+	}
+}
+
+// WithMaxOpenFiles bounds how many source files, each with its target
+// counterpart, are open at once across all workers, for systems with
+// a low limit on open files. Workers wait for a free slot before
+// comparing or copying a file, independent of WithWorkers, so "too
+// many open files" errors are avoided at the cost of concurrency. By
+// default the bound is derived from the process's soft limit, less a
+// reserve for everything else; where that limit is unknown, open
+// files are not bounded. Values below one keep the default.
+func WithMaxOpenFiles(n int) Option {
+	return func(fs *FileSync) {
+		fs.maxOpenFiles = n
+	}
+}
+
+// WithMaxPerDirectory bounds how many files within any one target
+// directory are compared or copied at once, for network shares whose
+// servers serialize the work within a directory and choke when many
+// workers hit the same one. Files in different directories are not
+// held back, so WithWorkers still sets the overall concurrency, and
+// WithMaxOpenFiles still applies on top. Values below one (the
+// default) mean no limit.
+func WithMaxPerDirectory(n int) Option {
+	return func(fs *FileSync) {
+		fs.maxPerDir = n
+	}
+}
+
+// WithEmptyPlaceholders treats zero-byte source files as placeholders
+// that are not ready yet, as some pipelines create them before the
+// data: one is not copied over a target file that has content, so it
+// cannot clobber real data. Such files are logged and listed in
+// Stats.Placeholders; an empty source whose target is missing or empty
+// too is still synced. The default, strict mode, copies empty files
+// faithfully like any other.
+func WithEmptyPlaceholders(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.emptyPlaceholders = enabled
+	}
+}
+
+// WithHashAlgorithm picks the checksum algorithm used wherever file
+// contents are hashed: comparisons, Verify, the checksum cache, the
+// manifest, dedup and the tree hash. The name is one of those
+// HashAlgorithms lists, such as "crc32" for speed or "blake2b" for
+// strength at speed, matched case-insensitively, including any added
+// with RegisterHash. Cached digests by another algorithm are
+// discarded, and manifest entries by another count as differing. An
+// unknown name makes the sync fail before anything is hashed. The
+// default is "sha256".
+//
+// Matching digests are trusted: a file whose digest matches is not
+// copied. crc32 only guards against accidental change, and two of
+// many files may well share a sum; md5 and sha1 can be forged to
+// collide. Use them only for sources that are trusted and small
+// enough. Dedup, which would link a file to a different one sharing
+// its digest, refuses algorithms with digests shorter than 128 bits.
+func WithHashAlgorithm(name string) Option {
+	return func(fs *FileSync) {
+		fs.hashAlgo = strings.ToLower(strings.TrimSpace(name))
+	}
+}
+
+// WithPeriodicVerify balances speed and integrity for recurring syncs
+// such as nightly backups: most runs use the cheap size and mod time
+// check, but every everyN-th run compares the contents of all files,
+// as WithChecksum does, without trusting the checksum cache, so silent
+// corruption is caught and repaired. Successful runs are counted in
+// .filesync-runs.json in the target; a run that fails is not counted,
+// so a failed full check is repeated. Stats.FullCheck tells which kind
+// a run was. Values below one, the default, disable it; snapshots and
+// directory swaps cannot be combined with it.
+func WithPeriodicVerify(everyN int) Option {
+	return func(fs *FileSync) {
+		fs.verifyEvery = everyN
+	}
+}
+
+// WithHeartbeat keeps the log readable on large, mostly unchanged
+// trees: the per-file lines for skipped files, such as those whose
+// target is newer, are left out, and a heartbeat like "Scanned 10000
+// files, 3 changed so far" is logged every everyN files instead, with
+// the totals at the end of the pass. Copies, deletions, warnings and
+// errors are still logged as they happen, unlike with the output
+// silenced altogether. Values below one, the default, disable it.
+func WithHeartbeat(everyN int) Option {
+	return func(fs *FileSync) {
+		fs.heartbeatEvery = everyN
+	}
+}
+
+// WithDeleteFirst runs the delete-missing pass before the copy pass
+// instead of after it, for mirrors whose target is too full to take
+// the new files before the orphans are gone: space is reclaimed
+// first, so a run whose net change frees space does not stop on a
+// full disk. The default order, copy then delete, is the safer one:
+// a copy pass that fails stops the run before anything is deleted,
+// whereas with this option orphans are already gone by then, and the
+// target may hold neither the old nor the new version of a renamed
+// file until the next run. It has no effect without delete-missing.
+func WithDeleteFirst(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.deleteFirst = enabled
+	}
+}
+
+// WithDeleteFirstPerDir deletes the orphans of each target directory
+// right before the first file is copied into it, for incremental
+// updates on a target with little room to spare: the space a directory
+// frees is reclaimed before that directory grows, so the transient
+// footprint stays bounded directory by directory, without deleting
+// every orphan up front as WithDeleteFirst does. With atomic copies the
+// old version of each replaced file is removed right before its new
+// version is written too, as the two would otherwise take up space side
+// by side until the final rename; that gives up keeping the old version
+// should the copy fail. Only orphans and files about to be replaced are
+// deleted, with the checks of the delete pass, which still runs after
+// the copies for the directories no copy went into. A directory's
+// orphans are gone even if its copies then fail. It has no effect
+// without delete-missing, with WithDeleteFirst or in dry runs.
+func WithDeleteFirstPerDir(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.deleteFirstPerDir = enabled
+	}
+}
+
+// WithCAS turns the target into a content-addressable store, as build
+// caches use: the contents of each source file are stored once, as
+// target/objects/<digest> by the WithHashAlgorithm algorithm, and
+// target/index.json maps every relative path to its digest. An object
+// already present is not written again, so identical files across the
+// whole tree, or across runs, share one. Files whose size and mod time
+// match the index are not hashed again, unless WithChecksum is on.
+// With delete-missing, objects no path refers to any more are removed.
+// The store is synced from a single source directory as a whole, and
+// restoring a tree from it is not part of this mode.
+func WithCAS(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.cas = enabled
+	}
+}
+
+// WithFollowSymlinks descends into source symlinks to directories,
+// syncing what they point to as directories below the link's path;
+// by default only links to files are followed. The resolved real
+// paths are tracked during the walk, so a link pointing back to a
+// directory it is reached from is skipped with a warning and listed
+// in Stats.SymlinkCycles instead of looping forever. Only local
+// sources are followed, and WithPreserveSymlinks takes precedence.
+func WithFollowSymlinks(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.followSymlinks = enabled
+	}
+}
+
+// WithFollowTargetSymlinks writes copies through symlinks found in
+// the target where files belong, overwriting whatever they point to,
+// as earlier versions did. By default such a link is replaced with a
+// regular file instead, so a link planted in the target cannot have a
+// sync write outside it. Symlinked directories along the path are not
+// affected either way.
+func WithFollowTargetSymlinks(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.followTargetLinks = enabled
+	}
+}
+
+// WithPreserveBirthTime gives each copy the creation (birth) time of
+// its source as well as the mod time, for archives that must keep it,
+// with local source and target. It is supported on macOS and Windows;
+// Linux filesystems record birth times but offer no way to set them,
+// so there, and on filesystems that keep no creation time, it is
+// skipped silently. Off by default.
+func WithPreserveBirthTime(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.preserveBirthTime = enabled
+	}
+}
+
+// WithRateLimit caps the bytes copied per second, across all copies,
+// so a sync leaves bandwidth for others. Zero, the default, is
+// unlimited. WithRateSchedule varies the cap by time of day.
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(fs *FileSync) {
+		fs.rateLimit = bytesPerSecond
+	}
+}
+
+// WithRateSchedule varies the rate limit by time of day, e.g. 1 MB/s
+// during business hours and unlimited overnight: at any moment, the
+// limit of the first window containing the local time applies, and
+// outside all windows that of WithRateLimit, or none. The schedule is
+// consulted again every second while data is copied, so a long run
+// changes pace as it crosses from one window into the next.
+func WithRateSchedule(windows []RateWindow) Option {
+	return func(fs *FileSync) {
+		fs.rateSchedule = windows
+	}
+}
+
+// WithDetectRenames moves files that were renamed or moved in the
+// source to their new path in the target, instead of copying them
+// again and deleting the old copy: a new source file takes the place
+// of an orphaned target file with the same size and checksum. It costs
+// a walk of the target to index the orphans, and reading the new
+// files and the orphans of matching sizes, so it is off by default.
+// Orphans are only used when delete-missing would remove them right
+// away, so it has no effect without delete-missing, or with a delete
+// retention or WithDeletePreexistingOnly. Renames are counted in
+// Stats.FilesRenamed.
+func WithDetectRenames(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.detectRenames = enabled
+	}
+}
+
+// WithStreaming makes the delete pass read target directories a batch
+// of entries at a time and act on each batch before reading the next,
+// instead of listing and sorting every directory in full first. Memory
+// use then stays flat on huge flat directories, at the cost of the
+// deterministic order: entries are visited in the order the
+// filesystem returns them. The source listings that decide what is an
+// orphan are still held in memory.
+func WithStreaming(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.streaming = enabled
+	}
+}
+
+// WithMaxErrors stops the sync once n per-file errors have been
+// collected, since that many usually means something systemic, like a
+// failing disk or a wrong mount, rather than a few bad files. The run
+// then returns ErrTooManyErrors joined with the errors so far, before
+// any further files are copied or deleted. Zero or negative (the
+// default) means no limit: every entry is tried.
+func WithMaxErrors(n int) Option {
+	return func(fs *FileSync) {
+		fs.maxErrors = n
+	}
+}
+
+// WithQuickHash compares files of the same size by a quick hash
+// instead of their mod times: a digest of the size and the first and
+// last n KiB, so a large file costs 2n KiB of reading on each side
+// rather than all of it, and smaller files are hashed in full. It
+// catches most real changes to large media files, but it is
+// probabilistic: an edit confined to the middle of a file that keeps
+// its size goes unnoticed. Use WithChecksum for data where that
+// matters; full checksums take precedence over quick hashes. Zero
+// (the default) turns it off.
+func WithQuickHash(n int) Option {
+	return func(fs *FileSync) {
+		fs.quickHash = n
+	}
+}
+
+// WithCopyOrder sets the order of the copy pass: SmallestFirst clears
+// the bulk of the file count quickly, LargestFirst starts the longest
+// transfers early, NewestFirst copies the most recently modified files
+// first, and Natural (the default) keeps walk order. All files to copy
+// are known once the walk and comparisons are done, so sorting them
+// costs no extra reads and little memory; ties keep their walk order.
+// Directory creation and the delete pass are not affected.
+func WithCopyOrder(order CopyOrder) Option {
+	return func(fs *FileSync) {
+		fs.copyOrder = order
+	}
+}
+
+// WithTargetSizeCap bounds the total size of the files in the target
+// to maxBytes, turning it into a cache: once a copy would take the
+// target past the cap, the file is skipped and listed in
+// Stats().OverCap, which is no error. Files are then copied newest
+// first, unless WithCopyOrder sets another order, so the most recent
+// ones get the room. The target's size is measured once per run, by
+// walking it; zero or less means no cap. See WithEviction to make room
+// instead of skipping.
+func WithTargetSizeCap(maxBytes int64) Option {
+	return func(fs *FileSync) {
+		fs.sizeCap = maxBytes
+	}
+}
+
+// WithEviction lets WithTargetSizeCap make room for a file that does
+// not fit by deleting least recently used target files: those with the
+// oldest access time (the mod time where the filesystem keeps none, or
+// is mounted noatime), oldest first, until the file fits. Only files
+// with no counterpart in the run's source are evicted, never the
+// protected ones (see AddProtect), the trash or the sync's own state
+// files, and nothing is evicted for a file that would not fit even
+// then. Evictions are deletes in PlannedActions and are listed in
+// Stats().Evicted; a dry run only reports them.
+func WithEviction(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.evict = enabled
+	}
+}
+
+// WithHashProgress registers a callback that receives progress while a
+// file is hashed, for checksum comparisons, Verify, manifests and
+// other content-based features: periodically during files that take
+// longer than a moment, and once when such a file is done, so hashing
+// a multi-gigabyte file does not look like a hang. Hashing runs on the
+// worker pool, so the callback may be called from several goroutines
+// at once and should return quickly.
+func WithHashProgress(fn func(HashProgress)) Option {
+	return func(fs *FileSync) {
+		fs.onHash = fn
+	}
+}
+
+// WithSourceDropGuard guards delete-missing against a source that did
+// not mount and looks (nearly) empty: each run over the whole tree
+// records its number of source files in a small state file in the
+// target, and when a run finds fewer than fraction of the last count,
+// such as 0.5 for half, it still copies but skips the delete pass,
+// warns, and fails with an error wrapping ErrSourceDropped. The count
+// is only updated by runs that pass the check, or with
+// WithForceDelete. Zero (the default) turns the guard off.
+func WithSourceDropGuard(fraction float64) Option {
+	return func(fs *FileSync) {
+		fs.dropGuard = fraction
+	}
+}
+
+// WithForceDelete runs the delete pass even when WithSourceDropGuard
+// finds the source count dropped, for drops that are intended, and
+// records the new count.
+func WithForceDelete(enabled bool) Option {
+	return func(fs *FileSync) {
+		fs.forceDelete = enabled
+	}
+}
+
+// WithWatchCycle calls fn after every sync Watch runs, the initial one
+// included, with the paths it covered and its Stats. It runs on the
+// watching goroutine, so events queue up until it returns.
+func WithWatchCycle(fn func(WatchCycle)) Option {
+	return func(fs *FileSync) {
+		fs.onWatchCycle = fn
+	}
+}
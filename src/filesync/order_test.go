@@ -0,0 +1,88 @@
+package filesync
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// actionPaths returns the kinds and paths of actions, in order.
+func actionPaths(actions []Action) []string {
+	var out []string
+	for _, a := range actions {
+		out = append(out, fmt.Sprintf("%s %s", a.Kind, filepath.ToSlash(a.Path)))
+	}
+	return out
+}
+
+func TestFileSync_DeterministicOrder(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	for _, name := range []string{"b.txt", "A.txt", "a2.txt", "C.txt", "sub/z.txt", "Sub2/y.txt"} {
+		writeTestFile(t, filepath.Join(src, name), name, now)
+	}
+	for _, name := range []string{"old-b", "OLD-a", "old-c"} {
+		writeTestFile(t, filepath.Join(dst, name), name, now)
+	}
+
+	add := func(paths ...string) []string {
+		var out []string
+		for _, p := range paths {
+			out = append(out, fmt.Sprintf("%s %s", ActionAdd, p))
+		}
+		return out
+	}
+	del := func(paths ...string) []string {
+		var out []string
+		for _, p := range paths {
+			out = append(out, fmt.Sprintf("%s %s", ActionDelete, p))
+		}
+		return out
+	}
+	// Directories are created during the walk, files copied after
+	// it, each in walk order; orphans are deleted last
+	tests := []struct {
+		name     string
+		foldCase bool
+		want     []string
+	}{
+		{"byte order", false, append(add("Sub2", "sub", "A.txt", "C.txt", "Sub2/y.txt", "a2.txt", "b.txt", "sub/z.txt"), del("OLD-a", "old-b", "old-c")...)},
+		{"case-insensitive", true, append(add("sub", "Sub2", "A.txt", "a2.txt", "b.txt", "C.txt", "sub/z.txt", "Sub2/y.txt"), del("OLD-a", "old-b", "old-c")...)},
+	}
+	for _, tc := range tests {
+		// The local walk and the generic one used for other
+		// filesystems must agree, and repeated runs must too
+		for _, fsys := range []FS{LocalFS(), strictFS{LocalFS()}} {
+			for run := 0; run < 2; run++ {
+				fs := NewFileSync(src, dst, true, WithDryRun(true), WithCaseInsensitiveOrder(tc.foldCase),
+					WithSourceFS(fsys), WithTargetFS(fsys))
+				if err := fs.SyncDirs(); err != nil {
+					t.Fatal(err)
+				}
+				if got := actionPaths(fs.PlannedActions()); !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("%s (%T, run %d):\n got %v\nwant %v", tc.name, fsys, run, got, tc.want)
+				}
+			}
+		}
+	}
+}
+
+func TestFoldedLess(t *testing.T) {
+	names := []string{"b", "B", "a", "A", "ab", "Aa"}
+	want := []string{"A", "a", "Aa", "ab", "B", "b"}
+	sorted := append([]string(nil), names...)
+	for i := range sorted {
+		for j := i + 1; j < len(sorted); j++ {
+			if foldedLess(sorted[j], sorted[i]) {
+				sorted[i], sorted[j] = sorted[j], sorted[i]
+			}
+		}
+	}
+	if !reflect.DeepEqual(sorted, want) {
+		t.Errorf("sorted = %v, want %v", sorted, want)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package filesync
+
+import "os"
+
+// sysOwner is unknown without Unix stat data, so ownership is left
+// alone.
+func sysOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package filesync
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysOwner returns the owner of a local file from its Unix stat data.
+func sysOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
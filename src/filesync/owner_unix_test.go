@@ -0,0 +1,53 @@
+//go:build unix
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_ExcludeOwner(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	for _, tc := range []struct {
+		name    string
+		opt     Option
+		skipped bool
+	}{
+		{"own uid", WithExcludeOwner(os.Getuid()), true},
+		{"own gid", WithExcludeGroup(os.Getgid()), true},
+		{"other uid", WithExcludeOwner(os.Getuid() + 1), false},
+		{"other gid", WithExcludeGroup(os.Getgid() + 1), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			writeTestFile(t, filepath.Join(src, "new.txt"), "new", old)
+			writeTestFile(t, filepath.Join(src, "kept.txt"), "source", old.Add(time.Minute))
+			writeTestFile(t, filepath.Join(dst, "kept.txt"), "target", old)
+
+			fs := NewFileSync(src, dst, true, tc.opt)
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatalf("SyncDirs() = %v", err)
+			}
+			_, err := os.Stat(filepath.Join(dst, "new.txt"))
+			if copied := err == nil; copied == tc.skipped {
+				t.Errorf("new.txt copied = %v, want %v", copied, !tc.skipped)
+			}
+			// A skipped file is neither updated nor deleted
+			want := "source"
+			if tc.skipped {
+				want = "target"
+			}
+			if got := readTestFile(t, filepath.Join(dst, "kept.txt")); got != want {
+				t.Errorf("kept.txt = %q, want %q", got, want)
+			}
+			if n, want := fs.Stats().FilesByOwner, map[bool]int{true: 2, false: 0}[tc.skipped]; n != want {
+				t.Errorf("FilesByOwner = %d, want %d", n, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package filesync
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ErrMappedOutside reports a path mapper result that is absolute or
+// climbs out of the target root.
+var ErrMappedOutside = errors.New("mapped path is outside the target")
+
+// mapTarget passes a source file to the path mapper (see
+// WithPathMapper) and returns its target-relative and target path.
+// The result is claimed so delete-missing keeps it and its parent
+// directories. ok is false, with the error recorded, when the mapper
+// returns a path outside the target.
+func (fs *FileSync) mapTarget(relPath, srcPath string, info os.FileInfo) (mapped, targetPath string, ok bool) {
+	mapped = filepath.Clean(filepath.FromSlash(fs.pathMapper(filepath.ToSlash(relPath), info)))
+	if !filepath.IsLocal(mapped) {
+		log.Printf("❌ Path mapper sent %q outside the target: %q", srcPath, mapped)
+		fs.recordError(&CopyError{Src: srcPath, Dst: mapped, Err: ErrMappedOutside})
+		fs.unmapped = true
+		return "", "", false
+	}
+	fs.claimPath(mapped)
+	return mapped, filepath.Join(fs.target, mapped), true
+}
+
+// claimPath marks the target-relative relPath and its parent
+// directories as synced from the source in this run, when a path
+// mapper is set.
+func (fs *FileSync) claimPath(relPath string) {
+	if fs.pathMapper == nil {
+		return
+	}
+	for p := relPath; p != "." && !fs.mapped[p]; p = filepath.Dir(p) {
+		fs.mapped[p] = true
+	}
+}
+
+// keepMapped claims the path the mapper gives the source file at
+// relPath when this run skips it, so delete-missing keeps the copy an
+// earlier run made. A file that cannot be mapped, with no info or
+// with a path outside the target, marks the run as unmapped: where
+// its copy is is then unknown, and no orphan is deleted.
+func (fs *FileSync) keepMapped(relPath string, info os.FileInfo) {
+	if fs.pathMapper == nil {
+		return
+	}
+	if info == nil {
+		fs.unmapped = true
+		return
+	}
+	if !info.Mode().IsRegular() && (fs.preserveSymlinks && info.Mode()&os.ModeSymlink != 0 || isSpecial(info.Mode())) {
+		// Preserved links and special files keep their own paths
+		fs.claimPath(relPath)
+		return
+	}
+	mapped := filepath.Clean(filepath.FromSlash(fs.pathMapper(filepath.ToSlash(relPath), info)))
+	if !filepath.IsLocal(mapped) {
+		fs.unmapped = true
+		return
+	}
+	fs.claimPath(mapped)
+}
+
+// keepSkipped is keepMapped for the source entry at path, skipped by
+// a filter or as a mount point, and for every file below it when it
+// is a directory.
+func (fs *FileSync) keepSkipped(tree sourceTree, path string) {
+	if fs.pathMapper == nil {
+		return
+	}
+	err := fs.walk(tree.fsys, path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			fs.unmapped = true
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		relPath, _ := filepath.Rel(tree.root, p)
+		info, err := tree.fsys.Lstat(p)
+		if err == nil && info.Mode()&os.ModeSymlink != 0 && !fs.preserveSymlinks {
+			if info, err = tree.fsys.Stat(p); os.IsNotExist(err) {
+				// A broken link is never copied
+				return nil
+			}
+		}
+		if err != nil {
+			info = nil
+		}
+		fs.keepMapped(relPath, info)
+		return nil
+	})
+	if err != nil {
+		fs.unmapped = true
+	}
+}
+
+// orphaned reports whether the target entry at relPath has no source
+// counterpart: with a path mapper, no file of this run was mapped to
+// it or into it, otherwise no source holds it. An error means that a
+// source could not be stat'ed, so it is unknown (see sourceAbsent).
+func (fs *FileSync) orphaned(trees []sourceTree, relPath string) (bool, error) {
+	if fs.pathMapper != nil {
+		return relPath != "." && !fs.mapped[relPath], nil
+	}
+	return sourceAbsent(trees, relPath)
+}
@@ -0,0 +1,134 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_PathMapper(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "apple.txt"), "apple", old)
+	writeTestFile(t, filepath.Join(src, "sub", "banana.txt"), "banana", old)
+	writeTestFile(t, filepath.Join(dst, "a", "apple.txt"), "stale", old.Add(-time.Hour))
+	writeTestFile(t, filepath.Join(dst, "old.txt"), "orphan", old)
+
+	// Shard by the first letter of the file name
+	shard := func(relPath string, info os.FileInfo) string {
+		name := path.Base(relPath)
+		return name[:1] + "/" + name
+	}
+	fs := NewFileSync(src, dst, true, WithPathMapper(shard))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "a", "apple.txt")); got != "apple" {
+		t.Errorf("a/apple.txt = %q", got)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "b", "banana.txt")); got != "banana" {
+		t.Errorf("b/banana.txt = %q", got)
+	}
+	for _, name := range []string{"old.txt", "sub"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be in the target: %v", name, err)
+		}
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 2 || stats.FilesDeleted != 1 {
+		t.Errorf("copied %d and deleted %d file(s), want 2 and 1", stats.FilesCopied, stats.FilesDeleted)
+	}
+
+	// Mapped copies are neither recopied nor taken for orphans
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 0 || stats.FilesDeleted != 0 {
+		t.Errorf("second run copied %d and deleted %d file(s), want none", stats.FilesCopied, stats.FilesDeleted)
+	}
+}
+
+func TestFileSync_PathMapperOutsideTarget(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", old)
+	writeTestFile(t, filepath.Join(src, "escape.txt"), "x", old)
+
+	fs := NewFileSync(src, dst, false, WithPathMapper(func(relPath string, info os.FileInfo) string {
+		if relPath == "escape.txt" {
+			return "../escape.txt"
+		}
+		return relPath
+	}))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	errs := fs.Stats().Errors
+	if len(errs) != 1 || !errors.Is(errs[0], ErrMappedOutside) {
+		t.Errorf("Errors = %v, want one ErrMappedOutside", errs)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the target: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "a.txt")); got != "a" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if _, err := fs.Diff(t.Context()); err == nil {
+		t.Error("Diff with a path mapper should fail")
+	}
+}
+
+func TestFileSync_PathMapperKeepsSkipped(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "apple.txt"), "apple", old)
+	writeTestFile(t, filepath.Join(src, "sub", "banana.txt"), "banana", old)
+	writeTestFile(t, filepath.Join(src, "cherry.txt"), "cherry", old.Add(-time.Hour))
+	shard := func(relPath string, info os.FileInfo) string {
+		name := path.Base(relPath)
+		return name[:1] + "/" + name
+	}
+	if err := NewFileSync(src, dst, true, WithPathMapper(shard)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copies of files filtered out of a later run stay in the target
+	fs := NewFileSync(src, dst, true, WithPathMapper(shard), WithExcludes("sub"), WithModifiedSince(old.Add(-time.Minute)))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a/apple.txt", "b/banana.txt", "c/cherry.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if stats := fs.Stats(); stats.FilesDeleted != 0 {
+		t.Errorf("deleted %d file(s), want none", stats.FilesDeleted)
+	}
+
+	// A file that cannot be mapped may have its copy anywhere, so no
+	// orphan is deleted
+	writeTestFile(t, filepath.Join(dst, "o", "orphan.txt"), "orphan", old)
+	fs = NewFileSync(src, dst, true, WithPathMapper(func(relPath string, info os.FileInfo) string {
+		if relPath == "apple.txt" {
+			return "../apple.txt"
+		}
+		return shard(relPath, info)
+	}))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a/apple.txt", "o/orphan.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package filesync
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// pauseGate is the switch behind Pause and Resume. While paused,
+// resume is an open channel that Resume closes.
+type pauseGate struct {
+	mu     sync.Mutex
+	resume chan struct{}
+}
+
+// Pause stops the sync from starting new copies until Resume is
+// called; copies in progress finish first. It is meant for an operator
+// easing the I/O load of a long sync without stopping it, and may be
+// called from any goroutine, also while no sync is running, in which
+// case the next one waits before its first copy. The status server
+// offers it as POST /pause. Pausing an already paused sync does
+// nothing.
+func (fs *FileSync) Pause() {
+	fs.pause.mu.Lock()
+	defer fs.pause.mu.Unlock()
+	if fs.pause.resume == nil {
+		fs.pause.resume = make(chan struct{})
+		log.Printf("⏸️ Paused, no new copies until resumed")
+	}
+}
+
+// Resume lets a sync paused with Pause go on with its copies (POST
+// /resume on the status server). Resuming a sync that is not paused
+// does nothing.
+func (fs *FileSync) Resume() {
+	fs.pause.mu.Lock()
+	defer fs.pause.mu.Unlock()
+	if fs.pause.resume != nil {
+		close(fs.pause.resume)
+		fs.pause.resume = nil
+		log.Printf("▶️ Resumed")
+	}
+}
+
+// Paused reports whether the sync is paused.
+func (fs *FileSync) Paused() bool {
+	fs.pause.mu.Lock()
+	defer fs.pause.mu.Unlock()
+	return fs.pause.resume != nil
+}
+
+// waitIfPaused blocks while the sync is paused. When the context of
+// Watch, SyncEvery or SyncDirsContext ends first, its error is returned so the paused
+// run is abandoned rather than left waiting forever.
+func (fs *FileSync) waitIfPaused() error {
+	fs.pause.mu.Lock()
+	resume := fs.pause.resume
+	fs.pause.mu.Unlock()
+	if resume == nil {
+		return nil
+	}
+	ctx := fs.runCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
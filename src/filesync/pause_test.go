@@ -0,0 +1,91 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileSync_PauseResume(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for _, name := range []string{"/src/a.txt", "/src/b.txt", "/src/c.txt"} {
+		if err := mem.WriteFile(name, []byte(name), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copied := make(chan string, 3)
+	var fs *FileSync
+	fs = NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithWorkers(1),
+		WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+			copied <- src
+			if src == "/src/a.txt" {
+				fs.Pause()
+			}
+			return true, nil
+		}))
+
+	done := make(chan error, 1)
+	go func() { done <- fs.SyncDirs() }()
+	if got := <-copied; got != "/src/a.txt" {
+		t.Fatalf("first copy = %s", got)
+	}
+	select {
+	case src := <-copied:
+		t.Fatalf("%s was copied while paused", src)
+	case err := <-done:
+		t.Fatalf("SyncDirs() returned while paused: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !fs.Paused() {
+		t.Error("Paused() = false while paused")
+	}
+	fs.Resume()
+	if err := <-done; err != nil {
+		t.Fatalf("SyncDirs() = %v", err)
+	}
+	if n := fs.Stats().FilesCopied; n != 3 {
+		t.Errorf("FilesCopied = %d, want 3", n)
+	}
+	fs.Resume() // not paused, nothing to do
+}
+
+func TestFileSync_PausedRunCancelled(t *testing.T) {
+	mem := NewMemFS()
+	if err := mem.WriteFile("/src/a.txt", []byte("a"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem))
+	fs.Pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	fs.runCtx = ctx
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := fs.SyncDirs(); !errors.Is(err, context.Canceled) {
+		t.Errorf("SyncDirs() = %v, want context.Canceled", err)
+	}
+	if _, err := mem.ReadFile("/dst/a.txt"); err == nil {
+		t.Error("a.txt was copied while paused")
+	}
+}
+
+func TestStatusHandler_PauseResume(t *testing.T) {
+	fs := NewFileSync(t.TempDir(), t.TempDir(), false)
+	handler := fs.statusHandler(&statusBoard{})
+	for _, tc := range []struct {
+		path   string
+		paused bool
+	}{{"/pause", true}, {"/resume", false}} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", tc.path, nil))
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("POST %s = %d, want 204", tc.path, rec.Code)
+		}
+		if fs.Paused() != tc.paused {
+			t.Errorf("after POST %s, Paused() = %v", tc.path, fs.Paused())
+		}
+	}
+}
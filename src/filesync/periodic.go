@@ -0,0 +1,71 @@
+package filesync
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// runCountName is the file in the target counting runs for
+// WithPeriodicVerify.
+const runCountName = ".filesync-runs.json"
+
+// runCount is the state kept in runCountName.
+type runCount struct {
+	Runs int `json:"runs"` // successful runs so far
+}
+
+// runCountFile returns the path of the run counter.
+func (fs *FileSync) runCountFile() string {
+	return filepath.Join(fs.target, runCountName)
+}
+
+// beginPeriodicVerify decides whether this run is a full check (see
+// WithPeriodicVerify): every verifyEvery-th run compares contents,
+// without trusting the checksum cache. It returns the function that
+// ends the run, restoring the comparator and, unless the run failed,
+// counting it.
+func (fs *FileSync) beginPeriodicVerify() (func(runErr error) error, error) {
+	fs.fullCheck = false
+	if fs.verifyEvery <= 0 {
+		return func(error) error { return nil }, nil
+	}
+	var state runCount
+	data, err := readFile(fs.tgtFS, fs.runCountFile())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, err
+		}
+	}
+
+	checksum := fs.checksum
+	if (state.Runs+1)%fs.verifyEvery == 0 {
+		log.Printf("🔍 Run %d compares contents in full", state.Runs+1)
+		fs.fullCheck, fs.checksum, fs.checksums = true, true, nil
+	}
+	return func(runErr error) error {
+		fs.checksum = checksum
+		if runErr != nil || fs.dryRun {
+			// A failed full check is repeated next time
+			return nil
+		}
+		state.Runs++
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		path := fs.runCountFile()
+		if err := fs.tgtFS.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		tmp := path + ".tmp"
+		if err := writeFile(fs.tgtFS, tmp, data); err != nil {
+			return err
+		}
+		return fs.tgtFS.Rename(tmp, path)
+	}, nil
+}
@@ -0,0 +1,64 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_PeriodicVerify(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "good", mtime)
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "good", mtime)
+
+	fs := NewFileSync(src, dst, true, WithPeriodicVerify(3), WithChecksumCache(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Stats().FullCheck {
+		t.Error("run 1 was a full check")
+	}
+
+	// Silent corruption keeps size and mod time: only a full check
+	// finds it
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "b0rk", mtime)
+	for run := 2; run <= 3; run++ {
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		stats := fs.Stats()
+		if full := run == 3; stats.FullCheck != full {
+			t.Errorf("run %d: FullCheck = %v, want %v", run, stats.FullCheck, full)
+		}
+		want := 0
+		if run == 3 {
+			want = 1
+		}
+		if stats.FilesCopied != want {
+			t.Errorf("run %d: FilesCopied = %d, want %d", run, stats.FilesCopied, want)
+		}
+	}
+	if got := readTestFile(t, filepath.Join(dst, "a.txt")); got != "good" {
+		t.Errorf("a.txt = %q after the full check", got)
+	}
+	// The counter survives delete-missing and is not a target file
+	if _, err := os.Stat(filepath.Join(dst, runCountName)); err != nil {
+		t.Errorf("run counter: %v", err)
+	}
+	if fs.checksum {
+		t.Error("the full check left checksum mode on")
+	}
+
+	// A fresh FileSync picks up the count: run 4 is cheap
+	fs = NewFileSync(src, dst, true, WithPeriodicVerify(3))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Stats().FullCheck {
+		t.Error("run 4 was a full check")
+	}
+}
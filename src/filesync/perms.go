@@ -0,0 +1,131 @@
+package filesync
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// chowner is implemented by filesystems that can change file ownership.
+type chowner interface {
+	Chown(name string, uid, gid int) error
+}
+
+// refPerms are the modes and ownership taken from the reference file
+// of WithPermissionsFrom for the current run.
+type refPerms struct {
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	uid, gid int
+	owned    bool // uid and gid are known and can still be applied
+}
+
+// loadPermissionsRef reads the reference of WithPermissionsFrom from
+// the target filesystem. A directory gives its mode to directories
+// and, without the execute bits, to files; a file gives its mode to
+// files and, with execute bits wherever it is readable, to
+// directories.
+func (fs *FileSync) loadPermissionsRef() error {
+	fs.refPerms = nil
+	fs.ownerDenied = false
+	if fs.permissionsFrom == "" {
+		return nil
+	}
+	info, err := fs.tgtFS.Stat(fs.permissionsFrom)
+	if err != nil {
+		return fmt.Errorf("permissions reference: %w", err)
+	}
+	perm := info.Mode().Perm()
+	ref := &refPerms{fileMode: perm, dirMode: perm | (perm&0444)>>2}
+	if info.IsDir() {
+		ref.fileMode, ref.dirMode = perm&^0111, perm
+	}
+	_, canChown := fs.tgtFS.(chowner)
+	if uid, gid, ok := fileOwner(info); ok && canChown {
+		ref.uid, ref.gid, ref.owned = uid, gid, true
+	}
+	fs.refPerms = ref
+	return nil
+}
+
+// modeRule is a WithModeRule pattern and the mode for matching files.
+type modeRule struct {
+	pattern string
+	mode    os.FileMode
+}
+
+// matches reports whether the slash-separated relative path rel
+// matches the rule: by base name, or by the whole path for a pattern
+// with a slash, as in .syncignore files.
+func (r modeRule) matches(rel string) bool {
+	name := path.Base(rel)
+	if strings.Contains(r.pattern, "/") {
+		name = rel
+	}
+	ok, _ := path.Match(strings.TrimPrefix(r.pattern, "/"), name)
+	return ok
+}
+
+// targetFileMode returns the mode for the target file dst, or zero to
+// keep the default. The last matching WithModeRule wins over
+// WithFileMode, which wins over the reference.
+func (fs *FileSync) targetFileMode(dst string) os.FileMode {
+	mode := fs.fileMode
+	if mode == 0 && fs.refPerms != nil {
+		mode = fs.refPerms.fileMode
+	}
+	if len(fs.modeRules) > 0 {
+		relPath, _ := filepath.Rel(fs.target, dst)
+		rel := filepath.ToSlash(relPath)
+		for _, r := range fs.modeRules {
+			if r.matches(rel) {
+				mode = r.mode
+			}
+		}
+	}
+	return mode
+}
+
+// targetDirMode is targetFileMode for directories created in the target.
+func (fs *FileSync) targetDirMode() os.FileMode {
+	if fs.dirMode == 0 && fs.refPerms != nil {
+		return fs.refPerms.dirMode
+	}
+	return fs.dirMode
+}
+
+// chownTargets reports whether written entries get the reference owner.
+func (fs *FileSync) chownTargets() bool {
+	return fs.refPerms != nil && fs.refPerms.owned
+}
+
+// applyOwner gives path on fsys the reference owner. Changing
+// ownership usually needs privileges, so the first failure is logged
+// and the rest of the run keeps the default owner.
+func (fs *FileSync) applyOwner(fsys FS, path string) {
+	if !fs.chownTargets() {
+		return
+	}
+	c, ok := fsys.(chowner)
+	if !ok {
+		return
+	}
+	if err := c.Chown(path, fs.refPerms.uid, fs.refPerms.gid); err != nil {
+		log.Printf("⚠️ Cannot change ownership, keeping the default owner: %v", err)
+		fs.refPerms.owned = false
+	}
+}
+
+// fileOwner returns the user and group owning the file info describes,
+// if the filesystem reports them.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	if st, isSFTP := info.Sys().(*sftp.FileStat); isSFTP {
+		return int(st.UID), int(st.GID), true
+	}
+	return sysOwner(info)
+}
@@ -0,0 +1,151 @@
+//go:build unix
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileSync_PermissionsFrom(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	ref := filepath.Join(tmp, "ref")
+	writeTestFile(t, filepath.Join(src, "sub", "a.txt"), "a", time.Now())
+	if err := os.Mkdir(ref, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(ref, 0750); err != nil {
+		t.Fatal(err)
+	}
+	chown := os.Chown(ref, 1234, 5678) == nil
+
+	fs := NewFileSync(src, dst, false, WithPermissionsFrom(ref))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]os.FileMode{
+		filepath.Join(dst, "sub"):          0750,
+		filepath.Join(dst, "sub", "a.txt"): 0640,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %o, want %o", path, got, want)
+		}
+		if !chown {
+			continue
+		}
+		st := info.Sys().(*syscall.Stat_t)
+		if st.Uid != 1234 || st.Gid != 5678 {
+			t.Errorf("%s: owner %d:%d, want 1234:5678", path, st.Uid, st.Gid)
+		}
+	}
+}
+
+func TestFileSync_PermissionsFromExplicitMode(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	ref := filepath.Join(tmp, "ref.txt")
+	writeTestFile(t, filepath.Join(src, "sub", "a.txt"), "a", time.Now())
+	writeTestFile(t, ref, "", time.Now())
+	if err := os.Chmod(ref, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileSync(src, dst, false, WithPermissionsFrom(ref), WithFileMode(0600))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	// A file reference gives directories execute bits where readable
+	for path, want := range map[string]os.FileMode{
+		filepath.Join(dst, "sub"):          0750,
+		filepath.Join(dst, "sub", "a.txt"): 0600,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %o, want %o", path, got, want)
+		}
+	}
+}
+
+func TestFileSync_PermissionsFromMissing(t *testing.T) {
+	tmp := t.TempDir()
+	fs := NewFileSync(filepath.Join(tmp, "src"), filepath.Join(tmp, "dst"), false,
+		WithPermissionsFrom(filepath.Join(tmp, "nope")))
+	if err := fs.SyncDirs(); err == nil {
+		t.Fatal("expected an error for a missing reference")
+	}
+}
+
+func TestFileSync_Archive(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "sub", "run.sh"), "#!/bin/sh", time.Now().Add(-time.Hour))
+	if err := os.Chmod(filepath.Join(src, "sub", "run.sh"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/run.sh", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	// Only root can hand files to another owner
+	chown := os.Chown(filepath.Join(src, "sub", "run.sh"), 1234, 5678) == nil
+
+	fs := NewFileSync(src, dst, false, WithArchive())
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{"sub": 0700, "sub/run.sh": 0750} {
+		info, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %o, want %o", name, got, want)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "sub/run.sh" {
+		t.Errorf("link = %q, %v; want a symlink to sub/run.sh", target, err)
+	}
+	if chown {
+		info, err := os.Stat(filepath.Join(dst, "sub", "run.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := info.Sys().(*syscall.Stat_t)
+		if st.Uid != 1234 || st.Gid != 5678 {
+			t.Errorf("owner %d:%d, want 1234:5678", st.Uid, st.Gid)
+		}
+	}
+
+	// Later options override parts of the archive mode
+	dst2 := filepath.Join(tmp, "dst2")
+	fs = NewFileSync(src, dst2, false, WithArchive(), WithPreservePerms(false), WithPreserveSymlinks(false))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(filepath.Join(dst2, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Error("link was recreated as a symlink despite WithPreserveSymlinks(false)")
+	}
+	if info.Mode().Perm() == 0750 {
+		t.Error("copy got the source mode despite WithPreservePerms(false)")
+	}
+}
@@ -0,0 +1,51 @@
+package filesync
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_EmptyPlaceholders(t *testing.T) {
+	for _, skip := range []bool{true, false} {
+		t.Run(fmt.Sprintf("placeholders %v", skip), func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			old := time.Now().Add(-time.Hour)
+			now := time.Now()
+
+			// Not ready yet: an empty source over real data
+			writeTestFile(t, filepath.Join(src, "report.csv"), "", now)
+			writeTestFile(t, filepath.Join(dst, "report.csv"), "real data", old)
+			// Empty on both sides, or new: synced as usual
+			writeTestFile(t, filepath.Join(src, "empty.txt"), "", now)
+			writeTestFile(t, filepath.Join(dst, "empty.txt"), "", old)
+			writeTestFile(t, filepath.Join(src, "new.txt"), "", now)
+
+			fs := NewFileSync(src, dst, false, WithEmptyPlaceholders(skip))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			want, wantCopied, wantPlaceholders := "", 3, []string(nil)
+			if skip {
+				want, wantCopied, wantPlaceholders = "real data", 2, []string{"report.csv"}
+			}
+			if got := readTestFile(t, filepath.Join(dst, "report.csv")); got != want {
+				t.Errorf("report.csv = %q, want %q", got, want)
+			}
+			stats := fs.Stats()
+			if stats.FilesCopied != wantCopied {
+				t.Errorf("FilesCopied = %d, want %d", stats.FilesCopied, wantCopied)
+			}
+			if !reflect.DeepEqual(stats.Placeholders, wantPlaceholders) {
+				t.Errorf("Placeholders = %q, want %q", stats.Placeholders, wantPlaceholders)
+			}
+			if got := readTestFile(t, filepath.Join(dst, "new.txt")); got != "" {
+				t.Errorf("new.txt = %q", got)
+			}
+		})
+	}
+}
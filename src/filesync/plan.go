@@ -0,0 +1,128 @@
+package filesync
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ActionKind is the type of change a sync makes to the target.
+type ActionKind string
+
+const (
+	// ActionAdd creates a file or directory missing from target.
+	ActionAdd ActionKind = "add"
+	// ActionModify replaces a target file that differs from source.
+	ActionModify ActionKind = "modify"
+	// ActionDelete removes a target entry missing from source.
+	ActionDelete ActionKind = "delete"
+)
+
+// Action is a single change to the target, planned in dry-run mode
+// or performed by a regular run.
+type Action struct {
+	Kind   ActionKind
+	Path   string     // relative to the target root
+	IsDir  bool       // whether the entry is a directory
+	Reason DiffReason // why a modified file differs (ActionModify only)
+
+	// OldSize and NewSize are the sizes of a file on the target before
+	// and after the action: OldSize is zero for an added file, NewSize
+	// for a deleted one and for a hard link to a duplicate (see
+	// WithDedup), which takes no room. Both are zero for directories
+	// and links.
+	OldSize int64
+	NewSize int64
+}
+
+// Delta returns how many bytes the action adds to the target, negative
+// for the bytes it frees.
+func (a Action) Delta() int64 {
+	return a.NewSize - a.OldSize
+}
+
+// ByteImpact sums the deltas of actions into the bytes the target
+// grows by and the bytes freed on it, by files that are deleted or
+// replaced by smaller ones. Run a dry run first to see the storage
+// impact of a sync before applying it.
+func ByteImpact(actions []Action) (added, freed int64) {
+	for _, a := range actions {
+		if d := a.Delta(); d > 0 {
+			added += d
+		} else {
+			freed -= d
+		}
+	}
+	return added, freed
+}
+
+// PlannedActions returns the changes of the most recent SyncDirs run,
+// in the order they were decided. In dry-run mode nothing was applied
+// and these are the actions a real run would take.
+func (fs *FileSync) PlannedActions() []Action {
+	return fs.actions
+}
+
+// recordAction appends an action to the current run's list.
+func (fs *FileSync) recordAction(kind ActionKind, relPath string, isDir bool, reason DiffReason) {
+	fs.actions = append(fs.actions, Action{Kind: kind, Path: relPath, IsDir: isDir, Reason: reason})
+	fs.traceChange(kind, relPath, isDir, reason)
+	fs.spanAction(kind, relPath, reason)
+}
+
+// recordFileAction appends an action on a file with its sizes before
+// and after, to the current run's list.
+func (fs *FileSync) recordFileAction(kind ActionKind, relPath string, reason DiffReason, oldSize, newSize int64) {
+	fs.actions = append(fs.actions, Action{Kind: kind, Path: relPath, Reason: reason, OldSize: oldSize, NewSize: newSize})
+	fs.traceChange(kind, relPath, false, reason)
+	fs.spanAction(kind, relPath, reason)
+}
+
+// copySizes returns the target size of the file of job before and
+// after it is copied.
+func copySizes(kind ActionKind, job *fileJob) (oldSize, newSize int64) {
+	if kind == ActionModify && job.tgtInfo != nil {
+		oldSize = job.tgtInfo.Size()
+	}
+	return oldSize, job.srcInfo.Size()
+}
+
+// entrySize returns the size of the target entry d, zero if it cannot
+// be read.
+func entrySize(d os.DirEntry) int64 {
+	if info, err := d.Info(); err == nil {
+		return info.Size()
+	}
+	return 0
+}
+
+// WriteStatus renders actions in a compact, git-status-like format:
+// one "A path", "M path" or "D path" line per action (directories get
+// a trailing slash), followed by a summary count line.
+func WriteStatus(w io.Writer, actions []Action) error {
+	var added, modified, deleted int
+	for _, a := range actions {
+		code := "?"
+		switch a.Kind {
+		case ActionAdd:
+			code = "A"
+			added++
+		case ActionModify:
+			code = "M"
+			modified++
+		case ActionDelete:
+			code = "D"
+			deleted++
+		}
+		path := filepath.ToSlash(a.Path)
+		if a.IsDir {
+			path += "/"
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", code, path); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d added, %d modified, %d deleted\n", added, modified, deleted)
+	return err
+}
@@ -0,0 +1,121 @@
+package filesync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_DryRun(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(src, "new", "a.txt"), "a", now)
+	writeTestFile(t, filepath.Join(src, "changed.txt"), "new content", now)
+	writeTestFile(t, filepath.Join(dst, "changed.txt"), "old", now)
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", now)
+
+	fs := NewFileSync(src, dst, true, WithDryRun(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// directories are decided during the walk, files after comparison
+	want := []Action{
+		{Kind: ActionAdd, Path: "new", IsDir: true},
+		{Kind: ActionModify, Path: "changed.txt", Reason: ReasonSize, OldSize: 3, NewSize: 11},
+		{Kind: ActionAdd, Path: filepath.Join("new", "a.txt"), NewSize: 1},
+		{Kind: ActionDelete, Path: "orphan.txt", OldSize: 6},
+	}
+	if got := fs.PlannedActions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("PlannedActions = %+v, want %+v", got, want)
+	}
+	if added, freed := ByteImpact(fs.PlannedActions()); added != 9 || freed != 6 {
+		t.Errorf("ByteImpact = %d added, %d freed, want 9 and 6", added, freed)
+	}
+
+	// nothing may have been written
+	if _, err := os.Stat(filepath.Join(dst, "new")); !os.IsNotExist(err) {
+		t.Error("dry run created a directory")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "orphan.txt")); err != nil {
+		t.Error("dry run deleted a file")
+	}
+	data, _ := os.ReadFile(filepath.Join(dst, "changed.txt"))
+	if string(data) != "old" {
+		t.Error("dry run modified a file")
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	actions := []Action{
+		{Kind: ActionAdd, Path: "dir", IsDir: true},
+		{Kind: ActionAdd, Path: filepath.Join("dir", "new.txt")},
+		{Kind: ActionModify, Path: "changed.txt", Reason: ReasonTime},
+		{Kind: ActionDelete, Path: "gone.txt"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteStatus(&buf, actions); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "A dir/\nA dir/new.txt\nM changed.txt\nD gone.txt\n2 added, 1 modified, 1 deleted\n"
+	if buf.String() != want {
+		t.Errorf("WriteStatus =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestFileSync_DryRunFileToDirectory(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "conf", "app.ini"), "ini", time.Now())
+	writeTestFile(t, filepath.Join(src, "conf", "sub", "extra.ini"), "extra", time.Now())
+	writeTestFile(t, filepath.Join(src, "other.txt"), "other", time.Now())
+	writeTestFile(t, filepath.Join(dst, "conf"), "was a file", time.Now())
+
+	type planned struct {
+		Kind  ActionKind
+		Path  string
+		IsDir bool
+	}
+	plan := func(dryRun bool) []planned {
+		t.Helper()
+		fs := NewFileSync(src, dst, false, WithDryRun(dryRun))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if errs := fs.Stats().Errors; len(errs) != 0 {
+			t.Fatalf("dry run %v: errors %v", dryRun, errs)
+		}
+		var got []planned
+		for _, a := range fs.PlannedActions() {
+			got = append(got, planned{a.Kind, a.Path, a.IsDir})
+		}
+		return got
+	}
+
+	// The file in the way hides nothing below it: the subtree is new
+	want := []planned{
+		{ActionModify, "conf", true},
+		{ActionAdd, filepath.Join("conf", "sub"), true},
+		{ActionAdd, filepath.Join("conf", "app.ini"), false},
+		{ActionAdd, filepath.Join("conf", "sub", "extra.ini"), false},
+		{ActionAdd, "other.txt", false},
+	}
+	if got := plan(true); !reflect.DeepEqual(got, want) {
+		t.Errorf("dry run planned %v, want %v", got, want)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "conf")); err != nil || info.IsDir() {
+		t.Fatalf("dry run changed the target: %v, %v", info, err)
+	}
+	if got := plan(false); !reflect.DeepEqual(got, want) {
+		t.Errorf("real run did %v, the dry run planned %v", got, want)
+	}
+}
@@ -0,0 +1,279 @@
+package filesync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// planVersion is the format version written by ExportPlan.
+const planVersion = 1
+
+// ErrPlanDrift reports a planned copy whose source file no longer
+// matches the state it had when the plan was made.
+var ErrPlanDrift = errors.New("source changed since the plan was made")
+
+// planFile is the JSON document written by ExportPlan.
+type planFile struct {
+	Version int         `json:"version"`
+	Created time.Time   `json:"created"`
+	Target  string      `json:"target"`
+	Entries []planEntry `json:"entries"`
+}
+
+// planEntry is one planned action. Copies also record the source file
+// and the size and mod time it had, so drift can be detected.
+type planEntry struct {
+	Kind   ActionKind `json:"kind"`
+	Path   string     `json:"path"`
+	IsDir  bool       `json:"is_dir,omitempty"`
+	Reason DiffReason `json:"reason,omitempty"`
+
+	Source  string    `json:"source,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitzero"`
+}
+
+// planSource is the source side of a planned file copy.
+type planSource struct {
+	path string
+	info os.FileInfo
+}
+
+// isCopy reports whether the entry copies a file from the source.
+func (e planEntry) isCopy() bool {
+	return e.Kind != ActionDelete && !e.IsDir
+}
+
+// ExportPlan writes the actions planned by the most recent dry-run
+// SyncDirs to a JSON file at path, for review and a later ApplyPlan.
+func (fs *FileSync) ExportPlan(path string) error {
+	if !fs.dryRun {
+		return errors.New("a plan can only be exported after a dry run")
+	}
+	if fs.bidirectional {
+		return errors.New("plans are not supported in two-way mode")
+	}
+	plan := planFile{Version: planVersion, Created: time.Now(), Target: fs.target}
+	for _, a := range fs.actions {
+		entry := planEntry{Kind: a.Kind, Path: filepath.ToSlash(a.Path), IsDir: a.IsDir, Reason: a.Reason}
+		if entry.isCopy() {
+			src, ok := fs.planSources[a.Path]
+			if !ok {
+				return fmt.Errorf("no source recorded for planned copy of %s", a.Path)
+			}
+			entry.Source = src.path
+			entry.Size = src.info.Size()
+			entry.ModTime = src.info.ModTime()
+		}
+		plan.Entries = append(plan.Entries, entry)
+	}
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ApplyPlan performs exactly the actions of a plan written by
+// ExportPlan, without scanning the source again. Directories are
+// created and files copied in plan order, then deletions follow,
+// deepest directories last. A planned copy whose source file changed
+// size or mod time since the plan was made is not applied: it is
+// listed in Stats().Drifted with an ErrPlanDrift error. As with
+// SyncDirs, per-file errors are collected in Stats rather than
+// returned. The plan must have been made for the same target, and a
+// plan with an entry outside the target, or a copy from outside the
+// sources, is rejected before anything is applied.
+func (fs *FileSync) ApplyPlan(path string) error {
+	if fs.dryRun {
+		return errors.New("a plan cannot be applied in dry-run mode")
+	}
+	if fs.swap {
+		return errors.New("a plan cannot be applied with directory swaps")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var plan planFile
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("reading plan %s: %w", path, err)
+	}
+	if plan.Version != planVersion {
+		return fmt.Errorf("plan %s has unsupported version %d", path, plan.Version)
+	}
+	if !samePath(plan.Target, fs.target) {
+		return fmt.Errorf("plan %s was made for target %s, not %s", path, plan.Target, fs.target)
+	}
+	for _, entry := range plan.Entries {
+		if err := fs.checkPlanEntry(entry); err != nil {
+			return fmt.Errorf("plan %s: %w", path, err)
+		}
+	}
+
+	return fs.applying(func() {
+		var fileDeletes, dirDeletes []planEntry
+		for _, entry := range plan.Entries {
+			switch {
+			case entry.Kind == ActionDelete && entry.IsDir:
+				dirDeletes = append(dirDeletes, entry)
+			case entry.Kind == ActionDelete:
+				fileDeletes = append(fileDeletes, entry)
+			case entry.IsDir:
+				fs.applyDir(entry)
+			default:
+				fs.applyCopy(entry)
+			}
+		}
+		for _, entry := range fileDeletes {
+			fs.applyDelete(entry)
+		}
+		// Children before their parents, so emptied directories can go
+		sort.SliceStable(dirDeletes, func(i, j int) bool {
+			return strings.Count(dirDeletes[i].Path, "/") > strings.Count(dirDeletes[j].Path, "/")
+		})
+		for _, entry := range dirDeletes {
+			fs.applyDelete(entry)
+		}
+	})
+}
+
+// checkPlanEntry rejects a plan entry whose path would leave the
+// target, such as "../x" in a crafted or damaged plan, and a planned
+// copy whose source file lies outside every source.
+func (fs *FileSync) checkPlanEntry(entry planEntry) error {
+	if !filepath.IsLocal(filepath.FromSlash(entry.Path)) {
+		return fmt.Errorf("entry %q is not a path within the target", entry.Path)
+	}
+	if !entry.isCopy() {
+		return nil
+	}
+	for _, root := range append([]string{fs.source}, fs.extraSources...) {
+		if withinRoot(entry.Source, fs.strippedRoot(root)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("entry %q copies from %q, which is not in a source", entry.Path, entry.Source)
+}
+
+// withinRoot reports whether path is root or lies below it.
+func withinRoot(path, root string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// applying runs apply, which changes the target without a scan of the
+// source, as a run of its own: connected, with the target locked, and
+// recorded and reported like SyncDirs. It is shared by ApplyPlan and
+// Replay.
+func (fs *FileSync) applying(apply func()) (err error) {
+	if err := fs.connect(); err != nil {
+		return err
+	}
+	stop, err := fs.serveStatus()
+	if err != nil {
+		return err
+	}
+	defer stop()
+	release, err := fs.acquireLock()
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := fs.loadTransforms(); err != nil {
+		return err
+	}
+	if err := fs.loadPermissionsRef(); err != nil {
+		return err
+	}
+	fs.stats = Stats{}
+	fs.actions = nil
+	defer fs.beginStatus()()
+	defer func(start time.Time) { fs.recordRun(start, err) }(time.Now())
+	defer func(start time.Time) {
+		if reportErr := fs.writeReport(start, err); err == nil {
+			err = reportErr
+		}
+	}(time.Now())
+
+	apply()
+	return fs.saveTransforms()
+}
+
+// applyDir creates a planned directory, replacing a file in its way.
+func (fs *FileSync) applyDir(entry planEntry) {
+	relPath := filepath.FromSlash(entry.Path)
+	targetPath := filepath.Join(fs.target, relPath)
+	if entry.Reason == ReasonType {
+		if err := fs.removeEntry(fs.tgtFS, targetPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("❌ Failed to remove file blocking directory %q: %v", targetPath, err)
+			fs.recordError(&DeleteError{Path: targetPath, Err: err})
+			return
+		}
+	}
+	if err := fs.makeDir(targetPath); err != nil {
+		log.Printf("❌ Failed to create directory %q: %v", targetPath, err)
+		fs.recordError(&MkdirError{Path: targetPath, Err: err})
+		return
+	}
+	log.Printf("📂 Created directory: %q", targetPath)
+	fs.recordAction(entry.Kind, relPath, true, entry.Reason)
+	fs.stats.DirsCreated++
+}
+
+// applyCopy copies a planned file after checking that its source is
+// still in the recorded state.
+func (fs *FileSync) applyCopy(entry planEntry) {
+	relPath := filepath.FromSlash(entry.Path)
+	targetPath := filepath.Join(fs.target, relPath)
+	info, err := fs.srcFS.Stat(entry.Source)
+	if err != nil || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+		log.Printf("⚠️ Source changed since the plan was made, not applied: %q", entry.Source)
+		fs.stats.Drifted = append(fs.stats.Drifted, relPath)
+		fs.recordError(&CopyError{Src: entry.Source, Dst: targetPath, Err: ErrPlanDrift})
+		return
+	}
+	if entry.Reason == ReasonType {
+		if err := fs.removeTree(fs.tgtFS, targetPath); err != nil {
+			log.Printf("❌ Failed to remove directory blocking file %q: %v", targetPath, err)
+			fs.recordError(&DeleteError{Path: targetPath, Err: err})
+			return
+		}
+	}
+	if err := fs.copyFile(entry.Source, targetPath); err != nil {
+		log.Printf("❌ Error copying %q → %q: %v", entry.Source, targetPath, err)
+		fs.recordError(&CopyError{Src: entry.Source, Dst: targetPath, Err: err})
+		return
+	}
+	log.Printf("📄 Copied/Updated: %q → %q", entry.Source, targetPath)
+	fs.recordAction(entry.Kind, relPath, false, entry.Reason)
+	fs.stats.FilesCopied++
+	fs.stats.BytesCopied += info.Size()
+}
+
+// applyDelete removes a planned file or (empty) directory. Entries
+// that are already gone count as done.
+func (fs *FileSync) applyDelete(entry planEntry) {
+	relPath := filepath.FromSlash(entry.Path)
+	targetPath := filepath.Join(fs.target, relPath)
+	if err := fs.removeEntry(fs.tgtFS, targetPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("❌ Failed to remove %q: %v", targetPath, err)
+		fs.recordError(&DeleteError{Path: targetPath, Err: err})
+		return
+	}
+	fs.recordAction(ActionDelete, relPath, entry.IsDir, "")
+	if entry.IsDir {
+		log.Printf("🗑️ Removed empty directory: %q", targetPath)
+		fs.stats.DirsDeleted++
+	} else {
+		log.Printf("🗑️ Removed file: %q", targetPath)
+		fs.stats.FilesDeleted++
+	}
+}
@@ -0,0 +1,127 @@
+package filesync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_ExportAndApplyPlan(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	planPath := filepath.Join(tmp, "plan.json")
+	old := time.Now().Add(-time.Hour)
+
+	writeTestFile(t, filepath.Join(src, "new", "a.txt"), "a", old)
+	writeTestFile(t, filepath.Join(src, "changed.txt"), "new content", old)
+	writeTestFile(t, filepath.Join(src, "drifts.txt"), "v1", old)
+	writeTestFile(t, filepath.Join(dst, "changed.txt"), "old", old)
+	writeTestFile(t, filepath.Join(dst, "orphan", "b.txt"), "orphan", old)
+
+	planner := NewFileSync(src, dst, true, WithDryRun(true))
+	if err := planner.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := planner.ExportPlan(planPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes after the review: one planned source drifts, and a new
+	// file appears that is not part of the plan
+	writeTestFile(t, filepath.Join(src, "drifts.txt"), "v2, edited", time.Now())
+	writeTestFile(t, filepath.Join(src, "unplanned.txt"), "x", old)
+
+	fs := NewFileSync(src, dst, true)
+	if err := fs.ApplyPlan(planPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for rel, want := range map[string]string{"new/a.txt": "a", "changed.txt": "new content"} {
+		data, err := os.ReadFile(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", rel, data, want)
+		}
+	}
+	for _, rel := range []string{"drifts.txt", "unplanned.txt", "orphan"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist, stat err = %v", rel, err)
+		}
+	}
+
+	stats := fs.Stats()
+	if want := []string{"drifts.txt"}; !reflect.DeepEqual(stats.Drifted, want) {
+		t.Errorf("Drifted = %v, want %v", stats.Drifted, want)
+	}
+	if !errors.Is(stats.Err(), ErrPlanDrift) {
+		t.Errorf("Err() = %v, want ErrPlanDrift", stats.Err())
+	}
+	if stats.FilesCopied != 2 || stats.FilesDeleted != 1 || stats.DirsDeleted != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestFileSync_PlanRequirements(t *testing.T) {
+	tmp := t.TempDir()
+	planPath := filepath.Join(tmp, "plan.json")
+
+	if err := NewFileSync(tmp, tmp, false).ExportPlan(planPath); err == nil {
+		t.Error("expected ExportPlan to require a dry run")
+	}
+
+	planner := NewFileSync(tmp, filepath.Join(tmp, "dst"), false, WithDryRun(true))
+	if err := planner.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := planner.ExportPlan(planPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFileSync(tmp, filepath.Join(tmp, "elsewhere"), false).ApplyPlan(planPath); err == nil {
+		t.Error("expected ApplyPlan to refuse a plan for another target")
+	}
+}
+
+func TestFileSync_PlanOutsideTarget(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	planPath := filepath.Join(tmp, "plan.json")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+	writeTestFile(t, filepath.Join(tmp, "victim.txt"), "keep me", time.Now())
+	writeTestFile(t, filepath.Join(tmp, "secret.txt"), "secret", time.Now())
+
+	for name, entry := range map[string]planEntry{
+		"delete outside": {Kind: ActionDelete, Path: "../victim.txt"},
+		"copy outside":   {Kind: ActionAdd, Path: "../victim.txt", Source: filepath.Join(src, "a.txt")},
+		"absolute":       {Kind: ActionDelete, Path: filepath.ToSlash(filepath.Join(tmp, "victim.txt"))},
+		"foreign source": {Kind: ActionAdd, Path: "stolen.txt", Source: filepath.Join(tmp, "secret.txt")},
+	} {
+		info, err := os.Stat(entry.Source)
+		if err == nil {
+			entry.Size, entry.ModTime = info.Size(), info.ModTime()
+		}
+		data, err := json.Marshal(planFile{Version: planVersion, Target: dst, Entries: []planEntry{entry}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(planPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewFileSync(src, dst, true).ApplyPlan(planPath); err == nil {
+			t.Errorf("%s: ApplyPlan accepted %+v", name, entry)
+		}
+		if data, err := os.ReadFile(filepath.Join(tmp, "victim.txt")); err != nil || string(data) != "keep me" {
+			t.Fatalf("%s: victim.txt = %q, %v", name, data, err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "stolen.txt")); err == nil {
+			t.Fatalf("%s: a file from outside the source was copied", name)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// prefetchedStat is the result of stat'ing a target path, with and
+// without following a symlink there.
+type prefetchedStat struct {
+	lstat, stat       os.FileInfo
+	lstatErr, statErr error
+}
+
+// targetStats holds the target lookups of a dry-run scan planned in
+// parallel (see WithParallelPlan), fetched on the walk's pool ahead of
+// the scan, keyed by target path. A dry run writes nothing to the
+// target, so they stay true until the scan is over.
+type targetStats struct {
+	mu    sync.Mutex
+	stats map[string]prefetchedStat
+}
+
+// prefetchTarget returns the walk prefetch that stats the target
+// counterpart of each entry of tree, or nil when the scan does not
+// look up the target ahead.
+func (fs *FileSync) prefetchTarget(tree sourceTree) func(path string) {
+	ts := fs.planStats
+	if ts == nil {
+		return nil
+	}
+	return func(path string) {
+		relPath, err := filepath.Rel(tree.root, path)
+		if err != nil {
+			return
+		}
+		targetPath := filepath.Join(fs.target, relPath)
+		var s prefetchedStat
+		s.lstat, s.lstatErr = fs.tgtFS.Lstat(targetPath)
+		switch {
+		case s.lstatErr != nil:
+			s.statErr = s.lstatErr
+		case s.lstat.Mode()&os.ModeSymlink == 0:
+			s.stat = s.lstat
+		default:
+			s.stat, s.statErr = fs.tgtFS.Stat(targetPath)
+		}
+		ts.mu.Lock()
+		ts.stats[targetPath] = s
+		ts.mu.Unlock()
+	}
+}
+
+// prefetched returns what was fetched ahead for targetPath.
+func (fs *FileSync) prefetched(targetPath string) (prefetchedStat, bool) {
+	ts := fs.planStats
+	if ts == nil {
+		return prefetchedStat{}, false
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	s, ok := ts.stats[targetPath]
+	return s, ok
+}
+
+// targetLstat is fs.tgtFS.Lstat, answered from the lookups fetched
+// ahead of a parallel dry-run scan where there is one.
+func (fs *FileSync) targetLstat(targetPath string) (os.FileInfo, error) {
+	if s, ok := fs.prefetched(targetPath); ok {
+		return s.lstat, s.lstatErr
+	}
+	return fs.tgtFS.Lstat(targetPath)
+}
+
+// targetStat is targetLstat following symlinks, like fs.tgtFS.Stat.
+func (fs *FileSync) targetStat(targetPath string) (os.FileInfo, error) {
+	if s, ok := fs.prefetched(targetPath); ok {
+		return s.stat, s.statErr
+	}
+	return fs.tgtFS.Stat(targetPath)
+}
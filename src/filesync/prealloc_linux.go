@@ -0,0 +1,20 @@
+//go:build linux
+
+package filesync
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate reserves size bytes of disk space for f using fallocate,
+// falling back to extending the file when fallocate is unsupported
+// or f is not a local file.
+func preallocate(f File, size int64) error {
+	if local, ok := f.(*os.File); ok {
+		if err := syscall.Fallocate(int(local.Fd()), 0, 0, size); err == nil {
+			return nil
+		}
+	}
+	return f.Truncate(size)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package filesync
+
+// preallocate extends f to size bytes. Without fallocate this only
+// sets the length, but still lets the filesystem plan the layout.
+func preallocate(f File, size int64) error {
+	return f.Truncate(size)
+}
@@ -0,0 +1,67 @@
+package filesync
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// targetEntry is a target entry as the WithDeletePreexistingOnly
+// listing found it before the sync.
+type targetEntry struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// listTarget records every target entry within scopes, for the delete
+// pass to tell entries that were there before the sync from ones
+// another process added since.
+func (fs *FileSync) listTarget(scopes []string) (map[string]targetEntry, error) {
+	entries := map[string]targetEntry{}
+	for _, scope := range scopes {
+		scopeRoot := filepath.Join(fs.target, scope)
+		if _, err := fs.tgtFS.Lstat(scopeRoot); os.IsNotExist(err) {
+			continue
+		}
+		err := fs.walk(fs.tgtFS, scopeRoot, func(path string, d os.DirEntry, err error) error {
+			if err != nil || fs.isInternal(path) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			relPath, _ := filepath.Rel(fs.target, path)
+			entries[relPath] = targetEntry{isDir: d.IsDir(), size: info.Size(), modTime: info.ModTime()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// spareOrphan reports whether the delete pass must leave the orphan
+// relPath alone because WithDeletePreexistingOnly is set and it was
+// not in the target before the sync, or has changed since.
+func (fs *FileSync) spareOrphan(relPath, path string, d os.DirEntry) bool {
+	if fs.preexisting == nil {
+		return false
+	}
+	before, ok := fs.preexisting[relPath]
+	if ok && d.IsDir() && before.isDir {
+		return false
+	}
+	if ok && !d.IsDir() && !before.isDir {
+		info, err := d.Info()
+		if err == nil && info.Size() == before.size && info.ModTime().Equal(before.modTime) {
+			return false
+		}
+	}
+	log.Printf("🛡️ Sparing an entry added or changed during the sync: %q", path)
+	fs.stats.Spared = append(fs.stats.Spared, relPath)
+	return true
+}
@@ -0,0 +1,62 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// busyTargetFS is a target another process writes into: the first
+// removal adds a file to a directory the delete pass has not reached
+// yet and rewrites an orphan it has not looked at. The target probe
+// does not count.
+type busyTargetFS struct {
+	FS
+	root string
+	done bool
+}
+
+func (b *busyTargetFS) Remove(name string) error {
+	if !b.done && filepath.Base(name) != probeName {
+		b.done = true
+		os.WriteFile(filepath.Join(b.root, "sub", "new.txt"), []byte("new"), 0644)
+		os.WriteFile(filepath.Join(b.root, "m-changed.txt"), []byte("rewritten"), 0644)
+	}
+	return b.FS.Remove(name)
+}
+
+func TestFileSync_DeletePreexistingOnly(t *testing.T) {
+	for _, only := range []bool{false, true} {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		old := time.Now().Add(-time.Hour)
+		writeTestFile(t, filepath.Join(src, "keep.txt"), "keep", old)
+		writeTestFile(t, filepath.Join(src, "sub", "keep.txt"), "keep", old)
+		writeTestFile(t, filepath.Join(dst, "a-old.txt"), "old", old)
+		writeTestFile(t, filepath.Join(dst, "m-changed.txt"), "old", old)
+
+		fs := NewFileSync(src, dst, true, WithTargetFS(&busyTargetFS{FS: LocalFS(), root: dst}), WithDeletePreexistingOnly(only))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatalf("only=%v: SyncDirs() = %v", only, err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "a-old.txt")); !os.IsNotExist(err) {
+			t.Errorf("only=%v: the old orphan was not deleted: %v", only, err)
+		}
+		for _, name := range []string{filepath.Join("sub", "new.txt"), "m-changed.txt"} {
+			_, err := os.Stat(filepath.Join(dst, name))
+			if spared := err == nil; spared != only {
+				t.Errorf("only=%v: %s spared = %v", only, name, spared)
+			}
+		}
+		want := []string(nil)
+		if only {
+			want = []string{"m-changed.txt", filepath.Join("sub", "new.txt")}
+		}
+		if got := fs.Stats().Spared; !reflect.DeepEqual(got, want) {
+			t.Errorf("only=%v: Spared = %v, want %v", only, got, want)
+		}
+	}
+}
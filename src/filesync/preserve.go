@@ -0,0 +1,59 @@
+package filesync
+
+import (
+	"log"
+	"os"
+)
+
+// copyMode returns the mode for dst, a copy of the source file info
+// describes: the configured one (see targetFileMode), else the
+// source's permission bits with WithPreservePerms, else zero to keep
+// the default.
+func (fs *FileSync) copyMode(dst string, info os.FileInfo) os.FileMode {
+	if mode := fs.targetFileMode(dst); mode != 0 {
+		return mode
+	}
+	if fs.preservePerms {
+		return info.Mode().Perm()
+	}
+	return 0
+}
+
+// copyOwner gives path on fsys the owner of its source, described by
+// info, with WithPreserveOwner, unless WithPermissionsFrom sets one.
+// As with applyOwner, the first failure is logged and the rest of the
+// run keeps the default owner.
+func (fs *FileSync) copyOwner(fsys FS, path string, info os.FileInfo) {
+	if !fs.preserveOwner || fs.ownerDenied || fs.chownTargets() {
+		return
+	}
+	c, ok := fsys.(chowner)
+	if !ok {
+		return
+	}
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return
+	}
+	if err := c.Chown(path, uid, gid); err != nil {
+		log.Printf("⚠️ Cannot preserve ownership, keeping the default owner: %v", err)
+		fs.ownerDenied = true
+	}
+}
+
+// ownerExcluded reports whether a source file described by info
+// belongs to a user or group excluded with WithExcludeOwner or
+// WithExcludeGroup. Files whose owner is unknown are never excluded.
+func (fs *FileSync) ownerExcluded(info os.FileInfo) bool {
+	if len(fs.excludeOwners) == 0 && len(fs.excludeGroups) == 0 {
+		return false
+	}
+	uid, gid, ok := fileOwner(info)
+	return ok && (fs.excludeOwners[uid] || fs.excludeGroups[gid])
+}
+
+// stampsDirs reports whether source directories are noted during the
+// walk so applyDirStamps can give their target copies source metadata.
+func (fs *FileSync) stampsDirs() bool {
+	return fs.dirsOnly || fs.preservePerms || fs.preserveOwner || fs.acls
+}
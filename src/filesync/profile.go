@@ -0,0 +1,66 @@
+package filesync
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// slowestFiles is how many of the slowest copies Timings keeps.
+const slowestFiles = 10
+
+// Timings breaks down where a sync spent its time (see WithProfile).
+type Timings struct {
+	Walk    time.Duration // scanning the sources
+	Compare time.Duration // comparing files with their targets
+	Copy    time.Duration // copying files
+	Cleanup time.Duration // deleting orphans and pruning directories
+
+	// Slowest lists the slowest file copies, slowest first.
+	Slowest []FileTiming
+}
+
+// FileTiming is how long copying one file took.
+type FileTiming struct {
+	Path     string // relative to the target root
+	Bytes    int64
+	Duration time.Duration
+}
+
+// String summarizes the phases, e.g. "walk 1.2s, compare 300ms,
+// copy 45s, cleanup 300ms".
+func (t Timings) String() string {
+	return fmt.Sprintf("walk %v, compare %v, copy %v, cleanup %v",
+		t.Walk.Round(time.Millisecond), t.Compare.Round(time.Millisecond),
+		t.Copy.Round(time.Millisecond), t.Cleanup.Round(time.Millisecond))
+}
+
+// timePhase starts timing a phase when profiling, and its span with
+// WithSpanTracer; the returned function adds the elapsed time to d and
+// ends the span.
+func (fs *FileSync) timePhase(name string, d *time.Duration) func() {
+	endSpan := fs.startPhaseSpan(name)
+	if !fs.profile {
+		return endSpan
+	}
+	start := time.Now()
+	return func() {
+		*d += time.Since(start)
+		endSpan()
+	}
+}
+
+// recordFileTiming keeps the copy of relPath if it is among the
+// slowest so far.
+func (t *Timings) recordFileTiming(relPath string, bytes int64, d time.Duration) {
+	if len(t.Slowest) == slowestFiles && d <= t.Slowest[len(t.Slowest)-1].Duration {
+		return
+	}
+	i := sort.Search(len(t.Slowest), func(i int) bool { return t.Slowest[i].Duration < d })
+	t.Slowest = append(t.Slowest, FileTiming{})
+	copy(t.Slowest[i+1:], t.Slowest[i:])
+	t.Slowest[i] = FileTiming{Path: relPath, Bytes: bytes, Duration: d}
+	if len(t.Slowest) > slowestFiles {
+		t.Slowest = t.Slowest[:slowestFiles]
+	}
+}
@@ -0,0 +1,60 @@
+package filesync
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimings_RecordFileTiming(t *testing.T) {
+	var timings Timings
+	for i := 1; i <= slowestFiles+5; i++ {
+		// 1ms, 2ms, ... interleaved with a slow outlier
+		timings.recordFileTiming(fmt.Sprintf("f%d", i), 0, time.Duration(i)*time.Millisecond)
+	}
+	timings.recordFileTiming("outlier", 0, time.Second)
+
+	if len(timings.Slowest) != slowestFiles {
+		t.Fatalf("kept %d files, want %d", len(timings.Slowest), slowestFiles)
+	}
+	if timings.Slowest[0].Path != "outlier" {
+		t.Errorf("slowest = %s, want outlier", timings.Slowest[0].Path)
+	}
+	for i := 1; i < len(timings.Slowest); i++ {
+		if timings.Slowest[i].Duration > timings.Slowest[i-1].Duration {
+			t.Fatalf("not sorted slowest first: %+v", timings.Slowest)
+		}
+	}
+	if last := timings.Slowest[len(timings.Slowest)-1].Path; last != "f7" {
+		t.Errorf("fastest kept = %s, want f7", last)
+	}
+}
+
+func TestFileSync_Profile(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+	writeTestFile(t, filepath.Join(src, "b.txt"), "bb", time.Now())
+
+	fs := NewFileSync(src, filepath.Join(tmp, "plain"), true)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().Timings; !reflect.DeepEqual(got, Timings{}) {
+		t.Errorf("timings recorded without WithProfile: %+v", got)
+	}
+
+	fs = NewFileSync(src, filepath.Join(tmp, "profiled"), true, WithProfile(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	timings := fs.Stats().Timings
+	if timings.Walk <= 0 || timings.Copy <= 0 {
+		t.Errorf("phase timings missing: %v", timings)
+	}
+	if len(timings.Slowest) != 2 {
+		t.Errorf("Slowest = %+v, want both files", timings.Slowest)
+	}
+}
@@ -0,0 +1,118 @@
+package filesync
+
+import (
+	"io"
+	"time"
+)
+
+// Progress is a snapshot of the copy phase of a running sync.
+//
+// Totals are known up front: files are compared before any is
+// copied, so FilesTotal and BytesTotal cover exactly the files that
+// will be written. Rate is smoothed over recent throughput, which
+// keeps ETA stable across a mix of small and large files.
+type Progress struct {
+	Path       string // file being copied, relative to the roots
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+
+	Rate float64       // recent throughput in bytes per second
+	ETA  time.Duration // estimated time remaining; zero until Rate is known
+}
+
+const (
+	// progressInterval limits how often the callback fires mid-file.
+	progressInterval = 200 * time.Millisecond
+	// rateSampleInterval is the window each throughput sample covers.
+	rateSampleInterval = time.Second
+	// rateSmoothing is the weight of the newest sample in the moving
+	// average; lower values react more slowly to bursts.
+	rateSmoothing = 0.3
+)
+
+// progressTracker accumulates copy progress and reports it to the
+// callback set with WithProgress.
+type progressTracker struct {
+	fn func(Progress)
+	p  Progress
+
+	fileStart int64 // BytesDone when the current file started
+
+	sampleTime  time.Time
+	sampleBytes int64
+	lastReport  time.Time
+}
+
+// newProgressTracker starts tracking the copy of jobs.
+func newProgressTracker(fn func(Progress), jobs []*fileJob) *progressTracker {
+	t := &progressTracker{fn: fn, sampleTime: time.Now()}
+	for _, job := range jobs {
+		if job.copy && job.err == nil {
+			t.p.FilesTotal++
+			t.p.BytesTotal += job.srcInfo.Size()
+		}
+	}
+	return t
+}
+
+// begin marks the start of copying relPath.
+func (t *progressTracker) begin(relPath string) {
+	t.p.Path = relPath
+	t.fileStart = t.p.BytesDone
+	t.report(true)
+}
+
+// add counts n more bytes of the current file as transferred.
+func (t *progressTracker) add(n int64) {
+	t.p.BytesDone += n
+	t.report(false)
+}
+
+// finish marks the current file of the given size as done, whether
+// or not its copy succeeded, so the totals stay consistent.
+func (t *progressTracker) finish(size int64) {
+	t.p.BytesDone = t.fileStart + size
+	t.p.FilesDone++
+	t.report(true)
+}
+
+// report updates the rate estimate and calls the callback, at most
+// every progressInterval unless force is set.
+func (t *progressTracker) report(force bool) {
+	now := time.Now()
+	if elapsed := now.Sub(t.sampleTime); elapsed >= rateSampleInterval {
+		sample := float64(t.p.BytesDone-t.sampleBytes) / elapsed.Seconds()
+		if t.p.Rate == 0 {
+			t.p.Rate = sample
+		} else {
+			t.p.Rate = rateSmoothing*sample + (1-rateSmoothing)*t.p.Rate
+		}
+		t.sampleTime = now
+		t.sampleBytes = t.p.BytesDone
+	}
+	if !force && now.Sub(t.lastReport) < progressInterval {
+		return
+	}
+	t.lastReport = now
+
+	t.p.ETA = 0
+	if t.p.Rate > 0 {
+		remaining := float64(max(t.p.BytesTotal-t.p.BytesDone, 0))
+		t.p.ETA = time.Duration(remaining / t.p.Rate * float64(time.Second)).Round(time.Second)
+	}
+	t.fn(t.p)
+}
+
+// progressReader counts the bytes read through it.
+type progressReader struct {
+	r io.Reader
+	t *progressTracker
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.t.add(int64(n))
+	return n, err
+}
@@ -0,0 +1,65 @@
+package filesync
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_ProgressTotals(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modtime := time.Now().Add(-time.Hour)
+
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", modtime)
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), strings.Repeat("x", 100), modtime)
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same", modtime)
+	writeTestFile(t, filepath.Join(dst, "same.txt"), "same", modtime)
+
+	var updates []Progress
+	fs := NewFileSync(src, dst, false, WithProgress(func(p Progress) {
+		updates = append(updates, p)
+	}))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(updates) == 0 {
+		t.Fatal("no progress reported")
+	}
+	for _, p := range updates {
+		if p.FilesTotal != 2 || p.BytesTotal != 105 {
+			t.Fatalf("totals = %d files/%d bytes, want 2/105 (unchanged files excluded)", p.FilesTotal, p.BytesTotal)
+		}
+	}
+	last := updates[len(updates)-1]
+	if last.FilesDone != 2 || last.BytesDone != 105 {
+		t.Errorf("final progress = %d files/%d bytes, want 2/105", last.FilesDone, last.BytesDone)
+	}
+}
+
+func TestProgressTracker_SmoothedETA(t *testing.T) {
+	var last Progress
+	tr := newProgressTracker(func(p Progress) { last = p }, nil)
+	tr.p.BytesTotal = 1000
+
+	// 100 bytes over one second: 100 B/s, 900 bytes to go
+	tr.sampleTime = time.Now().Add(-time.Second)
+	tr.add(100)
+	if last.Rate < 90 || last.Rate > 110 {
+		t.Fatalf("rate = %.1f, want about 100", last.Rate)
+	}
+	if last.ETA < 8*time.Second || last.ETA > 10*time.Second {
+		t.Fatalf("ETA = %v, want about 9s", last.ETA)
+	}
+
+	// A sudden burst only moves the average part of the way
+	tr.sampleTime = time.Now().Add(-time.Second)
+	tr.lastReport = time.Time{}
+	tr.add(800)
+	if last.Rate < 250 || last.Rate > 350 {
+		t.Errorf("smoothed rate = %.1f, want about 310 (not the instantaneous 800)", last.Rate)
+	}
+}
@@ -0,0 +1,60 @@
+package filesync
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// AddProtect keeps the target entries matching pattern from ever being
+// removed by delete-missing, even though they are absent from the
+// source, for artifacts the target side maintains itself, such as a
+// .cache directory. Patterns are written like the lines of a
+// .syncignore file ("*.log", ".cache/", "/local", "!drop.log") and
+// matched against paths relative to the target root; a protected
+// directory protects everything below it. Unlike excludes, protection
+// only concerns the target: matching source files are still synced.
+// Orphans spared this way are logged and listed in Stats.Protected.
+func (fs *FileSync) AddProtect(pattern string) {
+	if r, ok := parseIgnoreRule(pattern, ""); ok {
+		fs.protects = append(fs.protects, r)
+	}
+}
+
+// protected reports whether the target entry at relPath, or one of
+// the directories holding it, matches the AddProtect patterns, the
+// last matching pattern deciding as in .syncignore files.
+func (fs *FileSync) protected(relPath string, isDir bool) bool {
+	if len(fs.protects) == 0 || relPath == "." {
+		return false
+	}
+	for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+		if fs.matchesProtect(dir, true) {
+			return true
+		}
+	}
+	return fs.matchesProtect(relPath, isDir)
+}
+
+// matchesProtect applies the protect patterns to relPath alone.
+func (fs *FileSync) matchesProtect(relPath string, isDir bool) bool {
+	rel := filepath.ToSlash(relPath)
+	matched := false
+	for _, r := range fs.protects {
+		if r.matches(rel, isDir) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// spareProtected reports whether the orphan at relPath is protected
+// and must not be deleted, logging and listing it if so.
+func (fs *FileSync) spareProtected(relPath, path string, d os.DirEntry) bool {
+	if !fs.protected(relPath, d.IsDir()) {
+		return false
+	}
+	log.Printf("🛡️ Protected, not deleted: %q", path)
+	fs.stats.Protected = append(fs.stats.Protected, relPath)
+	return true
+}
@@ -0,0 +1,43 @@
+package filesync
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFileSync_AddProtect(t *testing.T) {
+	now := time.Now()
+	mem := NewMemFS()
+	mem.WriteFile("/src/keep.txt", []byte("k"), now)
+	mem.WriteFile("/src/app/data.txt", []byte("d"), now)
+	mem.WriteFile("/dst/.cache/blob", []byte("c"), now)
+	mem.WriteFile("/dst/app/.cache/nested", []byte("c"), now)
+	mem.WriteFile("/dst/app/run.log", []byte("l"), now)
+	mem.WriteFile("/dst/app/drop.log", []byte("l"), now)
+	mem.WriteFile("/dst/stale.txt", []byte("s"), now)
+
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem))
+	fs.AddProtect(".cache/")
+	fs.AddProtect("*.log")
+	fs.AddProtect("!drop.log")
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kept := range []string{"/dst/.cache/blob", "/dst/app/.cache/nested", "/dst/app/run.log"} {
+		if _, err := mem.Stat(kept); err != nil {
+			t.Errorf("protected %s deleted: %v", kept, err)
+		}
+	}
+	for _, gone := range []string{"/dst/stale.txt", "/dst/app/drop.log"} {
+		if _, err := mem.Stat(gone); err == nil {
+			t.Errorf("unprotected orphan %s kept", gone)
+		}
+	}
+	protected := fs.Stats().Protected
+	slices.Sort(protected)
+	if want := []string{".cache", "app/.cache", "app/run.log"}; !slices.Equal(protected, want) {
+		t.Errorf("Protected = %v, want %v", protected, want)
+	}
+}
@@ -0,0 +1,133 @@
+package filesync
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// keepEmptyDir reports whether the source directory relPath of tree
+// must be mirrored even though it holds nothing to copy: in prune
+// mode that is only the case for directories that are empty in the
+// source too, unless WithPruneSourceEmptyDirs is set.
+func (fs *FileSync) keepEmptyDir(tree sourceTree, relPath string) bool {
+	if fs.pruneSourceEmptyDirs || tree.file != "" {
+		return false
+	}
+	entries, err := tree.fsys.ReadDir(filepath.Join(tree.root, relPath))
+	return err == nil && len(entries) == 0
+}
+
+// keptEverywhere is keepEmptyDir across all sources.
+func (fs *FileSync) keptEverywhere(trees []sourceTree, relPath string) bool {
+	for _, tree := range trees {
+		if fs.keepEmptyDir(tree, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// createPendingDirs creates the directories above relPath whose
+// creation scanSource deferred, outermost first.
+func (fs *FileSync) createPendingDirs(relPath string) {
+	var pending []string
+	for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+		if fs.pendingDirs[dir] {
+			pending = append(pending, dir)
+		}
+	}
+	for i := len(pending) - 1; i >= 0; i-- {
+		delete(fs.pendingDirs, pending[i])
+		fs.createDir(pending[i])
+	}
+}
+
+// pruneEmpty removes empty directories within scope of the target,
+// deepest first, so parents emptied by the removal go too. The
+// target root itself and excluded directories are left alone.
+func (fs *FileSync) pruneEmpty(trees []sourceTree, scope string) error {
+	scopeRoot := filepath.Join(fs.target, scope)
+	if _, err := fs.tgtFS.Lstat(scopeRoot); os.IsNotExist(err) {
+		return nil
+	}
+
+	var dirs []string
+	err := fs.walk(fs.tgtFS, scopeRoot, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error accessing %q: %v", path, err)
+			fs.recordError(&WalkError{Path: path, Err: err})
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		relPath, _ := filepath.Rel(fs.target, path)
+		if relPath == "." {
+			return nil
+		}
+		if fs.excludedEverywhere(trees, relPath, true) || fs.protected(relPath, true) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, relPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Directories this run added to are not empty, even if a dry
+	// run left them untouched on disk
+	occupied := map[string]bool{}
+	for _, action := range fs.actions {
+		if action.Kind == ActionDelete {
+			continue
+		}
+		if action.IsDir {
+			occupied[action.Path] = true
+		}
+		for dir := filepath.Dir(action.Path); dir != "."; dir = filepath.Dir(dir) {
+			occupied[dir] = true
+		}
+	}
+
+	// Walk order lists parents before children, so go backwards.
+	// In dry-run mode nothing is removed, so pruned children are
+	// tracked to judge whether their parent would become empty.
+	pruned := map[string]bool{}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		relPath := dirs[i]
+		path := filepath.Join(fs.target, relPath)
+
+		entries, err := fs.tgtFS.ReadDir(path)
+		if err != nil {
+			log.Printf("Error accessing %q: %v", path, err)
+			fs.recordError(&WalkError{Path: path, Err: err})
+			continue
+		}
+		empty := true
+		for _, entry := range entries {
+			if !entry.IsDir() || !pruned[filepath.Join(relPath, entry.Name())] {
+				empty = false
+				break
+			}
+		}
+		if !empty || occupied[relPath] || fs.keptEverywhere(trees, relPath) {
+			continue
+		}
+
+		if fs.dryRun {
+			log.Printf("🔎 Would prune empty directory: %q", path)
+		} else if rmErr := fs.removeEntry(fs.tgtFS, path); rmErr != nil {
+			log.Printf("❌ Failed to prune empty directory %q: %v", path, rmErr)
+			fs.recordError(&DeleteError{Path: path, Err: rmErr})
+			continue
+		} else {
+			log.Printf("🗑️ Pruned empty directory: %q", path)
+		}
+		pruned[relPath] = true
+		fs.recordAction(ActionDelete, relPath, true, "")
+		fs.stats.DirsDeleted++
+	}
+	return nil
+}
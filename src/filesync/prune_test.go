@@ -0,0 +1,124 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupPruneTree builds a source whose logs/ subtree only holds files
+// the extension filter excludes, an empty source directory, and a
+// target with nested empty directories left from earlier runs.
+func setupPruneTree(t *testing.T) (src, dst string) {
+	t.Helper()
+	tmp := t.TempDir()
+	src = filepath.Join(tmp, "src")
+	dst = filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(src, "keep", "a.txt"), "a", now)
+	writeTestFile(t, filepath.Join(src, "logs", "x.log"), "x", now)
+	writeTestFile(t, filepath.Join(src, "logs", "deep", "y.log"), "y", now)
+	for _, dir := range []string{
+		filepath.Join(src, "empty"),
+		filepath.Join(dst, "old", "nested", "deeper"),
+		filepath.Join(dst, "keep", "stale"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src, dst
+}
+
+func TestFileSync_PruneEmptyDirs(t *testing.T) {
+	src, dst := setupPruneTree(t)
+
+	fs := NewFileSync(src, dst, false, WithExtensions("txt"), WithPruneEmptyDirs(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rel := range []string{"keep/a.txt", "empty"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); err != nil {
+			t.Errorf("%s should exist: %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"logs", "old", "keep/stale"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been pruned, stat err = %v", rel, err)
+		}
+	}
+	if got := fs.Stats().DirsDeleted; got != 4 {
+		t.Errorf("DirsDeleted = %d, want 4 (old, old/nested, old/nested/deeper, keep/stale)", got)
+	}
+
+	// A second run neither recreates nor prunes anything
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.DirsCreated != 0 || stats.DirsDeleted != 0 {
+		t.Errorf("second run created %d and pruned %d dirs, want 0/0", stats.DirsCreated, stats.DirsDeleted)
+	}
+}
+
+func TestFileSync_NoEmptyDirs(t *testing.T) {
+	src, dst := setupPruneTree(t)
+	writeTestFile(t, filepath.Join(src, "new", "sub", "b.txt"), "b", time.Now())
+
+	fs := NewFileSync(src, dst, false, WithExtensions("txt"), WithNoEmptyDirs(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"keep/a.txt", "new/sub/b.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); err != nil {
+			t.Errorf("%s should exist: %v", rel, err)
+		}
+	}
+	// Directories filtered to empty, or empty in the source, are not
+	// created, while the empty ones already in the target stay
+	for _, rel := range []string{"logs", "logs/deep", "empty"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should not have been created, stat err = %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"old/nested/deeper", "keep/stale"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); err != nil {
+			t.Errorf("%s should have been left alone: %v", rel, err)
+		}
+	}
+	if stats := fs.Stats(); stats.DirsCreated != 2 || stats.DirsDeleted != 0 {
+		t.Errorf("created %d and deleted %d dirs, want 2/0 (new, new/sub)", stats.DirsCreated, stats.DirsDeleted)
+	}
+}
+
+func TestFileSync_PruneSourceEmptyDirs(t *testing.T) {
+	src, dst := setupPruneTree(t)
+
+	fs := NewFileSync(src, dst, false, WithExtensions("txt"), WithPruneEmptyDirs(true), WithPruneSourceEmptyDirs(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "empty")); !os.IsNotExist(err) {
+		t.Errorf("empty source dir should not be mirrored, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "keep", "a.txt")); err != nil {
+		t.Errorf("keep/a.txt should exist: %v", err)
+	}
+}
+
+func TestFileSync_PruneEmptyDirsDryRun(t *testing.T) {
+	src, dst := setupPruneTree(t)
+
+	fs := NewFileSync(src, dst, false, WithExtensions("txt"), WithPruneEmptyDirs(true), WithDryRun(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().DirsDeleted; got != 4 {
+		t.Errorf("DirsDeleted = %d, want 4", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "old", "nested", "deeper")); err != nil {
+		t.Errorf("dry run must not prune: %v", err)
+	}
+}
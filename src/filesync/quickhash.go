@@ -0,0 +1,60 @@
+package filesync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"io"
+	"os"
+)
+
+// compareQuickHash compares a source file and its target counterpart
+// by quick hash, see WithQuickHash, for compareFiles.
+func (fs *FileSync) compareQuickHash(srcPath, tgtPath string, src, tgt os.FileInfo) (DiffReason, error) {
+	n := int64(fs.quickHash) << 10
+	sumA, err := quickChecksum(fs.srcFS, srcPath, src.Size(), n, fs.newHash)
+	if err != nil {
+		return "", err
+	}
+	sumB, err := quickChecksum(fs.tgtFS, tgtPath, tgt.Size(), n, fs.newHash)
+	if err != nil {
+		return "", err
+	}
+	fs.contentRead.Add(min(src.Size(), 2*n) + min(tgt.Size(), 2*n))
+	if !bytes.Equal(sumA, sumB) {
+		return ReasonContent, nil
+	}
+	return "", nil
+}
+
+// quickChecksum returns the digest of the size of the file at path on
+// fsys and its first and last n bytes, or of all of it when it is no
+// larger than 2n bytes.
+func quickChecksum(fsys FS, path string, size, n int64, newHash func() hash.Hash) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := newHash()
+	var sizeBytes [8]byte
+	binary.BigEndian.PutUint64(sizeBytes[:], uint64(size))
+	h.Write(sizeBytes[:])
+	if size <= 2*n {
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		return h.Sum(nil), nil
+	}
+	if _, err := io.CopyN(h, f, n); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(size-n, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(h, f, n); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,54 @@
+package filesync
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_QuickHash(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	big := bytes.Repeat([]byte("a"), 8<<10)
+	edited := func(at int) string {
+		b := bytes.Clone(big)
+		b[at] = 'b'
+		return string(b)
+	}
+	now := time.Now()
+	old := now.Add(-time.Hour)
+	// Mod times differ everywhere, so only the hashes decide
+	writeTestFile(t, filepath.Join(src, "same.bin"), string(big), now)
+	writeTestFile(t, filepath.Join(dst, "same.bin"), string(big), old)
+	writeTestFile(t, filepath.Join(src, "head.bin"), edited(10), now)
+	writeTestFile(t, filepath.Join(dst, "head.bin"), string(big), old)
+	writeTestFile(t, filepath.Join(src, "tail.bin"), edited(len(big)-10), now)
+	writeTestFile(t, filepath.Join(dst, "tail.bin"), string(big), old)
+	// The documented blind spot: the middle is not read
+	writeTestFile(t, filepath.Join(src, "middle.bin"), edited(len(big)/2), now)
+	writeTestFile(t, filepath.Join(dst, "middle.bin"), string(big), old)
+	writeTestFile(t, filepath.Join(src, "small.txt"), "new", now)
+	writeTestFile(t, filepath.Join(dst, "small.txt"), "old", old)
+
+	fs := NewFileSync(src, dst, false, WithQuickHash(1))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 3 {
+		t.Errorf("FilesCopied = %d, want 3 (head, tail, small)", got)
+	}
+	if readTestFile(t, filepath.Join(dst, "middle.bin")) != string(big) {
+		t.Error("middle.bin copied by quick hash")
+	}
+
+	// Full checksums take precedence and catch the middle edit
+	fs = NewFileSync(src, dst, false, WithQuickHash(1), WithChecksum(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 1 {
+		t.Errorf("FilesCopied with checksums = %d, want 1 (middle)", got)
+	}
+}
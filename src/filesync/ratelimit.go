@@ -0,0 +1,132 @@
+package filesync
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateWindow is a daily time window with a transfer rate limit of its
+// own, for WithRateSchedule. Start and End are times of day, as
+// offsets from local midnight; a window whose End is not after its
+// Start wraps past midnight, so 22h to 6h covers the night.
+type RateWindow struct {
+	Start          time.Duration
+	End            time.Duration
+	BytesPerSecond int64 // zero for unlimited
+}
+
+// contains reports whether the time of day offset from midnight falls
+// within the window.
+func (w RateWindow) contains(offset time.Duration) bool {
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// checkRateSchedule reports a window whose bounds are not times of
+// day.
+func checkRateSchedule(schedule []RateWindow) error {
+	for i, w := range schedule {
+		if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End > 24*time.Hour || w.BytesPerSecond < 0 {
+			return fmt.Errorf("rate window %d: start and end must be times of day and the limit not negative", i+1)
+		}
+	}
+	return nil
+}
+
+// scheduledRate returns the limit in effect at now: that of the first
+// window of schedule containing it, else the static one.
+func scheduledRate(now time.Time, static int64, schedule []RateWindow) int64 {
+	y, m, d := now.Date()
+	offset := now.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+	for _, w := range schedule {
+		if w.contains(offset) {
+			return w.BytesPerSecond
+		}
+	}
+	return static
+}
+
+// rateRecheck is how often the schedule is consulted again while data
+// is being sent, so a long copy picks up the next window in time.
+const rateRecheck = time.Second
+
+// rateChunk bounds the bytes read at once under a limit, so slow rates
+// are kept smoothly rather than in long pauses.
+const rateChunk = 32 << 10
+
+// rateLimiter caps the bytes copied per second across all copies, see
+// WithRateLimit and WithRateSchedule.
+type rateLimiter struct {
+	mu       sync.Mutex
+	static   int64
+	schedule []RateWindow
+	now      func() time.Time
+	sleep    func(time.Duration)
+
+	rate    int64     // limit in effect, zero for none
+	checked time.Time // when rate was last looked up
+	since   time.Time // start of the current accounting period
+	sent    int64     // bytes sent since then
+}
+
+// newRateLimiter returns the limiter for a static limit and a
+// schedule, nil when neither limits anything.
+func newRateLimiter(static int64, schedule []RateWindow) *rateLimiter {
+	if static <= 0 && len(schedule) == 0 {
+		return nil
+	}
+	return &rateLimiter{static: static, schedule: schedule, now: time.Now, sleep: time.Sleep}
+}
+
+// wait blocks until n more bytes may be sent under the limit in
+// effect.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if l.checked.IsZero() || now.Sub(l.checked) >= rateRecheck {
+		if rate := scheduledRate(now, l.static, l.schedule); rate != l.rate || l.checked.IsZero() {
+			l.rate, l.since, l.sent = rate, now, 0
+		}
+		l.checked = now
+	}
+	if l.rate <= 0 {
+		return
+	}
+	// Time spent comparing or between files earns no credit to burst
+	// with later
+	if now.Sub(l.dueAt(l.sent)) > time.Second {
+		l.since, l.sent = now, 0
+	}
+	l.sent += int64(n)
+	if d := l.dueAt(l.sent).Sub(now); d > 0 {
+		l.sleep(d)
+	}
+}
+
+// dueAt returns when sent bytes are allowed through at the current
+// rate.
+func (l *rateLimiter) dueAt(sent int64) time.Time {
+	return l.since.Add(time.Duration(float64(sent) / float64(l.rate) * float64(time.Second)))
+}
+
+// limitedReader reads from r no faster than its limiter allows.
+type limitedReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateChunk {
+		p = p[:rateChunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.l.wait(n)
+	}
+	return n, err
+}
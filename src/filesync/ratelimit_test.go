@@ -0,0 +1,90 @@
+package filesync
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose sleeps advance it instantly.
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+	c.slept += d
+}
+
+func TestRateLimiter_Schedule(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 6, 10, 0, 0, 0, time.Local)}
+	l := newRateLimiter(0, []RateWindow{
+		{Start: 9 * time.Hour, End: 17 * time.Hour, BytesPerSecond: 1000},
+	})
+	l.now, l.sleep = clock.Now, clock.Sleep
+
+	// Business hours: 3000 bytes take three seconds
+	for range 3 {
+		l.wait(1000)
+	}
+	if clock.slept != 3*time.Second {
+		t.Errorf("slept %v during the window, want 3s", clock.slept)
+	}
+
+	// Overnight the schedule lifts the limit
+	clock.now, clock.slept = time.Date(2024, 5, 6, 18, 0, 0, 0, time.Local), 0
+	for range 3 {
+		l.wait(1 << 20)
+	}
+	if clock.slept != 0 {
+		t.Errorf("slept %v outside the window, want none", clock.slept)
+	}
+}
+
+func TestRateLimiter_Recheck(t *testing.T) {
+	// A long copy that crosses into an unlimited window speeds up
+	clock := &fakeClock{now: time.Date(2024, 5, 6, 16, 59, 58, 0, time.Local)}
+	l := newRateLimiter(0, []RateWindow{
+		{Start: 9 * time.Hour, End: 17 * time.Hour, BytesPerSecond: 1000},
+	})
+	l.now, l.sleep = clock.Now, clock.Sleep
+	for range 10 {
+		l.wait(1000)
+	}
+	if clock.slept != 2*time.Second {
+		t.Errorf("slept %v, want 2s until the window closed", clock.slept)
+	}
+}
+
+func TestScheduledRate(t *testing.T) {
+	schedule := []RateWindow{
+		{Start: 22 * time.Hour, End: 6 * time.Hour, BytesPerSecond: 0},
+		{Start: 9 * time.Hour, End: 17 * time.Hour, BytesPerSecond: 1 << 20},
+	}
+	for _, tc := range []struct {
+		hour int
+		want int64
+	}{
+		{23, 0},
+		{3, 0},
+		{10, 1 << 20},
+		{7, 500},
+		{17, 500},
+	} {
+		at := time.Date(2024, 5, 6, tc.hour, 0, 0, 0, time.Local)
+		if got := scheduledRate(at, 500, schedule); got != tc.want {
+			t.Errorf("rate at %d:00 = %d, want %d", tc.hour, got, tc.want)
+		}
+	}
+}
+
+func TestFileSync_RateScheduleInvalid(t *testing.T) {
+	mem := NewMemFS()
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem),
+		WithRateSchedule([]RateWindow{{Start: 25 * time.Hour, End: time.Hour}}))
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("SyncDirs() accepted a window starting at 25h")
+	}
+}
@@ -0,0 +1,74 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// probeName is the file a run writes to the target and removes again
+// for WithWriteCheck and WithClockCheck, see probeTarget.
+const probeName = ".filesync-probe"
+
+// ErrReadOnlyTarget reports a target on a read-only filesystem, such
+// as one mounted read-only, found by the probe of WithWriteCheck or
+// WithClockCheck.
+var ErrReadOnlyTarget = errors.New("the target is on a read-only filesystem")
+
+// probeFile returns the path of the probe in the target.
+func (fs *FileSync) probeFile() string {
+	return filepath.Join(fs.target, probeName)
+}
+
+// probeTarget writes and removes one probe file in the target before a
+// run walks anything, for both the checks that need one. A target on a
+// read-only filesystem fails the run with ErrReadOnlyTarget instead of
+// an error for every file; other failures are left for the sync to
+// report as usual. With WithClockCheck, the mod time the probe got
+// tells the target's clock skew. Runs with neither check, and dry
+// runs, which write nothing, skip the probe.
+func (fs *FileSync) probeTarget() error {
+	if fs.dryRun || (!fs.writeCheck && fs.clockCheck <= 0) {
+		return nil
+	}
+	skew, err := fs.writeProbe()
+	if err != nil && readOnlyFilesystem(err) {
+		return fmt.Errorf("cannot sync to %s: %w (%v)", fs.target, ErrReadOnlyTarget, err)
+	}
+	if fs.clockCheck <= 0 {
+		return nil
+	}
+	return fs.checkClock(skew, err)
+}
+
+// writeProbe writes the probe and returns how far its mod time lies
+// outside the time it took to write it, zero if within. The start is
+// rounded down to the second for targets that only keep whole seconds,
+// such as SFTP servers.
+func (fs *FileSync) writeProbe() (time.Duration, error) {
+	if err := fs.tgtFS.MkdirAll(fs.target, 0755); err != nil {
+		return 0, err
+	}
+	probe := fs.probeFile()
+	before := time.Now().Truncate(time.Second)
+	if err := writeFile(fs.tgtFS, probe, nil); err != nil {
+		return 0, err
+	}
+	after := time.Now()
+	info, err := fs.tgtFS.Stat(probe)
+	if rmErr := fs.tgtFS.Remove(probe); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch stamped := info.ModTime(); {
+	case stamped.Before(before):
+		return stamped.Sub(before), nil
+	case stamped.After(after):
+		return stamped.Sub(after), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package filesync
+
+// readOnlyFilesystem reports false where read-only filesystems cannot
+// be told apart from other failures.
+func readOnlyFilesystem(err error) bool {
+	return false
+}
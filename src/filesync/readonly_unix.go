@@ -0,0 +1,14 @@
+//go:build unix
+
+package filesync
+
+import (
+	"errors"
+	"syscall"
+)
+
+// readOnlyFilesystem reports whether err means the filesystem is
+// read-only.
+func readOnlyFilesystem(err error) bool {
+	return errors.Is(err, syscall.EROFS)
+}
@@ -0,0 +1,88 @@
+//go:build unix
+
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// readOnlyTargetFS is a target mounted read-only: reads work, writes
+// fail with EROFS.
+type readOnlyTargetFS struct {
+	FS
+}
+
+func (r readOnlyTargetFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+	}
+	return r.FS.OpenFile(name, flag, perm)
+}
+
+func (r readOnlyTargetFS) MkdirAll(path string, perm os.FileMode) error {
+	if _, err := r.FS.Stat(path); err == nil {
+		return nil
+	}
+	return &os.PathError{Op: "mkdir", Path: path, Err: syscall.EROFS}
+}
+
+func TestFileSync_ReadOnlyTarget(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for _, name := range []string{"a.txt", "b.txt", "sub/c.txt"} {
+		mem.WriteFile("/src/"+name, []byte(name), now)
+	}
+	mem.WriteFile("/dst/old.txt", []byte("old"), now)
+	target := readOnlyTargetFS{mem}
+
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(target), WithWriteCheck(true))
+	err := fs.SyncDirs()
+	if !errors.Is(err, ErrReadOnlyTarget) {
+		t.Fatalf("SyncDirs() = %v, want ErrReadOnlyTarget", err)
+	}
+	if stats := fs.Stats(); len(stats.Errors) != 0 || stats.FilesCopied != 0 {
+		t.Errorf("expected the run to stop before the walk, got %d per-file error(s) and %d copies", len(stats.Errors), stats.FilesCopied)
+	}
+
+	// A missing target on a read-only filesystem is caught too
+	fs = NewFileSync("/src", "/elsewhere", false, WithSourceFS(mem), WithTargetFS(target), WithWriteCheck(true))
+	if err := fs.SyncDirs(); !errors.Is(err, ErrReadOnlyTarget) {
+		t.Errorf("SyncDirs() to a missing target = %v, want ErrReadOnlyTarget", err)
+	}
+
+	// The clock check's probe catches it as well
+	fs = NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(target), WithClockCheck(time.Minute, false))
+	if err := fs.SyncDirs(); !errors.Is(err, ErrReadOnlyTarget) {
+		t.Errorf("SyncDirs() with a clock check = %v, want ErrReadOnlyTarget", err)
+	}
+
+	// A dry run writes nothing, so it goes ahead
+	fs = NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(target), WithWriteCheck(true), WithDryRun(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if got := len(fs.PlannedActions()); got != 5 {
+		t.Errorf("dry run planned %d action(s), want 5", got)
+	}
+}
+
+func TestFileSync_NoProbeByDefault(t *testing.T) {
+	mem := NewMemFS()
+	mem.WriteFile("/src/a.txt", []byte("a"), time.Now())
+	target := &remoteFS{FS: mem}
+
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(target))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range target.opened {
+		if filepath.Base(name) == probeName {
+			t.Errorf("the target was probed without a check asking for it: %s", name)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package filesync
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// readOnlyFilesystem reports whether err means the volume is
+// write-protected.
+func readOnlyFilesystem(err error) bool {
+	return errors.Is(err, windows.ERROR_WRITE_PROTECT)
+}
@@ -0,0 +1,23 @@
+package filesync
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink makes dst a copy-on-write clone of src with clonefile(2), as
+// supported by APFS. clonefile refuses to overwrite, so the clone is
+// made next to dst and renamed over it.
+func reflink(src *os.File, dst string) error {
+	clone := partialPath(dst)
+	_ = os.Remove(clone)
+	if err := unix.Clonefile(src.Name(), clone, unix.CLONE_NOFOLLOW); err != nil {
+		return err
+	}
+	if err := os.Rename(clone, dst); err != nil {
+		_ = os.Remove(clone)
+		return err
+	}
+	return nil
+}
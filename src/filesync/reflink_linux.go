@@ -0,0 +1,29 @@
+package filesync
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink makes dst share src's data blocks with the FICLONE ioctl,
+// as supported by Btrfs and XFS. An existing dst is only replaced once
+// the clone succeeded, so a partial copy survives a failed attempt.
+func reflink(src *os.File, dst string) error {
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(out.Fd()), int(src.Fd()))
+	if err == nil {
+		err = out.Truncate(info.Size())
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package filesync
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is not available on this platform; files are always copied.
+func reflink(src *os.File, dst string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,162 @@
+package filesync
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// renameCandidate is an orphaned target file that WithDetectRenames
+// may move to the path of a new source file with the same contents.
+// Its checksum is computed lazily, once a new file of its size turns
+// up.
+type renameCandidate struct {
+	relPath string
+	path    string
+	info    os.FileInfo
+	sum     []byte
+	used    bool // moved, or unreadable
+}
+
+// renameOrphans moves orphaned target files into place of new source
+// files with identical contents for WithDetectRenames, marking their
+// jobs as done, so reorganized trees are not copied over again. Only
+// orphans the delete pass would remove right away are used.
+func (fs *FileSync) renameOrphans(trees []sourceTree, scopes []string, jobs []*fileJob) error {
+	fs.renamedFrom = map[string]bool{}
+	if !fs.detectRenames || !fs.deleteMissing || fs.deleteRetention > 0 || fs.deletePreexistingOnly {
+		return nil
+	}
+	sizes := map[int64]bool{}
+	for _, job := range jobs {
+		if job.copy && job.err == nil && job.tgtInfo == nil && job.linkFrom == "" && job.srcInfo.Size() > 0 {
+			sizes[job.srcInfo.Size()] = true
+		}
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	index, err := fs.indexOrphans(trees, scopes, sizes)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if !job.copy || job.err != nil || job.tgtInfo != nil || job.linkFrom != "" || !sizes[job.srcInfo.Size()] {
+			continue
+		}
+		if err := fs.interrupted(); err != nil {
+			return err
+		}
+		from := fs.matchOrphan(job, index[job.srcInfo.Size()])
+		if from == nil {
+			continue
+		}
+		fs.createPendingDirs(job.relPath)
+		if fs.dryRun {
+			log.Printf("🔎 Would rename: %q → %q", from.path, job.targetPath)
+			fs.planSources[job.relPath] = planSource{path: job.srcPath, info: job.srcInfo}
+		} else if err := fs.moveOrphan(from.path, job); err != nil {
+			log.Printf("⚠️ Could not rename %q, copying instead: %v", from.path, err)
+			continue
+		} else {
+			log.Printf("🚚 Renamed: %q → %q", from.path, job.targetPath)
+		}
+		fs.renamedFrom[from.relPath] = true
+		fs.recordAction(ActionDelete, from.relPath, false, "")
+		fs.recordAction(ActionAdd, job.relPath, false, "")
+		fs.forgetManifest(from.relPath)
+		fs.journalDone(job)
+		fs.noteManifest(job, true)
+		fs.noteDeduped(job)
+		fs.stats.FilesRenamed++
+		job.copy, job.renamed = false, true
+	}
+	return nil
+}
+
+// indexOrphans lists the orphaned regular files in the target whose
+// size is one of sizes, by size.
+func (fs *FileSync) indexOrphans(trees []sourceTree, scopes []string, sizes map[int64]bool) (map[int64][]*renameCandidate, error) {
+	index := map[int64][]*renameCandidate{}
+	for _, scope := range scopes {
+		root := filepath.Join(fs.target, scope)
+		if _, err := fs.tgtFS.Lstat(root); os.IsNotExist(err) {
+			continue
+		}
+		err := fs.walk(fs.tgtFS, root, func(path string, d os.DirEntry, err error) error {
+			// Problem entries are reported by the delete pass
+			if err != nil || fs.isInternal(path) {
+				return nil
+			}
+			relPath, _ := filepath.Rel(fs.target, path)
+			if fs.excludedEverywhere(trees, relPath, d.IsDir()) || fs.contentExcluded(fs.tgtFS, path, d) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if orphan, _ := fs.orphaned(trees, relPath); !d.Type().IsRegular() || !orphan || fs.protected(relPath, false) {
+				return nil
+			}
+			info, err := d.Info()
+			if err == nil && sizes[info.Size()] {
+				index[info.Size()] = append(index[info.Size()], &renameCandidate{relPath: relPath, path: path, info: info})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// matchOrphan returns the first unused candidate with the same
+// checksum as the source of job, or nil.
+func (fs *FileSync) matchOrphan(job *fileJob, candidates []*renameCandidate) *renameCandidate {
+	if len(candidates) == 0 {
+		return nil
+	}
+	sum, err := fs.checksumOf(fs.srcFS, job.srcPath, job.srcInfo)
+	if err != nil {
+		return nil
+	}
+	for _, c := range candidates {
+		if c.used {
+			continue
+		}
+		if c.sum == nil {
+			if c.sum, err = fs.checksumOf(fs.tgtFS, c.path, c.info); err != nil {
+				c.used = true
+				continue
+			}
+		}
+		if bytes.Equal(c.sum, sum) {
+			c.used = true
+			return c
+		}
+	}
+	return nil
+}
+
+// moveOrphan renames the orphan at from to the target of job and
+// gives it the source's metadata, as a copy would have.
+func (fs *FileSync) moveOrphan(from string, job *fileJob) error {
+	if err := fs.makeDir(filepath.Dir(job.targetPath)); err != nil {
+		return err
+	}
+	if err := fs.tgtFS.Rename(from, job.targetPath); err != nil {
+		return err
+	}
+	if mode := fs.copyMode(job.targetPath, job.srcInfo); mode != 0 {
+		if err := fs.tgtFS.Chmod(job.targetPath, mode); err != nil {
+			return err
+		}
+	}
+	if fs.preserveModTime() {
+		return fs.tgtFS.Chtimes(job.targetPath, job.srcInfo.ModTime(), job.srcInfo.ModTime())
+	}
+	return nil
+}
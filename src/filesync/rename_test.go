@@ -0,0 +1,63 @@
+package filesync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileSync_DetectRenames(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		mem := NewMemFS()
+		mem.WriteFile("/src/new/big.bin", []byte("large contents"), modTime)
+		mem.WriteFile("/src/fresh.bin", []byte("other contents"), modTime)
+		mem.WriteFile("/dst/old/big.bin", []byte("large contents"), modTime.Add(-time.Hour))
+		mem.WriteFile("/dst/stale.bin", []byte("stale contents"), modTime)
+
+		fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem),
+			WithDetectRenames(true), WithDryRun(dryRun))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatalf("SyncDirs() with dry run %v = %v", dryRun, err)
+		}
+		stats := fs.Stats()
+		// The same-sized stale file differs, so fresh.bin is copied
+		if stats.FilesRenamed != 1 || stats.FilesCopied != 1 || stats.FilesDeleted != 1 {
+			t.Errorf("dry run %v: renamed %d, copied %d, deleted %d; want 1 each",
+				dryRun, stats.FilesRenamed, stats.FilesCopied, stats.FilesDeleted)
+		}
+		if dryRun {
+			if _, err := mem.Stat("/dst/old/big.bin"); err != nil {
+				t.Errorf("dry run moved the orphan: %v", err)
+			}
+			continue
+		}
+		data, err := mem.ReadFile("/dst/new/big.bin")
+		if err != nil || string(data) != "large contents" {
+			t.Errorf("renamed file = %q, %v", data, err)
+		}
+		if info, err := mem.Stat("/dst/new/big.bin"); err != nil || !info.ModTime().Equal(modTime) {
+			t.Errorf("renamed file not given the source mod time: %v", err)
+		}
+		if _, err := mem.Stat("/dst/old/big.bin"); err == nil {
+			t.Error("orphan still at its old path")
+		}
+	}
+}
+
+func TestFileSync_DetectRenamesNeedsDelete(t *testing.T) {
+	mem := NewMemFS()
+	mem.WriteFile("/src/new.bin", []byte("contents"), time.Now())
+	mem.WriteFile("/dst/old.bin", []byte("contents"), time.Now())
+
+	// Without delete-missing the orphan is kept, so it is not moved
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithDetectRenames(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesRenamed != 0 || stats.FilesCopied != 1 {
+		t.Errorf("renamed %d, copied %d; want 0 and 1", stats.FilesRenamed, stats.FilesCopied)
+	}
+	if _, err := mem.Stat("/dst/old.bin"); err != nil {
+		t.Errorf("orphan gone: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package filesync
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"os"
+	"strings"
+)
+
+// RepairReport is the outcome of RepairMetadata. All paths are relative
+// to the source/target roots, in walk order.
+type RepairReport struct {
+	Repaired  int // entries whose mode, owner or mod time was fixed
+	Unchanged int // entries whose metadata already matched
+
+	// NeedsCopy lists the entries whose content cannot be assumed
+	// correct: missing from the target, of another type there, or
+	// files of another size. They are left for a real sync.
+	NeedsCopy []string
+
+	// Errors holds the entries that could not be checked or fixed, as
+	// a *MetadataError, *StatError or *WalkError.
+	Errors []error
+}
+
+// RepairMetadata reconciles the metadata of an existing copy without
+// copying any data, e.g. after a botched chmod or chown of the target.
+// Every file present on both sides with the same size is assumed to
+// have the right content, and only its permission bits, owner and mod
+// time are set to match the source; directories get their mode and
+// owner fixed. WithFileMode, WithModeRule, WithDirMode and
+// WithPermissionsFrom are honored as in a sync. Owners are compared by
+// numeric id and only fixed when both sides report one. File contents
+// are never read. In dry-run mode the fixes are only logged and
+// counted.
+//
+// Per-entry problems are collected in the report; the returned error
+// is for failures to connect and for ctx being cancelled.
+func (fs *FileSync) RepairMetadata(ctx context.Context) (*RepairReport, error) {
+	if err := fs.connect(); err != nil {
+		return nil, err
+	}
+	if err := fs.loadPermissionsRef(); err != nil {
+		return nil, err
+	}
+
+	scan := &VerifyReport{}
+	trees := fs.sourceTrees()
+	perSource := make([][]*verifyItem, len(trees))
+	for i, tree := range trees {
+		items, err := fs.verifySource(ctx, tree, scan)
+		if err != nil {
+			return nil, err
+		}
+		perSource[i] = items
+	}
+	items := mergeByPath(perSource, func(it *verifyItem) string { return it.relPath }, fs.firstSourceWins)
+
+	report := &RepairReport{Errors: scan.Errors}
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		switch {
+		case item.unusable, item.srcInfo.Mode()&os.ModeSymlink != 0:
+		case item.tgtInfo == nil, item.reason != "",
+			!item.srcInfo.IsDir() && item.srcInfo.Size() != item.tgtInfo.Size():
+			report.NeedsCopy = append(report.NeedsCopy, item.relPath)
+		default:
+			fixed, err := fs.repairEntry(item)
+			switch {
+			case err != nil:
+				log.Printf("❌ Failed to fix metadata of %q: %v", item.tgtPath, err)
+				report.Errors = append(report.Errors, &MetadataError{Path: item.tgtPath, Err: err})
+			case fixed:
+				report.Repaired++
+			default:
+				report.Unchanged++
+			}
+		}
+	}
+	return report, nil
+}
+
+// repairEntry gives the target of item the source's mode, owner and
+// mod time where they differ, and reports whether anything did.
+func (fs *FileSync) repairEntry(item *verifyItem) (bool, error) {
+	src, tgt := item.srcInfo, item.tgtInfo
+	var fixes []string
+
+	mode := cmp.Or(fs.targetFileMode(item.tgtPath), src.Mode().Perm())
+	if src.IsDir() {
+		mode = cmp.Or(fs.targetDirMode(), src.Mode().Perm())
+	}
+	fixMode := tgt.Mode().Perm() != mode.Perm()
+	if fixMode {
+		fixes = append(fixes, "mode")
+	}
+
+	uid, gid, owned := fileOwner(src)
+	if fs.chownTargets() {
+		uid, gid, owned = fs.refPerms.uid, fs.refPerms.gid, true
+	}
+	tgtUID, tgtGID, tgtOwned := fileOwner(tgt)
+	c, canChown := fs.tgtFS.(chowner)
+	fixOwner := owned && tgtOwned && canChown && (uid != tgtUID || gid != tgtGID)
+	if fixOwner {
+		fixes = append(fixes, "owner")
+	}
+
+	fixTime := !src.IsDir() && fs.preserveModTime() && !sameModTime(src.ModTime(), tgt.ModTime(), fs.timeTolerance)
+	if fixTime {
+		fixes = append(fixes, "mod time")
+	}
+
+	if len(fixes) == 0 {
+		return false, nil
+	}
+	if fs.dryRun {
+		log.Printf("🔎 Would fix %s: %q", strings.Join(fixes, ", "), item.tgtPath)
+		return true, nil
+	}
+	if fixOwner {
+		// Before the mode, since a chown may clear setuid bits
+		if err := c.Chown(item.tgtPath, uid, gid); err != nil {
+			return false, err
+		}
+	}
+	if fixMode {
+		if err := fs.tgtFS.Chmod(item.tgtPath, mode); err != nil {
+			return false, err
+		}
+	}
+	if fixTime {
+		if err := fs.tgtFS.Chtimes(item.tgtPath, src.ModTime(), src.ModTime()); err != nil {
+			return false, err
+		}
+	}
+	log.Printf("🩹 Fixed %s: %q", strings.Join(fixes, ", "), item.tgtPath)
+	return true, nil
+}
@@ -0,0 +1,87 @@
+//go:build unix
+
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileSync_RepairMetadata(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// Same size, drifted mode, owner and mod time; the differing
+	// content proves no data is copied
+	writeTestFile(t, filepath.Join(src, "run.sh"), "a", base)
+	writeTestFile(t, filepath.Join(dst, "run.sh"), "b", base.Add(time.Hour))
+	if err := os.Chmod(filepath.Join(src, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dst, "run.sh"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	chown := os.Chown(filepath.Join(dst, "run.sh"), 1234, 5678) == nil
+	writeTestFile(t, filepath.Join(src, "ok.txt"), "ok", base)
+	writeTestFile(t, filepath.Join(dst, "ok.txt"), "ok", base)
+	for _, root := range []string{src, dst} {
+		if err := os.Chmod(filepath.Join(root, "ok.txt"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(src, "grown.txt"), "longer", base)
+	writeTestFile(t, filepath.Join(dst, "grown.txt"), "short", base)
+	writeTestFile(t, filepath.Join(src, "new.txt"), "new", base)
+
+	t.Run("dry run", func(t *testing.T) {
+		report, err := NewFileSync(src, dst, false, WithDryRun(true)).RepairMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Repaired != 1 {
+			t.Errorf("Repaired = %d, want 1", report.Repaired)
+		}
+		info, _ := os.Stat(filepath.Join(dst, "run.sh"))
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("dry run changed the mode to %o", info.Mode().Perm())
+		}
+	})
+
+	report, err := NewFileSync(src, dst, false).RepairMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Repaired != 1 || report.Unchanged != 1 || len(report.Errors) != 0 {
+		t.Errorf("report = %+v, want 1 repaired and 1 unchanged", report)
+	}
+	if want := []string{"grown.txt", "new.txt"}; !reflect.DeepEqual(report.NeedsCopy, want) {
+		t.Errorf("NeedsCopy = %v, want %v", report.NeedsCopy, want)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0755 {
+		t.Errorf("run.sh mode %o, want 0755", got)
+	}
+	if !info.ModTime().Equal(base) {
+		t.Errorf("run.sh mod time %v, want %v", info.ModTime(), base)
+	}
+	if st := info.Sys().(*syscall.Stat_t); chown && (st.Uid == 1234 || st.Gid == 5678) {
+		t.Errorf("run.sh owner %d:%d was not restored", st.Uid, st.Gid)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "run.sh")); got != "b" {
+		t.Errorf("run.sh content %q, want the untouched target data", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "new.txt")); !os.IsNotExist(err) {
+		t.Error("new.txt should not have been copied")
+	}
+}
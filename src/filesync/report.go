@@ -0,0 +1,300 @@
+package filesync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// writeReport writes the WithReportFile audit report for the run that
+// started at start and ended with runErr. The file is replaced
+// atomically, so a reader never sees half a report.
+func (fs *FileSync) writeReport(start time.Time, runErr error) error {
+	if fs.reportFile == "" {
+		return nil
+	}
+	end := time.Now()
+	stats := fs.stats
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "# Sync report\n\n")
+	fmt.Fprintf(&b, "- Started: %s\n", start.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Finished: %s\n", end.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Duration: %s\n", end.Sub(start).Round(time.Millisecond))
+	for _, source := range append([]string{fs.source}, fs.extraSources...) {
+		fmt.Fprintf(&b, "- Source: %s\n", source)
+	}
+	fmt.Fprintf(&b, "- Target: %s\n", fs.target)
+	for _, target := range fs.extraTargets {
+		fmt.Fprintf(&b, "- Also synced to: %s (not covered below)\n", target)
+	}
+	switch {
+	case errors.Is(runErr, ErrTooManyErrors):
+		fmt.Fprintf(&b, "- Result: aborted after %d error(s), the error threshold\n", len(stats.Errors))
+	case runErr != nil:
+		fmt.Fprintf(&b, "- Result: failed: %v\n", runErr)
+	case len(stats.Errors) > 0:
+		fmt.Fprintf(&b, "- Result: completed with %d error(s)\n", len(stats.Errors))
+	case fs.dryRun:
+		fmt.Fprintf(&b, "- Result: dry run, no changes were made\n")
+	default:
+		fmt.Fprintf(&b, "- Result: success\n")
+	}
+	if stats.FullCheck {
+		fmt.Fprintf(&b, "- Check: full content comparison\n")
+	}
+	if stats.TreeHash != "" {
+		fmt.Fprintf(&b, "- Tree hash: %s\n", stats.TreeHash)
+	}
+
+	fmt.Fprintf(&b, "\n## Options\n\n")
+	options := fs.reportOptions()
+	if len(options) == 0 {
+		fmt.Fprintf(&b, "- defaults\n")
+	}
+	for _, option := range options {
+		fmt.Fprintf(&b, "- %s\n", option)
+	}
+
+	fmt.Fprintf(&b, "\n## Summary\n\n")
+	fmt.Fprintf(&b, "| | Count |\n|---|---:|\n")
+	for _, row := range []struct {
+		label string
+		n     int
+	}{
+		{"Files copied or updated", stats.FilesCopied},
+		{"Files skipped, up to date", stats.FilesSkipped},
+		{"Files deleted", stats.FilesDeleted},
+		{"Files renamed", stats.FilesRenamed},
+		{"Files hard-linked", stats.FilesLinked + stats.FilesDeduped},
+		{"Files skipped by owner", stats.FilesByOwner},
+		{"Files skipped, not in the target", stats.FilesNotInTarget},
+		{"Directories created", stats.DirsCreated},
+		{"Directories deleted", stats.DirsDeleted},
+		{"Errors", len(stats.Errors)},
+	} {
+		fmt.Fprintf(&b, "| %s | %d |\n", row.label, row.n)
+	}
+	fmt.Fprintf(&b, "| Bytes copied | %d |\n", stats.BytesCopied)
+	bytesAdded, bytesFreed := ByteImpact(fs.actions)
+	fmt.Fprintf(&b, "| Bytes added to the target | %d |\n", bytesAdded)
+	fmt.Fprintf(&b, "| Bytes freed on the target | %d |\n", bytesFreed)
+	if fs.autoWorkers {
+		fmt.Fprintf(&b, "| Comparison workers, auto-tuned | %d |\n", stats.Workers)
+	}
+	if fs.loadThrottle != nil {
+		fmt.Fprintf(&b, "| Copies held back for load | %s |\n", stats.LoadThrottled.Round(time.Second))
+	}
+	if fs.clockCheck > 0 && !fs.dryRun {
+		fmt.Fprintf(&b, "| Target clock skew | %s |\n", stats.ClockSkew)
+	}
+
+	var added, modified, deleted []string
+	for _, a := range fs.actions {
+		name := filepath.ToSlash(a.Path)
+		if a.IsDir {
+			name += "/"
+		}
+		switch a.Kind {
+		case ActionAdd:
+			added = append(added, name)
+		case ActionModify:
+			if a.Reason != "" {
+				name += fmt.Sprintf(" (%s)", a.Reason)
+			}
+			modified = append(modified, name)
+		case ActionDelete:
+			deleted = append(deleted, name)
+		}
+	}
+	reportSection(&b, "Copied", added)
+	reportSection(&b, "Updated", modified)
+	reportSection(&b, "Deleted", deleted)
+	reportSection(&b, "Skipped, locked", stats.Locked)
+	reportSection(&b, "Skipped by the before-copy hook", stats.Vetoed)
+	reportSection(&b, "Failed validation", stats.Invalid)
+	reportSection(&b, "Skipped broken symlinks", stats.BrokenSymlinks)
+	reportSection(&b, "Skipped symlink cycles", stats.SymlinkCycles)
+	reportSection(&b, "Skipped special files", stats.Special)
+	reportSection(&b, "Skipped, same file as the source", stats.SameFile)
+	reportSection(&b, "Spared, changed during the run", stats.Spared)
+	reportSection(&b, "Protected from deletion", stats.Protected)
+	reportSection(&b, "Kept by the delete policy", stats.KeptByPolicy)
+	reportSection(&b, "Moved to the trash by the delete policy", stats.BackedUp)
+	reportSection(&b, "Orphans left for review", stats.ForReview)
+	reportSection(&b, "Kept, not confirmed gone from the source", stats.Unconfirmed)
+	reportSection(&b, "Empty placeholders, not copied", stats.Placeholders)
+	reportSection(&b, "Skipped, over the size cap", stats.OverCap)
+	reportSection(&b, "Evicted to stay under the size cap", stats.Evicted)
+	reportSection(&b, "Conflicts", stats.Conflicts)
+	var errs []string
+	for _, err := range stats.Errors {
+		errs = append(errs, err.Error())
+	}
+	reportSection(&b, "Errors", errs)
+
+	tmp := fs.reportFile + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("report file: %w", err)
+	}
+	if err := os.Rename(tmp, fs.reportFile); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("report file: %w", err)
+	}
+	return nil
+}
+
+// reportSection writes a list of items under a heading, or nothing
+// if there are none.
+func reportSection(b *bytes.Buffer, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %s (%d)\n\n", title, len(items))
+	for _, item := range items {
+		// Keep odd names on one line
+		fmt.Fprintf(b, "- %s\n", strings.ReplaceAll(item, "\n", `\n`))
+	}
+}
+
+// reportOptions names the settings of the run that differ from the
+// defaults, for the report.
+func (fs *FileSync) reportOptions() []string {
+	var options []string
+	flag := func(on bool, name string) {
+		if on {
+			options = append(options, name)
+		}
+	}
+	flag(fs.deleteMissing, "delete missing")
+	flag(fs.deletePreexistingOnly, "delete preexisting only")
+	flag(fs.deleteMissing && fs.deleteFirst, "delete first")
+	flag(fs.deleteMissing && fs.deleteFirstPerDir && !fs.deleteFirst, "delete first per directory")
+	flag(fs.detectRenames, "detect renames")
+	flag(fs.deleteMissing && fs.streaming, "streaming delete pass")
+	flag(fs.dryRun, "dry run")
+	flag(fs.checksum, "checksum comparison")
+	flag(fs.contentOnly, "content only")
+	flag(fs.mmapCompare, "mmap comparison")
+	flag(fs.updateOnly, "update only")
+	flag(fs.existingOnly, "existing files only")
+	flag(fs.noDowngrade, "no downgrade")
+	flag(fs.atomicCopy, "atomic copies")
+	flag(fs.resume, "resume")
+	flag(fs.journal, "journal")
+	flag(fs.trash, "trash")
+	flag(fs.acls, "ACLs")
+	flag(fs.autoWorkers, "auto-tuned workers")
+	flag(fs.fileCaps, "file capabilities")
+	flag(fs.altStreams, "alternate streams")
+	flag(fs.fileFlags, "file flags")
+	flag(fs.loadThrottle != nil, "load throttle")
+	flag(fs.deletePolicy != nil, "delete policy")
+	flag(fs.snapshot, "snapshot")
+	flag(fs.swap, "swap")
+	flag(fs.bidirectional, "two-way")
+	flag(fs.cas, "content-addressable store")
+	flag(fs.preserveSymlinks, "preserve symlinks")
+	flag(fs.followSymlinks, "follow symlinks")
+	flag(fs.preservePerms, "preserve permissions")
+	flag(fs.preserveOwner, "preserve owner")
+	flag(fs.preserveBirthTime, "preserve birth times")
+	flag(fs.dedup, "dedup")
+	flag(fs.dirsOnly, "directories only")
+	flag(fs.pruneEmptyDirs, "prune empty directories")
+	flag(fs.noEmptyDirs, "no empty directories")
+	flag(fs.emptyPlaceholders, "empty placeholders")
+	flag(fs.oneFileSystem, "one file system")
+	flag(fs.failOnAccessError, "fail on access error")
+	if len(fs.excludes) > 0 {
+		options = append(options, fmt.Sprintf("%d exclude pattern(s)", len(fs.excludes)))
+	}
+	if len(fs.includes) > 0 {
+		options = append(options, fmt.Sprintf("%d include pattern(s)", len(fs.includes)))
+	}
+	if len(fs.protects) > 0 {
+		options = append(options, fmt.Sprintf("%d protect pattern(s)", len(fs.protects)))
+	}
+	if fs.fingerprintCmd != "" {
+		options = append(options, "fingerprint command "+fs.fingerprintCmd)
+	}
+	if algo := fs.hashAlgorithm(); algo != defaultHashAlgorithm {
+		options = append(options, "hash algorithm "+algo)
+	}
+	if fs.manifestPath != "" {
+		options = append(options, "manifest "+fs.manifestPath)
+	}
+	flag(fs.manifestCompare, "compare against the manifest")
+	if fs.stripPrefix != "" {
+		options = append(options, "strip prefix "+filepath.ToSlash(fs.stripPrefix))
+	}
+	if fs.shardCount > 1 {
+		options = append(options, fmt.Sprintf("shard %d/%d", fs.shardIndex, fs.shardCount))
+	}
+	if len(fs.extensions) > 0 {
+		options = append(options, fmt.Sprintf("%d extension(s)", len(fs.extensions)))
+	}
+	if fs.contentMatch != nil {
+		options = append(options, fmt.Sprintf("content matching %q in the first %d bytes", fs.contentMatch, fs.contentMatchBytes))
+	}
+	if !fs.modifiedSince.IsZero() {
+		options = append(options, "modified since "+fs.modifiedSince.Format(time.RFC3339))
+	}
+	if fs.accessedSince > 0 {
+		options = append(options, "accessed within "+fs.accessedSince.String())
+	}
+	if n := len(fs.excludeOwners) + len(fs.excludeGroups); n > 0 {
+		options = append(options, fmt.Sprintf("%d excluded owner(s) or group(s)", n))
+	}
+	if fs.timeTolerance > 0 {
+		options = append(options, "time tolerance "+fs.timeTolerance.String())
+	}
+	if fs.verifyEvery > 0 {
+		options = append(options, fmt.Sprintf("full check every %d runs", fs.verifyEvery))
+	}
+	if fs.quickHash > 0 && !fs.byContent() {
+		options = append(options, fmt.Sprintf("quick hash of %d KiB at each end", fs.quickHash))
+	}
+	if fs.heartbeatEvery > 0 {
+		options = append(options, fmt.Sprintf("heartbeat every %d files", fs.heartbeatEvery))
+	}
+	if fs.rateLimit > 0 {
+		options = append(options, fmt.Sprintf("rate limit %d bytes/s", fs.rateLimit))
+	}
+	if len(fs.rateSchedule) > 0 {
+		options = append(options, fmt.Sprintf("rate schedule of %d window(s)", len(fs.rateSchedule)))
+	}
+	if fs.maxOpenFiles > 0 {
+		options = append(options, fmt.Sprintf("at most %d open file pair(s)", fs.maxOpenFiles))
+	}
+	if fs.maxPerDir > 0 {
+		options = append(options, fmt.Sprintf("at most %d file(s) per directory at once", fs.maxPerDir))
+	}
+	if fs.maxFiles > 0 {
+		options = append(options, fmt.Sprintf("at most %d files", fs.maxFiles))
+	}
+	if fs.maxErrors > 0 {
+		options = append(options, fmt.Sprintf("abort after %d errors", fs.maxErrors))
+	}
+	if fs.deleteMissing && fs.dropGuard > 0 {
+		options = append(options, fmt.Sprintf("no delete pass below %g of the last source count", fs.dropGuard))
+	}
+	if fs.deleteMissing && fs.deleteOlderThan > 0 {
+		options = append(options, fmt.Sprintf("orphans deleted once modified %s ago", fs.deleteOlderThan))
+	}
+	if fs.sizeCap > 0 {
+		entry := fmt.Sprintf("target size cap of %d bytes", fs.sizeCap)
+		if fs.evict {
+			entry += ", evicting least recently used files"
+		}
+		options = append(options, entry)
+	}
+	if fs.copyOrder != Natural {
+		options = append(options, fmt.Sprintf("%s files copied first", fs.copyOrder))
+	}
+	return options
+}
@@ -0,0 +1,49 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_ReportFile(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	reportPath := filepath.Join(tmp, "report.md")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "new.txt"), "new", old)
+	writeTestFile(t, filepath.Join(src, "changed.txt"), "changed!", old)
+	writeTestFile(t, filepath.Join(dst, "changed.txt"), "old", old)
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", old)
+
+	fs := NewFileSync(src, dst, true, WithReportFile(reportPath), WithTreeHash(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+	for _, want := range []string{
+		"- Source: " + src,
+		"- Target: " + dst,
+		"- Result: success",
+		"- Tree hash: " + fs.Stats().TreeHash,
+		"- delete missing",
+		"| Files copied or updated | 2 |",
+		"## Copied (1)\n\n- new.txt\n",
+		"## Updated (1)\n\n- changed.txt (size)\n",
+		"## Deleted (1)\n\n- orphan.txt\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+	if _, err := os.Stat(reportPath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary report left behind: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package filesync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// retentionStateName is the default state file name, placed in the target.
+const retentionStateName = ".filesync-retention.json"
+
+// retentionState records when each orphaned target path
+// (relative to the target root) was first seen missing from source,
+// and in how many runs in a row it has been missing since.
+type retentionState struct {
+	FirstSeen map[string]time.Time `json:"first_seen"`
+	Runs      map[string]int       `json:"runs,omitempty"`
+
+	// next and nextRuns collect orphans seen in the current run;
+	// entries that were not seen again (restored in source or
+	// deleted) are dropped when the state is saved.
+	next     map[string]time.Time
+	nextRuns map[string]int
+}
+
+// retainsOrphans reports whether orphans wait out a retention period
+// before being deleted (see WithDeleteRetention and
+// WithDeleteRetentionRuns).
+func (fs *FileSync) retainsOrphans() bool {
+	return fs.deleteRetention > 0 || fs.retentionRuns > 0
+}
+
+// retentionFile returns the path of the retention state file.
+func (fs *FileSync) retentionFile() string {
+	if fs.retentionStatePath != "" {
+		return fs.retentionStatePath
+	}
+	return filepath.Join(fs.target, retentionStateName)
+}
+
+// loadRetentionState reads the state file at path on fsys.
+// A missing file yields an empty state.
+func loadRetentionState(fsys FS, path string) (*retentionState, error) {
+	st := &retentionState{
+		FirstSeen: map[string]time.Time{},
+		Runs:      map[string]int{},
+		next:      map[string]time.Time{},
+		nextRuns:  map[string]int{},
+	}
+	data, err := readFile(fsys, path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, err
+	}
+	if st.FirstSeen == nil {
+		st.FirstSeen = map[string]time.Time{}
+	}
+	if st.Runs == nil {
+		st.Runs = map[string]int{}
+	}
+	return st, nil
+}
+
+// due reports whether the orphan relPath has been missing for at
+// least d as of now and in at least runs runs, this one included.
+// Every orphan is remembered for the next run; call forget once it has
+// actually been removed.
+func (st *retentionState) due(relPath string, now time.Time, d time.Duration, runs int) bool {
+	first, ok := st.FirstSeen[relPath]
+	if !ok {
+		first = now
+	}
+	st.next[relPath] = first
+	st.nextRuns[relPath] = st.Runs[relPath] + 1
+	return now.Sub(first) >= d && st.nextRuns[relPath] >= runs
+}
+
+// keep carries the entry of relPath over to the next run unchanged.
+func (st *retentionState) keep(relPath string, first time.Time) {
+	st.next[relPath] = first
+	if n, ok := st.Runs[relPath]; ok {
+		st.nextRuns[relPath] = n
+	}
+}
+
+// keepOutside carries over the entries that lie outside scope, for
+// delete passes that only look at part of the target.
+func (st *retentionState) keepOutside(scope string) {
+	if scope == "." {
+		return
+	}
+	for relPath, first := range st.FirstSeen {
+		if !withinScope(relPath, scope) {
+			st.keep(relPath, first)
+		}
+	}
+}
+
+// keepBelow carries over the entries in subdirectories of scope, for
+// delete passes that only look at the entries directly in it.
+func (st *retentionState) keepBelow(scope string) {
+	for relPath, first := range st.FirstSeen {
+		if withinScope(relPath, scope) && filepath.Dir(relPath) != scope {
+			st.keep(relPath, first)
+		}
+	}
+}
+
+// forget drops relPath from the state after it has been deleted.
+func (st *retentionState) forget(relPath string) {
+	delete(st.next, relPath)
+	delete(st.nextRuns, relPath)
+}
+
+// save atomically replaces the state file at path on fsys with the
+// orphans that are still pending deletion.
+func (st *retentionState) save(fsys FS, path string) error {
+	data, err := json.MarshalIndent(retentionState{FirstSeen: st.next, Runs: st.nextRuns}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := writeFile(fsys, tmp, data); err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, path)
+}
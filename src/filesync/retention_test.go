@@ -0,0 +1,147 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_DeleteRetentionKeepsRecentOrphans(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep", time.Now())
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", time.Now())
+
+	fs := NewFileSync(src, dst, true, WithDeleteRetention(time.Hour))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "orphan.txt")); err != nil {
+		t.Error("expected orphan.txt to be retained")
+	}
+	st, err := loadRetentionState(LocalFS(), filepath.Join(dst, retentionStateName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.FirstSeen["orphan.txt"]; !ok {
+		t.Error("expected orphan.txt to be recorded in retention state")
+	}
+}
+
+func TestFileSync_DeleteRetentionExpires(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	statePath := filepath.Join(tmp, "state.json")
+
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep", time.Now())
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", time.Now())
+
+	// pretend the orphan was first seen two hours ago
+	st := &retentionState{next: map[string]time.Time{
+		"orphan.txt": time.Now().Add(-2 * time.Hour),
+	}}
+	if err := st.save(LocalFS(), statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileSync(src, dst, true,
+		WithDeleteRetention(time.Hour),
+		WithRetentionStateFile(statePath),
+	)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "orphan.txt")); !os.IsNotExist(err) {
+		t.Error("expected orphan.txt to be deleted after retention")
+	}
+	st, err := loadRetentionState(LocalFS(), statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.FirstSeen) != 0 {
+		t.Errorf("expected empty retention state, got %v", st.FirstSeen)
+	}
+}
+
+func TestFileSync_DeleteOlderThan(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep", now)
+	writeTestFile(t, filepath.Join(dst, "fresh.txt"), "fresh", now.Add(-time.Hour))
+	writeTestFile(t, filepath.Join(dst, "sub", "fresh.txt"), "fresh", now.Add(-time.Minute))
+	writeTestFile(t, filepath.Join(dst, "stale.txt"), "stale", now.Add(-48*time.Hour))
+	writeTestFile(t, filepath.Join(dst, "sub", "stale.txt"), "stale", now.Add(-72*time.Hour))
+
+	fs := NewFileSync(src, dst, true, WithDeleteOlderThan(24*time.Hour))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"fresh.txt", filepath.Join("sub", "fresh.txt")} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("recent orphan %s was deleted", name)
+		}
+	}
+	for _, name := range []string{"stale.txt", filepath.Join("sub", "stale.txt")} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("old orphan %s was kept", name)
+		}
+	}
+	if got := fs.Stats().FilesDeleted; got != 2 {
+		t.Errorf("FilesDeleted = %d, want 2", got)
+	}
+}
+
+func TestFileSync_DeleteRetentionRuns(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep", time.Now())
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", time.Now())
+	writeTestFile(t, filepath.Join(dst, "back.txt"), "back", time.Now())
+
+	sync := func() {
+		t.Helper()
+		if err := NewFileSync(src, dst, true, WithDeleteRetentionRuns(3)).SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dst, name))
+		return err == nil
+	}
+
+	sync()
+	sync()
+	if !exists("orphan.txt") {
+		t.Fatal("orphan.txt was deleted after two runs, want three")
+	}
+
+	// A file back in the source for a run starts counting over
+	writeTestFile(t, filepath.Join(src, "back.txt"), "back", time.Now())
+	sync()
+	if exists("orphan.txt") {
+		t.Error("orphan.txt was kept after three runs")
+	}
+	if err := os.Remove(filepath.Join(src, "back.txt")); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	sync()
+	if !exists("back.txt") {
+		t.Error("back.txt was deleted two runs after it left the source again")
+	}
+	sync()
+	if exists("back.txt") {
+		t.Error("back.txt was kept three runs after it left the source again")
+	}
+}
@@ -0,0 +1,259 @@
+package filesync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Files in a session's state directory.
+const (
+	sessionConfigName     = "config.yaml"
+	sessionStateName      = "state.json"
+	sessionCheckpointName = "checkpoint"
+)
+
+// SessionsDir returns the directory sessions keep their state in, one
+// subdirectory per session: filesync/sessions in os.UserConfigDir,
+// such as ~/.config/filesync/sessions on Linux.
+func SessionsDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "filesync", "sessions"), nil
+}
+
+// Session is a named, resumable sync job for migrations that take
+// several runs, possibly days apart: its config and progress are kept
+// in its directory below SessionsDir, so a later process can pick it
+// up by name. Each Run continues where the last one stopped, using
+// WithCheckpoint, until a run completes the sync.
+type Session struct {
+	name string
+	dir  string
+	cfg  *Config
+	opts []Option
+}
+
+// SessionStatus is the progress of a session, see Session.Status.
+type SessionStatus struct {
+	Name      string    `json:"name"`
+	Created   time.Time `json:"created"`
+	LastRun   time.Time `json:"last_run,omitzero"`
+	Runs      int       `json:"runs"`
+	Completed bool      `json:"completed"` // the last run finished the sync
+	LastError string    `json:"last_error,omitempty"`
+
+	// FilesCopied and BytesCopied add up the copies of every run.
+	FilesCopied int   `json:"files_copied"`
+	BytesCopied int64 `json:"bytes_copied"`
+
+	// FilesDone is how many files the current, unfinished sync has
+	// recorded in its checkpoint so far; the checkpoint is flushed
+	// periodically, so it may lag behind. It is zero once a run
+	// completed, and when the options name a checkpoint of their own.
+	FilesDone int `json:"-"`
+}
+
+// NewSession creates the session name for the job cfg describes, or
+// opens it if it exists: a nil cfg resumes with the stored config,
+// while a new one replaces it. The opts are applied on top of the
+// config on every Run, for what a config cannot hold such as hooks;
+// they are not stored, so pass them again when resuming. Relative
+// paths in cfg are stored made absolute, so resuming from another
+// working directory syncs the same trees. A session needs a single
+// target, and the name must be usable as a directory name.
+func NewSession(name string, cfg *Config, opts ...Option) (*Session, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid session name %q", name)
+	}
+	root, err := SessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{name: name, dir: filepath.Join(root, name), opts: opts}
+
+	if cfg == nil {
+		if s.cfg, err = LoadConfig(filepath.Join(s.dir, sessionConfigName)); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("no session %q and no config to create it with", name)
+			}
+			return nil, err
+		}
+		return s, nil
+	}
+	if len(cfg.AlsoTo) > 0 {
+		return nil, errors.New("a session syncs to a single target")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg, err = absConfig(cfg); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, sessionConfigName), data); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, sessionStateName)); os.IsNotExist(err) {
+		if err := s.saveState(&SessionStatus{Name: name, Created: time.Now()}); err != nil {
+			return nil, err
+		}
+	}
+	s.cfg = cfg
+	return s, nil
+}
+
+// absConfig returns a copy of cfg with its local paths made absolute.
+func absConfig(cfg *Config) (*Config, error) {
+	c := *cfg
+	c.Sources = slices.Clone(cfg.Sources)
+	paths := []*string{&c.Target, &c.Manifest, &c.ReportFile, &c.Trace}
+	for i := range c.Sources {
+		paths = append(paths, &c.Sources[i])
+	}
+	for _, p := range paths {
+		if *p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*p)
+		if err != nil {
+			return nil, err
+		}
+		*p = abs
+	}
+	return &c, nil
+}
+
+// Name returns the session's name.
+func (s *Session) Name() string {
+	return s.name
+}
+
+// Dir returns the session's state directory.
+func (s *Session) Dir() string {
+	return s.dir
+}
+
+// Run syncs the session's job until it completes or ctx is done,
+// skipping the files earlier runs finished whose source is unchanged.
+// The checkpoint is kept in the session's directory, unless the
+// session's options set one with WithCheckpoint; Status only counts
+// the files of its own.
+// The outcome is recorded for Status either way; like
+// SyncDirsContext, an interrupted run returns ctx's error and the next
+// Run resumes from there.
+func (s *Session) Run(ctx context.Context) error {
+	state, err := s.loadState()
+	if err != nil {
+		return err
+	}
+	fs, err := NewFileSyncFromConfig(s.cfg, s.opts...)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	// A named checkpoint is a local file, so the session keeps its own
+	// even for a remote target, unless the options name one
+	if fs.checkpointPath == "" {
+		WithCheckpoint(filepath.Join(s.dir, sessionCheckpointName))(fs)
+	}
+
+	runErr := fs.SyncDirsContext(ctx)
+	stats := fs.Stats()
+	if runErr == nil {
+		runErr = stats.Err()
+	}
+	state.Runs++
+	state.LastRun = time.Now()
+	state.Completed = runErr == nil
+	state.LastError = ""
+	if runErr != nil {
+		state.LastError = runErr.Error()
+	}
+	state.FilesCopied += stats.FilesCopied
+	state.BytesCopied += stats.BytesCopied
+	if err := s.saveState(state); err != nil {
+		return errors.Join(runErr, err)
+	}
+	return runErr
+}
+
+// Status returns the progress of the session as its state directory
+// records it, which works while another process runs the session too.
+func (s *Session) Status() (SessionStatus, error) {
+	state, err := s.loadState()
+	if err != nil {
+		return SessionStatus{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, sessionCheckpointName))
+	if err != nil && !os.IsNotExist(err) {
+		return *state, err
+	}
+	done := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry journalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			done[entry.Path] = true
+		}
+	}
+	state.FilesDone = len(done)
+	return *state, scanner.Err()
+}
+
+// Complete ends the session by removing its state directory, typically
+// once Status reports it completed. A later NewSession with a config
+// starts the name afresh.
+func (s *Session) Complete() error {
+	return os.RemoveAll(s.dir)
+}
+
+// loadState reads the session's recorded progress.
+func (s *Session) loadState() (*SessionStatus, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, sessionStateName))
+	if err != nil {
+		return nil, fmt.Errorf("session %q: %w", s.name, err)
+	}
+	state := &SessionStatus{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("session %q: %w", s.name, err)
+	}
+	return state, nil
+}
+
+// saveState replaces the session's recorded progress.
+func (s *Session) saveState(state *SessionStatus) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, sessionStateName), data)
+}
+
+// writeFileAtomic replaces the local file path with data by writing a
+// temporary file next to it and renaming it into place.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,136 @@
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSession_ResumeByName(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "config"))
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+		writeTestFile(t, filepath.Join(src, name), name, time.Now())
+	}
+
+	// The first run is stopped once c.txt is copied
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopAt := WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+		if filepath.Base(src) == "c.txt" {
+			cancel()
+		}
+		return true, nil
+	})
+	s, err := NewSession("migration", &Config{Sources: []string{src}, Target: dst, Workers: 1}, stopAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(ctx); err == nil {
+		t.Fatal("expected the cancelled run to fail")
+	}
+	status, err := s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Runs != 1 || status.Completed || status.LastError == "" {
+		t.Errorf("status after the interruption = %+v", status)
+	}
+	if status.FilesDone != 3 || status.FilesCopied != 3 {
+		t.Errorf("FilesDone = %d, FilesCopied = %d, want 3 and 3", status.FilesDone, status.FilesCopied)
+	}
+
+	// Another process resumes the session by name alone
+	resumed, err := NewSession("migration", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	status, err = resumed.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Runs != 2 || !status.Completed || status.LastError != "" || status.FilesDone != 0 {
+		t.Errorf("status after completing = %+v", status)
+	}
+	if status.FilesCopied != 5 {
+		t.Errorf("FilesCopied = %d over both runs, want 5", status.FilesCopied)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "e.txt")); got != "e.txt" {
+		t.Errorf("e.txt = %q", got)
+	}
+
+	if err := resumed.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(resumed.Dir()); !os.IsNotExist(err) {
+		t.Errorf("expected the session directory to be removed: %v", err)
+	}
+	if _, err := NewSession("migration", nil); err == nil {
+		t.Error("expected resuming a completed session to fail")
+	}
+}
+
+func TestNewSession_InvalidName(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, name := range []string{"", "..", "a/b"} {
+		if _, err := NewSession(name, &Config{Sources: []string{"src"}, Target: "dst"}); err == nil {
+			t.Errorf("NewSession(%q) succeeded", name)
+		}
+	}
+}
+
+func TestSession_RelativePaths(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "config"))
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	writeTestFile(t, filepath.Join(tmp, "work", "src", "a.txt"), "a", time.Now())
+	writeTestFile(t, filepath.Join(tmp, "work", "src", "b.txt"), "b", time.Now())
+	if err := os.MkdirAll(filepath.Join(tmp, "elsewhere"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Created with paths relative to one directory, resumed in another
+	t.Chdir(filepath.Join(tmp, "work"))
+	checkpoint := filepath.Join(tmp, "own-checkpoint")
+	if _, err := NewSession("relative", &Config{Sources: []string{"src"}, Target: "dst", Workers: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(filepath.Join(tmp, "elsewhere"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+		if filepath.Base(src) == "a.txt" {
+			cancel()
+		}
+		return true, nil
+	})
+	s, err := NewSession("relative", nil, WithCheckpoint(checkpoint), stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(ctx); err == nil {
+		t.Fatal("expected the cancelled run to fail")
+	}
+	if got := readTestFile(t, filepath.Join(tmp, "work", "dst", "a.txt")); got != "a" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "elsewhere", "dst")); !os.IsNotExist(err) {
+		t.Error("the resumed session synced relative to the new working directory")
+	}
+
+	// The checkpoint given in the options is used, not the session's
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Errorf("checkpoint of the options: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir(), sessionCheckpointName)); !os.IsNotExist(err) {
+		t.Errorf("session checkpoint written despite WithCheckpoint: %v", err)
+	}
+}
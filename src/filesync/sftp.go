@@ -0,0 +1,291 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPFS implements FS on top of an SFTP session, so either side of a
+// sync can live on a remote server without mounting it.
+type SFTPFS struct {
+	client *sftp.Client
+	conn   *ssh.Client // nil unless the connection was dialed by DialSFTP
+}
+
+// NewSFTPFS wraps an established SFTP client. Closing the returned FS
+// closes the client.
+func NewSFTPFS(client *sftp.Client) *SFTPFS {
+	return &SFTPFS{client: client}
+}
+
+// DialSFTP connects to the SSH server at addr ("host:port")
+// and starts an SFTP session on it.
+func DialSFTP(addr string, config *ssh.ClientConfig) (*SFTPFS, error) {
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &SFTPFS{client: client, conn: conn}, nil
+}
+
+// Close ends the SFTP session and, if DialSFTP opened it,
+// the underlying SSH connection.
+func (s *SFTPFS) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *SFTPFS) Open(name string) (File, error) {
+	name = remotePath(name)
+	f, err := s.client.Open(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &sftpFile{File: f, client: s.client}, nil
+}
+
+// OpenFile opens name with the given flags. SFTP applies the server's
+// default permissions to new files, so perm is set explicitly after
+// creation.
+func (s *SFTPFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	name = remotePath(name)
+	_, statErr := s.client.Lstat(name)
+	f, err := s.client.OpenFile(name, flag)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if flag&os.O_CREATE != 0 && os.IsNotExist(statErr) {
+		if err := s.client.Chmod(name, perm); err != nil {
+			f.Close()
+			return nil, pathError("chmod", name, err)
+		}
+	}
+	return &sftpFile{File: f, client: s.client}, nil
+}
+
+func (s *SFTPFS) Stat(name string) (os.FileInfo, error) {
+	name = remotePath(name)
+	info, err := s.client.Stat(name)
+	return info, pathError("stat", name, err)
+}
+
+func (s *SFTPFS) Lstat(name string) (os.FileInfo, error) {
+	name = remotePath(name)
+	info, err := s.client.Lstat(name)
+	return info, pathError("lstat", name, err)
+}
+
+func (s *SFTPFS) ReadDir(name string) ([]os.DirEntry, error) {
+	name = remotePath(name)
+	infos, err := s.client.ReadDir(name)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	entries := make([]os.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = dirEntry{info}
+	}
+	return entries, nil
+}
+
+// MkdirAll creates name and any missing parents. The SFTP protocol
+// offers no way to pass a mode on creation, so perm is applied to
+// the directories that were created.
+func (s *SFTPFS) MkdirAll(name string, perm os.FileMode) error {
+	name = remotePath(name)
+	if info, err := s.client.Stat(name); err == nil {
+		if !info.IsDir() {
+			return pathError("mkdir", name, errors.New("not a directory"))
+		}
+		return nil
+	}
+	if parent := path.Dir(name); parent != name {
+		if err := s.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := s.client.Mkdir(name); err != nil {
+		// Lost a race with another creator
+		if info, statErr := s.client.Stat(name); statErr == nil && info.IsDir() {
+			return nil
+		}
+		return pathError("mkdir", name, err)
+	}
+	return pathError("chmod", name, s.client.Chmod(name, perm))
+}
+
+func (s *SFTPFS) Remove(name string) error {
+	name = remotePath(name)
+	return pathError("remove", name, s.client.Remove(name))
+}
+
+func (s *SFTPFS) RemoveAll(name string) error {
+	name = remotePath(name)
+	if _, err := s.client.Lstat(name); os.IsNotExist(err) {
+		return nil
+	}
+	return pathError("remove", name, s.client.RemoveAll(name))
+}
+
+// Rename moves oldname to newname, replacing newname if it exists.
+// Plain SFTP renames refuse to overwrite, so the posix-rename
+// extension is used when the server offers it.
+func (s *SFTPFS) Rename(oldname, newname string) error {
+	oldname, newname = remotePath(oldname), remotePath(newname)
+	if _, ok := s.client.HasExtension("posix-rename@openssh.com"); ok {
+		return linkError("rename", oldname, newname, s.client.PosixRename(oldname, newname))
+	}
+	if err := s.client.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return linkError("rename", oldname, newname, err)
+	}
+	return linkError("rename", oldname, newname, s.client.Rename(oldname, newname))
+}
+
+// Link creates a hard link, which needs the hardlink@openssh.com
+// extension on the server.
+func (s *SFTPFS) Link(oldname, newname string) error {
+	oldname, newname = remotePath(oldname), remotePath(newname)
+	return linkError("link", oldname, newname, s.client.Link(oldname, newname))
+}
+
+func (s *SFTPFS) Chmod(name string, mode os.FileMode) error {
+	name = remotePath(name)
+	return pathError("chmod", name, s.client.Chmod(name, mode))
+}
+
+func (s *SFTPFS) Chown(name string, uid, gid int) error {
+	name = remotePath(name)
+	return pathError("chown", name, s.client.Chown(name, uid, gid))
+}
+
+func (s *SFTPFS) Readlink(name string) (string, error) {
+	name = remotePath(name)
+	dest, err := s.client.ReadLink(name)
+	return dest, pathError("readlink", name, err)
+}
+
+func (s *SFTPFS) Symlink(oldname, newname string) error {
+	oldname, newname = remotePath(oldname), remotePath(newname)
+	return linkError("symlink", oldname, newname, s.client.Symlink(oldname, newname))
+}
+
+// Chtimes sets the access and modification times of name.
+// SFTP stores them with one-second precision.
+func (s *SFTPFS) Chtimes(name string, atime, mtime time.Time) error {
+	name = remotePath(name)
+	return pathError("chtimes", name, s.client.Chtimes(name, atime, mtime))
+}
+
+// remotePath turns name, built with filepath like every path FileSync
+// passes to its filesystems, into the slash-separated form SFTP
+// servers expect, whatever the local OS separator.
+func remotePath(name string) string {
+	return filepath.ToSlash(name)
+}
+
+// sftpEndpoint is a server to dial when a sync first needs it.
+type sftpEndpoint struct {
+	addr   string
+	config *ssh.ClientConfig
+}
+
+// connect dials the SFTP endpoints configured with WithSFTPSource
+// and WithSFTPTarget that are not connected yet, and sets up split
+// files (see WithSplitSize and WithJoinParts) on top.
+// If the target cannot be reached, the source connection just made is
+// closed again, and both are dialed anew on the next attempt.
+func (fs *FileSync) connect() error {
+	var source *SFTPFS
+	if fs.sftpSource != nil {
+		remote, err := DialSFTP(fs.sftpSource.addr, fs.sftpSource.config)
+		if err != nil {
+			return fmt.Errorf("connect to source %s: %w", fs.sftpSource.addr, err)
+		}
+		source = remote
+	}
+	if fs.sftpTarget != nil {
+		remote, err := DialSFTP(fs.sftpTarget.addr, fs.sftpTarget.config)
+		if err != nil {
+			if source != nil {
+				source.Close()
+			}
+			return fmt.Errorf("connect to target %s: %w", fs.sftpTarget.addr, err)
+		}
+		fs.tgtFS = remote
+		fs.sftpTarget = nil
+		fs.connections = append(fs.connections, remote)
+	}
+	if source != nil {
+		fs.srcFS = source
+		fs.sftpSource = nil
+		fs.connections = append(fs.connections, source)
+	}
+	if _, split := fs.tgtFS.(*splitFS); !split && fs.splitSize > 0 {
+		fs.tgtFS = &splitFS{FS: fs.tgtFS, limit: fs.splitSize}
+	}
+	if _, split := fs.srcFS.(*splitFS); !split && fs.joinParts {
+		fs.srcFS = &splitFS{FS: fs.srcFS}
+	}
+	return nil
+}
+
+// Close releases the connections FileSync opened for WithSFTPSource
+// and WithSFTPTarget. It is a no-op for purely local syncs.
+func (fs *FileSync) Close() error {
+	var errs []error
+	for _, remote := range fs.connections {
+		errs = append(errs, remote.Close())
+	}
+	fs.connections = nil
+	return errors.Join(errs...)
+}
+
+// sftpFile is an open remote file.
+type sftpFile struct {
+	*sftp.File
+	client *sftp.Client
+}
+
+// Sync flushes the file on servers that support it; elsewhere it is
+// a no-op, since the SFTP close already hands the data to the server.
+func (f *sftpFile) Sync() error {
+	if _, ok := f.client.HasExtension("fsync@openssh.com"); !ok {
+		return nil
+	}
+	return f.File.Sync()
+}
+
+// pathError wraps a remote error the way the os package reports
+// local ones, so callers can tell which path failed.
+func pathError(op, name string, err error) error {
+	var pathErr *os.PathError
+	if err == nil || errors.As(err, &pathErr) {
+		return err
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// linkError is pathError for operations on two paths.
+func linkError(op, oldname, newname string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &os.LinkError{Op: op, Old: oldname, New: newname, Err: err}
+}
@@ -0,0 +1,103 @@
+package filesync
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// newTestSFTPFS serves the local filesystem over an in-process SFTP
+// server and returns a client FS connected to it.
+func newTestSFTPFS(t *testing.T) *SFTPFS {
+	t.Helper()
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverRead, serverWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := NewSFTPFS(client)
+	t.Cleanup(func() {
+		server.Close()
+		clientWrite.Close()
+		remote.Close()
+	})
+	return remote
+}
+
+func TestFileSync_SFTP(t *testing.T) {
+	modtime := time.Now().Add(-time.Hour)
+
+	cases := []struct {
+		name string
+		opts func(remote FS) []Option
+	}{
+		{"remote target", func(remote FS) []Option { return []Option{WithTargetFS(remote)} }},
+		{"remote source", func(remote FS) []Option { return []Option{WithSourceFS(remote)} }},
+		{"atomic remote target", func(remote FS) []Option {
+			return []Option{WithTargetFS(remote), WithAtomicCopy(true)}
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			writeTestFile(t, filepath.Join(src, "a.txt"), "hello", modtime)
+			writeTestFile(t, filepath.Join(src, "sub", "deep", "b.txt"), "nested", modtime)
+			writeTestFile(t, filepath.Join(dst, "a.txt"), "stale", modtime.Add(-time.Hour))
+			writeTestFile(t, filepath.Join(dst, "orphan.txt"), "gone", modtime)
+
+			fs := NewFileSync(src, dst, true, tc.opts(newTestSFTPFS(t))...)
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if err := fs.Stats().Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			for rel, want := range map[string]string{"a.txt": "hello", "sub/deep/b.txt": "nested"} {
+				data, err := os.ReadFile(filepath.Join(dst, rel))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", rel, data, want)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dst, "orphan.txt")); !os.IsNotExist(err) {
+				t.Errorf("orphan.txt should have been deleted, stat err = %v", err)
+			}
+
+			// SFTP keeps whole seconds only; that must not cause recopies
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if got := fs.Stats().FilesCopied; got != 0 {
+				t.Errorf("second sync copied %d files, want 0", got)
+			}
+		})
+	}
+}
+
+func TestFileSync_SFTPWatchNeedsLocalSource(t *testing.T) {
+	tmp := t.TempDir()
+	fs := NewFileSync(tmp, tmp, false, WithSourceFS(newTestSFTPFS(t)))
+	if err := fs.Watch(t.Context()); err == nil {
+		t.Fatal("expected Watch to refuse a remote source")
+	}
+}
@@ -0,0 +1,79 @@
+package filesync
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// inShard reports whether the file at relPath belongs to this node's
+// WithShard slice of the tree. The path is hashed with forward slashes,
+// so nodes on different platforms agree on the split.
+func (fs *FileSync) inShard(relPath string) bool {
+	if fs.shardCount <= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(filepath.ToSlash(relPath)))
+	return h.Sum64()%uint64(fs.shardCount) == uint64(fs.shardIndex)
+}
+
+// shardFile returns where this node's WithShard slice keeps the state
+// file at path, such as the source count, as every shard has its own:
+// path with the shard before its extension, state.1-of-4.json for the
+// second of four. Without shards it is path itself.
+func (fs *FileSync) shardFile(path string) string {
+	if fs.shardCount <= 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d-of-%d%s", strings.TrimSuffix(path, ext), fs.shardIndex+1, fs.shardCount, ext)
+}
+
+// anyShardFile reports whether path is the state file at file of any
+// shard (see shardFile), or of a run without shards.
+func anyShardFile(path, file string) bool {
+	if samePath(path, file) {
+		return true
+	}
+	ext := filepath.Ext(file)
+	pattern := strings.TrimSuffix(filepath.Base(file), ext) + ".*-of-*" + ext
+	ok, _ := filepath.Match(pattern, filepath.Base(path))
+	return ok && samePath(filepath.Dir(path), filepath.Dir(file))
+}
+
+// checkShard rejects a WithShard index outside 0 to total-1.
+func (fs *FileSync) checkShard() error {
+	if fs.shardCount == 0 && fs.shardIndex == 0 {
+		return nil
+	}
+	if fs.shardCount < 1 || fs.shardIndex < 0 || fs.shardIndex >= fs.shardCount {
+		return fmt.Errorf("shard %d of %d is out of range: the index must be from 0 to the count minus one", fs.shardIndex, fs.shardCount)
+	}
+	return nil
+}
+
+// ParseShard parses a shard as "index/total", such as "0/4" for the
+// first of four shards, for WithShard. Empty is no sharding, 0/0.
+func ParseShard(s string) (index, total int, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, nil
+	}
+	i, n, ok := strings.Cut(s, "/")
+	if ok {
+		index, err = strconv.Atoi(strings.TrimSpace(i))
+		if err == nil {
+			total, err = strconv.Atoi(strings.TrimSpace(n))
+		}
+	}
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("invalid shard %q, want index/total such as 0/4", s)
+	}
+	if total < 1 || index < 0 || index >= total {
+		return 0, 0, fmt.Errorf("invalid shard %q: the index must be from 0 to %d", s, max(total-1, 0))
+	}
+	return index, total, nil
+}
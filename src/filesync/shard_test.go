@@ -0,0 +1,126 @@
+package filesync
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Shard(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	var all []string
+	for i := range 20 {
+		p := fmt.Sprintf("dir%d/file%d.txt", i%3, i)
+		all = append(all, p)
+		mem.WriteFile("/src/"+p, []byte(p), now)
+	}
+
+	// Three nodes sharing one target with delete-missing each copy
+	// their own files and leave the others' alone
+	owner := map[string]int{}
+	for index := range 3 {
+		fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithShard(index, 3))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range fs.PlannedActions() {
+			if a.Kind == ActionDelete {
+				t.Errorf("shard %d deleted %s", index, a.Path)
+			}
+			if a.Kind == ActionAdd && !a.IsDir {
+				if prev, ok := owner[a.Path]; ok {
+					t.Errorf("%s copied by shards %d and %d", a.Path, prev, index)
+				}
+				owner[a.Path] = index
+			}
+		}
+	}
+	for _, p := range all {
+		if _, err := mem.Stat("/dst/" + p); err != nil {
+			t.Errorf("%s missing from the combined target: %v", p, err)
+		}
+	}
+	if len(owner) != len(all) {
+		t.Errorf("%d files copied, want %d", len(owner), len(all))
+	}
+
+	// An orphan is only deleted by the node whose shard it falls in
+	mem.WriteFile("/dst/orphan.txt", []byte("gone"), now)
+	for index := range 3 {
+		fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithShard(index, 3))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		_, err := mem.Stat("/dst/orphan.txt")
+		if fs.inShard("orphan.txt") != (err != nil) {
+			t.Errorf("shard %d: orphan gone = %v, in shard = %v", index, err != nil, fs.inShard("orphan.txt"))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if _, err := mem.Stat("/dst/orphan.txt"); err == nil {
+		t.Error("expected one of the shards to delete the orphan")
+	}
+}
+
+func TestParseShard(t *testing.T) {
+	if i, n, err := ParseShard(" 2/4 "); err != nil || i != 2 || n != 4 {
+		t.Errorf("ParseShard(2/4) = %d, %d, %v", i, n, err)
+	}
+	if i, n, err := ParseShard(""); err != nil || i != 0 || n != 0 {
+		t.Errorf("ParseShard(\"\") = %d, %d, %v", i, n, err)
+	}
+	for _, bad := range []string{"4/4", "-1/4", "1/0", "2", "a/b"} {
+		if _, _, err := ParseShard(bad); err == nil {
+			t.Errorf("ParseShard(%q) succeeded", bad)
+		}
+	}
+	fs := NewFileSync(t.TempDir(), t.TempDir(), false, WithShard(3, 2))
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("expected an error for a shard index out of range")
+	}
+}
+
+func TestFileSync_ShardState(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for i := range 20 {
+		mem.WriteFile(fmt.Sprintf("/src/file%d.txt", i), []byte("x"), now)
+	}
+
+	// Every shard keeps its own source count, which the other shards
+	// do not take for orphans, and its own manifest
+	manifest := filepath.Join(t.TempDir(), "manifest.json")
+	for range 2 {
+		for index := range 3 {
+			fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithShard(index, 3), WithSourceDropGuard(0.5), WithManifest(manifest))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatalf("shard %d: %v", index, err)
+			}
+		}
+	}
+	files := 0
+	for index := range 3 {
+		name := fmt.Sprintf("/dst/.filesync-source-count.%d-of-3.json", index+1)
+		if _, err := mem.Stat(name); err != nil {
+			t.Errorf("shard %d: %v", index, err)
+		}
+		m, err := readManifest(fmt.Sprintf("%s.%d-of-3.json", strings.TrimSuffix(manifest, ".json"), index+1))
+		if err != nil {
+			t.Fatalf("shard %d: %v", index, err)
+		}
+		files += len(m.Files)
+	}
+	if files != 20 {
+		t.Errorf("the shard manifests list %d files, want 20", files)
+	}
+
+	fs := NewFileSync("/src", "/cas", true, WithSourceFS(mem), WithTargetFS(mem), WithShard(0, 3), WithCAS(true))
+	if err := fs.SyncDirs(); err == nil {
+		t.Error("expected a sharded content-addressable store to be rejected")
+	}
+}
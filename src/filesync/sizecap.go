@@ -0,0 +1,121 @@
+package filesync
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// sizeBudget is the state of WithTargetSizeCap during a copy pass.
+type sizeBudget struct {
+	used int64         // bytes the target holds now
+	lru  []cachedEntry // eviction candidates, least recently used first
+}
+
+// cachedEntry is a file in the target, by path relative to the target
+// root, with its size and last use.
+type cachedEntry struct {
+	relPath string
+	size    int64
+	used    time.Time
+}
+
+// newSizeBudget measures the files in the target for WithTargetSizeCap,
+// nil without a cap. A target that does not exist yet holds nothing.
+// The eviction candidates are the files no job of the copy pass is
+// for, and that are neither protected nor in the trash.
+func (fs *FileSync) newSizeBudget(jobs []*fileJob) (*sizeBudget, error) {
+	if fs.sizeCap <= 0 {
+		return nil, nil
+	}
+	pending := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		pending[job.relPath] = true
+	}
+	b := &sizeBudget{}
+	err := fs.walk(fs.tgtFS, fs.target, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == fs.target {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() || fs.isInternal(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		relPath, _ := filepath.Rel(fs.target, path)
+		b.used += info.Size()
+		if !pending[relPath] && !fs.protected(relPath, false) && !fs.inTrashDir(path) {
+			b.lru = append(b.lru, cachedEntry{relPath: relPath, size: info.Size(), used: accessTime(info)})
+		}
+		return nil
+	})
+	slices.SortStableFunc(b.lru, func(x, y cachedEntry) int {
+		return x.used.Compare(y.used)
+	})
+	return b, err
+}
+
+// fitsCap reports whether copying the file of job keeps the target
+// within WithTargetSizeCap, evicting least recently used files to make
+// room with WithEviction, and accounts for the copy if so. A file that
+// does not fit is logged and listed in Stats.OverCap.
+func (fs *FileSync) fitsCap(b *sizeBudget, job *fileJob) bool {
+	need := job.srcInfo.Size()
+	if job.tgtInfo != nil {
+		need -= job.tgtInfo.Size()
+	}
+	if over := b.used + need - fs.sizeCap; over > 0 && !(fs.evict && fs.evictFor(b, over)) {
+		fs.logSkip("🧺 Skipped, the target would exceed its size cap: %q", job.targetPath)
+		fs.stats.OverCap = append(fs.stats.OverCap, job.relPath)
+		return false
+	}
+	b.used += need
+	return true
+}
+
+// evictFor deletes least recently used eviction candidates until over
+// bytes are freed, and reports whether that
+// worked. Nothing is deleted when those files cannot free enough.
+func (fs *FileSync) evictFor(b *sizeBudget, over int64) bool {
+	var freeable int64
+	for _, e := range b.lru {
+		freeable += e.size
+	}
+	if freeable < over {
+		return false
+	}
+
+	kept := b.lru[:0]
+	for i, e := range b.lru {
+		if over <= 0 {
+			kept = append(kept, e)
+			continue
+		}
+		targetPath := filepath.Join(fs.target, e.relPath)
+		if fs.dryRun {
+			log.Printf("🔎 Would evict least recently used: %q (frees %d bytes)", targetPath, e.size)
+		} else if err := fs.removeEntry(fs.tgtFS, targetPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("❌ Failed to evict %q: %v", targetPath, err)
+			fs.recordError(&DeleteError{Path: targetPath, Err: err})
+			// Give up on the file being copied, keeping what is left
+			kept = append(kept, b.lru[i:]...)
+			b.lru = kept
+			return false
+		} else {
+			log.Printf("♻️ Evicted least recently used: %q", targetPath)
+		}
+		fs.recordFileAction(ActionDelete, e.relPath, "", e.size, 0)
+		fs.stats.Evicted = append(fs.stats.Evicted, e.relPath)
+		b.used -= e.size
+		over -= e.size
+	}
+	b.lru = kept
+	return true
+}
@@ -0,0 +1,97 @@
+package filesync
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_TargetSizeCap(t *testing.T) {
+	now := time.Now()
+	mem := NewMemFS()
+	mem.MkdirAll("/dst", 0755)
+	mem.WriteFile("/src/newest.bin", []byte(strings.Repeat("n", 40)), now)
+	mem.WriteFile("/src/middle.bin", []byte(strings.Repeat("m", 30)), now.Add(-time.Hour))
+	mem.WriteFile("/src/oldest.bin", []byte(strings.Repeat("o", 50)), now.Add(-2*time.Hour))
+
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithTargetSizeCap(100))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	// Newest first: the oldest file no longer fits
+	if got := fs.Stats().OverCap; !reflect.DeepEqual(got, []string{"oldest.bin"}) {
+		t.Errorf("OverCap = %v, want [oldest.bin]", got)
+	}
+	if _, err := mem.Stat("/dst/oldest.bin"); err == nil {
+		t.Error("expected oldest.bin not to be copied")
+	}
+	if fs.Stats().Err() != nil {
+		t.Errorf("Err() = %v, want none for a full cache", fs.Stats().Err())
+	}
+}
+
+func TestFileSync_SizeCapEviction(t *testing.T) {
+	now := time.Now()
+	mem := NewMemFS()
+	// Up to date and the newest source file, so reached first
+	mem.WriteFile("/src/current.bin", []byte(strings.Repeat("c", 50)), now.Add(-time.Hour))
+	mem.WriteFile("/dst/current.bin", []byte(strings.Repeat("c", 50)), now.Add(-time.Hour))
+	mem.WriteFile("/src/incoming.bin", []byte(strings.Repeat("i", 50)), now.Add(-2*time.Hour))
+	// Used more recently than current.bin, but not reached
+	mem.WriteFile("/dst/cached.bin", []byte(strings.Repeat("x", 40)), now)
+	mem.WriteFile("/src/huge.bin", []byte(strings.Repeat("h", 500)), now.Add(-3*time.Hour))
+
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithTargetSizeCap(100), WithEviction(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if !reflect.DeepEqual(stats.Evicted, []string{"cached.bin"}) {
+		t.Errorf("Evicted = %v, want [cached.bin]", stats.Evicted)
+	}
+	// Nothing is evicted for a file that could never fit
+	if !reflect.DeepEqual(stats.OverCap, []string{"huge.bin"}) {
+		t.Errorf("OverCap = %v, want [huge.bin]", stats.OverCap)
+	}
+	for _, p := range []string{"/dst/current.bin", "/dst/incoming.bin"} {
+		if _, err := mem.Stat(p); err != nil {
+			t.Errorf("expected %s in the target: %v", p, err)
+		}
+	}
+	if _, err := mem.Stat("/dst/cached.bin"); err == nil {
+		t.Error("expected cached.bin to be evicted")
+	}
+	want := []string{"delete cached.bin", "add incoming.bin"}
+	if got := actionPaths(fs.PlannedActions()); !reflect.DeepEqual(got, want) {
+		t.Errorf("actions = %v, want %v", got, want)
+	}
+}
+
+func TestFileSync_SizeCapEvictionSpares(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-24 * time.Hour)
+	mem := NewMemFS()
+	mem.WriteFile("/src/incoming.bin", []byte(strings.Repeat("i", 50)), now)
+	// Up to date, but later in copy order than incoming.bin
+	mem.WriteFile("/src/later.bin", []byte(strings.Repeat("l", 30)), old)
+	mem.WriteFile("/dst/later.bin", []byte(strings.Repeat("l", 30)), old)
+	mem.WriteFile("/dst/keep/notes.txt", []byte(strings.Repeat("k", 30)), old)
+	mem.WriteFile("/dst/"+trashDirName+"/2026-01-01T000000/gone.bin", []byte(strings.Repeat("t", 10)), old)
+	mem.WriteFile("/dst/cached.bin", []byte(strings.Repeat("x", 20)), now)
+
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithTargetSizeCap(100), WithEviction(true))
+	fs.AddProtect("keep/")
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if len(stats.Evicted) != 0 || !reflect.DeepEqual(stats.OverCap, []string{"incoming.bin"}) {
+		t.Errorf("Evicted = %v, OverCap = %v, want none evicted and incoming.bin over the cap", stats.Evicted, stats.OverCap)
+	}
+	for _, p := range []string{"/dst/later.bin", "/dst/keep/notes.txt", "/dst/" + trashDirName + "/2026-01-01T000000/gone.bin", "/dst/cached.bin"} {
+		if _, err := mem.Stat(p); err != nil {
+			t.Errorf("expected %s to be kept: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package filesync
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// snapshotLayout names snapshot directories by the time of the run.
+const snapshotLayout = "2006-01-02T15-04-05"
+
+// snapshotCompleteSuffix names the empty file written next to a
+// snapshot directory once its run finished without errors. Only
+// snapshots marked so are linked from.
+const snapshotCompleteSuffix = ".complete"
+
+// beginSnapshot points the sync at a new snapshot directory below the
+// target (see WithSnapshot) and remembers the latest complete earlier
+// one. The returned function restores the target afterwards and, if
+// complete is set, marks the new snapshot complete.
+func (fs *FileSync) beginSnapshot() (func(complete bool) error, error) {
+	root := fs.target
+	prev, err := latestSnapshot(fs.tgtFS, root)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, time.Now().Format(snapshotLayout))
+	if _, err := fs.tgtFS.Lstat(dir); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", dir)
+	}
+	fs.target, fs.prevSnapshot = dir, prev
+	return func(complete bool) error {
+		fs.target, fs.prevSnapshot = root, ""
+		if !complete || fs.dryRun {
+			return nil
+		}
+		if _, err := fs.tgtFS.Lstat(dir); err != nil {
+			return nil
+		}
+		return writeFile(fs.tgtFS, dir+snapshotCompleteSuffix, nil)
+	}, nil
+}
+
+// latestSnapshot returns the most recent complete snapshot directory
+// in root, or "" if there is none yet. Snapshots of runs that failed
+// or were interrupted may lack files or hold torn copies, so they are
+// passed over.
+func latestSnapshot(fsys FS, root string) (string, error) {
+	entries, err := fsys.ReadDir(root)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	complete := make(map[string]bool)
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), snapshotCompleteSuffix); ok && !entry.IsDir() {
+			complete[name] = true
+		}
+	}
+	latest := ""
+	for _, entry := range entries {
+		if !entry.IsDir() || !complete[entry.Name()] {
+			continue
+		}
+		// The layout sorts chronologically by name
+		if _, err := time.Parse(snapshotLayout, entry.Name()); err == nil && entry.Name() > latest {
+			latest = entry.Name()
+		}
+	}
+	if latest == "" {
+		return "", nil
+	}
+	return filepath.Join(root, latest), nil
+}
+
+// snapshotBase makes the previous snapshot's copy of a file, if there
+// is one, the file job is compared with in place of the new target.
+func (fs *FileSync) snapshotBase(job *fileJob) {
+	if fs.prevSnapshot == "" {
+		return
+	}
+	prevPath := filepath.Join(fs.prevSnapshot, job.relPath)
+	info, err := fs.tgtFS.Stat(prevPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	job.copy = false
+	job.linkFrom = prevPath
+	job.tgtInfo = info
+}
+
+// linkUnchanged hard-links the previous snapshot's copy of an
+// unchanged file into the new snapshot and reports whether it did.
+func (fs *FileSync) linkUnchanged(job *fileJob) bool {
+	fs.createPendingDirs(job.relPath)
+	if fs.dryRun {
+		log.Printf("🔎 Would link unchanged: %q → %q", job.linkFrom, job.targetPath)
+		fs.stats.FilesLinked++
+		return true
+	}
+	err := fs.makeDir(filepath.Dir(job.targetPath))
+	if err == nil {
+		err = fs.tgtFS.Link(job.linkFrom, job.targetPath)
+	}
+	if err != nil {
+		log.Printf("⚠️ Could not link %q, copying instead: %v", job.targetPath, err)
+		return false
+	}
+	log.Printf("🔗 Linked unchanged: %q", job.targetPath)
+	fs.stats.FilesLinked++
+	return true
+}
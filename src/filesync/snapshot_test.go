@@ -0,0 +1,130 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nextSecond waits until the wall clock reaches a new second, so the
+// next snapshot gets a name of its own.
+func nextSecond() {
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+}
+
+func TestFileSync_Snapshot(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "same", "a.txt"), "unchanged", old)
+	writeTestFile(t, filepath.Join(src, "edit.txt"), "v1", old)
+	writeTestFile(t, filepath.Join(src, "gone.txt"), "deleted later", old)
+
+	fs := NewFileSync(src, dst, true, WithSnapshot(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	first := fs.Stats()
+	if first.FilesCopied != 3 || first.FilesLinked != 0 {
+		t.Fatalf("first snapshot stats = %+v", first)
+	}
+
+	writeTestFile(t, filepath.Join(src, "edit.txt"), "v2 edited", time.Now())
+	writeTestFile(t, filepath.Join(src, "new.txt"), "new", old)
+	if err := os.Remove(filepath.Join(src, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	nextSecond()
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	second := fs.Stats()
+	if second.FilesCopied != 2 || second.FilesLinked != 1 {
+		t.Fatalf("second snapshot stats = %+v", second)
+	}
+	if filepath.Dir(second.Snapshot) != dst || second.Snapshot == first.Snapshot {
+		t.Fatalf("unexpected snapshot dirs %s and %s", first.Snapshot, second.Snapshot)
+	}
+
+	// The unchanged file is shared, the rest are separate copies
+	a1, err := os.Stat(filepath.Join(first.Snapshot, "same", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := os.Stat(filepath.Join(second.Snapshot, "same", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(a1, a2) {
+		t.Error("unchanged file was not hard-linked")
+	}
+	for snapshot, want := range map[string]string{first.Snapshot: "v1", second.Snapshot: "v2 edited"} {
+		data, err := os.ReadFile(filepath.Join(snapshot, "edit.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s/edit.txt = %q, want %q", snapshot, data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(first.Snapshot, "gone.txt")); err != nil {
+		t.Errorf("older snapshot lost gone.txt: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(second.Snapshot, "gone.txt")); !os.IsNotExist(err) {
+		t.Errorf("new snapshot should not contain gone.txt, stat err = %v", err)
+	}
+}
+
+func TestFileSync_SnapshotIncomplete(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "unchanged", old)
+	writeTestFile(t, filepath.Join(src, "b.txt"), "fails once", old)
+
+	// The first snapshot fails to copy b.txt, so it is not complete
+	failB := WithBeforeCopy(func(src, dst string, info os.FileInfo) (bool, error) {
+		if filepath.Base(src) == "b.txt" {
+			return false, errors.New("copy refused")
+		}
+		return true, nil
+	})
+	fs := NewFileSync(src, dst, false, WithSnapshot(true), failB)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	first := fs.Stats()
+	if len(first.Errors) != 1 {
+		t.Fatalf("Errors = %v, want the refused copy", first.Errors)
+	}
+	if _, err := os.Stat(first.Snapshot + snapshotCompleteSuffix); !os.IsNotExist(err) {
+		t.Errorf("failed snapshot was marked complete, stat err = %v", err)
+	}
+
+	// The next one passes over it and copies everything afresh
+	nextSecond()
+	fs = NewFileSync(src, dst, false, WithSnapshot(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	second := fs.Stats()
+	if second.FilesCopied != 2 || second.FilesLinked != 0 {
+		t.Fatalf("snapshot after a failed one: stats = %+v", second)
+	}
+	if _, err := os.Stat(second.Snapshot + snapshotCompleteSuffix); err != nil {
+		t.Errorf("snapshot not marked complete: %v", err)
+	}
+
+	// Complete snapshots are linked from as before
+	nextSecond()
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if third := fs.Stats(); third.FilesCopied != 0 || third.FilesLinked != 2 {
+		t.Fatalf("snapshot after a complete one: stats = %+v", third)
+	}
+}
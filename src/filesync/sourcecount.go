@@ -0,0 +1,80 @@
+package filesync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// sourceCountName is the file in the target recording the source file
+// count of the last run, for WithSourceDropGuard.
+const sourceCountName = ".filesync-source-count.json"
+
+// ErrSourceDropped is returned by a delete-missing sync that skipped
+// its delete pass because the source holds far fewer files than on the
+// previous run (see WithSourceDropGuard), as when a share did not
+// mount and the source looks empty. Files were still copied.
+var ErrSourceDropped = errors.New("source file count dropped suspiciously, delete pass skipped")
+
+// sourceCount is the state kept in sourceCountName.
+type sourceCount struct {
+	Files int `json:"files"` // source files of the last run over the whole tree
+}
+
+// sourceCountFile returns the path of the source count state, one per
+// shard.
+func (fs *FileSync) sourceCountFile() string {
+	return fs.shardFile(filepath.Join(fs.target, sourceCountName))
+}
+
+// checkSourceDrop compares files, the number of source files found by
+// this run, with the count recorded by the previous one. If it fell
+// below the guard's fraction of it in a delete-missing run over the
+// whole tree, it warns and returns an error wrapping ErrSourceDropped,
+// which skips the delete pass, unless WithForceDelete is set. Other
+// errors are failures to read the recorded count.
+func (fs *FileSync) checkSourceDrop(files int, wholeTree bool) error {
+	if fs.dropGuard <= 0 || !fs.deleteMissing || !wholeTree {
+		return nil
+	}
+	var last sourceCount
+	data, err := readFile(fs.tgtFS, fs.sourceCountFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &last); err != nil {
+		return fmt.Errorf("%s: %w", fs.sourceCountFile(), err)
+	}
+	if float64(files) >= fs.dropGuard*float64(last.Files) {
+		return nil
+	}
+	if fs.forceDelete {
+		log.Printf("⚠️ The source holds %d file(s), down from %d last time; deleting orphans anyway, as forced", files, last.Files)
+		return nil
+	}
+	log.Printf("🚨 The source holds %d file(s), down from %d last time: NOT deleting anything. Is it mounted? Force the delete pass if the drop is intended.", files, last.Files)
+	return fmt.Errorf("%w: %d file(s), down from %d", ErrSourceDropped, files, last.Files)
+}
+
+// saveSourceCount records files as the source count for the next run.
+func (fs *FileSync) saveSourceCount(files int) error {
+	data, err := json.Marshal(sourceCount{Files: files})
+	if err != nil {
+		return err
+	}
+	path := fs.sourceCountFile()
+	if err := fs.tgtFS.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := writeFile(fs.tgtFS, tmp, data); err != nil {
+		return err
+	}
+	return fs.tgtFS.Rename(tmp, path)
+}
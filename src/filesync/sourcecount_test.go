@@ -0,0 +1,58 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_SourceDropGuard(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	for i := range 10 {
+		writeTestFile(t, filepath.Join(src, fmt.Sprintf("f%d.txt", i)), "x", now)
+	}
+	if err := NewFileSync(src, dst, true, WithSourceDropGuard(0.5)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source loses most of its files, as if it were half mounted
+	for i := range 8 {
+		os.Remove(filepath.Join(src, fmt.Sprintf("f%d.txt", i)))
+	}
+	writeTestFile(t, filepath.Join(src, "new.txt"), "n", now)
+	fs := NewFileSync(src, dst, true, WithSourceDropGuard(0.5))
+	if err := fs.SyncDirs(); !errors.Is(err, ErrSourceDropped) {
+		t.Fatalf("SyncDirs() = %v, want ErrSourceDropped", err)
+	}
+	if got := fs.Stats().FilesDeleted; got != 0 {
+		t.Errorf("FilesDeleted = %d after the source count dropped, want 0", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "new.txt")); err != nil {
+		t.Errorf("new file not copied: %v", err)
+	}
+	// Refused again next time: the count of the good run is kept
+	if err := NewFileSync(src, dst, true, WithSourceDropGuard(0.5)).SyncDirs(); !errors.Is(err, ErrSourceDropped) {
+		t.Fatalf("second SyncDirs() = %v, want ErrSourceDropped", err)
+	}
+
+	// Forced, the orphans go and the new count is recorded
+	fs = NewFileSync(src, dst, true, WithSourceDropGuard(0.5), WithForceDelete(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesDeleted; got != 8 {
+		t.Errorf("forced FilesDeleted = %d, want 8", got)
+	}
+	if err := NewFileSync(src, dst, true, WithSourceDropGuard(0.5)).SyncDirs(); err != nil {
+		t.Errorf("SyncDirs() after a forced run = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, sourceCountName)); err != nil {
+		t.Errorf("source count state missing: %v", err)
+	}
+}
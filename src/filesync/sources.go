@@ -0,0 +1,194 @@
+package filesync
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// sourceTree is one source root together with its .syncignore rules.
+// A source that is a single file is the tree of its directory,
+// limited to that file.
+type sourceTree struct {
+	root    string
+	file    string // base name of a single-file source, else ""
+	fsys    FS
+	ignores *ignoreSet
+	present bool // root existed when the tree was set up
+}
+
+// holds reports whether relPath can belong to the tree, which for a
+// single-file source is only the file itself (and the root).
+func (t sourceTree) holds(relPath string) bool {
+	return t.file == "" || relPath == "." || relPath == t.file
+}
+
+// walkRoot returns where a walk of scope (a relative path, "." for
+// the whole tree) starts.
+func (t sourceTree) walkRoot(scope string) string {
+	if t.file != "" && scope == "." {
+		return filepath.Join(t.root, t.file)
+	}
+	return filepath.Join(t.root, scope)
+}
+
+// AddSource adds another source directory to merge into the target.
+// Sources are processed in the order they were added, after the one
+// passed to NewFileSync. When several sources contain the same
+// relative path, the last one wins unless WithFirstSourceWins is set.
+// Delete-missing only removes target entries absent from every source.
+// The path is cleaned like the one passed to NewFileSync.
+func (fs *FileSync) AddSource(path string) {
+	if !hasTrailingSlash(path) {
+		fs.namedSources = append(fs.namedSources, filepath.Clean(path))
+	}
+	fs.extraSources = append(fs.extraSources, filepath.Clean(path))
+}
+
+// sourceTrees returns all configured source roots in priority order,
+// each with a fresh ignore set. Sources that are files are synced as
+// that single file into the target root.
+func (fs *FileSync) sourceTrees() []sourceTree {
+	roots := append([]string{fs.source}, fs.extraSources...)
+	trees := make([]sourceTree, len(roots))
+	for i, root := range roots {
+		root = fs.strippedRoot(root)
+		tree := sourceTree{root: root, fsys: fs.srcFS}
+		info, err := fs.srcFS.Stat(root)
+		tree.present = err == nil
+		if err == nil && !info.IsDir() {
+			tree.root, tree.file = filepath.Dir(root), filepath.Base(root)
+		}
+		tree.ignores = newIgnoreSet(fs.srcFS, tree.root, slices.Concat(fs.excludes, fs.includes))
+		trees[i] = tree
+	}
+	return trees
+}
+
+// excludedEverywhere reports whether relPath is excluded by every
+// source, meaning no source would ever sync it to the target.
+func (fs *FileSync) excludedEverywhere(trees []sourceTree, relPath string, isDir bool) bool {
+	for _, tree := range trees {
+		if !fs.excluded(tree.ignores, relPath, isDir) {
+			return false
+		}
+	}
+	return true
+}
+
+// missingEverywhere reports whether relPath is absent from every source.
+func missingEverywhere(trees []sourceTree, relPath string) bool {
+	missing, _ := sourceAbsent(trees, relPath)
+	return missing
+}
+
+// sourceAbsent is missingEverywhere, telling apart an entry that is
+// known to be absent from one that may only look absent: if no source
+// holds relPath but one of them cannot be stat'ed for a reason other
+// than the entry not existing, it returns false with a *StatError.
+func sourceAbsent(trees []sourceTree, relPath string) (bool, error) {
+	var unknown error
+	for _, tree := range trees {
+		if !tree.holds(relPath) {
+			continue
+		}
+		path := filepath.Join(tree.root, relPath)
+		_, err := tree.fsys.Lstat(path)
+		switch {
+		case err == nil:
+			return false, nil
+		case !os.IsNotExist(err) && unknown == nil:
+			unknown = &StatError{Path: path, Err: err}
+		}
+	}
+	return unknown == nil, unknown
+}
+
+// mergeByPath merges per-source lists keyed by relative path. Each
+// path keeps the position where it first appeared; which source's
+// entry is kept depends on firstWins.
+func mergeByPath[T any](lists [][]T, relPath func(T) string, firstWins bool) []T {
+	if len(lists) == 1 {
+		return lists[0]
+	}
+
+	var merged []T
+	index := map[string]int{}
+	for _, list := range lists {
+		for _, item := range list {
+			key := relPath(item)
+			if i, ok := index[key]; ok {
+				if !firstWins {
+					merged[i] = item
+				}
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// withinScope reports whether relPath equals scope or lies below it.
+func withinScope(relPath, scope string) bool {
+	if scope == "." {
+		return true
+	}
+	return relPath == scope || strings.HasPrefix(relPath, scope+string(filepath.Separator))
+}
+
+// GlobSources expands each pattern with filepath.Glob on the local
+// filesystem, in order, for use as sources (see AddSource). Patterns
+// without glob metacharacters are kept as they are; a pattern that
+// matches nothing is an error. Matched files are synced as single
+// files into the target root.
+func GlobSources(patterns ...string) ([]string, error) {
+	var sources []string
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, `*?[`) {
+			sources = append(sources, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("source pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("source pattern %q matches nothing", pattern)
+		}
+		sources = append(sources, matches...)
+	}
+	return sources, nil
+}
+
+// confirmOrphan stats the sources again right before the orphan at
+// relPath is deleted, and reports whether it is still gone from all
+// of them. An entry that is back, or whose sources cannot be stat'ed
+// now, is kept.
+func (fs *FileSync) confirmOrphan(trees []sourceTree, relPath, path string) bool {
+	if fs.pathMapper != nil {
+		return true
+	}
+	absent, err := sourceAbsent(trees, relPath)
+	switch {
+	case err != nil:
+		fs.keepUnconfirmed(relPath, path, err)
+		return false
+	case !absent:
+		log.Printf("🛡️ Back in the source, not deleted: %q", path)
+		return false
+	}
+	return true
+}
+
+// keepUnconfirmed records a target entry that is kept because a
+// source could not be stat'ed, so it may not be gone from it.
+func (fs *FileSync) keepUnconfirmed(relPath, path string, err error) {
+	log.Printf("⚠️ Could not confirm %q is gone from the source, not deleted: %v", path, err)
+	fs.stats.Unconfirmed = append(fs.stats.Unconfirmed, relPath)
+	fs.recordError(err)
+}
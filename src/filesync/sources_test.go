@@ -0,0 +1,138 @@
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_MultipleSources(t *testing.T) {
+	tmp := t.TempDir()
+	srcA := filepath.Join(tmp, "a")
+	srcB := filepath.Join(tmp, "b")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(srcA, "only-a.txt"), "a", now)
+	writeTestFile(t, filepath.Join(srcA, "shared.txt"), "from a", now)
+	writeTestFile(t, filepath.Join(srcB, "only-b.txt"), "b", now)
+	writeTestFile(t, filepath.Join(srcB, "shared.txt"), "from b", now.Add(time.Minute))
+	writeTestFile(t, filepath.Join(dst, "orphan.txt"), "orphan", now)
+
+	fs := NewFileSync(srcA, dst, true)
+	fs.AddSource(srcB)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"only-a.txt", "only-b.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Errorf("expected %s in target (delete-missing must use the union of sources)", p)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "orphan.txt")); !os.IsNotExist(err) {
+		t.Error("expected orphan.txt to be deleted")
+	}
+	data, _ := os.ReadFile(filepath.Join(dst, "shared.txt"))
+	if string(data) != "from b" {
+		t.Errorf("expected later source to win, got %s", data)
+	}
+
+	// merged result is stable: a second run changes nothing
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if n := fs.Stats().FilesCopied; n != 0 {
+		t.Errorf("expected no copies on second run, got %d", n)
+	}
+	diff, err := fs.Diff(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Empty() {
+		t.Errorf("expected empty diff after merge, got %+v", diff)
+	}
+}
+
+func TestFileSync_FirstSourceWins(t *testing.T) {
+	tmp := t.TempDir()
+	srcA := filepath.Join(tmp, "a")
+	srcB := filepath.Join(tmp, "b")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(srcA, "shared.txt"), "from a", now)
+	writeTestFile(t, filepath.Join(srcB, "shared.txt"), "from b", now)
+
+	fs := NewFileSync(srcA, dst, false, WithFirstSourceWins(true))
+	fs.AddSource(srcB)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dst, "shared.txt"))
+	if string(data) != "from a" {
+		t.Errorf("expected first source to win, got %s", data)
+	}
+}
+
+func TestFileSync_GlobSources(t *testing.T) {
+	tmp := t.TempDir()
+	photos := filepath.Join(tmp, "photos")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(photos, "2023-01", "a.jpg"), "a", now)
+	writeTestFile(t, filepath.Join(photos, "2023-02", "b.jpg"), "b", now)
+	writeTestFile(t, filepath.Join(photos, "2023-notes.txt"), "notes", now)
+	writeTestFile(t, filepath.Join(photos, "2024-01", "c.jpg"), "c", now)
+	writeTestFile(t, filepath.Join(dst, "stale.jpg"), "stale", now)
+
+	if _, err := GlobSources(filepath.Join(photos, "1999-*")); err == nil {
+		t.Error("expected an error for a pattern without matches")
+	}
+	sources, err := GlobSources(filepath.Join(photos, "2023-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(photos, "2023-01"),
+		filepath.Join(photos, "2023-02"),
+		filepath.Join(photos, "2023-notes.txt"),
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Fatalf("GlobSources = %v, want %v", sources, want)
+	}
+
+	fs := NewFileSync(sources[0], dst, true)
+	for _, source := range sources[1:] {
+		fs.AddSource(source)
+	}
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Directories are merged, the matched file lands in the target root
+	// and nothing else next to it is picked up
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"2023-notes.txt", "a.jpg", "b.jpg"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("target holds %v, want %v", names, want)
+	}
+
+	// A second run has nothing left to do
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 0 || stats.FilesDeleted != 0 {
+		t.Errorf("second run stats = %+v", stats)
+	}
+}
@@ -0,0 +1,123 @@
+package filesync
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// SpanTracer starts the spans WithSpanTracer emits. It has the shape
+// of OpenTelemetry's trace.Tracer, so an adapter around one takes a
+// few lines, while filesync itself does not depend on OpenTelemetry;
+// see the README for such an adapter.
+type SpanTracer interface {
+	// Start starts a span named name as a child of the span in ctx,
+	// if any, and returns a context holding the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a SpanTracer. Its methods may be called
+// from several goroutines.
+type Span interface {
+	SetAttributes(attrs ...SpanAttribute)
+	AddEvent(name string, attrs ...SpanAttribute)
+	RecordError(err error)
+	End()
+}
+
+// SpanAttribute is a key-value pair on a span or span event. Values
+// are strings, int64s or bools.
+type SpanAttribute struct {
+	Key   string
+	Value any
+}
+
+// spanTracing is the state of WithSpanTracer during a run: the
+// context of the run's span, and the span of the phase in progress.
+type spanTracing struct {
+	tracer SpanTracer
+	ctx    context.Context
+	run    Span
+	phase  Span
+}
+
+// noSpan ends nothing, for runs without a tracer.
+func noSpan() {}
+
+// startRunSpan starts the span of a sync run, filesync.sync, and
+// returns the function ending it with the outcome and the run's
+// totals.
+func (fs *FileSync) startRunSpan() func(err error) {
+	if fs.spans == nil {
+		return func(error) {}
+	}
+	ctx := fs.runCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := fs.spans
+	s.ctx, s.run = s.tracer.Start(ctx, "filesync.sync")
+	s.run.SetAttributes(
+		SpanAttribute{"filesync.source", fs.source},
+		SpanAttribute{"filesync.target", fs.target},
+		SpanAttribute{"filesync.dry_run", fs.dryRun},
+	)
+	return func(err error) {
+		s.run.SetAttributes(
+			SpanAttribute{"filesync.files_copied", int64(fs.stats.FilesCopied)},
+			SpanAttribute{"filesync.bytes_copied", fs.stats.BytesCopied},
+			SpanAttribute{"filesync.files_deleted", int64(fs.stats.FilesDeleted)},
+			SpanAttribute{"filesync.errors", int64(len(fs.stats.Errors))},
+		)
+		if err != nil {
+			s.run.RecordError(err)
+		}
+		s.run.End()
+		s.ctx, s.run = nil, nil
+	}
+}
+
+// startPhaseSpan starts the span of a phase of the run, such as
+// filesync.walk, and returns the function ending it.
+func (fs *FileSync) startPhaseSpan(name string) func() {
+	s := fs.spans
+	if s == nil || s.run == nil {
+		return noSpan
+	}
+	_, span := s.tracer.Start(s.ctx, "filesync."+name)
+	s.phase = span
+	return func() {
+		span.End()
+		s.phase = nil
+	}
+}
+
+// currentSpan returns the span of the phase in progress, or of the
+// run between phases, or nil.
+func (fs *FileSync) currentSpan() Span {
+	switch s := fs.spans; {
+	case s == nil:
+		return nil
+	case s.phase != nil:
+		return s.phase
+	case s.run != nil:
+		return s.run
+	}
+	return nil
+}
+
+// spanAction adds a change made to the target to the current span.
+func (fs *FileSync) spanAction(kind ActionKind, relPath string, reason DiffReason) {
+	if span := fs.currentSpan(); span != nil {
+		span.AddEvent("filesync."+string(kind),
+			SpanAttribute{"filesync.path", filepath.ToSlash(relPath)},
+			SpanAttribute{"filesync.reason", string(reason)},
+		)
+	}
+}
+
+// spanError records a per-file error on the current span.
+func (fs *FileSync) spanError(err error) {
+	if span := fs.currentSpan(); span != nil {
+		span.RecordError(err)
+	}
+}
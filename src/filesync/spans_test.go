@@ -0,0 +1,106 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSpan is a span recorded by testTracer.
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]any
+	events []string
+	errs   []error
+	ended  bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...SpanAttribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) AddEvent(name string, attrs ...SpanAttribute) {
+	s.events = append(s.events, name+" "+attrs[0].Value.(string))
+}
+
+func (s *testSpan) RecordError(err error) { s.errs = append(s.errs, err) }
+func (s *testSpan) End()                  { s.ended = true }
+
+// testTracer records the spans it starts, in order.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attrs: map[string]any{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func TestFileSync_SpanTracer(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	mem.WriteFile("/src/new.txt", []byte("new"), now)
+	mem.WriteFile("/dst/old.txt", []byte("old"), now)
+
+	tracer := &testTracer{}
+	ctx, outer := tracer.Start(context.Background(), "deploy")
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithSpanTracer(tracer))
+	if err := fs.SyncDirsContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, s := range tracer.spans {
+		names = append(names, s.name)
+		if !s.ended && s != outer {
+			t.Errorf("span %s was not ended", s.name)
+		}
+	}
+	want := []string{"deploy", "filesync.sync", "filesync.walk", "filesync.compare", "filesync.copy", "filesync.delete"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("spans = %v, want %v", names, want)
+	}
+	run := tracer.spans[1]
+	if run.parent != outer {
+		t.Error("expected the run's span to be a child of the context's")
+	}
+	for _, s := range tracer.spans[2:] {
+		if s.parent != run {
+			t.Errorf("expected %s to be a child of the run's span", s.name)
+		}
+	}
+	if run.attrs["filesync.files_copied"] != int64(1) || run.attrs["filesync.files_deleted"] != int64(1) || run.attrs["filesync.target"] != "/dst" {
+		t.Errorf("run attributes = %v", run.attrs)
+	}
+	if got := tracer.spans[4].events; !reflect.DeepEqual(got, []string{"filesync.add new.txt"}) {
+		t.Errorf("copy events = %v", got)
+	}
+	if got := tracer.spans[5].events; !reflect.DeepEqual(got, []string{"filesync.delete old.txt"}) {
+		t.Errorf("delete events = %v", got)
+	}
+
+	// Per-file errors are recorded on the span of their phase
+	mem.WriteFile("/src/new.txt", []byte("newer"), now.Add(time.Second))
+	fs.beforeCopy = func(src, dst string, info os.FileInfo) (bool, error) { return false, errors.New("refused") }
+	tracer.spans = nil
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if copySpan := tracer.spans[3]; copySpan.name != "filesync.copy" || len(copySpan.errs) != 1 {
+		t.Errorf("span %s recorded %v, want the hook's error", copySpan.name, copySpan.errs)
+	}
+}
@@ -0,0 +1,83 @@
+package filesync
+
+import (
+	"log"
+	"os"
+)
+
+// specialMaker is implemented by filesystems that can create named
+// pipes and device nodes.
+type specialMaker interface {
+	Mknod(name string, mode os.FileMode, dev uint64) error
+}
+
+// isSpecial reports whether mode is that of a named pipe, socket,
+// device node or other irregular file, whose contents cannot be
+// copied: opening a FIFO blocks until a writer appears, and reading a
+// device yields whatever it produces.
+func isSpecial(mode os.FileMode) bool {
+	return mode&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeCharDevice|os.ModeIrregular) != 0
+}
+
+// specialKind names the type of a special file for log messages.
+func specialKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	default:
+		return "irregular file"
+	}
+}
+
+// syncSpecial handles a special source file found by scanSource. By
+// default it is skipped with a warning; with WithSpecialFiles named
+// pipes and device nodes are recreated in the target, when the target
+// filesystem supports that. Sockets only exist while a process serves
+// them, so they are always skipped.
+func (fs *FileSync) syncSpecial(relPath, srcPath, targetPath string, info os.FileInfo) {
+	maker, canMake := fs.tgtFS.(specialMaker)
+	if !fs.specialFiles || !canMake || info.Mode()&(os.ModeSocket|os.ModeIrregular) != 0 {
+		log.Printf("⚠️ Skipping %s: %q", specialKind(info.Mode()), srcPath)
+		fs.stats.Special = append(fs.stats.Special, relPath)
+		return
+	}
+
+	dev, _ := specialDevice(info)
+	tgtInfo, err := fs.tgtFS.Lstat(targetPath)
+	if err == nil && tgtInfo.Mode().Type() == info.Mode().Type() {
+		if tgtDev, _ := specialDevice(tgtInfo); tgtDev == dev {
+			fs.stats.FilesSkipped++
+			return
+		}
+	}
+	if fs.dryRun {
+		log.Printf("🔎 Would create %s: %q", specialKind(info.Mode()), targetPath)
+		return
+	}
+
+	fs.createPendingDirs(relPath)
+	if err == nil {
+		rm := fs.removeEntry
+		if tgtInfo.IsDir() {
+			rm = fs.removeTree
+		}
+		if rmErr := rm(fs.tgtFS, targetPath); rmErr != nil {
+			log.Printf("❌ Failed to remove %q: %v", targetPath, rmErr)
+			fs.recordError(&DeleteError{Path: targetPath, Err: rmErr})
+			return
+		}
+	}
+	if err := maker.Mknod(targetPath, info.Mode(), dev); err != nil {
+		log.Printf("❌ Failed to create %s %q: %v", specialKind(info.Mode()), targetPath, err)
+		fs.recordError(&CopyError{Src: srcPath, Dst: targetPath, Err: err})
+		return
+	}
+	log.Printf("🧷 Created %s: %q", specialKind(info.Mode()), targetPath)
+	fs.stats.FilesCopied++
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package filesync
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Mknod creates a named pipe or device node with the type and
+// permission bits of mode, bypassing the umask.
+func (osFS) Mknod(name string, mode os.FileMode, dev uint64) error {
+	var err error
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		err = unix.Mkfifo(name, uint32(mode.Perm()))
+	case mode&os.ModeCharDevice != 0:
+		err = mknod(unix.Mknod, name, unix.S_IFCHR|uint32(mode.Perm()), dev)
+	case mode&os.ModeDevice != 0:
+		err = mknod(unix.Mknod, name, unix.S_IFBLK|uint32(mode.Perm()), dev)
+	default:
+		err = errors.ErrUnsupported
+	}
+	if err != nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
+	}
+	return os.Chmod(name, mode.Perm())
+}
+
+// mknod calls unix.Mknod, whose device argument is an int on some
+// systems and a uint64 on others.
+func mknod[D int | uint64](fn func(string, uint32, D) error, name string, mode uint32, dev uint64) error {
+	return fn(name, mode, D(dev))
+}
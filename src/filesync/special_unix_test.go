@@ -0,0 +1,123 @@
+//go:build unix
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileSync_SkipsFIFO(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", time.Now())
+	if err := syscall.Mkfifo(filepath.Join(src, "pipe"), 0644); err != nil {
+		t.Skipf("mkfifo unavailable: %v", err)
+	}
+
+	// Opening the FIFO would block forever, so a hang fails the test
+	done := make(chan error, 1)
+	fs := NewFileSync(src, dst, false)
+	go func() { done <- fs.SyncDirs() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("sync hung on a FIFO")
+	}
+
+	stats := fs.Stats()
+	if want := []string{"pipe"}; !reflect.DeepEqual(stats.Special, want) {
+		t.Errorf("Special = %v, want %v", stats.Special, want)
+	}
+	if len(stats.Errors) > 0 {
+		t.Errorf("unexpected errors: %v", stats.Errors)
+	}
+	if stats.FilesCopied != 1 {
+		t.Errorf("FilesCopied = %d, want 1", stats.FilesCopied)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "pipe")); !os.IsNotExist(err) {
+		t.Errorf("FIFO should not exist in target, got %v", err)
+	}
+}
+
+func TestFileSync_RecreateFIFO(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(src, "sub", "pipe"), 0640); err != nil {
+		t.Skipf("mkfifo unavailable: %v", err)
+	}
+
+	fs := NewFileSync(src, dst, false, WithSpecialFiles(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(filepath.Join(dst, "sub", "pipe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Type() != os.ModeNamedPipe || info.Mode().Perm() != 0640 {
+		t.Errorf("target mode = %v, want a named pipe with 0640", info.Mode())
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 1 || len(stats.Special) != 0 {
+		t.Errorf("FilesCopied = %d, Special = %v", stats.FilesCopied, stats.Special)
+	}
+
+	// An existing FIFO is up to date
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 0 || stats.FilesSkipped != 1 {
+		t.Errorf("second run: FilesCopied = %d, FilesSkipped = %d", stats.FilesCopied, stats.FilesSkipped)
+	}
+}
+
+func TestFileSync_BidirectionalSkipsFIFO(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", time.Now())
+	writeTestFile(t, filepath.Join(dst, "b.txt"), "beta", time.Now())
+	if err := syscall.Mkfifo(filepath.Join(src, "pipe"), 0644); err != nil {
+		t.Skipf("mkfifo unavailable: %v", err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(dst, "fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	fs := NewFileSync(src, dst, false, WithBidirectional(true))
+	go func() { done <- fs.SyncDirs() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("two-way sync hung on a FIFO")
+	}
+
+	stats := fs.Stats()
+	if want := []string{"pipe", "fifo"}; !reflect.DeepEqual(stats.Special, want) {
+		t.Errorf("Special = %v, want %v", stats.Special, want)
+	}
+	if len(stats.Errors) > 0 || stats.FilesCopied != 2 {
+		t.Errorf("FilesCopied = %d, Errors = %v; want the two regular files", stats.FilesCopied, stats.Errors)
+	}
+	for _, path := range []string{filepath.Join(dst, "pipe"), filepath.Join(src, "fifo")} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist, got %v", path, err)
+		}
+	}
+}
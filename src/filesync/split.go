@@ -0,0 +1,457 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// partInfix separates a file name from the number of one of its parts.
+const partInfix = ".part"
+
+// errSplitUnsupported is returned for operations a split file on a
+// splitFS cannot do in place.
+var errSplitUnsupported = errors.New("operation not supported on split files")
+
+// partName returns the path of the n-th part (counting from 1) of name.
+func partName(name string, n int) string {
+	return fmt.Sprintf("%s%s%04d", name, partInfix, n)
+}
+
+// splitPart parses a part file name into the name of the whole file
+// and the part number.
+func splitPart(name string) (string, int, bool) {
+	i := strings.LastIndex(name, partInfix)
+	if i <= 0 {
+		return "", 0, false
+	}
+	digits := name[i+len(partInfix):]
+	if len(digits) < 4 || strings.Trim(digits, "0123456789") != "" {
+		return "", 0, false
+	}
+	var n int
+	fmt.Sscan(digits, &n)
+	return name[:i], n, n > 0
+}
+
+// splitFS stores files larger than limit as numbered parts of at most
+// limit bytes ("name.part0001", "name.part0002", ...) on the wrapped
+// FS, and presents such parts as the single file they make up: Stat
+// sums their sizes, Open reads them in order, and ReadDir lists the
+// whole file instead. A plain file always wins over parts of the same
+// name. With a zero limit nothing is split, but existing parts are
+// still read as one file (see WithJoinParts).
+type splitFS struct {
+	FS
+	limit int64
+}
+
+// baseFS returns fsys without the splitFS wrapper of WithSplitSize and
+// WithJoinParts, for the checks of whether a location is local, which
+// splitting files does not change.
+func baseFS(fsys FS) FS {
+	if s, ok := fsys.(*splitFS); ok {
+		return s.FS
+	}
+	return fsys
+}
+
+// parts returns the infos of the consecutive parts of name.
+func (s *splitFS) parts(name string) []os.FileInfo {
+	var infos []os.FileInfo
+	for n := 1; ; n++ {
+		info, err := s.FS.Lstat(partName(name, n))
+		if err != nil || !info.Mode().IsRegular() {
+			return infos
+		}
+		infos = append(infos, info)
+	}
+}
+
+// splitInfo describes a file stored as parts.
+type splitInfo struct {
+	name  string
+	size  int64
+	first os.FileInfo
+}
+
+func (i splitInfo) Name() string       { return i.name }
+func (i splitInfo) Size() int64        { return i.size }
+func (i splitInfo) Mode() os.FileMode  { return i.first.Mode() }
+func (i splitInfo) ModTime() time.Time { return i.first.ModTime() }
+func (i splitInfo) IsDir() bool        { return false }
+func (i splitInfo) Sys() any           { return nil }
+
+// stat returns the info of name itself, or of the parts it is stored
+// as, and the parts (nil for a plain file).
+func (s *splitFS) stat(name string, lstat func(string) (os.FileInfo, error)) (os.FileInfo, []os.FileInfo, error) {
+	info, err := lstat(name)
+	if !os.IsNotExist(err) {
+		return info, nil, err
+	}
+	parts := s.parts(name)
+	if len(parts) == 0 {
+		return nil, nil, err
+	}
+	whole := splitInfo{name: filepath.Base(name), first: parts[0]}
+	for _, part := range parts {
+		whole.size += part.Size()
+	}
+	return whole, parts, nil
+}
+
+func (s *splitFS) Stat(name string) (os.FileInfo, error) {
+	info, _, err := s.stat(name, s.FS.Stat)
+	return info, err
+}
+
+func (s *splitFS) Lstat(name string) (os.FileInfo, error) {
+	info, _, err := s.stat(name, s.FS.Lstat)
+	return info, err
+}
+
+func (s *splitFS) ReadDir(name string) ([]os.DirEntry, error) {
+	entries, err := s.FS.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, entry := range entries {
+		present[entry.Name()] = true
+	}
+	return s.joinEntries(name, entries, func(base string) bool { return present[base] })
+}
+
+// joinEntries turns the entries of the directory name, as the
+// underlying FS lists them, into those of whole files: the first part
+// of each split file stands for the whole file, unless present says a
+// plain file of that name shadows it, and the other parts are left
+// out. It serves ReadDir and the batches of a streaming walk, which
+// cannot see the whole listing at once.
+func (s *splitFS) joinEntries(name string, entries []os.DirEntry, present func(base string) bool) ([]os.DirEntry, error) {
+	var out []os.DirEntry
+	for _, entry := range entries {
+		base, n, ok := splitPart(entry.Name())
+		if !ok || entry.IsDir() {
+			out = append(out, entry)
+			continue
+		}
+		// Parts are listed once, as the whole file, unless shadowed
+		if n != 1 || present(base) {
+			continue
+		}
+		info, err := s.Lstat(filepath.Join(name, base))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dirEntry{info})
+	}
+	return out, nil
+}
+
+func (s *splitFS) Open(name string) (File, error) {
+	_, parts, err := s.stat(name, s.FS.Lstat)
+	if err != nil || parts == nil {
+		return s.FS.Open(name)
+	}
+	return &splitReader{fsys: s, name: name, parts: parts}, nil
+}
+
+// OpenFile splits files created with O_TRUNC for writing; other
+// writes go to the plain file, reads to the whole file.
+func (s *splitFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return s.Open(name)
+	}
+	if s.limit <= 0 || flag&os.O_TRUNC == 0 {
+		return s.FS.OpenFile(name, flag, perm)
+	}
+	out, err := s.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &splitWriter{fsys: s, name: name, perm: perm, cur: out}, nil
+}
+
+// removeParts removes the parts of name from part from on.
+func (s *splitFS) removeParts(name string, from int) error {
+	for n := from; ; n++ {
+		if err := s.FS.Remove(partName(name, n)); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (s *splitFS) Remove(name string) error {
+	err := s.FS.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(s.parts(name)) == 0 {
+		return err
+	}
+	return s.removeParts(name, 1)
+}
+
+func (s *splitFS) RemoveAll(name string) error {
+	if err := s.FS.RemoveAll(name); err != nil {
+		return err
+	}
+	return s.removeParts(name, 1)
+}
+
+func (s *splitFS) Rename(oldname, newname string) error {
+	_, parts, err := s.stat(oldname, s.FS.Lstat)
+	if err != nil || parts == nil {
+		if err := s.FS.Rename(oldname, newname); err != nil {
+			return err
+		}
+		return s.removeParts(newname, 1)
+	}
+	if err := s.FS.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := range parts {
+		if err := s.FS.Rename(partName(oldname, n+1), partName(newname, n+1)); err != nil {
+			return err
+		}
+	}
+	return s.removeParts(newname, len(parts)+1)
+}
+
+func (s *splitFS) Link(oldname, newname string) error {
+	_, parts, err := s.stat(oldname, s.FS.Lstat)
+	if err != nil || parts == nil {
+		return s.FS.Link(oldname, newname)
+	}
+	for n := range parts {
+		if err := s.FS.Link(partName(oldname, n+1), partName(newname, n+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachPart applies fn to name if it is a plain file, else to each of
+// its parts.
+func (s *splitFS) eachPart(name string, fn func(string) error) error {
+	_, parts, err := s.stat(name, s.FS.Lstat)
+	if err != nil || parts == nil {
+		return fn(name)
+	}
+	for n := range parts {
+		if err := fn(partName(name, n+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *splitFS) Chmod(name string, mode os.FileMode) error {
+	return s.eachPart(name, func(path string) error { return s.FS.Chmod(path, mode) })
+}
+
+func (s *splitFS) Chtimes(name string, atime, mtime time.Time) error {
+	return s.eachPart(name, func(path string) error { return s.FS.Chtimes(path, atime, mtime) })
+}
+
+func (s *splitFS) Chown(name string, uid, gid int) error {
+	c, ok := s.FS.(chowner)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return s.eachPart(name, func(path string) error { return c.Chown(path, uid, gid) })
+}
+
+// splitReader reads the parts of a split file as one.
+type splitReader struct {
+	fsys  *splitFS
+	name  string
+	parts []os.FileInfo
+
+	cur    File  // open part, nil before the first read and after the end
+	index  int   // part that cur is, or the next read opens
+	offset int64 // position within the whole file
+}
+
+func (r *splitReader) Read(p []byte) (int, error) {
+	for {
+		if r.index >= len(r.parts) {
+			return 0, io.EOF
+		}
+		if r.cur == nil {
+			f, err := r.fsys.FS.Open(partName(r.name, r.index+1))
+			if err != nil {
+				return 0, err
+			}
+			start := int64(0)
+			for _, part := range r.parts[:r.index] {
+				start += part.Size()
+			}
+			if r.offset > start {
+				if _, err := f.Seek(r.offset-start, io.SeekStart); err != nil {
+					f.Close()
+					return 0, err
+				}
+			}
+			r.cur = f
+		}
+		n, err := r.cur.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			r.index++
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *splitReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		info, _ := r.Stat()
+		offset += info.Size()
+	}
+	if offset < 0 {
+		return 0, errors.New("negative seek offset")
+	}
+	if r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+	}
+	// Find the part holding offset; the next read opens it
+	r.offset, r.index = offset, 0
+	for start := int64(0); r.index < len(r.parts) && start+r.parts[r.index].Size() <= offset; r.index++ {
+		start += r.parts[r.index].Size()
+	}
+	return offset, nil
+}
+
+func (r *splitReader) Stat() (os.FileInfo, error) {
+	whole := splitInfo{name: filepath.Base(r.name), first: r.parts[0]}
+	for _, part := range r.parts {
+		whole.size += part.Size()
+	}
+	return whole, nil
+}
+
+func (r *splitReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
+
+func (r *splitReader) Write([]byte) (int, error) { return 0, errSplitUnsupported }
+func (r *splitReader) Truncate(int64) error      { return errSplitUnsupported }
+func (r *splitReader) Sync() error               { return nil }
+
+// splitWriter writes a new file to a splitFS. It starts out as the
+// plain file; once that holds limit bytes and more follow, it becomes
+// the first part and writing continues in the next ones. Close removes
+// whatever is left of an earlier version: parts beyond the last one
+// written, or all parts if the file stayed small.
+type splitWriter struct {
+	fsys *splitFS
+	name string
+	perm os.FileMode
+
+	cur  File  // file being written
+	part int   // number of cur, 0 while writing the plain file
+	n    int64 // bytes in cur
+}
+
+func (w *splitWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.n == w.fsys.limit {
+			if err := w.nextPart(); err != nil {
+				return written, err
+			}
+		}
+		chunk := min(int64(len(p)), w.fsys.limit-w.n)
+		n, err := w.cur.Write(p[:chunk])
+		written += n
+		w.n += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// nextPart closes the current file and continues in the next part,
+// turning the plain file into the first part if needed.
+func (w *splitWriter) nextPart() error {
+	if err := w.cur.Close(); err != nil {
+		return err
+	}
+	if w.part == 0 {
+		if err := w.fsys.FS.Rename(w.name, partName(w.name, 1)); err != nil {
+			return err
+		}
+		w.part = 1
+	}
+	w.part++
+	out, err := w.fsys.FS.OpenFile(partName(w.name, w.part), os.O_RDWR|os.O_CREATE|os.O_TRUNC, w.perm)
+	if err != nil {
+		w.cur = nil
+		return err
+	}
+	w.cur, w.n = out, 0
+	return nil
+}
+
+func (w *splitWriter) Close() error {
+	if w.cur == nil {
+		return nil
+	}
+	err := w.cur.Close()
+	w.cur = nil
+	if err != nil {
+		return err
+	}
+	if w.part == 0 {
+		return w.fsys.removeParts(w.name, 1)
+	}
+	return w.fsys.removeParts(w.name, w.part+1)
+}
+
+func (w *splitWriter) Stat() (os.FileInfo, error) {
+	if w.part == 0 {
+		return w.cur.Stat()
+	}
+	return w.fsys.Stat(w.name)
+}
+
+func (w *splitWriter) Sync() error {
+	return w.cur.Sync()
+}
+
+// Seek only reports the position; split files are written in one go.
+func (w *splitWriter) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekCurrent {
+		return 0, errSplitUnsupported
+	}
+	return int64(max(w.part-1, 0))*w.fsys.limit + w.n, nil
+}
+
+func (w *splitWriter) Read([]byte) (int, error) { return 0, errSplitUnsupported }
+func (w *splitWriter) Truncate(int64) error     { return errSplitUnsupported }
@@ -0,0 +1,215 @@
+package filesync
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listNames returns the names of the files in dir, sorted.
+func listNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFileSync_SplitSize(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now().Add(-time.Hour)
+	big := strings.Repeat("0123456789", 2) + "abcde"
+	writeTestFile(t, filepath.Join(src, "big.bin"), big, now)
+	writeTestFile(t, filepath.Join(src, "small.txt"), "small", now)
+
+	for _, opts := range [][]Option{nil, {WithAtomicCopy(true)}, {WithChecksum(true)}} {
+		os.RemoveAll(dst)
+		opts = append(opts, WithSplitSize(10))
+		fs := NewFileSync(src, dst, false, opts...)
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"big.bin.part0001", "big.bin.part0002", "big.bin.part0003", "small.txt"}
+		if got := listNames(t, dst); !reflect.DeepEqual(got, want) {
+			t.Fatalf("target = %v, want %v", got, want)
+		}
+		for i, part := range []string{"0123456789", "0123456789", "abcde"} {
+			data, err := os.ReadFile(filepath.Join(dst, want[i]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != part {
+				t.Errorf("%s = %q, want %q", want[i], data, part)
+			}
+		}
+
+		// The parts count as an up-to-date copy
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fs.Stats().FilesCopied; got != 0 {
+			t.Errorf("second run copied %d file(s), want 0", got)
+		}
+	}
+
+	// Shrinking drops the parts no longer needed, and a file below the
+	// threshold is stored whole again
+	fs := NewFileSync(src, dst, false, WithSplitSize(10))
+	writeTestFile(t, filepath.Join(src, "big.bin"), "0123456789xy", now.Add(time.Minute))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listNames(t, dst), []string{"big.bin.part0001", "big.bin.part0002", "small.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after shrinking, target = %v, want %v", got, want)
+	}
+	writeTestFile(t, filepath.Join(src, "big.bin"), "tiny", now.Add(2*time.Minute))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listNames(t, dst), []string{"big.bin", "small.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("below the threshold, target = %v, want %v", got, want)
+	}
+}
+
+func TestFileSync_SplitDeleteMissing(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep", time.Now())
+	for _, part := range []string{"gone.bin.part0001", "gone.bin.part0002"} {
+		writeTestFile(t, filepath.Join(dst, part), "part", time.Now())
+	}
+
+	fs := NewFileSync(src, dst, true, WithSplitSize(10))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listNames(t, dst), []string{"keep.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("target = %v, want %v", got, want)
+	}
+	if got := fs.Stats().FilesDeleted; got != 1 {
+		t.Errorf("FilesDeleted = %d, want 1 for the whole split file", got)
+	}
+}
+
+func TestFileSync_JoinParts(t *testing.T) {
+	tmp := t.TempDir()
+	split := filepath.Join(tmp, "split")
+	joined := filepath.Join(tmp, "joined")
+	content := strings.Repeat("x", 25) + "end"
+	writeTestFile(t, filepath.Join(split, "orig", "big.bin"), content, time.Now().Add(-time.Hour))
+
+	if err := NewFileSync(filepath.Join(split, "orig"), filepath.Join(split, "parts"), false, WithSplitSize(10)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewFileSync(filepath.Join(split, "parts"), joined, false, WithJoinParts(true), WithChecksum(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listNames(t, joined), []string{"big.bin"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("joined target = %v, want %v", got, want)
+	}
+	data, err := os.ReadFile(filepath.Join(joined, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("joined content = %q, want %q", data, content)
+	}
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 0 {
+		t.Errorf("second run copied %d file(s), want 0", got)
+	}
+}
+
+func TestSplitReaderSeek(t *testing.T) {
+	dir := t.TempDir()
+	for i, part := range []string{"0123", "4567", "89"} {
+		writeTestFile(t, partName(filepath.Join(dir, "f"), i+1), part, time.Now())
+	}
+	fsys := &splitFS{FS: LocalFS()}
+	f, err := fsys.Open(filepath.Join(dir, "f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, offset := range []int64{6, 0, 4, 9, 10} {
+		if _, err := f.Seek(offset, 0); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 10)
+		n, _ := io.ReadFull(f, buf)
+		if got, want := string(buf[:n]), "0123456789"[offset:]; got != want {
+			t.Errorf("read at %d = %q, want %q", offset, got, want)
+		}
+	}
+}
+
+func TestFileSync_SplitStreamingDelete(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "big.bin"), strings.Repeat("x", 25), time.Now())
+	writeTestFile(t, filepath.Join(src, "sub", "big.bin"), strings.Repeat("y", 25), time.Now())
+	for _, part := range []string{"gone.bin.part0001", "gone.bin.part0002"} {
+		writeTestFile(t, filepath.Join(dst, part), "part", time.Now())
+	}
+
+	// The streamed delete pass sees whole files too, so the parts of
+	// the synced ones are not orphans
+	fs := NewFileSync(src, dst, true, WithSplitSize(10), WithStreaming(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"big.bin.part0001", "big.bin.part0002", "big.bin.part0003", "sub"}
+	if got := listNames(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("target = %v, want %v", got, want)
+	}
+	if got := listNames(t, filepath.Join(dst, "sub")); len(got) != 3 {
+		t.Errorf("target/sub = %v, want three parts", got)
+	}
+	if got := fs.Stats().FilesDeleted; got != 1 {
+		t.Errorf("FilesDeleted = %d, want 1 for the whole split file", got)
+	}
+}
+
+func TestFileSync_SplitLocalChecks(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "big.bin"), strings.Repeat("0123456789", 3), time.Now().Add(-time.Hour))
+
+	// Split files still live on a local target, so it can be locked
+	fs := NewFileSync(src, dst, false, WithSplitSize(10), WithLock(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs() with split size and locking = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "big.bin.part0003")); err != nil {
+		t.Error(err)
+	}
+
+	// and its free space checked
+	os.RemoveAll(dst)
+	fs = NewFileSync(src, dst, false, WithSplitSize(10), WithFreeSpaceCheck(true), WithFreeSpaceReserve(1<<62))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().NoSpace; len(got) != 1 {
+		t.Errorf("NoSpace = %v, want big.bin skipped", got)
+	}
+}
@@ -0,0 +1,180 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Stats summarizes the outcome of the last SyncDirs run.
+type Stats struct {
+	FilesCopied      int   // new or updated files written to target
+	FilesSkipped     int   // files already up to date
+	FilesDeleted     int   // orphaned files removed from target
+	DirsCreated      int   // directories created in target
+	DirsDeleted      int   // empty orphaned directories removed from target
+	BytesCopied      int64 // total size of copied files
+	FilesLinked      int   // unchanged files hard-linked from the previous snapshot
+	FilesTooOld      int   // source files older than the WithModifiedSince cutoff
+	FilesNotAccessed int   // source files not accessed within the WithAccessedSince window
+	FilesDeduped     int   // copies hard-linked to an identical file with WithDedup
+	FilesByOwner     int   // source files skipped by WithExcludeOwner or WithExcludeGroup
+	FilesNotInTarget int   // source files skipped by WithExistingOnly for lack of a target counterpart
+	FilesRenamed     int   // orphans moved into place of new files with WithDetectRenames
+	Workers          int   // comparison workers used, as tuned with WithAutoWorkers
+
+	// ClockSkew is how far ahead of this host's clock, negative for
+	// behind, the target stamped a probe file with WithClockCheck.
+	ClockSkew time.Duration
+
+	// LoadThrottled is how long WithLoadThrottle held back copies for a
+	// high system load.
+	LoadThrottled time.Duration
+
+	// Snapshot is the directory created by the run in snapshot mode.
+	Snapshot string
+
+	// Conflicts lists the files (relative paths) that changed on both
+	// sides in two-way mode and were skipped rather than resolved.
+	Conflicts []string
+
+	// ChangedDuringCopy lists the files (relative paths) that were
+	// modified while being copied, even after any retries. Each one
+	// also has a *CopyError wrapping ErrChangedDuringCopy in Errors.
+	ChangedDuringCopy []string
+
+	// Drifted lists the files (relative paths) that ApplyPlan did not
+	// copy because their source changed since the plan was made. Each
+	// one also has a *CopyError wrapping ErrPlanDrift in Errors.
+	Drifted []string
+
+	// Locked lists the files (relative paths) skipped with
+	// WithSkipLocked because another process held them locked. They are
+	// not errors; the next run tries them again.
+	Locked []string
+
+	// Special lists the named pipes, sockets and device nodes (relative
+	// paths) that were skipped rather than recreated; see
+	// WithSpecialFiles.
+	Special []string
+
+	// Vetoed lists the files (relative paths) the WithBeforeCopy hook
+	// chose not to copy.
+	Vetoed []string
+
+	// BrokenSymlinks lists the source symlinks (relative paths) that
+	// were skipped because their destination does not exist; see
+	// WithPreserveSymlinks for copying them as links instead.
+	BrokenSymlinks []string
+
+	// Protected lists the orphaned target entries (relative paths)
+	// that delete-missing kept because they match AddProtect.
+	Protected []string
+
+	// KeptByPolicy lists the orphaned target files (relative paths)
+	// that the WithDeletePolicy callback kept.
+	KeptByPolicy []string
+
+	// BackedUp lists the orphaned target files (relative paths) that
+	// the WithDeletePolicy callback had moved to the trash. They are
+	// counted in FilesDeleted as well.
+	BackedUp []string
+
+	// ForReview lists the orphaned target files (relative paths) that
+	// the WithDeletePolicy callback left in place for manual review.
+	ForReview []string
+
+	// SymlinkCycles lists the source symlinks (relative paths) to
+	// directories that were not followed because they point back to
+	// one of their own ancestors; see WithFollowSymlinks.
+	SymlinkCycles []string
+
+	// SameFile lists the files (relative paths) skipped because their
+	// target path is the source file itself, on the same device and
+	// inode, e.g. through a hard link or a bind mount.
+	SameFile []string
+
+	// Invalid lists the copied files (relative paths) the WithValidate
+	// hook rejected. Each one also has a *ValidationError in Errors.
+	Invalid []string
+
+	// Spared lists the orphans (relative paths) the delete pass left
+	// alone because they were added or changed in the target during the
+	// run; see WithDeletePreexistingOnly.
+	Spared []string
+
+	// Unconfirmed lists the target entries (relative paths) the delete
+	// pass kept because a source could not be stat'ed, so they might
+	// not be gone from it; their *StatError is in Errors.
+	Unconfirmed []string
+
+	// Placeholders lists the empty source files (relative paths) that
+	// were not copied over non-empty target files; see
+	// WithEmptyPlaceholders.
+	Placeholders []string
+
+	// NoSpace lists the files (relative paths) skipped by the free-space
+	// check. Each one also has a *CopyError wrapping
+	// ErrInsufficientSpace in Errors.
+	NoSpace []string
+
+	// OverCap lists the files (relative paths) skipped because they
+	// would take the target past WithTargetSizeCap, and Evicted the
+	// target files deleted to make room with WithEviction.
+	OverCap []string
+	Evicted []string
+
+	// Truncated is set when WithMaxFilesPerRun stopped the copying
+	// early; FilesRemaining is how many more files needed copying.
+	Truncated      bool
+	FilesRemaining int
+
+	// FullCheck is set when the run compared contents in full, as
+	// WithPeriodicVerify does every few runs, rather than doing the
+	// cheap size and mod time check.
+	FullCheck bool
+
+	// TreeHash is the Merkle-style root over the target's files after
+	// the run, hex-encoded; it is only computed with WithTreeHash.
+	TreeHash string
+
+	// Timings says where the run spent its time; it is only filled
+	// in with WithProfile.
+	Timings Timings
+
+	// Errors holds every per-file error that was logged and skipped,
+	// as a *CopyError, *CompareError, *DeleteError, *MkdirError,
+	// *ValidationError, *StatError or *WalkError.
+	Errors []error
+}
+
+// Err returns all per-file errors joined into one, or nil if none occurred.
+func (s Stats) Err() error {
+	return errors.Join(s.Errors...)
+}
+
+// Stats returns the statistics of the most recent SyncDirs, ApplyPlan
+// or ExportTar run.
+func (fs *FileSync) Stats() Stats {
+	return fs.stats
+}
+
+// recordError adds a per-file error to the current run's stats.
+func (fs *FileSync) recordError(err error) {
+	fs.stats.Errors = append(fs.stats.Errors, err)
+	fs.traceFailure(err)
+	fs.spanError(err)
+}
+
+// ErrTooManyErrors is returned, together with the aggregate of the
+// per-file errors, by a run that WithMaxErrors stopped.
+var ErrTooManyErrors = errors.New("too many errors")
+
+// errorLimit returns ErrTooManyErrors once the run has collected the
+// WithMaxErrors number of per-file errors, and nil before.
+func (fs *FileSync) errorLimit() error {
+	if fs.maxErrors <= 0 || len(fs.stats.Errors) < fs.maxErrors {
+		return nil
+	}
+	return fmt.Errorf("%w, stopped after %d: %w", ErrTooManyErrors, len(fs.stats.Errors), fs.stats.Err())
+}
@@ -0,0 +1,181 @@
+package filesync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// statusShutdownTimeout bounds how long the status server waits for
+// in-flight requests when the sync is done.
+const statusShutdownTimeout = 5 * time.Second
+
+// Status is the state of a sync as served on /status by the status
+// server (see WithStatusServer). The progress fields describe the copy
+// phase of the current run, like Progress; the counts are those of
+// Stats so far.
+type Status struct {
+	Running     bool    `json:"running"`
+	Paused      bool    `json:"paused"`
+	CurrentFile string  `json:"current_file,omitempty"`
+	FilesDone   int     `json:"files_done"`
+	FilesTotal  int     `json:"files_total"`
+	BytesDone   int64   `json:"bytes_done"`
+	BytesTotal  int64   `json:"bytes_total"`
+	Rate        float64 `json:"rate_bytes_per_second"`
+	ETASeconds  float64 `json:"eta_seconds"`
+
+	FilesCopied  int `json:"files_copied"`
+	FilesSkipped int `json:"files_skipped"`
+	FilesDeleted int `json:"files_deleted"`
+	Errors       int `json:"errors"`
+}
+
+// statusBoard holds the Status shared between the sync and the
+// status server's handlers.
+type statusBoard struct {
+	mu     sync.Mutex
+	status Status
+}
+
+// update changes the status under the lock.
+func (b *statusBoard) update(fn func(*Status)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fn(&b.status)
+}
+
+// get returns a copy of the status.
+func (b *statusBoard) get() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status
+}
+
+// countStats copies the counts of the current run into the status.
+func (fs *FileSync) countStats(s *Status) {
+	s.FilesCopied = fs.stats.FilesCopied
+	s.FilesSkipped = fs.stats.FilesSkipped
+	s.FilesDeleted = fs.stats.FilesDeleted
+	s.Errors = len(fs.stats.Errors)
+}
+
+// beginStatus marks a run as started on the status board, if any, and
+// returns the function marking it finished.
+func (fs *FileSync) beginStatus() func() {
+	board := fs.statusBoard
+	if board == nil {
+		return func() {}
+	}
+	board.update(func(s *Status) { *s = Status{Running: true} })
+	return func() {
+		board.update(func(s *Status) {
+			s.Running = false
+			s.CurrentFile = ""
+			s.Rate, s.ETASeconds = 0, 0
+			fs.countStats(s)
+		})
+	}
+}
+
+// reportProgress passes copy progress to the status board and to the
+// WithProgress callback, whichever are set.
+func (fs *FileSync) reportProgress(p Progress) {
+	if board := fs.statusBoard; board != nil {
+		board.update(func(s *Status) {
+			s.CurrentFile = p.Path
+			s.FilesDone, s.FilesTotal = p.FilesDone, p.FilesTotal
+			s.BytesDone, s.BytesTotal = p.BytesDone, p.BytesTotal
+			s.Rate, s.ETASeconds = p.Rate, p.ETA.Seconds()
+			fs.countStats(s)
+		})
+	}
+	if fs.onProgress != nil {
+		fs.onProgress(p)
+	}
+}
+
+// statusHandler serves /status as JSON, /metrics in the Prometheus
+// text format, and /healthz, and takes POST /pause and /resume.
+func (fs *FileSync) statusHandler(board *statusBoard) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		status := board.get()
+		status.Paused = fs.Paused()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		fs.Pause()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		fs.Resume()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, fs.Metrics())
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+// serveStatus starts the status server when one is configured and
+// returns the function that shuts it down. While it runs, nested
+// calls (Watch running SyncDirs) share it.
+func (fs *FileSync) serveStatus() (func(), error) {
+	if fs.statusAddr == "" || fs.statusBoard != nil {
+		return func() {}, nil
+	}
+	ln, err := net.Listen("tcp", fs.statusAddr)
+	if err != nil {
+		return nil, err
+	}
+	board := &statusBoard{}
+	srv := &http.Server{Handler: fs.statusHandler(board), ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	fs.statusBoard = board
+	log.Printf("🌐 Serving status on http://%s/status", ln.Addr())
+
+	return func() {
+		fs.statusBoard = nil
+		ctx, cancel := context.WithTimeout(context.Background(), statusShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
+
+// writeMetrics renders m in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, m Metrics) {
+	unix := func(t time.Time) float64 {
+		if t.IsZero() {
+			return 0
+		}
+		return float64(t.UnixNano()) / 1e9
+	}
+	for _, metric := range []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"filesync_runs_total", "counter", "Sync runs finished.", float64(m.Runs)},
+		{"filesync_failed_runs_total", "counter", "Sync runs that returned an error.", float64(m.FailedRuns)},
+		{"filesync_files_copied_total", "counter", "Files written to the target.", float64(m.FilesCopied)},
+		{"filesync_files_deleted_total", "counter", "Files removed from the target.", float64(m.FilesDeleted)},
+		{"filesync_bytes_copied_total", "counter", "Bytes written to the target.", float64(m.BytesCopied)},
+		{"filesync_errors_total", "counter", "Per-file errors.", float64(m.Errors)},
+		{"filesync_last_run_duration_seconds", "gauge", "Duration of the latest run.", m.LastRunDuration.Seconds()},
+		{"filesync_last_run_timestamp_seconds", "gauge", "End of the latest run, as a Unix time.", unix(m.LastRunEnd)},
+		{"filesync_last_success_timestamp_seconds", "gauge", "End of the latest run without errors, as a Unix time.", unix(m.LastSuccess)},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", metric.name, metric.help, metric.name, metric.kind, metric.name, metric.value)
+	}
+}
@@ -0,0 +1,94 @@
+package filesync
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_StatusServer(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "aaaa", time.Now())
+	writeTestFile(t, filepath.Join(src, "b.txt"), "bb", time.Now())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	// Query the server from the middle of the copy phase
+	var status Status
+	var health int
+	queried := false
+	onProgress := func(p Progress) {
+		if queried || p.FilesDone != 1 {
+			return
+		}
+		queried = true
+		resp, err := http.Get("http://" + addr + "/healthz")
+		if err != nil {
+			t.Errorf("healthz: %v", err)
+			return
+		}
+		resp.Body.Close()
+		health = resp.StatusCode
+
+		resp, err = http.Get("http://" + addr + "/status")
+		if err != nil {
+			t.Errorf("status: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Errorf("decoding status: %v", err)
+		}
+	}
+
+	fs := NewFileSync(src, filepath.Join(tmp, "dst"), false, WithStatusServer(addr), WithProgress(onProgress))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if !queried {
+		t.Fatal("progress callback never saw the first file finish")
+	}
+	if health != http.StatusOK {
+		t.Errorf("healthz status = %d, want 200", health)
+	}
+	if !status.Running || status.FilesDone != 1 || status.FilesTotal != 2 || status.BytesTotal != 6 {
+		t.Errorf("status mid-copy = %+v, want running with 1 of 2 files and 6 bytes total", status)
+	}
+
+	// The server is gone once the sync returned
+	if resp, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		resp.Body.Close()
+		t.Error("status server still answering after SyncDirs returned")
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	fs := NewFileSync(t.TempDir(), t.TempDir(), false)
+	fs.statusBoard = &statusBoard{}
+	done := fs.beginStatus()
+	fs.stats.FilesCopied = 3
+	done()
+
+	rec := httptest.NewRecorder()
+	fs.statusHandler(fs.statusBoard).ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var status Status
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Running || status.FilesCopied != 3 {
+		t.Errorf("status after run = %+v, want finished with 3 files copied", status)
+	}
+}
@@ -0,0 +1,119 @@
+package filesync
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// streamBatch is how many directory entries walkDirStreaming reads at
+// a time, which bounds its memory use per directory level.
+const streamBatch = 256
+
+// dirReader is implemented by files that list a directory in batches,
+// like *os.File.
+type dirReader interface {
+	ReadDir(n int) ([]os.DirEntry, error)
+}
+
+// walkTarget walks root on the target for the delete pass, streaming
+// with WithStreaming and in the configured order otherwise.
+func (fs *FileSync) walkTarget(root string, fn func(path string, d os.DirEntry, err error) error) error {
+	if fs.streaming {
+		return walkDirStreaming(fs.tgtFS, root, fn)
+	}
+	return fs.walk(fs.tgtFS, root, fn)
+}
+
+// walkDirStreaming is walkDir reading each directory streamBatch
+// entries at a time, and visiting them in the order the filesystem
+// returns them instead of sorting a full listing first. Only one batch
+// per open directory is held in memory, however many entries it has.
+// An FS whose files cannot list a directory incrementally, like
+// MemFS, is read with ReadDir, a directory at a time.
+func walkDirStreaming(fsys FS, root string, fn func(path string, d os.DirEntry, err error) error) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = streamDirEntry(fsys, root, dirEntry{info}, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// streamDirEntry visits path and, for directories, everything below
+// it, like walkDirEntry.
+func streamDirEntry(fsys FS, path string, d os.DirEntry, fn func(string, os.DirEntry, error) error) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		return streamDirError(path, d, err, fn)
+	}
+	defer f.Close()
+	dr, ok := f.(dirReader)
+	if !ok {
+		entries, err := fsys.ReadDir(path)
+		if err != nil {
+			return streamDirError(path, d, err, fn)
+		}
+		return skipRest(streamEntries(fsys, path, entries, fn))
+	}
+	split, _ := fsys.(*splitFS)
+	for {
+		entries, err := dr.ReadDir(streamBatch)
+		if split != nil && len(entries) > 0 {
+			// Batches list the parts of split files, not the files
+			var joinErr error
+			entries, joinErr = split.joinEntries(path, entries, func(base string) bool {
+				_, err := split.FS.Lstat(filepath.Join(path, base))
+				return err == nil
+			})
+			if joinErr != nil {
+				return streamDirError(path, d, joinErr, fn)
+			}
+		}
+		if visitErr := streamEntries(fsys, path, entries, fn); visitErr != nil || err == io.EOF {
+			return skipRest(visitErr)
+		}
+		if err != nil {
+			return streamDirError(path, d, err, fn)
+		}
+	}
+}
+
+// streamEntries visits a batch of the entries of the directory path.
+func streamEntries(fsys FS, path string, entries []os.DirEntry, fn func(string, os.DirEntry, error) error) error {
+	for _, entry := range entries {
+		if err := streamDirEntry(fsys, filepath.Join(path, entry.Name()), entry, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipRest turns a SkipDir from an entry, which skips the rest of its
+// directory, into the end of the walk of that directory.
+func skipRest(err error) error {
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// streamDirError reports an error listing the directory path with a
+// second call of fn, like walkDirEntry.
+func streamDirError(path string, d os.DirEntry, err error, fn func(string, os.DirEntry, error) error) error {
+	if err = fn(path, d, err); err == filepath.SkipDir {
+		err = nil
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package filesync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_StreamingDelete(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, "flat", "keep.txt"), "k", now)
+	// More orphans than fit in one batch, and a nested orphan tree
+	orphans := 3*streamBatch + 1
+	for i := range orphans {
+		writeTestFile(t, filepath.Join(dst, "flat", fmt.Sprintf("old-%04d", i)), "o", now)
+	}
+	writeTestFile(t, filepath.Join(dst, "flat", "sub", "deep.txt"), "o", now)
+
+	fs := NewFileSync(src, dst, true, WithStreaming(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesDeleted; got != orphans+1 {
+		t.Errorf("FilesDeleted = %d, want %d", got, orphans+1)
+	}
+	entries, err := os.ReadDir(filepath.Join(dst, "flat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// The emptied sub directory is left, as without streaming
+	if len(names) != 2 || names[0] != "keep.txt" || names[1] != "sub" {
+		t.Errorf("target entries = %v, want [keep.txt sub]", names)
+	}
+}
+
+func TestFileSync_StreamingDeleteMemFS(t *testing.T) {
+	now := time.Now()
+	mem := NewMemFS()
+	mem.WriteFile("/src/keep.txt", []byte("k"), now)
+	mem.WriteFile("/dst/dir/stale.txt", []byte("s"), now)
+	mem.WriteFile("/dst/stale.txt", []byte("s"), now)
+
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithStreaming(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, gone := range []string{"/dst/dir/stale.txt", "/dst/stale.txt"} {
+		if _, err := mem.Stat(gone); err == nil {
+			t.Errorf("orphan %s kept", gone)
+		}
+	}
+	if _, err := mem.Stat("/dst/keep.txt"); err != nil {
+		t.Errorf("source file not copied: %v", err)
+	}
+}
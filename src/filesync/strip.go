@@ -0,0 +1,61 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsidePrefix is returned, wrapped, when WithRequirePrefix is set
+// and a source holds entries outside the WithStripPrefix prefix.
+var ErrOutsidePrefix = errors.New("source entries outside the stripped prefix")
+
+// strippedRoot returns the directory of root that is synced to the
+// target root, which is root itself unless WithStripPrefix is set.
+func (fs *FileSync) strippedRoot(root string) string {
+	if fs.stripPrefix == "" {
+		return root
+	}
+	return filepath.Join(root, fs.stripPrefix)
+}
+
+// checkStripPrefix validates the WithStripPrefix prefix, which every
+// source must hold, so a mistyped prefix is not taken for an emptied
+// source that delete-missing would mirror, and, with
+// WithRequirePrefix, makes sure every source holds nothing beside it.
+// Only the directories along the prefix are listed, so the check does
+// not cost a walk of the tree.
+func (fs *FileSync) checkStripPrefix() error {
+	if fs.stripPrefix == "" {
+		return nil
+	}
+	if !filepath.IsLocal(fs.stripPrefix) {
+		return fmt.Errorf("strip prefix %q is not a relative path inside the source", fs.stripPrefix)
+	}
+	for _, root := range append([]string{fs.source}, fs.extraSources...) {
+		if _, err := fs.srcFS.Stat(fs.strippedRoot(root)); err != nil {
+			return fmt.Errorf("strip prefix %q in source %s: %w", fs.stripPrefix, root, err)
+		}
+	}
+	if !fs.requirePrefix {
+		return nil
+	}
+	segments := strings.Split(fs.stripPrefix, string(filepath.Separator))
+	for _, root := range append([]string{fs.source}, fs.extraSources...) {
+		dir := root
+		for _, segment := range segments {
+			entries, err := fs.srcFS.ReadDir(dir)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if name := entry.Name(); name != segment && name != syncIgnoreName {
+					return fmt.Errorf("%w: %s", ErrOutsidePrefix, filepath.Join(dir, name))
+				}
+			}
+			dir = filepath.Join(dir, segment)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_StripPrefix(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "project", "dist", "app.js"), "app", old)
+	writeTestFile(t, filepath.Join(src, "project", "dist", "css", "site.css"), "css", old)
+	writeTestFile(t, filepath.Join(src, "project", "main.go"), "go", old)
+	writeTestFile(t, filepath.Join(dst, "stale.js"), "stale", old)
+
+	fs := NewFileSync(src, dst, true, WithStripPrefix("project/dist"))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs() = %v", err)
+	}
+	for name, want := range map[string]string{"app.js": "app", filepath.Join("css", "site.css"): "css"} {
+		if got := readTestFile(t, filepath.Join(dst, name)); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	for _, name := range []string{"project", "main.go", "stale.js"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be in the target: %v", name, err)
+		}
+	}
+
+	// Requiring the prefix turns the left-out main.go into an error
+	writeTestFile(t, filepath.Join(src, "project", "dist", "new.js"), "new", old)
+	fs = NewFileSync(src, dst, true, WithStripPrefix("project/dist"), WithRequirePrefix(true))
+	if err := fs.SyncDirs(); !errors.Is(err, ErrOutsidePrefix) {
+		t.Fatalf("SyncDirs() = %v, want ErrOutsidePrefix", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "new.js")); !os.IsNotExist(err) {
+		t.Errorf("new.js was copied despite the failed prefix check: %v", err)
+	}
+	if err := os.Remove(filepath.Join(src, "project", "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatalf("SyncDirs() with only the prefix = %v", err)
+	}
+
+	// A mistyped prefix is an error, not an empty source to mirror
+	fs = NewFileSync(src, dst, true, WithStripPrefix("project/dsit"))
+	if err := fs.SyncDirs(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("SyncDirs() with a missing prefix = %v, want os.ErrNotExist", err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "app.js")); got != "app" {
+		t.Errorf("app.js = %q after the missing prefix", got)
+	}
+
+	for _, prefix := range []string{"../other", "/abs"} {
+		fs = NewFileSync(src, dst, false, WithStripPrefix(prefix))
+		if err := fs.SyncDirs(); err == nil {
+			t.Errorf("WithStripPrefix(%q) should be rejected", prefix)
+		}
+	}
+}
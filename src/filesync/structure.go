@@ -0,0 +1,124 @@
+package filesync
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// StructureReport is the outcome of CheckStructure. Paths are relative
+// to the target root.
+type StructureReport struct {
+	// Orphaned lists the target directories that no source has, the
+	// outermost of each orphaned subtree only.
+	Orphaned []string
+
+	// Pruned lists the orphaned directories removed because they held
+	// no files, only empty directories if anything. Orphaned
+	// directories holding files are left for delete-missing.
+	Pruned []string
+
+	// Empty lists the empty target directories that the sources do
+	// have, which are legitimate and left alone.
+	Empty []string
+
+	// Errors holds the directories that could not be checked or
+	// pruned, as a *StatError, *WalkError or *DeleteError.
+	Errors []error
+}
+
+// CheckStructure looks for target directories with no counterpart in
+// any source, such as ones left behind by syncs without delete-missing
+// after a source directory was renamed, without touching files. They
+// are told apart from directories that exist in the source but happen
+// to be empty, which are listed separately. Directories the filters or
+// the protect list leave out are not looked at. With prune, orphaned
+// directories holding no files are removed; in dry-run mode that is
+// only logged.
+//
+// Per-directory problems are collected in the report; the returned
+// error is for failures to connect and for ctx being cancelled.
+func (fs *FileSync) CheckStructure(ctx context.Context, prune bool) (*StructureReport, error) {
+	if err := fs.connect(); err != nil {
+		return nil, err
+	}
+	trees := fs.sourceTrees()
+	report := &StructureReport{}
+
+	err := fs.walk(fs.tgtFS, fs.target, func(path string, d os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if path == fs.target && os.IsNotExist(err) {
+				return filepath.SkipAll
+			}
+			report.Errors = append(report.Errors, &WalkError{Path: path, Err: err})
+			return nil
+		}
+		if !d.IsDir() || path == fs.target {
+			return nil
+		}
+		relPath, _ := filepath.Rel(fs.target, path)
+		if fs.isInternal(path) || fs.excludedEverywhere(trees, relPath, true) || fs.protected(relPath, true) {
+			return filepath.SkipDir
+		}
+
+		absent, err := sourceAbsent(trees, relPath)
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			return filepath.SkipDir
+		}
+		if !absent {
+			if entries, err := fs.tgtFS.ReadDir(path); err == nil && len(entries) == 0 {
+				report.Empty = append(report.Empty, relPath)
+			}
+			return nil
+		}
+
+		report.Orphaned = append(report.Orphaned, relPath)
+		holdsFiles, err := fs.holdsFiles(path)
+		switch {
+		case err != nil:
+			report.Errors = append(report.Errors, &WalkError{Path: path, Err: err})
+		case holdsFiles:
+			log.Printf("🏚️ Orphaned directory, holding files: %q", path)
+		case !prune:
+			log.Printf("🏚️ Orphaned directory: %q", path)
+		case fs.dryRun:
+			log.Printf("🔎 Would remove orphaned directory: %q", path)
+			report.Pruned = append(report.Pruned, relPath)
+		default:
+			if err := fs.removeTree(fs.tgtFS, path); err != nil {
+				log.Printf("❌ Failed to remove orphaned directory %q: %v", path, err)
+				report.Errors = append(report.Errors, &DeleteError{Path: path, Err: err})
+				break
+			}
+			log.Printf("🗑️ Removed orphaned directory: %q", path)
+			report.Pruned = append(report.Pruned, relPath)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// holdsFiles reports whether anything other than directories is below
+// the target directory dir.
+func (fs *FileSync) holdsFiles(dir string) (bool, error) {
+	found := false
+	err := fs.walk(fs.tgtFS, dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,68 @@
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_CheckStructure(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(src, "docs", "a.txt"), "a", now)
+	writeTestFile(t, filepath.Join(dst, "docs", "a.txt"), "a", now)
+	// Empty on both sides: legitimate
+	for _, dir := range []string{filepath.Join(src, "inbox"), filepath.Join(dst, "inbox")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Orphaned, holding only empty directories
+	if err := os.MkdirAll(filepath.Join(dst, "old", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Orphaned, holding a file
+	writeTestFile(t, filepath.Join(dst, "renamed", "sub", "b.txt"), "b", now)
+	// Excluded directories are not looked at
+	writeTestFile(t, filepath.Join(src, ".syncignore"), "cache/\n", now)
+	if err := os.MkdirAll(filepath.Join(dst, "cache"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileSync(src, dst, false)
+	report, err := fs.CheckStructure(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"old", "renamed"}; !reflect.DeepEqual(report.Orphaned, want) {
+		t.Errorf("Orphaned = %v, want %v", report.Orphaned, want)
+	}
+	if want := []string{"inbox"}; !reflect.DeepEqual(report.Empty, want) {
+		t.Errorf("Empty = %v, want %v", report.Empty, want)
+	}
+	if len(report.Pruned) != 0 || len(report.Errors) != 0 {
+		t.Errorf("Pruned = %v, Errors = %v; want none", report.Pruned, report.Errors)
+	}
+
+	report, err = fs.CheckStructure(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"old"}; !reflect.DeepEqual(report.Pruned, want) {
+		t.Errorf("Pruned = %v, want %v", report.Pruned, want)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "old")); !os.IsNotExist(err) {
+		t.Error("expected the empty orphaned directory to be removed")
+	}
+	for _, p := range []string{"renamed/sub/b.txt", "inbox", "cache"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Errorf("expected %s to be kept: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Suffixes of the directories next to the target used by WithSwap,
+// and of its lock file (see WithLock).
+const (
+	swapNewSuffix  = ".new"
+	swapOldSuffix  = ".old"
+	swapLockSuffix = ".lock"
+)
+
+// syncSwapped runs a sync for WithSwap: the whole tree is built in
+// target.new, with files unchanged since the live target hard-linked
+// from it, and then swapped into place with two renames, so readers of
+// the target never see a partial tree; it is only missing for the
+// instant between the renames. The live target is only touched once
+// the staged tree synced without errors.
+func (fs *FileSync) syncSwapped() error {
+	if err := fs.connect(); err != nil {
+		return err
+	}
+	if fs.snapshot || fs.bidirectional || fs.journal {
+		return errors.New("directory swaps cannot be combined with snapshots, two-way sync or the resume journal")
+	}
+
+	live := fs.target
+	staging, old := live+swapNewSuffix, live+swapOldSuffix
+
+	// The lock covers the staging and old trees too, so it is taken
+	// before either is touched, and sits next to the target, which is
+	// replaced as a whole
+	release, err := fs.acquireLockAt(live + swapLockSuffix)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	hasLive := false
+	if info, err := fs.tgtFS.Stat(live); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("target %s is not a directory", live)
+		}
+		hasLive = true
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// A staging tree left by a failed run is rebuilt from scratch, so
+	// every file in it is either fresh or a link to the live tree
+	if !fs.dryRun {
+		if err := fs.removeTree(fs.tgtFS, staging); err != nil {
+			return fmt.Errorf("remove stale staging directory: %w", err)
+		}
+	}
+	deleteMissing, lock := fs.deleteMissing, fs.lock
+	fs.target, fs.deleteMissing, fs.lock = staging, true, false
+	if hasLive {
+		fs.prevSnapshot = live
+	}
+	err = fs.syncScopes([]string{"."})
+	fs.target, fs.deleteMissing, fs.prevSnapshot, fs.lock = live, deleteMissing, "", lock
+	if err != nil {
+		return err
+	}
+	if n := len(fs.stats.Errors); n > 0 {
+		return fmt.Errorf("not swapping in %s: the staged tree has %d error(s)", staging, n)
+	}
+	if fs.dryRun {
+		log.Printf("🔎 Would swap %q into %q", staging, live)
+		return nil
+	}
+
+	if !hasLive {
+		if err := fs.tgtFS.Rename(staging, live); err != nil {
+			return err
+		}
+		log.Printf("🔀 Swapped in %q", live)
+		return nil
+	}
+	if err := fs.removeTree(fs.tgtFS, old); err != nil {
+		return fmt.Errorf("remove stale %s: %w", old, err)
+	}
+	if err := fs.tgtFS.Rename(live, old); err != nil {
+		return err
+	}
+	if err := fs.tgtFS.Rename(staging, live); err != nil {
+		// Put the old tree back rather than leave no target at all
+		if restoreErr := fs.tgtFS.Rename(old, live); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("restore %s: %w", live, restoreErr))
+		}
+		return err
+	}
+	log.Printf("🔀 Swapped in %q", live)
+	if err := fs.removeTree(fs.tgtFS, old); err != nil {
+		log.Printf("⚠️ Could not remove the previous tree %q: %v", old, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Swap(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "www")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "index.html"), "v1", old)
+	writeTestFile(t, filepath.Join(src, "static", "app.js"), "js", old)
+
+	// First deploy: no target yet
+	fs := NewFileSync(src, dst, false, WithSwap(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "index.html")); got != "v1" {
+		t.Errorf("index.html = %q, want %q", got, "v1")
+	}
+
+	// Keep a handle on the live tree's copy to check it is never rewritten
+	before, err := os.Stat(filepath.Join(dst, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src, "index.html"), "v2", time.Now())
+	writeTestFile(t, filepath.Join(dst, "stray.txt"), "stray", old)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "index.html")); got != "v2" {
+		t.Errorf("index.html = %q, want %q", got, "v2")
+	}
+	if got := readTestFile(t, filepath.Join(dst, "static", "app.js")); got != "js" {
+		t.Errorf("static/app.js = %q, want %q", got, "js")
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 1 || stats.FilesLinked != 1 {
+		t.Errorf("FilesCopied = %d, FilesLinked = %d, want 1 and 1", stats.FilesCopied, stats.FilesLinked)
+	}
+	if after, err := os.Stat(filepath.Join(dst, "index.html")); err != nil || os.SameFile(before, after) {
+		t.Errorf("changed file was written in place: %v", err)
+	}
+	for _, p := range []string{dst + ".new", dst + ".old", filepath.Join(dst, "stray.txt")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be gone, got %v", p, err)
+		}
+	}
+}
+
+func TestFileSync_SwapKeepsTargetOnErrors(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "www")
+	writeTestFile(t, filepath.Join(src, "index.html"), "v2", time.Now())
+	writeTestFile(t, filepath.Join(dst, "index.html"), "v1", time.Now().Add(-time.Hour))
+
+	// Every read of the source fails, so the staged tree is incomplete
+	fs := NewFileSync(src, dst, false, WithSwap(true), WithSourceFS(failingFS{FS: LocalFS()}))
+	if err := fs.SyncDirs(); err == nil {
+		t.Fatal("expected an error when the staged tree has errors")
+	}
+	if got := readTestFile(t, filepath.Join(dst, "index.html")); got != "v1" {
+		t.Errorf("index.html = %q, want %q", got, "v1")
+	}
+}
+
+// failingFS fails to open any file.
+type failingFS struct{ FS }
+
+func (failingFS) Open(name string) (File, error) {
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+}
+
+func TestFileSync_SwapLocksFirst(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "www")
+	writeTestFile(t, filepath.Join(src, "index.html"), "v1", time.Now())
+	if err := NewFileSync(src, dst, false, WithSwap(true), WithLock(true)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another deploy is staging its tree and holds the lock
+	writeTestFile(t, filepath.Join(dst+swapNewSuffix, "index.html"), "staged", time.Now())
+	holder := NewFileSync(src, dst, false, WithLock(true))
+	release, err := holder.acquireLockAt(dst + swapLockSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	fs := NewFileSync(src, dst, false, WithSwap(true), WithLock(true))
+	if err := fs.SyncDirs(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("SyncDirs error = %v, want ErrLocked", err)
+	}
+	if got := readTestFile(t, filepath.Join(dst+swapNewSuffix, "index.html")); got != "staged" {
+		t.Errorf("the other deploy's staging tree was touched: index.html = %q", got)
+	}
+}
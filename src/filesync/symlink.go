@@ -0,0 +1,160 @@
+package filesync
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// symlinker is implemented by filesystems that can read and create
+// symbolic links.
+type symlinker interface {
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+}
+
+// isSymlink reports whether d is a symbolic link.
+func isSymlink(d os.DirEntry) bool {
+	return d.Type()&os.ModeSymlink != 0
+}
+
+// skipBrokenSymlink handles a source symlink whose destination does
+// not exist when links are dereferenced: there is nothing to copy, so
+// it is skipped with a warning rather than reported as an error
+// (though WithFailOnAccessError still stops the sync at it).
+func (fs *FileSync) skipBrokenSymlink(srcFS FS, relPath, srcPath string) {
+	dest := "?"
+	if r, ok := srcFS.(symlinker); ok {
+		if d, err := r.Readlink(srcPath); err == nil {
+			dest = d
+		}
+	}
+	log.Printf("⚠️ Skipping broken symlink: %q → %q", srcPath, dest)
+	fs.stats.BrokenSymlinks = append(fs.stats.BrokenSymlinks, relPath)
+}
+
+// unlinkTargetSymlink removes a symlink at the target path dst before
+// a copy is written there, so the copy replaces the link rather than
+// going through it to wherever it points, unless
+// WithFollowTargetSymlinks. Atomic copies rename over the link and
+// need no help.
+func (fs *FileSync) unlinkTargetSymlink(dst string) error {
+	if fs.followTargetLinks {
+		return nil
+	}
+	info, err := fs.tgtFS.Lstat(dst)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return fs.tgtFS.Remove(dst)
+}
+
+// syncSymlink recreates a source symlink in the target with the same
+// destination, verbatim and whether or not that exists, for
+// WithPreserveSymlinks. A target entry that is not already the same
+// link is replaced.
+func (fs *FileSync) syncSymlink(srcFS FS, relPath, srcPath, targetPath string) {
+	reader, canRead := srcFS.(symlinker)
+	writer, canWrite := fs.tgtFS.(symlinker)
+	if !canRead || !canWrite {
+		log.Printf("⚠️ Skipping symlink, the filesystem cannot recreate it: %q", srcPath)
+		fs.stats.FilesSkipped++
+		return
+	}
+	dest, err := reader.Readlink(srcPath)
+	if err != nil {
+		log.Printf("❌ Could not read symlink %q: %v", srcPath, err)
+		fs.recordError(&StatError{Path: srcPath, Err: err})
+		return
+	}
+
+	kind := ActionAdd
+	tgtInfo, err := fs.tgtFS.Lstat(targetPath)
+	if err == nil {
+		if tgtInfo.Mode()&os.ModeSymlink != 0 {
+			if current, err := writer.Readlink(targetPath); err == nil && current == dest {
+				fs.stats.FilesSkipped++
+				return
+			}
+		}
+		kind = ActionModify
+	}
+	if fs.dryRun {
+		log.Printf("🔎 Would create symlink: %q → %q", targetPath, dest)
+		fs.recordAction(kind, relPath, false, "")
+		fs.stats.FilesCopied++
+		return
+	}
+
+	fs.createPendingDirs(relPath)
+	if err == nil {
+		rm := fs.removeEntry
+		if tgtInfo.IsDir() {
+			rm = fs.removeTree
+		}
+		if rmErr := rm(fs.tgtFS, targetPath); rmErr != nil {
+			log.Printf("❌ Failed to remove %q: %v", targetPath, rmErr)
+			fs.recordError(&DeleteError{Path: targetPath, Err: rmErr})
+			return
+		}
+	}
+	if err := writer.Symlink(dest, targetPath); err != nil {
+		log.Printf("❌ Failed to create symlink %q: %v", targetPath, err)
+		fs.recordError(&CopyError{Src: srcPath, Dst: targetPath, Err: err})
+		return
+	}
+	log.Printf("🔗 Created symlink: %q → %q", targetPath, dest)
+	fs.recordAction(kind, relPath, false, "")
+	fs.stats.FilesCopied++
+}
+
+// followDirLinks wraps the walk callback fn of a walk below root for
+// WithFollowSymlinks: a symlink to a directory is walked as the
+// directory it points to, with the paths passed to fn kept below the
+// link. The real paths of the directories links were followed from
+// are tracked: a link that resolves to one of them, or to a directory
+// holding its own location, would make the walk endless, so it is
+// skipped with a warning and listed in Stats.SymlinkCycles. Only local
+// sources are followed. The sync and Diff walk the sources through
+// it; the delete pass needs no following, as looking up a path below a
+// link resolves the link.
+func (fs *FileSync) followDirLinks(fsys FS, root string, fn func(path string, d os.DirEntry, err error) error) func(path string, d os.DirEntry, err error) error {
+	if _, local := fsys.(osFS); !local || !fs.followSymlinks || fs.preserveSymlinks {
+		return fn
+	}
+	var follow func(chain []string) func(path string, d os.DirEntry, err error) error
+	follow = func(chain []string) func(path string, d os.DirEntry, err error) error {
+		return func(path string, d os.DirEntry, err error) error {
+			if err != nil || !isSymlink(d) {
+				return fn(path, d, err)
+			}
+			info, statErr := statOf(fsys, path, d)
+			if statErr != nil || !info.IsDir() {
+				return fn(path, d, nil)
+			}
+			real, realErr := filepath.EvalSymlinks(path)
+			var parent string
+			if realErr == nil {
+				parent, realErr = filepath.EvalSymlinks(filepath.Dir(path))
+			}
+			if realErr != nil {
+				return fn(path, d, realErr)
+			}
+			seen := append(chain[:len(chain):len(chain)], parent)
+			for _, dir := range seen {
+				if withinScope(dir, real) {
+					relPath, _ := filepath.Rel(root, path)
+					log.Printf("🔁 Symlink cycle detected, skipping: %q → %q", path, real)
+					fs.stats.SymlinkCycles = append(fs.stats.SymlinkCycles, relPath)
+					return nil
+				}
+			}
+			below := follow(seen)
+			return fs.walkTree(fsys, real, true, nil, func(p string, d os.DirEntry, err error) error {
+				rel, _ := filepath.Rel(real, p)
+				return below(filepath.Join(path, rel), d, err)
+			})
+		}
+	}
+	return follow(nil)
+}
@@ -0,0 +1,80 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_BrokenSymlinkSkipped(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "ok.txt"), "ok", time.Now())
+	if err := os.Symlink(filepath.Join(tmp, "missing"), filepath.Join(src, "broken")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	// The target's copy from when the link still resolved is kept
+	writeTestFile(t, filepath.Join(dst, "broken"), "old", time.Now())
+
+	fs := NewFileSync(src, dst, true)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if len(stats.BrokenSymlinks) != 1 || stats.BrokenSymlinks[0] != "broken" {
+		t.Errorf("BrokenSymlinks = %v, want [broken]", stats.BrokenSymlinks)
+	}
+	if len(stats.Errors) != 0 || stats.FilesCopied != 1 {
+		t.Errorf("copied %d with errors %v, want 1 and none", stats.FilesCopied, stats.Errors)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "broken")); got != "old" {
+		t.Errorf("target broken = %q, want it kept", got)
+	}
+}
+
+func TestFileSync_PreserveSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "real.txt"), "real", time.Now())
+	links := map[string]string{
+		"rel":             "real.txt",
+		"dangling":        "../nowhere/gone.txt",
+		"sub/replaced":    "../real.txt",
+		"absolute-broken": filepath.Join(tmp, "missing"),
+	}
+	for name, dest := range links {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(dest, filepath.Join(src, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	// A regular file where a link belongs is replaced
+	writeTestFile(t, filepath.Join(dst, "sub", "replaced"), "stale", time.Now())
+
+	fs := NewFileSync(src, dst, true, WithPreserveSymlinks(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range links {
+		got, err := os.Readlink(filepath.Join(dst, name))
+		if err != nil || got != want {
+			t.Errorf("%s → %q (%v), want %q", name, got, err, want)
+		}
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 5 || len(stats.BrokenSymlinks) != 0 {
+		t.Errorf("copied %d, broken %v; want 5 and none", stats.FilesCopied, stats.BrokenSymlinks)
+	}
+
+	// Links already in place are left alone, and never deleted
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := fs.Stats(); stats.FilesCopied != 0 || stats.FilesDeleted != 0 || stats.FilesSkipped != 5 {
+		t.Errorf("second run copied %d, deleted %d, skipped %d; want 0, 0, 5", stats.FilesCopied, stats.FilesDeleted, stats.FilesSkipped)
+	}
+}
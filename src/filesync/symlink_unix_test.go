@@ -0,0 +1,146 @@
+//go:build unix
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFileSync_FollowSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a", "file.txt"), "a", time.Now())
+	writeTestFile(t, filepath.Join(src, "b", "file.txt"), "b", time.Now())
+	writeTestFile(t, filepath.Join(tmp, "shared", "lib.txt"), "lib", time.Now())
+	// An ancestor, two directories linking to each other, and a
+	// directory outside the source, which is no cycle
+	for link, dest := range map[string]string{
+		"a/up":     "..",
+		"a/to-b":   "../b",
+		"b/to-a":   "../a",
+		"a/shared": filepath.Join(tmp, "shared"),
+	} {
+		if err := os.Symlink(dest, filepath.Join(src, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan *FileSync, 1)
+	go func() {
+		fs := NewFileSync(src, dst, false, WithFollowSymlinks(true))
+		if err := fs.SyncDirs(); err != nil {
+			t.Error(err)
+		}
+		done <- fs
+	}()
+	var fs *FileSync
+	select {
+	case fs = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("sync did not terminate")
+	}
+
+	if got := readTestFile(t, filepath.Join(dst, "a", "shared", "lib.txt")); got != "lib" {
+		t.Errorf("followed link copied %q, want lib", got)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "a", "to-b", "file.txt")); got != "b" {
+		t.Errorf("a/to-b/file.txt = %q, want b", got)
+	}
+	cycles := fs.Stats().SymlinkCycles
+	slices.Sort(cycles)
+	want := []string{"a/to-b/to-a", "a/up", "b/to-a/to-b", "b/to-a/up"}
+	if !slices.Equal(cycles, want) {
+		t.Errorf("SymlinkCycles = %v, want %v", cycles, want)
+	}
+}
+
+func TestFileSync_TargetSymlinks(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		follow  bool
+		outside string
+	}{
+		{"replaced", nil, false, "secret"},
+		{"replaced atomically", []Option{WithAtomicCopy(true)}, false, "secret"},
+		{"followed", []Option{WithFollowTargetSymlinks(true)}, true, "new"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			outside := filepath.Join(tmp, "outside.txt")
+			writeTestFile(t, filepath.Join(src, "a.txt"), "new", time.Now())
+			writeTestFile(t, outside, "secret", time.Now().Add(-time.Hour))
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				t.Fatal(err)
+			}
+			// A link planted in the target, pointing out of it
+			if err := os.Symlink(outside, filepath.Join(dst, "a.txt")); err != nil {
+				t.Fatal(err)
+			}
+
+			fs := NewFileSync(src, dst, false, tc.opts...)
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if err := fs.Stats().Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(outside); string(got) != tc.outside {
+				t.Errorf("outside file = %q, want %q", got, tc.outside)
+			}
+			info, err := os.Lstat(filepath.Join(dst, "a.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isLink := info.Mode()&os.ModeSymlink != 0; isLink != tc.follow {
+				t.Errorf("target is a symlink: %v, want %v", isLink, tc.follow)
+			}
+			if got, _ := os.ReadFile(filepath.Join(dst, "a.txt")); string(got) != "new" {
+				t.Errorf("target reads %q, want %q", got, "new")
+			}
+		})
+	}
+}
+
+func TestFileSync_FollowSymlinksDeleteAndDiff(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now().Add(-time.Hour))
+	writeTestFile(t, filepath.Join(tmp, "shared", "lib.txt"), "lib", time.Now().Add(-time.Hour))
+	if err := os.Symlink(filepath.Join(tmp, "shared"), filepath.Join(src, "shared")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The followed directory is no orphan on later runs
+	for _, streaming := range []bool{false, false, true} {
+		fs := NewFileSync(src, dst, true, WithFollowSymlinks(true), WithStreaming(streaming))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if n := fs.Stats().FilesDeleted; n != 0 {
+			t.Errorf("run with streaming %v deleted %d file(s), want none", streaming, n)
+		}
+	}
+	if got := readTestFile(t, filepath.Join(dst, "shared", "lib.txt")); got != "lib" {
+		t.Errorf("shared/lib.txt = %q, want lib", got)
+	}
+
+	// and Diff compares it as the directory the sync copied
+	for _, workers := range []int{1, 4} {
+		diff, err := NewFileSync(src, dst, true, WithFollowSymlinks(true), WithParallelPlan(workers)).Diff(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diff.OnlyInSource)+len(diff.OnlyInTarget)+len(diff.Differing) != 0 {
+			t.Errorf("Diff with %d worker(s) = %+v, want no differences", workers, diff)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package filesync
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ExportTar writes the selection a sync would copy to w as a tar
+// archive, gzip-compressed with compress, instead of syncing it into
+// the target directory, which is not touched. Entries are the ones
+// List reports, in the same order and with their directories, keeping
+// relative paths, modes and mod times; .syncignore rules and the
+// configured filters apply as usual, and with WithPreserveSymlinks
+// symlinks are stored as links. Special files are logged, left out
+// and listed in Stats().Special. Files that cannot be opened, and
+// entries whose header the tar format cannot hold, are logged, left
+// out and recorded in Stats().Errors, but a read failing halfway, or
+// a file changing size while it is archived, stops the export since
+// the archive cannot skip a partly written entry. Stats().FilesCopied
+// and BytesCopied count the archived files. The archive is closed and
+// flushed whether or not the export succeeds; w itself is left open.
+func (fs *FileSync) ExportTar(ctx context.Context, w io.Writer, compress bool) (err error) {
+	if err := fs.connect(); err != nil {
+		return err
+	}
+	fs.stats = Stats{}
+	items, err := fs.listSources(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer func() {
+		// Close even after an error, so what was written is flushed
+		closeErr := tw.Close()
+		if gz != nil {
+			closeErr = errors.Join(closeErr, gz.Close())
+		}
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fs.tarEntry(tw, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tarEntry writes one source item to tw.
+func (fs *FileSync) tarEntry(tw *tar.Writer, item sourceItem) error {
+	if isSpecial(item.info.Mode()) {
+		log.Printf("⚠️ Skipping %s: %q", specialKind(item.info.Mode()), item.path)
+		fs.stats.Special = append(fs.stats.Special, item.relPath)
+		return nil
+	}
+	name := filepath.ToSlash(item.relPath)
+	var link string
+	if item.info.Mode()&os.ModeSymlink != 0 {
+		l, ok := fs.srcFS.(symlinker)
+		if !ok {
+			log.Printf("⚠️ Skipping symlink %q: the source cannot read links", item.path)
+			return nil
+		}
+		target, err := l.Readlink(item.path)
+		if err != nil {
+			log.Printf("❌ Could not read symlink %q: %v", item.path, err)
+			fs.recordError(&CopyError{Src: item.path, Dst: name, Err: err})
+			return nil
+		}
+		link = target
+	}
+
+	hdr, err := tar.FileInfoHeader(item.info, link)
+	if err != nil {
+		return fmt.Errorf("%s: %w", item.path, err)
+	}
+	hdr.Name = name
+	if item.info.IsDir() {
+		hdr.Name += "/"
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		if written, err := fs.writeTarHeader(tw, hdr, item); !written {
+			return err
+		}
+		log.Printf("📦 Archived: %q", hdr.Name)
+		return nil
+	}
+
+	in, err := fs.srcFS.Open(item.path)
+	if err != nil {
+		log.Printf("❌ Could not open %q: %v", item.path, err)
+		fs.recordError(&CopyError{Src: item.path, Dst: name, Err: err})
+		return nil
+	}
+	defer in.Close()
+	if written, err := fs.writeTarHeader(tw, hdr, item); !written {
+		return err
+	}
+	n, err := io.CopyN(tw, in, hdr.Size)
+	if err == io.EOF {
+		err = fmt.Errorf("%s: %w", item.path, ErrChangedDuringCopy)
+	}
+	if err != nil {
+		return fmt.Errorf("archiving %s: %w", item.path, err)
+	}
+	if extra, _ := in.Read(make([]byte, 1)); extra > 0 {
+		return fmt.Errorf("archiving %s: %w", item.path, ErrChangedDuringCopy)
+	}
+	log.Printf("📦 Archived: %q (%d bytes)", hdr.Name, n)
+	fs.stats.FilesCopied++
+	fs.stats.BytesCopied += n
+	return nil
+}
+
+// writeTarHeader writes the header of item to tw and reports whether
+// it did. A header the tar format cannot encode leaves the archive
+// intact, so the entry is logged, recorded and left out; other errors
+// stop the export.
+func (fs *FileSync) writeTarHeader(tw *tar.Writer, hdr *tar.Header, item sourceItem) (bool, error) {
+	err := tw.WriteHeader(hdr)
+	if err == nil {
+		return true, nil
+	}
+	// Such an error writes nothing and does not break the writer
+	if tw.Flush() != nil {
+		return false, err
+	}
+	log.Printf("⚠️ Skipping %q, which a tar header cannot hold: %v", item.path, err)
+	fs.recordError(&CopyError{Src: item.path, Dst: hdr.Name, Err: err})
+	return false, nil
+}
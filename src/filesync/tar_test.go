@@ -0,0 +1,148 @@
+package filesync
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_ExportTar(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", modtime)
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "beta", modtime)
+	writeTestFile(t, filepath.Join(src, "skip.tmp"), "no", modtime)
+	writeTestFile(t, filepath.Join(src, ".syncignore"), "*.tmp\n", modtime)
+
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		fs := NewFileSync(src, dst, false)
+		if err := fs.ExportTar(context.Background(), &buf, compress); err != nil {
+			t.Fatal(err)
+		}
+
+		var r io.Reader = &buf
+		if compress {
+			gz, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		var names []string
+		contents := map[string]string{}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, hdr.Name)
+			if hdr.Typeflag == tar.TypeReg {
+				data, _ := io.ReadAll(tr)
+				contents[hdr.Name] = string(data)
+				if !hdr.ModTime.Equal(modtime) {
+					t.Errorf("%s: mod time %v, want %v", hdr.Name, hdr.ModTime, modtime)
+				}
+			}
+		}
+		want := []string{"a.txt", "sub/", "sub/b.txt"}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("compress=%v: entries %v, want %v", compress, names, want)
+		}
+		if contents["sub/b.txt"] != "beta" {
+			t.Errorf("sub/b.txt = %q, want %q", contents["sub/b.txt"], "beta")
+		}
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("target was touched: %v", err)
+	}
+}
+
+// failingWriter accepts n bytes and then fails.
+type failingWriter struct{ n int }
+
+var errWriteFailed = errors.New("disk full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errWriteFailed
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestFileSync_ExportTarWriteError(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	writeTestFile(t, filepath.Join(src, "big.bin"), string(make([]byte, 64*1024)), time.Now())
+
+	fs := NewFileSync(src, filepath.Join(tmp, "dst"), false)
+	err := fs.ExportTar(context.Background(), &failingWriter{n: 1024}, false)
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("ExportTar() = %v, want the write error", err)
+	}
+}
+
+// pipeInfo makes a file look like a named pipe.
+type pipeInfo struct{ os.FileInfo }
+
+func (pipeInfo) Mode() os.FileMode { return os.ModeNamedPipe | 0644 }
+
+// tarSourceFS is a local FS where the file named pipe is a named pipe
+// and the one named locked cannot be opened.
+type tarSourceFS struct{ FS }
+
+func (f tarSourceFS) Stat(name string) (os.FileInfo, error) {
+	info, err := f.FS.Stat(name)
+	if err == nil && filepath.Base(name) == "pipe" {
+		info = pipeInfo{info}
+	}
+	return info, err
+}
+
+func (f tarSourceFS) Open(name string) (File, error) {
+	if filepath.Base(name) == "locked" {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return f.FS.Open(name)
+}
+
+func TestFileSync_ExportTarRecordsSkipped(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	for _, name := range []string{"a.txt", "locked", "pipe"} {
+		writeTestFile(t, filepath.Join(src, name), name, time.Now())
+	}
+
+	var buf bytes.Buffer
+	fs := NewFileSync(src, dst, false, WithSourceFS(tarSourceFS{LocalFS()}))
+	if err := fs.ExportTar(context.Background(), &buf, false); err != nil {
+		t.Fatal(err)
+	}
+	stats := fs.Stats()
+	if want := []string{"pipe"}; !reflect.DeepEqual(stats.Special, want) {
+		t.Errorf("Special = %v, want %v", stats.Special, want)
+	}
+	var copyErr *CopyError
+	if len(stats.Errors) != 1 || !errors.As(stats.Errors[0], &copyErr) || filepath.Base(copyErr.Src) != "locked" {
+		t.Errorf("Errors = %v, want the unreadable file", stats.Errors)
+	}
+	if stats.FilesCopied != 1 || stats.BytesCopied != int64(len("a.txt")) {
+		t.Errorf("FilesCopied = %d, BytesCopied = %d; want a.txt alone", stats.FilesCopied, stats.BytesCopied)
+	}
+}
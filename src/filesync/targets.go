@@ -0,0 +1,82 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// AddTarget adds another target directory (on the same host as the
+// first), synced from the same sources with the same options in the
+// same run. Every target is compared, copied to and cleaned up on its
+// own, but the copy passes share their reads: a source file that
+// several targets need is read once and written to all of them as it
+// is read, instead of once per target (see teeHub). A failing target
+// does not stop the others; SyncDirs then returns the errors of every
+// failed target, and TargetStats has the outcome of each. Stats,
+// PlannedActions and the report describe the first target.
+//
+// The targets are synced concurrently, so hooks such as WithBeforeCopy
+// may be called from several goroutines at once. Multiple targets
+// cannot be combined with snapshots, directory swaps, two-way sync, a
+// content-addressable store, resumed copies or a manifest, nor with a
+// checkpoint, checksum cache or retention state file at an explicit
+// path, which every target would share: by default each target keeps
+// its own in its root.
+func (fs *FileSync) AddTarget(path string) {
+	fs.extraTargets = append(fs.extraTargets, filepath.Clean(path))
+}
+
+// TargetStats returns the statistics of the most recent run for each
+// target, by target path, once targets were added with AddTarget.
+func (fs *FileSync) TargetStats() map[string]Stats {
+	return fs.targetStats
+}
+
+// syncTargets runs syncScopes for the first target and every target
+// added with AddTarget at once, sharing source reads between them.
+func (fs *FileSync) syncTargets(scopes []string) error {
+	if fs.snapshot || fs.swap || fs.bidirectional || fs.cas || fs.resume || fs.manifestPath != "" {
+		return errors.New("multiple targets cannot be combined with snapshots, directory swaps, two-way sync, a content-addressable store, resumed copies or a manifest")
+	}
+	if fs.checkpointPath != "" || fs.checksumCachePath != "" || fs.retentionStatePath != "" {
+		return errors.New("multiple targets cannot share a checkpoint, checksum cache or retention state file: leave them in each target's root")
+	}
+	targets := []*FileSync{fs}
+	for _, target := range fs.extraTargets {
+		t := NewFileSync(fs.sourceArg, target, fs.deleteMissing, fs.opts...)
+		t.extraSources, t.namedSources = fs.extraSources, fs.namedSources
+		t.protects, t.transforms = fs.protects, fs.transforms
+		t.syncCtx, t.runCtx, t.pause = fs.syncCtx, fs.runCtx, fs.pause
+		// Progress, status and the report follow the first target
+		t.onProgress, t.reportFile, t.tracePath = nil, "", ""
+		defer t.Close()
+		targets = append(targets, t)
+	}
+
+	hub := newTeeHub(len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		t.tee, t.teeID = hub, i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer hub.end(i)
+			errs[i] = t.syncScopes(scopes)
+		}()
+	}
+	wg.Wait()
+	fs.tee = nil
+
+	fs.targetStats = map[string]Stats{}
+	var failed []error
+	for i, t := range targets {
+		fs.targetStats[t.target] = t.stats
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("target %s: %w", t.target, errs[i]))
+		}
+	}
+	return errors.Join(failed...)
+}
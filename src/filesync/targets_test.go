@@ -0,0 +1,154 @@
+package filesync
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileSync_AddTarget(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	targets := []string{filepath.Join(tmp, "a"), filepath.Join(tmp, "b"), filepath.Join(tmp, "c")}
+	mtime := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "one.txt"), "one", mtime)
+	writeTestFile(t, filepath.Join(src, "sub", "two.txt"), "two", mtime)
+	for _, target := range targets {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each target is compared and cleaned up on its own
+	writeTestFile(t, filepath.Join(targets[1], "one.txt"), "one", mtime)
+	writeTestFile(t, filepath.Join(targets[2], "orphan.txt"), "orphan", mtime)
+
+	fs := NewFileSync(src, targets[0], true)
+	fs.AddTarget(targets[1])
+	fs.AddTarget(targets[2])
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range targets {
+		if got := readTestFile(t, filepath.Join(target, "sub", "two.txt")); got != "two" {
+			t.Errorf("%s: sub/two.txt = %q", target, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(targets[2], "orphan.txt")); !os.IsNotExist(err) {
+		t.Errorf("orphan.txt not deleted: %v", err)
+	}
+
+	stats := fs.TargetStats()
+	for target, want := range map[string]Stats{
+		targets[0]: {FilesCopied: 2},
+		targets[1]: {FilesCopied: 1, FilesSkipped: 1},
+		targets[2]: {FilesCopied: 2, FilesDeleted: 1},
+	} {
+		got := stats[target]
+		if got.FilesCopied != want.FilesCopied || got.FilesSkipped != want.FilesSkipped || got.FilesDeleted != want.FilesDeleted {
+			t.Errorf("%s: copied %d, skipped %d, deleted %d; want %d, %d, %d", target,
+				got.FilesCopied, got.FilesSkipped, got.FilesDeleted, want.FilesCopied, want.FilesSkipped, want.FilesDeleted)
+		}
+	}
+	if fs.Stats().FilesCopied != 2 {
+		t.Errorf("Stats().FilesCopied = %d, want that of the first target", fs.Stats().FilesCopied)
+	}
+}
+
+// readCountFS is a MemFS that counts the bytes read from its files.
+type readCountFS struct {
+	*MemFS
+	read atomic.Int64
+}
+
+// readCountedFile is a file of readCountFS.
+type readCountedFile struct {
+	File
+	fsys *readCountFS
+}
+
+func (f *readCountedFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.fsys.read.Add(int64(n))
+	return n, err
+}
+
+func (c *readCountFS) Open(name string) (File, error) {
+	f, err := c.MemFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readCountedFile{File: f, fsys: c}, nil
+}
+
+// failingDirFS is a MemFS on which files below dir cannot be created.
+type failingDirFS struct {
+	*MemFS
+	dir string
+}
+
+func (f failingDirFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&os.O_CREATE != 0 && strings.HasPrefix(name, f.dir+string(filepath.Separator)) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("disk full")}
+	}
+	return f.MemFS.OpenFile(name, flag, perm)
+}
+
+func TestFileSync_AddTargetSharedState(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "state.json")
+	for name, opt := range map[string]Option{
+		"checkpoint":     WithCheckpoint(state),
+		"checksum cache": WithChecksumCacheFile(state),
+		"retention":      WithRetentionStateFile(state),
+	} {
+		mem := NewMemFS()
+		mem.WriteFile("/src/a.txt", []byte("a"), time.Now())
+		fs := NewFileSync("/src", "/a", true, WithSourceFS(mem), WithTargetFS(mem), opt)
+		fs.AddTarget("/b")
+		if err := fs.SyncDirs(); err == nil {
+			t.Errorf("%s file shared by two targets: want an error", name)
+		}
+	}
+}
+
+func TestFileSync_AddTargetSharesReads(t *testing.T) {
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	big := bytes.Repeat([]byte("0123456789"), 100_000)
+	src := &readCountFS{MemFS: NewMemFS()}
+	src.WriteFile("/src/big.bin", big, mtime)
+	src.WriteFile("/src/small.txt", []byte("small"), mtime)
+	dst := NewMemFS()
+	for _, dir := range []string{"/a", "/bad", "/c"} {
+		if err := dst.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := NewFileSync("/src", "/a", false, WithSourceFS(src), WithTargetFS(failingDirFS{dst, "/bad"}))
+	fs.AddTarget("/bad")
+	fs.AddTarget("/c")
+	err := fs.SyncDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Per-file errors stay with their target
+	if n := len(fs.TargetStats()["/bad"].Errors); n != 2 {
+		t.Errorf("%d errors for /bad, want 2", n)
+	}
+	for _, target := range []string{"/a", "/c"} {
+		got, err := dst.ReadFile(target + "/big.bin")
+		if err != nil || !bytes.Equal(got, big) {
+			t.Errorf("%s/big.bin: %d bytes, %v", target, len(got), err)
+		}
+		if n := len(fs.TargetStats()[target].Errors); n != 0 {
+			t.Errorf("%d errors for %s", n, target)
+		}
+	}
+	if read, want := src.read.Load(), int64(len(big)+len("small")); read != want {
+		t.Errorf("read %d source bytes, want %d (each file once)", read, want)
+	}
+}
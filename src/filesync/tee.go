@@ -0,0 +1,214 @@
+package filesync
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// teeChunk is how much of a shared source file is read at a time and
+// handed to every target copying it.
+const teeChunk = 256 << 10
+
+// teeHub lets the targets of a multi-target run (see AddTarget) share
+// the source reads of their copy passes. Each target copies in walk
+// order; when one opens a source file, it waits until every other
+// target has either opened it too or moved past it (or finished
+// copying), so all targets needing the file join one session. The
+// session reads the file once and feeds each of them through a pipe.
+// A target that stops reading, because its copy failed, is dropped
+// from the session without holding up the others.
+//
+// Waits cannot go in a circle: a target only waits for targets behind
+// it in walk order, and the one furthest behind waits for nobody.
+type teeHub struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	members  []*teeMember
+	sessions map[string]*teeSession
+}
+
+// teeMember is the state of one target's copy pass.
+type teeMember struct {
+	order map[string]int // position of the files it may copy; nil until its copy pass begins
+	pos   int            // position of the file it opened last
+	done  bool           // it opens no more files
+}
+
+// teeSession is the shared read of one source file, with a pipe for
+// each member that joined it.
+type teeSession struct {
+	readers map[int]*io.PipeReader
+	writers []*io.PipeWriter
+	started bool
+	file    File // handed over as is when only one member joined
+	info    os.FileInfo
+	err     error
+}
+
+func newTeeHub(n int) *teeHub {
+	h := &teeHub{sessions: map[string]*teeSession{}}
+	h.cond = sync.NewCond(&h.mu)
+	for range n {
+		h.members = append(h.members, &teeMember{pos: -1})
+	}
+	return h
+}
+
+// begin starts the copy pass of member id over jobs.
+func (h *teeHub) begin(id int, jobs []*fileJob) {
+	order := map[string]int{}
+	for i, job := range jobs {
+		if job.copy && !job.renamed {
+			order[job.srcPath] = i
+		}
+	}
+	h.mu.Lock()
+	h.members[id].order = order
+	h.mu.Unlock()
+	h.cond.Broadcast()
+}
+
+// end marks member id as done opening files.
+func (h *teeHub) end(id int) {
+	h.mu.Lock()
+	h.members[id].done = true
+	h.mu.Unlock()
+	h.cond.Broadcast()
+}
+
+// open opens the source file at path on fsys for member id, shared
+// with the other members that copy it. A file opened again, as for a
+// retry, is read on its own.
+func (h *teeHub) open(id int, fsys FS, path string) (File, error) {
+	h.mu.Lock()
+	m := h.members[id]
+	pos, ok := m.order[path]
+	if !ok || pos <= m.pos {
+		h.mu.Unlock()
+		return fsys.Open(path)
+	}
+	m.pos = pos
+	s := h.sessions[path]
+	if s == nil {
+		s = &teeSession{readers: map[int]*io.PipeReader{}}
+		h.sessions[path] = s
+	}
+	r, w := io.Pipe()
+	s.readers[id] = r
+	s.writers = append(s.writers, w)
+	h.cond.Broadcast()
+	for !s.started {
+		if h.ready(s, path) {
+			h.start(s, fsys, path)
+			break
+		}
+		h.cond.Wait()
+	}
+	h.mu.Unlock()
+
+	switch {
+	case s.err != nil:
+		return nil, s.err
+	case s.file != nil:
+		return s.file, nil
+	}
+	return &teeFile{r: r, info: s.info}, nil
+}
+
+// openSource opens a source file to copy, through the teeHub in a run
+// with several targets.
+func (fs *FileSync) openSource(path string) (File, error) {
+	if fs.tee == nil {
+		return fs.srcFS.Open(path)
+	}
+	return fs.tee.open(fs.teeID, fs.srcFS, path)
+}
+
+// ready reports whether every member has joined the session of path,
+// moved past it, or will never open it.
+func (h *teeHub) ready(s *teeSession, path string) bool {
+	for id, m := range h.members {
+		if s.readers[id] != nil || m.done {
+			continue
+		}
+		if m.order == nil {
+			return false
+		}
+		if pos, ok := m.order[path]; ok && m.pos < pos {
+			return false
+		}
+	}
+	return true
+}
+
+// start opens the source file of a session and feeds its members, or
+// hands it to the only one.
+func (h *teeHub) start(s *teeSession, fsys FS, path string) {
+	s.started = true
+	delete(h.sessions, path)
+	defer h.cond.Broadcast()
+
+	f, err := fsys.Open(path)
+	if err == nil {
+		if s.info, err = f.Stat(); err != nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		s.err = err
+		return
+	}
+	if len(s.writers) == 1 {
+		s.file = f
+		return
+	}
+	go feedTee(f, s.writers)
+}
+
+// feedTee reads f to the end and writes it to every pipe whose reader
+// is still reading, then closes the pipes with the outcome.
+func feedTee(f File, pipes []*io.PipeWriter) {
+	defer f.Close()
+	buf := make([]byte, teeChunk)
+	for len(pipes) > 0 {
+		n, err := f.Read(buf)
+		if n > 0 {
+			live := pipes[:0]
+			for _, w := range pipes {
+				if _, werr := w.Write(buf[:n]); werr == nil {
+					live = append(live, w)
+				}
+			}
+			pipes = live
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			for _, w := range pipes {
+				w.CloseWithError(err)
+			}
+			return
+		}
+	}
+}
+
+// errTeeFile is returned for operations a shared source file does not
+// support.
+var errTeeFile = errors.New("not supported on a shared source read")
+
+// teeFile is a member's end of a teeSession, a read-only stream.
+type teeFile struct {
+	r    *io.PipeReader
+	info os.FileInfo
+}
+
+func (f *teeFile) Read(p []byte) (int, error)                   { return f.r.Read(p) }
+func (f *teeFile) Write(p []byte) (int, error)                  { return 0, errTeeFile }
+func (f *teeFile) Seek(offset int64, whence int) (int64, error) { return 0, errTeeFile }
+func (f *teeFile) Close() error                                 { return f.r.Close() }
+func (f *teeFile) Stat() (os.FileInfo, error)                   { return f.info, nil }
+func (f *teeFile) Truncate(size int64) error                    { return errTeeFile }
+func (f *teeFile) Sync() error                                  { return nil }
@@ -0,0 +1,273 @@
+package filesync
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// traceVersion is the format version written to traces by WithTrace.
+const traceVersion = 1
+
+// Ops of trace events.
+const (
+	traceDecide = "decide" // the comparator's verdict on a source file
+	traceAction = "action" // a change made to the target
+	traceError  = "error"  // a per-file error
+)
+
+// traceHeader is the first line of a trace.
+type traceHeader struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Sources []string  `json:"sources"`
+	Target  string    `json:"target"`
+	DryRun  bool      `json:"dry_run,omitempty"`
+}
+
+// traceStat is the part of a stat result the comparator looks at.
+type traceStat struct {
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mod_time"`
+	Mode    os.FileMode `json:"mode"`
+}
+
+// traceEvent is one line of a trace after the header, in the order
+// the run decided and did things. Paths are slash-separated and
+// relative to the target root.
+type traceEvent struct {
+	Seq  int    `json:"seq"`
+	Op   string `json:"op"`
+	Path string `json:"path,omitempty"`
+
+	// Decisions: the inputs and the outcome of the comparison
+	Source   string     `json:"source,omitempty"`
+	Src      *traceStat `json:"src,omitempty"`
+	Tgt      *traceStat `json:"tgt,omitempty"`
+	Decision string     `json:"decision,omitempty"`
+
+	// Actions
+	Kind  ActionKind `json:"kind,omitempty"`
+	IsDir bool       `json:"is_dir,omitempty"`
+
+	Reason DiffReason `json:"reason,omitempty"`
+	Err    string     `json:"err,omitempty"`
+}
+
+// tracer writes the trace of a run, one JSON document per line.
+type tracer struct {
+	mu   sync.Mutex
+	file *os.File
+	out  *bufio.Writer
+	seq  int
+	err  error // the first write error, reported by closeTrace
+}
+
+// openTrace starts the trace of a run at the WithTrace path, replacing
+// an older one.
+func (fs *FileSync) openTrace() error {
+	if fs.tracePath == "" {
+		return nil
+	}
+	f, err := os.Create(longPath(fs.tracePath))
+	if err != nil {
+		return fmt.Errorf("trace: %w", err)
+	}
+	fs.trace = &tracer{file: f, out: bufio.NewWriter(f)}
+	fs.trace.write(traceHeader{
+		Version: traceVersion,
+		Created: time.Now().UTC(),
+		Sources: append([]string{fs.source}, fs.extraSources...),
+		Target:  fs.target,
+		DryRun:  fs.dryRun,
+	})
+	return nil
+}
+
+// closeTrace flushes and closes the trace of a run.
+func (fs *FileSync) closeTrace() error {
+	t := fs.trace
+	if t == nil {
+		return nil
+	}
+	fs.trace = nil
+	if err := t.out.Flush(); t.err == nil {
+		t.err = err
+	}
+	if err := t.file.Close(); t.err == nil {
+		t.err = err
+	}
+	if t.err != nil {
+		return fmt.Errorf("trace: %w", t.err)
+	}
+	return nil
+}
+
+// write appends one line to the trace.
+func (t *tracer) write(v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		_, err = t.out.Write(append(data, '\n'))
+	}
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// event numbers e and appends it to the trace.
+func (t *tracer) event(e traceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	e.Seq = t.seq
+	t.write(e)
+}
+
+// statOfTrace returns the traced part of info, nil for none.
+func statOfTrace(info os.FileInfo) *traceStat {
+	if info == nil {
+		return nil
+	}
+	return &traceStat{Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+}
+
+// traceJob records what was decided for a file job once it has been
+// compared, with the stat results the decision was made from.
+func (fs *FileSync) traceJob(job *fileJob) {
+	if fs.trace == nil {
+		return
+	}
+	decision := "skip"
+	switch {
+	case job.err != nil:
+		decision = "failed"
+	case job.journaled:
+		decision = "journaled"
+	case job.renamed:
+		decision = "renamed"
+	case job.targetNewer:
+		decision = "target-newer"
+	case job.placeholder:
+		decision = "placeholder"
+	case job.copy:
+		decision = "copy"
+	}
+	e := traceEvent{
+		Op:       traceDecide,
+		Path:     filepath.ToSlash(job.relPath),
+		Source:   job.srcPath,
+		Src:      statOfTrace(job.srcInfo),
+		Tgt:      statOfTrace(job.tgtInfo),
+		Decision: decision,
+		Reason:   job.reason,
+	}
+	if job.err != nil {
+		e.Err = job.err.Error()
+	}
+	fs.trace.event(e)
+}
+
+// traceChange records an action on the target.
+func (fs *FileSync) traceChange(kind ActionKind, relPath string, isDir bool, reason DiffReason) {
+	if fs.trace != nil {
+		fs.trace.event(traceEvent{Op: traceAction, Path: filepath.ToSlash(relPath), Kind: kind, IsDir: isDir, Reason: reason})
+	}
+}
+
+// traceFailure records a per-file error.
+func (fs *FileSync) traceFailure(err error) {
+	if fs.trace != nil {
+		fs.trace.event(traceEvent{Op: traceError, Err: err.Error()})
+	}
+}
+
+// Replay repeats the actions recorded in a trace written by WithTrace,
+// in the order they were taken, against the target: directories are
+// created, files copied from the source the trace names and entries
+// deleted exactly as the traced run decided, without comparing
+// anything again, so a run's outcome can be reproduced to tell a
+// comparator bug from an ordering one. As with ApplyPlan, a recorded
+// copy whose source has since changed size or mod time is not replayed
+// and is listed in Stats().Drifted, and per-file errors are collected
+// in Stats. The trace must have been made for the same target, by a
+// run that was not a dry run.
+func (fs *FileSync) Replay(path string) error {
+	if fs.dryRun {
+		return errors.New("a trace cannot be replayed in dry-run mode")
+	}
+	if fs.swap {
+		return errors.New("a trace cannot be replayed with directory swaps")
+	}
+	header, events, err := readTrace(path)
+	if err != nil {
+		return err
+	}
+	if header.DryRun {
+		return fmt.Errorf("trace %s was made by a dry run, which changed nothing", path)
+	}
+	if !samePath(header.Target, fs.target) {
+		return fmt.Errorf("trace %s was made for target %s, not %s", path, header.Target, fs.target)
+	}
+
+	return fs.applying(func() {
+		decided := map[string]traceEvent{}
+		for _, e := range events {
+			switch {
+			case e.Op == traceDecide:
+				decided[e.Path] = e
+			case e.Op != traceAction:
+			case e.Kind == ActionDelete:
+				fs.applyDelete(planEntry{Kind: e.Kind, Path: e.Path, IsDir: e.IsDir})
+			case e.IsDir:
+				fs.applyDir(planEntry{Kind: e.Kind, Path: e.Path, IsDir: true, Reason: e.Reason})
+			default:
+				d, ok := decided[e.Path]
+				if !ok || d.Src == nil {
+					log.Printf("⚠️ No source recorded in the trace, not replayed: %q", e.Path)
+					continue
+				}
+				fs.applyCopy(planEntry{Kind: e.Kind, Path: e.Path, Reason: e.Reason, Source: d.Source, Size: d.Src.Size, ModTime: d.Src.ModTime})
+			}
+		}
+	})
+}
+
+// readTrace reads the header and events of a trace. A last line cut
+// short, by a run that crashed, is ignored.
+func readTrace(path string) (traceHeader, []traceEvent, error) {
+	var header traceHeader
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return header, nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return header, nil, err
+		}
+		return header, nil, fmt.Errorf("trace %s is empty", path)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return header, nil, fmt.Errorf("reading trace %s: %w", path, err)
+	}
+	if header.Version != traceVersion {
+		return header, nil, fmt.Errorf("trace %s has unsupported version %d", path, header.Version)
+	}
+	var events []traceEvent
+	for scanner.Scan() {
+		var e traceEvent
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			break
+		}
+		events = append(events, e)
+	}
+	return header, events, scanner.Err()
+}
@@ -0,0 +1,115 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_TraceAndReplay(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	trace := filepath.Join(tmp, "run.trace")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same", old)
+	writeTestFile(t, filepath.Join(src, "changed.txt"), "new content", old)
+	writeTestFile(t, filepath.Join(src, "dir", "new.txt"), "new", old)
+	seed := func() {
+		os.RemoveAll(dst)
+		writeTestFile(t, filepath.Join(dst, "same.txt"), "same", old)
+		writeTestFile(t, filepath.Join(dst, "changed.txt"), "old", old)
+		writeTestFile(t, filepath.Join(dst, "orphan.txt"), "gone", old)
+	}
+	seed()
+
+	fs := NewFileSync(src, dst, true, WithTrace(trace))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	header, events, err := readTrace(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != traceVersion || header.Target != dst {
+		t.Errorf("header = %+v", header)
+	}
+	decisions := map[string]traceEvent{}
+	var changes []string
+	for i, e := range events {
+		if e.Seq != i+1 {
+			t.Errorf("event %d has seq %d", i, e.Seq)
+		}
+		switch e.Op {
+		case traceDecide:
+			decisions[e.Path] = e
+		case traceAction:
+			changes = append(changes, string(e.Kind)+" "+e.Path)
+		}
+	}
+	if d := decisions["same.txt"]; d.Decision != "skip" || d.Src == nil || d.Tgt == nil || d.Src.Size != 4 {
+		t.Errorf("same.txt decision = %+v, want a skip with both stats", d)
+	}
+	if d := decisions["changed.txt"]; d.Decision != "copy" || d.Reason != ReasonSize || d.Tgt.Size != 3 {
+		t.Errorf("changed.txt decision = %+v, want a copy for the size", d)
+	}
+	if d := decisions["dir/new.txt"]; d.Decision != "copy" || d.Tgt != nil {
+		t.Errorf("dir/new.txt decision = %+v, want a copy of a missing file", d)
+	}
+	want := "add dir,modify changed.txt,add dir/new.txt,delete orphan.txt"
+	if got := strings.Join(changes, ","); got != want {
+		t.Errorf("changes = %s, want %s", got, want)
+	}
+
+	// Replaying onto the old target reproduces the outcome
+	seed()
+	replay := NewFileSync(src, dst, false)
+	if err := replay.Replay(trace); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "changed.txt")); got != "new content" {
+		t.Errorf("changed.txt = %q after replay", got)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "dir", "new.txt")); got != "new" {
+		t.Errorf("dir/new.txt = %q after replay", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "orphan.txt")); !os.IsNotExist(err) {
+		t.Error("expected the orphan to be deleted by the replay")
+	}
+	if stats := replay.Stats(); stats.FilesCopied != 2 || stats.FilesDeleted != 1 || stats.DirsCreated != 1 {
+		t.Errorf("replay stats = %+v", stats)
+	}
+}
+
+func TestFileSync_ReplayRequirements(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+
+	dryTrace := filepath.Join(tmp, "dry.trace")
+	if err := NewFileSync(src, dst, false, WithDryRun(true), WithTrace(dryTrace)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFileSync(src, dst, false).Replay(dryTrace); err == nil {
+		t.Error("expected an error replaying a dry run's trace")
+	}
+
+	trace := filepath.Join(tmp, "run.trace")
+	if err := NewFileSync(src, dst, false, WithTrace(trace)).SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFileSync(src, filepath.Join(tmp, "other"), false).Replay(trace); err == nil {
+		t.Error("expected an error replaying onto another target")
+	}
+
+	future := filepath.Join(tmp, "future.trace")
+	writeTestFile(t, future, `{"version":99}`+"\n", time.Now())
+	if err := NewFileSync(src, dst, false).Replay(future); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("Replay() = %v, want an unsupported version error", err)
+	}
+}
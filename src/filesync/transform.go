@@ -0,0 +1,200 @@
+package filesync
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TransformFunc rewrites a file's contents while it is copied,
+// reading the source from r and writing the result to w.
+type TransformFunc func(r io.Reader, w io.Writer) error
+
+// transformStateName is the file in the target that remembers which
+// source each transformed file was produced from.
+const transformStateName = ".filesync-transforms.json"
+
+// transformRecord describes the source a transformed target file was
+// produced from, since its own size and contents differ from it.
+type transformRecord struct {
+	SourceSize int64  `json:"source_size"`
+	SourceSum  string `json:"source_sum,omitempty"` // hex digest, checksum mode only
+	OutputSize int64  `json:"output_size"`
+}
+
+// transformState maps target paths (relative to the target root) to
+// the record of their last transformation.
+type transformState struct {
+	Files map[string]transformRecord `json:"files"`
+}
+
+// RegisterTransform pipes every file with extension ext (e.g. "json"
+// or ".json", case-insensitive) through fn instead of copying it
+// verbatim, for example to minify or normalize line endings. A later
+// registration for the same extension replaces the earlier one.
+//
+// Because the output differs from the source, transformed files are
+// not compared with their source directly. Instead the source's size
+// (and checksum in checksum mode) at transformation time is stored in
+// ".filesync-transforms.json" in the target, and a file is only
+// transformed again once its source no longer matches that record or
+// the target was changed. Transformed files are never resumed or
+// preallocated.
+func (fs *FileSync) RegisterTransform(ext string, fn TransformFunc) {
+	if fs.transforms == nil {
+		fs.transforms = map[string]TransformFunc{}
+	}
+	fs.transforms[normalizeExtension(ext)] = fn
+}
+
+// transformFor returns the transform registered for path's
+// extension, or nil if it is copied verbatim.
+func (fs *FileSync) transformFor(path string) TransformFunc {
+	return fs.transforms[strings.ToLower(filepath.Ext(path))]
+}
+
+// transformFile returns the path of the transform state file.
+func (fs *FileSync) transformFile() string {
+	return filepath.Join(fs.target, transformStateName)
+}
+
+// loadTransforms reads the transform state from the target when
+// transforms are registered. A missing file yields an empty state.
+func (fs *FileSync) loadTransforms() error {
+	if len(fs.transforms) == 0 {
+		return nil
+	}
+	st := &transformState{}
+	data, err := readFile(fs.tgtFS, fs.transformFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, st); err != nil {
+			return err
+		}
+	}
+	if st.Files == nil {
+		st.Files = map[string]transformRecord{}
+	}
+	fs.transformed = st
+	return nil
+}
+
+// saveTransforms atomically writes the transform state back.
+func (fs *FileSync) saveTransforms() error {
+	if fs.transformed == nil || fs.dryRun {
+		return nil
+	}
+	data, err := json.MarshalIndent(fs.transformed, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := fs.transformFile()
+	if err := fs.tgtFS.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := writeFile(fs.tgtFS, tmp, data); err != nil {
+		return err
+	}
+	return fs.tgtFS.Rename(tmp, path)
+}
+
+// compareTransformed is the comparator for transformed files: the
+// target matches if it is what the recorded source produced and the
+// source still matches that record.
+func (fs *FileSync) compareTransformed(srcPath, tgtPath string, src, tgt os.FileInfo) (DiffReason, error) {
+	var rec transformRecord
+	ok := false
+	if fs.transformed != nil {
+		relPath, _ := filepath.Rel(fs.target, tgtPath)
+		rec, ok = fs.transformed.Files[relPath]
+	}
+	if !ok {
+		return ReasonContent, nil
+	}
+	if rec.SourceSize != src.Size() || rec.OutputSize != tgt.Size() {
+		return ReasonSize, nil
+	}
+	if fs.byContent() {
+		sum, err := fs.checksumOf(fs.srcFS, srcPath, src)
+		if err != nil {
+			return "", err
+		}
+		if hex.EncodeToString(sum) != rec.SourceSum {
+			return ReasonContent, nil
+		}
+		return "", nil
+	}
+	if !sameModTime(src.ModTime(), tgt.ModTime(), fs.timeTolerance) {
+		return ReasonTime, nil
+	}
+	return "", nil
+}
+
+// recordTransform remembers that dst was produced from a source
+// described by rec.
+func (fs *FileSync) recordTransform(dst string, rec transformRecord) {
+	if fs.transformed == nil {
+		return
+	}
+	relPath, _ := filepath.Rel(fs.target, dst)
+	fs.transformed.Files[relPath] = rec
+}
+
+// transformCopy runs fn from in to out and returns the record for the
+// result along with the number of source bytes read. The source is
+// read to the end even if fn stops early, so it is counted (and
+// hashed in checksum mode) in full.
+func (fs *FileSync) transformCopy(fn TransformFunc, in io.Reader, out io.Writer) (transformRecord, int64, error) {
+	source := &countingReader{r: in}
+	var r io.Reader = source
+	var h hash.Hash
+	if fs.byContent() {
+		h = fs.newHash()
+		r = io.TeeReader(source, h)
+	}
+	output := &countingWriter{w: out}
+
+	if err := fn(r, output); err != nil {
+		return transformRecord{}, source.n, err
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return transformRecord{}, source.n, err
+	}
+
+	rec := transformRecord{SourceSize: source.n, OutputSize: output.n}
+	if h != nil {
+		rec.SourceSum = hex.EncodeToString(h.Sum(nil))
+	}
+	return rec, source.n, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
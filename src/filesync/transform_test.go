@@ -0,0 +1,94 @@
+package filesync
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// crlfToLF is a sample transform converting Windows line endings.
+func crlfToLF(r io.Reader, w io.Writer) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")))
+	return err
+}
+
+func TestFileSync_Transform(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		name := "mtime"
+		if checksum {
+			name = "checksum"
+		}
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			modtime := time.Now().Add(-time.Hour)
+			writeTestFile(t, filepath.Join(src, "notes.TXT"), "a\r\nb\r\n", modtime)
+			writeTestFile(t, filepath.Join(src, "raw.bin"), "a\r\nb\r\n", modtime)
+
+			fs := NewFileSync(src, dst, true, WithChecksum(checksum))
+			fs.RegisterTransform("txt", crlfToLF)
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+
+			for rel, want := range map[string]string{"notes.TXT": "a\nb\n", "raw.bin": "a\r\nb\r\n"} {
+				data, err := os.ReadFile(filepath.Join(dst, rel))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", rel, data, want)
+				}
+			}
+
+			// The size mismatch of the transformed file must not recopy it
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if stats := fs.Stats(); stats.FilesCopied != 0 || stats.FilesDeleted != 0 {
+				t.Errorf("second sync copied %d and deleted %d files, want 0/0", stats.FilesCopied, stats.FilesDeleted)
+			}
+
+			// A changed source is transformed again
+			writeTestFile(t, filepath.Join(src, "notes.TXT"), "c\r\nd\r\n", modtime.Add(time.Minute))
+			if err := fs.SyncDirs(); err != nil {
+				t.Fatal(err)
+			}
+			if got := fs.Stats().FilesCopied; got != 1 {
+				t.Errorf("after change copied %d files, want 1", got)
+			}
+			data, _ := os.ReadFile(filepath.Join(dst, "notes.TXT"))
+			if string(data) != "c\nd\n" {
+				t.Errorf("notes.TXT = %q, want %q", data, "c\nd\n")
+			}
+		})
+	}
+}
+
+func TestFileSync_TransformWithoutRecordRecopies(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	modtime := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "notes.txt"), "a\r\n", modtime)
+	// Same bytes and mod time, but never produced by the transform
+	writeTestFile(t, filepath.Join(dst, "notes.txt"), "a\r\n", modtime)
+
+	fs := NewFileSync(src, dst, false)
+	fs.RegisterTransform(".txt", crlfToLF)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dst, "notes.txt"))
+	if string(data) != "a\n" {
+		t.Errorf("notes.txt = %q, want transformed output", data)
+	}
+}
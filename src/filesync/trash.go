@@ -0,0 +1,77 @@
+package filesync
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// trashDirName is the directory in the target that takes deleted files
+// with WithTrash when there is no platform trash to move them to.
+const trashDirName = ".filesync-trash"
+
+// trashNameTries bounds the numbered names a platform trash tries for
+// a deleted file whose name is taken.
+const trashNameTries = 10000
+
+// trasher moves a local file to the platform's trash, where the user
+// can restore it with the usual desktop tools.
+type trasher interface {
+	trash(path string) error
+}
+
+// trashCan routes the deletions of one delete pass: to the platform
+// trash for a local target, and otherwise, or once that fails, to a
+// directory per run under the target's trashDirName.
+type trashCan struct {
+	fs  *FileSync
+	bin trasher // nil if unavailable
+	dir string
+}
+
+// newTrashCan returns the trash for a delete pass started at now.
+func (fs *FileSync) newTrashCan(now time.Time) *trashCan {
+	c := &trashCan{fs: fs, dir: filepath.Join(fs.trashDir(), now.Format("2006-01-02T150405"))}
+	if _, local := baseFS(fs.tgtFS).(osFS); local {
+		c.bin = platformTrash()
+	}
+	return c
+}
+
+// discard moves the target file at path, relPath below the target
+// root, to the trash.
+func (c *trashCan) discard(path, relPath string) error {
+	if c.bin != nil {
+		var err error
+		if split, ok := c.fs.tgtFS.(*splitFS); ok {
+			// A split file goes to the trash as its parts
+			err = split.eachPart(path, c.bin.trash)
+		} else {
+			err = c.bin.trash(path)
+		}
+		if err == nil || os.IsNotExist(err) {
+			return err
+		}
+		log.Printf("⚠️ Cannot use the system trash, moving deleted files to %q: %v", c.dir, err)
+		c.bin = nil
+	}
+	dst := filepath.Join(c.dir, relPath)
+	if err := c.fs.tgtFS.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return c.fs.tgtFS.Rename(path, dst)
+}
+
+// trashDir is the target's fallback trash directory.
+func (fs *FileSync) trashDir() string {
+	return filepath.Join(fs.target, trashDirName)
+}
+
+// inTrashDir reports whether path is the fallback trash directory or
+// lies below it.
+func (fs *FileSync) inTrashDir(path string) bool {
+	dir := fs.trashDir()
+	return samePath(path, dir) || strings.HasPrefix(filepath.Clean(path), dir+string(filepath.Separator))
+}
@@ -0,0 +1,53 @@
+package filesync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// macTrash is the user's ~/.Trash, which Finder shows as the Trash.
+type macTrash struct {
+	dir string
+}
+
+// platformTrash returns the user's Trash.
+func platformTrash() trasher {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return macTrash{dir: filepath.Join(home, ".Trash")}
+}
+
+// trash moves path into the Trash, adding a number before the
+// extension like Finder does if the name is taken. A Trash that is
+// missing or cannot be looked into is an error, leaving path where it
+// is.
+func (t macTrash) trash(path string) error {
+	if _, err := os.Lstat(path); err != nil {
+		return err
+	}
+	if _, err := os.Stat(t.dir); err != nil {
+		return fmt.Errorf("trash %s unavailable: %v", t.dir, err)
+	}
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 1; i <= trashNameTries; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s %d%s", stem, i, ext)
+		}
+		dst := filepath.Join(t.dir, name)
+		_, err := os.Lstat(dst)
+		if os.IsNotExist(err) {
+			return os.Rename(path, dst)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("no free name for %q in %s", base, t.dir)
+}
@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package filesync
+
+// platformTrash reports that there is no platform trash here, so
+// WithTrash uses the target's own trash directory.
+func platformTrash() trasher {
+	return nil
+}
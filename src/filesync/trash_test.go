@@ -0,0 +1,51 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_TrashFallbackDir(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for name, data := range map[string]string{
+		"/src/keep.txt":       "keep",
+		"/dst/keep.txt":       "keep",
+		"/dst/sub/orphan.txt": "orphan",
+		"/dst/other/gone.txt": "gone",
+	} {
+		if err := mem.WriteFile(name, []byte(data), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A MemFS target has no platform trash
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(mem), WithTargetFS(mem), WithTrash(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesDeleted; got != 2 {
+		t.Errorf("FilesDeleted = %d, want 2", got)
+	}
+	runs, err := mem.ReadDir("/dst/" + trashDirName)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("trash runs = %v, %v; want one", runs, err)
+	}
+	data, err := mem.ReadFile(filepath.Join("/dst", trashDirName, runs[0].Name(), "sub", "orphan.txt"))
+	if err != nil || string(data) != "orphan" {
+		t.Errorf("trashed orphan = %q, %v", data, err)
+	}
+	if _, err := mem.Stat("/dst/sub/orphan.txt"); !os.IsNotExist(err) {
+		t.Error("orphan.txt is still in place")
+	}
+
+	// The trash itself is never an orphan
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesDeleted; got != 0 {
+		t.Errorf("second run deleted %d files, want 0", got)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build windows
+
+package filesync
+
+import (
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procSHFileOperationW = windows.NewLazySystemDLL("shell32.dll").NewProc("SHFileOperationW")
+
+// shFileOpStruct is SHFILEOPSTRUCTW from shellapi.h.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+const (
+	foDelete          = 0x3
+	fofSilent         = 0x4
+	fofNoConfirmation = 0x10
+	fofAllowUndo      = 0x40
+	fofNoErrorUI      = 0x400
+)
+
+// recycleBin is the Windows Recycle Bin, reached through the shell.
+type recycleBin struct{}
+
+// platformTrash returns the Recycle Bin, if the shell is there.
+func platformTrash() trasher {
+	if procSHFileOperationW.Find() != nil {
+		return nil
+	}
+	return recycleBin{}
+}
+
+// trash deletes path with undo allowed, which sends it to the Recycle
+// Bin, without showing any dialogs.
+func (recycleBin) trash(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	// pFrom is a list of names ending in an extra NUL
+	from, err := windows.UTF16FromString(abs)
+	if err != nil {
+		return err
+	}
+	from = append(from, 0)
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+	if rc, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op))); rc != 0 {
+		return fmt.Errorf("SHFileOperation failed with code %#x", rc)
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return fmt.Errorf("moving %s to the Recycle Bin was aborted", abs)
+	}
+	return nil
+}
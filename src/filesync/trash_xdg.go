@@ -0,0 +1,78 @@
+//go:build unix && !darwin
+
+package filesync
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// xdgTrash is the Freedesktop.org home trash, $XDG_DATA_HOME/Trash,
+// as used by GNOME, KDE and the other Linux desktops.
+type xdgTrash struct {
+	dir string
+}
+
+// platformTrash returns the user's home trash.
+func platformTrash() trasher {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return xdgTrash{dir: filepath.Join(data, "Trash")}
+}
+
+// trash moves path to the trash's files directory and records where it
+// came from in a .trashinfo file, which the spec has created first,
+// exclusively, to claim a free name.
+func (t xdgTrash) trash(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(t.dir, "files"), 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(t.dir, "info"), 0700); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return err
+	}
+
+	base := filepath.Base(abs)
+	for i := 1; i <= trashNameTries; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d", base, i)
+		}
+		infoPath := filepath.Join(t.dir, "info", name+".trashinfo")
+		info, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: abs}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		if closeErr := info.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(abs, filepath.Join(t.dir, "files", name))
+		}
+		if err != nil {
+			_ = os.Remove(infoPath)
+		}
+		return err
+	}
+	return fmt.Errorf("no free name for %q in %s", base, t.dir)
+}
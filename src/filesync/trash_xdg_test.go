@@ -0,0 +1,43 @@
+//go:build unix && !darwin
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_TrashFreedesktop(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	data := filepath.Join(tmp, "data")
+	t.Setenv("XDG_DATA_HOME", data)
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep", now)
+	writeTestFile(t, filepath.Join(dst, "a", "gone.txt"), "first", now)
+	writeTestFile(t, filepath.Join(dst, "b", "gone.txt"), "second", now)
+
+	fs := NewFileSync(src, dst, true, WithTrash(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same base name twice: the second one gets a numbered name
+	trash := filepath.Join(data, "Trash")
+	for _, name := range []string{"gone.txt", "gone.txt.2"} {
+		if _, err := os.Stat(filepath.Join(trash, "files", name)); err != nil {
+			t.Errorf("expected %s in the trash: %v", name, err)
+		}
+		info := readTestFile(t, filepath.Join(trash, "info", name+".trashinfo"))
+		if !strings.HasPrefix(info, "[Trash Info]\nPath="+dst) || !strings.Contains(info, "DeletionDate=") {
+			t.Errorf("%s.trashinfo = %q", name, info)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, trashDirName)); !os.IsNotExist(err) {
+		t.Error("the fallback trash directory should not be used")
+	}
+}
@@ -0,0 +1,129 @@
+package filesync
+
+import (
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// treeEntry is a regular file folded into a tree hash.
+type treeEntry struct {
+	relPath string
+	fsys    FS
+	path    string
+	info    os.FileInfo
+}
+
+// treeRoot folds the entries into a Merkle-style root: each file's
+// leaf is the hash of its slash-separated relative path, a NUL and
+// its content digest, and the root is the hash over the leaves in
+// sorted path order, all by the configured algorithm (see
+// WithHashAlgorithm).
+func (fs *FileSync) treeRoot(entries []treeEntry) (string, error) {
+	for i := range entries {
+		entries[i].relPath = filepath.ToSlash(entries[i].relPath)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].relPath < entries[j].relPath })
+
+	root := fs.newHash()
+	for _, e := range entries {
+		sum, err := fs.checksumOf(e.fsys, e.path, e.info)
+		if err != nil {
+			return "", &CompareError{Src: e.path, Err: err}
+		}
+		leaf := fs.newHash()
+		leaf.Write([]byte(e.relPath))
+		leaf.Write([]byte{0})
+		leaf.Write(sum)
+		root.Write(leaf.Sum(nil))
+	}
+	return hex.EncodeToString(root.Sum(nil)), nil
+}
+
+// hashTarget computes Stats.TreeHash for the run that just finished.
+func (fs *FileSync) hashTarget() error {
+	trees := fs.sourceTrees()
+	var entries []treeEntry
+	err := fs.walk(fs.tgtFS, fs.target, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if fs.isInternal(path) {
+			return nil
+		}
+		relPath, _ := filepath.Rel(fs.target, path)
+		if relPath == "." {
+			return nil
+		}
+		if fs.excludedEverywhere(trees, relPath, d.IsDir()) || fs.contentExcluded(fs.tgtFS, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, treeEntry{relPath: relPath, fsys: fs.tgtFS, path: path, info: info})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	hash, err := fs.treeRoot(entries)
+	if err != nil {
+		return err
+	}
+	fs.stats.TreeHash = hash
+	log.Printf("🌳 Tree hash: %s", hash)
+	return nil
+}
+
+// SourceTreeHash computes the tree hash (see WithTreeHash) of what the
+// sources hold for the target: only the files the filters let through,
+// and with several sources the file of the source that wins each path.
+// After a successful sync without transforms it equals
+// Stats().TreeHash.
+func (fs *FileSync) SourceTreeHash() (string, error) {
+	if err := fs.connect(); err != nil {
+		return "", err
+	}
+	trees := fs.sourceTrees()
+	perSource := make([][]treeEntry, len(trees))
+	for i, tree := range trees {
+		err := fs.walk(tree.fsys, tree.walkRoot("."), func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, _ := filepath.Rel(tree.root, path)
+			if relPath == "." {
+				return nil
+			}
+			if fs.excluded(tree.ignores, relPath, d.IsDir()) || fs.contentExcluded(tree.fsys, path, d) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			perSource[i] = append(perSource[i], treeEntry{relPath: relPath, fsys: tree.fsys, path: path, info: info})
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return fs.treeRoot(mergeByPath(perSource, func(e treeEntry) string { return e.relPath }, fs.firstSourceWins))
+}
@@ -0,0 +1,71 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSync_TreeHash(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", now)
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "beta", now)
+	writeTestFile(t, filepath.Join(src, "skip.log"), "excluded", now)
+	writeTestFile(t, filepath.Join(src, ".syncignore"), "*.log\n", now)
+
+	fs := NewFileSync(src, dst, false, WithTreeHash(true))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	hash := fs.Stats().TreeHash
+	if len(hash) != 64 {
+		t.Fatalf("TreeHash = %q, want a hex SHA-256", hash)
+	}
+	srcHash, err := fs.SourceTreeHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srcHash != hash {
+		t.Errorf("source hash %s differs from target hash %s", srcHash, hash)
+	}
+
+	// Same content in another mirror gives the same root
+	other := filepath.Join(tmp, "other")
+	mirror := NewFileSync(src, other, false, WithTreeHash(true))
+	if err := mirror.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := mirror.Stats().TreeHash; got != hash {
+		t.Errorf("mirror hash %s differs from %s", got, hash)
+	}
+
+	// Drift in the target changes the root
+	writeTestFile(t, filepath.Join(dst, "sub", "b.txt"), "BETA", now)
+	if err := os.Chtimes(filepath.Join(dst, "sub", "b.txt"), now, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().TreeHash; got == hash {
+		t.Error("TreeHash unchanged after the target drifted")
+	}
+}
+
+func TestFileSync_TreeHashOff(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha", time.Now())
+
+	fs := NewFileSync(src, filepath.Join(tmp, "dst"), false)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().TreeHash; got != "" {
+		t.Errorf("TreeHash = %q without WithTreeHash", got)
+	}
+}
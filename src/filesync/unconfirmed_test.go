@@ -0,0 +1,49 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyStatFS is an FS whose Lstat fails with an I/O error for paths
+// with a given base name, like a source mount that drops out briefly.
+type flakyStatFS struct {
+	FS
+	name string
+}
+
+func (f *flakyStatFS) Lstat(name string) (os.FileInfo, error) {
+	if filepath.Base(name) == f.name {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: syscall.EIO}
+	}
+	return f.FS.Lstat(name)
+}
+
+func TestFileSync_DeleteKeepsUnconfirmed(t *testing.T) {
+	now := time.Now()
+	mem := NewMemFS()
+	mem.WriteFile("/src/keep.txt", []byte("k"), now)
+	mem.WriteFile("/dst/flaky.txt", []byte("f"), now)
+	mem.WriteFile("/dst/stale.txt", []byte("s"), now)
+
+	fs := NewFileSync("/src", "/dst", true, WithSourceFS(&flakyStatFS{FS: mem, name: "flaky.txt"}), WithTargetFS(mem))
+	fs.SyncDirs()
+	if _, err := mem.Stat("/dst/flaky.txt"); err != nil {
+		t.Errorf("orphan whose source could not be stat'ed was deleted: %v", err)
+	}
+	if _, err := mem.Stat("/dst/stale.txt"); err == nil {
+		t.Error("orphan missing from the source was kept")
+	}
+	stats := fs.Stats()
+	if len(stats.Unconfirmed) != 1 || stats.Unconfirmed[0] != "flaky.txt" {
+		t.Errorf("Unconfirmed = %v, want [flaky.txt]", stats.Unconfirmed)
+	}
+	var statErr *StatError
+	if len(stats.Errors) != 1 || !errors.As(stats.Errors[0], &statErr) || !errors.Is(statErr, syscall.EIO) {
+		t.Errorf("Errors = %v, want one *StatError wrapping EIO", stats.Errors)
+	}
+}
@@ -0,0 +1,39 @@
+package filesync
+
+import (
+	"log"
+	"time"
+)
+
+// validateCopy runs the WithValidate hook on the fresh target copy of
+// job. A rejected copy is logged, recorded and, unless WithKeepInvalid
+// is set, removed; the returned *ValidationError says which. A kept
+// copy has its mod time set to the Unix epoch, so it no longer passes
+// for up to date.
+func (fs *FileSync) validateCopy(job *fileJob) error {
+	if fs.validate == nil {
+		return nil
+	}
+	err := fs.validate(job.targetPath)
+	if err == nil {
+		return nil
+	}
+	verr := &ValidationError{Path: job.targetPath, Err: err}
+	if !fs.keepInvalid {
+		if rmErr := fs.tgtFS.Remove(job.targetPath); rmErr != nil {
+			log.Printf("❌ Failed to remove %q: %v", job.targetPath, rmErr)
+		} else {
+			verr.Removed = true
+		}
+	} else if err := fs.tgtFS.Chtimes(job.targetPath, time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		log.Printf("❌ Failed to mark %q as invalid: %v", job.targetPath, err)
+	}
+	if verr.Removed {
+		log.Printf("🛑 Failed validation, removed: %q: %v", job.targetPath, err)
+	} else {
+		log.Printf("🛑 Failed validation, kept: %q: %v", job.targetPath, err)
+	}
+	fs.stats.Invalid = append(fs.stats.Invalid, job.relPath)
+	fs.recordError(verr)
+	return verr
+}
@@ -0,0 +1,85 @@
+package filesync
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Validate(t *testing.T) {
+	errBad := errors.New("bad signature")
+	for _, keep := range []bool{false, true} {
+		mem := NewMemFS()
+		now := time.Now()
+		for name, data := range map[string]string{"/src/good.txt": "good", "/src/bad.txt": "evil", "/src/sub/ok.txt": "ok"} {
+			if err := mem.WriteFile(name, []byte(data), now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var validated []string
+		validate := func(dst string) error {
+			validated = append(validated, dst)
+			data, err := mem.ReadFile(dst)
+			if err != nil {
+				return err
+			}
+			if strings.Contains(string(data), "evil") {
+				return errBad
+			}
+			return nil
+		}
+
+		fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithValidate(validate), WithKeepInvalid(keep))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatalf("keep=%v: SyncDirs() = %v", keep, err)
+		}
+		stats := fs.Stats()
+		if len(validated) != 3 {
+			t.Errorf("keep=%v: validated %v, want all three copies", keep, validated)
+		}
+		if !reflect.DeepEqual(stats.Invalid, []string{"bad.txt"}) {
+			t.Errorf("keep=%v: Invalid = %v, want [bad.txt]", keep, stats.Invalid)
+		}
+		if stats.FilesCopied != 2 {
+			t.Errorf("keep=%v: FilesCopied = %d, want 2", keep, stats.FilesCopied)
+		}
+		var verr *ValidationError
+		if len(stats.Errors) != 1 || !errors.As(stats.Errors[0], &verr) || !errors.Is(verr, errBad) {
+			t.Fatalf("keep=%v: Errors = %v, want one *ValidationError", keep, stats.Errors)
+		}
+		if verr.Removed == keep {
+			t.Errorf("keep=%v: Removed = %v", keep, verr.Removed)
+		}
+		if _, err := mem.ReadFile("/dst/bad.txt"); (err == nil) != keep {
+			t.Errorf("keep=%v: rejected copy present = %v", keep, err == nil)
+		}
+		if _, err := mem.ReadFile("/dst/good.txt"); err != nil {
+			t.Errorf("keep=%v: valid copy missing: %v", keep, err)
+		}
+
+		// The next run copies and validates the rejected file again
+		validated = nil
+		fs = NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem), WithValidate(validate), WithKeepInvalid(keep))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatalf("keep=%v: second SyncDirs() = %v", keep, err)
+		}
+		if !reflect.DeepEqual(validated, []string{"/dst/bad.txt"}) {
+			t.Errorf("keep=%v: second run validated %v, want only bad.txt", keep, validated)
+		}
+	}
+}
+
+func TestFileSync_ValidateFailOnAccessError(t *testing.T) {
+	mem := NewMemFS()
+	if err := mem.WriteFile("/src/a.txt", []byte("a"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	errBad := errors.New("rejected")
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(mem), WithTargetFS(mem),
+		WithValidate(func(string) error { return errBad }), WithFailOnAccessError(true))
+	if err := fs.SyncDirs(); !errors.Is(err, errBad) {
+		t.Errorf("SyncDirs() = %v, want the validation error", err)
+	}
+}
@@ -0,0 +1,50 @@
+package filesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrSourceVanished is returned by a sync whose source root could no
+// longer be accessed while it ran, e.g. a removable drive unplugged
+// mid-walk. No delete pass runs then, since every target file would
+// look orphaned.
+var ErrSourceVanished = errors.New("source vanished during sync")
+
+// checkSourcesPresent returns an error wrapping ErrSourceVanished if
+// the root of any of trees existed when the sync started but can no
+// longer be stat'ed. A source that was missing from the start keeps
+// its lenient handling.
+func checkSourcesPresent(trees ...sourceTree) error {
+	for _, tree := range trees {
+		if !tree.present {
+			continue
+		}
+		if _, err := tree.fsys.Stat(tree.root); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrSourceVanished, tree.root, err)
+		}
+	}
+	return nil
+}
+
+// checkSourceRoots is checkSourcesPresent for the delete pass, which
+// must not run against a source that was missing from the start
+// either, such as a share that did not mount: every target file would
+// look orphaned too. Such a source yields a *StatError.
+func checkSourceRoots(trees ...sourceTree) error {
+	if err := checkSourcesPresent(trees...); err != nil {
+		return err
+	}
+	for _, tree := range trees {
+		if !tree.present {
+			_, err := tree.fsys.Stat(tree.root)
+			if err == nil {
+				// It has turned up since; its files were not synced
+				err = os.ErrNotExist
+			}
+			return &StatError{Path: tree.root, Err: err}
+		}
+	}
+	return nil
+}
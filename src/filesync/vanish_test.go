@@ -0,0 +1,78 @@
+package filesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unplugFS is a local FS whose root disappears the moment a directory
+// named "sub" is listed, like a drive pulled out mid-walk.
+type unplugFS struct {
+	FS
+	root string
+}
+
+func (u *unplugFS) ReadDir(name string) ([]os.DirEntry, error) {
+	if filepath.Base(name) == "sub" {
+		os.RemoveAll(u.root)
+	}
+	return u.FS.ReadDir(name)
+}
+
+func TestFileSync_SourceVanished(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	old := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", old)
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b", old)
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "a", old)
+	writeTestFile(t, filepath.Join(dst, "keep.txt"), "keep", old)
+
+	fs := NewFileSync(src, dst, true, WithSourceFS(&unplugFS{FS: LocalFS(), root: src}))
+	err := fs.SyncDirs()
+	if !errors.Is(err, ErrSourceVanished) {
+		t.Fatalf("SyncDirs() = %v, want ErrSourceVanished", err)
+	}
+	if !strings.Contains(err.Error(), src) {
+		t.Errorf("error %q does not name the source", err)
+	}
+	for _, name := range []string{"a.txt", "keep.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("%s was deleted after the source vanished: %v", name, err)
+		}
+	}
+}
+
+func TestFileSync_SourceMissingFromStart(t *testing.T) {
+	tmp := t.TempDir()
+	fs := NewFileSync(filepath.Join(tmp, "nonexistent"), filepath.Join(tmp, "dst"), false)
+	if err := fs.SyncDirs(); errors.Is(err, ErrSourceVanished) {
+		t.Errorf("SyncDirs() = %v, a source missing from the start has not vanished", err)
+	}
+}
+
+func TestFileSync_SourceMissingKeepsTarget(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "a", time.Now())
+	writeTestFile(t, filepath.Join(dst, "b.txt"), "b", time.Now())
+
+	// A second source that did not mount makes everything look
+	// orphaned, so nothing is deleted
+	fs := NewFileSync(src, dst, true)
+	fs.AddSource(filepath.Join(tmp, "unmounted"))
+	var statErr *StatError
+	if err := fs.SyncDirs(); !errors.As(err, &statErr) {
+		t.Errorf("SyncDirs() = %v, want a *StatError for the missing source", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "b.txt")); err != nil {
+		t.Errorf("b.txt was deleted against a missing source: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package filesync
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// VerifyReport is the outcome of Verify. All paths are relative to the
+// source/target roots, in walk order.
+type VerifyReport struct {
+	Verified   int         // files whose content matched
+	Mismatched []DiffEntry // files whose size, content or type differ
+	Missing    []string    // in a source but not in the target
+	Extra      []string    // in the target but in no source
+
+	// Errors holds the entries that could not be checked, as a
+	// *CompareError, *StatError or *WalkError. They count as
+	// discrepancies, since nothing is known about them.
+	Errors []error
+}
+
+// OK reports whether the target was verified to match the source.
+func (r *VerifyReport) OK() bool {
+	return len(r.Mismatched) == 0 && len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Errors) == 0
+}
+
+// verifyItem is one source entry and its target counterpart.
+type verifyItem struct {
+	relPath  string
+	srcPath  string
+	srcInfo  os.FileInfo
+	tgtPath  string
+	tgtInfo  os.FileInfo // nil if missing from the target
+	reason   DiffReason
+	err      error
+	unusable bool // could not be stat'ed; already reported
+}
+
+// Verify audits an existing copy: every file present on both sides is
+// compared by checksum (see WithHashAlgorithm), whatever the
+// configured comparator,
+// and files missing from the target or present only there are
+// reported. Nothing is written, not even the checksum cache, whose
+// digests are not trusted either, so silent corruption of a file with
+// unchanged size and mod time is found too. Hashing is spread over
+// the WithWorkers pool. .syncignore rules are honored, and with
+// several sources each path is judged by the source that would win it
+// during a sync.
+//
+// Per-entry problems are collected in the report; the returned error
+// is for failures to connect and for ctx being cancelled.
+func (fs *FileSync) Verify(ctx context.Context) (*VerifyReport, error) {
+	if err := fs.connect(); err != nil {
+		return nil, err
+	}
+	if err := fs.checkHashAlgorithm(); err != nil {
+		return nil, err
+	}
+	if err := fs.loadTransforms(); err != nil {
+		return nil, err
+	}
+	checksum, cache := fs.checksum, fs.checksums
+	fs.checksum, fs.checksums, fs.hashCtx = true, nil, ctx
+	defer func() { fs.checksum, fs.checksums, fs.hashCtx = checksum, cache, nil }()
+
+	report := &VerifyReport{}
+	trees := fs.sourceTrees()
+	perSource := make([][]*verifyItem, len(trees))
+	for i, tree := range trees {
+		items, err := fs.verifySource(ctx, tree, report)
+		if err != nil {
+			return nil, err
+		}
+		perSource[i] = items
+	}
+	items := mergeByPath(perSource, func(it *verifyItem) string { return it.relPath }, fs.firstSourceWins)
+
+	if err := fs.verifyContents(ctx, items); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		switch {
+		case item.unusable:
+		case item.tgtInfo == nil:
+			report.Missing = append(report.Missing, item.relPath)
+		case item.err != nil:
+			log.Printf("❌ Could not verify %q against %q: %v", item.srcPath, item.tgtPath, item.err)
+			report.Errors = append(report.Errors, &CompareError{Src: item.srcPath, Dst: item.tgtPath, Err: item.err})
+		case item.reason != "":
+			log.Printf("⚠️ Mismatch (%s): %q", item.reason, item.tgtPath)
+			report.Mismatched = append(report.Mismatched, DiffEntry{Path: item.relPath, Reason: item.reason})
+		case !item.srcInfo.IsDir():
+			report.Verified++
+		}
+	}
+
+	extra, err := fs.onlyInTarget(ctx, trees, func(err error) {
+		report.Errors = append(report.Errors, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Extra = extra
+	return report, nil
+}
+
+// verifySource walks one source tree and pairs each entry with its
+// target counterpart, in walk order. Entries that cannot be read are
+// added to report.Errors.
+func (fs *FileSync) verifySource(ctx context.Context, tree sourceTree, report *VerifyReport) ([]*verifyItem, error) {
+	var items []*verifyItem
+
+	err := fs.walk(tree.fsys, tree.walkRoot("."), func(path string, d os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			log.Printf("Error accessing %q: %v", path, err)
+			report.Errors = append(report.Errors, &WalkError{Path: path, Err: err})
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(tree.root, path)
+		if relPath == "." {
+			return nil
+		}
+		if fs.excluded(tree.ignores, relPath, d.IsDir()) || fs.contentExcluded(tree.fsys, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Special files have no content to verify, see syncSpecial
+		if isSpecial(d.Type()) {
+			return nil
+		}
+		item := &verifyItem{relPath: relPath, srcPath: path, tgtPath: filepath.Join(fs.target, relPath)}
+		items = append(items, item)
+
+		if item.srcInfo, err = d.Info(); err != nil {
+			log.Printf("❌ Could not read file info for %q: %v", path, err)
+			report.Errors = append(report.Errors, &StatError{Path: path, Err: err})
+			item.unusable = true
+			return nil
+		}
+		item.tgtInfo, err = fs.tgtFS.Stat(item.tgtPath)
+		if os.IsNotExist(err) {
+			item.tgtInfo = nil
+			return nil
+		}
+		if err != nil {
+			log.Printf("❌ Problem reading %q: %v", item.tgtPath, err)
+			report.Errors = append(report.Errors, &StatError{Path: item.tgtPath, Err: err})
+			item.unusable = true
+			return nil
+		}
+		if d.IsDir() != item.tgtInfo.IsDir() {
+			item.reason = ReasonType
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+// verifyContents compares the files present on both sides, hashing
+// them on the worker pool like compareJobs does for a sync.
+func (fs *FileSync) verifyContents(ctx context.Context, items []*verifyItem) error {
+	pending := make(chan *verifyItem)
+	var wg sync.WaitGroup
+
+	for i := 0; i < fs.workerCount(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range pending {
+				releaseDir := fs.acquireDir(item.tgtPath)
+				release := fs.acquireFiles()
+				item.reason, item.err = fs.compareFiles(item.srcPath, item.tgtPath, item.srcInfo, item.tgtInfo)
+				release()
+				releaseDir()
+			}
+		}()
+	}
+
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		if !item.unusable && item.tgtInfo != nil && item.reason == "" && !item.srcInfo.IsDir() {
+			pending <- item
+		}
+	}
+	close(pending)
+	wg.Wait()
+	return ctx.Err()
+}
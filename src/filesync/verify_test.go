@@ -0,0 +1,113 @@
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSync_Verify(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+
+	writeTestFile(t, filepath.Join(src, "same.txt"), "same", now)
+	writeTestFile(t, filepath.Join(src, "dir", "rot.txt"), "good", now)
+	writeTestFile(t, filepath.Join(src, "new.txt"), "new", now)
+
+	fs := NewFileSync(src, dst, false)
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := fs.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Verified != 3 {
+		t.Fatalf("fresh copy: report = %+v, want OK with 3 verified", report)
+	}
+
+	// Bit rot keeps size and mod time, so only a checksum can find it
+	writeTestFile(t, filepath.Join(dst, "dir", "rot.txt"), "gooD", now)
+	if err := os.Remove(filepath.Join(dst, "new.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dst, "extra.txt"), "extra", now)
+
+	report, err = fs.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() {
+		t.Fatal("report is OK despite discrepancies")
+	}
+	if report.Verified != 1 {
+		t.Errorf("Verified = %d, want 1", report.Verified)
+	}
+	wantMismatch := []DiffEntry{{Path: filepath.Join("dir", "rot.txt"), Reason: ReasonContent}}
+	if !reflect.DeepEqual(report.Mismatched, wantMismatch) {
+		t.Errorf("Mismatched = %v, want %v", report.Mismatched, wantMismatch)
+	}
+	if want := []string{"new.txt"}; !reflect.DeepEqual(report.Missing, want) {
+		t.Errorf("Missing = %v, want %v", report.Missing, want)
+	}
+	if want := []string{"extra.txt"}; !reflect.DeepEqual(report.Extra, want) {
+		t.Errorf("Extra = %v, want %v", report.Extra, want)
+	}
+	if len(report.Errors) > 0 {
+		t.Errorf("unexpected errors: %v", report.Errors)
+	}
+
+	// Verify is read-only
+	data, err := os.ReadFile(filepath.Join(dst, "dir", "rot.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "gooD" {
+		t.Errorf("Verify modified the target: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("Verify restored a missing file, stat err = %v", err)
+	}
+}
+
+func TestFileSync_VerifyIgnoresChecksumCache(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	now := time.Now()
+	writeTestFile(t, filepath.Join(src, "a.txt"), "abcd", now)
+
+	fs := NewFileSync(src, dst, false, WithChecksum(true), WithChecksumCacheFile(filepath.Join(tmp, "cache.json")))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SyncDirs(); err != nil { // fills the cache for both sides
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "abcD", now)
+
+	report, err := fs.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Mismatched) != 1 {
+		t.Errorf("Mismatched = %v, want a.txt: cached digests must not be trusted", report.Mismatched)
+	}
+}
+
+func TestFileSync_VerifyCancelled(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a", time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewFileSync(src, filepath.Join(tmp, "dst"), false).Verify(ctx); err != context.Canceled {
+		t.Errorf("Verify with cancelled ctx = %v, want context.Canceled", err)
+	}
+}
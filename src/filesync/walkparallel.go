@@ -0,0 +1,265 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// walkQueuePerWorker caps the work a parallel walk queues ahead, per
+// worker. Past it, files are stat'ed and directories listed when the
+// walk reaches them, so a huge tree is not held in memory at once.
+const walkQueuePerWorker = 256
+
+// walkNode is a directory listed ahead of a parallel walk. Its
+// entries are sorted like a sequential walk would see them; done is
+// closed once they, and the stats of its files, are available.
+type walkNode struct {
+	path     string
+	parent   *walkNode
+	entries  []os.DirEntry
+	children map[string]*walkNode // subdirectories, by name
+	err      error                // from listing the directory
+	pending  atomic.Int64         // listing plus file stats still running
+	skipped  atomic.Bool
+	deferred bool // the queue was full, so the walk lists it itself
+	done     chan struct{}
+}
+
+// statEntry is a directory entry carrying the result of stat'ing the
+// path, fetched while the walk was still elsewhere (see statOf).
+type statEntry struct {
+	os.DirEntry
+	info os.FileInfo
+	err  error
+}
+
+// finish marks one piece of work on n as done.
+func (n *walkNode) finish() {
+	if n.pending.Add(-1) == 0 {
+		close(n.done)
+	}
+}
+
+// abandoned reports whether n or a directory above it was skipped,
+// so listing below it is wasted work.
+func (n *walkNode) abandoned() bool {
+	for ; n != nil; n = n.parent {
+		if n.skipped.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// parallelWalker lists directories (and optionally stats files) with a
+// bounded pool of goroutines ahead of a walk that still calls fn
+// sequentially, in the same order and with the same errors as
+// walkDirOrdered. On high-latency filesystems the round trips overlap
+// instead of adding up.
+type parallelWalker struct {
+	fsys      FS
+	less      func(a, b string) bool
+	statFiles bool
+	prefetch  func(path string) // run for every entry, if set, before it is visited
+	stopped   atomic.Bool
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	queue []func()
+	limit int // of queued tasks
+	wg    sync.WaitGroup
+}
+
+// walkDirParallel is walkDirOrdered with directory listings, and with
+// statFiles the stats of files, fetched by up to workers goroutines.
+// A non-nil prefetch is also run on the pool for the path of every
+// entry below root, done before fn sees the entry. At most
+// walkQueuePerWorker tasks per worker are queued ahead at a time.
+func walkDirParallel(fsys FS, root string, less func(a, b string) bool, workers int, statFiles bool, prefetch func(path string), fn func(path string, d os.DirEntry, err error) error) error {
+	if less == nil {
+		less = func(a, b string) bool { return a < b }
+	}
+	w := &parallelWalker{fsys: fsys, less: less, statFiles: statFiles, prefetch: prefetch, limit: workers * walkQueuePerWorker}
+	w.cond = sync.NewCond(&w.mu)
+	for range workers {
+		w.wg.Add(1)
+		go w.work()
+	}
+	defer w.close()
+
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		var node *walkNode
+		if info.IsDir() {
+			node = w.list(root, nil)
+		}
+		err = w.visit(root, dirEntry{info}, node, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// work runs queued tasks until the walker is closed.
+func (w *parallelWalker) work() {
+	defer w.wg.Done()
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.stopped.Load() {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		task := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+		task()
+	}
+}
+
+// enqueue schedules task on the pool and reports whether it did,
+// which it does not while the queue is full.
+func (w *parallelWalker) enqueue(task func()) bool {
+	w.mu.Lock()
+	if len(w.queue) >= w.limit {
+		w.mu.Unlock()
+		return false
+	}
+	w.queue = append(w.queue, task)
+	w.mu.Unlock()
+	w.cond.Signal()
+	return true
+}
+
+// close stops the pool once the walk is over; remaining tasks only
+// release their nodes.
+func (w *parallelWalker) close() {
+	w.stopped.Store(true)
+	w.cond.Broadcast()
+	w.wg.Wait()
+}
+
+// list returns a node for the directory at path whose listing is
+// queued on the pool, or deferred to the walk if the queue is full.
+func (w *parallelWalker) list(path string, parent *walkNode) *walkNode {
+	n := &walkNode{path: path, parent: parent, done: make(chan struct{})}
+	n.pending.Store(1)
+	n.deferred = !w.enqueue(func() { w.load(n) })
+	return n
+}
+
+// load lists n, queues listings of its subdirectories and stats of
+// its files.
+func (w *parallelWalker) load(n *walkNode) {
+	defer n.finish()
+	if w.stopped.Load() || n.abandoned() {
+		return
+	}
+	entries, err := w.fsys.ReadDir(n.path)
+	n.err = err
+	sort.Slice(entries, func(i, j int) bool { return w.less(entries[i].Name(), entries[j].Name()) })
+
+	n.children = make(map[string]*walkNode)
+	for i, entry := range entries {
+		path := filepath.Join(n.path, entry.Name())
+		// Work the queue has no room for is left to the walk; load's
+		// own pending piece keeps n from finishing meanwhile
+		if w.prefetch != nil {
+			n.pending.Add(1)
+			queued := w.enqueue(func() {
+				defer n.finish()
+				if !w.stopped.Load() && !n.abandoned() {
+					w.prefetch(path)
+				}
+			})
+			if !queued {
+				n.pending.Add(-1)
+			}
+		}
+		if entry.IsDir() {
+			n.children[entry.Name()] = w.list(path, n)
+			continue
+		}
+		if !w.statFiles {
+			continue
+		}
+		se := &statEntry{DirEntry: entry}
+		n.pending.Add(1)
+		queued := w.enqueue(func() {
+			defer n.finish()
+			if w.stopped.Load() || n.abandoned() {
+				return
+			}
+			se.info, se.err = w.fsys.Stat(path)
+		})
+		if queued {
+			entries[i] = se
+		} else {
+			n.pending.Add(-1)
+		}
+	}
+	n.entries = entries
+}
+
+// visit calls fn for path and, for directories, everything below it,
+// like walkDirEntry but waiting for node's prefetched listing.
+func (w *parallelWalker) visit(path string, d os.DirEntry, node *walkNode, fn func(string, os.DirEntry, error) error) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			if node != nil {
+				node.skipped.Store(true)
+			}
+			err = nil
+		}
+		return err
+	}
+	if node == nil {
+		return nil
+	}
+
+	if node.deferred {
+		w.load(node)
+	}
+	<-node.done
+	if node.err != nil {
+		// Second call, to report the ReadDir error
+		if err := fn(path, d, node.err); err != nil {
+			if err == filepath.SkipDir {
+				node.skipped.Store(true)
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, entry := range node.entries {
+		child := node.children[entry.Name()]
+		if err := w.visit(filepath.Join(path, entry.Name()), entry, child, fn); err != nil {
+			if err == filepath.SkipDir {
+				node.skipped.Store(true)
+				break
+			}
+			return err
+		}
+		// Let visited subtrees be collected
+		delete(node.children, entry.Name())
+	}
+	return nil
+}
+
+// statOf stats path, reusing the result a parallel walk fetched for d
+// if there is one.
+func statOf(fsys FS, path string, d os.DirEntry) (os.FileInfo, error) {
+	if se, ok := d.(*statEntry); ok && (se.info != nil || se.err != nil) {
+		return se.info, se.err
+	}
+	return fsys.Stat(path)
+}
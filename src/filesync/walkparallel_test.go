@@ -0,0 +1,177 @@
+package filesync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowFS is a MemFS where every directory listing and stat takes a
+// while, like a network mount, and which counts calls in flight.
+type slowFS struct {
+	*MemFS
+	latency  time.Duration
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (s *slowFS) wait() func() {
+	n := s.inFlight.Add(1)
+	for {
+		peak := s.peak.Load()
+		if n <= peak || s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(s.latency)
+	return func() { s.inFlight.Add(-1) }
+}
+
+func (s *slowFS) ReadDir(name string) ([]os.DirEntry, error) {
+	defer s.wait()()
+	return s.MemFS.ReadDir(name)
+}
+
+func (s *slowFS) Stat(name string) (os.FileInfo, error) {
+	defer s.wait()()
+	return s.MemFS.Stat(name)
+}
+
+func TestWalkDirParallel_SameOrder(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	for _, name := range []string{"/root/b.txt", "/root/a/x.txt", "/root/a/y/z.txt", "/root/skip/no.txt", "/root/c/d.txt", "/root/c/e.txt"} {
+		if err := mem.WriteFile(name, []byte(name), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collect := func(walk func(fn func(string, os.DirEntry, error) error) error) []string {
+		var seen []string
+		err := walk(func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen = append(seen, path)
+			switch filepath.Base(path) {
+			case "skip":
+				return filepath.SkipDir
+			case "d.txt":
+				return filepath.SkipDir // skips the rest of c
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return seen
+	}
+
+	want := collect(func(fn func(string, os.DirEntry, error) error) error { return walkDir(mem, "/root", fn) })
+	for _, statFiles := range []bool{false, true} {
+		got := collect(func(fn func(string, os.DirEntry, error) error) error {
+			return walkDirParallel(mem, "/root", nil, 4, statFiles, nil, fn)
+		})
+		if !slices.Equal(got, want) {
+			t.Errorf("statFiles=%v: visited %v, want %v", statFiles, got, want)
+		}
+	}
+}
+
+func TestFileSync_ParallelWalk(t *testing.T) {
+	mem := NewMemFS()
+	old := time.Now().Add(-time.Hour)
+	for i := range 4 {
+		for j := range 4 {
+			name := filepath.Join("/src", string(rune('a'+i)), string(rune('a'+j))+".txt")
+			if err := mem.WriteFile(name, []byte(name), old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	src := &slowFS{MemFS: mem, latency: 5 * time.Millisecond}
+
+	fs := NewFileSync("/src", "/dst", false, WithSourceFS(src), WithTargetFS(mem), WithParallelWalk(8))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().FilesCopied; got != 16 {
+		t.Errorf("FilesCopied = %d, want 16", got)
+	}
+	if err := fs.Stats().Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+	if peak := src.peak.Load(); peak < 2 {
+		t.Errorf("at most %d source calls ran at once, want overlap", peak)
+	}
+	data, err := mem.ReadFile("/dst/c/b.txt")
+	if err != nil || string(data) != "/src/c/b.txt" {
+		t.Errorf("/dst/c/b.txt = %q, %v", data, err)
+	}
+}
+
+// countingFS is a MemFS that counts stats and listings.
+type countingFS struct {
+	*MemFS
+	calls atomic.Int32
+}
+
+func (c *countingFS) ReadDir(name string) ([]os.DirEntry, error) {
+	c.calls.Add(1)
+	return c.MemFS.ReadDir(name)
+}
+
+func (c *countingFS) Stat(name string) (os.FileInfo, error) {
+	c.calls.Add(1)
+	return c.MemFS.Stat(name)
+}
+
+func TestWalkDirParallel_BoundedQueue(t *testing.T) {
+	mem := NewMemFS()
+	now := time.Now()
+	n := 4 * walkQueuePerWorker
+	for i := range n {
+		for _, name := range []string{fmt.Sprintf("/root/f%04d.txt", i), fmt.Sprintf("/root/d%04d/x.txt", i)} {
+			if err := mem.WriteFile(name, nil, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fsys := &countingFS{MemFS: mem}
+
+	// While the walk waits at the root, the pool runs ahead only as
+	// far as the queue allows: the root's listing fills it with the
+	// first subdirectories, whose listings each queue one stat, and
+	// the rest is left to the walk
+	var ahead int32
+	var got []string
+	err := walkDirParallel(fsys, "/root", nil, 1, true, nil, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path == "/root" {
+			time.Sleep(100 * time.Millisecond)
+			ahead = fsys.calls.Load()
+		}
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit := int32(2*walkQueuePerWorker + 1); ahead > limit {
+		t.Errorf("%d calls ran ahead of the walk, want at most %d", ahead, limit)
+	}
+
+	var want []string
+	walkDir(mem, "/root", func(path string, d os.DirEntry, err error) error {
+		want = append(want, path)
+		return nil
+	})
+	if !slices.Equal(got, want) {
+		t.Errorf("visited %d paths, want the %d of a serial walk in order", len(got), len(want))
+	}
+}
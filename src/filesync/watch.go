@@ -0,0 +1,259 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultWatchDebounce is how long Watch waits for a burst of events
+// to settle before syncing.
+const defaultWatchDebounce = 500 * time.Millisecond
+
+// lockedRetryInterval is how long Watch waits before trying files
+// skipped as locked again (see WithSkipLocked).
+const lockedRetryInterval = 30 * time.Second
+
+// watchRetryInterval is how long Watch waits before trying again to
+// watch directories it could not, e.g. at the system's watch limit.
+const watchRetryInterval = time.Minute
+
+// WatchCycle is one sync of Watch, reported to the callback set with
+// WithWatchCycle.
+type WatchCycle struct {
+	Scopes   []string // paths synced, relative to the roots; "." is the whole tree
+	Stats    Stats
+	Duration time.Duration
+}
+
+// Watch performs an initial sync and then keeps the target in sync
+// with the sources until ctx is done, at which point it returns nil.
+//
+// Filesystem events are collected per relative path and debounced
+// (see WithWatchDebounce), so a flurry of edits results in a single
+// incremental sync of just the affected paths. Directories created
+// while watching are added to the watch set automatically. A sync in
+// progress when ctx is done stops after the file being copied, as
+// with SyncDirsContext. Watcher errors, such as lost events, are
+// logged and answered with a sync of the whole tree; directories that
+// cannot be watched, e.g. at the inotify watch limit, are tried again
+// every minute, each time with a full sync to catch what was missed.
+// An error is returned if the watcher cannot be set up or a sync is
+// aborted. The target may be remote, but the sources must be local.
+func (fs *FileSync) Watch(ctx context.Context) error {
+	// Change notifications only exist for local directories
+	if err := fs.connect(); err != nil {
+		return err
+	}
+	if _, local := baseFS(fs.srcFS).(osFS); !local {
+		return errors.New("watch mode requires local sources")
+	}
+	if fs.swap {
+		return errors.New("watch mode cannot swap directories")
+	}
+	stop, err := fs.serveStatus()
+	if err != nil {
+		return err
+	}
+	defer stop()
+	fs.runCtx, fs.syncCtx = ctx, ctx
+	defer func() { fs.runCtx, fs.syncCtx = nil, nil }()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	trees := fs.sourceTrees()
+	rewatch := time.NewTimer(watchRetryInterval)
+	if fs.watchTrees(watcher, trees) == 0 {
+		rewatch.Stop()
+	}
+
+	if err := fs.watchSync([]string{"."}); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	log.Printf("👀 Watching %d source(s) for changes", len(trees))
+
+	pending := map[string]bool{}
+	debounce := time.NewTimer(fs.watchDebounce)
+	debounce.Stop()
+	fs.retryLocked(pending, debounce)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Permission-only changes do not affect content
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			tree, relPath, ok := locateInTrees(trees, event.Name)
+			if !ok {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Lstat(event.Name); err == nil && info.IsDir() && fs.watchTree(watcher, tree, event.Name) > 0 {
+					rewatch.Reset(watchRetryInterval)
+				}
+			}
+			pending[relPath] = true
+			debounce.Reset(fs.watchDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			// Events may have been lost: watch again and resync all
+			log.Printf("❌ Watch error, resyncing the whole tree: %v", err)
+			rewatch.Reset(fs.watchDebounce)
+
+		case <-rewatch.C:
+			if fs.watchTrees(watcher, trees) > 0 {
+				rewatch.Reset(watchRetryInterval)
+			}
+			pending["."] = true
+			debounce.Reset(fs.watchDebounce)
+
+		case <-debounce.C:
+			scopes := collapseScopes(pending)
+			pending = map[string]bool{}
+			if err := fs.watchSync(scopes); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			stats := fs.Stats()
+			log.Printf("🔄 Synced %d changed path(s): %d copied, %d deleted, %d error(s)",
+				len(scopes), stats.FilesCopied, stats.FilesDeleted, len(stats.Errors))
+			fs.retryLocked(pending, debounce)
+		}
+	}
+}
+
+// WatchContext is Watch, named like SyncDirsContext for callers that
+// look for the context-aware variant; Watch itself takes the context.
+func (fs *FileSync) WatchContext(ctx context.Context) error {
+	return fs.Watch(ctx)
+}
+
+// watchSync runs one sync of Watch over scopes and reports it to the
+// WithWatchCycle callback.
+func (fs *FileSync) watchSync(scopes []string) error {
+	start := time.Now()
+	err := fs.syncScopes(scopes)
+	if err == nil && fs.onWatchCycle != nil {
+		fs.onWatchCycle(WatchCycle{Scopes: scopes, Stats: fs.Stats(), Duration: time.Since(start)})
+	}
+	return err
+}
+
+// watchTrees adds the directories of every tree to the watcher and
+// returns how many could not be watched.
+func (fs *FileSync) watchTrees(watcher *fsnotify.Watcher, trees []sourceTree) int {
+	failed := 0
+	for _, tree := range trees {
+		failed += fs.watchTree(watcher, tree, tree.root)
+	}
+	if failed > 0 {
+		log.Printf("⚠️ %d director(ies) are not watched; trying again in %s", failed, watchRetryInterval)
+	}
+	return failed
+}
+
+// retryLocked schedules the files the last pass skipped as locked for
+// another pass after lockedRetryInterval, unless changes come sooner.
+func (fs *FileSync) retryLocked(pending map[string]bool, debounce *time.Timer) {
+	locked := fs.stats.Locked
+	if len(locked) == 0 {
+		return
+	}
+	for _, relPath := range locked {
+		pending[relPath] = true
+	}
+	debounce.Reset(lockedRetryInterval)
+}
+
+// watchTree adds dir and every non-excluded directory below it
+// to the watcher, and returns how many could not be watched, which
+// are logged. For a single-file source only its directory is watched.
+func (fs *FileSync) watchTree(watcher *fsnotify.Watcher, tree sourceTree, dir string) int {
+	if tree.file != "" {
+		if err := watcher.Add(tree.root); err != nil {
+			log.Printf("❌ Could not watch %q: %v", tree.root, err)
+			return 1
+		}
+		return 0
+	}
+	failed := 0
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		relPath, _ := filepath.Rel(tree.root, path)
+		if fs.excluded(tree.ignores, relPath, true) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			log.Printf("❌ Could not watch %q: %v", path, err)
+			failed++
+		}
+		return nil
+	})
+	return failed
+}
+
+// locateInTrees finds the source tree containing path and returns
+// path relative to that tree's root.
+func locateInTrees(trees []sourceTree, path string) (sourceTree, string, bool) {
+	for _, tree := range trees {
+		relPath, err := filepath.Rel(tree.root, path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) || !tree.holds(relPath) {
+			continue
+		}
+		return tree, relPath, true
+	}
+	return sourceTree{}, "", false
+}
+
+// collapseScopes returns the pending paths in sorted order, dropping
+// any path already covered by a pending ancestor.
+func collapseScopes(pending map[string]bool) []string {
+	paths := make([]string, 0, len(pending))
+	for p := range pending {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var scopes []string
+	for _, p := range paths {
+		covered := false
+		for _, s := range scopes {
+			if withinScope(p, s) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			scopes = append(scopes, p)
+		}
+	}
+	return scopes
+}
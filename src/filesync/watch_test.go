@@ -0,0 +1,136 @@
+package filesync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or the timeout expires.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestFileSync_Watch(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "initial.txt"), "initial", time.Now())
+
+	fs := NewFileSync(src, dst, true, WithWatchDebounce(50*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- fs.Watch(ctx) }()
+
+	waitFor(t, "initial sync", func() bool { return exists(filepath.Join(dst, "initial.txt")) })
+
+	// new files, including ones in freshly created directories
+	writeTestFile(t, filepath.Join(src, "added.txt"), "added", time.Now())
+	waitFor(t, "added.txt", func() bool { return exists(filepath.Join(dst, "added.txt")) })
+
+	if err := os.MkdirAll(filepath.Join(src, "newdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "newdir", func() bool { return exists(filepath.Join(dst, "newdir")) })
+	writeTestFile(t, filepath.Join(src, "newdir", "nested.txt"), "nested", time.Now())
+	waitFor(t, "newdir/nested.txt", func() bool { return exists(filepath.Join(dst, "newdir", "nested.txt")) })
+
+	// deletions propagate with delete-missing
+	if err := os.Remove(filepath.Join(src, "initial.txt")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "initial.txt removal", func() bool { return !exists(filepath.Join(dst, "initial.txt")) })
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected nil on cancel, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not return after cancel")
+	}
+}
+
+func TestCollapseScopes(t *testing.T) {
+	pending := map[string]bool{
+		"b":                         true,
+		filepath.Join("a", "x.txt"): true,
+		"a":                         true,
+		filepath.Join("b2", "y"):    true,
+	}
+	want := []string{"a", "b", filepath.Join("b2", "y")}
+	if got := collapseScopes(pending); !reflect.DeepEqual(got, want) {
+		t.Errorf("collapseScopes = %v, want %v", got, want)
+	}
+}
+
+func TestFileSync_WatchContextCoalesces(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	writeTestFile(t, filepath.Join(src, "initial.txt"), "initial", time.Now())
+
+	var mu sync.Mutex
+	var cycles []WatchCycle
+	fs := NewFileSync(src, dst, true, WithWatchDebounce(300*time.Millisecond), WithWatchCycle(func(c WatchCycle) {
+		mu.Lock()
+		cycles = append(cycles, c)
+		mu.Unlock()
+	}))
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(cycles)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- fs.WatchContext(ctx) }()
+	waitFor(t, "initial sync", func() bool { return count() == 1 })
+
+	// A burst of writes, in a new directory too, is synced at once
+	for i := range 10 {
+		writeTestFile(t, filepath.Join(src, "burst", fmt.Sprintf("f%d.txt", i)), "x", time.Now())
+	}
+	waitFor(t, "burst sync", func() bool { return count() == 2 })
+	time.Sleep(500 * time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected nil on cancel, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchContext did not return after cancel")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(cycles) != 2 {
+		t.Fatalf("%d sync cycles, want the initial one and one for the burst", len(cycles))
+	}
+	if !reflect.DeepEqual(cycles[0].Scopes, []string{"."}) || cycles[0].Stats.FilesCopied != 1 {
+		t.Errorf("initial cycle = %+v", cycles[0])
+	}
+	if got := cycles[1].Stats.FilesCopied; got != 10 {
+		t.Errorf("burst cycle copied %d files, want 10", got)
+	}
+}
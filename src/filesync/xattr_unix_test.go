@@ -0,0 +1,74 @@
+//go:build linux || darwin
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFileSync_Xattrs(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		tmp := t.TempDir()
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		writeTestFile(t, filepath.Join(src, "a.txt"), "hello", time.Now())
+		if err := unix.Setxattr(filepath.Join(src, "a.txt"), "user.filesync.test", []byte("tagged"), 0); err != nil {
+			t.Skipf("xattrs not supported here: %v", err)
+		}
+
+		fs := NewFileSync(src, dst, false, WithXattrs(true), WithAtomicCopy(atomic))
+		if err := fs.SyncDirs(); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Stats().Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := getXattr(filepath.Join(dst, "a.txt"), "user.filesync.test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != "tagged" {
+			t.Errorf("atomic=%v: xattr = %q, want tagged", atomic, value)
+		}
+	}
+}
+
+func TestFileSync_XattrsCrossDeviceTempDir(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	tempDir := filepath.Join(tmp, "staging")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "hello", time.Now())
+	if err := unix.Setxattr(filepath.Join(src, "a.txt"), "user.filesync.test", []byte("tagged"), 0); err != nil {
+		t.Skipf("xattrs not supported here: %v", err)
+	}
+
+	// The staged copy cannot be renamed into the target, so it is
+	// copied there instead
+	rename := renameStaged
+	defer func() { renameStaged = rename }()
+	renameStaged = func(fsys FS, stage, dst string) error {
+		if filepath.Dir(stage) == tempDir {
+			return &os.LinkError{Op: "rename", Old: stage, New: dst, Err: syscall.EXDEV}
+		}
+		return rename(fsys, stage, dst)
+	}
+
+	fs := NewFileSync(src, dst, false, WithXattrs(true), WithTempDir(tempDir))
+	if err := fs.SyncDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Stats().Err(); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := getXattr(filepath.Join(dst, "a.txt"), "user.filesync.test"); err != nil || string(value) != "tagged" {
+		t.Errorf("xattr = %q, %v; want tagged", value, err)
+	}
+}